@@ -0,0 +1,110 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// AnalyticsScalar is the single value returned by an aggregation query, such as SELECT VALUE COUNT(*) or
+// SELECT SUM(price) AS total.  Its accessors parse the raw value directly rather than decoding it into a struct.
+type AnalyticsScalar struct {
+	raw json.RawMessage
+}
+
+// Raw returns the JSON encoded value.
+func (s AnalyticsScalar) Raw() []byte {
+	return s.raw
+}
+
+// IsNull returns whether the value is null, which aggregations over no rows, such as SUM, return.
+func (s AnalyticsScalar) IsNull() bool {
+	return bytes.Equal(s.raw, []byte("null"))
+}
+
+// Int64 returns the value as an integer, failing if it is not a number or has a fractional part.
+func (s AnalyticsScalar) Int64() (int64, error) {
+	val, err := strconv.ParseInt(string(s.raw), 10, 64)
+	if err == nil {
+		return val, nil
+	}
+
+	// Whole numbers are sometimes returned in exponent form, e.g. 1e+06.
+	f, ferr := strconv.ParseFloat(string(s.raw), 64)
+	if ferr != nil || f != float64(int64(f)) {
+		return 0, errors.Errorf("analytics value %s is not an integer", s.raw)
+	}
+	return int64(f), nil
+}
+
+// Float64 returns the value as a floating point number, failing if it is not a number.
+func (s AnalyticsScalar) Float64() (float64, error) {
+	val, err := strconv.ParseFloat(string(s.raw), 64)
+	if err != nil {
+		return 0, errors.Errorf("analytics value %s is not a number", s.raw)
+	}
+	return val, nil
+}
+
+// Str returns the value as a string, failing if it is not a string.  It is not named String so that
+// AnalyticsScalar does not appear to implement fmt.Stringer.
+func (s AnalyticsScalar) Str() (string, error) {
+	if len(s.raw) == 0 || s.raw[0] != '"' {
+		return "", errors.Errorf("analytics value %s is not a string", s.raw)
+	}
+
+	var val string
+	err := json.Unmarshal(s.raw, &val)
+	if err != nil {
+		return "", err
+	}
+	return val, nil
+}
+
+// Bool returns the value as a boolean, failing if it is not a boolean.
+func (s AnalyticsScalar) Bool() (bool, error) {
+	switch string(s.raw) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, errors.Errorf("analytics value %s is not a boolean", s.raw)
+}
+
+// ScalarValue returns the value of the first row of a query which returns a single value, and closes the
+// results.  The row can be the value itself, as returned by SELECT VALUE, or an object with a single field, as
+// returned by SELECT COUNT(*) AS count.  It fails with ErrNoResults if there are no rows.
+func (r *AnalyticsResults) ScalarValue() (AnalyticsScalar, error) {
+	row := r.NextBytes()
+	if row == nil {
+		err := r.Close()
+		if err != nil {
+			return AnalyticsScalar{}, err
+		}
+		return AnalyticsScalar{}, ErrNoResults
+	}
+
+	// Ignore any errors occurring after we already have our result
+	r.rows.rows = nil
+	r.Close()
+
+	row = bytes.TrimSpace(row)
+	if len(row) > 0 && row[0] == '{' {
+		var fields map[string]json.RawMessage
+		err := json.Unmarshal(row, &fields)
+		if err != nil {
+			return AnalyticsScalar{}, err
+		}
+		if len(fields) != 1 {
+			return AnalyticsScalar{}, errors.Errorf("analytics row has %d fields rather than a single value", len(fields))
+		}
+		for _, value := range fields {
+			row = bytes.TrimSpace(value)
+		}
+	}
+
+	return AnalyticsScalar{raw: row}, nil
+}
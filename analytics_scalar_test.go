@@ -0,0 +1,59 @@
+package gocb
+
+import (
+	"testing"
+)
+
+func testAnalyticsResults(rows ...string) *AnalyticsResults {
+	return &AnalyticsResults{rows: &analyticsRows{index: -1, rows: testRawRows(rows)}}
+}
+
+func TestAnalyticsResultsScalarValue(t *testing.T) {
+	count, err := testAnalyticsResults(`42`).ScalarValue()
+	if err != nil {
+		t.Fatalf("Expected scalar value but was %v", err)
+	}
+	if val, err := count.Int64(); err != nil || val != 42 {
+		t.Fatalf("Expected 42 but was %d (%v)", val, err)
+	}
+
+	res := testAnalyticsResults(`{"total": 12.5}`, `{"total": 1}`)
+	sum, err := res.ScalarValue()
+	if err != nil {
+		t.Fatalf("Expected scalar value but was %v", err)
+	}
+	if val, err := sum.Float64(); err != nil || val != 12.5 {
+		t.Fatalf("Expected 12.5 but was %f (%v)", val, err)
+	}
+	if _, err := sum.Int64(); err == nil {
+		t.Fatalf("Expected fractional value not to be an integer")
+	}
+	if !res.rows.closed {
+		t.Fatalf("Expected results to be closed")
+	}
+
+	large, _ := testAnalyticsResults(`1e+06`).ScalarValue()
+	if val, err := large.Int64(); err != nil || val != 1000000 {
+		t.Fatalf("Expected 1000000 but was %d (%v)", val, err)
+	}
+
+	name, _ := testAnalyticsResults(`{"name":"beer"}`).ScalarValue()
+	if val, err := name.Str(); err != nil || val != "beer" {
+		t.Fatalf("Expected beer but was %s (%v)", val, err)
+	}
+
+	empty, _ := testAnalyticsResults(`{"sum":null}`).ScalarValue()
+	if !empty.IsNull() {
+		t.Fatalf("Expected null value but was %s", empty.Raw())
+	}
+
+	_, err = testAnalyticsResults(`{"a":1,"b":2}`).ScalarValue()
+	if err == nil {
+		t.Fatalf("Expected rows with several fields to fail")
+	}
+
+	_, err = testAnalyticsResults().ScalarValue()
+	if err != ErrNoResults {
+		t.Fatalf("Expected no results error but was %v", err)
+	}
+}
@@ -15,6 +15,7 @@ type AnalyticsDeferredResultHandle interface {
 	Next(valuePtr interface{}) bool
 	NextBytes() []byte
 	Close() error
+	Err() error
 
 	Status() (string, error)
 }
@@ -30,6 +31,7 @@ type analyticsDeferredResultHandle struct {
 }
 
 // Next assigns the next result from the results into the value pointer, returning whether the read was successful.
+// It always returns false once the results have been closed or an error has occurred.
 func (r *analyticsDeferredResultHandle) Next(valuePtr interface{}) bool {
 	if r.err != nil {
 		return false
@@ -51,7 +53,7 @@ func (r *analyticsDeferredResultHandle) Next(valuePtr interface{}) bool {
 // NextBytes returns the next result from the results as a byte array.
 // TODO: how to deadline/timeout this?
 func (r *analyticsDeferredResultHandle) NextBytes() []byte {
-	if r.err != nil {
+	if r.err != nil || r.rows.closed {
 		return nil
 	}
 
@@ -75,12 +77,18 @@ func (r *analyticsDeferredResultHandle) NextBytes() []byte {
 	return r.rows.NextBytes()
 }
 
-// Close marks the results as closed, returning any errors that occurred during reading the results.
+// Close marks the results as closed, returning the first error that occurred during reading the results.
+// It is safe to call Close more than once.
 func (r *analyticsDeferredResultHandle) Close() error {
 	r.rows.Close()
 	return r.err
 }
 
+// Err returns the first error that occurred during reading the results.
+func (r *analyticsDeferredResultHandle) Err() error {
+	return r.err
+}
+
 // One assigns the first value from the results into the value pointer.
 func (r *analyticsDeferredResultHandle) One(valuePtr interface{}) error {
 	if !r.Next(valuePtr) {
@@ -129,16 +137,8 @@ func (r *analyticsDeferredResultHandle) executeHandle(req *gocbcore.HttpRequest,
 		return err
 	}
 
-	jsonDec := json.NewDecoder(resp.Body)
-	err = jsonDec.Decode(valuePtr)
-	if err != nil {
-		return err
-	}
-
-	err = resp.Body.Close()
-	if err != nil {
-		logDebugf("Failed to close socket (%s)", err)
-	}
+	defer drainAndCloseHTTPBody(resp.Body)
 
-	return nil
+	jsonDec := json.NewDecoder(resp.Body)
+	return jsonDec.Decode(valuePtr)
 }
@@ -20,6 +20,15 @@ type AnalyticsQueryOptions struct {
 	Priority             bool
 	PositionalParameters []interface{}
 	NamedParameters      map[string]interface{}
+	// ScanConsistency bounds how stale the data read by the query may be, only NotBounded and RequestPlus are
+	// supported by the analytics service.
+	ScanConsistency ConsistencyMode
+	// ScanWait is the longest that a RequestPlus query waits for the analytics datasets to catch up.
+	ScanWait time.Duration
+	// Progress is called every ProgressInterval, defaulting to 1 second, whilst the query executes.  It can be
+	// used to emit liveness signals for long running queries or to abort them by returning an error.
+	Progress         QueryProgressFunc
+	ProgressInterval time.Duration
 
 	// Experimental: This API is subject to change at any time.
 	Deferred bool
@@ -49,6 +58,20 @@ func (opts *AnalyticsQueryOptions) toMap(statement string) (map[string]interface
 		execOpts["mode"] = "async"
 	}
 
+	if opts.ScanConsistency != 0 {
+		if opts.ScanConsistency == NotBounded {
+			execOpts["scan_consistency"] = "not_bounded"
+		} else if opts.ScanConsistency == RequestPlus {
+			execOpts["scan_consistency"] = "request_plus"
+		} else {
+			return nil, errors.New("Unexpected consistency option")
+		}
+	}
+
+	if opts.ScanWait != 0 {
+		execOpts["scan_wait"] = opts.ScanWait.String()
+	}
+
 	if opts.PositionalParameters != nil && opts.NamedParameters != nil {
 		return nil, errors.New("Positional and named parameters must be used exclusively")
 	}
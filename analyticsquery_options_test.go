@@ -47,6 +47,21 @@ func TestAnalyticsQueryOptionsToMap(t *testing.T) {
 			testAssertOption(t, nil, "pretty", optMap)
 		}
 
+		switch opts.ScanConsistency {
+		case NotBounded:
+			testAssertOption(t, "not_bounded", "scan_consistency", optMap)
+		case RequestPlus:
+			testAssertOption(t, "request_plus", "scan_consistency", optMap)
+		default:
+			testAssertOption(t, nil, "scan_consistency", optMap)
+		}
+
+		if opts.ScanWait == 0 {
+			testAssertOption(t, nil, "scan_wait", optMap)
+		} else {
+			testAssertOption(t, opts.ScanWait.String(), "scan_wait", optMap)
+		}
+
 		if opts.ServerSideTimeout == 0 {
 			testAssertOption(t, nil, "timeout", optMap)
 		} else {
@@ -139,5 +154,25 @@ func testCreateAnalyticsQueryOptions(seed int64) *AnalyticsQueryOptions {
 		opts.Context = context.Background()
 	}
 
+	randVal = rand.Intn(3)
+	if randVal == 1 {
+		opts.ScanConsistency = NotBounded
+	} else if randVal == 2 {
+		opts.ScanConsistency = RequestPlus
+	}
+
+	randVal = rand.Intn(2)
+	if randVal == 1 {
+		opts.ScanWait = 5 * time.Second
+	}
+
 	return opts
 }
+
+func TestAnalyticsQueryOptionsStatementPlus(t *testing.T) {
+	opts := &AnalyticsQueryOptions{ScanConsistency: StatementPlus}
+	_, err := opts.toMap("select 1")
+	if err == nil {
+		t.Fatalf("Expected StatementPlus to be rejected for analytics queries")
+	}
+}
@@ -31,6 +31,7 @@ func TestMain(m *testing.M) {
 	bucketName := flag.String("bucket", "default", "The bucket to use to test against")
 	// bucketPassword := flag.String("bucket-pass", "", "The bucket password to use when connecting to the bucket")
 	version := flag.String("version", "", "The server or mock version being tested against (major.minor.patch.build_edition)")
+	provision := flag.Bool("provision", false, "Whether to create the bucket, indexes and datasets used by the tests on a real server")
 	flag.Parse()
 
 	var err error
@@ -79,6 +80,13 @@ func TestMain(m *testing.M) {
 
 	globalCluster = &testCluster{Cluster: cluster, Mock: mock, Version: nodeVersion}
 
+	if *provision {
+		err = globalCluster.provision(*bucketName)
+		if err != nil {
+			panic(err.Error())
+		}
+	}
+
 	globalBucket, err = globalCluster.Bucket(*bucketName, &BucketOptions{UseMutationTokens: true})
 	if err != nil {
 		panic(err.Error())
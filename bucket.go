@@ -1,8 +1,16 @@
 package gocb
 
+import (
+	"errors"
+	"sync/atomic"
+)
+
 // Bucket is an interface representing a single bucket within a cluster.
 type Bucket struct {
 	sb stateBlock
+
+	cluster *Cluster
+	closed  uint32
 }
 
 // BucketOptions are the options available when connecting to a Bucket.
@@ -10,28 +18,54 @@ type BucketOptions struct {
 	UseMutationTokens bool
 }
 
-func newBucket(sb *stateBlock, bucketName string, opts BucketOptions) *Bucket {
-	return &Bucket{
-		sb: stateBlock{
-			clientStateBlock: clientStateBlock{
-				BucketName:        bucketName,
-				UseMutationTokens: opts.UseMutationTokens,
-			},
-			N1qlTimeout:      sb.N1qlTimeout,
-			SearchTimeout:    sb.SearchTimeout,
-			AnalyticsTimeout: sb.AnalyticsTimeout,
-
-			client: sb.client,
+func newBucket(sb stateBlock, bucketName string, opts BucketOptions) *Bucket {
+	bucketSb := stateBlock{
+		clientStateBlock: clientStateBlock{
+			BucketName:        bucketName,
+			UseMutationTokens: opts.UseMutationTokens,
 		},
+		KvTimeout:        sb.KvTimeout,
+		DuraTimeout:      sb.DuraTimeout,
+		N1qlTimeout:      sb.N1qlTimeout,
+		SearchTimeout:    sb.SearchTimeout,
+		AnalyticsTimeout: sb.AnalyticsTimeout,
+
+		MetricsRecorder:  sb.MetricsRecorder,
+		ValueCompression: sb.ValueCompression,
+		KvErrors:         sb.KvErrors,
+
+		client: sb.client,
+	}
+
+	return &Bucket{
+		sb: bucketSb.withRecachedClient(),
 	}
 }
 
 func (b *Bucket) connect() error {
-	b.sb.recacheClient()
 	cli := b.sb.getCachedClient()
 	return cli.connect()
 }
 
+// BucketCloseOptions is the set of options available when closing a Bucket.
+type BucketCloseOptions struct {
+}
+
+// Close releases the Bucket's connection to the cluster.  The connection is shared by all Buckets opened with
+// the same name and options, and is only closed once all of them have been closed.  Close must only be called
+// once all use of the Bucket, and any Scopes and Collections opened from it, has finished.
+func (b *Bucket) Close(opts *BucketCloseOptions) error {
+	if b.cluster == nil {
+		return errors.New("bucket was not opened through a cluster")
+	}
+
+	if !atomic.CompareAndSwapUint32(&b.closed, 0, 1) {
+		return nil
+	}
+
+	return b.cluster.releaseClient(b.sb.getCachedClient())
+}
+
 func (b *Bucket) clone() *Bucket {
 	newB := *b
 	return &newB
@@ -71,7 +105,7 @@ func (b *Bucket) Views() (*ViewManager, error) {
 
 	return &ViewManager{
 		bucket:     b,
-		httpClient: provider,
+		httpClient: b.cluster.newMgmtProvider(provider),
 	}, nil
 }
 
@@ -0,0 +1,436 @@
+package gocb
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+const (
+	defaultChangesBufferSize = 1024
+	changesReopenDelay       = 100 * time.Millisecond
+)
+
+// dcpProvider is the subset of a DCP gocbcore Agent used to stream changes.
+type dcpProvider interface {
+	OpenStream(vbID uint16, flags gocbcore.DcpStreamAddFlag, vbUUID gocbcore.VbUuid, startSeqNo, endSeqNo, snapStartSeqNo, snapEndSeqNo gocbcore.SeqNo, evtHandler gocbcore.StreamObserver, cb gocbcore.OpenStreamCallback) (gocbcore.PendingOp, error)
+	GetFailoverLog(vbID uint16, cb gocbcore.GetFailoverLogCallback) (gocbcore.PendingOp, error)
+	NumVbuckets() int
+	Close() error
+}
+
+// ChangeEventType is the kind of change described by a ChangeEvent.
+type ChangeEventType int
+
+const (
+	// ChangeMutation indicates that a document was created or modified.
+	ChangeMutation ChangeEventType = iota
+
+	// ChangeDeletion indicates that a document was removed.
+	ChangeDeletion
+
+	// ChangeExpiration indicates that a document was removed because it expired.
+	ChangeExpiration
+
+	// ChangeRollback indicates that the server rolled the vbucket back to SeqNo, for example after a failover.
+	// Changes received from the vbucket after SeqNo were lost and anything derived from them should be discarded.
+	ChangeRollback
+)
+
+// ChangeEvent is a single change streamed from a bucket.
+type ChangeEvent struct {
+	Type ChangeEventType
+	Key  string
+	// Value is the new value of the document for mutations, it is nil if the stream was opened with NoValue.
+	Value    []byte
+	Cas      Cas
+	Flags    uint32
+	Expiry   uint32
+	Datatype uint8
+	VbID     uint16
+	SeqNo    uint64
+
+	checkpoint ChangesCheckpoint
+}
+
+// ChangesCheckpoint is the position of a change stream within a single vbucket.
+type ChangesCheckpoint struct {
+	VbUUID        uint64
+	SeqNo         uint64
+	SnapshotStart uint64
+	SnapshotEnd   uint64
+}
+
+// ChangesCheckpointer stores the positions of a change stream so that a later stream can resume from them.
+type ChangesCheckpointer interface {
+	// Load returns the checkpoint to resume vbID from, or nil to stream the vbucket from the beginning.
+	Load(vbID uint16) (*ChangesCheckpoint, error)
+	// Save stores the checkpoint for vbID.
+	Save(vbID uint16, checkpoint ChangesCheckpoint) error
+}
+
+// ChangesOptions are the options available when streaming changes from a bucket.
+type ChangesOptions struct {
+	// StreamName identifies the stream to the server, defaulting to a random name.
+	StreamName string
+	// Checkpointer, if set, provides the position to resume each vbucket from and stores the stream's
+	// positions whenever ChangeStream.Checkpoint is called.
+	Checkpointer ChangesCheckpointer
+	// Filter, if set, is called with the key of every changed document and only those changes for which it
+	// returns true are returned.  The change streams of the servers supported by this client are not
+	// collection aware so the documents of a collection must be selected by their keys, such as by prefix.
+	Filter func(key []byte) bool
+	// NoValue streams changes without document values.
+	NoValue bool
+	// BufferSize is the number of changes received ahead of the consumer, defaulting to 1024.
+	BufferSize int
+}
+
+// ChangeStream streams the changes made to the documents in a bucket.  Streams are resumed automatically when
+// they are interrupted, such as by a rebalance, and restarted from a safe point when the server rolls a vbucket
+// back.
+type ChangeStream struct {
+	provider     dcpProvider
+	checkpointer ChangesCheckpointer
+	filter       func(key []byte) bool
+
+	events chan ChangeEvent
+	done   chan struct{}
+
+	lock     sync.Mutex
+	received map[uint16]*ChangesCheckpoint
+	consumed map[uint16]ChangesCheckpoint
+	err      error
+	closed   bool
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Changes opens a stream of the changes made to the documents in the bucket, from the beginning of each vbucket
+// or from the checkpoints provided by opts.Checkpointer.  The stream uses its own connections, which are
+// released when it is closed.
+func (b *Bucket) Changes(opts *ChangesOptions) (*ChangeStream, error) {
+	if opts == nil {
+		opts = &ChangesOptions{}
+	}
+
+	streamName := opts.StreamName
+	if streamName == "" {
+		streamName = "gocb-changes-" + b.cluster.newID()
+	}
+
+	flags := gocbcore.DcpOpenFlagProducer
+	if opts.NoValue {
+		flags |= gocbcore.DcpOpenFlagNoValue
+	}
+
+	provider, err := b.sb.getCachedClient().openDcpProvider(streamName, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	return newChangeStream(provider, opts)
+}
+
+func newChangeStream(provider dcpProvider, opts *ChangesOptions) (*ChangeStream, error) {
+	bufferSize := opts.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultChangesBufferSize
+	}
+
+	s := &ChangeStream{
+		provider:     provider,
+		checkpointer: opts.Checkpointer,
+		filter:       opts.Filter,
+		events:       make(chan ChangeEvent, bufferSize),
+		done:         make(chan struct{}),
+		received:     make(map[uint16]*ChangesCheckpoint),
+		consumed:     make(map[uint16]ChangesCheckpoint),
+	}
+
+	numVbuckets := provider.NumVbuckets()
+	for vbID := uint16(0); int(vbID) < numVbuckets; vbID++ {
+		checkpoint := &ChangesCheckpoint{}
+		if s.checkpointer != nil {
+			loaded, err := s.checkpointer.Load(vbID)
+			if err != nil {
+				s.shutdown()
+				return nil, err
+			}
+			if loaded != nil {
+				*checkpoint = *loaded
+			}
+		}
+
+		s.received[vbID] = checkpoint
+	}
+
+	for vbID := uint16(0); int(vbID) < numVbuckets; vbID++ {
+		if err := s.openStream(vbID); err != nil {
+			s.shutdown()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Next assigns the next change into evt, blocking until there is one.  It returns false once the stream has
+// been closed or has failed, in which case Err returns the reason.
+func (s *ChangeStream) Next(evt *ChangeEvent) bool {
+	if s.isClosed() {
+		return false
+	}
+
+	select {
+	case e := <-s.events:
+		s.lock.Lock()
+		s.consumed[e.VbID] = e.checkpoint
+		s.lock.Unlock()
+
+		*evt = e
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// Checkpoint saves the position of the last change returned by Next for each vbucket to the Checkpointer, a
+// stream opened from these checkpoints continues with the changes which follow them.
+func (s *ChangeStream) Checkpoint() error {
+	if s.checkpointer == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	checkpoints := make(map[uint16]ChangesCheckpoint, len(s.consumed))
+	for vbID, checkpoint := range s.consumed {
+		checkpoints[vbID] = checkpoint
+	}
+	s.lock.Unlock()
+
+	for vbID, checkpoint := range checkpoints {
+		if err := s.checkpointer.Save(vbID, checkpoint); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Err returns the error which caused the stream to fail, if any.
+func (s *ChangeStream) Err() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Close saves the stream's checkpoints and closes it, releasing its connections.  It is safe to call Close
+// more than once.
+func (s *ChangeStream) Close() error {
+	checkpointErr := s.Checkpoint()
+	closeErr := s.shutdown()
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if checkpointErr != nil {
+		return checkpointErr
+	}
+	return closeErr
+}
+
+func (s *ChangeStream) isClosed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.closed
+}
+
+func (s *ChangeStream) shutdown() error {
+	s.closeOnce.Do(func() {
+		s.lock.Lock()
+		s.closed = true
+		s.lock.Unlock()
+
+		close(s.done)
+		s.closeErr = s.provider.Close()
+	})
+
+	return s.closeErr
+}
+
+// fail stops the stream with err, it is called from the provider's goroutines so the provider is closed
+// asynchronously.
+func (s *ChangeStream) fail(err error) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	if s.err == nil {
+		s.err = err
+	}
+	s.lock.Unlock()
+
+	go s.shutdown()
+}
+
+func (s *ChangeStream) openStream(vbID uint16) error {
+	s.lock.Lock()
+	checkpoint := *s.received[vbID]
+	s.lock.Unlock()
+
+	_, err := s.provider.OpenStream(vbID, 0, gocbcore.VbUuid(checkpoint.VbUUID), gocbcore.SeqNo(checkpoint.SeqNo),
+		gocbcore.SeqNo(math.MaxUint64), gocbcore.SeqNo(checkpoint.SnapshotStart), gocbcore.SeqNo(checkpoint.SnapshotEnd),
+		&changeStreamObserver{stream: s}, func(entries []gocbcore.FailoverEntry, err error) {
+			if err != nil {
+				if gocbcore.IsErrorStatus(err, gocbcore.StatusRollback) {
+					s.rollback(vbID)
+					return
+				}
+				s.fail(err)
+				return
+			}
+
+			if len(entries) > 0 {
+				s.lock.Lock()
+				s.received[vbID].VbUUID = uint64(entries[0].VbUuid)
+				s.lock.Unlock()
+			}
+		})
+	return err
+}
+
+// reopenStream opens the stream for vbID again, after a short delay, from the last change received.
+func (s *ChangeStream) reopenStream(vbID uint16) {
+	time.AfterFunc(changesReopenDelay, func() {
+		if s.isClosed() {
+			return
+		}
+
+		if err := s.openStream(vbID); err != nil {
+			s.fail(err)
+		}
+	})
+}
+
+// rollback restarts the stream for vbID from the newest failover log entry at or before the last change
+// received, which the server guarantees to be consistent, or from the beginning if there is none.
+func (s *ChangeStream) rollback(vbID uint16) {
+	_, err := s.provider.GetFailoverLog(vbID, func(entries []gocbcore.FailoverEntry, err error) {
+		if err != nil {
+			s.fail(err)
+			return
+		}
+
+		s.lock.Lock()
+		restart := ChangesCheckpoint{}
+		for _, entry := range entries {
+			if uint64(entry.SeqNo) <= s.received[vbID].SeqNo {
+				restart = ChangesCheckpoint{
+					VbUUID:        uint64(entry.VbUuid),
+					SeqNo:         uint64(entry.SeqNo),
+					SnapshotStart: uint64(entry.SeqNo),
+					SnapshotEnd:   uint64(entry.SeqNo),
+				}
+				break
+			}
+		}
+		*s.received[vbID] = restart
+		s.lock.Unlock()
+
+		s.deliver(ChangeEvent{
+			Type:       ChangeRollback,
+			VbID:       vbID,
+			SeqNo:      restart.SeqNo,
+			checkpoint: restart,
+		})
+		s.reopenStream(vbID)
+	})
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *ChangeStream) change(evt ChangeEvent, key []byte) {
+	s.lock.Lock()
+	checkpoint := s.received[evt.VbID]
+	checkpoint.SeqNo = evt.SeqNo
+	evt.checkpoint = *checkpoint
+	s.lock.Unlock()
+
+	if s.filter != nil && !s.filter(key) {
+		return
+	}
+
+	s.deliver(evt)
+}
+
+func (s *ChangeStream) deliver(evt ChangeEvent) {
+	select {
+	case s.events <- evt:
+	case <-s.done:
+	}
+}
+
+// changeStreamObserver receives the events for the vbucket streams of a ChangeStream.
+type changeStreamObserver struct {
+	stream *ChangeStream
+}
+
+func (o *changeStreamObserver) SnapshotMarker(startSeqNo, endSeqNo uint64, vbID uint16, snapshotType gocbcore.SnapshotState) {
+	o.stream.lock.Lock()
+	checkpoint := o.stream.received[vbID]
+	checkpoint.SnapshotStart = startSeqNo
+	checkpoint.SnapshotEnd = endSeqNo
+	o.stream.lock.Unlock()
+}
+
+func (o *changeStreamObserver) Mutation(seqNo, revNo uint64, flags, expiry, lockTime uint32, cas uint64, datatype uint8, vbID uint16, key, value []byte) {
+	o.stream.change(ChangeEvent{
+		Type:     ChangeMutation,
+		Key:      string(key),
+		Value:    value,
+		Cas:      Cas(cas),
+		Flags:    flags,
+		Expiry:   expiry,
+		Datatype: datatype,
+		VbID:     vbID,
+		SeqNo:    seqNo,
+	}, key)
+}
+
+func (o *changeStreamObserver) Deletion(seqNo, revNo, cas uint64, datatype uint8, vbID uint16, key, value []byte) {
+	o.stream.change(ChangeEvent{
+		Type:     ChangeDeletion,
+		Key:      string(key),
+		Cas:      Cas(cas),
+		Datatype: datatype,
+		VbID:     vbID,
+		SeqNo:    seqNo,
+	}, key)
+}
+
+func (o *changeStreamObserver) Expiration(seqNo, revNo, cas uint64, vbID uint16, key []byte) {
+	o.stream.change(ChangeEvent{
+		Type:  ChangeExpiration,
+		Key:   string(key),
+		Cas:   Cas(cas),
+		VbID:  vbID,
+		SeqNo: seqNo,
+	}, key)
+}
+
+// End is called when the stream for vbID ends, which only happens when it is interrupted as streams are opened
+// without an end, so it is reopened from the last change received.
+func (o *changeStreamObserver) End(vbID uint16, err error) {
+	if o.stream.isClosed() {
+		return
+	}
+
+	logDebugf("Change stream for vbucket %d ended (%v), reopening", vbID, err)
+	o.stream.reopenStream(vbID)
+}
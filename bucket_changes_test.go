@@ -0,0 +1,161 @@
+package gocb
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type mockDcpProvider struct {
+	lock      sync.Mutex
+	observers map[uint16]gocbcore.StreamObserver
+	starts    map[uint16][]gocbcore.SeqNo
+	rollback  map[uint16]bool
+	opened    chan uint16
+	closed    bool
+}
+
+func newMockDcpProvider() *mockDcpProvider {
+	return &mockDcpProvider{
+		observers: make(map[uint16]gocbcore.StreamObserver),
+		starts:    make(map[uint16][]gocbcore.SeqNo),
+		rollback:  make(map[uint16]bool),
+		opened:    make(chan uint16, 10),
+	}
+}
+
+func (p *mockDcpProvider) OpenStream(vbID uint16, flags gocbcore.DcpStreamAddFlag, vbUUID gocbcore.VbUuid, startSeqNo, endSeqNo, snapStartSeqNo, snapEndSeqNo gocbcore.SeqNo, evtHandler gocbcore.StreamObserver, cb gocbcore.OpenStreamCallback) (gocbcore.PendingOp, error) {
+	p.lock.Lock()
+	p.observers[vbID] = evtHandler
+	p.starts[vbID] = append(p.starts[vbID], startSeqNo)
+	rollback := p.rollback[vbID]
+	p.rollback[vbID] = false
+	p.lock.Unlock()
+
+	if rollback {
+		go cb(nil, &gocbcore.KvError{Code: gocbcore.StatusRollback})
+		return &mocktest.PendingOp{}, nil
+	}
+
+	go func() {
+		cb([]gocbcore.FailoverEntry{{VbUuid: 7, SeqNo: 0}}, nil)
+		p.opened <- vbID
+	}()
+	return &mocktest.PendingOp{}, nil
+}
+
+func (p *mockDcpProvider) GetFailoverLog(vbID uint16, cb gocbcore.GetFailoverLogCallback) (gocbcore.PendingOp, error) {
+	go cb([]gocbcore.FailoverEntry{{VbUuid: 9, SeqNo: 20}, {VbUuid: 7, SeqNo: 2}}, nil)
+	return &mocktest.PendingOp{}, nil
+}
+
+func (p *mockDcpProvider) NumVbuckets() int {
+	return 2
+}
+
+func (p *mockDcpProvider) Close() error {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+	return nil
+}
+
+func (p *mockDcpProvider) observer(vbID uint16) gocbcore.StreamObserver {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.observers[vbID]
+}
+
+type memoryCheckpointer struct {
+	checkpoints map[uint16]ChangesCheckpoint
+}
+
+func (c *memoryCheckpointer) Load(vbID uint16) (*ChangesCheckpoint, error) {
+	checkpoint, ok := c.checkpoints[vbID]
+	if !ok {
+		return nil, nil
+	}
+	return &checkpoint, nil
+}
+
+func (c *memoryCheckpointer) Save(vbID uint16, checkpoint ChangesCheckpoint) error {
+	c.checkpoints[vbID] = checkpoint
+	return nil
+}
+
+func TestChangeStream(t *testing.T) {
+	provider := newMockDcpProvider()
+	checkpointer := &memoryCheckpointer{checkpoints: map[uint16]ChangesCheckpoint{1: {VbUUID: 7, SeqNo: 4}}}
+
+	stream, err := newChangeStream(provider, &ChangesOptions{
+		Checkpointer: checkpointer,
+		Filter: func(key []byte) bool {
+			return strings.HasPrefix(string(key), "user::")
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected stream to open but error was %v", err)
+	}
+	<-provider.opened
+	<-provider.opened
+
+	if provider.starts[1][0] != 4 {
+		t.Fatalf("Expected vbucket 1 to resume from its checkpoint but started at %d", provider.starts[1][0])
+	}
+
+	provider.observer(0).SnapshotMarker(0, 10, 0, 1)
+	provider.observer(0).Mutation(1, 1, 0, 0, 0, 100, 1, 0, []byte("order::1"), []byte(`{}`))
+	provider.observer(0).Mutation(2, 1, 0, 0, 0, 101, 1, 0, []byte("user::1"), []byte(`{"name":"a"}`))
+	provider.observer(0).Deletion(3, 1, 102, 0, 0, []byte("user::2"), nil)
+
+	var evt ChangeEvent
+	if !stream.Next(&evt) || evt.Type != ChangeMutation || evt.Key != "user::1" || string(evt.Value) != `{"name":"a"}` {
+		t.Fatalf("Expected filtered mutation but had %+v", evt)
+	}
+	if !stream.Next(&evt) || evt.Type != ChangeDeletion || evt.Key != "user::2" || evt.SeqNo != 3 {
+		t.Fatalf("Expected deletion but had %+v", evt)
+	}
+
+	err = stream.Checkpoint()
+	if err != nil {
+		t.Fatalf("Expected checkpoint to save but error was %v", err)
+	}
+	if checkpointer.checkpoints[0] != (ChangesCheckpoint{VbUUID: 7, SeqNo: 3, SnapshotStart: 0, SnapshotEnd: 10}) {
+		t.Fatalf("Unexpected checkpoint %+v", checkpointer.checkpoints[0])
+	}
+
+	// An interrupted stream which the server then rolls back restarts from the failover log.
+	provider.lock.Lock()
+	provider.rollback[0] = true
+	provider.lock.Unlock()
+	provider.observer(0).End(0, gocbcore.ErrStreamStateChanged)
+
+	if !stream.Next(&evt) || evt.Type != ChangeRollback || evt.VbID != 0 || evt.SeqNo != 2 {
+		t.Fatalf("Expected rollback but had %+v", evt)
+	}
+	<-provider.opened
+
+	provider.lock.Lock()
+	starts := provider.starts[0]
+	provider.lock.Unlock()
+	if len(starts) != 3 || starts[1] != 3 || starts[2] != 2 {
+		t.Fatalf("Unexpected stream restarts %v", starts)
+	}
+
+	err = stream.Close()
+	if err != nil {
+		t.Fatalf("Expected stream to close but error was %v", err)
+	}
+	if !provider.closed {
+		t.Fatalf("Expected provider to be closed")
+	}
+	if stream.Next(&evt) {
+		t.Fatalf("Expected Next to return false after Close")
+	}
+	if checkpointer.checkpoints[0].SeqNo != 2 {
+		t.Fatalf("Expected rolled back checkpoint to be saved on Close but was %+v", checkpointer.checkpoints[0])
+	}
+}
@@ -0,0 +1,124 @@
+package gocb
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// InternalBucket provides access to lower level functionality of a bucket.
+// VOLATILE: This API is subject to change at any time.
+type InternalBucket struct {
+	bucket *Bucket
+}
+
+// Internal returns an InternalBucket for this bucket.
+// VOLATILE: This API is subject to change at any time.
+func (b *Bucket) Internal() *InternalBucket {
+	return &InternalBucket{
+		bucket: b,
+	}
+}
+
+// StatsOptions are the options available to the Stats operation.
+type StatsOptions struct {
+	ParentSpanContext opentracing.SpanContext
+	Timeout           time.Duration
+	Context           context.Context
+}
+
+// ServerStats holds the statistics returned by a single server.
+type ServerStats struct {
+	Stats map[string]string
+	Error error
+}
+
+// StatsResult holds the statistics returned by each server, keyed by server address.
+type StatsResult struct {
+	Servers map[string]ServerStats
+}
+
+// Stats executes the memcached STATS command with the given key (an empty key returns the general stats)
+// against every server in the bucket.  The results from each server are returned individually, a failure
+// on one server is reported in its ServerStats rather than failing the whole operation.
+func (ib *InternalBucket) Stats(key string, opts *StatsOptions) (statsOut *StatsResult, errOut error) {
+	if opts == nil {
+		opts = &StatsOptions{}
+	}
+
+	b := ib.bucket
+
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
+	var span opentracing.Span
+	if parentSpanCtx == nil {
+		span = opentracing.GlobalTracer().StartSpan("Stats",
+			opentracing.Tag{Key: "couchbase.service", Value: "kv"})
+	} else {
+		span = opentracing.GlobalTracer().StartSpan("Stats",
+			opentracing.Tag{Key: "couchbase.service", Value: "kv"}, opentracing.ChildOf(parentSpanCtx))
+	}
+	defer span.Finish()
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = b.sb.KvTimeout
+	}
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cli := b.sb.getCachedClient()
+	provider, err := cli.getDiagnosticsProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	signal := make(chan struct{}, 1)
+	op, err := provider.StatsEx(gocbcore.StatsOptions{
+		Key:          key,
+		TraceContext: span.Context(),
+	}, func(res *gocbcore.StatsResult, err error) {
+		if err != nil {
+			errOut = err
+			signal <- struct{}{}
+			return
+		}
+
+		statsOut = &StatsResult{
+			Servers: make(map[string]ServerStats, len(res.Servers)),
+		}
+		for address, serverStats := range res.Servers {
+			statsOut.Servers[address] = ServerStats{
+				Stats: serverStats.Stats,
+				Error: serverStats.Error,
+			}
+		}
+		signal <- struct{}{}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-signal:
+		return
+	case <-ctx.Done():
+		if !op.Cancel() {
+			<-signal
+			return
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, timeoutError{}
+		}
+		return nil, ctx.Err()
+	}
+}
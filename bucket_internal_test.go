@@ -0,0 +1,79 @@
+package gocb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type mockStatsProvider struct {
+	key    string
+	result *gocbcore.StatsResult
+}
+
+func (p *mockStatsProvider) Diagnostics() (*gocbcore.DiagnosticInfo, error) {
+	return nil, nil
+}
+
+func (p *mockStatsProvider) PingKvEx(opts gocbcore.PingKvOptions, cb gocbcore.PingKvExCallback) (gocbcore.PendingOp, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *mockStatsProvider) StatsEx(opts gocbcore.StatsOptions, cb gocbcore.StatsExCallback) (gocbcore.PendingOp, error) {
+	p.key = opts.Key
+	go cb(p.result, nil)
+	return &mocktest.PendingOp{}, nil
+}
+
+func TestBucketInternalStats(t *testing.T) {
+	nodeErr := errors.New("connection reset")
+	provider := &mockStatsProvider{
+		result: &gocbcore.StatsResult{
+			Servers: map[string]gocbcore.SingleServerStats{
+				"10.112.0.1:11210": {Stats: map[string]string{"curr_items": "7303"}},
+				"10.112.0.2:11210": {Error: nodeErr},
+			},
+		},
+	}
+
+	clients := make(map[string]client)
+	clients["mock-false"] = &mockClient{
+		bucketName:       "mock",
+		mockDiagProvider: provider,
+	}
+	c := &Cluster{
+		connections: clients,
+	}
+	b := &Bucket{
+		sb: stateBlock{
+			clientStateBlock: clientStateBlock{
+				BucketName: "mock",
+			},
+			client: c.getClient,
+		},
+	}
+	b.sb = b.sb.withRecachedClient()
+
+	stats, err := b.Internal().Stats("vbucket", nil)
+	if err != nil {
+		t.Fatalf("Expected stats to succeed but was %v", err)
+	}
+
+	if provider.key != "vbucket" {
+		t.Fatalf("Expected stats key to be vbucket but was %s", provider.key)
+	}
+
+	if len(stats.Servers) != 2 {
+		t.Fatalf("Expected stats from 2 servers but had %d", len(stats.Servers))
+	}
+
+	if stats.Servers["10.112.0.1:11210"].Stats["curr_items"] != "7303" {
+		t.Fatalf("Unexpected stats: %v", stats.Servers["10.112.0.1:11210"])
+	}
+
+	if stats.Servers["10.112.0.2:11210"].Error != nodeErr {
+		t.Fatalf("Expected server error to be returned but was %v", stats.Servers["10.112.0.2:11210"].Error)
+	}
+}
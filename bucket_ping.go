@@ -6,8 +6,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
-
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
@@ -78,6 +76,10 @@ func (jsonReport *jsonPingReport) toReport() *PingReport {
 }
 
 func (b *Bucket) pingKv(provider diagnosticsProvider) (pingsOut []gocbcore.PingResult, errOut error) {
+	return pingKvProvider(provider, b.sb.KvTimeout)
+}
+
+func pingKvProvider(provider diagnosticsProvider, timeout time.Duration) (pingsOut []gocbcore.PingResult, errOut error) {
 	signal := make(chan bool, 1)
 
 	op, err := provider.PingKvEx(gocbcore.PingKvOptions{}, func(services *gocbcore.PingKvResult, err error) {
@@ -102,7 +104,7 @@ func (b *Bucket) pingKv(provider diagnosticsProvider) (pingsOut []gocbcore.PingR
 		return nil, err
 	}
 
-	timeoutTmr := gocbcore.AcquireTimer(b.sb.KvTimeout)
+	timeoutTmr := gocbcore.AcquireTimer(timeout)
 	select {
 	case <-signal:
 		gocbcore.ReleaseTimer(timeoutTmr, false)
@@ -140,7 +142,7 @@ func (b *Bucket) Ping(opts *PingOptions) (*PingReport, error) {
 
 	report.ID = opts.ReportID
 	if report.ID == "" {
-		report.ID = uuid.New().String()
+		report.ID = b.cluster.newID()
 	}
 
 	if services == nil {
@@ -0,0 +1,239 @@
+package gocb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// waitUntilReadyInterval is how long WaitUntilReady waits between checking whether services are ready.
+const waitUntilReadyInterval = 250 * time.Millisecond
+
+// ClusterState is the state that WaitUntilReady waits for the services to reach.
+type ClusterState int
+
+const (
+	// ClusterStateOnline indicates that every endpoint of each service is ready.
+	ClusterStateOnline = ClusterState(0)
+
+	// ClusterStateDegraded indicates that at least one endpoint of each service is ready.
+	ClusterStateDegraded = ClusterState(1)
+)
+
+// WaitUntilReadyOptions are the options available to WaitUntilReady.
+type WaitUntilReadyOptions struct {
+	Context context.Context
+	// Services are the services to wait for, which may be MemdService, N1qlService, FtsService and CbasService.
+	// Only MemdService is waited for by default.
+	Services []ServiceType
+	// DesiredState is the state that the services must reach, by default ClusterStateOnline.
+	DesiredState ClusterState
+}
+
+// ServiceReadiness describes whether a service was ready when it was last checked by WaitUntilReady.
+type ServiceReadiness struct {
+	Service ServiceType
+	Ready   bool
+	// Endpoints is the number of endpoints of the service in the cluster config, of which ReadyEndpoints
+	// responded successfully to a ping.
+	Endpoints      int
+	ReadyEndpoints int
+	// Err is the last error from pinging an endpoint of the service, if any.
+	Err error
+}
+
+func (r ServiceReadiness) String() string {
+	state := "ready"
+	if !r.Ready {
+		state = "not ready"
+	}
+	msg := fmt.Sprintf("%s %s (%d/%d endpoints)", diagServiceString(r.Service), state, r.ReadyEndpoints, r.Endpoints)
+	if r.Err != nil {
+		msg += ": " + r.Err.Error()
+	}
+	return msg
+}
+
+// WaitUntilReady waits until the services in opts are ready to handle requests, failing with a NotReadyError
+// describing which services were and were not ready if they do not become ready within timeout.  This allows
+// applications, and the orchestration starting them, to tell apart a cluster which cannot be reached at all from
+// one which has, for example, its data nodes ready but a query node still warming up.
+func (b *Bucket) WaitUntilReady(timeout time.Duration, opts *WaitUntilReadyOptions) error {
+	if opts == nil {
+		opts = &WaitUntilReadyOptions{}
+	}
+
+	services := opts.Services
+	if len(services) == 0 {
+		services = []ServiceType{MemdService}
+	}
+	for _, service := range services {
+		switch service {
+		case MemdService, N1qlService, FtsService, CbasService:
+		default:
+			return errors.Wrapf(ErrInvalidArgument, "cannot wait for the %s service", diagServiceString(service))
+		}
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		readiness := b.checkReadiness(ctx, services, opts.DesiredState)
+
+		ready := true
+		for _, service := range readiness {
+			ready = ready && service.Ready
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return notReadyError{
+				services: readiness,
+				cause:    ctx.Err(),
+			}
+		case <-time.After(waitUntilReadyInterval):
+		}
+	}
+}
+
+// checkReadiness checks each of services concurrently, returning their readiness in the same order.
+func (b *Bucket) checkReadiness(ctx context.Context, services []ServiceType, state ClusterState) []ServiceReadiness {
+	readiness := make([]ServiceReadiness, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, service ServiceType) {
+			defer wg.Done()
+
+			if service == MemdService {
+				readiness[i] = b.checkKvReadiness(ctx)
+			} else {
+				readiness[i] = b.checkHTTPReadiness(ctx, service)
+			}
+
+			r := &readiness[i]
+			if state == ClusterStateDegraded {
+				r.Ready = r.ReadyEndpoints > 0
+			} else {
+				r.Ready = r.Endpoints > 0 && r.ReadyEndpoints == r.Endpoints
+			}
+		}(i, service)
+	}
+	wg.Wait()
+
+	return readiness
+}
+
+func (b *Bucket) checkKvReadiness(ctx context.Context) ServiceReadiness {
+	readiness := ServiceReadiness{Service: MemdService}
+
+	provider, err := b.sb.getCachedClient().getDiagnosticsProvider()
+	if err != nil {
+		readiness.Err = err
+		return readiness
+	}
+
+	timeout := b.sb.KvTimeout
+	if deadline, ok := ctx.Deadline(); ok && (timeout <= 0 || time.Until(deadline) < timeout) {
+		timeout = time.Until(deadline)
+	}
+
+	pings, err := pingKvProvider(provider, timeout)
+	if err != nil {
+		readiness.Err = err
+		return readiness
+	}
+
+	readiness.Endpoints = len(pings)
+	for _, ping := range pings {
+		if ping.Error != nil {
+			readiness.Err = ping.Error
+			continue
+		}
+		readiness.ReadyEndpoints++
+	}
+
+	return readiness
+}
+
+func (b *Bucket) checkHTTPReadiness(ctx context.Context, service ServiceType) ServiceReadiness {
+	readiness := ServiceReadiness{Service: service}
+
+	provider, err := b.sb.getCachedClient().getHTTPProvider()
+	if err != nil {
+		readiness.Err = err
+		return readiness
+	}
+
+	var path string
+	var endpoints []string
+	var known bool
+	switch service {
+	case N1qlService:
+		path = "/admin/ping"
+		if p, ok := provider.(interface{ N1qlEps() []string }); ok {
+			endpoints, known = p.N1qlEps(), true
+		}
+	case FtsService:
+		path = "/api/ping"
+		if p, ok := provider.(interface{ FtsEps() []string }); ok {
+			endpoints, known = p.FtsEps(), true
+		}
+	case CbasService:
+		path = "/admin/ping"
+		if p, ok := provider.(interface{ CbasEps() []string }); ok {
+			endpoints, known = p.CbasEps(), true
+		}
+	}
+	// Without the endpoint list a single ping is sent to whichever endpoint the provider chooses.
+	if !known {
+		endpoints = []string{""}
+	}
+
+	readiness.Endpoints = len(endpoints)
+	for _, endpoint := range endpoints {
+		err := pingHTTPEndpoint(ctx, provider, service, endpoint, path)
+		if err != nil {
+			readiness.Err = err
+			continue
+		}
+		readiness.ReadyEndpoints++
+	}
+
+	return readiness
+}
+
+// pingHTTPEndpoint pings a single endpoint of an HTTP service, a response other than 200 means that the service
+// is running but not yet ready.
+func pingHTTPEndpoint(ctx context.Context, provider httpProvider, service ServiceType, endpoint, path string) error {
+	resp, err := provider.DoHttpRequest(&gocbcore.HttpRequest{
+		Method:   "GET",
+		Path:     path,
+		Service:  gocbcore.ServiceType(service),
+		Endpoint: endpoint,
+		Context:  ctx,
+	})
+	if err != nil {
+		return err
+	}
+	drainAndCloseHTTPBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ping of %s returned status %d", resp.Endpoint, resp.StatusCode)
+	}
+
+	return nil
+}
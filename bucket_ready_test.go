@@ -0,0 +1,131 @@
+package gocb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type readinessHTTPProvider struct {
+	*mockHTTPProvider
+}
+
+func (p *readinessHTTPProvider) N1qlEps() []string {
+	return []string{"http://10.112.0.1:8093", "http://10.112.0.2:8093"}
+}
+
+func testReadinessBucket(diag diagnosticsProvider, provider httpProvider) *Bucket {
+	cli := &mockClient{
+		bucketName:       "mock",
+		mockDiagProvider: diag,
+		mockHTTPProvider: provider,
+	}
+	return &Bucket{
+		sb: stateBlock{
+			clientStateBlock: clientStateBlock{
+				BucketName: "mock",
+			},
+			KvTimeout:    time.Second,
+			cachedClient: cli,
+		},
+	}
+}
+
+func TestWaitUntilReady(t *testing.T) {
+	diag := &mockPingProvider{
+		results: []gocbcore.PingResult{
+			{Endpoint: "10.112.0.1:11210"},
+			{Endpoint: "10.112.0.2:11210"},
+		},
+	}
+
+	// The second query node is warming up until it has been pinged twice.
+	var warmingPings int32
+	provider := &readinessHTTPProvider{&mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			if req.Path != "/admin/ping" {
+				return nil, errors.New("unexpected path " + req.Path)
+			}
+			status := 200
+			if req.Endpoint == "http://10.112.0.2:8093" && atomic.AddInt32(&warmingPings, 1) <= 2 {
+				status = 503
+			}
+			return &gocbcore.HttpResponse{
+				Endpoint:   req.Endpoint,
+				StatusCode: status,
+				Body:       &testReadCloser{bytes.NewBufferString(""), nil},
+			}, nil
+		},
+	}}
+	b := testReadinessBucket(diag, provider)
+
+	err := b.WaitUntilReady(5*time.Second, nil)
+	if err != nil {
+		t.Fatalf("Expected KV to be ready but was %v", err)
+	}
+
+	err = b.WaitUntilReady(5*time.Second, &WaitUntilReadyOptions{
+		Services: []ServiceType{MemdService, N1qlService},
+	})
+	if err != nil {
+		t.Fatalf("Expected KV and query to become ready but was %v", err)
+	}
+	if atomic.LoadInt32(&warmingPings) != 3 {
+		t.Fatalf("Expected warming node to be pinged until ready but was pinged %d times", warmingPings)
+	}
+}
+
+func TestWaitUntilReadyReportsServices(t *testing.T) {
+	diag := &mockPingProvider{
+		results: []gocbcore.PingResult{
+			{Endpoint: "10.112.0.1:11210"},
+			{Endpoint: "10.112.0.2:11210", Error: errors.New("timed out")},
+		},
+	}
+	provider := &readinessHTTPProvider{&mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   req.Endpoint,
+				StatusCode: 503,
+				Body:       &testReadCloser{bytes.NewBufferString(""), nil},
+			}, nil
+		},
+	}}
+	b := testReadinessBucket(diag, provider)
+
+	err := b.WaitUntilReady(5*time.Second, &WaitUntilReadyOptions{
+		Services:     []ServiceType{MemdService},
+		DesiredState: ClusterStateDegraded,
+	})
+	if err != nil {
+		t.Fatalf("Expected KV to be degraded but was %v", err)
+	}
+
+	err = b.WaitUntilReady(100*time.Millisecond, &WaitUntilReadyOptions{
+		Services:     []ServiceType{MemdService, N1qlService},
+		DesiredState: ClusterStateDegraded,
+	})
+	notReady, ok := err.(NotReadyError)
+	if !ok {
+		t.Fatalf("Expected NotReadyError but was %v", err)
+	}
+
+	services := notReady.Services()
+	if len(services) != 2 {
+		t.Fatalf("Expected readiness of 2 services but had %v", services)
+	}
+	if !services[0].Ready || services[0].Endpoints != 2 || services[0].ReadyEndpoints != 1 {
+		t.Fatalf("Expected KV to be ready with 1 of 2 endpoints but was %v", services[0])
+	}
+	if services[1].Ready || services[1].Endpoints != 2 || services[1].ReadyEndpoints != 0 {
+		t.Fatalf("Expected query not to be ready but was %v", services[1])
+	}
+	if !strings.Contains(err.Error(), "n1ql not ready (0/2 endpoints)") {
+		t.Fatalf("Expected error to describe query readiness but was %v", err)
+	}
+}
@@ -1,9 +1,11 @@
 package gocb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"gopkg.in/couchbase/gocbcore.v7"
 )
@@ -13,6 +15,21 @@ type ViewManager struct {
 	httpClient httpProvider
 }
 
+// WithContext returns a copy of the manager whose operations are cancelled once ctx is done.
+func (vm *ViewManager) WithContext(ctx context.Context) *ViewManager {
+	newM := *vm
+	newM.httpClient = asMgmtProvider(vm.httpClient).withContext(ctx)
+	return &newM
+}
+
+// WithTimeout returns a copy of the manager whose operations time out after timeout, rather than after
+// ClusterOptions.ManagementTimeout.  Requests which are safe to repeat are retried within the timeout.
+func (vm *ViewManager) WithTimeout(timeout time.Duration) *ViewManager {
+	newM := *vm
+	newM.httpClient = asMgmtProvider(vm.httpClient).withTimeout(timeout)
+	return &newM
+}
+
 // View represents a Couchbase view within a design document.
 type View struct {
 	Map    string `json:"map,omitempty"`
@@ -32,6 +49,9 @@ type DesignDocument struct {
 
 // GetDesignDocument retrieves a single design document for the given bucket..
 func (vm ViewManager) GetDesignDocument(name string) (*DesignDocument, error) {
+	span := startManagerTrace("views", "get_design_document", "views")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(CapiService),
 		Path:    fmt.Sprintf("/_design/%s", name),
@@ -68,6 +88,9 @@ func (vm ViewManager) GetDesignDocument(name string) (*DesignDocument, error) {
 
 // GetDesignDocuments will retrieve all design documents for the given bucket.
 func (vm ViewManager) GetDesignDocuments() ([]*DesignDocument, error) {
+	span := startManagerTrace("views", "get_all_design_documents", "views")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(CapiService),
 		Path:    fmt.Sprintf("/pools/default/buckets/%s/ddocs", vm.bucket.Name()),
@@ -119,6 +142,9 @@ func (vm ViewManager) GetDesignDocuments() ([]*DesignDocument, error) {
 
 // InsertDesignDocument inserts a design document to the given bucket.
 func (vm ViewManager) InsertDesignDocument(ddoc *DesignDocument) error {
+	span := startManagerTrace("views", "create_design_document", "views")
+	defer span.Finish()
+
 	oldDdoc, err := vm.GetDesignDocument(ddoc.Name)
 	if oldDdoc != nil || err == nil {
 		// return clientError{"Design document already exists"} TODO
@@ -129,6 +155,9 @@ func (vm ViewManager) InsertDesignDocument(ddoc *DesignDocument) error {
 // UpsertDesignDocument will insert a design document to the given bucket, or update
 // an existing design document with the same name.
 func (vm ViewManager) UpsertDesignDocument(ddoc *DesignDocument) error {
+	span := startManagerTrace("views", "upsert_design_document", "views")
+	defer span.Finish()
+
 	data, err := json.Marshal(&ddoc)
 	if err != nil {
 		return err
@@ -163,6 +192,9 @@ func (vm ViewManager) UpsertDesignDocument(ddoc *DesignDocument) error {
 
 // RemoveDesignDocument will remove a design document from the given bucket.
 func (vm ViewManager) RemoveDesignDocument(name string) error {
+	span := startManagerTrace("views", "drop_design_document", "views")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(CapiService),
 		Path:    fmt.Sprintf("/_design/%s", name),
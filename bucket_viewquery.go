@@ -23,15 +23,20 @@ type viewResponse struct {
 
 // ViewResults implements an iterator interface which can be used to iterate over the rows of the query results.
 type ViewResults struct {
+	closed    bool
 	index     int
 	rows      []json.RawMessage
 	totalRows int
 	err       error
-	// endErr    error
+	// endErr is the error for the nodes which could not be queried when the results are partial.
+	endErr error
 }
 
+// Next assigns the next result from the results into the value pointer, returning whether the read was successful.
+// It always returns false once the results have been closed or an error has occurred.  The rows of partial
+// results can still be read, the error for them is returned by Close.
 func (r *ViewResults) Next(valuePtr interface{}) bool {
-	if r.err != nil {
+	if r.err != nil || r.closed {
 		return false
 	}
 
@@ -48,8 +53,9 @@ func (r *ViewResults) Next(valuePtr interface{}) bool {
 	return true
 }
 
+// NextBytes returns the next result from the results as a byte array.
 func (r *ViewResults) NextBytes() []byte {
-	if r.err != nil {
+	if r.err != nil || r.closed {
 		return nil
 	}
 
@@ -61,18 +67,26 @@ func (r *ViewResults) NextBytes() []byte {
 	return r.rows[r.index]
 }
 
+// Close marks the results as closed, returning the first error that occurred during reading the results, or the
+// errors for the nodes which could not be queried when the results are partial.  It is safe to call Close more
+// than once.
 func (r *ViewResults) Close() error {
+	r.closed = true
+	r.rows = nil
+	return r.Err()
+}
+
+// Err returns the first error that occurred during reading the results, or the errors for the nodes which could
+// not be queried when the results are partial.
+func (r *ViewResults) Err() error {
 	if r.err != nil {
 		return r.err
 	}
-
-	// if r.endErr != nil {
-	// 	return r.endErr
-	// }
-
-	return nil
+	return r.endErr
 }
 
+// One assigns the first value from the results into the value pointer.
+// Any rows after the first are discarded without being decoded.
 func (r *ViewResults) One(valuePtr interface{}) error {
 	if !r.Next(valuePtr) {
 		err := r.Close()
@@ -82,6 +96,9 @@ func (r *ViewResults) One(valuePtr interface{}) error {
 		// return ErrNoResults TODO
 	}
 
+	// We only ever want the first row so release the remaining ones now.
+	r.rows = nil
+
 	// Ignore any errors occurring after we already have our result
 	err := r.Close()
 	if err != nil {
@@ -92,6 +109,7 @@ func (r *ViewResults) One(valuePtr interface{}) error {
 	return nil
 }
 
+// TotalRows returns the number of rows in the view, before any key range, skip or limit was applied.
 func (r *ViewResults) TotalRows() int {
 	return r.totalRows
 }
@@ -106,13 +124,14 @@ func (b *Bucket) ViewQuery(designDoc string, viewName string, opts *ViewOptions)
 		ctx = context.Background()
 	}
 
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
 	var span opentracing.Span
-	if opts.ParentSpanContext == nil {
+	if parentSpanCtx == nil {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteViewQuery",
 			opentracing.Tag{Key: "couchbase.service", Value: "views"})
 	} else {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteViewQuery",
-			opentracing.Tag{Key: "couchbase.service", Value: "views"}, opentracing.ChildOf(opts.ParentSpanContext))
+			opentracing.Tag{Key: "couchbase.service", Value: "views"}, opentracing.ChildOf(parentSpanCtx))
 	}
 	defer span.Finish()
 
@@ -142,13 +161,14 @@ func (b *Bucket) SpatialViewQuery(designDoc string, viewName string, opts *Spati
 		ctx = context.Background()
 	}
 
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
 	var span opentracing.Span
-	if opts.ParentSpanContext == nil {
+	if parentSpanCtx == nil {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteSpatialQuery",
 			opentracing.Tag{Key: "couchbase.service", Value: "views"})
 	} else {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteSpatialQuery",
-			opentracing.Tag{Key: "couchbase.service", Value: "views"}, opentracing.ChildOf(opts.ParentSpanContext))
+			opentracing.Tag{Key: "couchbase.service", Value: "views"}, opentracing.ChildOf(parentSpanCtx))
 	}
 	defer span.Finish()
 
@@ -184,30 +204,38 @@ func (b *Bucket) executeViewQuery(ctx context.Context, traceCtx opentracing.Span
 	resp, err := provider.DoHttpRequest(req)
 	if err != nil {
 		dtrace.Finish()
-		if err == context.DeadlineExceeded {
+		// The error from the HTTP client wraps the context error so the context is checked instead.
+		if ctx.Err() == context.DeadlineExceeded {
 			return nil, timeoutError{}
-		} // TODO: test this...
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if svcErr := serviceUnavailableError("views", err); svcErr != nil {
+			return nil, svcErr
+		}
 		return nil, errors.Wrap(err, "could not complete query http request")
 	}
 
 	dtrace.Finish()
 
+	if authErr := serviceAuthError("views", resp.StatusCode); authErr != nil {
+		drainAndCloseHTTPBody(resp.Body)
+		return nil, authErr
+	}
+
 	strace := opentracing.GlobalTracer().StartSpan("streaming",
 		opentracing.ChildOf(traceCtx))
 
 	viewResp := viewResponse{}
 	jsonDec := json.NewDecoder(resp.Body)
 	err = jsonDec.Decode(&viewResp)
+	drainAndCloseHTTPBody(resp.Body)
 	if err != nil {
 		strace.Finish()
 		return nil, errors.Wrap(err, "failed to decode query response body")
 	}
 
-	err = resp.Body.Close()
-	if err != nil {
-		logDebugf("Failed to close socket (%s)", err)
-	}
-
 	strace.Finish()
 
 	if resp.StatusCode != 200 {
@@ -223,30 +251,29 @@ func (b *Bucket) executeViewQuery(ctx context.Context, traceCtx opentracing.Span
 		}
 	}
 
-	// TODO : endErrs. Partial view results.
-	var endErrs viewMultiError
+	res := &ViewResults{
+		index:     -1,
+		rows:      viewResp.Rows,
+		totalRows: viewResp.TotalRows,
+	}
+
+	// The view engine reports the nodes which could not be queried alongside the rows from those which could.
 	if len(viewResp.Errors) > 0 {
 		errs := make([]ViewQueryError, len(viewResp.Errors))
-		for i, e := range errs {
-			errs[i] = e
+		for i := range viewResp.Errors {
+			errs[i] = &viewResp.Errors[i]
 		}
-		endErrs = viewMultiError{
+		endErrs := viewMultiError{
 			errors:     errs,
 			endpoint:   resp.Endpoint,
 			httpStatus: resp.StatusCode,
+			partial:    len(viewResp.Rows) > 0,
 		}
-
-		if len(viewResp.Rows) > 0 {
-			endErrs.partial = true
-		}
+		res.endErr = endErrs
+		return res, endErrs
 	}
 
-	return &ViewResults{
-		index:     -1,
-		rows:      viewResp.Rows,
-		totalRows: viewResp.TotalRows,
-		// endErr:    endErrs,
-	}, endErrs
+	return res, nil
 }
 
 func (b *Bucket) maybePrefixDevDocument(val bool, ddoc string) string {
@@ -0,0 +1,142 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"net/url"
+	"testing"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func testGetBucketForHTTP(provider *mockHTTPProvider) *Bucket {
+	cli := &mockClient{
+		bucketName:       "mock",
+		mockHTTPProvider: provider,
+	}
+	c := &Cluster{
+		connections: map[string]client{"mock-false": cli},
+	}
+	return &Bucket{
+		sb: stateBlock{
+			clientStateBlock: clientStateBlock{
+				BucketName: "mock",
+			},
+			client:       c.getClient,
+			cachedClient: cli,
+		},
+	}
+}
+
+func testViewProvider(body string, lastReq **gocbcore.HttpRequest) *mockHTTPProvider {
+	return &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			*lastReq = req
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8092",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(body), nil},
+			}, nil
+		},
+	}
+}
+
+func TestViewQuery(t *testing.T) {
+	var req *gocbcore.HttpRequest
+	bucket := testGetBucketForHTTP(testViewProvider(
+		`{"total_rows":10,"rows":[{"id":"a","key":"a","value":1},{"id":"b","key":"b","value":2}]}`, &req))
+
+	res, err := bucket.ViewQuery("dev_beers", "by_name", &ViewOptions{
+		StartKey:        "a",
+		EndKey:          "b",
+		InclusiveEnd:    true,
+		ScanConsistency: ViewScanConsistencyRequestPlus,
+	})
+	if err != nil {
+		t.Fatalf("Expected view query to succeed but was %v", err)
+	}
+
+	reqURL, err := url.Parse(req.Path)
+	if err != nil {
+		t.Fatalf("Expected request path to be a URL but was %v", err)
+	}
+	if reqURL.Path != "/_design/beers/_view/by_name" {
+		t.Fatalf("Expected production design document view to be queried but was %s", reqURL.Path)
+	}
+	query := reqURL.Query()
+	if query.Get("startkey") != `"a"` || query.Get("endkey") != `"b"` || query.Get("inclusive_end") != "true" ||
+		query.Get("stale") != "false" {
+		t.Fatalf("Expected key range and consistency to be sent but was %v", query)
+	}
+
+	var row struct {
+		ID    string `json:"id"`
+		Value int    `json:"value"`
+	}
+	var ids []string
+	for res.Next(&row) {
+		ids = append(ids, row.ID)
+	}
+	if err := res.Close(); err != nil {
+		t.Fatalf("Expected results to close without error but was %v", err)
+	}
+	if len(ids) != 2 || ids[1] != "b" || res.TotalRows() != 10 {
+		t.Fatalf("Expected 2 of 10 rows but were %v of %d", ids, res.TotalRows())
+	}
+}
+
+func TestViewQueryPartialResults(t *testing.T) {
+	var req *gocbcore.HttpRequest
+	bucket := testGetBucketForHTTP(testViewProvider(
+		`{"total_rows":2,"rows":[{"id":"a","key":"a","value":1}],`+
+			`"errors":[{"from":"10.0.0.2:8092","reason":"timeout"}]}`, &req))
+
+	res, err := bucket.ViewQuery("beers", "by_name", nil)
+	viewErrs, ok := err.(ViewQueryErrors)
+	if !ok || !viewErrs.PartialResults() || len(viewErrs.Errors()) != 1 || viewErrs.Errors()[0].Reason() != "timeout" {
+		t.Fatalf("Expected partial results error but was %v", err)
+	}
+
+	var row struct {
+		ID string `json:"id"`
+	}
+	if !res.Next(&row) || row.ID != "a" {
+		t.Fatalf("Expected rows of partial results to be readable")
+	}
+	if _, ok := res.Close().(ViewQueryErrors); !ok {
+		t.Fatalf("Expected close to return the partial results error")
+	}
+}
+
+func TestSpatialViewQueryLimit(t *testing.T) {
+	var req *gocbcore.HttpRequest
+	bucket := testGetBucketForHTTP(testViewProvider(`{"rows":[]}`, &req))
+
+	_, err := bucket.SpatialViewQuery("geo", "by_location", &SpatialViewOptions{Skip: 5, Limit: 20, ScanConsistency: ViewScanConsistencyNotBounded})
+	if err != nil {
+		t.Fatalf("Expected spatial view query to succeed but was %v", err)
+	}
+
+	reqURL, _ := url.Parse(req.Path)
+	query := reqURL.Query()
+	if reqURL.Path != "/_design/geo/_spatial/by_location" || query.Get("skip") != "5" || query.Get("limit") != "20" ||
+		query.Get("stale") != "ok" {
+		t.Fatalf("Expected spatial view options to be sent but was %s", req.Path)
+	}
+}
+
+func TestViewQueryContextDone(t *testing.T) {
+	bucket := testGetBucketForHTTP(&mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			<-req.Context.Done()
+			return nil, &url.Error{Op: "Get", URL: "http://localhost:8092", Err: req.Context.Err()}
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := bucket.ViewQuery("beers", "by_name", &ViewOptions{Context: ctx})
+	if err != context.Canceled {
+		t.Fatalf("Expected cancelled view query to fail with the context error but was %v", err)
+	}
+}
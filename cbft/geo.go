@@ -0,0 +1,104 @@
+package cbft
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// GeoPoint represents a geographical location, as used within documents and FTS geo queries.
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+type geoPointObject struct {
+	Lat *float64 `json:"lat"`
+	Lon *float64 `json:"lon"`
+	Lng *float64 `json:"lng"`
+}
+
+// MarshalJSON marshals this point to the JSON object form, {"lat": ..., "lon": ...}, which avoids
+// any ambiguity over the ordering of latitude and longitude.
+func (p GeoPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]float64{
+		"lat": p.Lat,
+		"lon": p.Lon,
+	})
+}
+
+// UnmarshalJSON unmarshals a point from any of the JSON forms accepted by FTS: an object with
+// lat and lon (or lng) fields, a [lon, lat] array or a "lat,lon" string.
+func (p *GeoPoint) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if len(trimmed) == 0 {
+		return errors.New("invalid geo point")
+	}
+
+	switch trimmed[0] {
+	case '[':
+		var coords []float64
+		if err := json.Unmarshal(data, &coords); err != nil {
+			return err
+		}
+		if len(coords) != 2 {
+			return errors.New("geo point arrays must be in the form [lon, lat]")
+		}
+		p.Lon = coords[0]
+		p.Lat = coords[1]
+		return nil
+	case '"':
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		point, err := ParseGeoPoint(str)
+		if err != nil {
+			return err
+		}
+		*p = point
+		return nil
+	case '{':
+		var obj geoPointObject
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return err
+		}
+		if obj.Lon == nil {
+			obj.Lon = obj.Lng
+		}
+		if obj.Lat == nil || obj.Lon == nil {
+			return errors.New("geo point objects must contain lat and lon fields")
+		}
+		p.Lat = *obj.Lat
+		p.Lon = *obj.Lon
+		return nil
+	}
+
+	return errors.New("invalid geo point")
+}
+
+// ParseGeoPoint parses a point from the "lat,lon" string form.
+func ParseGeoPoint(str string) (GeoPoint, error) {
+	parts := strings.Split(str, ",")
+	if len(parts) != 2 {
+		return GeoPoint{}, errors.New("geo point strings must be in the form \"lat,lon\"")
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return GeoPoint{}, err
+	}
+
+	lon, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return GeoPoint{}, err
+	}
+
+	return GeoPoint{Lat: lat, Lon: lon}, nil
+}
+
+// String returns the point in the "lat,lon" string form.
+func (p GeoPoint) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
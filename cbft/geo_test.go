@@ -0,0 +1,107 @@
+package cbft
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGeoPointUnmarshalJSON(t *testing.T) {
+	tests := []string{
+		`{"lat":51.5,"lon":-0.12}`,
+		`{"lat":51.5,"lng":-0.12}`,
+		`[-0.12,51.5]`,
+		`"51.5,-0.12"`,
+		`" 51.5 , -0.12 "`,
+	}
+
+	for _, test := range tests {
+		var point GeoPoint
+		err := json.Unmarshal([]byte(test), &point)
+		if err != nil {
+			t.Fatalf("Expected %s to unmarshal but error was %v", test, err)
+		}
+		if point.Lat != 51.5 || point.Lon != -0.12 {
+			t.Fatalf("Expected %s to unmarshal to 51.5,-0.12 but was %v", test, point)
+		}
+	}
+
+	invalid := []string{
+		`{"lat":51.5}`,
+		`[-0.12]`,
+		`"51.5"`,
+		`"a,b"`,
+		`true`,
+	}
+
+	for _, test := range invalid {
+		var point GeoPoint
+		err := json.Unmarshal([]byte(test), &point)
+		if err == nil {
+			t.Fatalf("Expected %s to fail to unmarshal", test)
+		}
+	}
+}
+
+func TestGeoPointMarshalJSON(t *testing.T) {
+	point := GeoPoint{Lat: 51.5, Lon: -0.12}
+
+	data, err := json.Marshal(point)
+	if err != nil {
+		t.Fatalf("Expected point to marshal but error was %v", err)
+	}
+	if string(data) != `{"lat":51.5,"lon":-0.12}` {
+		t.Fatalf("Expected point to marshal to the object form but was %s", data)
+	}
+
+	var roundTripped GeoPoint
+	err = json.Unmarshal(data, &roundTripped)
+	if err != nil || roundTripped != point {
+		t.Fatalf("Expected point to round trip but was %v, %v", roundTripped, err)
+	}
+
+	if point.String() != "51.5,-0.12" {
+		t.Fatalf("Expected point string to be 51.5,-0.12 but was %s", point.String())
+	}
+}
+
+func TestGeoQueries(t *testing.T) {
+	tests := []struct {
+		query    interface{}
+		expected string
+	}{
+		{
+			NewGeoDistanceQuery(51.5, -0.12, "10mi"),
+			`{"distance":"10mi","location":{"lat":51.5,"lon":-0.12}}`,
+		},
+		{
+			NewGeoDistanceQueryFromPoint(GeoPoint{Lat: 51.5, Lon: -0.12}, "10mi"),
+			`{"distance":"10mi","location":{"lat":51.5,"lon":-0.12}}`,
+		},
+		{
+			NewGeoBoundingBoxQuery(52, -1, 51, 1),
+			`{"bottom_right":{"lat":51,"lon":1},"top_left":{"lat":52,"lon":-1}}`,
+		},
+		{
+			NewGeoBoundingBoxQueryFromPoints(GeoPoint{Lat: 52, Lon: -1}, GeoPoint{Lat: 51, Lon: 1}),
+			`{"bottom_right":{"lat":51,"lon":1},"top_left":{"lat":52,"lon":-1}}`,
+		},
+		{
+			NewSearchSortGeoDistance("geo", 51.5, -0.12),
+			`{"by":"geo_distance","field":"geo","location":{"lat":51.5,"lon":-0.12}}`,
+		},
+		{
+			NewSearchSortGeoDistanceFromPoint("geo", GeoPoint{Lat: 51.5, Lon: -0.12}),
+			`{"by":"geo_distance","field":"geo","location":{"lat":51.5,"lon":-0.12}}`,
+		},
+	}
+
+	for _, test := range tests {
+		data, err := json.Marshal(test.query)
+		if err != nil {
+			t.Fatalf("Expected query to marshal but error was %v", err)
+		}
+		if string(data) != test.expected {
+			t.Fatalf("Expected query to marshal to %s but was %s", test.expected, data)
+		}
+	}
+}
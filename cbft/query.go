@@ -578,8 +578,13 @@ type GeoDistanceQuery struct {
 
 // NewGeoDistanceQuery creates a new GeoDistanceQuery.
 func NewGeoDistanceQuery(lat, lon float64, distance string) *GeoDistanceQuery {
+	return NewGeoDistanceQueryFromPoint(GeoPoint{Lat: lat, Lon: lon}, distance)
+}
+
+// NewGeoDistanceQueryFromPoint creates a new GeoDistanceQuery around location.
+func NewGeoDistanceQueryFromPoint(location GeoPoint, distance string) *GeoDistanceQuery {
 	q := &GeoDistanceQuery{newFtsQueryBase()}
-	q.options["location"] = []float64{lon, lat}
+	q.options["location"] = location
 	q.options["distance"] = distance
 	return q
 }
@@ -603,9 +608,15 @@ type GeoBoundingBoxQuery struct {
 
 // NewGeoBoundingBoxQuery creates a new GeoBoundingBoxQuery.
 func NewGeoBoundingBoxQuery(tlLat, tlLon, brLat, brLon float64) *GeoBoundingBoxQuery {
+	return NewGeoBoundingBoxQueryFromPoints(GeoPoint{Lat: tlLat, Lon: tlLon}, GeoPoint{Lat: brLat, Lon: brLon})
+}
+
+// NewGeoBoundingBoxQueryFromPoints creates a new GeoBoundingBoxQuery for the box with the corners topLeft and
+// bottomRight.
+func NewGeoBoundingBoxQueryFromPoints(topLeft, bottomRight GeoPoint) *GeoBoundingBoxQuery {
 	q := &GeoBoundingBoxQuery{newFtsQueryBase()}
-	q.options["top_left"] = []float64{tlLon, tlLat}
-	q.options["bottom_right"] = []float64{brLon, brLat}
+	q.options["top_left"] = topLeft
+	q.options["bottom_right"] = bottomRight
 	return q
 }
 
@@ -103,10 +103,15 @@ type SearchSortGeoDistance struct {
 
 // NewSearchSortGeoDistance creates a new SearchSortGeoDistance.
 func NewSearchSortGeoDistance(field string, lat, lon float64) *SearchSortGeoDistance {
+	return NewSearchSortGeoDistanceFromPoint(field, GeoPoint{Lat: lat, Lon: lon})
+}
+
+// NewSearchSortGeoDistanceFromPoint creates a new SearchSortGeoDistance which sorts by the distance from location.
+func NewSearchSortGeoDistanceFromPoint(field string, location GeoPoint) *SearchSortGeoDistance {
 	q := &SearchSortGeoDistance{newFtsSortBase()}
 	q.options["by"] = "geo_distance"
 	q.options["field"] = field
-	q.options["location"] = []float64{lon, lat}
+	q.options["location"] = location
 	return q
 }
 
@@ -0,0 +1,299 @@
+package gocb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+const (
+	defaultCircuitBreakerFailureThreshold = 5
+	defaultCircuitBreakerSleepWindow      = 5 * time.Second
+)
+
+// CircuitBreakerConfig configures the circuit breakers for query, search and analytics endpoints.  Once an endpoint
+// has failed FailureThreshold times in a row its breaker opens, and requests are sent to the other endpoints of
+// the service instead, or fail immediately with ErrCircuitOpen if the breakers of all of them are open.  After
+// SleepWindow a single request is allowed through to check whether the endpoint has recovered.
+type CircuitBreakerConfig struct {
+	Enabled bool
+	// FailureThreshold is the number of consecutive failures that open a breaker, 5 by default.
+	FailureThreshold uint
+	// SleepWindow is how long a breaker stays open before a request is sent to check the endpoint, 5 seconds by
+	// default.
+	SleepWindow time.Duration
+}
+
+type circuitState int
+
+const (
+	circuitClosed = circuitState(iota)
+	circuitOpen
+	circuitHalfOpen
+)
+
+type endpointCircuit struct {
+	state    circuitState
+	failures uint
+	openedAt time.Time
+}
+
+// circuitBreakers tracks the health of each HTTP endpoint.  It is shared by every request made through the cluster
+// so that a failing endpoint found by one request is avoided by the others.
+type circuitBreakers struct {
+	lock             sync.Mutex
+	circuits         map[string]*endpointCircuit
+	failureThreshold uint
+	sleepWindow      time.Duration
+	now              func() time.Time
+}
+
+func newCircuitBreakers(config CircuitBreakerConfig) *circuitBreakers {
+	if !config.Enabled {
+		return nil
+	}
+
+	breakers := &circuitBreakers{
+		circuits:         make(map[string]*endpointCircuit),
+		failureThreshold: config.FailureThreshold,
+		sleepWindow:      config.SleepWindow,
+		now:              time.Now,
+	}
+	if breakers.failureThreshold == 0 {
+		breakers.failureThreshold = defaultCircuitBreakerFailureThreshold
+	}
+	if breakers.sleepWindow <= 0 {
+		breakers.sleepWindow = defaultCircuitBreakerSleepWindow
+	}
+	return breakers
+}
+
+// allow returns whether a request can be sent to endpoint.  Once the sleep window of an open breaker has passed
+// one request is allowed through, and others are refused until it completes.
+func (b *circuitBreakers) allow(endpoint string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	circuit := b.circuits[endpoint]
+	if circuit == nil {
+		return true
+	}
+
+	switch circuit.state {
+	case circuitOpen:
+		if b.now().Sub(circuit.openedAt) < b.sleepWindow {
+			return false
+		}
+		circuit.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		return false
+	default:
+		return true
+	}
+}
+
+// record records the outcome of a request to endpoint, returning whether its breaker is now open.
+func (b *circuitBreakers) record(endpoint string, failed bool) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	circuit := b.circuits[endpoint]
+	if !failed {
+		if circuit != nil {
+			if circuit.state != circuitClosed {
+				logInfof("Circuit breaker for %s closed", endpoint)
+			}
+			delete(b.circuits, endpoint)
+		}
+		return false
+	}
+
+	if circuit == nil {
+		circuit = &endpointCircuit{}
+		b.circuits[endpoint] = circuit
+	}
+	circuit.failures++
+	if circuit.state == circuitHalfOpen || circuit.failures >= b.failureThreshold {
+		if circuit.state != circuitOpen {
+			logWarnf("Circuit breaker for %s opened after %d failures", endpoint, circuit.failures)
+		}
+		circuit.state = circuitOpen
+		circuit.openedAt = b.now()
+	}
+	return circuit.state == circuitOpen
+}
+
+// abandon records that a request to endpoint ended without showing whether the endpoint is healthy, such as when
+// it was cancelled.  The failures of the endpoint are kept, and a half-open breaker is opened again so that the
+// next request checks the endpoint instead.  It returns whether the breaker is open.
+func (b *circuitBreakers) abandon(endpoint string) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	circuit := b.circuits[endpoint]
+	if circuit == nil {
+		return false
+	}
+	if circuit.state == circuitHalfOpen {
+		circuit.state = circuitOpen
+	}
+	return circuit.state == circuitOpen
+}
+
+// recordRequest records the outcome of req, sent to endpoint, returning whether the breaker of endpoint is now
+// open.  Requests whose context was cancelled or passed its deadline are counted as neither a success nor a failure.
+func (b *circuitBreakers) recordRequest(endpoint string, req *gocbcore.HttpRequest, resp *gocbcore.HttpResponse,
+	err error) bool {
+	if err != nil && req.Context != nil && req.Context.Err() != nil {
+		return b.abandon(endpoint)
+	}
+	return b.record(endpoint, isCircuitFailure(resp, err))
+}
+
+// isCircuitFailure returns whether the outcome of a request shows that the endpoint is unhealthy, rather than the
+// request being rejected.
+func isCircuitFailure(resp *gocbcore.HttpResponse, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable ||
+		resp.StatusCode == http.StatusGatewayTimeout
+}
+
+// isIdempotentRequest returns whether req can be sent again after a node may already have executed it: requests
+// other than POSTs, search queries, which only read, and queries sent with the readonly option.
+func isIdempotentRequest(req *gocbcore.HttpRequest) bool {
+	if req.Method != "POST" {
+		return true
+	}
+	if ServiceType(req.Service) == FtsService {
+		return true
+	}
+
+	body := req.Body
+	if req.Headers["Content-Encoding"] == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return false
+		}
+		body, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return false
+		}
+	}
+
+	var opts struct {
+		ReadOnly bool `json:"readonly"`
+	}
+	if err := json.Unmarshal(body, &opts); err != nil {
+		return false
+	}
+	return opts.ReadOnly
+}
+
+// circuitBreakerProvider sends requests for a service to endpoints whose breakers are closed.  When an endpoint
+// fails and its breaker opens the request is sent to another endpoint straight away, rather than waiting for the
+// retry behavior to retry it, so that a failing node does not add to the latency of requests.  Only requests which
+// are idempotent, or which were never sent as no connection could be made, are sent to another endpoint, so that
+// statements such as DML are not executed twice.
+type circuitBreakerProvider struct {
+	endpointForwarder
+	service  ServiceType
+	breakers *circuitBreakers
+}
+
+// withCircuitBreakers returns provider, wrapped to use the circuit breakers of the cluster if they are enabled.
+func (c *Cluster) withCircuitBreakers(service ServiceType, provider httpProvider) httpProvider {
+	if c.breakers == nil {
+		return provider
+	}
+
+	return &circuitBreakerProvider{
+		endpointForwarder: endpointForwarder{provider},
+		service:           service,
+		breakers:          c.breakers,
+	}
+}
+
+func (p *circuitBreakerProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	if ServiceType(req.Service) != p.service {
+		return p.httpProvider.DoHttpRequest(req)
+	}
+
+	// Requests for a specific endpoint, such as those which are part of a transaction, cannot be rerouted.
+	if req.Endpoint != "" {
+		if !p.breakers.allow(req.Endpoint) {
+			return nil, errors.Wrapf(ErrCircuitOpen, "endpoint %s", req.Endpoint)
+		}
+		resp, err := p.httpProvider.DoHttpRequest(req)
+		p.breakers.recordRequest(req.Endpoint, req, resp, err)
+		return resp, err
+	}
+
+	eps := serviceEndpoints(p.httpProvider, p.service)
+	if len(eps) == 0 {
+		return p.httpProvider.DoHttpRequest(req)
+	}
+
+	// As well as when a breaker opens, the request is rerouted once when a connection cannot be made, as it would
+	// be by the fallbackHostProvider if the breakers were not enabled.
+	tried := make(map[string]bool, len(eps))
+	fellBack := false
+	for {
+		endpoint := p.pickEndpoint(eps, tried)
+		if endpoint == "" {
+			return nil, errors.Wrapf(ErrCircuitOpen, "service %d", req.Service)
+		}
+		tried[endpoint] = true
+
+		attempt := *req
+		attempt.Endpoint = endpoint
+		resp, err := p.httpProvider.DoHttpRequest(&attempt)
+		opened := p.breakers.recordRequest(endpoint, &attempt, resp, err)
+		notSent := err != nil && isDialError(err)
+		fallback := !fellBack && notSent && (p.service == N1qlService || p.service == FtsService)
+		reroute := (opened && (notSent || isIdempotentRequest(req))) || fallback
+		if !reroute || len(tried) == len(eps) || (req.Context != nil && req.Context.Err() != nil) {
+			return resp, err
+		}
+
+		if !opened {
+			fellBack = true
+			logDebugf("Rerouting request away from %s after failing to connect (%s)", endpoint, err)
+			continue
+		}
+		logDebugf("Rerouting request away from %s as its circuit breaker opened", endpoint)
+		if resp != nil {
+			drainAndCloseHTTPBody(resp.Body)
+		}
+	}
+}
+
+// pickEndpoint returns a random endpoint which has not been tried and whose breaker allows a request, or an empty
+// string if there is none.
+func (p *circuitBreakerProvider) pickEndpoint(eps []string, tried map[string]bool) string {
+	candidates := make([]string, 0, len(eps))
+	for _, ep := range eps {
+		if !tried[ep] {
+			candidates = append(candidates, ep)
+		}
+	}
+
+	for len(candidates) > 0 {
+		idx := rand.Intn(len(candidates))
+		if p.breakers.allow(candidates[idx]) {
+			return candidates[idx]
+		}
+		candidates = append(candidates[:idx], candidates[idx+1:]...)
+	}
+	return ""
+}
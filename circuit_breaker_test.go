@@ -0,0 +1,186 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestCircuitBreakerReroutesRequests(t *testing.T) {
+	failing := map[string]bool{"http://a:8093": true}
+	attempts := make(map[string]int)
+	provider := &mockServiceEpsProvider{
+		mockHTTPProvider: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				attempts[req.Endpoint]++
+				if failing[req.Endpoint] {
+					return nil, errors.New("connection refused")
+				}
+				return &gocbcore.HttpResponse{
+					Endpoint:   req.Endpoint,
+					StatusCode: 200,
+					Body:       &testReadCloser{bytes.NewBufferString(`{"results":[],"status":"success"}`), nil},
+				}, nil
+			},
+		},
+		n1qlEps: []string{"http://a:8093", "http://b:8093"},
+	}
+
+	now := time.Now()
+	breakers := newCircuitBreakers(CircuitBreakerConfig{Enabled: true, FailureThreshold: 1, SleepWindow: time.Minute})
+	breakers.now = func() time.Time { return now }
+
+	cluster := &Cluster{breakers: breakers}
+	p := cluster.withCircuitBreakers(N1qlService, provider)
+
+	for i := 0; i < 10; i++ {
+		resp, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+		if err != nil {
+			t.Fatalf("Expected request to be rerouted to the healthy endpoint but was %v", err)
+		}
+		if resp.Endpoint != "http://b:8093" {
+			t.Fatalf("Expected request to be sent to b but was %s", resp.Endpoint)
+		}
+	}
+	if attempts["http://a:8093"] > 1 {
+		t.Fatalf("Expected a to be avoided once its breaker opened but was sent %d requests", attempts["http://a:8093"])
+	}
+
+	// With every breaker open requests fail immediately.
+	failing["http://b:8093"] = true
+	p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+	_, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+	if pkgerrors.Cause(err) != ErrCircuitOpen {
+		t.Fatalf("Expected circuit open error but was %v", err)
+	}
+
+	// Once the sleep window has passed a request is allowed through, and success closes the breaker.
+	failing = map[string]bool{}
+	now = now.Add(2 * time.Minute)
+	_, err = p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+	if err != nil {
+		t.Fatalf("Expected request after the sleep window to succeed but was %v", err)
+	}
+	if len(breakers.circuits) != 1 {
+		t.Fatalf("Expected one breaker to have closed but %d remain", len(breakers.circuits))
+	}
+}
+
+func TestQueryFailsFastWhenCircuitOpen(t *testing.T) {
+	provider := &mockServiceEpsProvider{
+		mockHTTPProvider: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				return nil, errors.New("connection refused")
+			},
+		},
+		n1qlEps: []string{"http://a:8093"},
+	}
+
+	cluster := testGetClusterForHTTP(provider.mockHTTPProvider, 10*time.Second, 0, 0)
+	cluster.connections["mock-false"].(*mockClient).mockHTTPProvider = provider
+	cluster.sb.N1qlRetryBehavior = StandardDelayRetryBehavior(10, 1, time.Second, LinearDelayFunction)
+	cluster.breakers = newCircuitBreakers(CircuitBreakerConfig{Enabled: true, FailureThreshold: 1})
+
+	_, err := cluster.Query("SELECT 1=1", nil)
+	if err == nil {
+		t.Fatalf("Expected query to fail")
+	}
+
+	// The failure opened the breaker of the only endpoint, so the next query fails without being sent or retried.
+	start := time.Now()
+	_, err = cluster.Query("SELECT 1=1", nil)
+	if pkgerrors.Cause(err) != ErrCircuitOpen {
+		t.Fatalf("Expected circuit open error but was %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatalf("Expected query to fail fast but took %s", time.Since(start))
+	}
+}
+
+func TestCircuitBreakerOnlyReroutesIdempotentRequests(t *testing.T) {
+	var attempts []string
+	provider := &mockServiceEpsProvider{
+		mockHTTPProvider: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				attempts = append(attempts, req.Endpoint)
+				status := 200
+				if req.Endpoint == "http://a:8093" {
+					status = 503
+				}
+				return &gocbcore.HttpResponse{
+					Endpoint:   req.Endpoint,
+					StatusCode: status,
+					Body:       &testReadCloser{bytes.NewBufferString(`{"results":[],"status":"success"}`), nil},
+				}, nil
+			},
+		},
+		n1qlEps: []string{"http://a:8093", "http://b:8093"},
+	}
+
+	for _, tc := range []struct {
+		body     string
+		rerouted bool
+	}{
+		{`{"statement":"DELETE FROM default"}`, false},
+		{`{"statement":"SELECT 1","readonly":true}`, true},
+	} {
+		for i := 0; i < 10; i++ {
+			breakers := newCircuitBreakers(CircuitBreakerConfig{Enabled: true, FailureThreshold: 1})
+			cluster := &Cluster{breakers: breakers}
+			p := cluster.withCircuitBreakers(N1qlService, provider)
+
+			attempts = nil
+			resp, err := p.DoHttpRequest(&gocbcore.HttpRequest{
+				Service: gocbcore.N1qlService,
+				Method:  "POST",
+				Body:    []byte(tc.body),
+			})
+			if err != nil {
+				t.Fatalf("Expected request to be sent but was %v", err)
+			}
+			if attempts[0] == "http://b:8093" {
+				continue
+			}
+			if tc.rerouted && (len(attempts) != 2 || resp.Endpoint != "http://b:8093") {
+				t.Fatalf("Expected %s to be rerouted to b but was sent to %v", tc.body, attempts)
+			}
+			if !tc.rerouted && (len(attempts) != 1 || resp.StatusCode != 503) {
+				t.Fatalf("Expected %s not to be rerouted but was sent to %v", tc.body, attempts)
+			}
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresCancelledRequests(t *testing.T) {
+	now := time.Now()
+	breakers := newCircuitBreakers(CircuitBreakerConfig{Enabled: true, FailureThreshold: 2, SleepWindow: time.Minute})
+	breakers.now = func() time.Time { return now }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelled := &gocbcore.HttpRequest{Context: ctx}
+	endpoint := "http://a:8093"
+
+	breakers.record(endpoint, true)
+	breakers.recordRequest(endpoint, cancelled, nil, context.Canceled)
+	if circuit := breakers.circuits[endpoint]; circuit == nil || circuit.failures != 1 {
+		t.Fatalf("Expected cancelled request not to reset the failure count but was %+v", circuit)
+	}
+
+	breakers.record(endpoint, true)
+	now = now.Add(2 * time.Minute)
+	if !breakers.allow(endpoint) {
+		t.Fatalf("Expected a request to be allowed once the sleep window passed")
+	}
+	if opened := breakers.recordRequest(endpoint, cancelled, nil, context.Canceled); !opened {
+		t.Fatalf("Expected cancelled check request to leave the breaker open")
+	}
+	if !breakers.allow(endpoint) {
+		t.Fatalf("Expected another check request to be allowed after the cancelled one")
+	}
+}
@@ -3,6 +3,7 @@ package gocb
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -17,6 +18,9 @@ type client interface {
 	getKvProvider() (kvProvider, error)
 	getHTTPProvider() (httpProvider, error)
 	getDiagnosticsProvider() (diagnosticsProvider, error)
+	openDcpProvider(streamName string, flags gocbcore.DcpOpenFlag) (dcpProvider, error)
+	reconnect() error
+	bucketGeneration() uint32
 	close() error
 }
 
@@ -24,7 +28,17 @@ type stdClient struct {
 	cluster *Cluster
 	state   clientStateBlock
 	lock    sync.Mutex
-	agent   *gocbcore.Agent
+
+	// agentLock guards the agent, and the heartbeater and provider built on it, which are replaced when the
+	// client reconnects.
+	agentLock   sync.RWMutex
+	agent       *gocbcore.Agent
+	heartbeater *kvHeartbeater
+	kvProvider  kvProvider
+
+	uuidLock   sync.Mutex
+	bucketUUID string
+	generation uint32
 }
 
 func newClient(cluster *Cluster, sb *clientStateBlock) *stdClient {
@@ -44,6 +58,97 @@ func (c *stdClient) connect() error {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	if c.currentAgent() != nil {
+		// The client is shared between buckets and has already been connected.
+		return nil
+	}
+
+	agent, err := c.createAgent()
+	if err != nil {
+		return err
+	}
+
+	c.setAgent(agent)
+	return nil
+}
+
+// reconnect replaces the client's agent with one connected using the cluster's current credentials.  The old
+// agent is closed once any operations already sent through it have had time to complete.  Clients which have
+// not yet connected are left alone as they will use the current credentials when they do.
+func (c *stdClient) reconnect() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.currentAgent() == nil {
+		return nil
+	}
+
+	agent, err := c.createAgent()
+	if err != nil {
+		return err
+	}
+
+	oldAgent, oldHeartbeater := c.setAgent(agent)
+	oldHeartbeater.close()
+
+	time.AfterFunc(c.cluster.longestServiceTimeout(), func() {
+		closeServiceTransports(oldAgent)
+		if err := oldAgent.Close(); err != nil {
+			logDebugf("Failed to close replaced agent (%s)", err)
+		}
+	})
+
+	return nil
+}
+
+func (c *stdClient) createAgent() (*gocbcore.Agent, error) {
+	config, err := c.agentConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	agent, err := gocbcore.CreateAgent(config)
+	if err != nil {
+		return nil, maybeEnhanceErr(err, "")
+	}
+	c.cluster.withServiceTransports(agent)
+
+	return agent, nil
+}
+
+// setAgent makes agent the client's agent, returning the agent and heartbeater which it replaced.
+func (c *stdClient) setAgent(agent *gocbcore.Agent) (*gocbcore.Agent, *kvHeartbeater) {
+	ssb := c.cluster.ssb
+
+	var provider kvProvider = agent
+	if ssb.overloadBehavior == OverloadWait {
+		provider = newOverloadWaitingProvider(agent, ssb.overloadMaxWait)
+	}
+
+	var heartbeater *kvHeartbeater
+	if ssb.kvHeartbeatInterval > 0 {
+		heartbeater = newKvHeartbeater(agent, ssb, c.reconnect, c.cluster.onDeadConnection)
+		heartbeater.start()
+	}
+
+	c.agentLock.Lock()
+	oldAgent, oldHeartbeater := c.agent, c.heartbeater
+	c.agent = agent
+	c.kvProvider = provider
+	c.heartbeater = heartbeater
+	c.agentLock.Unlock()
+
+	return oldAgent, oldHeartbeater
+}
+
+func (c *stdClient) currentAgent() *gocbcore.Agent {
+	c.agentLock.RLock()
+	defer c.agentLock.RUnlock()
+	return c.agent
+}
+
+// agentConfig returns the configuration used to create the agents for this client.
+func (c *stdClient) agentConfig() (*gocbcore.AgentConfig, error) {
 	config := &gocbcore.AgentConfig{
 		// TODO: Generate the UserString appropriately
 		UserString:           "gocb/" + Version(),
@@ -55,6 +160,7 @@ func (c *stdClient) connect() error {
 		NoRootTraceSpans:     true,
 		UseCollections:       true,
 		UseEnhancedErrors:    true,
+		Tracer:               kvQueueTracer{},
 	}
 
 	config.BucketName = c.state.BucketName
@@ -66,37 +172,108 @@ func (c *stdClient) connect() error {
 
 	err := config.FromConnStr(c.cluster.connSpec().String())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	agent, err := gocbcore.CreateAgent(config)
+	config.TlsConfig = c.cluster.withTLSVerification(config.TlsConfig)
+
+	// Options set on the cluster take precedence over those from the connection string.
+	ssb := c.cluster.ssb
+	if ssb.httpMaxIdleConns > 0 {
+		config.HttpMaxIdleConns = ssb.httpMaxIdleConns
+	}
+	if ssb.httpMaxIdleConnsPerHost > 0 {
+		config.HttpMaxIdleConnsPerHost = ssb.httpMaxIdleConnsPerHost
+	}
+	if ssb.httpIdleConnTimeout > 0 {
+		config.HttpIdleConnTimeout = ssb.httpIdleConnTimeout
+	}
+	if ssb.connectTimeout > 0 {
+		config.ConnectTimeout = ssb.connectTimeout
+	}
+	if ssb.kvConnectTimeout > 0 {
+		config.ServerConnectTimeout = ssb.kvConnectTimeout
+	}
+
+	return config, nil
+}
+
+// openDcpProvider creates a new agent, with its own connections, for streaming changes from the bucket.  The
+// caller owns the agent and must close it.
+func (c *stdClient) openDcpProvider(streamName string, flags gocbcore.DcpOpenFlag) (dcpProvider, error) {
+	config, err := c.agentConfig()
 	if err != nil {
-		return maybeEnhanceErr(err, "")
+		return nil, err
 	}
 
-	c.agent = agent
-	return nil
+	agent, err := gocbcore.CreateDcpAgent(config, streamName, flags)
+	if err != nil {
+		return nil, maybeEnhanceErr(err, "")
+	}
+
+	return agent, nil
 }
 
 func (c *stdClient) getKvProvider() (kvProvider, error) {
-	if c.agent == nil {
+	c.agentLock.RLock()
+	agent, provider, heartbeater := c.agent, c.kvProvider, c.heartbeater
+	c.agentLock.RUnlock()
+
+	if agent == nil {
 		return nil, errors.New("Cluster not yet connected")
 	}
-	return c.agent, nil
+	c.checkBucketRecreated(agent)
+	heartbeater.touch()
+	return provider, nil
+}
+
+// checkBucketRecreated compares the bucket uuid from the latest topology against the one previously seen,
+// a change means that the bucket has been deleted and recreated underneath us so anything cached against
+// the old bucket needs to be thrown away.
+func (c *stdClient) checkBucketRecreated(agent *gocbcore.Agent) {
+	uuid := agent.BucketUUID()
+	if uuid == "" {
+		return
+	}
+
+	c.uuidLock.Lock()
+	if c.bucketUUID == uuid {
+		c.uuidLock.Unlock()
+		return
+	}
+	previousUUID := c.bucketUUID
+	c.bucketUUID = uuid
+	c.uuidLock.Unlock()
+
+	if previousUUID == "" {
+		return
+	}
+
+	logInfof("Bucket %s has been recreated (uuid %s -> %s), resetting cached state", c.state.BucketName,
+		previousUUID, uuid)
+	atomic.AddUint32(&c.generation, 1)
+	c.cluster.bucketRecreated(c.state.BucketName)
+}
+
+// bucketGeneration returns a counter which is incremented each time the bucket is detected as being recreated.
+func (c *stdClient) bucketGeneration() uint32 {
+	return atomic.LoadUint32(&c.generation)
 }
 
 func (c *stdClient) getHTTPProvider() (httpProvider, error) {
-	if c.agent == nil {
+	agent := c.currentAgent()
+	if agent == nil {
 		return nil, errors.New("Cluster not yet connected")
 	}
-	return c.agent, nil
+	return agent, nil
 }
 
 func (c *stdClient) getDiagnosticsProvider() (diagnosticsProvider, error) {
-	if c.agent == nil {
+	agent := c.currentAgent()
+	if agent == nil {
 		return nil, errors.New("Cluster not yet connected")
 	}
-	return c.agent, nil
+	return agent, nil
 }
 
 func (c *stdClient) fetchCollectionID(ctx context.Context, scopeName string, collectionName string) (uint32, error) {
@@ -104,7 +281,8 @@ func (c *stdClient) fetchCollectionID(ctx context.Context, scopeName string, col
 		return 0, nil
 	}
 
-	if c.agent == nil {
+	agent := c.currentAgent()
+	if agent == nil {
 		return 0, errors.New("Cluster not yet connected")
 	}
 
@@ -112,7 +290,7 @@ func (c *stdClient) fetchCollectionID(ctx context.Context, scopeName string, col
 	var collectionID uint32
 	var colErr error
 
-	op, err := c.agent.GetCollectionID(scopeName, collectionName, func(manifestID uint64, cid uint32, err error) {
+	op, err := agent.GetCollectionID(scopeName, collectionName, func(manifestID uint64, cid uint32, err error) {
 		if err != nil {
 			colErr = err
 			waitCh <- struct{}{}
@@ -144,8 +322,14 @@ func (c *stdClient) fetchCollectionID(ctx context.Context, scopeName string, col
 }
 
 func (c *stdClient) close() error {
-	if c.agent == nil {
+	c.agentLock.RLock()
+	agent, heartbeater := c.agent, c.heartbeater
+	c.agentLock.RUnlock()
+
+	if agent == nil {
 		return errors.New("Cluster not yet connected") //TODO
 	}
-	return c.agent.Close()
+	heartbeater.close()
+	closeServiceTransports(agent)
+	return agent.Close()
 }
@@ -7,7 +7,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/couchbase/gocbcore"
 	opentracing "github.com/opentracing/opentracing-go"
 	"gopkg.in/couchbaselabs/gocbconnstr.v1"
 )
@@ -17,19 +16,138 @@ type Cluster struct {
 	cSpec gocbconnstr.ConnSpec
 	auth  Authenticator
 
-	connectionsLock sync.RWMutex
-	connections     map[string]client
+	connectionsLock       sync.RWMutex
+	connections           map[string]client
+	connectionRefs        map[string]int
+	idleTimers            map[string]*time.Timer
+	connectionIdleTimeout time.Duration
+	clientFactory         func(sb *clientStateBlock) client
 
 	clusterLock sync.RWMutex
-	queryCache  map[string]*n1qlCache
+	queryCache  map[n1qlCacheKey]*n1qlCache
+	reprepare   queryReprepareState
 
 	sb  stateBlock
 	ssb servicesStateBlock
+
+	onBucketRecreated func(bucketName string)
+	onDeadConnection  func(endpoint string)
+
+	serviceHTTPConfigs map[ServiceType]ServiceHTTPConfig
+	breakers           *circuitBreakers
+	queryResults       *queryResultCache
+
+	insecureWarning sync.Once
 }
 
 // ClusterOptions is the set of options available for creating a Cluster.
 type ClusterOptions struct {
 	Authenticator Authenticator
+
+	// HTTPMaxIdleConns, HTTPMaxIdleConnsPerHost and HTTPIdleConnTimeout tune the pool of
+	// connections used for the query, search, analytics, view and management services.
+	// The pool is shared by the services without their own ServiceHTTPConfigs, a zero value
+	// leaves the corresponding connection string option (or default) in place.
+	HTTPMaxIdleConns        int
+	HTTPMaxIdleConnsPerHost int
+	HTTPIdleConnTimeout     time.Duration
+
+	// ServiceHTTPConfigs gives services their own pool of HTTP connections, so that, for example, long running
+	// analytics queries cannot use up the connections needed for query requests, and their own TLS configuration,
+	// e.g. when a service is behind a terminating proxy with its own CA.  Settings which are not given are taken
+	// from the shared pool and the connection string.
+	ServiceHTTPConfigs map[ServiceType]ServiceHTTPConfig
+
+	// MetricsRecorder, if set, receives the encoded size of each document read from or written to
+	// any collection opened through this cluster.
+	MetricsRecorder MetricsRecorder
+
+	// OnBucketRecreated, if set, is called with the name of a bucket when it is detected that the bucket
+	// has been deleted and recreated whilst connected.  Any state cached against the old bucket, such as
+	// collection ids and prepared statements, is reset before this is called.
+	OnBucketRecreated func(bucketName string)
+
+	// ApplicationName, if set, is sent as a header with each query, search and analytics request so that
+	// proxies and audit layers can attribute requests to an application without parsing request bodies.
+	ApplicationName string
+
+	// ConnectionIdleTimeout is how long the connection to a bucket is kept open once every Bucket using it
+	// has been closed, allowing it to be reused if the bucket is opened again.  A zero value closes the
+	// connection as soon as the last Bucket using it is closed.
+	ConnectionIdleTimeout time.Duration
+
+	// KvHeartbeatInterval, if set, is how long a bucket connection may be idle before a NOOP is sent to each KV
+	// node.  This keeps connections open through firewalls which drop idle connections, avoiding timeouts on
+	// the first operations after an idle period.
+	KvHeartbeatInterval time.Duration
+	// KvHeartbeatTimeout is how long to wait for a heartbeat response, defaulting to 2.5 seconds.
+	KvHeartbeatTimeout time.Duration
+	// KvDeadConnectionFailures is the number of consecutive heartbeats a KV node can fail before its
+	// connection is reported as dead and the bucket connection is re-established, defaulting to 3.
+	KvDeadConnectionFailures uint
+	// OnDeadConnection, if set, is called with the address of a KV node when its connection is detected as dead.
+	OnDeadConnection func(endpoint string)
+
+	// ConnectTimeout is how long to wait for a bucket to connect, and KvConnectTimeout how long to wait for the
+	// connection to each KV node, including authentication.
+	ConnectTimeout   time.Duration
+	KvConnectTimeout time.Duration
+	// KvTimeout is the default timeout of key value operations, and DurabilityTimeout how long to wait for
+	// durability requirements to be met, for every collection opened through this cluster.
+	KvTimeout         time.Duration
+	DurabilityTimeout time.Duration
+	// QueryTimeout, SearchTimeout and AnalyticsTimeout are the default timeouts of each service.
+	QueryTimeout     time.Duration
+	SearchTimeout    time.Duration
+	AnalyticsTimeout time.Duration
+	// RetryBehavior, if set, is used to retry failed query, search and analytics requests.
+	RetryBehavior RetryBehavior
+
+	// OverloadBehavior controls whether key value operations fail immediately with ErrOverload when the client's
+	// operation queues are full, the default, or wait up to OverloadMaxWait (1 second by default) for space.
+	OverloadBehavior OverloadBehavior
+	OverloadMaxWait  time.Duration
+
+	// HTTPRequestCompression gzips query, search and analytics request bodies of at least
+	// HTTPRequestCompressionMinSize bytes (1024 by default), reducing bandwidth for large requests such as
+	// those with many parameters.  Responses are always compressed when the server supports it, and are
+	// decompressed transparently.
+	HTTPRequestCompression        bool
+	HTTPRequestCompressionMinSize int
+
+	// SlowConsumerThreshold, if set, is how long the results of a query or analytics request can be held open
+	// without being fully read or closed before a warning is logged, and MetricsRecorder is notified if it
+	// implements SlowConsumerRecorder.  This helps to find code which stalls whilst reading results or leaks them.
+	SlowConsumerThreshold time.Duration
+
+	// IDGenerator, if set, generates the client context ids of query, analytics and search requests which are not
+	// given one, and the ids of ping reports, diagnostics reports and change streams.  By default random uuids are
+	// used for query requests and reports, and analytics and search requests are sent without a client context id.
+	IDGenerator IDGenerator
+
+	// ManagementTimeout is how long a management operation, such as creating a bucket or an index, can take
+	// before it times out, 75 seconds by default.  It can be changed for individual managers with WithTimeout.
+	ManagementTimeout time.Duration
+
+	// PreparedNamePrefix, if set, names the statements prepared for Prepared queries with the prefix followed by a
+	// hash of the statement and its query context, rather than letting the query service choose a name.  Instances
+	// of an application using the same prefix share prepared statements, see QueryOptions.PreparedName.
+	PreparedNamePrefix string
+
+	// CircuitBreaker configures circuit breakers for query, search and analytics endpoints, so that requests avoid
+	// endpoints which are repeatedly failing rather than retrying against them.  They are disabled by default.
+	CircuitBreaker CircuitBreakerConfig
+
+	// InsecureSkipVerify disables verification of the certificates presented by the cluster when connecting with
+	// couchbases://, for development and test clusters with self-signed certificates.  It only applies to this
+	// cluster, not to the TLS configuration of ServiceHTTPConfigs, and a warning is logged when it is in effect.
+	// It must not be used in production as connections are not protected against man-in-the-middle attacks.
+	InsecureSkipVerify bool
+
+	// QueryResultCacheSize is the number of query results which can be cached, the least recently used being evicted
+	// when the cache is full.  Only the results of queries run with QueryOptions.CacheFor are cached, and caching
+	// is disabled if this is 0.
+	QueryResultCacheSize int
 }
 
 // ClusterCloseOptions is the set of options available when disconnecting from a Cluster.
@@ -68,6 +186,7 @@ type ClusterCloseOptions struct {
 //   n1ql_timeout (int) - Maximum execution time for n1ql queries in ms.
 //   fts_timeout (int) - Maximum execution time for fts searches in ms.
 //   analytics_timeout (int) - Maximum execution time for analytics queries in ms.
+//   management_timeout (int) - Maximum execution time for management operations in ms.
 func NewCluster(connStr string, opts ClusterOptions) (*Cluster, error) {
 	connSpec, err := gocbconnstr.Parse(connStr)
 	if err != nil {
@@ -78,18 +197,61 @@ func NewCluster(connStr string, opts ClusterOptions) (*Cluster, error) {
 		cSpec:       connSpec,
 		auth:        opts.Authenticator,
 		connections: make(map[string]client),
+		queryCache:  make(map[n1qlCacheKey]*n1qlCache),
+
+		connectionIdleTimeout: opts.ConnectionIdleTimeout,
+		onBucketRecreated:     opts.OnBucketRecreated,
+		onDeadConnection:      opts.OnDeadConnection,
 		ssb: servicesStateBlock{
 			n1qlTimeout:      75 * time.Second,
 			analyticsTimeout: 75 * time.Second,
 			searchTimeout:    75 * time.Second,
+
+			httpMaxIdleConns:        opts.HTTPMaxIdleConns,
+			httpMaxIdleConnsPerHost: opts.HTTPMaxIdleConnsPerHost,
+			httpIdleConnTimeout:     opts.HTTPIdleConnTimeout,
+
+			applicationName: opts.ApplicationName,
+
+			kvHeartbeatInterval:      opts.KvHeartbeatInterval,
+			kvHeartbeatTimeout:       opts.KvHeartbeatTimeout,
+			kvDeadConnectionFailures: opts.KvDeadConnectionFailures,
+
+			connectTimeout:   opts.ConnectTimeout,
+			kvConnectTimeout: opts.KvConnectTimeout,
+
+			overloadBehavior: opts.OverloadBehavior,
+			overloadMaxWait:  opts.OverloadMaxWait,
+
+			httpRequestCompression:        opts.HTTPRequestCompression,
+			httpRequestCompressionMinSize: opts.HTTPRequestCompressionMinSize,
+
+			slowConsumerThreshold: opts.SlowConsumerThreshold,
+
+			idGenerator: opts.IDGenerator,
+
+			preparedNamePrefix: opts.PreparedNamePrefix,
 		},
 		sb: stateBlock{
 			N1qlRetryBehavior:      StandardDelayRetryBehavior(10, 2, 500*time.Millisecond, ExponentialDelayFunction),
 			AnalyticsRetryBehavior: StandardDelayRetryBehavior(10, 2, 500*time.Millisecond, ExponentialDelayFunction),
 			SearchRetryBehavior:    StandardDelayRetryBehavior(10, 2, 500*time.Millisecond, ExponentialDelayFunction),
+			MgmtRetryBehavior:      StandardDelayRetryBehavior(10, 2, 500*time.Millisecond, ExponentialDelayFunction),
+			MetricsRecorder:        opts.MetricsRecorder,
+			KvErrors:               newKvErrorHeatmap(),
+
+			KvTimeout:   opts.KvTimeout,
+			DuraTimeout: opts.DurabilityTimeout,
 		},
 	}
 
+	if opts.RetryBehavior != nil {
+		cluster.sb.N1qlRetryBehavior = opts.RetryBehavior
+		cluster.sb.AnalyticsRetryBehavior = opts.RetryBehavior
+		cluster.sb.SearchRetryBehavior = opts.RetryBehavior
+		cluster.sb.MgmtRetryBehavior = opts.RetryBehavior
+	}
+
 	cluster.sb.N1qlTimeout = cluster.n1qlTimeout
 	cluster.sb.SearchTimeout = cluster.searchTimeout
 	cluster.sb.AnalyticsTimeout = cluster.analyticsTimeout
@@ -100,6 +262,25 @@ func NewCluster(connStr string, opts ClusterOptions) (*Cluster, error) {
 		return nil, err
 	}
 
+	// Options set on the cluster take precedence over those from the connection string.
+	if opts.QueryTimeout > 0 {
+		cluster.ssb.n1qlTimeout = opts.QueryTimeout
+	}
+	if opts.SearchTimeout > 0 {
+		cluster.ssb.searchTimeout = opts.SearchTimeout
+	}
+	if opts.AnalyticsTimeout > 0 {
+		cluster.ssb.analyticsTimeout = opts.AnalyticsTimeout
+	}
+	if opts.ManagementTimeout > 0 {
+		cluster.ssb.mgmtTimeout = opts.ManagementTimeout
+	}
+	cluster.ssb.insecureSkipVerify = opts.InsecureSkipVerify
+
+	cluster.serviceHTTPConfigs = opts.ServiceHTTPConfigs
+	cluster.breakers = newCircuitBreakers(opts.CircuitBreaker)
+	cluster.queryResults = newQueryResultCache(opts.QueryResultCacheSize)
+
 	if !opentracing.IsGlobalTracerRegistered() {
 		// we'd add threshold logging here
 		opentracing.SetGlobalTracer(opentracing.NoopTracer{})
@@ -125,17 +306,61 @@ func (c *Cluster) parseExtraConnStrOptions(spec gocbconnstr.ConnSpec) error {
 		c.ssb.n1qlTimeout = time.Duration(val) * time.Millisecond
 	}
 
+	if valStr, ok := fetchOption("management_timeout"); ok {
+		val, err := strconv.ParseInt(valStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("management_timeout option must be a number")
+		}
+		c.ssb.mgmtTimeout = time.Duration(val) * time.Millisecond
+	}
+
+	// The compression options are also parsed by gocbcore, which negotiates compression with the server and
+	// compresses the values which gocb cannot, see Collection.compressValue.
+	if valStr, ok := fetchOption("compression"); ok {
+		val, err := strconv.ParseBool(valStr)
+		if err != nil {
+			return fmt.Errorf("compression option must be a boolean")
+		}
+		c.sb.ValueCompression.enabled = val
+	}
+
+	if valStr, ok := fetchOption("compression_min_size"); ok {
+		val, err := strconv.ParseInt(valStr, 10, 64)
+		if err != nil {
+			return fmt.Errorf("compression_min_size option must be an int")
+		}
+		c.sb.ValueCompression.minSize = int(val)
+	}
+
+	if valStr, ok := fetchOption("compression_min_ratio"); ok {
+		val, err := strconv.ParseFloat(valStr, 64)
+		if err != nil {
+			return fmt.Errorf("compression_min_ratio option must be a number")
+		}
+		c.sb.ValueCompression.minRatio = val
+	}
+
 	return nil
 }
 
-// Bucket connects the cluster to server(s) and returns a new Bucket instance.
+// Bucket connects the cluster to server(s) and returns a new Bucket instance.  Buckets opened with the same
+// name and options share a single connection, which is closed once every Bucket using it has been closed.
 func (c *Cluster) Bucket(bucketName string, opts *BucketOptions) (*Bucket, error) {
 	if opts == nil {
 		opts = &BucketOptions{}
 	}
-	b := newBucket(&c.sb, bucketName, *opts)
+
+	// Take our reference before the bucket fetches its client so that the client cannot be closed in between.
+	cli := c.acquireClient(&clientStateBlock{
+		BucketName:        bucketName,
+		UseMutationTokens: opts.UseMutationTokens,
+	})
+
+	b := newBucket(c.sb, bucketName, *opts)
+	b.cluster = c
 	err := b.connect()
 	if err != nil {
+		c.releaseUnconnectedClient(cli)
 		return nil, err
 	}
 	return b, nil
@@ -150,17 +375,25 @@ func (c *Cluster) getClient(sb *clientStateBlock) client {
 		return cli
 	}
 
-	cli := newClient(c, sb)
+	cli := c.newClient(sb)
 	c.connections[hash] = cli
 
 	return cli
 }
 
+func (c *Cluster) newClient(sb *clientStateBlock) client {
+	if c.clientFactory != nil {
+		return c.clientFactory(sb)
+	}
+
+	return newClient(c, sb)
+}
+
 func (c *Cluster) randomClient() (client, error) {
 	c.connectionsLock.RLock()
 	if len(c.connections) == 0 {
 		c.connectionsLock.RUnlock()
-		return nil, nil // TODO: return an error
+		return nil, ErrNoOpenBuckets
 	}
 	var randomClient client
 	for _, c := range c.connections { // This is ugly
@@ -171,10 +404,80 @@ func (c *Cluster) randomClient() (client, error) {
 	return randomClient, nil
 }
 
+// bucketRecreated resets any cluster level state which may have been cached against a bucket
+// that has since been recreated.
+func (c *Cluster) bucketRecreated(bucketName string) {
+	// Prepared statements without a query context may refer to any bucket so they are dropped along with
+	// those prepared in the context of the bucket, they will be transparently re-prepared on next use.
+	c.clusterLock.Lock()
+	for key := range c.queryCache {
+		if key.queryContext == "" || queryContextBucket(key.queryContext) == bucketName {
+			delete(c.queryCache, key)
+		}
+	}
+	c.clusterLock.Unlock()
+
+	if c.onBucketRecreated != nil {
+		c.onBucketRecreated(bucketName)
+	}
+}
+
 func (c *Cluster) authenticator() Authenticator {
+	c.clusterLock.RLock()
+	defer c.clusterLock.RUnlock()
 	return c.auth
 }
 
+// Reauthenticate switches the cluster to authenticate using auth, for example when rotating passwords.  New
+// connections are made using auth for every open bucket and operations are moved onto them, the old
+// connections are closed once operations already sent on them have had time to complete.  If the first new
+// connection fails, such as because the credentials are rejected, the previous authenticator is restored and
+// the error returned.
+func (c *Cluster) Reauthenticate(auth Authenticator) error {
+	c.clusterLock.Lock()
+	oldAuth := c.auth
+	c.auth = auth
+	c.clusterLock.Unlock()
+
+	c.connectionsLock.RLock()
+	clients := make([]client, 0, len(c.connections))
+	for _, cli := range c.connections {
+		clients = append(clients, cli)
+	}
+	c.connectionsLock.RUnlock()
+
+	var overallErr error
+	for i, cli := range clients {
+		err := cli.reconnect()
+		if err == nil {
+			continue
+		}
+
+		if i == 0 {
+			c.clusterLock.Lock()
+			c.auth = oldAuth
+			c.clusterLock.Unlock()
+			return err
+		}
+
+		logWarnf("Failed to reconnect a client with new credentials: %s", err)
+		overallErr = err
+	}
+
+	return overallErr
+}
+
+// longestServiceTimeout returns the longest time that an operation may take before it times out.
+func (c *Cluster) longestServiceTimeout() time.Duration {
+	longest := c.sb.KvTimeout
+	for _, timeout := range []time.Duration{c.ssb.n1qlTimeout, c.ssb.searchTimeout, c.ssb.analyticsTimeout} {
+		if timeout > longest {
+			longest = timeout
+		}
+	}
+	return longest
+}
+
 func (c *Cluster) connSpec() gocbconnstr.ConnSpec {
 	return c.cSpec
 }
@@ -187,7 +490,7 @@ func (c *Cluster) Users() (*UserManager, error) {
 	}
 
 	return &UserManager{
-		httpClient: provider,
+		httpClient: c.newMgmtProvider(provider),
 	}, nil
 }
 
@@ -199,7 +502,7 @@ func (c *Cluster) Buckets() (*BucketManager, error) {
 	}
 
 	return &BucketManager{
-		httpClient: provider,
+		httpClient: c.newMgmtProvider(provider),
 	}, nil
 }
 
@@ -207,6 +510,7 @@ func (c *Cluster) Buckets() (*BucketManager, error) {
 func (c *Cluster) QueryIndexes() (*QueryIndexManager, error) {
 	return &QueryIndexManager{
 		ExecuteQuery: c.Query,
+		timeout:      c.ssb.mgmtTimeout,
 	}, nil
 }
 
@@ -218,7 +522,7 @@ func (c *Cluster) SearchIndexes() (*SearchIndexManager, error) {
 	}
 
 	return &SearchIndexManager{
-		httpClient: provider,
+		httpClient: c.newMgmtProvider(provider),
 	}, nil
 }
 
@@ -231,17 +535,19 @@ func (c *Cluster) Nodes() (*NodeManger, error) {
 func (c *Cluster) Close(opts *ClusterCloseOptions) error {
 	var overallErr error
 
-	c.clusterLock.Lock()
+	c.reprepare.stop()
+
+	c.connectionsLock.Lock()
 	for key, conn := range c.connections {
-		err := conn.close()
-		if err != nil && gocbcore.ErrorCause(err) != gocbcore.ErrShutdown {
+		err := closeClient(conn)
+		if err != nil {
 			logWarnf("Failed to close a client in cluster close: %s", err)
 			overallErr = err
 		}
 
-		delete(c.connections, key)
+		c.removeClientLocked(key)
 	}
-	c.clusterLock.Unlock()
+	c.connectionsLock.Unlock()
 
 	return overallErr
 }
@@ -65,10 +65,15 @@ type analyticsRows struct {
 	rows   []json.RawMessage
 }
 
-// AnalyticsResults allows access to the results of a Analytics query.
+// AnalyticsResults allows access to the results of a Analytics query.  The rows are read from the network as they
+// are needed, so the results must be read to the end or closed to release the connection.  Metadata, such as the
+// status and metrics, which the analytics service returns after the rows is only available once they have all
+// been read.
 type AnalyticsResults struct {
 	rows            *analyticsRows
+	stream          *queryResultStream
 	err             error
+	endpoint        string
 	requestID       string
 	clientContextID string
 	status          string
@@ -76,9 +81,11 @@ type AnalyticsResults struct {
 	signature       interface{}
 	metrics         AnalyticsResultMetrics
 	handle          AnalyticsDeferredResultHandle
+	watch           *consumerWatch
 }
 
-// NextBytes assigns the next result from the results into the value pointer, returning whether the read was successful.
+// Next assigns the next result from the results into the value pointer, returning whether the read was successful.
+// It always returns false once the results have been closed or an error has occurred.
 func (r *AnalyticsResults) Next(valuePtr interface{}) bool {
 	if r.err != nil {
 		return false
@@ -103,16 +110,41 @@ func (r *AnalyticsResults) NextBytes() []byte {
 		return nil
 	}
 
-	return r.rows.NextBytes()
+	var row []byte
+	if r.stream != nil {
+		if !r.rows.closed {
+			row = r.nextStreamedRow()
+		}
+		if row == nil {
+			r.rows.closed = true
+		}
+	} else {
+		row = r.rows.NextBytes()
+	}
+	if row == nil {
+		r.watch.done()
+	}
+	return row
 }
 
-// Close marks the results as closed, returning any errors that occurred during reading the results.
+// Close marks the results as closed, returning the first error that occurred during reading the results.
+// Any rows which have not been read are discarded, if there are too many to read quickly the metadata returned
+// after them is not available.  It is safe to call Close more than once.
 func (r *AnalyticsResults) Close() error {
 	r.rows.Close()
+	r.discardStream()
+	r.finishStream()
+	r.watch.done()
+	return r.err
+}
+
+// Err returns the first error that occurred during reading the results.
+func (r *AnalyticsResults) Err() error {
 	return r.err
 }
 
 // One assigns the first value from the results into the value pointer.
+// Any rows after the first are discarded without being decoded.
 func (r *AnalyticsResults) One(valuePtr interface{}) error {
 	if !r.Next(valuePtr) {
 		err := r.Close()
@@ -122,6 +154,13 @@ func (r *AnalyticsResults) One(valuePtr interface{}) error {
 		// return ErrNoResults TODO
 	}
 
+	// We only ever want the first row so release the remaining ones now.  A streamed response is aborted rather
+	// than having its remaining rows read.
+	r.rows.rows = nil
+	if r.stream != nil {
+		r.stream.abort()
+	}
+
 	// Ignore any errors occurring after we already have our result
 	err := r.Close()
 	if err != nil {
@@ -180,6 +219,10 @@ func (r *AnalyticsResults) Handle() AnalyticsDeferredResultHandle {
 
 // NextBytes returns the next result from the rows as a byte array.
 func (r *analyticsRows) NextBytes() []byte {
+	if r.closed {
+		return nil
+	}
+
 	if r.index+1 >= len(r.rows) {
 		r.closed = true
 		return nil
@@ -192,6 +235,7 @@ func (r *analyticsRows) NextBytes() []byte {
 // Close marks the rows as closed.
 func (r *analyticsRows) Close() {
 	r.closed = true
+	r.rows = nil
 }
 
 // AnalyticsQuery performs an analytics query and returns a list of rows or an error.
@@ -204,22 +248,29 @@ func (c *Cluster) AnalyticsQuery(statement string, opts *AnalyticsQueryOptions)
 		ctx = context.Background()
 	}
 
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
 	var span opentracing.Span
-	if opts.ParentSpanContext == nil {
+	if parentSpanCtx == nil {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteAnalyticsQuery",
 			opentracing.Tag{Key: "couchbase.service", Value: "cbas"})
 	} else {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteAnalyticsQuery",
-			opentracing.Tag{Key: "couchbase.service", Value: "cbas"}, opentracing.ChildOf(opts.ParentSpanContext))
+			opentracing.Tag{Key: "couchbase.service", Value: "cbas"}, opentracing.ChildOf(parentSpanCtx))
 	}
 	defer span.Finish()
 
-	provider, err := c.getHTTPProvider()
+	provider, err := c.getAnalyticsProvider()
 	if err != nil {
 		return nil, err
 	}
 
-	return c.analyticsQuery(ctx, span.Context(), statement, opts, provider)
+	res, err := c.analyticsQuery(ctx, span.Context(), statement, opts, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	res.watch = c.watchConsumer("analytics", res.clientContextID)
+	return res, nil
 }
 
 func (c *Cluster) analyticsQuery(ctx context.Context, traceCtx opentracing.SpanContext, statement string, opts *AnalyticsQueryOptions,
@@ -229,6 +280,11 @@ func (c *Cluster) analyticsQuery(ctx context.Context, traceCtx opentracing.SpanC
 	if err != nil {
 		return nil, errors.Wrap(err, "could not parse query options")
 	}
+	if _, ok := queryOpts["client_context_id"]; !ok {
+		if clientContextID := c.generatedID(); clientContextID != "" {
+			queryOpts["client_context_id"] = clientContextID
+		}
+	}
 
 	// Work out which timeout to use, the cluster level default or query specific one
 	timeout := c.analyticsTimeout()
@@ -246,23 +302,55 @@ func (c *Cluster) analyticsQuery(ctx context.Context, traceCtx opentracing.SpanC
 	queryOpts["timeout"] = timeout.String()
 
 	// Doing this will set the context deadline to whichever is shorter, what is already set or the timeout
-	// value TODO: should timeout be for the operation or per retry?
+	// value TODO: should timeout be for the operation or per retry?  Streamed results take over cancelling the
+	// context, and stopping the progress tracker, once they have been read.
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, timeout)
-	defer cancel()
+	streamed := false
+	defer func() {
+		if !streamed {
+			cancel()
+		}
+	}()
 
-	// TODO: clientcontextid?
+	progress := newQueryProgressTracker(opts.Progress, opts.ProgressInterval, cancel)
+	defer func() {
+		if !streamed {
+			progress.stop()
+		}
+	}()
+	provider = progress.wrapProvider(provider)
 
 	var retries uint
 	for {
 		retries++
 		var res *AnalyticsResults
-		res, err = c.executeAnalyticsQuery(ctx, traceCtx, queryOpts, provider)
+		res, err = c.executeAnalyticsQuery(ctx, traceCtx, queryOpts, provider, progress.row)
 		if err == nil {
+			if res.stream != nil {
+				streamed = true
+				res.stream.release = func() {
+					progress.stop()
+					cancel()
+				}
+				res.stream.mapErr = func(err error) error {
+					if abortErr := progress.err(); abortErr != nil {
+						return abortErr
+					}
+					if ctx.Err() == context.DeadlineExceeded {
+						return timeoutError{}
+					}
+					return err
+				}
+			}
 			return res, err
 		}
 
-		if !isRetryableError(err) || c.sb.AnalyticsRetryBehavior == nil || !c.sb.AnalyticsRetryBehavior.CanRetry(retries) {
+		if abortErr := progress.err(); abortErr != nil {
+			return nil, abortErr
+		}
+
+		if !IsRetryableError(err) || c.sb.AnalyticsRetryBehavior == nil || !c.sb.AnalyticsRetryBehavior.CanRetry(retries) {
 			return res, err
 		}
 
@@ -270,8 +358,10 @@ func (c *Cluster) analyticsQuery(ctx context.Context, traceCtx opentracing.SpanC
 	}
 }
 
+// executeAnalyticsQuery sends an analytics query and reads its response.  The rows of a successful response are
+// read from the body as they are iterated, see queryResultStream.  onRow, if not nil, is called as each row is read.
 func (c *Cluster) executeAnalyticsQuery(ctx context.Context, traceCtx opentracing.SpanContext, opts map[string]interface{},
-	provider httpProvider) (*AnalyticsResults, error) {
+	provider httpProvider, onRow func() error) (*AnalyticsResults, error) {
 
 	// priority is sent as a header not in the body
 	priority, priorityCastOK := opts["priority"].(int)
@@ -297,58 +387,92 @@ func (c *Cluster) executeAnalyticsQuery(ctx context.Context, traceCtx opentracin
 		req.Headers["Analytics-Priority"] = strconv.Itoa(priority)
 	}
 
+	clientContextID, _ := opts["client_context_id"].(string)
+	c.setAttributionHeaders(req, clientContextID)
+	c.compressHTTPRequest(req)
+
 	dtrace := opentracing.GlobalTracer().StartSpan("dispatch", opentracing.ChildOf(traceCtx))
 
 	resp, err := provider.DoHttpRequest(req)
 	if err != nil {
 		dtrace.Finish()
+		if svcErr := serviceUnavailableError("analytics", err); svcErr != nil {
+			return nil, svcErr
+		}
 		return nil, errors.Wrap(err, "could not complete query http request")
 	}
 
 	dtrace.Finish()
 
+	streaming := false
+	defer func() {
+		if !streaming {
+			drainAndCloseHTTPBody(resp.Body)
+		}
+	}()
+
+	if authErr := serviceAuthError("analytics", resp.StatusCode); authErr != nil {
+		return nil, authErr
+	}
+
 	strace := opentracing.GlobalTracer().StartSpan("streaming", opentracing.ChildOf(traceCtx))
 
-	analyticsResp := analyticsResponse{}
-	jsonDec := json.NewDecoder(resp.Body)
-	err = jsonDec.Decode(&analyticsResp)
+	rows, err := newRowStream(resp.Body, "results")
 	if err != nil {
 		strace.Finish()
-		if err == context.DeadlineExceeded {
-			return nil, timeoutError{}
-		} // TODO: test this...
-		return nil, errors.Wrap(err, "failed to decode query response body")
+		return nil, analyticsDecodeError(ctx, err)
 	}
 
-	err = resp.Body.Close()
-	if err != nil {
-		logDebugf("Failed to close socket (%s)", err)
+	// Rows are only streamed once the first has been read, so that errors which the analytics service returns
+	// before any results, and which the query can be retried after, are still returned from here.
+	var first json.RawMessage
+	if resp.StatusCode == 200 {
+		first, err = rows.nextRow()
+		if err != nil {
+			strace.Finish()
+			return nil, analyticsDecodeError(ctx, err)
+		}
 	}
 
-	strace.SetTag("couchbase.operation_id", analyticsResp.RequestID)
-	strace.Finish()
+	analyticsResp := analyticsResponse{}
+	if first != nil {
+		err = rows.decodeFields(&analyticsResp)
+		if err != nil {
+			strace.Finish()
+			return nil, analyticsDecodeError(ctx, err)
+		}
+		streaming = len(analyticsResp.Errors) == 0
+	}
 
-	elapsedTime, err := time.ParseDuration(analyticsResp.Metrics.ElapsedTime)
-	if err != nil {
-		logDebugf("Failed to parse elapsed time duration (%s)", err)
+	if !streaming {
+		var results []json.RawMessage
+		if first != nil {
+			results = append(results, first)
+			if onRow != nil {
+				err = onRow()
+			}
+		}
+		if err == nil {
+			results, err = readStreamRows(rows, results, onRow)
+		}
+		if err == nil {
+			analyticsResp = analyticsResponse{}
+			err = rows.decodeFields(&analyticsResp)
+		}
+		if err != nil {
+			strace.Finish()
+			return nil, analyticsDecodeError(ctx, err)
+		}
+		analyticsResp.Results = results
 	}
 
-	executionTime, err := time.ParseDuration(analyticsResp.Metrics.ExecutionTime)
-	if err != nil {
-		logDebugf("Failed to parse execution time duration (%s)", err)
+	strace.SetTag("couchbase.operation_id", analyticsResp.RequestID)
+	if !streaming {
+		strace.Finish()
 	}
 
 	if len(analyticsResp.Errors) > 0 {
-		errs := make([]AnalyticsQueryError, len(analyticsResp.Errors))
-		for i, e := range analyticsResp.Errors {
-			errs[i] = e
-		}
-		return nil, analyticsQueryMultiError{
-			errors:     errs,
-			endpoint:   resp.Endpoint,
-			httpStatus: resp.StatusCode,
-			contextID:  analyticsResp.ClientContextID,
-		}
+		return nil, newAnalyticsQueryMultiError(analyticsResp, resp.Endpoint, resp.StatusCode)
 	}
 
 	if resp.StatusCode != 200 {
@@ -357,9 +481,10 @@ func (c *Cluster) executeAnalyticsQuery(ctx context.Context, traceCtx opentracin
 		}
 	}
 
-	return &AnalyticsResults{
+	res := &AnalyticsResults{
 		requestID:       analyticsResp.RequestID,
 		clientContextID: analyticsResp.ClientContextID,
+		endpoint:        resp.Endpoint,
 		rows: &analyticsRows{
 			rows:  analyticsResp.Results,
 			index: -1,
@@ -367,17 +492,7 @@ func (c *Cluster) executeAnalyticsQuery(ctx context.Context, traceCtx opentracin
 		signature: analyticsResp.Signature,
 		status:    analyticsResp.Status,
 		warnings:  analyticsResp.Warnings,
-		metrics: AnalyticsResultMetrics{
-			ElapsedTime:      elapsedTime,
-			ExecutionTime:    executionTime,
-			ResultCount:      analyticsResp.Metrics.ResultCount,
-			ResultSize:       analyticsResp.Metrics.ResultSize,
-			MutationCount:    analyticsResp.Metrics.MutationCount,
-			SortCount:        analyticsResp.Metrics.SortCount,
-			ErrorCount:       analyticsResp.Metrics.ErrorCount,
-			WarningCount:     analyticsResp.Metrics.WarningCount,
-			ProcessedObjects: analyticsResp.Metrics.ProcessedObjects,
-		},
+		metrics:   analyticsResultMetrics(analyticsResp.Metrics),
 		handle: &analyticsDeferredResultHandle{
 			handleUri: analyticsResp.Handle,
 			rows: &analyticsRows{
@@ -386,5 +501,126 @@ func (c *Cluster) executeAnalyticsQuery(ctx context.Context, traceCtx opentracin
 			status:   analyticsResp.Status,
 			provider: provider,
 		},
-	}, nil
+	}
+	if streaming {
+		res.stream = &queryResultStream{
+			rows:    rows,
+			body:    resp.Body,
+			ctx:     ctx,
+			span:    strace,
+			pending: first,
+			onRow:   onRow,
+		}
+	}
+
+	return res, nil
+}
+
+// analyticsDecodeError returns the error to report for err, which occurred whilst reading an analytics response.
+func analyticsDecodeError(ctx context.Context, err error) error {
+	if err == context.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
+		return timeoutError{}
+	}
+	return errors.Wrap(err, "failed to decode query response body")
+}
+
+// newAnalyticsQueryMultiError returns the error for the errors in an analytics response.
+func newAnalyticsQueryMultiError(analyticsResp analyticsResponse, endpoint string, httpStatus int) analyticsQueryMultiError {
+	errs := make([]AnalyticsQueryError, len(analyticsResp.Errors))
+	for i, e := range analyticsResp.Errors {
+		errs[i] = e
+	}
+	return analyticsQueryMultiError{
+		errors:     errs,
+		endpoint:   endpoint,
+		httpStatus: httpStatus,
+		contextID:  analyticsResp.ClientContextID,
+	}
+}
+
+// analyticsResultMetrics converts the metrics returned by the analytics service.
+func analyticsResultMetrics(metrics analyticsResponseMetrics) AnalyticsResultMetrics {
+	elapsedTime, err := parseServerDuration(metrics.ElapsedTime)
+	if err != nil {
+		logDebugf("Failed to parse elapsed time duration (%s)", err)
+	}
+
+	executionTime, err := parseServerDuration(metrics.ExecutionTime)
+	if err != nil {
+		logDebugf("Failed to parse execution time duration (%s)", err)
+	}
+
+	return AnalyticsResultMetrics{
+		ElapsedTime:      elapsedTime,
+		ExecutionTime:    executionTime,
+		ResultCount:      metrics.ResultCount,
+		ResultSize:       metrics.ResultSize,
+		MutationCount:    metrics.MutationCount,
+		SortCount:        metrics.SortCount,
+		ErrorCount:       metrics.ErrorCount,
+		WarningCount:     metrics.WarningCount,
+		ProcessedObjects: metrics.ProcessedObjects,
+	}
+}
+
+// nextStreamedRow returns the next row read from the response body, or nil once all rows have been read or an
+// error occurred, in which case the error is set on the results.
+func (r *AnalyticsResults) nextStreamedRow() []byte {
+	row, err := r.stream.next()
+	if err != nil {
+		r.err = err
+		r.finishStream()
+		return nil
+	}
+
+	if row == nil {
+		r.completeStream()
+		r.finishStream()
+		return nil
+	}
+
+	return row
+}
+
+// completeStream sets the metadata and any errors from the fields which follow the rows in the response.
+func (r *AnalyticsResults) completeStream() {
+	var analyticsResp analyticsResponse
+	err := r.stream.rows.decodeFields(&analyticsResp)
+	if err != nil {
+		r.err = errors.Wrap(err, "failed to decode query response body")
+		return
+	}
+
+	r.status = analyticsResp.Status
+	r.warnings = analyticsResp.Warnings
+	r.metrics = analyticsResultMetrics(analyticsResp.Metrics)
+
+	if len(analyticsResp.Errors) > 0 {
+		r.err = newAnalyticsQueryMultiError(analyticsResp, r.endpoint, 200)
+	}
+}
+
+// discardStream reads the rows which have not been read so that the metadata which follows them is available,
+// unless more than maxHTTPBodyDrainBytes of rows remain.
+func (r *AnalyticsResults) discardStream() {
+	s := r.stream
+	if s == nil || s.finished || r.err != nil {
+		return
+	}
+
+	complete, err := s.discard()
+	if err != nil {
+		r.err = err
+		return
+	}
+	if complete {
+		r.completeStream()
+	}
+}
+
+// finishStream closes the response body and releases the request.  It is safe to call more than once.
+func (r *AnalyticsResults) finishStream() {
+	if r.stream != nil {
+		r.stream.finish()
+	}
 }
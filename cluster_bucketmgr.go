@@ -1,10 +1,12 @@
 package gocb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/url"
+	"time"
 
 	"gopkg.in/couchbase/gocbcore.v7"
 )
@@ -15,6 +17,21 @@ type BucketManager struct {
 	httpClient httpProvider
 }
 
+// WithContext returns a copy of the manager whose operations are cancelled once ctx is done.
+func (bm *BucketManager) WithContext(ctx context.Context) *BucketManager {
+	newM := *bm
+	newM.httpClient = asMgmtProvider(bm.httpClient).withContext(ctx)
+	return &newM
+}
+
+// WithTimeout returns a copy of the manager whose operations time out after timeout, rather than after
+// ClusterOptions.ManagementTimeout.  Requests which are safe to repeat are retried within the timeout.
+func (bm *BucketManager) WithTimeout(timeout time.Duration) *BucketManager {
+	newM := *bm
+	newM.httpClient = asMgmtProvider(bm.httpClient).withTimeout(timeout)
+	return &newM
+}
+
 // BucketType specifies the kind of bucket
 type BucketType int
 
@@ -82,6 +99,9 @@ func bucketDataInToSettings(bucketData *bucketDataIn) *BucketSettings {
 
 // GetBuckets returns a list of all active buckets on the cluster.
 func (bm *BucketManager) GetBuckets() ([]*BucketSettings, error) {
+	span := startManagerTrace("buckets", "get_all_buckets", "mgmt")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(MgmtService),
 		Path:    "/pools/default/buckets",
@@ -122,6 +142,13 @@ func (bm *BucketManager) GetBuckets() ([]*BucketSettings, error) {
 
 // InsertBucket creates a new bucket on the cluster.
 func (bm *BucketManager) InsertBucket(settings *BucketSettings) error {
+	span := startManagerTrace("buckets", "create_bucket", "mgmt")
+	defer span.Finish()
+
+	return bm.upsertBucket(settings)
+}
+
+func (bm *BucketManager) upsertBucket(settings *BucketSettings) error {
 	posts := url.Values{}
 	posts.Add("name", settings.Name)
 	if settings.Type == Couchbase {
@@ -175,12 +202,18 @@ func (bm *BucketManager) InsertBucket(settings *BucketSettings) error {
 
 // UpdateBucket will update the settings for a specific bucket on the cluster.
 func (bm *BucketManager) UpdateBucket(settings *BucketSettings) error {
+	span := startManagerTrace("buckets", "update_bucket", "mgmt")
+	defer span.Finish()
+
 	// Cluster-side, updates are the same as creates.
-	return bm.InsertBucket(settings)
+	return bm.upsertBucket(settings)
 }
 
 // RemoveBucket will delete a bucket from the cluster by name.
 func (bm *BucketManager) RemoveBucket(name string) error {
+	span := startManagerTrace("buckets", "drop_bucket", "mgmt")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(MgmtService),
 		Path:    fmt.Sprintf("/pools/default/buckets/%s", name),
@@ -210,6 +243,9 @@ func (bm *BucketManager) RemoveBucket(name string) error {
 // Flush will delete all the of the data from a bucket.
 // Keep in mind that you must have flushing enabled in the buckets configuration.
 func (bm *BucketManager) Flush(name string) error {
+	span := startManagerTrace("buckets", "flush_bucket", "mgmt")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(MgmtService),
 		Path:    fmt.Sprintf("/pools/default/buckets/%s/controller/doFlush", name),
@@ -0,0 +1,122 @@
+package gocb
+
+import (
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// acquireClient fetches, or creates, the client for sb and takes a reference to it.  A client with outstanding
+// references is never closed other than by Cluster.Close.
+func (c *Cluster) acquireClient(sb *clientStateBlock) client {
+	c.connectionsLock.Lock()
+	defer c.connectionsLock.Unlock()
+
+	hash := sb.Hash()
+	cli, ok := c.connections[hash]
+	if !ok {
+		cli = c.newClient(sb)
+		c.connections[hash] = cli
+	}
+
+	if c.connectionRefs == nil {
+		c.connectionRefs = make(map[string]int)
+	}
+	c.connectionRefs[hash]++
+
+	if timer, ok := c.idleTimers[hash]; ok {
+		timer.Stop()
+		delete(c.idleTimers, hash)
+	}
+
+	return cli
+}
+
+// releaseClient drops a reference to cli.  Once no references remain the client is closed, either immediately or
+// after the cluster's connection idle timeout if it is not acquired again in the meantime.
+func (c *Cluster) releaseClient(cli client) error {
+	hash := cli.Hash()
+
+	c.connectionsLock.Lock()
+	if c.connections[hash] != cli || c.connectionRefs[hash] <= 0 {
+		c.connectionsLock.Unlock()
+		return nil
+	}
+
+	c.connectionRefs[hash]--
+	if c.connectionRefs[hash] > 0 {
+		c.connectionsLock.Unlock()
+		return nil
+	}
+
+	if c.connectionIdleTimeout > 0 {
+		if c.idleTimers == nil {
+			c.idleTimers = make(map[string]*time.Timer)
+		}
+		c.idleTimers[hash] = time.AfterFunc(c.connectionIdleTimeout, func() {
+			err := c.closeIdleClient(cli)
+			if err != nil {
+				logWarnf("Failed to close idle client: %s", err)
+			}
+		})
+		c.connectionsLock.Unlock()
+		return nil
+	}
+
+	c.removeClientLocked(hash)
+	c.connectionsLock.Unlock()
+
+	return closeClient(cli)
+}
+
+// releaseUnconnectedClient drops the reference taken on cli for a Bucket which failed to connect.  The client can
+// only be left without references if it never connected, so it is then removed without being closed as there is
+// no connection to close.
+func (c *Cluster) releaseUnconnectedClient(cli client) {
+	hash := cli.Hash()
+
+	c.connectionsLock.Lock()
+	defer c.connectionsLock.Unlock()
+
+	if c.connections[hash] != cli || c.connectionRefs[hash] <= 0 {
+		return
+	}
+
+	c.connectionRefs[hash]--
+	if c.connectionRefs[hash] == 0 {
+		c.removeClientLocked(hash)
+	}
+}
+
+func (c *Cluster) closeIdleClient(cli client) error {
+	hash := cli.Hash()
+
+	c.connectionsLock.Lock()
+	if c.connections[hash] != cli || c.connectionRefs[hash] > 0 {
+		// The client has been acquired again, or replaced, since it became idle.
+		c.connectionsLock.Unlock()
+		return nil
+	}
+	c.removeClientLocked(hash)
+	c.connectionsLock.Unlock()
+
+	return closeClient(cli)
+}
+
+func (c *Cluster) removeClientLocked(hash string) {
+	delete(c.connections, hash)
+	delete(c.connectionRefs, hash)
+	if timer, ok := c.idleTimers[hash]; ok {
+		timer.Stop()
+		delete(c.idleTimers, hash)
+	}
+}
+
+func closeClient(cli client) error {
+	err := cli.close()
+	if err != nil && gocbcore.ErrorCause(err) != gocbcore.ErrShutdown {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package gocb
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testGetClusterForConnections(cli *mockClient, idleTimeout time.Duration) *Cluster {
+	c := &Cluster{
+		connections: map[string]client{
+			cli.Hash(): cli,
+		},
+		connectionIdleTimeout: idleTimeout,
+	}
+	c.sb.client = c.getClient
+
+	return c
+}
+
+func TestBucketsShareReferenceCountedClient(t *testing.T) {
+	cli := &mockClient{bucketName: "mock"}
+	c := testGetClusterForConnections(cli, 0)
+
+	b1, err := c.Bucket("mock", nil)
+	if err != nil {
+		t.Fatalf("Expected bucket to open but was %v", err)
+	}
+	b2, err := c.Bucket("mock", nil)
+	if err != nil {
+		t.Fatalf("Expected bucket to open but was %v", err)
+	}
+
+	if b1.sb.getCachedClient() != b2.sb.getCachedClient() {
+		t.Fatalf("Expected buckets to share a client")
+	}
+
+	err = b1.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected close to succeed but was %v", err)
+	}
+	// Closing the same bucket twice must not release the other bucket's reference.
+	err = b1.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected close to succeed but was %v", err)
+	}
+
+	if atomic.LoadUint32(&cli.closeCount) != 0 {
+		t.Fatalf("Expected client to remain open whilst referenced")
+	}
+
+	err = b2.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected close to succeed but was %v", err)
+	}
+
+	if atomic.LoadUint32(&cli.closeCount) != 1 {
+		t.Fatalf("Expected client to be closed once but was closed %d times", atomic.LoadUint32(&cli.closeCount))
+	}
+	if len(c.connections) != 0 {
+		t.Fatalf("Expected client to be removed from the cluster")
+	}
+}
+
+func TestBucketConnectFailureReleasesClient(t *testing.T) {
+	cli := &mockClient{bucketName: "mock", connectErr: errors.New("connect failed")}
+	c := testGetClusterForConnections(cli, 0)
+
+	_, err := c.Bucket("mock", nil)
+	if err != cli.connectErr {
+		t.Fatalf("Expected connect error but was %v", err)
+	}
+
+	// The client never connected, so there is nothing to close.
+	if atomic.LoadUint32(&cli.closeCount) != 0 {
+		t.Fatalf("Expected unconnected client not to be closed but was closed %d times",
+			atomic.LoadUint32(&cli.closeCount))
+	}
+	if len(c.connections) != 0 || len(c.connectionRefs) != 0 {
+		t.Fatalf("Expected client to be removed from the cluster")
+	}
+}
+
+func TestBucketClientIdleClose(t *testing.T) {
+	cli := &mockClient{bucketName: "mock"}
+	c := testGetClusterForConnections(cli, 20*time.Millisecond)
+
+	b, err := c.Bucket("mock", nil)
+	if err != nil {
+		t.Fatalf("Expected bucket to open but was %v", err)
+	}
+
+	err = b.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected close to succeed but was %v", err)
+	}
+
+	// Reopening within the idle timeout reuses the client.
+	b, err = c.Bucket("mock", nil)
+	if err != nil {
+		t.Fatalf("Expected bucket to open but was %v", err)
+	}
+	if b.sb.getCachedClient() != client(cli) {
+		t.Fatalf("Expected idle client to be reused")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadUint32(&cli.closeCount) != 0 {
+		t.Fatalf("Expected reacquired client not to be closed")
+	}
+
+	err = b.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected close to succeed but was %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadUint32(&cli.closeCount) != 1 {
+		t.Fatalf("Expected idle client to be closed once but was closed %d times", atomic.LoadUint32(&cli.closeCount))
+	}
+
+	c.connectionsLock.RLock()
+	numConnections := len(c.connections)
+	c.connectionsLock.RUnlock()
+	if numConnections != 0 {
+		t.Fatalf("Expected idle client to be removed from the cluster")
+	}
+}
+
+func TestClusterReauthenticate(t *testing.T) {
+	cli := &mockClient{bucketName: "mock"}
+	c := testGetClusterForConnections(cli, 0)
+	oldAuth := PasswordAuthenticator{Username: "user", Password: "old"}
+	c.auth = oldAuth
+
+	newAuth := PasswordAuthenticator{Username: "user", Password: "new"}
+	err := c.Reauthenticate(newAuth)
+	if err != nil {
+		t.Fatalf("Expected reauthenticate to succeed but was %v", err)
+	}
+	if c.authenticator() != newAuth {
+		t.Fatalf("Expected new authenticator to be used")
+	}
+	if atomic.LoadUint32(&cli.reconnectCount) != 1 {
+		t.Fatalf("Expected client to reconnect once but was %d", cli.reconnectCount)
+	}
+
+	cli.reconnectErr = ErrAuthenticationFailure
+	err = c.Reauthenticate(PasswordAuthenticator{Username: "user", Password: "wrong"})
+	if err != ErrAuthenticationFailure {
+		t.Fatalf("Expected reauthenticate to fail but was %v", err)
+	}
+	if c.authenticator() != newAuth {
+		t.Fatalf("Expected previous authenticator to be restored after a failure")
+	}
+}
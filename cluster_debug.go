@@ -0,0 +1,413 @@
+package gocb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+	"gopkg.in/couchbaselabs/gocbconnstr.v1"
+)
+
+const redactedValue = "<redacted>"
+
+// sensitiveConnStrOptions contains fragments of connection string option names whose values
+// must never be written out by DebugDump.
+var sensitiveConnStrOptions = []string{"pass", "secret", "token", "key"}
+
+type debugDumpRetryBehavior struct {
+	Type       string `json:"type"`
+	MaxRetries uint   `json:"max_retries,omitempty"`
+	RetryDelay uint   `json:"retry_delay_ms,omitempty"`
+	DelayLimit string `json:"delay_limit,omitempty"`
+}
+
+type debugDumpQueryCacheKey struct {
+	// StatementHash identifies the statement without revealing any literal values which it contains.
+	StatementHash string `json:"statement_sha256"`
+	QueryContext  string `json:"query_context,omitempty"`
+	User          string `json:"user,omitempty"`
+}
+
+type debugDumpConnection struct {
+	ID string `json:"id"`
+	// HelloFeatures are the features negotiated by the KV connections, when the agent reports them.
+	HelloFeatures []string `json:"hello_features,omitempty"`
+}
+
+type debugDumpCompression struct {
+	Enabled  bool    `json:"enabled"`
+	MinSize  int     `json:"min_size"`
+	MinRatio float64 `json:"min_ratio"`
+}
+
+type debugDumpServiceHTTPConfig struct {
+	MaxIdleConns        int    `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int    `json:"max_idle_conns_per_host,omitempty"`
+	IdleConnTimeout     string `json:"idle_conn_timeout,omitempty"`
+	RequestTimeout      string `json:"request_timeout,omitempty"`
+	TLSConfigSet        bool   `json:"tls_config_set"`
+}
+
+type debugDumpCircuitBreaker struct {
+	Enabled          bool   `json:"enabled"`
+	FailureThreshold uint   `json:"failure_threshold,omitempty"`
+	SleepWindow      string `json:"sleep_window,omitempty"`
+}
+
+// debugDumpClusterOptions holds the ClusterOptions which are not reported elsewhere in the dump.  Callbacks and
+// pluggable implementations are reported by whether they are set, or by their type.
+type debugDumpClusterOptions struct {
+	ApplicationName               string                                `json:"application_name,omitempty"`
+	ConnectionIdleTimeout         string                                `json:"connection_idle_timeout"`
+	KvHeartbeatInterval           string                                `json:"kv_heartbeat_interval"`
+	KvHeartbeatTimeout            string                                `json:"kv_heartbeat_timeout"`
+	KvDeadConnectionFailures      uint                                  `json:"kv_dead_connection_failures"`
+	OnBucketRecreatedSet          bool                                  `json:"on_bucket_recreated_set"`
+	OnDeadConnectionSet           bool                                  `json:"on_dead_connection_set"`
+	OverloadBehavior              string                                `json:"overload_behavior"`
+	OverloadMaxWait               string                                `json:"overload_max_wait"`
+	HTTPRequestCompression        bool                                  `json:"http_request_compression"`
+	HTTPRequestCompressionMinSize int                                   `json:"http_request_compression_min_size"`
+	SlowConsumerThreshold         string                                `json:"slow_consumer_threshold"`
+	IDGenerator                   string                                `json:"id_generator"`
+	PreparedNamePrefix            string                                `json:"prepared_name_prefix,omitempty"`
+	CircuitBreaker                debugDumpCircuitBreaker               `json:"circuit_breaker"`
+	InsecureSkipVerify            bool                                  `json:"insecure_skip_verify"`
+	QueryResultCacheSize          int                                   `json:"query_result_cache_size"`
+	ServiceHTTPConfigs            map[string]debugDumpServiceHTTPConfig `json:"service_http_configs,omitempty"`
+}
+
+type debugDump struct {
+	ConnectionString string              `json:"connection_string"`
+	Endpoints        []string            `json:"endpoints"`
+	Options          map[string][]string `json:"options,omitempty"`
+	Authenticator    string              `json:"authenticator"`
+
+	Timeouts map[string]string `json:"timeouts"`
+
+	RetryBehaviors map[string]debugDumpRetryBehavior `json:"retry_behaviors"`
+
+	HTTPMaxIdleConns        int    `json:"http_max_idle_conns,omitempty"`
+	HTTPMaxIdleConnsPerHost int    `json:"http_max_idle_conns_per_host,omitempty"`
+	HTTPIdleConnTimeout     string `json:"http_idle_conn_timeout,omitempty"`
+
+	Compression    debugDumpCompression    `json:"compression"`
+	ClusterOptions debugDumpClusterOptions `json:"cluster_options"`
+
+	Connections        []debugDumpConnection    `json:"connections"`
+	QueryCacheSize     int                      `json:"query_cache_size"`
+	QueryCacheKeys     []debugDumpQueryCacheKey `json:"query_cache_keys,omitempty"`
+	MetricsRecorderSet bool                     `json:"metrics_recorder_set"`
+}
+
+// DebugDump writes a snapshot of the effective configuration of the cluster to w, suitable for
+// attaching to support tickets.  Credentials and other sensitive connection string options are redacted, and
+// the statements of cached prepared queries are replaced by their hashes.
+// VOLATILE: The format of the output may change at any time.
+func (c *Cluster) DebugDump(w io.Writer) error {
+	dump := debugDump{
+		ConnectionString: redactedConnStr(c.cSpec),
+		Endpoints:        make([]string, 0, len(c.cSpec.Addresses)),
+		Options:          redactedConnStrOptions(c.cSpec.Options),
+		Authenticator:    "none",
+		Timeouts: map[string]string{
+			"n1ql":       c.ssb.n1qlTimeout.String(),
+			"analytics":  c.ssb.analyticsTimeout.String(),
+			"search":     c.ssb.searchTimeout.String(),
+			"management": c.ssb.mgmtTimeout.String(),
+			"kv":         c.sb.KvTimeout.String(),
+			"durability": c.sb.DuraTimeout.String(),
+			"connect":    c.ssb.connectTimeout.String(),
+			"kv_connect": c.ssb.kvConnectTimeout.String(),
+		},
+		RetryBehaviors: map[string]debugDumpRetryBehavior{
+			"n1ql":      debugDumpRetry(c.sb.N1qlRetryBehavior),
+			"analytics": debugDumpRetry(c.sb.AnalyticsRetryBehavior),
+			"search":    debugDumpRetry(c.sb.SearchRetryBehavior),
+		},
+		HTTPMaxIdleConns:        c.ssb.httpMaxIdleConns,
+		HTTPMaxIdleConnsPerHost: c.ssb.httpMaxIdleConnsPerHost,
+		Compression:             debugDumpValueCompression(c.sb.ValueCompression),
+		ClusterOptions:          c.debugDumpClusterOptions(),
+		MetricsRecorderSet:      c.sb.MetricsRecorder != nil,
+	}
+
+	for _, address := range c.cSpec.Addresses {
+		dump.Endpoints = append(dump.Endpoints, connStrAddress(address.Host, address.Port))
+	}
+
+	if auth := c.authenticator(); auth != nil {
+		dump.Authenticator = fmt.Sprintf("%T", auth)
+	}
+
+	if c.ssb.httpIdleConnTimeout > 0 {
+		dump.HTTPIdleConnTimeout = c.ssb.httpIdleConnTimeout.String()
+	}
+
+	c.connectionsLock.RLock()
+	dump.Connections = make([]debugDumpConnection, 0, len(c.connections))
+	for hash, cli := range c.connections {
+		dump.Connections = append(dump.Connections, debugDumpConnection{
+			ID:            hash,
+			HelloFeatures: debugDumpHelloFeatures(cli),
+		})
+	}
+	c.connectionsLock.RUnlock()
+	sort.Slice(dump.Connections, func(i, j int) bool {
+		return dump.Connections[i].ID < dump.Connections[j].ID
+	})
+
+	c.clusterLock.RLock()
+	dump.QueryCacheSize = len(c.queryCache)
+	for key := range c.queryCache {
+		statementHash := sha256.Sum256([]byte(key.statement))
+		dumpedKey := debugDumpQueryCacheKey{
+			StatementHash: hex.EncodeToString(statementHash[:]),
+			QueryContext:  key.queryContext,
+		}
+		// User names are treated like credentials, only whether the statement was prepared for a user is shown.
+		if key.user != "" {
+			dumpedKey.User = redactedValue
+		}
+		dump.QueryCacheKeys = append(dump.QueryCacheKeys, dumpedKey)
+	}
+	c.clusterLock.RUnlock()
+	sort.Slice(dump.QueryCacheKeys, func(i, j int) bool {
+		a, b := dump.QueryCacheKeys[i], dump.QueryCacheKeys[j]
+		if a.StatementHash != b.StatementHash {
+			return a.StatementHash < b.StatementHash
+		}
+		if a.QueryContext != b.QueryContext {
+			return a.QueryContext < b.QueryContext
+		}
+		return a.User < b.User
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(dump)
+}
+
+func (c *Cluster) debugDumpClusterOptions() debugDumpClusterOptions {
+	overloadBehavior := "fail_fast"
+	if c.ssb.overloadBehavior == OverloadWait {
+		overloadBehavior = "wait"
+	}
+
+	idGenerator := "none"
+	if c.ssb.idGenerator != nil {
+		idGenerator = fmt.Sprintf("%T", c.ssb.idGenerator)
+	}
+
+	options := debugDumpClusterOptions{
+		ApplicationName:               c.ssb.applicationName,
+		ConnectionIdleTimeout:         c.connectionIdleTimeout.String(),
+		KvHeartbeatInterval:           c.ssb.kvHeartbeatInterval.String(),
+		KvHeartbeatTimeout:            c.ssb.kvHeartbeatTimeout.String(),
+		KvDeadConnectionFailures:      c.ssb.kvDeadConnectionFailures,
+		OnBucketRecreatedSet:          c.onBucketRecreated != nil,
+		OnDeadConnectionSet:           c.onDeadConnection != nil,
+		OverloadBehavior:              overloadBehavior,
+		OverloadMaxWait:               c.ssb.overloadMaxWait.String(),
+		HTTPRequestCompression:        c.ssb.httpRequestCompression,
+		HTTPRequestCompressionMinSize: c.ssb.httpRequestCompressionMinSize,
+		SlowConsumerThreshold:         c.ssb.slowConsumerThreshold.String(),
+		IDGenerator:                   idGenerator,
+		PreparedNamePrefix:            c.ssb.preparedNamePrefix,
+		InsecureSkipVerify:            c.ssb.insecureSkipVerify,
+	}
+
+	if c.breakers != nil {
+		options.CircuitBreaker = debugDumpCircuitBreaker{
+			Enabled:          true,
+			FailureThreshold: c.breakers.failureThreshold,
+			SleepWindow:      c.breakers.sleepWindow.String(),
+		}
+	}
+
+	if c.queryResults != nil {
+		options.QueryResultCacheSize = c.queryResults.capacity
+	}
+
+	if len(c.serviceHTTPConfigs) > 0 {
+		options.ServiceHTTPConfigs = make(map[string]debugDumpServiceHTTPConfig, len(c.serviceHTTPConfigs))
+		for service, config := range c.serviceHTTPConfigs {
+			dumped := debugDumpServiceHTTPConfig{
+				MaxIdleConns:        config.MaxIdleConns,
+				MaxIdleConnsPerHost: config.MaxIdleConnsPerHost,
+				TLSConfigSet:        config.TLSConfig != nil,
+			}
+			if config.IdleConnTimeout > 0 {
+				dumped.IdleConnTimeout = config.IdleConnTimeout.String()
+			}
+			if config.RequestTimeout > 0 {
+				dumped.RequestTimeout = config.RequestTimeout.String()
+			}
+			options.ServiceHTTPConfigs[diagServiceString(service)] = dumped
+		}
+	}
+
+	return options
+}
+
+func debugDumpValueCompression(compression valueCompression) debugDumpCompression {
+	dumped := debugDumpCompression{
+		Enabled:  compression.enabled,
+		MinSize:  compression.minSize,
+		MinRatio: compression.minRatio,
+	}
+	if dumped.MinSize <= 0 {
+		dumped.MinSize = defaultCompressionMinSize
+	}
+	if dumped.MinRatio <= 0 {
+		dumped.MinRatio = defaultCompressionMinRatio
+	}
+
+	return dumped
+}
+
+// debugDumpHelloFeatureNames names the HELLO features which may be negotiated by KV connections.
+var debugDumpHelloFeatureNames = []struct {
+	feature gocbcore.HelloFeature
+	name    string
+}{
+	{gocbcore.FeatureDatatype, "datatype"},
+	{gocbcore.FeatureTls, "tls"},
+	{gocbcore.FeatureTcpNoDelay, "tcp_nodelay"},
+	{gocbcore.FeatureSeqNo, "seqno"},
+	{gocbcore.FeatureTcpDelay, "tcp_delay"},
+	{gocbcore.FeatureXattr, "xattr"},
+	{gocbcore.FeatureXerror, "xerror"},
+	{gocbcore.FeatureSelectBucket, "select_bucket"},
+	{gocbcore.FeatureCollections, "collections"},
+	{gocbcore.FeatureSnappy, "snappy"},
+	{gocbcore.FeatureJson, "json"},
+	{gocbcore.FeatureDuplex, "duplex"},
+	{gocbcore.FeatureClusterMapNotif, "cluster_map_notif"},
+	{gocbcore.FeatureUnorderedExec, "unordered_exec"},
+	{gocbcore.FeatureDurations, "durations"},
+}
+
+// debugDumpHelloFeatures returns the names of the HELLO features negotiated by the KV connections of cli, or nil
+// if they cannot be reported, such as when it has not connected.
+func debugDumpHelloFeatures(cli client) []string {
+	std, ok := cli.(*stdClient)
+	if !ok {
+		return nil
+	}
+
+	agent := std.currentAgent()
+	if agent == nil {
+		return nil
+	}
+
+	p := featureProvider(agent)
+	if p == nil {
+		return nil
+	}
+
+	features := []string{}
+	for _, feature := range debugDumpHelloFeatureNames {
+		if p.SupportsFeature(feature.feature) {
+			features = append(features, feature.name)
+		}
+	}
+
+	return features
+}
+
+func debugDumpRetry(behavior RetryBehavior) debugDumpRetryBehavior {
+	if behavior == nil {
+		return debugDumpRetryBehavior{Type: "none"}
+	}
+
+	dumped := debugDumpRetryBehavior{
+		Type: fmt.Sprintf("%T", behavior),
+	}
+	if delayBehavior, ok := behavior.(*DelayRetryBehavior); ok {
+		dumped.MaxRetries = delayBehavior.maxRetries
+		dumped.RetryDelay = delayBehavior.retryDelay
+		dumped.DelayLimit = delayBehavior.delayLimit.String()
+	}
+
+	return dumped
+}
+
+func isSensitiveConnStrOption(name string) bool {
+	name = strings.ToLower(name)
+	for _, fragment := range sensitiveConnStrOptions {
+		if strings.Contains(name, fragment) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func redactedConnStrOptions(options map[string][]string) map[string][]string {
+	if len(options) == 0 {
+		return nil
+	}
+
+	redacted := make(map[string][]string, len(options))
+	for name, values := range options {
+		if isSensitiveConnStrOption(name) {
+			redacted[name] = []string{redactedValue}
+			continue
+		}
+		redacted[name] = values
+	}
+
+	return redacted
+}
+
+func connStrAddress(host string, port int) string {
+	if port < 0 {
+		return host
+	}
+
+	return host + ":" + strconv.Itoa(port)
+}
+
+func redactedConnStr(spec gocbconnstr.ConnSpec) string {
+	var connStr string
+	if spec.Scheme != "" {
+		connStr = spec.Scheme + "://"
+	}
+
+	for i, address := range spec.Addresses {
+		if i > 0 {
+			connStr += ","
+		}
+		connStr += connStrAddress(address.Host, address.Port)
+	}
+
+	if spec.Bucket != "" {
+		connStr += "/" + spec.Bucket
+	}
+
+	redacted := redactedConnStrOptions(spec.Options)
+	if len(redacted) > 0 {
+		names := make([]string, 0, len(redacted))
+		for name := range redacted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var params []string
+		for _, name := range names {
+			for _, value := range redacted[name] {
+				params = append(params, name+"="+value)
+			}
+		}
+		connStr += "?" + strings.Join(params, "&")
+	}
+
+	return connStr
+}
@@ -0,0 +1,96 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClusterDebugDump(t *testing.T) {
+	connStr := "couchbases://10.112.0.1,10.112.0.2:11207?n1ql_timeout=1000&http_password=secret&compression=true"
+	cluster, err := NewCluster(connStr, ClusterOptions{
+		Authenticator:       PasswordAuthenticator{Username: "Administrator", Password: "password"},
+		HTTPIdleConnTimeout: 2 * time.Second,
+		ApplicationName:     "support",
+		KvTimeout:           2500 * time.Millisecond,
+		ManagementTimeout:   75 * time.Second,
+		OnDeadConnection:    func(string) {},
+		ServiceHTTPConfigs: map[ServiceType]ServiceHTTPConfig{
+			FtsService: {RequestTimeout: 5 * time.Second},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create cluster: %v", err)
+	}
+
+	cluster.queryCache[n1qlCacheKey{statement: "SELECT 1", queryContext: "default:`b`", user: "Administrator"}] =
+		&n1qlCache{name: "p1"}
+
+	var buf bytes.Buffer
+	err = cluster.DebugDump(&buf)
+	if err != nil {
+		t.Fatalf("DebugDump failed: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "Administrator") ||
+		strings.Contains(buf.String(), "\"password\"") {
+		t.Fatalf("Expected credentials to be redacted but was %s", buf.String())
+	}
+
+	var dump debugDump
+	err = json.Unmarshal(buf.Bytes(), &dump)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal dump: %v", err)
+	}
+
+	expectedConnStr := "couchbases://10.112.0.1,10.112.0.2:11207?" +
+		"compression=true&http_password=<redacted>&n1ql_timeout=1000"
+	if dump.ConnectionString != expectedConnStr {
+		t.Fatalf("Expected connection string to be %s but was %s", expectedConnStr, dump.ConnectionString)
+	}
+
+	if len(dump.Endpoints) != 2 || dump.Endpoints[0] != "10.112.0.1" || dump.Endpoints[1] != "10.112.0.2:11207" {
+		t.Fatalf("Unexpected endpoints: %v", dump.Endpoints)
+	}
+
+	if dump.Timeouts["n1ql"] != "1s" {
+		t.Fatalf("Expected n1ql timeout to be 1s but was %s", dump.Timeouts["n1ql"])
+	}
+
+	if dump.RetryBehaviors["search"].MaxRetries != 10 {
+		t.Fatalf("Expected search max retries to be 10 but was %d", dump.RetryBehaviors["search"].MaxRetries)
+	}
+
+	if dump.HTTPIdleConnTimeout != "2s" {
+		t.Fatalf("Expected http idle conn timeout to be 2s but was %s", dump.HTTPIdleConnTimeout)
+	}
+
+	if dump.Timeouts["kv"] != "2.5s" || dump.Timeouts["management"] != "1m15s" {
+		t.Fatalf("Expected kv and management timeouts to be dumped but were %v", dump.Timeouts)
+	}
+
+	if !dump.Compression.Enabled || dump.Compression.MinSize != defaultCompressionMinSize {
+		t.Fatalf("Unexpected compression: %v", dump.Compression)
+	}
+
+	if dump.ClusterOptions.ApplicationName != "support" || !dump.ClusterOptions.OnDeadConnectionSet ||
+		dump.ClusterOptions.OnBucketRecreatedSet || dump.ClusterOptions.CircuitBreaker.Enabled {
+		t.Fatalf("Unexpected cluster options: %v", dump.ClusterOptions)
+	}
+
+	if dump.ClusterOptions.ServiceHTTPConfigs["fts"].RequestTimeout != "5s" {
+		t.Fatalf("Expected search request timeout to be dumped but was %v", dump.ClusterOptions.ServiceHTTPConfigs)
+	}
+
+	// SHA-256 of "SELECT 1"
+	expectedHash := "e004ebd5b5532a4b85984a62f8ad48a81aa3460c1ca07701f386135d72cdecf5"
+	if strings.Contains(buf.String(), "SELECT 1") {
+		t.Fatalf("Expected statements to be redacted but was %s", buf.String())
+	}
+	if len(dump.QueryCacheKeys) != 1 || dump.QueryCacheKeys[0].StatementHash != expectedHash ||
+		dump.QueryCacheKeys[0].QueryContext != "default:`b`" || dump.QueryCacheKeys[0].User != redactedValue {
+		t.Fatalf("Unexpected query cache keys: %v", dump.QueryCacheKeys)
+	}
+}
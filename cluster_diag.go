@@ -1,17 +1,22 @@
 package gocb
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/google/uuid"
-
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
 type diagnosticsProvider interface {
 	Diagnostics() (*gocbcore.DiagnosticInfo, error)
 	PingKvEx(opts gocbcore.PingKvOptions, cb gocbcore.PingKvExCallback) (gocbcore.PendingOp, error)
+	StatsEx(opts gocbcore.StatsOptions, cb gocbcore.StatsExCallback) (gocbcore.PendingOp, error)
 }
 
 func diagServiceString(service ServiceType) string {
@@ -78,6 +83,133 @@ type DiagnosticEntry struct {
 	LocalAddr    string
 	RemoteAddr   string
 	LastActivity time.Time
+	// TLS holds the details of the TLS session with the remote endpoint, it is nil unless
+	// DiagnosticsOptions.ProbeTLS is set, TLS is in use and the details could be determined.
+	TLS *DiagnosticTLSInfo
+}
+
+// DiagnosticTLSInfo describes the TLS session negotiated with an endpoint.  The connections themselves are owned
+// by gocbcore which does not expose their state, so these details come from a separate handshake with the
+// endpoint using the same TLS configuration, see DiagnosticsOptions.ProbeTLS.
+type DiagnosticTLSInfo struct {
+	Version     uint16
+	CipherSuite uint16
+	// PeerCertificateExpiry is when the endpoint's own certificate expires.
+	PeerCertificateExpiry time.Time
+	// ChainExpiry is the earliest expiry of any certificate presented by the endpoint, including intermediates.
+	ChainExpiry time.Time
+}
+
+// diagTLSProbeTimeout bounds each handshake made to gather TLS details for a diagnostics report.
+const diagTLSProbeTimeout = 2 * time.Second
+
+// probeTLS performs a TLS handshake with address, returning details of the negotiated session.  The handshake is
+// abandoned if ctx is done first.
+func probeTLS(ctx context.Context, address string, config *tls.Config) (*DiagnosticTLSInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, diagTLSProbeTimeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	rawConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer rawConn.Close()
+
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, err = net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	deadline, _ := ctx.Deadline()
+	err = rawConn.SetDeadline(deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	// The deadline does not cover the context being cancelled, so the connection is closed to interrupt the
+	// handshake instead.
+	handshakeDone := make(chan struct{})
+	defer close(handshakeDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			rawConn.Close()
+		case <-handshakeDone:
+		}
+	}()
+
+	conn := tls.Client(rawConn, config)
+	err = conn.Handshake()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+
+	state := conn.ConnectionState()
+	info := &DiagnosticTLSInfo{
+		Version:     state.Version,
+		CipherSuite: state.CipherSuite,
+	}
+	for i, cert := range state.PeerCertificates {
+		if i == 0 {
+			info.PeerCertificateExpiry = cert.NotAfter
+		}
+		if info.ChainExpiry.IsZero() || cert.NotAfter.Before(info.ChainExpiry) {
+			info.ChainExpiry = cert.NotAfter
+		}
+	}
+
+	return info, nil
+}
+
+// probeTLSEndpoints probes each of addresses in parallel, returning the details of those which could be probed.
+func probeTLSEndpoints(ctx context.Context, addresses []string, config *tls.Config) map[string]*DiagnosticTLSInfo {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	infos := make(map[string]*DiagnosticTLSInfo, len(addresses))
+	for _, address := range addresses {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+
+			info, err := probeTLS(ctx, address, config)
+			if err != nil {
+				logDebugf("Failed to fetch TLS details for %s (%s)", address, err)
+				return
+			}
+
+			lock.Lock()
+			infos[address] = info
+			lock.Unlock()
+		}(address)
+	}
+	wg.Wait()
+
+	return infos
+}
+
+// diagTLSConfig returns the TLS configuration in use by provider, or nil if it does not use TLS.
+func diagTLSConfig(provider diagnosticsProvider) *tls.Config {
+	secureProvider, ok := provider.(interface {
+		IsSecure() bool
+		HttpClient() *http.Client
+	})
+	if !ok || !secureProvider.IsSecure() || secureProvider.HttpClient() == nil {
+		return nil
+	}
+
+	transport, ok := secureProvider.HttpClient().Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil {
+		return nil
+	}
+
+	return transport.TLSClientConfig
 }
 
 // DiagnosticsReport encapsulates the results of a Diagnostics operation.
@@ -85,50 +217,130 @@ type DiagnosticsReport struct {
 	ID        string
 	ConfigRev int64
 	Services  []DiagnosticEntry
+	// KvErrors summarizes the KV errors which have occurred recently per vbucket and server.
+	KvErrors *KvErrorHeatmap
+	// InsecureSkipVerify is true when TLS is in use but the certificates presented by the cluster are not
+	// verified, see ClusterOptions.InsecureSkipVerify.
+	InsecureSkipVerify bool
 }
 
 type jsonDiagnosticEntry struct {
-	State          string `json:"state"`
-	Remote         string `json:"remote"`
-	Local          string `json:"local"`
-	LastActivityUs uint64 `json:"last_activity_us"`
+	State          string                 `json:"state"`
+	Remote         string                 `json:"remote"`
+	Local          string                 `json:"local"`
+	LastActivityUs uint64                 `json:"last_activity_us"`
+	TLS            *jsonDiagnosticTLSInfo `json:"tls,omitempty"`
+}
+
+type jsonDiagnosticTLSInfo struct {
+	Version               uint16    `json:"version"`
+	CipherSuite           uint16    `json:"cipher_suite"`
+	PeerCertificateExpiry time.Time `json:"peer_cert_expiry"`
+	ChainExpiry           time.Time `json:"chain_expiry"`
 }
 
 type jsonDiagnosticReport struct {
-	Version   int                              `json:"version"`
-	ID        string                           `json:"id"`
-	ConfigRev int                              `json:"config_rev"`
-	Sdk       string                           `json:"sdk"`
-	Services  map[string][]jsonDiagnosticEntry `json:"services"`
+	Version            int                              `json:"version"`
+	ID                 string                           `json:"id"`
+	ConfigRev          int                              `json:"config_rev"`
+	Sdk                string                           `json:"sdk"`
+	Services           map[string][]jsonDiagnosticEntry `json:"services"`
+	KvErrors           *jsonKvErrorHeatmap              `json:"kv_errors,omitempty"`
+	InsecureSkipVerify bool                             `json:"insecure_skip_verify,omitempty"`
+}
+
+type jsonKvErrorHeatmap struct {
+	WindowMs int64                               `json:"window_ms"`
+	Buckets  map[string]jsonKvBucketErrorHeatmap `json:"buckets"`
+}
+
+type jsonKvBucketErrorHeatmap struct {
+	Errors   uint64            `json:"errors"`
+	Vbuckets map[string]uint64 `json:"vbuckets,omitempty"`
+	Servers  map[string]uint64 `json:"servers,omitempty"`
 }
 
 // MarshalJSON generates a JSON representation of this diagnostics report.
 func (report *DiagnosticsReport) MarshalJSON() ([]byte, error) {
 	jsonReport := jsonDiagnosticReport{
-		Version:  1,
-		ID:       report.ID,
-		Services: make(map[string][]jsonDiagnosticEntry),
+		Version:            1,
+		ID:                 report.ID,
+		Services:           make(map[string][]jsonDiagnosticEntry),
+		InsecureSkipVerify: report.InsecureSkipVerify,
 	}
 
 	for _, service := range report.Services {
 		serviceStr := diagServiceString(service.Service)
 		stateStr := diagStateString(service.State)
 
-		jsonReport.Services[serviceStr] = append(jsonReport.Services[serviceStr], jsonDiagnosticEntry{
+		entry := jsonDiagnosticEntry{
 			State:          stateStr,
 			Remote:         service.RemoteAddr,
 			Local:          service.LocalAddr,
 			LastActivityUs: uint64(time.Now().Sub(service.LastActivity).Nanoseconds()),
-		})
+		}
+		if service.TLS != nil {
+			entry.TLS = &jsonDiagnosticTLSInfo{
+				Version:               service.TLS.Version,
+				CipherSuite:           service.TLS.CipherSuite,
+				PeerCertificateExpiry: service.TLS.PeerCertificateExpiry,
+				ChainExpiry:           service.TLS.ChainExpiry,
+			}
+		}
+		jsonReport.Services[serviceStr] = append(jsonReport.Services[serviceStr], entry)
+	}
+
+	if report.KvErrors != nil && len(report.KvErrors.Buckets) > 0 {
+		jsonReport.KvErrors = &jsonKvErrorHeatmap{
+			WindowMs: int64(report.KvErrors.Window / time.Millisecond),
+			Buckets:  make(map[string]jsonKvBucketErrorHeatmap),
+		}
+		for _, bucket := range report.KvErrors.Buckets {
+			jsonBucket := jsonKvBucketErrorHeatmap{
+				Errors:   bucket.Errors,
+				Vbuckets: make(map[string]uint64),
+				Servers:  make(map[string]uint64),
+			}
+			for _, vbucket := range bucket.Vbuckets {
+				jsonBucket.Vbuckets[strconv.Itoa(int(vbucket.Vbucket))] = vbucket.Errors
+			}
+			for _, server := range bucket.Servers {
+				jsonBucket.Servers[server.Server] = server.Errors
+			}
+			jsonReport.KvErrors.Buckets[bucket.BucketName] = jsonBucket
+		}
 	}
 
 	return json.Marshal(&jsonReport)
 }
 
-// DiagnosticsWithID returns information about the internal state of the SDK, using reportID as the name for the report.
+// DiagnosticsOptions are the options available to the DiagnosticsWithOptions command.
+type DiagnosticsOptions struct {
+	// ReportID is the name for the report, defaulting to a uuid or an id from ClusterOptions.IDGenerator.
+	ReportID string
+	// ProbeTLS includes the details of the TLS session with each connected KV endpoint in the report.  The
+	// connections themselves are owned by gocbcore which does not expose their state, so each endpoint is probed
+	// with a separate handshake, made in parallel and bounded by Context.
+	ProbeTLS bool
+	Context  context.Context
+}
+
+// DiagnosticsWithOptions returns information about the internal state of the SDK.
 //
 // Experimental: This API is subject to change at any time.
-func (c *Cluster) DiagnosticsWithID(reportID string) (*DiagnosticsReport, error) {
+func (c *Cluster) DiagnosticsWithOptions(opts *DiagnosticsOptions) (*DiagnosticsReport, error) {
+	if opts == nil {
+		opts = &DiagnosticsOptions{}
+	}
+	reportID := opts.ReportID
+	if reportID == "" {
+		reportID = c.newID()
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	cli, err := c.randomClient()
 	if err != nil {
 		return nil, err
@@ -148,6 +360,13 @@ func (c *Cluster) DiagnosticsWithID(reportID string) (*DiagnosticsReport, error)
 		ID:        reportID,
 		ConfigRev: agentReport.ConfigRev,
 	}
+	if c.sb.KvErrors != nil {
+		report.KvErrors = c.sb.KvErrors.summary(time.Now())
+	}
+
+	tlsConfig := diagTLSConfig(provider)
+	report.InsecureSkipVerify = tlsConfig != nil && tlsConfig.InsecureSkipVerify
+
 	for _, conn := range agentReport.MemdConns {
 		state := DiagStateDisconnected
 		if conn.LocalAddr != "" {
@@ -163,12 +382,39 @@ func (c *Cluster) DiagnosticsWithID(reportID string) (*DiagnosticsReport, error)
 		})
 	}
 
+	if opts.ProbeTLS && tlsConfig != nil {
+		// Each endpoint is only probed once, however many connections there are to it.
+		var addresses []string
+		seen := make(map[string]bool)
+		for _, entry := range report.Services {
+			if entry.State == DiagStateOk && !seen[entry.RemoteAddr] {
+				seen[entry.RemoteAddr] = true
+				addresses = append(addresses, entry.RemoteAddr)
+			}
+		}
+
+		tlsInfos := probeTLSEndpoints(ctx, addresses, tlsConfig)
+		for i, entry := range report.Services {
+			if entry.State == DiagStateOk {
+				report.Services[i].TLS = tlsInfos[entry.RemoteAddr]
+			}
+		}
+	}
+
 	return report, nil
 }
 
-// Diagnostics returns information about the internal state of the SDK, using uuid as the name for the report.
+// DiagnosticsWithID returns information about the internal state of the SDK, using reportID as the name for the report.
+//
+// Experimental: This API is subject to change at any time.
+func (c *Cluster) DiagnosticsWithID(reportID string) (*DiagnosticsReport, error) {
+	return c.DiagnosticsWithOptions(&DiagnosticsOptions{ReportID: reportID})
+}
+
+// Diagnostics returns information about the internal state of the SDK, using a uuid, or an id from
+// ClusterOptions.IDGenerator, as the name for the report.
 //
 // Experimental: This API is subject to change at any time.
 func (c *Cluster) Diagnostics() (*DiagnosticsReport, error) {
-	return c.DiagnosticsWithID(uuid.New().String())
+	return c.DiagnosticsWithID(c.newID())
 }
@@ -0,0 +1,133 @@
+package gocb
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type mockSecureDiagProvider struct {
+	mockStatsProvider
+	info   *gocbcore.DiagnosticInfo
+	client *http.Client
+}
+
+func (p *mockSecureDiagProvider) Diagnostics() (*gocbcore.DiagnosticInfo, error) {
+	return p.info, nil
+}
+
+func (p *mockSecureDiagProvider) IsSecure() bool {
+	return p.client != nil
+}
+
+func (p *mockSecureDiagProvider) HttpClient() *http.Client {
+	return p.client
+}
+
+func TestDiagnosticsTLSDetails(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse server url: %v", err)
+	}
+
+	provider := &mockSecureDiagProvider{
+		info: &gocbcore.DiagnosticInfo{
+			MemdConns: []gocbcore.MemdConnInfo{
+				{LocalAddr: "127.0.0.1:50001", RemoteAddr: serverURL.Host, LastActivity: time.Now()},
+				{LocalAddr: "127.0.0.1:50002", RemoteAddr: serverURL.Host, LastActivity: time.Now()},
+				{RemoteAddr: "127.0.0.1:1"},
+			},
+		},
+		client: &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		},
+	}
+	cluster := &Cluster{
+		connections: map[string]client{
+			"mock-false": &mockClient{bucketName: "mock", mockDiagProvider: provider},
+		},
+	}
+
+	report, err := cluster.Diagnostics()
+	if err != nil {
+		t.Fatalf("Diagnostics failed: %v", err)
+	}
+	if report.Services[0].TLS != nil {
+		t.Fatalf("Expected no TLS details unless they are asked for")
+	}
+	if !report.InsecureSkipVerify {
+		t.Fatalf("Expected report to show that certificates are not verified")
+	}
+
+	report, err = cluster.DiagnosticsWithOptions(&DiagnosticsOptions{ProbeTLS: true})
+	if err != nil {
+		t.Fatalf("Diagnostics failed: %v", err)
+	}
+
+	expiry := server.Certificate().NotAfter
+	for i, entry := range report.Services[:2] {
+		if entry.TLS == nil {
+			t.Fatalf("Expected TLS details for connection %d", i)
+		}
+		if entry.TLS.Version == 0 || entry.TLS.CipherSuite == 0 {
+			t.Fatalf("Expected negotiated version and cipher but were %+v", entry.TLS)
+		}
+		if !entry.TLS.PeerCertificateExpiry.Equal(expiry) || !entry.TLS.ChainExpiry.Equal(expiry) {
+			t.Fatalf("Expected certificate expiry to be %s but was %+v", expiry, entry.TLS)
+		}
+	}
+	if report.Services[2].TLS != nil {
+		t.Fatalf("Expected no TLS details for a disconnected endpoint")
+	}
+	if !report.InsecureSkipVerify {
+		t.Fatalf("Expected report to show that certificates are not verified")
+	}
+
+	jsonBytes, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("Failed to marshal report: %v", err)
+	}
+	var jsonReport jsonDiagnosticReport
+	err = json.Unmarshal(jsonBytes, &jsonReport)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal report: %v", err)
+	}
+	if jsonReport.Services["kv"][0].TLS == nil || jsonReport.Services["kv"][2].TLS != nil {
+		t.Fatalf("Expected TLS details to be included in JSON report for connected endpoints only")
+	}
+	if !jsonReport.InsecureSkipVerify {
+		t.Fatalf("Expected JSON report to show that certificates are not verified")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err = cluster.DiagnosticsWithOptions(&DiagnosticsOptions{ProbeTLS: true, Context: ctx})
+	if err != nil {
+		t.Fatalf("Diagnostics failed: %v", err)
+	}
+	if report.Services[0].TLS != nil {
+		t.Fatalf("Expected no TLS details when the context is cancelled")
+	}
+
+	provider.client = nil
+	report, err = cluster.DiagnosticsWithOptions(&DiagnosticsOptions{ProbeTLS: true})
+	if err != nil {
+		t.Fatalf("Diagnostics failed: %v", err)
+	}
+	if report.Services[0].TLS != nil {
+		t.Fatalf("Expected no TLS details when TLS is not in use")
+	}
+	if report.InsecureSkipVerify {
+		t.Fatalf("Expected report not to show certificates as unverified when TLS is not in use")
+	}
+}
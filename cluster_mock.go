@@ -0,0 +1,195 @@
+package gocb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// MockKvProvider is implemented by types which serve key value operations in place of a cluster, it has the same
+// methods as the key value operations of a gocbcore Agent.  The mocktest package provides an implementation, and
+// mocks of it can also be generated with tools such as gomock.
+// VOLATILE: This API is subject to change at any time.
+type MockKvProvider interface {
+	AddEx(opts gocbcore.AddOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error)
+	SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error)
+	ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error)
+	GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error)
+	GetReplicaEx(opts gocbcore.GetReplicaOptions, cb gocbcore.GetReplicaExCallback) (gocbcore.PendingOp, error)
+	GetMetaEx(opts gocbcore.GetMetaOptions, cb gocbcore.GetMetaExCallback) (gocbcore.PendingOp, error)
+	ObserveEx(opts gocbcore.ObserveOptions, cb gocbcore.ObserveExCallback) (gocbcore.PendingOp, error)
+	ObserveVbEx(opts gocbcore.ObserveVbOptions, cb gocbcore.ObserveVbExCallback) (gocbcore.PendingOp, error)
+	DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error)
+	LookupInEx(opts gocbcore.LookupInOptions, cb gocbcore.LookupInExCallback) (gocbcore.PendingOp, error)
+	MutateInEx(opts gocbcore.MutateInOptions, cb gocbcore.MutateInExCallback) (gocbcore.PendingOp, error)
+	GetAndTouchEx(opts gocbcore.GetAndTouchOptions, cb gocbcore.GetAndTouchExCallback) (gocbcore.PendingOp, error)
+	GetAndLockEx(opts gocbcore.GetAndLockOptions, cb gocbcore.GetAndLockExCallback) (gocbcore.PendingOp, error)
+	UnlockEx(opts gocbcore.UnlockOptions, cb gocbcore.UnlockExCallback) (gocbcore.PendingOp, error)
+	TouchEx(opts gocbcore.TouchOptions, cb gocbcore.TouchExCallback) (gocbcore.PendingOp, error)
+	IncrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error)
+	DecrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error)
+	AppendEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error)
+	PrependEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error)
+	NumReplicas() int
+}
+
+// MockHTTPProvider is implemented by types which serve query, search, analytics, view and management requests
+// in place of a cluster.
+// VOLATILE: This API is subject to change at any time.
+type MockHTTPProvider interface {
+	DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error)
+}
+
+// NewMockCluster returns a Cluster whose operations are served by the given providers rather than by connecting
+// to a cluster, allowing code built on top of gocb to be unit tested.  Every Bucket opened from the Cluster shares
+// the same providers, either of which may be nil if the corresponding operations are not used.
+// VOLATILE: This API is subject to change at any time.
+func NewMockCluster(kvProvider MockKvProvider, httpProvider MockHTTPProvider, opts ClusterOptions) (*Cluster, error) {
+	cluster, err := NewCluster("couchbase://mock", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cluster.clientFactory = func(sb *clientStateBlock) client {
+		return &mockedClient{
+			sb:           *sb,
+			kvProvider:   kvProvider,
+			httpProvider: httpProvider,
+		}
+	}
+
+	// Cluster level services use any open client, make sure there is one before a bucket has been opened.
+	cluster.getClient(&clientStateBlock{})
+
+	return cluster, nil
+}
+
+// NewGetResult returns a GetResult for a document with the given cas and value, which is encoded with
+// DefaultEncode, so that mocks of CollectionInterface can return documents.
+// VOLATILE: This API is subject to change at any time.
+func NewGetResult(cas Cas, value interface{}) (*GetResult, error) {
+	contents, flags, err := DefaultEncode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GetResult{
+		cas:      cas,
+		flags:    flags,
+		contents: contents,
+	}, nil
+}
+
+// NewExistsResult returns an ExistsResult for a document with the given cas, so that mocks of
+// CollectionInterface can report whether documents exist.
+// VOLATILE: This API is subject to change at any time.
+func NewExistsResult(cas Cas, exists bool) *ExistsResult {
+	keyState := gocbcore.KeyStateNotFound
+	if exists {
+		keyState = gocbcore.KeyStatePersisted
+	}
+
+	return &ExistsResult{
+		cas:      cas,
+		keyState: keyState,
+	}
+}
+
+// NewMutationResult returns a MutationResult with the given cas and mutation token, so that mocks of
+// CollectionInterface can report mutations.
+// VOLATILE: This API is subject to change at any time.
+func NewMutationResult(cas Cas, mt MutationToken) *MutationResult {
+	return &MutationResult{
+		mt:  mt,
+		cas: cas,
+	}
+}
+
+// NewCounterResult returns a CounterResult with the given cas, mutation token and counter value, so that mocks
+// of BinaryCollectionInterface can report counter operations.
+// VOLATILE: This API is subject to change at any time.
+func NewCounterResult(cas Cas, mt MutationToken, value uint64) *CounterResult {
+	return &CounterResult{
+		mt:      mt,
+		cas:     cas,
+		content: value,
+	}
+}
+
+// NewQueryResults returns QueryResults whose rows are the given values marshalled to JSON, so that mocks of
+// QueryerInterface can return rows.  Of the metadata of the results only the result count is set.
+// VOLATILE: This API is subject to change at any time.
+func NewQueryResults(rows []interface{}) (*QueryResults, error) {
+	rawRows := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		rawRows[i] = data
+	}
+
+	return &QueryResults{
+		index: -1,
+		rows:  rawRows,
+		metrics: QueryResultMetrics{
+			ResultCount: uint(len(rawRows)),
+		},
+	}, nil
+}
+
+// mockedClient is the client used by clusters created with NewMockCluster.
+type mockedClient struct {
+	sb           clientStateBlock
+	kvProvider   kvProvider
+	httpProvider httpProvider
+}
+
+func (c *mockedClient) Hash() string {
+	return c.sb.Hash()
+}
+
+func (c *mockedClient) connect() error {
+	return nil
+}
+
+func (c *mockedClient) fetchCollectionID(ctx context.Context, scopeName string, collectionName string) (uint32, error) {
+	return 0, nil
+}
+
+func (c *mockedClient) getKvProvider() (kvProvider, error) {
+	if c.kvProvider == nil {
+		return nil, fmt.Errorf("no mock kv provider configured for bucket %s", c.sb.BucketName)
+	}
+	return c.kvProvider, nil
+}
+
+func (c *mockedClient) getHTTPProvider() (httpProvider, error) {
+	if c.httpProvider == nil {
+		return nil, errors.New("no mock http provider configured")
+	}
+	return c.httpProvider, nil
+}
+
+func (c *mockedClient) getDiagnosticsProvider() (diagnosticsProvider, error) {
+	return nil, errors.New("diagnostics are not supported by mock clusters")
+}
+
+func (c *mockedClient) openDcpProvider(streamName string, flags gocbcore.DcpOpenFlag) (dcpProvider, error) {
+	return nil, errors.New("change streams are not supported by mock clusters")
+}
+
+func (c *mockedClient) reconnect() error {
+	return nil
+}
+
+func (c *mockedClient) bucketGeneration() uint32 {
+	return 0
+}
+
+func (c *mockedClient) close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package gocb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+var _ MockKvProvider = &mocktest.KvOperator{}
+
+func TestMockCluster(t *testing.T) {
+	kvProvider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(5),
+		Datatype: 1,
+		Value:    []byte(`{"name":"mock"}`),
+	}
+	httpProvider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(bytes.NewReader([]byte(`{"results":[{"a":1}],"status":"success"}`))),
+			}, nil
+		},
+	}
+
+	cluster, err := NewMockCluster(kvProvider, httpProvider, ClusterOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create mock cluster: %v", err)
+	}
+
+	bucket, err := cluster.Bucket("mock", nil)
+	if err != nil {
+		t.Fatalf("Failed to open bucket: %v", err)
+	}
+
+	col, err := bucket.DefaultCollection(nil)
+	if err != nil {
+		t.Fatalf("Failed to open collection: %v", err)
+	}
+
+	res, err := col.Get("key", &GetOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	if res.Cas() != Cas(5) {
+		t.Fatalf("Expected cas to be 5 but was %d", res.Cas())
+	}
+
+	var doc map[string]string
+	err = res.Content(&doc)
+	if err != nil {
+		t.Fatalf("Failed to decode content: %v", err)
+	}
+	if doc["name"] != "mock" {
+		t.Fatalf("Expected name to be mock but was %s", doc["name"])
+	}
+
+	rows, err := cluster.Query("SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("Query failed, error was %v", err)
+	}
+
+	var row map[string]int
+	if !rows.Next(&row) || row["a"] != 1 {
+		t.Fatalf("Expected query to return a row")
+	}
+	err = rows.Close()
+	if err != nil {
+		t.Fatalf("Failed to close query results: %v", err)
+	}
+
+	err = cluster.Close(nil)
+	if err != nil {
+		t.Fatalf("Failed to close cluster: %v", err)
+	}
+}
+
+func TestMockClusterWithoutProviders(t *testing.T) {
+	cluster, err := NewMockCluster(nil, nil, ClusterOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create mock cluster: %v", err)
+	}
+
+	bucket, err := cluster.Bucket("mock", nil)
+	if err != nil {
+		t.Fatalf("Failed to open bucket: %v", err)
+	}
+
+	col, err := bucket.DefaultCollection(nil)
+	if err != nil {
+		t.Fatalf("Failed to open collection: %v", err)
+	}
+
+	_, err = col.Get("key", nil)
+	if err == nil {
+		t.Fatalf("Expected Get to fail without a kv provider")
+	}
+
+	_, err = cluster.Query("SELECT 1", nil)
+	if err == nil {
+		t.Fatalf("Expected Query to fail without an http provider")
+	}
+}
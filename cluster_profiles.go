@@ -0,0 +1,53 @@
+package gocb
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClusterProfile is the name of a curated set of ClusterOptions, see ClusterOptions.ApplyProfile.
+type ClusterProfile string
+
+const (
+	// ClusterProfileWanDevelopment raises timeouts for developing against a cluster over a high latency
+	// connection, such as a cloud hosted cluster from a laptop.  It is not intended for production use.
+	ClusterProfileWanDevelopment = ClusterProfile("wan-development")
+
+	// ClusterProfileLowLatency lowers timeouts and retries so that operations fail fast, for applications
+	// which are close to the cluster and prefer a fast failure over waiting for a slow response.
+	ClusterProfileLowLatency = ClusterProfile("low-latency")
+)
+
+var clusterProfiles = map[ClusterProfile]func(opts *ClusterOptions){
+	ClusterProfileWanDevelopment: func(opts *ClusterOptions) {
+		opts.ConnectTimeout = 120 * time.Second
+		opts.KvConnectTimeout = 20 * time.Second
+		opts.KvTimeout = 20 * time.Second
+		opts.DurabilityTimeout = 60 * time.Second
+		opts.QueryTimeout = 120 * time.Second
+		opts.SearchTimeout = 120 * time.Second
+		opts.AnalyticsTimeout = 120 * time.Second
+	},
+	ClusterProfileLowLatency: func(opts *ClusterOptions) {
+		opts.KvConnectTimeout = 2 * time.Second
+		opts.KvTimeout = 1 * time.Second
+		opts.DurabilityTimeout = 5 * time.Second
+		opts.QueryTimeout = 10 * time.Second
+		opts.SearchTimeout = 10 * time.Second
+		opts.AnalyticsTimeout = 30 * time.Second
+		opts.RetryBehavior = StandardDelayRetryBehavior(3, 2, 10*time.Millisecond, ExponentialDelayFunction)
+	},
+}
+
+// ApplyProfile sets the timeout and retry options of opts to the preset values of profile.  Any of those options
+// which were previously set are overwritten, so options which should differ from the profile must be set after
+// applying it.
+func (opts *ClusterOptions) ApplyProfile(profile ClusterProfile) error {
+	apply, ok := clusterProfiles[profile]
+	if !ok {
+		return fmt.Errorf("unknown cluster profile %s", profile)
+	}
+
+	apply(opts)
+	return nil
+}
@@ -0,0 +1,63 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClusterOptionsApplyProfile(t *testing.T) {
+	opts := ClusterOptions{QueryTimeout: time.Second}
+	err := opts.ApplyProfile(ClusterProfileWanDevelopment)
+	if err != nil {
+		t.Fatalf("Failed to apply profile: %v", err)
+	}
+
+	if opts.KvTimeout != 20*time.Second || opts.QueryTimeout != 120*time.Second {
+		t.Fatalf("Expected profile timeouts to be applied but were %s and %s", opts.KvTimeout, opts.QueryTimeout)
+	}
+
+	cluster, err := NewCluster("couchbase://localhost?n1ql_timeout=1000", opts)
+	if err != nil {
+		t.Fatalf("Failed to create cluster: %v", err)
+	}
+
+	if cluster.n1qlTimeout() != 120*time.Second {
+		t.Fatalf("Expected query timeout to take precedence over the connection string but was %s", cluster.n1qlTimeout())
+	}
+
+	if cluster.ssb.kvConnectTimeout != 20*time.Second {
+		t.Fatalf("Expected kv connect timeout to be 20s but was %s", cluster.ssb.kvConnectTimeout)
+	}
+
+	sb := newBucket(cluster.sb, "default", BucketOptions{}).sb.withCollection("_default")
+	if sb.KvTimeout != 20*time.Second || sb.DuraTimeout != 60*time.Second {
+		t.Fatalf("Expected collection timeouts to be 20s and 60s but were %s and %s", sb.KvTimeout, sb.DuraTimeout)
+	}
+
+	err = opts.ApplyProfile("unknown")
+	if err == nil {
+		t.Fatalf("Expected applying an unknown profile to fail")
+	}
+}
+
+func TestClusterOptionsLowLatencyProfile(t *testing.T) {
+	var opts ClusterOptions
+	err := opts.ApplyProfile(ClusterProfileLowLatency)
+	if err != nil {
+		t.Fatalf("Failed to apply profile: %v", err)
+	}
+
+	cluster, err := NewCluster("couchbase://localhost", opts)
+	if err != nil {
+		t.Fatalf("Failed to create cluster: %v", err)
+	}
+
+	if cluster.sb.N1qlRetryBehavior != opts.RetryBehavior || cluster.sb.SearchRetryBehavior != opts.RetryBehavior {
+		t.Fatalf("Expected profile retry behavior to be used")
+	}
+
+	sb := newBucket(cluster.sb, "default", BucketOptions{}).sb.withCollection("_default")
+	if sb.KvTimeout != time.Second {
+		t.Fatalf("Expected kv timeout to be 1s but was %s", sb.KvTimeout)
+	}
+}
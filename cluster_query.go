@@ -3,7 +3,10 @@ package gocb
 import (
 	"context"
 	"encoding/json"
+	"io"
+	"io/ioutil"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -15,6 +18,60 @@ import (
 type n1qlCache struct {
 	name        string
 	encodedPlan string
+	// named is whether the statement was prepared with a name chosen by the application.
+	named bool
+}
+
+// n1qlCacheKey identifies a prepared statement in the query cache.  The same statement text can resolve to
+// different keyspaces in different query contexts, and a plan prepared by one user must not be executed by
+// another, so both are part of the key.
+type n1qlCacheKey struct {
+	statement    string
+	queryContext string
+	user         string
+}
+
+// queryCacheKey returns the key of the prepared statement for the query in queryOpts.
+func (c *Cluster) queryCacheKey(queryOpts map[string]interface{}) n1qlCacheKey {
+	key := n1qlCacheKey{}
+	key.statement, _ = queryOpts["statement"].(string)
+	key.queryContext, _ = queryOpts["query_context"].(string)
+	key.user = c.queryUser()
+
+	return key
+}
+
+// queryUser returns the user that queries are currently run as, or an empty string if there is none.
+func (c *Cluster) queryUser() string {
+	if auth := c.authenticator(); auth != nil {
+		creds, err := auth.Credentials(AuthCredsRequest{Service: N1qlService})
+		if err == nil && len(creds) > 0 {
+			return creds[0].Username
+		}
+	}
+
+	return ""
+}
+
+// queryContextBucket returns the bucket named by a query context such as "default:`bucket`.`scope`", or an
+// empty string if it names none.
+func queryContextBucket(queryContext string) string {
+	if idx := strings.Index(queryContext, ":"); idx >= 0 {
+		queryContext = queryContext[idx+1:]
+	}
+
+	if strings.HasPrefix(queryContext, "`") {
+		queryContext = queryContext[1:]
+		if idx := strings.Index(queryContext, "`"); idx >= 0 {
+			return queryContext[:idx]
+		}
+		return queryContext
+	}
+
+	if idx := strings.Index(queryContext, "."); idx >= 0 {
+		return queryContext[:idx]
+	}
+	return queryContext
 }
 
 type n1qlResponseMetrics struct {
@@ -28,11 +85,20 @@ type n1qlResponseMetrics struct {
 	WarningCount  uint   `json:"warningCount,omitempty"`
 }
 
+// QueryWarning is a warning returned by the query service about a query which was executed successfully, for
+// example when it uses deprecated syntax that a future version of the server may reject.
+type QueryWarning struct {
+	Code    uint32 `json:"code"`
+	Message string `json:"msg"`
+}
+
 type n1qlResponse struct {
 	RequestID       string              `json:"requestID"`
 	ClientContextID string              `json:"clientContextID"`
 	Results         []json.RawMessage   `json:"results,omitempty"`
+	Signature       json.RawMessage     `json:"signature,omitempty"`
 	Errors          []queryError        `json:"errors,omitempty"`
+	Warnings        []QueryWarning      `json:"warnings,omitempty"`
 	Status          string              `json:"status"`
 	Metrics         n1qlResponseMetrics `json:"metrics"`
 }
@@ -49,21 +115,33 @@ type QueryResultMetrics struct {
 	WarningCount  uint
 }
 
-// QueryResults allows access to the results of a N1QL query.
+// QueryResults allows access to the results of a N1QL query.  The rows of the results of Cluster.Query are read
+// from the network as they are needed, so the results must be read to the end or closed to release the connection.
+// Metadata, such as the metrics, which the query service returns after the rows is only available once they have
+// all been read.
 type QueryResults struct {
 	closed          bool
 	index           int
 	rows            []json.RawMessage
+	stream          *queryResultStream
+	partitions      *partitionedRows
+	signature       json.RawMessage
+	scanColumns     []string
+	strictDecoding  bool
+	watch           *consumerWatch
 	err             error
 	requestID       string
 	clientContextID string
 	metrics         QueryResultMetrics
+	warnings        []QueryWarning
 	sourceAddr      string
+	cached          bool
 }
 
 // Next assigns the next result from the results into the value pointer, returning whether the read was successful.
+// It always returns false once the results have been closed or an error has occurred.
 func (r *QueryResults) Next(valuePtr interface{}) bool {
-	if r.err != nil {
+	if r.err != nil || r.closed {
 		return false
 	}
 
@@ -72,7 +150,11 @@ func (r *QueryResults) Next(valuePtr interface{}) bool {
 		return false
 	}
 
-	r.err = json.Unmarshal(row, valuePtr)
+	if r.strictDecoding {
+		r.err = r.decodeRowStrict(row, valuePtr)
+	} else {
+		r.err = json.Unmarshal(row, valuePtr)
+	}
 	if r.err != nil {
 		return false
 	}
@@ -82,12 +164,35 @@ func (r *QueryResults) Next(valuePtr interface{}) bool {
 
 // NextBytes returns the next result from the results as a byte array.
 func (r *QueryResults) NextBytes() []byte {
-	if r.err != nil {
+	if r.err != nil || r.closed {
 		return nil
 	}
 
+	if r.stream != nil {
+		row := r.nextStreamedRow()
+		if row == nil {
+			r.closed = true
+			r.watch.done()
+			return nil
+		}
+		r.index++
+		return row
+	}
+
+	if r.partitions != nil {
+		row := r.partitions.next(r)
+		if row == nil {
+			r.closed = true
+			r.watch.done()
+			return nil
+		}
+		r.index++
+		return row
+	}
+
 	if r.index+1 >= len(r.rows) {
 		r.closed = true
+		r.watch.done()
 		return nil
 	}
 	r.index++
@@ -95,13 +200,28 @@ func (r *QueryResults) NextBytes() []byte {
 	return r.rows[r.index]
 }
 
-// Close marks the results as closed, returning any errors that occurred during reading the results.
+// Close marks the results as closed, returning the first error that occurred during reading the results.
+// Any rows which have not been read are discarded, if there are too many to read quickly the metadata returned
+// after them is not available.  It is safe to call Close more than once.
 func (r *QueryResults) Close() error {
 	r.closed = true
+	r.rows = nil
+	r.discardStream()
+	r.finishStream()
+	if r.partitions != nil {
+		r.partitions.close()
+	}
+	r.watch.done()
+	return r.err
+}
+
+// Err returns the first error that occurred during reading the results.
+func (r *QueryResults) Err() error {
 	return r.err
 }
 
 // One assigns the first value from the results into the value pointer.
+// Any rows after the first are discarded without being decoded.
 func (r *QueryResults) One(valuePtr interface{}) error {
 	if !r.Next(valuePtr) {
 		err := r.Close()
@@ -111,6 +231,14 @@ func (r *QueryResults) One(valuePtr interface{}) error {
 		// return ErrNoResults TODO
 	}
 
+	// We only ever want the first row so release the remaining ones now rather than
+	// holding on to them until the results themselves are no longer referenced.  A streamed response is aborted
+	// rather than having its remaining rows read.
+	r.rows = nil
+	if r.stream != nil {
+		r.stream.abort()
+	}
+
 	// Ignore any errors occurring after we already have our result
 	err := r.Close()
 	if err != nil {
@@ -121,6 +249,11 @@ func (r *QueryResults) One(valuePtr interface{}) error {
 	return nil
 }
 
+// Cached returns whether the results were served from the client side cache, see QueryOptions.CacheFor.
+func (r *QueryResults) Cached() bool {
+	return r.cached
+}
+
 // SourceEndpoint returns the endpoint used for execution of this query.
 // VOLATILE
 func (r *QueryResults) SourceEndpoint() string {
@@ -145,6 +278,15 @@ func (r *QueryResults) ClientContextID() string {
 	return r.clientContextID
 }
 
+// Warnings returns any warnings that the query service returned about the query.
+func (r *QueryResults) Warnings() []QueryWarning {
+	if !r.closed {
+		panic("Result must be closed before accessing meta-data")
+	}
+
+	return r.warnings
+}
+
 // Metrics returns metrics about execution of this result.
 func (r *QueryResults) Metrics() QueryResultMetrics {
 	if !r.closed {
@@ -158,6 +300,54 @@ type httpProvider interface {
 	DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error)
 }
 
+// maxHTTPBodyDrainBytes is the most unread data that will be discarded from a response body before it is closed.
+// The HTTP client can only reuse a connection once the body has been fully read, but a body with more than this
+// remaining is cheaper to abort (closing the connection) than to read to the end.
+const maxHTTPBodyDrainBytes = 256 * 1024
+
+const (
+	applicationNameHeader = "X-Couchbase-Application-Name"
+	clientContextIDHeader = "X-Couchbase-Client-Context-ID"
+)
+
+// setAttributionHeaders adds headers identifying the application and request to req, mirroring the
+// client context id which is also sent within the body for services that support it.
+func (c *Cluster) setAttributionHeaders(req *gocbcore.HttpRequest, clientContextID string) {
+	if c.ssb.applicationName == "" && clientContextID == "" {
+		return
+	}
+
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	if c.ssb.applicationName != "" {
+		req.Headers[applicationNameHeader] = c.ssb.applicationName
+	}
+	if clientContextID != "" {
+		req.Headers[clientContextIDHeader] = clientContextID
+	}
+}
+
+// drainAndCloseHTTPBody discards any unread data from body and then closes it, allowing the underlying
+// connection to be returned to the pool.
+func drainAndCloseHTTPBody(body io.ReadCloser) {
+	_, err := io.CopyN(ioutil.Discard, body, maxHTTPBodyDrainBytes)
+	if err != nil && err != io.EOF {
+		logDebugf("Failed to drain response body (%s)", err)
+	}
+
+	closeHTTPBody(body)
+}
+
+// closeHTTPBody closes a response body without reading what remains of it, which aborts the response and closes
+// its connection if it has not been read to the end.
+func closeHTTPBody(body io.ReadCloser) {
+	err := body.Close()
+	if err != nil {
+		logDebugf("Failed to close socket (%s)", err)
+	}
+}
+
 // Query executes the N1QL query statement on the server n1qlEp.
 // This function assumes that `opts` already contains all the required
 // settings. This function will inject any additional connection or request-level
@@ -171,32 +361,78 @@ func (c *Cluster) Query(statement string, opts *QueryOptions) (*QueryResults, er
 		ctx = context.Background()
 	}
 
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
 	var span opentracing.Span
-	if opts.ParentSpanContext == nil {
+	if parentSpanCtx == nil {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteN1QLQuery",
 			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"})
 	} else {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteN1QLQuery",
-			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"}, opentracing.ChildOf(opts.ParentSpanContext))
+			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"}, opentracing.ChildOf(parentSpanCtx))
 	}
 	defer span.Finish()
 
-	provider, err := c.getHTTPProvider()
+	cacheKey := c.queryResultCacheKey(statement, opts)
+	if cacheKey != "" {
+		res, ok := c.queryResults.get(cacheKey)
+		// Results with more rows than can be buffered are left for the query to fail with ErrResultTooLarge.
+		if ok && (opts.MaxBufferedRows <= 0 || len(res.rows) <= opts.MaxBufferedRows) {
+			span.SetTag("couchbase.cached", true)
+			res.strictDecoding = opts.StrictDecoding
+			return res, nil
+		}
+	}
+
+	provider, err := c.getQueryProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	// Results which are cached, or limited in size, are read into memory before they are returned.
+	stream := cacheKey == "" && opts.MaxBufferedRows <= 0
+	res, err := c.query(ctx, span.Context(), statement, opts, provider, stream)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.query(ctx, span.Context(), statement, opts, provider)
+	if cacheKey != "" {
+		c.queryResults.set(cacheKey, res, opts.CacheFor)
+	}
+
+	res.watch = c.watchConsumer("query", res.clientContextID)
+	return res, nil
 }
 
+// queryResultCacheKey returns the key to cache the results of the query under, or an empty string if they are not
+// to be cached.
+func (c *Cluster) queryResultCacheKey(statement string, opts *QueryOptions) string {
+	if opts.CacheFor <= 0 || c.queryResults == nil {
+		return ""
+	}
+
+	queryOpts, err := opts.toMap(statement)
+	if err != nil {
+		return ""
+	}
+	return queryResultCacheKey(c.queryUser(), queryOpts)
+}
+
+// query executes statement, retrying it if it fails with a temporary error.  If stream is set the rows of the
+// results are read from the response as they are needed, see executeN1qlQuery.
 func (c *Cluster) query(ctx context.Context, traceCtx opentracing.SpanContext, statement string, opts *QueryOptions,
-	provider httpProvider) (*QueryResults, error) {
+	provider httpProvider, stream bool) (*QueryResults, error) {
 
 	queryOpts, err := opts.toMap(statement)
 	if err != nil {
 		return nil, errors.Wrap(err, "could not parse query options")
 	}
 
+	// The query service is asked to stop once it has returned more rows than can be buffered, rather than the rows
+	// being read and discarded.  One extra row is still needed to detect that the results are too large.
+	if opts.MaxBufferedRows > 0 {
+		queryOpts["statement"] = limitStatement(statement, opts.MaxBufferedRows+1)
+	}
+
 	// Work out which timeout to use, the cluster level default or query specific one
 	timeout := c.n1qlTimeout()
 	var optTimeout time.Duration
@@ -213,57 +449,170 @@ func (c *Cluster) query(ctx context.Context, traceCtx opentracing.SpanContext, s
 	queryOpts["timeout"] = timeout.String()
 
 	// Doing this will set the context deadline to whichever is shorter, what is already set or the timeout
-	// value
+	// value.  Streamed results take over cancelling the context, and stopping the progress tracker, once they have
+	// been read.
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, timeout)
-	defer cancel()
+	streamed := false
+	defer func() {
+		if !streamed {
+			cancel()
+		}
+	}()
+
+	// Always send a client context id so that a query which times out can be found in the server logs.
+	clientContextID, _ := queryOpts["client_context_id"].(string)
+	if clientContextID == "" {
+		clientContextID = c.newID()
+		queryOpts["client_context_id"] = clientContextID
+	}
+
+	progress := newQueryProgressTracker(opts.Progress, opts.ProgressInterval, cancel)
+	defer func() {
+		if !streamed {
+			progress.stop()
+		}
+	}()
+
+	start := time.Now()
+	recorder := &endpointRecordingProvider{provider: progress.wrapProvider(provider)}
+	timedOut := func(retries uint) error {
+		return queryTimeoutError{
+			elapsed:         time.Since(start),
+			attempts:        retries,
+			lastEndpoint:    recorder.lastEndpoint,
+			clientContextID: clientContextID,
+		}
+	}
 
 	var retries uint
 	var res *QueryResults
 	for {
 		retries++
+		onRow := limitRows(opts.MaxBufferedRows, progress.row)
 		if opts.Prepared {
 			etrace := opentracing.GlobalTracer().StartSpan("execute", opentracing.ChildOf(traceCtx))
-			res, err = c.doPreparedN1qlQuery(ctx, traceCtx, queryOpts, provider)
+			res, err = c.doPreparedN1qlQuery(ctx, traceCtx, queryOpts, c.preparedName(queryOpts, opts), recorder, onRow,
+				stream)
 			etrace.Finish()
 		} else {
-			res, err = c.executeN1qlQuery(ctx, traceCtx, queryOpts, provider)
+			res, err = c.executeN1qlQuery(ctx, traceCtx, queryOpts, recorder, onRow, stream)
 		}
 		if err == nil {
+			res.strictDecoding = opts.StrictDecoding
+			if res.stream != nil {
+				streamed = true
+				attempts := retries
+				res.stream.logWarnings = opts.LogWarnings
+				res.stream.release = func() {
+					progress.stop()
+					cancel()
+				}
+				res.stream.mapErr = func(err error) error {
+					if abortErr := progress.err(); abortErr != nil {
+						return abortErr
+					}
+					if IsTimeoutError(err) || ctx.Err() == context.DeadlineExceeded {
+						return timedOut(attempts)
+					}
+					return err
+				}
+			} else if opts.LogWarnings {
+				logQueryWarnings(res)
+			}
 			return res, err
 		}
 
-		if !isRetryableError(err) || c.sb.N1qlRetryBehavior == nil || !c.sb.N1qlRetryBehavior.CanRetry(retries) {
+		if abortErr := progress.err(); abortErr != nil {
+			return nil, abortErr
+		}
+
+		if errors.Cause(err) == ErrResultTooLarge {
+			return nil, ErrResultTooLarge
+		}
+
+		if IsTimeoutError(err) || isServerQueryTimeout(err) {
+			return nil, timedOut(retries)
+		}
+
+		if !IsRetryableError(err) || c.sb.N1qlRetryBehavior == nil || !c.sb.N1qlRetryBehavior.CanRetry(retries) {
 			return res, err
 		}
 
-		time.Sleep(c.sb.N1qlRetryBehavior.NextInterval(retries))
+		select {
+		case <-time.After(c.sb.N1qlRetryBehavior.NextInterval(retries)):
+		case <-ctx.Done():
+			if abortErr := progress.err(); abortErr != nil {
+				return nil, abortErr
+			}
+			if ctx.Err() == context.Canceled {
+				return nil, ctx.Err()
+			}
+			return nil, timedOut(retries)
+		}
 	}
 }
 
+// endpointRecordingProvider records the endpoint of the most recent request made through it.  It must not be
+// used concurrently.
+type endpointRecordingProvider struct {
+	provider     httpProvider
+	lastEndpoint string
+}
+
+func (p *endpointRecordingProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	resp, err := p.provider.DoHttpRequest(req)
+	if err != nil {
+		if req.Endpoint != "" {
+			p.lastEndpoint = req.Endpoint
+		}
+		return nil, err
+	}
+
+	p.lastEndpoint = resp.Endpoint
+	return resp, nil
+}
+
 func (c *Cluster) doPreparedN1qlQuery(ctx context.Context, traceCtx opentracing.SpanContext, queryOpts map[string]interface{},
-	provider httpProvider) (*QueryResults, error) {
+	name string, provider httpProvider, onRow func() error, stream bool) (*QueryResults, error) {
+
+	cacheKey := c.queryCacheKey(queryOpts)
+	statement, _ := queryOpts["statement"].(string)
 
-	stmtStr, isStr := queryOpts["statement"].(string)
-	if !isStr {
-		// return nil, ErrCliInternalError TODO
+	// The statement is replaced by the prepared statement, queryOpts are left unchanged so that the query can be
+	// retried.
+	execOpts := make(map[string]interface{}, len(queryOpts))
+	for k, v := range queryOpts {
+		execOpts[k] = v
 	}
+	delete(execOpts, "statement")
 
 	c.clusterLock.RLock()
-	cachedStmt := c.queryCache[stmtStr]
+	cachedStmt := c.queryCache[cacheKey]
 	c.clusterLock.RUnlock()
 
+	// A named statement may already have been prepared by another instance of the application, with enhanced
+	// prepared statements it can be executed by name without being prepared again.
+	shared := false
+	if cachedStmt == nil && name != "" {
+		cachedStmt = &n1qlCache{name: name}
+		shared = true
+	}
+
 	if cachedStmt != nil {
 		// Attempt to execute our cached query plan
-		delete(queryOpts, "statement")
-		queryOpts["prepared"] = cachedStmt.name
-		queryOpts["encoded_plan"] = cachedStmt.encodedPlan
+		setPreparedStatement(execOpts, cachedStmt)
 
 		etrace := opentracing.GlobalTracer().StartSpan("execute", opentracing.ChildOf(traceCtx))
 
-		results, err := c.executeN1qlQuery(ctx, etrace.Context(), queryOpts, provider)
+		results, err := c.executeN1qlQuery(ctx, etrace.Context(), execOpts, provider, onRow, stream)
 		if err == nil {
 			etrace.Finish()
+			if shared {
+				c.clusterLock.Lock()
+				c.queryCache[cacheKey] = cachedStmt
+				c.clusterLock.Unlock()
+			}
 			return results, nil
 		}
 
@@ -271,16 +620,22 @@ func (c *Cluster) doPreparedN1qlQuery(ctx context.Context, traceCtx opentracing.
 
 		// If we get error 4050, 4070 or 5000, we should attempt
 		//   to re-prepare the statement immediately before failing.
-		if !isRetryableError(err) {
+		if !IsRetryableError(err) && !isQueryErrorMatching(err, isPreparedNotFoundQueryError) {
 			return nil, err
 		}
+
+		// A rejected plan usually means that the query nodes have been upgraded, in which case the plans of the
+		// other cached statements will be rejected too.
+		if !shared && isQueryErrorMatching(err, isPlanRejectedQueryError) {
+			c.reprepareInBackground(cacheKey)
+		}
 	}
 
 	// Prepare the query
 	ptrace := opentracing.GlobalTracer().StartSpan("prepare", opentracing.ChildOf(traceCtx))
 
 	var err error
-	cachedStmt, err = c.prepareN1qlQuery(ctx, ptrace.Context(), queryOpts, provider)
+	cachedStmt, err = c.prepareN1qlQuery(ctx, ptrace.Context(), queryOpts, statement, name, provider)
 	if err != nil {
 		ptrace.Finish()
 		return nil, err
@@ -290,30 +645,43 @@ func (c *Cluster) doPreparedN1qlQuery(ctx context.Context, traceCtx opentracing.
 
 	// Save new cached statement
 	c.clusterLock.Lock()
-	c.queryCache[stmtStr] = cachedStmt
+	c.queryCache[cacheKey] = cachedStmt
 	c.clusterLock.Unlock()
 
 	// Update with new prepared data
-	delete(queryOpts, "statement")
-	queryOpts["prepared"] = cachedStmt.name
-	queryOpts["encoded_plan"] = cachedStmt.encodedPlan
+	setPreparedStatement(execOpts, cachedStmt)
 
 	etrace := opentracing.GlobalTracer().StartSpan("execute", opentracing.ChildOf(traceCtx))
 	defer etrace.Finish()
 
-	return c.executeN1qlQuery(ctx, etrace.Context(), queryOpts, provider)
+	return c.executeN1qlQuery(ctx, etrace.Context(), execOpts, provider, onRow, stream)
+}
+
+// setPreparedStatement sets the prepared statement to execute in opts.  Statements prepared by other instances
+// of the application are executed by name alone.
+func setPreparedStatement(opts map[string]interface{}, stmt *n1qlCache) {
+	opts["prepared"] = stmt.name
+	if stmt.encodedPlan != "" {
+		opts["encoded_plan"] = stmt.encodedPlan
+	} else {
+		delete(opts, "encoded_plan")
+	}
 }
 
 func (c *Cluster) prepareN1qlQuery(ctx context.Context, traceCtx opentracing.SpanContext, opts map[string]interface{},
-	provider httpProvider) (*n1qlCache, error) {
+	statement, name string, provider httpProvider) (*n1qlCache, error) {
 
 	prepOpts := make(map[string]interface{})
 	for k, v := range opts {
 		prepOpts[k] = v
 	}
-	prepOpts["statement"] = "PREPARE " + opts["statement"].(string)
+	if name != "" {
+		prepOpts["statement"] = "PREPARE `" + strings.Replace(name, "`", "``", -1) + "` FROM " + statement
+	} else {
+		prepOpts["statement"] = "PREPARE " + statement
+	}
 
-	prepRes, err := c.executeN1qlQuery(ctx, traceCtx, opts, provider)
+	prepRes, err := c.executeN1qlQuery(ctx, traceCtx, prepOpts, provider, nil, false)
 	if err != nil {
 		return nil, err
 	}
@@ -327,6 +695,7 @@ func (c *Cluster) prepareN1qlQuery(ctx context.Context, traceCtx opentracing.Spa
 	return &n1qlCache{
 		name:        preped.Name,
 		encodedPlan: preped.EncodedPlan,
+		named:       name != "",
 	}, nil
 }
 
@@ -338,9 +707,11 @@ type n1qlPrepData struct {
 // Executes the N1QL query (in opts) on the server n1qlEp.
 // This function assumes that `opts` already contains all the required
 // settings. This function will inject any additional connection or request-level
-// settings into the `opts` map.
+// settings into the `opts` map. onRow, if not nil, is called as each result row is read.  If stream is set the
+// rows are read from the response body as they are needed rather than all being read before returning, the
+// caller must then make sure that the results are read or closed.
 func (c *Cluster) executeN1qlQuery(ctx context.Context, traceCtx opentracing.SpanContext, opts map[string]interface{},
-	provider httpProvider) (*QueryResults, error) {
+	provider httpProvider, onRow func() error, stream bool) (*QueryResults, error) {
 
 	reqJSON, err := json.Marshal(opts)
 	if err != nil {
@@ -355,32 +726,86 @@ func (c *Cluster) executeN1qlQuery(ctx context.Context, traceCtx opentracing.Spa
 		Body:    reqJSON,
 	}
 
+	clientContextID, _ := opts["client_context_id"].(string)
+	c.setAttributionHeaders(req, clientContextID)
+	c.compressHTTPRequest(req)
+
 	dtrace := opentracing.GlobalTracer().StartSpan("dispatch", opentracing.ChildOf(traceCtx))
 
 	resp, err := provider.DoHttpRequest(req)
 	if err != nil {
 		dtrace.Finish()
-		if err == context.DeadlineExceeded {
+		if err == context.DeadlineExceeded || ctx.Err() == context.DeadlineExceeded {
 			return nil, timeoutError{}
-		} // TODO: test this...
+		}
+		if svcErr := serviceUnavailableError("query", err); svcErr != nil {
+			return nil, svcErr
+		}
 		return nil, errors.Wrap(err, "could not complete query http request")
 	}
 
 	dtrace.Finish()
 
+	streaming := false
+	defer func() {
+		if !streaming {
+			drainAndCloseHTTPBody(resp.Body)
+		}
+	}()
+
+	if authErr := serviceAuthError("query", resp.StatusCode); authErr != nil {
+		return nil, authErr
+	}
+
 	strace := opentracing.GlobalTracer().StartSpan("streaming", opentracing.ChildOf(traceCtx))
 
-	n1qlResp := n1qlResponse{}
-	jsonDec := json.NewDecoder(resp.Body)
-	err = jsonDec.Decode(&n1qlResp)
+	rows, err := newRowStream(resp.Body, "results")
 	if err != nil {
 		strace.Finish()
 		return nil, errors.Wrap(err, "failed to decode query response body")
 	}
 
-	err = resp.Body.Close()
-	if err != nil {
-		logDebugf("Failed to close socket (%s)", err)
+	// Rows are only streamed once the first has been read, so that errors which the query service returns before
+	// any results, and which the query can be retried after, are still returned from here.
+	var first json.RawMessage
+	if stream && resp.StatusCode == 200 {
+		first, err = rows.nextRow()
+		if err != nil {
+			strace.Finish()
+			return nil, errors.Wrap(err, "failed to decode query response body")
+		}
+	}
+
+	n1qlResp := n1qlResponse{}
+	if first != nil {
+		err = rows.decodeFields(&n1qlResp)
+		if err != nil {
+			strace.Finish()
+			return nil, errors.Wrap(err, "failed to decode query response body")
+		}
+		streaming = len(n1qlResp.Errors) == 0
+	}
+
+	if !streaming {
+		var results []json.RawMessage
+		if first != nil {
+			results = append(results, first)
+			if onRow != nil {
+				err = onRow()
+			}
+		}
+		if err == nil {
+			results, err = readStreamRows(rows, results, onRow)
+		}
+		if err == nil {
+			n1qlResp = n1qlResponse{}
+			err = rows.decodeFields(&n1qlResp)
+		}
+		if err != nil {
+			strace.Finish()
+			return nil, errors.Wrap(err, "failed to decode query response body")
+		}
+		n1qlResp.Results = results
 	}
 
 	// TODO(brett19): place the server_duration in the right place...
@@ -388,7 +813,9 @@ func (c *Cluster) executeN1qlQuery(ctx context.Context, traceCtx opentracing.Spa
 	// strace.SetTag("server_duration", srvDuration)
 
 	strace.SetTag("couchbase.operation_id", n1qlResp.RequestID)
-	strace.Finish()
+	if !streaming {
+		strace.Finish()
+	}
 
 	epInfo, err := url.Parse(resp.Endpoint)
 	if err != nil {
@@ -417,31 +844,58 @@ func (c *Cluster) executeN1qlQuery(ctx context.Context, traceCtx opentracing.Spa
 		}
 	}
 
-	elapsedTime, err := time.ParseDuration(n1qlResp.Metrics.ElapsedTime)
+	res := &QueryResults{
+		sourceAddr:      epInfo.Host,
+		requestID:       n1qlResp.RequestID,
+		clientContextID: n1qlResp.ClientContextID,
+		index:           -1,
+		rows:            n1qlResp.Results,
+		signature:       n1qlResp.Signature,
+		warnings:        n1qlResp.Warnings,
+		metrics:         n1qlResultMetrics(n1qlResp.Metrics),
+	}
+	if streaming {
+		res.stream = &queryResultStream{
+			rows:    rows,
+			body:    resp.Body,
+			ctx:     ctx,
+			span:    strace,
+			pending: first,
+			onRow:   onRow,
+		}
+	}
+
+	return res, nil
+}
+
+// n1qlResultMetrics converts the metrics returned by the query service.
+func n1qlResultMetrics(metrics n1qlResponseMetrics) QueryResultMetrics {
+	elapsedTime, err := parseServerDuration(metrics.ElapsedTime)
 	if err != nil {
 		logDebugf("Failed to parse elapsed time duration (%s)", err)
 	}
 
-	executionTime, err := time.ParseDuration(n1qlResp.Metrics.ExecutionTime)
+	executionTime, err := parseServerDuration(metrics.ExecutionTime)
 	if err != nil {
 		logDebugf("Failed to parse execution time duration (%s)", err)
 	}
 
-	return &QueryResults{
-		sourceAddr:      epInfo.Host,
-		requestID:       n1qlResp.RequestID,
-		clientContextID: n1qlResp.ClientContextID,
-		index:           -1,
-		rows:            n1qlResp.Results,
-		metrics: QueryResultMetrics{
-			ElapsedTime:   elapsedTime,
-			ExecutionTime: executionTime,
-			ResultCount:   n1qlResp.Metrics.ResultCount,
-			ResultSize:    n1qlResp.Metrics.ResultSize,
-			MutationCount: n1qlResp.Metrics.MutationCount,
-			SortCount:     n1qlResp.Metrics.SortCount,
-			ErrorCount:    n1qlResp.Metrics.ErrorCount,
-			WarningCount:  n1qlResp.Metrics.WarningCount,
-		},
-	}, nil
+	return QueryResultMetrics{
+		ElapsedTime:   elapsedTime,
+		ExecutionTime: executionTime,
+		ResultCount:   metrics.ResultCount,
+		ResultSize:    metrics.ResultSize,
+		MutationCount: metrics.MutationCount,
+		SortCount:     metrics.SortCount,
+		ErrorCount:    metrics.ErrorCount,
+		WarningCount:  metrics.WarningCount,
+	}
+}
+
+// logQueryWarnings logs the warnings returned for a query so that deprecations are noticed before an upgrade
+// causes the query to fail.
+func logQueryWarnings(res *QueryResults) {
+	for _, warning := range res.warnings {
+		logWarnf("Query request %s returned warning %d: %s", res.requestID, warning.Code, warning.Message)
+	}
 }
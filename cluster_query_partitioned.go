@@ -0,0 +1,288 @@
+package gocb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// QueryPartition holds the parameters for one partition of a partitioned query, such as the bounds of a key range.
+type QueryPartition struct {
+	PositionalParameters []interface{}
+	NamedParameters      map[string]interface{}
+}
+
+// PartitionedQueryOptions are the options available to PartitionedQuery.
+type PartitionedQueryOptions struct {
+	// QueryOptions are used for the query of every partition.  The parameters of each partition are added to
+	// any NamedParameters, and replace any PositionalParameters.
+	QueryOptions
+	// MaxConcurrency is the most partitions which are queried at once, defaulting to the number of query nodes.
+	MaxConcurrency int
+}
+
+// PartitionedQuery executes statement once for each partition, with the parameters of that partition,
+// spreading the queries across the query nodes and running them concurrently.  The rows of every partition
+// are returned together, in partition order, and are read from the responses as they are iterated rather than
+// being held in memory.  This is much faster than a single query for jobs, such as bulk exports, where the
+// statement can be split into independent pieces such as key ranges.  The query of each partition holds one of
+// the MaxConcurrency slots until its rows have been read, queries of later partitions start as slots are freed.
+// If the query of the first partition fails its error is returned, if that of any other partition fails then the
+// remaining queries are cancelled and the error is returned by Close.
+func (c *Cluster) PartitionedQuery(statement string, partitions []QueryPartition, opts *PartitionedQueryOptions) (*QueryResults, error) {
+	if opts == nil {
+		opts = &PartitionedQueryOptions{}
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
+	var span opentracing.Span
+	if parentSpanCtx == nil {
+		span = opentracing.GlobalTracer().StartSpan("ExecutePartitionedN1QLQuery",
+			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"})
+	} else {
+		span = opentracing.GlobalTracer().StartSpan("ExecutePartitionedN1QLQuery",
+			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"}, opentracing.ChildOf(parentSpanCtx))
+	}
+	defer span.Finish()
+
+	provider, err := c.getQueryProvider()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	endpoints := queryEndpoints(provider)
+	concurrency := opts.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = len(endpoints)
+		if concurrency == 0 {
+			concurrency = 1
+		}
+	}
+
+	parts := &partitionedRows{
+		cancel:  cancel,
+		limit:   make(chan struct{}, concurrency),
+		results: make([]chan partitionResult, len(partitions)),
+		current: -1,
+	}
+	for i := range partitions {
+		parts.results[i] = make(chan partitionResult, 1)
+	}
+
+	// Slots are taken in partition order so that the partitions which are read first are queried first.
+	go func() {
+		for i := range partitions {
+			select {
+			case parts.limit <- struct{}{}:
+			case <-ctx.Done():
+				parts.results[i] <- partitionResult{err: ctx.Err()}
+				continue
+			}
+
+			pieceOpts := partitionQueryOptions(opts.QueryOptions, partitions[i])
+			if opts.ClientContextID != "" {
+				pieceOpts.ClientContextID = fmt.Sprintf("%s-%d", opts.ClientContextID, i)
+			}
+
+			pieceProvider := provider
+			if len(endpoints) > 0 {
+				pieceProvider = &stickyHTTPProvider{provider: provider, endpoint: endpoints[i%len(endpoints)]}
+			}
+
+			go func(i int) {
+				// Results limited in size are read into memory before they are returned, as they are by Query.
+				stream := pieceOpts.MaxBufferedRows <= 0
+				res, err := c.query(ctx, span.Context(), statement, pieceOpts, pieceProvider, stream)
+				if err != nil {
+					parts.setErr(errors.Wrapf(err, "query of partition %d failed", i))
+					<-parts.limit
+				}
+				parts.results[i] <- partitionResult{res: res, err: err}
+			}(i)
+		}
+	}()
+
+	merged := &QueryResults{
+		index:           -1,
+		clientContextID: opts.ClientContextID,
+		partitions:      parts,
+	}
+
+	// The first partition is waited for so that errors common to every partition, such as a syntax error, are
+	// returned by PartitionedQuery itself.
+	if len(partitions) > 0 {
+		err = parts.advance()
+		if err != nil {
+			parts.close()
+			return nil, err
+		}
+		merged.signature = parts.res.signature
+		merged.strictDecoding = parts.res.strictDecoding
+	}
+
+	merged.watch = c.watchConsumer("query", merged.clientContextID)
+	return merged, nil
+}
+
+type partitionResult struct {
+	res *QueryResults
+	err error
+}
+
+// partitionedRows reads the rows of the partitions of a partitioned query, one partition after another.  The
+// query of each partition holds a slot in limit for as long as its results are open.
+type partitionedRows struct {
+	cancel  context.CancelFunc
+	limit   chan struct{}
+	results []chan partitionResult
+	// current is the index of the partition whose rows are being read, res its results.
+	current int
+	res     *QueryResults
+
+	errLock  sync.Mutex
+	firstErr error
+}
+
+// setErr records err if it is the first error of any partition, cancelling the queries of the others.  Their
+// errors are caused by the cancellation, so only the first is reported.
+func (p *partitionedRows) setErr(err error) {
+	p.errLock.Lock()
+	if p.firstErr == nil {
+		p.firstErr = err
+	}
+	p.errLock.Unlock()
+	p.cancel()
+}
+
+func (p *partitionedRows) err() error {
+	p.errLock.Lock()
+	defer p.errLock.Unlock()
+	return p.firstErr
+}
+
+// advance waits for the results of the next partition.
+func (p *partitionedRows) advance() error {
+	p.current++
+	result := <-p.results[p.current]
+	if result.err != nil {
+		if err := p.err(); err != nil {
+			return err
+		}
+		return errors.Wrapf(result.err, "query of partition %d failed", p.current)
+	}
+
+	p.res = result.res
+	return nil
+}
+
+// release closes the results of the current partition, freeing its slot for the query of a later partition.
+func (p *partitionedRows) release() error {
+	err := p.res.Close()
+	p.res = nil
+	<-p.limit
+	return err
+}
+
+// next returns the next row of the partitions, or nil once every row has been read or an error occurred, in
+// which case the error is set on merged.  The metadata of each partition is added to merged as it is read.
+func (p *partitionedRows) next(merged *QueryResults) []byte {
+	for {
+		if p.res == nil {
+			if p.current+1 >= len(p.results) {
+				p.cancel()
+				return nil
+			}
+			if err := p.advance(); err != nil {
+				merged.err = err
+				p.close()
+				return nil
+			}
+		}
+
+		row := p.res.NextBytes()
+		if row != nil {
+			return row
+		}
+
+		res := p.res
+		if err := p.release(); err != nil {
+			merged.err = errors.Wrapf(err, "query of partition %d failed", p.current)
+			if firstErr := p.err(); firstErr != nil {
+				merged.err = firstErr
+			}
+			p.close()
+			return nil
+		}
+		addPartitionMetadata(merged, res)
+	}
+}
+
+// close cancels the queries of the partitions which have not been read and closes their results.
+func (p *partitionedRows) close() {
+	p.cancel()
+	if p.res != nil {
+		p.release()
+	}
+	for p.current+1 < len(p.results) {
+		p.current++
+		result := <-p.results[p.current]
+		if result.res != nil {
+			p.res = result.res
+			p.release()
+		}
+	}
+}
+
+// partitionQueryOptions returns a copy of opts with the parameters of partition added.
+func partitionQueryOptions(opts QueryOptions, partition QueryPartition) *QueryOptions {
+	if partition.PositionalParameters != nil {
+		opts.PositionalParameters = partition.PositionalParameters
+	}
+
+	if partition.NamedParameters != nil {
+		named := make(map[string]interface{}, len(opts.NamedParameters)+len(partition.NamedParameters))
+		for name, value := range opts.NamedParameters {
+			named[name] = value
+		}
+		for name, value := range partition.NamedParameters {
+			named[name] = value
+		}
+		opts.NamedParameters = named
+	}
+
+	return &opts
+}
+
+// queryEndpoints returns the query endpoints that requests can be sent to through provider, if it exposes them.
+func queryEndpoints(provider httpProvider) []string {
+	if p, ok := provider.(interface{ N1qlEps() []string }); ok {
+		return p.N1qlEps()
+	}
+	return nil
+}
+
+// addPartitionMetadata adds the warnings and metrics of the results of a partition to merged.
+func addPartitionMetadata(merged *QueryResults, res *QueryResults) {
+	merged.warnings = append(merged.warnings, res.warnings...)
+
+	if res.metrics.ElapsedTime > merged.metrics.ElapsedTime {
+		merged.metrics.ElapsedTime = res.metrics.ElapsedTime
+	}
+	merged.metrics.ExecutionTime += res.metrics.ExecutionTime
+	merged.metrics.ResultCount += res.metrics.ResultCount
+	merged.metrics.ResultSize += res.metrics.ResultSize
+	merged.metrics.MutationCount += res.metrics.MutationCount
+	merged.metrics.SortCount += res.metrics.SortCount
+	merged.metrics.ErrorCount += res.metrics.ErrorCount
+	merged.metrics.WarningCount += res.metrics.WarningCount
+}
@@ -0,0 +1,159 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type endpointsHTTPProvider struct {
+	*mockHTTPProvider
+	eps []string
+}
+
+func (p *endpointsHTTPProvider) N1qlEps() []string {
+	return p.eps
+}
+
+func TestPartitionedQuery(t *testing.T) {
+	var lock sync.Mutex
+	endpoints := make(map[string]string)
+	provider := &endpointsHTTPProvider{
+		eps: []string{"http://node1:8093", "http://node2:8093"},
+		mockHTTPProvider: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				var body map[string]interface{}
+				if err := json.Unmarshal(req.Body, &body); err != nil {
+					return nil, err
+				}
+				args := body["args"].([]interface{})
+				start := args[0].(string)
+
+				lock.Lock()
+				endpoints[start] = req.Endpoint
+				lock.Unlock()
+
+				resp := fmt.Sprintf(`{"requestID":"r","results":[{"id":"%s1"},{"id":"%s2"}],"status":"success",`+
+					`"metrics":{"elapsedTime":"1ms","executionTime":"1ms","resultCount":2,"resultSize":20}}`, start, start)
+				return &gocbcore.HttpResponse{
+					Endpoint:   req.Endpoint,
+					StatusCode: 200,
+					Body:       &testReadCloser{bytes.NewBufferString(resp), nil},
+				}, nil
+			},
+		},
+	}
+
+	cluster := testGetClusterForHTTP(nil, time.Second, 0, 0)
+	cluster.connections["mock-false"].(*mockClient).mockHTTPProvider = provider
+
+	partitions := []QueryPartition{
+		{PositionalParameters: []interface{}{"a", "m"}},
+		{PositionalParameters: []interface{}{"m", "t"}},
+		{PositionalParameters: []interface{}{"t", "z"}},
+	}
+	res, err := cluster.PartitionedQuery("SELECT META().id FROM default WHERE META().id >= $1 AND META().id < $2",
+		partitions, nil)
+	if err != nil {
+		t.Fatalf("Expected partitioned query to succeed but error was %v", err)
+	}
+
+	var ids []string
+	var row struct {
+		ID string `json:"id"`
+	}
+	for res.Next(&row) {
+		ids = append(ids, row.ID)
+	}
+	if err := res.Close(); err != nil {
+		t.Fatalf("Expected results to close but error was %v", err)
+	}
+
+	expected := []string{"a1", "a2", "m1", "m2", "t1", "t2"}
+	if fmt.Sprint(ids) != fmt.Sprint(expected) {
+		t.Fatalf("Expected rows %v but had %v", expected, ids)
+	}
+	if res.Metrics().ResultCount != 6 {
+		t.Fatalf("Expected merged result count of 6 but was %d", res.Metrics().ResultCount)
+	}
+
+	if endpoints["a"] != "http://node1:8093" || endpoints["m"] != "http://node2:8093" || endpoints["t"] != "http://node1:8093" {
+		t.Fatalf("Expected partitions to be spread across query nodes but were %v", endpoints)
+	}
+}
+
+func TestPartitionedQueryStreamsPartitions(t *testing.T) {
+	var lock sync.Mutex
+	var started []string
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			var body map[string]interface{}
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				return nil, err
+			}
+			start := body["args"].([]interface{})[0].(string)
+
+			lock.Lock()
+			started = append(started, start)
+			lock.Unlock()
+
+			if start == "t" {
+				return &gocbcore.HttpResponse{
+					Endpoint:   req.Endpoint,
+					StatusCode: 500,
+					Body: &testReadCloser{
+						bytes.NewBufferString(`{"errors":[{"code":5000,"msg":"internal error"}],"status":"errors"}`), nil},
+				}, nil
+			}
+
+			resp := fmt.Sprintf(`{"requestID":"r","results":[{"id":"%s1"},{"id":"%s2"}],"status":"success"}`,
+				start, start)
+			return &gocbcore.HttpResponse{
+				Endpoint:   req.Endpoint,
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(resp), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, time.Second, 0, 0)
+
+	partitions := []QueryPartition{
+		{PositionalParameters: []interface{}{"a"}},
+		{PositionalParameters: []interface{}{"m"}},
+		{PositionalParameters: []interface{}{"t"}},
+	}
+	res, err := cluster.PartitionedQuery("SELECT META().id FROM default WHERE META().id >= $1", partitions,
+		&PartitionedQueryOptions{MaxConcurrency: 1})
+	if err != nil {
+		t.Fatalf("Expected partitioned query to succeed but error was %v", err)
+	}
+
+	var row struct {
+		ID string `json:"id"`
+	}
+	if !res.Next(&row) || row.ID != "a1" {
+		t.Fatalf("Expected first row of the first partition but had %v, %v", row, res.Err())
+	}
+	lock.Lock()
+	if len(started) != 1 {
+		t.Fatalf("Expected only the first partition to be queried before its rows were read but were %v", started)
+	}
+	lock.Unlock()
+
+	var ids []string
+	for res.Next(&row) {
+		ids = append(ids, row.ID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint([]string{"a2", "m1", "m2"}) {
+		t.Fatalf("Expected rows of the first two partitions but had %v", ids)
+	}
+	if err := res.Close(); err == nil || !strings.Contains(err.Error(), "partition 2") {
+		t.Fatalf("Expected the error of the third partition but was %v", err)
+	}
+}
@@ -2,13 +2,20 @@ package gocb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
@@ -40,8 +47,12 @@ func TestBasicQuery(t *testing.T) {
 			t.Fatalf("Failed to unmarshal request body %v", err)
 		}
 
-		if len(opts) != 3 {
-			t.Fatalf("Expected request body to contain 3 options but was %d, %v", len(opts), opts)
+		if len(opts) != 4 {
+			t.Fatalf("Expected request body to contain 4 options but was %d, %v", len(opts), opts)
+		}
+
+		if contextID, ok := opts["client_context_id"].(string); !ok || contextID == "" {
+			t.Fatalf("Request query options missing client_context_id")
 		}
 
 		optsStatement, ok := opts["statement"]
@@ -180,6 +191,386 @@ func TestQueryError(t *testing.T) {
 	}
 }
 
+func TestQueryResultsOneDiscardsRemainingRows(t *testing.T) {
+	res := &QueryResults{
+		index: -1,
+		rows:  []json.RawMessage{json.RawMessage(`{"name":"first"}`), json.RawMessage(`{"name":"second"}`)},
+	}
+
+	var doc testBreweryDocument
+	err := res.One(&doc)
+	if err != nil {
+		t.Fatalf("Expected One to succeed but was %v", err)
+	}
+
+	if doc.Name != "first" {
+		t.Fatalf("Expected first row to be returned but was %v", doc)
+	}
+
+	if res.rows != nil {
+		t.Fatalf("Expected remaining rows to have been released")
+	}
+
+	if res.Next(&doc) {
+		t.Fatalf("Expected no further rows after One")
+	}
+}
+
+func TestQueryOneAbortsStreamedResponse(t *testing.T) {
+	rows := make([]string, 20000)
+	for i := range rows {
+		rows[i] = `{"name":"brewery","description":"a row which One does not need to read"}`
+	}
+	body := `{"requestID":"r","results":[` + strings.Join(rows, ",") + `],"status":"success"}`
+
+	respBody := &testBufferReadCloser{Buffer: bytes.NewBufferString(body)}
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       respBody,
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	res, err := cluster.Query("SELECT * FROM breweries", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but was %v", err)
+	}
+
+	var doc testBreweryDocument
+	err = res.One(&doc)
+	if err != nil || doc.Name != "brewery" {
+		t.Fatalf("Expected One to return the first row but was %v, %v", doc, err)
+	}
+
+	if !respBody.closed {
+		t.Fatalf("Expected response body to have been closed")
+	}
+	if respBody.Len() < len(body)-64*1024 {
+		t.Fatalf("Expected the rest of the response to be aborted but %d of %d bytes were read",
+			len(body)-respBody.Len(), len(body))
+	}
+}
+
+// testHTTPConnectionCounter returns a provider which sends requests to an httptest server responding with each of
+// bodies in turn, along with a function which returns the number of requests and of connections opened.
+func testHTTPConnectionCounter(t *testing.T, bodies [][]byte) (*mockHTTPProvider, func() (int, int)) {
+	var lock sync.Mutex
+	var newConns int
+	var requests int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		body := bodies[requests%len(bodies)]
+		requests++
+		lock.Unlock()
+
+		w.Write(body)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			lock.Lock()
+			newConns++
+			lock.Unlock()
+		}
+	}
+	server.Start()
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			httpReq, err := http.NewRequest(req.Method, server.URL+req.Path, bytes.NewReader(req.Body))
+			if err != nil {
+				return nil, err
+			}
+
+			resp, err := client.Do(httpReq.WithContext(req.Context))
+			if err != nil {
+				return nil, err
+			}
+
+			return &gocbcore.HttpResponse{
+				Endpoint:   server.URL,
+				StatusCode: resp.StatusCode,
+				Body:       resp.Body,
+			}, nil
+		},
+	}
+
+	return provider, func() (int, int) {
+		lock.Lock()
+		defer lock.Unlock()
+		return requests, newConns
+	}
+}
+
+func TestServicesReuseHTTPConnections(t *testing.T) {
+	dataBytes, err := loadRawTestDataset("beer_sample_query_dataset")
+	if err != nil {
+		t.Fatalf("Could not read test dataset: %v", err)
+	}
+
+	rows := make([]string, 1000)
+	hits := make([]string, 1000)
+	for i := range rows {
+		rows[i] = `{"name":"brewery","description":"a row which is not read before the results are closed"}`
+		hits[i] = `{"id":"brewery","score":1}`
+	}
+	padding := bytes.Repeat([]byte("\n"), 64*1024)
+	invalid := []byte("{\"requestID\": \"not valid json")
+
+	// Each response has data left unread once the results are closed, which must be drained for the
+	// connection to be reused.
+	tests := []struct {
+		name   string
+		bodies [][]byte
+		run    func(provider *mockHTTPProvider)
+	}{
+		{
+			name: "query",
+			bodies: [][]byte{
+				append(dataBytes, padding...),
+				invalid,
+				[]byte(`{"requestID":"r","results":[` + strings.Join(rows, ",") + `],"status":"success"}`),
+			},
+			run: func(provider *mockHTTPProvider) {
+				res, err := testGetClusterForHTTP(provider, 60*time.Second, 0, 0).Query("SELECT 1=1", nil)
+				if err == nil {
+					_ = res.Close()
+				}
+			},
+		},
+		{
+			name: "analytics",
+			bodies: [][]byte{
+				append([]byte(`{"requestID":"r","results":[],"status":"success"}`), padding...),
+				invalid,
+				[]byte(`{"requestID":"r","results":[` + strings.Join(rows, ",") + `],"status":"success"}`),
+			},
+			run: func(provider *mockHTTPProvider) {
+				res, err := testGetClusterForHTTP(provider, 0, 60*time.Second, 0).AnalyticsQuery("SELECT 1=1", nil)
+				if err == nil {
+					_ = res.Close()
+				}
+			},
+		},
+		{
+			name: "search",
+			bodies: [][]byte{
+				append([]byte(`{"status":{"total":1,"successful":1},"hits":[],"total_hits":0}`), padding...),
+				invalid,
+				[]byte(`{"status":{"total":1,"successful":1},"hits":[` + strings.Join(hits, ",") +
+					`],"total_hits":1000}`),
+			},
+			run: func(provider *mockHTTPProvider) {
+				query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+				cluster := testGetClusterForHTTP(provider, 0, 0, 60*time.Second)
+				res, err := cluster.SearchQuery(query, &SearchQueryOptions{StreamHits: true})
+				if err == nil {
+					_ = res.Close()
+				}
+			},
+		},
+		{
+			name: "view",
+			bodies: [][]byte{
+				append([]byte(`{"total_rows":0,"rows":[]}`), padding...),
+				invalid,
+			},
+			run: func(provider *mockHTTPProvider) {
+				res, err := testGetBucketForHTTP(provider).ViewQuery("beers", "by_name", nil)
+				if err == nil {
+					_ = res.Close()
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			provider, counts := testHTTPConnectionCounter(t, test.bodies)
+			for range test.bodies {
+				test.run(provider)
+			}
+
+			requests, newConns := counts()
+			if requests != len(test.bodies) {
+				t.Fatalf("Expected %d requests but there were %d", len(test.bodies), requests)
+			}
+			if newConns != 1 {
+				t.Fatalf("Expected the connection to be reused for every request but %d were opened", newConns)
+			}
+		})
+	}
+}
+
+func TestAttributionHeaders(t *testing.T) {
+	dataBytes, err := loadRawTestDataset("beer_sample_query_dataset")
+	if err != nil {
+		t.Fatalf("Could not read test dataset: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		resp []byte
+		run  func(cluster *Cluster) error
+		// bodyField is the field of the request body which also carries the client context id, if any.
+		bodyField string
+	}{
+		{
+			name: "query",
+			resp: dataBytes,
+			run: func(cluster *Cluster) error {
+				_, err := cluster.Query("SELECT 1=1", &QueryOptions{ClientContextID: "beer-context"})
+				return err
+			},
+			bodyField: "client_context_id",
+		},
+		{
+			name: "analytics",
+			resp: []byte(`{"requestID":"r","results":[],"status":"success"}`),
+			run: func(cluster *Cluster) error {
+				_, err := cluster.AnalyticsQuery("SELECT 1=1", &AnalyticsQueryOptions{ContextID: "beer-context"})
+				return err
+			},
+			bodyField: "client_context_id",
+		},
+		{
+			name: "search",
+			resp: []byte(`{"status":{"total":1,"successful":1},"hits":[],"total_hits":0}`),
+			run: func(cluster *Cluster) error {
+				query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+				_, err := cluster.SearchQuery(query, &SearchQueryOptions{ClientContextID: "beer-context"})
+				return err
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var headers map[string]string
+			var body map[string]interface{}
+			provider := &mockHTTPProvider{
+				doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+					headers = req.Headers
+					err := json.Unmarshal(req.Body, &body)
+					if err != nil {
+						t.Fatalf("Failed to unmarshal request body: %v", err)
+					}
+
+					return &gocbcore.HttpResponse{
+						Endpoint:   "http://localhost:8093",
+						StatusCode: 200,
+						Body:       &testReadCloser{bytes.NewBuffer(test.resp), nil},
+					}, nil
+				},
+			}
+
+			cluster := testGetClusterForHTTP(provider, 60*time.Second, 60*time.Second, 60*time.Second)
+			cluster.ssb.applicationName = "beer-app"
+
+			err := test.run(cluster)
+			if err != nil {
+				t.Fatalf("Expected request to succeed but was %v", err)
+			}
+
+			if headers[applicationNameHeader] != "beer-app" {
+				t.Fatalf("Expected application name header to be beer-app but was %s", headers[applicationNameHeader])
+			}
+
+			if headers[clientContextIDHeader] != "beer-context" {
+				t.Fatalf("Expected client context id header to be beer-context but was %s",
+					headers[clientContextIDHeader])
+			}
+
+			if test.bodyField != "" && body[test.bodyField] != "beer-context" {
+				t.Fatalf("Expected client context id in body to be beer-context but was %v", body[test.bodyField])
+			}
+		})
+	}
+}
+
+func TestQueryIDGenerator(t *testing.T) {
+	dataBytes, err := loadRawTestDataset("beer_sample_query_dataset")
+	if err != nil {
+		t.Fatalf("Could not read test dataset: %v", err)
+	}
+
+	var headers map[string]string
+	var body map[string]interface{}
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			headers = req.Headers
+			err := json.Unmarshal(req.Body, &body)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal request body: %v", err)
+			}
+
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBuffer(dataBytes), nil},
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	var generated int
+	cluster.ssb.idGenerator = func() string {
+		generated++
+		return fmt.Sprintf("trace-%d", generated)
+	}
+
+	_, err = cluster.Query("SELECT 1=1", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but was %v", err)
+	}
+
+	if body["client_context_id"] != "trace-1" {
+		t.Fatalf("Expected client context id in body to be trace-1 but was %v", body["client_context_id"])
+	}
+
+	if headers[clientContextIDHeader] != "trace-1" {
+		t.Fatalf("Expected client context id header to be trace-1 but was %s", headers[clientContextIDHeader])
+	}
+
+	_, err = cluster.Query("SELECT 1=1", &QueryOptions{ClientContextID: "beer-context"})
+	if err != nil {
+		t.Fatalf("Expected query to succeed but was %v", err)
+	}
+
+	if body["client_context_id"] != "beer-context" {
+		t.Fatalf("Expected client context id in body to be beer-context but was %v", body["client_context_id"])
+	}
+
+	if generated != 1 {
+		t.Fatalf("Expected the generator to be called once but was called %d times", generated)
+	}
+
+	cluster.ssb.idGenerator = func() string { return "" }
+	if cluster.newID() == "" {
+		t.Fatalf("Expected a uuid to be used when the generator returns an empty id")
+	}
+}
+
+func TestDrainAndCloseHTTPBodyAbortsLargeBodies(t *testing.T) {
+	respBody := &testBufferReadCloser{Buffer: bytes.NewBuffer(make([]byte, maxHTTPBodyDrainBytes*2))}
+
+	drainAndCloseHTTPBody(respBody)
+
+	if !respBody.closed {
+		t.Fatalf("Expected response body to have been closed")
+	}
+
+	remaining := respBody.Len()
+	if remaining != maxHTTPBodyDrainBytes {
+		t.Fatalf("Expected %d bytes to be left unread but was %d", maxHTTPBodyDrainBytes, remaining)
+	}
+}
+
 func testAssertQueryRequest(t *testing.T, req *gocbcore.HttpRequest) {
 	if req.Service != gocbcore.N1qlService {
 		t.Fatalf("Service should have been N1qlService but was %d", req.Service)
@@ -304,3 +695,353 @@ func testGetClusterForHTTP(provider *mockHTTPProvider, n1qlTimeout, analyticsTim
 
 	return c
 }
+
+func TestClusterBucketRecreatedResetsQueryCache(t *testing.T) {
+	var recreated string
+	cluster := &Cluster{
+		queryCache: map[n1qlCacheKey]*n1qlCache{
+			{statement: "SELECT 1=1"}:                                      {name: "p1"},
+			{statement: "SELECT 1=1", queryContext: "default:`default`"}:   {name: "p2"},
+			{statement: "SELECT 1=1", queryContext: "default:`other`.`s`"}: {name: "p3"},
+		},
+		onBucketRecreated: func(bucketName string) {
+			recreated = bucketName
+		},
+	}
+
+	cluster.bucketRecreated("default")
+
+	if len(cluster.queryCache) != 1 {
+		t.Fatalf("Expected query cache to have 1 entry but had %d entries", len(cluster.queryCache))
+	}
+	if _, ok := cluster.queryCache[n1qlCacheKey{statement: "SELECT 1=1", queryContext: "default:`other`.`s`"}]; !ok {
+		t.Fatalf("Expected statement prepared against another bucket to remain cached")
+	}
+
+	if recreated != "default" {
+		t.Fatalf("Expected bucket recreated handler to be called with default but was %s", recreated)
+	}
+}
+
+func TestPreparedQueryCacheKeyedByContextAndUser(t *testing.T) {
+	requests := 0
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			requests++
+			return &gocbcore.HttpResponse{
+				StatusCode: 200,
+				Body: &testReadCloser{bytes.NewBufferString(`{"results":[{"name":"p","encoded_plan":"plan"}],` +
+					`"status":"success"}`), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, time.Second, 0, 0)
+	cluster.queryCache = make(map[n1qlCacheKey]*n1qlCache)
+	cluster.auth = PasswordAuthenticator{Username: "alice", Password: "password"}
+
+	runQuery := func(queryContext string, expectedRequests int) {
+		requests = 0
+		res, err := cluster.Query("SELECT * FROM airline", &QueryOptions{Prepared: true, QueryContext: queryContext})
+		if err != nil {
+			t.Fatalf("Expected query to succeed but error was %v", err)
+		}
+		res.Close()
+		if requests != expectedRequests {
+			t.Fatalf("Expected %d requests for query context %s but were %d", expectedRequests, queryContext,
+				requests)
+		}
+	}
+
+	// Prepare and execute, then execute from the cache.
+	runQuery("default:`travel-sample`", 2)
+	runQuery("default:`travel-sample`", 1)
+	// The same statement in another query context is prepared again.
+	runQuery("default:`beer-sample`", 2)
+
+	cluster.auth = PasswordAuthenticator{Username: "bob", Password: "password"}
+	runQuery("default:`travel-sample`", 2)
+
+	if len(cluster.queryCache) != 3 {
+		t.Fatalf("Expected 3 cached statements but had %d", len(cluster.queryCache))
+	}
+}
+
+func TestPreparedQueryName(t *testing.T) {
+	var bodies []map[string]interface{}
+	peerPrepared := false
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			var body map[string]interface{}
+			err := json.Unmarshal(req.Body, &body)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal request body: %v", err)
+			}
+			bodies = append(bodies, body)
+
+			if statement, ok := body["statement"].(string); ok && strings.HasPrefix(statement, "PREPARE") {
+				peerPrepared = true
+				return &gocbcore.HttpResponse{
+					StatusCode: 200,
+					Body: &testReadCloser{bytes.NewBufferString(`{"results":[{"name":"beers","encoded_plan":"plan"}],` +
+						`"status":"success"}`), nil},
+				}, nil
+			}
+			if !peerPrepared {
+				return &gocbcore.HttpResponse{
+					StatusCode: 404,
+					Body: &testReadCloser{bytes.NewBufferString(`{"errors":[{"code":4040,"msg":"No such prepared statement: beers"}],` +
+						`"status":"errors"}`), nil},
+				}, nil
+			}
+			return &gocbcore.HttpResponse{
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(`{"results":[{"a":1}],"status":"success"}`), nil},
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, time.Second, 0, 0)
+	cluster.queryCache = make(map[n1qlCacheKey]*n1qlCache)
+
+	res, err := cluster.Query("SELECT * FROM beers", &QueryOptions{Prepared: true, PreparedName: "beers"})
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	res.Close()
+
+	if len(bodies) != 3 {
+		t.Fatalf("Expected the statement to be executed by name, prepared and executed but requests were %v", bodies)
+	}
+	if bodies[0]["prepared"] != "beers" || bodies[0]["encoded_plan"] != nil || bodies[0]["statement"] != nil {
+		t.Fatalf("Expected the statement to first be executed by name but request was %v", bodies[0])
+	}
+	if bodies[1]["statement"] != "PREPARE `beers` FROM SELECT * FROM beers" {
+		t.Fatalf("Expected the statement to be prepared with its name but request was %v", bodies[1])
+	}
+	if bodies[2]["prepared"] != "beers" || bodies[2]["encoded_plan"] != "plan" {
+		t.Fatalf("Expected the prepared statement to be executed but request was %v", bodies[2])
+	}
+
+	// A peer finds the statement already prepared and executes it by name.
+	bodies = nil
+	peer := testGetClusterForHTTP(provider, time.Second, 0, 0)
+	peer.queryCache = make(map[n1qlCacheKey]*n1qlCache)
+	peer.ssb.preparedNamePrefix = "beer-app-"
+
+	name := peer.preparedName(map[string]interface{}{"statement": "SELECT * FROM beers"}, &QueryOptions{})
+	if !strings.HasPrefix(name, "beer-app-") || len(name) <= len("beer-app-") {
+		t.Fatalf("Expected name to be derived from the prefix but was %s", name)
+	}
+	otherContext := peer.preparedName(map[string]interface{}{"statement": "SELECT * FROM beers",
+		"query_context": "default:`beer-sample`"}, &QueryOptions{})
+	if otherContext == name {
+		t.Fatalf("Expected names to differ between query contexts")
+	}
+
+	res, err = peer.Query("SELECT * FROM beers", &QueryOptions{Prepared: true, PreparedName: "beers"})
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	res.Close()
+
+	if len(bodies) != 1 || bodies[0]["prepared"] != "beers" {
+		t.Fatalf("Expected the statement to be executed by name once but requests were %v", bodies)
+	}
+	if len(peer.queryCache) != 1 {
+		t.Fatalf("Expected the shared statement to be cached but cache had %d entries", len(peer.queryCache))
+	}
+}
+
+func TestQueryContextBucket(t *testing.T) {
+	contexts := map[string]string{
+		"default:`travel-sample`":             "travel-sample",
+		"default:`travel-sample`.`inventory`": "travel-sample",
+		"default:beer.scope":                  "beer",
+		"default:beer":                        "beer",
+		"":                                    "",
+	}
+	for queryContext, expected := range contexts {
+		if bucket := queryContextBucket(queryContext); bucket != expected {
+			t.Fatalf("Expected bucket of %s to be %s but was %s", queryContext, expected, bucket)
+		}
+	}
+}
+
+func TestQueryTimeoutErrorDetails(t *testing.T) {
+	attempts := 0
+	doHTTP := func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+		attempts++
+		if attempts == 1 {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 500,
+				Body: &testReadCloser{
+					bytes.NewBufferString(`{"errors":[{"code":5000,"msg":"internal error"}],"status":"errors"}`), nil},
+			}, nil
+		}
+
+		return nil, context.DeadlineExceeded
+	}
+
+	provider := &mockHTTPProvider{
+		doFn: doHTTP,
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	cluster.sb.N1qlRetryBehavior = StandardDelayRetryBehavior(3, 1, time.Millisecond, LinearDelayFunction)
+
+	_, err := cluster.Query("SELECT 1=1", &QueryOptions{ClientContextID: "my-context"})
+	if err == nil {
+		t.Fatal("Expected query to return error")
+	}
+
+	if !IsTimeoutError(err) {
+		t.Fatalf("Expected error to be a timeout but was %v", err)
+	}
+
+	timeoutErr, ok := err.(QueryTimeoutError)
+	if !ok {
+		t.Fatalf("Expected error to be QueryTimeoutError but was %s", reflect.TypeOf(err).String())
+	}
+
+	if timeoutErr.Attempts() != 2 {
+		t.Fatalf("Expected 2 attempts but was %d", timeoutErr.Attempts())
+	}
+
+	if timeoutErr.LastEndpoint() != "http://localhost:8093" {
+		t.Fatalf("Expected last endpoint to be http://localhost:8093 but was %s", timeoutErr.LastEndpoint())
+	}
+
+	if timeoutErr.ClientContextID() != "my-context" {
+		t.Fatalf("Expected client context id to be my-context but was %s", timeoutErr.ClientContextID())
+	}
+
+	if timeoutErr.Elapsed() <= 0 {
+		t.Fatalf("Expected elapsed time to be recorded")
+	}
+}
+
+func TestQueryCancelledDuringRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			cancel()
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 500,
+				Body: &testReadCloser{
+					bytes.NewBufferString(`{"errors":[{"code":5000,"msg":"internal error"}],"status":"errors"}`), nil},
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	cluster.sb.N1qlRetryBehavior = StandardDelayRetryBehavior(3, 1, time.Minute, LinearDelayFunction)
+
+	_, err := cluster.Query("SELECT 1=1", &QueryOptions{Context: ctx})
+	if err != context.Canceled {
+		t.Fatalf("Expected query to fail with context cancelled but was %v", err)
+	}
+}
+
+func TestQueryServiceAccessErrors(t *testing.T) {
+	var status int
+	var doErr error
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			if doErr != nil {
+				return nil, doErr
+			}
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: status,
+				Body:       &testReadCloser{bytes.NewBufferString(`{"errors":[{"code":13014,"msg":"User does not have credentials"}]}`), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 10*time.Second, 10*time.Second, 0)
+
+	status = 403
+	_, err := cluster.Query("SELECT 1", nil)
+	if errors.Cause(err) != ErrAuthenticationFailure || !strings.Contains(err.Error(), "query service") {
+		t.Fatalf("Expected an authentication failure naming the query service but was %v", err)
+	}
+
+	status = 401
+	_, err = cluster.AnalyticsQuery("SELECT 1", nil)
+	if errors.Cause(err) != ErrAuthenticationFailure || !strings.Contains(err.Error(), "analytics service") {
+		t.Fatalf("Expected an authentication failure naming the analytics service but was %v", err)
+	}
+
+	doErr = gocbcore.ErrNoN1qlService
+	_, err = cluster.Query("SELECT 1", nil)
+	if !IsServiceNotFoundError(err) || !strings.Contains(err.Error(), "query service") {
+		t.Fatalf("Expected service not available naming the query service but was %v", err)
+	}
+}
+
+// recordingLogger records the messages logged at the warn level.
+type recordingLogger struct {
+	lock     sync.Mutex
+	messages []string
+}
+
+func (l *recordingLogger) Log(level LogLevel, offset int, format string, v ...interface{}) error {
+	if level != LogWarn {
+		return nil
+	}
+	l.lock.Lock()
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+	l.lock.Unlock()
+	return nil
+}
+
+func TestQueryWarnings(t *testing.T) {
+	body := `{"requestID":"req-1","results":[{"a":1}],"status":"success",` +
+		`"warnings":[{"code":4100,"msg":"The syntax is deprecated"}],"metrics":{"warningCount":1}}`
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(body), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+
+	logger := &recordingLogger{}
+	oldLogger := globalLogger
+	globalLogger = logger
+	defer func() {
+		globalLogger = oldLogger
+	}()
+
+	res, err := cluster.Query("SELECT 1=1", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but was %v", err)
+	}
+	if len(logger.messages) != 0 {
+		t.Fatalf("Expected warnings not to be logged by default but logged %v", logger.messages)
+	}
+	err = res.Close()
+	if err != nil {
+		t.Fatalf("Expected close to succeed but was %v", err)
+	}
+
+	warnings := res.Warnings()
+	if len(warnings) != 1 || warnings[0].Code != 4100 || warnings[0].Message != "The syntax is deprecated" {
+		t.Fatalf("Expected warning to be parsed but was %v", warnings)
+	}
+
+	res, err = cluster.Query("SELECT 1=1", &QueryOptions{LogWarnings: true})
+	if err != nil {
+		t.Fatalf("Expected query to succeed but was %v", err)
+	}
+	// The warnings follow the rows in the response so are logged once the rows have been read.
+	for res.NextBytes() != nil {
+	}
+	if len(logger.messages) != 1 || !strings.Contains(logger.messages[0], "4100: The syntax is deprecated") {
+		t.Fatalf("Expected warning to be logged but logged %v", logger.messages)
+	}
+}
@@ -1,13 +1,34 @@
 package gocb
 
 import (
-	"strings"
+	"context"
+	"encoding/json"
 	"time"
+
+	"github.com/opentracing/opentracing-go"
 )
 
 // QueryIndexManager provides methods for performing Couchbase N1ql index management.
 type QueryIndexManager struct {
 	ExecuteQuery func(statement string, opts *QueryOptions) (*QueryResults, error)
+
+	ctx     context.Context
+	timeout time.Duration
+}
+
+// WithContext returns a copy of the manager whose operations are cancelled once ctx is done.
+func (qm *QueryIndexManager) WithContext(ctx context.Context) *QueryIndexManager {
+	newM := *qm
+	newM.ctx = ctx
+	return &newM
+}
+
+// WithTimeout returns a copy of the manager whose queries time out after timeout, rather than after
+// ClusterOptions.ManagementTimeout or, if that is not set, the query timeout.
+func (qm *QueryIndexManager) WithTimeout(timeout time.Duration) *QueryIndexManager {
+	newM := *qm
+	newM.timeout = timeout
+	return &newM
 }
 
 // IndexInfo represents a Couchbase GSI index.
@@ -21,7 +42,84 @@ type IndexInfo struct {
 	IndexKey  []string  `json:"index_key"`
 }
 
-func (qm *QueryIndexManager) createIndex(bucketName, indexName string, fields []string, ignoreIfExists, deferred bool) error {
+// IndexAdvice represents the index advice returned by the query service for a statement.
+type IndexAdvice struct {
+	// CurrentIndexes are the indexes that the statement would currently be planned against.
+	CurrentIndexes []AdvisedIndex
+	// RecommendedIndexes are indexes which the query service recommends creating for the statement.
+	RecommendedIndexes []AdvisedIndex
+	// RecommendedCoveringIndexes are covering indexes which the query service recommends creating for the statement.
+	RecommendedCoveringIndexes []AdvisedIndex
+}
+
+// AdvisedIndex represents a single index within IndexAdvice.
+type AdvisedIndex struct {
+	// Statement is the DDL statement used to create the index.
+	Statement string `json:"index_statement"`
+	// KeyspaceAlias is the alias of the keyspace that the index applies to.
+	KeyspaceAlias string `json:"keyspace_alias"`
+}
+
+type adviseIndexRow struct {
+	Advice struct {
+		AdviseInfo struct {
+			CurrentIndexes     []AdvisedIndex  `json:"current_indexes"`
+			RecommendedIndexes json.RawMessage `json:"recommended_indexes"`
+		} `json:"adviseinfo"`
+	} `json:"advice"`
+}
+
+type adviseRecommendedIndexes struct {
+	Indexes         []AdvisedIndex `json:"indexes"`
+	CoveringIndexes []AdvisedIndex `json:"covering_indexes"`
+}
+
+// AdviseIndex asks the query service for index advice for the given statement.
+func (qm *QueryIndexManager) AdviseIndex(statement string) (*IndexAdvice, error) {
+	span := startManagerTrace("query", "advise_index", "n1ql")
+	defer span.Finish()
+
+	rows, err := qm.executeQuery(span.Context(), "ADVISE "+statement)
+	if err != nil {
+		return nil, err
+	}
+
+	var row adviseIndexRow
+	err = rows.One(&row)
+	if err != nil {
+		return nil, err
+	}
+
+	info := row.Advice.AdviseInfo
+	advice := &IndexAdvice{
+		CurrentIndexes: info.CurrentIndexes,
+	}
+
+	// When the service has nothing to recommend it sends a message string rather than an object.
+	if len(info.RecommendedIndexes) > 0 && info.RecommendedIndexes[0] == '{' {
+		var recommended adviseRecommendedIndexes
+		err = json.Unmarshal(info.RecommendedIndexes, &recommended)
+		if err != nil {
+			return nil, err
+		}
+
+		advice.RecommendedIndexes = recommended.Indexes
+		advice.RecommendedCoveringIndexes = recommended.CoveringIndexes
+	}
+
+	return advice, nil
+}
+
+// executeQuery executes statement with its span as a child of traceCtx.
+func (qm *QueryIndexManager) executeQuery(traceCtx opentracing.SpanContext, statement string) (*QueryResults, error) {
+	return qm.ExecuteQuery(statement, &QueryOptions{
+		ParentSpanContext: traceCtx,
+		Context:           qm.ctx,
+		Timeout:           qm.timeout,
+	})
+}
+
+func (qm *QueryIndexManager) createIndex(traceCtx opentracing.SpanContext, bucketName, indexName string, fields []string, ignoreIfExists, deferred bool) error {
 	var qs string
 
 	if len(fields) == 0 {
@@ -47,9 +145,9 @@ func (qm *QueryIndexManager) createIndex(bucketName, indexName string, fields []
 		qs += " WITH {\"defer_build\": true}"
 	}
 
-	rows, err := qm.ExecuteQuery(qs, nil)
+	rows, err := qm.executeQuery(traceCtx, qs)
 	if err != nil {
-		if strings.Contains(err.Error(), "already exist") {
+		if isQueryErrorMatching(err, isIndexExistsQueryError) {
 			if ignoreIfExists {
 				return nil
 			}
@@ -61,23 +159,31 @@ func (qm *QueryIndexManager) createIndex(bucketName, indexName string, fields []
 	return rows.Close()
 }
 
-// CreateIndex creates an index over the specified fields.
+// CreateIndex creates an index over the specified fields.  If the index already exists it fails with
+// ErrIndexAlreadyExists, unless ignoreIfExists is set in which case it succeeds.
 func (qm *QueryIndexManager) CreateIndex(bucketName, indexName string, fields []string, ignoreIfExists, deferred bool) error {
+	span := startManagerTrace("query", "create_index", "n1ql")
+	defer span.Finish()
+
 	if indexName == "" {
 		return ErrIndexInvalidName
 	}
 	if len(fields) <= 0 {
 		return ErrIndexNoFields
 	}
-	return qm.createIndex(bucketName, indexName, fields, ignoreIfExists, deferred)
+	return qm.createIndex(span.Context(), bucketName, indexName, fields, ignoreIfExists, deferred)
 }
 
-// CreatePrimaryIndex creates a primary index.  An empty customName uses the default naming.
+// CreatePrimaryIndex creates a primary index.  An empty customName uses the default naming.  If the index
+// already exists it fails with ErrIndexAlreadyExists, unless ignoreIfExists is set in which case it succeeds.
 func (qm *QueryIndexManager) CreatePrimaryIndex(bucketName string, customName string, ignoreIfExists, deferred bool) error {
-	return qm.createIndex(bucketName, customName, nil, ignoreIfExists, deferred)
+	span := startManagerTrace("query", "create_primary_index", "n1ql")
+	defer span.Finish()
+
+	return qm.createIndex(span.Context(), bucketName, customName, nil, ignoreIfExists, deferred)
 }
 
-func (qm *QueryIndexManager) dropIndex(bucketName, indexName string, ignoreIfNotExists bool) error {
+func (qm *QueryIndexManager) dropIndex(traceCtx opentracing.SpanContext, bucketName, indexName string, ignoreIfNotExists bool) error {
 	var qs string
 
 	if indexName == "" {
@@ -86,9 +192,9 @@ func (qm *QueryIndexManager) dropIndex(bucketName, indexName string, ignoreIfNot
 		qs += "DROP INDEX `" + bucketName + "`.`" + indexName + "`"
 	}
 
-	rows, err := qm.ExecuteQuery(qs, nil)
+	rows, err := qm.executeQuery(traceCtx, qs)
 	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
+		if isQueryErrorMatching(err, isIndexNotFoundQueryError) {
 			if ignoreIfNotExists {
 				return nil
 			}
@@ -100,23 +206,38 @@ func (qm *QueryIndexManager) dropIndex(bucketName, indexName string, ignoreIfNot
 	return rows.Close()
 }
 
-// DropIndex drops a specific index by name.
+// DropIndex drops a specific index by name.  If the index does not exist it fails with ErrIndexNotFound, unless
+// ignoreIfNotExists is set in which case it succeeds.
 func (qm *QueryIndexManager) DropIndex(bucketName, indexName string, ignoreIfNotExists bool) error {
+	span := startManagerTrace("query", "drop_index", "n1ql")
+	defer span.Finish()
+
 	if indexName == "" {
 		return ErrIndexInvalidName
 	}
-	return qm.dropIndex(bucketName, indexName, ignoreIfNotExists)
+	return qm.dropIndex(span.Context(), bucketName, indexName, ignoreIfNotExists)
 }
 
-// DropPrimaryIndex drops the primary index.  Pass an empty customName for unnamed primary indexes.
+// DropPrimaryIndex drops the primary index.  Pass an empty customName for unnamed primary indexes.  If the index
+// does not exist it fails with ErrIndexNotFound, unless ignoreIfNotExists is set in which case it succeeds.
 func (qm *QueryIndexManager) DropPrimaryIndex(bucketName, customName string, ignoreIfNotExists bool) error {
-	return qm.dropIndex(bucketName, customName, ignoreIfNotExists)
+	span := startManagerTrace("query", "drop_primary_index", "n1ql")
+	defer span.Finish()
+
+	return qm.dropIndex(span.Context(), bucketName, customName, ignoreIfNotExists)
 }
 
 // GetIndexes returns a list of all currently registered indexes.
 func (qm *QueryIndexManager) GetIndexes() ([]IndexInfo, error) {
+	span := startManagerTrace("query", "get_all_indexes", "n1ql")
+	defer span.Finish()
+
+	return qm.getIndexes(span.Context())
+}
+
+func (qm *QueryIndexManager) getIndexes(traceCtx opentracing.SpanContext) ([]IndexInfo, error) {
 	q := "SELECT `indexes`.* FROM system:indexes"
-	rows, err := qm.ExecuteQuery(q, nil)
+	rows, err := qm.executeQuery(traceCtx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -136,7 +257,10 @@ func (qm *QueryIndexManager) GetIndexes() ([]IndexInfo, error) {
 
 // BuildDeferredIndexes builds all indexes which are currently in deferred state.
 func (qm *QueryIndexManager) BuildDeferredIndexes(bucketName string) ([]string, error) {
-	indexList, err := qm.GetIndexes()
+	span := startManagerTrace("query", "build_deferred_indexes", "n1ql")
+	defer span.Finish()
+
+	indexList, err := qm.getIndexes(span.Context())
 	if err != nil {
 		return nil, err
 	}
@@ -164,7 +288,7 @@ func (qm *QueryIndexManager) BuildDeferredIndexes(bucketName string) ([]string,
 	}
 	qs += ")"
 
-	rows, err := qm.ExecuteQuery(qs, nil)
+	rows, err := qm.executeQuery(span.Context(), qs)
 	if err != nil {
 		return nil, err
 	}
@@ -201,41 +325,11 @@ func checkIndexesActive(indexes []IndexInfo, checkList []string) (bool, error) {
 	return true, nil
 }
 
-// WatchIndexes waits for a set of indexes to come online
+// WatchIndexes waits for a set of indexes to come online, see WatchQueryIndexes for more control over how they
+// are watched.
 func (qm *QueryIndexManager) WatchIndexes(watchList []string, watchPrimary bool, timeout time.Duration) error {
-	if watchPrimary {
-		watchList = append(watchList, "#primary")
-	}
-
-	curInterval := 50 * time.Millisecond
-	timeoutTime := time.Now().Add(timeout)
-	for {
-		indexes, err := qm.GetIndexes()
-		if err != nil {
-			return err
-		}
-
-		allOnline, err := checkIndexesActive(indexes, watchList)
-		if err != nil {
-			return err
-		}
-
-		if allOnline {
-			break
-		}
-
-		curInterval += 500 * time.Millisecond
-		if curInterval > 1000 {
-			curInterval = 1000
-		}
-
-		if time.Now().Add(curInterval).After(timeoutTime) {
-			return timeoutError{}
-		}
-
-		// wait till our next poll interval
-		time.Sleep(curInterval)
-	}
-
-	return nil
+	return qm.WatchQueryIndexes(watchList, &WatchQueryIndexesOptions{
+		WatchPrimary: watchPrimary,
+		Timeout:      timeout,
+	})
 }
@@ -0,0 +1,198 @@
+package gocb
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestQueryIndexManagerAdviseIndex(t *testing.T) {
+	var statement string
+	qm := &QueryIndexManager{
+		ExecuteQuery: func(s string, opts *QueryOptions) (*QueryResults, error) {
+			statement = s
+			return &QueryResults{
+				index: -1,
+				rows: []json.RawMessage{[]byte(`{"#operator":"Advise","advice":{"#operator":"IndexAdvice","adviseinfo":{` +
+					`"current_indexes":[{"index_statement":"CREATE PRIMARY INDEX def_primary ON default","keyspace_alias":"default"}],` +
+					`"recommended_indexes":{"covering_indexes":[{"index_statement":"CREATE INDEX adv_city_name ON default(city,name)","keyspace_alias":"default"}],` +
+					`"indexes":[{"index_statement":"CREATE INDEX adv_city ON default(city)","keyspace_alias":"default"}]}}},` +
+					`"query":"SELECT name FROM default WHERE city = \"London\""}`)},
+			}, nil
+		},
+	}
+
+	advice, err := qm.AdviseIndex("SELECT name FROM default WHERE city = \"London\"")
+	if err != nil {
+		t.Fatalf("Expected AdviseIndex to not error: %v", err)
+	}
+
+	if statement != "ADVISE SELECT name FROM default WHERE city = \"London\"" {
+		t.Fatalf("Unexpected statement sent: %s", statement)
+	}
+
+	if len(advice.CurrentIndexes) != 1 || advice.CurrentIndexes[0].Statement != "CREATE PRIMARY INDEX def_primary ON default" {
+		t.Fatalf("Unexpected current indexes: %v", advice.CurrentIndexes)
+	}
+
+	if len(advice.RecommendedIndexes) != 1 || advice.RecommendedIndexes[0].Statement != "CREATE INDEX adv_city ON default(city)" {
+		t.Fatalf("Unexpected recommended indexes: %v", advice.RecommendedIndexes)
+	}
+
+	if len(advice.RecommendedCoveringIndexes) != 1 || advice.RecommendedCoveringIndexes[0].KeyspaceAlias != "default" {
+		t.Fatalf("Unexpected recommended covering indexes: %v", advice.RecommendedCoveringIndexes)
+	}
+}
+
+func TestQueryIndexManagerAdviseIndexNoRecommendation(t *testing.T) {
+	qm := &QueryIndexManager{
+		ExecuteQuery: func(s string, opts *QueryOptions) (*QueryResults, error) {
+			return &QueryResults{
+				index: -1,
+				rows: []json.RawMessage{[]byte(`{"#operator":"Advise","advice":{"#operator":"IndexAdvice","adviseinfo":{` +
+					`"recommended_indexes":"No index recommendation at this time."}}}`)},
+			}, nil
+		},
+	}
+
+	advice, err := qm.AdviseIndex("SELECT META().id FROM default")
+	if err != nil {
+		t.Fatalf("Expected AdviseIndex to not error: %v", err)
+	}
+
+	if len(advice.CurrentIndexes) != 0 || len(advice.RecommendedIndexes) != 0 || len(advice.RecommendedCoveringIndexes) != 0 {
+		t.Fatalf("Expected no advice but was %v", advice)
+	}
+}
+
+func TestQueryIndexManagerIgnoreIfExists(t *testing.T) {
+	var queryErr error
+	qm := &QueryIndexManager{
+		ExecuteQuery: func(s string, opts *QueryOptions) (*QueryResults, error) {
+			return nil, queryErr
+		},
+	}
+
+	existsErrs := []queryError{
+		{ErrorCode: 4300, ErrorMessage: "The index beers already exists."},
+		{ErrorCode: 5000, ErrorMessage: "GSI CreateIndex() - cause: Index beers already exists"},
+	}
+	for _, existsErr := range existsErrs {
+		queryErr = queryMultiError{errors: []QueryError{existsErr}}
+
+		err := qm.CreateIndex("default", "beers", []string{"name"}, false, false)
+		if err != ErrIndexAlreadyExists {
+			t.Fatalf("Expected index exists error for %v but was %v", existsErr, err)
+		}
+
+		err = qm.CreatePrimaryIndex("default", "", true, false)
+		if err != nil {
+			t.Fatalf("Expected existing index to be ignored for %v but was %v", existsErr, err)
+		}
+
+		if IsRetryableError(existsErr) {
+			t.Fatalf("Expected %v not to be retryable", existsErr)
+		}
+	}
+
+	notFoundErrs := []queryError{
+		{ErrorCode: 12004, ErrorMessage: "Index beers not found."},
+		{ErrorCode: 12016, ErrorMessage: "Index Not Found - cause: GSI index beers not found."},
+		{ErrorCode: 5000, ErrorMessage: "GSI index beers not found."},
+	}
+	for _, notFoundErr := range notFoundErrs {
+		queryErr = queryMultiError{errors: []QueryError{notFoundErr}}
+
+		err := qm.DropIndex("default", "beers", false)
+		if err != ErrIndexNotFound {
+			t.Fatalf("Expected index not found error for %v but was %v", notFoundErr, err)
+		}
+
+		err = qm.DropPrimaryIndex("default", "", true)
+		if err != nil {
+			t.Fatalf("Expected missing index to be ignored for %v but was %v", notFoundErr, err)
+		}
+	}
+
+	queryErr = queryMultiError{errors: []QueryError{queryError{ErrorCode: 3000, ErrorMessage: "syntax error"}}}
+	err := qm.CreateIndex("default", "beers", []string{"name"}, true, false)
+	if err == nil || err.Error() != queryErr.Error() {
+		t.Fatalf("Expected other errors to be returned unchanged but was %v", err)
+	}
+}
+
+func TestQueryIndexManagerWatchQueryIndexes(t *testing.T) {
+	states := []string{"deferred", "building", "building", "online"}
+	var polls int
+	qm := &QueryIndexManager{
+		ExecuteQuery: func(s string, opts *QueryOptions) (*QueryResults, error) {
+			if opts.Context == nil {
+				t.Fatalf("Expected index queries to be sent with the watch context")
+			}
+			state := states[polls]
+			polls++
+			return &QueryResults{
+				index: -1,
+				rows: []json.RawMessage{
+					[]byte(`{"name":"beers","keyspace_id":"default","state":"` + state + `"}`),
+					[]byte(`{"name":"#primary","keyspace_id":"default","state":"online"}`),
+				},
+			}, nil
+		},
+	}
+
+	var changes []IndexStateChange
+	err := qm.WatchQueryIndexes([]string{"beers"}, &WatchQueryIndexesOptions{
+		PollInterval: time.Millisecond,
+		WatchPrimary: true,
+		OnStateChange: func(change IndexStateChange) {
+			changes = append(changes, change)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Expected watch to succeed but was %v", err)
+	}
+
+	if polls != 4 {
+		t.Fatalf("Expected 4 polls but was %d", polls)
+	}
+
+	expected := []IndexStateChange{
+		{Name: "beers", Keyspace: "default", State: "deferred"},
+		{Name: "#primary", Keyspace: "default", State: "online"},
+		{Name: "beers", Keyspace: "default", PreviousState: "deferred", State: "building"},
+		{Name: "beers", Keyspace: "default", PreviousState: "building", State: "online"},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("Expected changes %v but was %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Fatalf("Expected changes %v but was %v", expected, changes)
+		}
+	}
+
+	polls = 0
+	states = []string{"building", "building"}
+	ctx, cancel := context.WithCancel(context.Background())
+	err = qm.WatchQueryIndexes([]string{"beers"}, &WatchQueryIndexesOptions{
+		Context:      ctx,
+		PollInterval: time.Hour,
+		OnStateChange: func(change IndexStateChange) {
+			cancel()
+		},
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected watch to be cancelled but was %v", err)
+	}
+
+	polls = 0
+	err = qm.WatchQueryIndexes([]string{"beers"}, &WatchQueryIndexesOptions{
+		Timeout:      5 * time.Millisecond,
+		PollInterval: time.Hour,
+	})
+	if !IsTimeoutError(err) {
+		t.Fatalf("Expected watch to time out but was %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package gocb
+
+import (
+	"context"
+	"time"
+)
+
+const defaultIndexWatchPollInterval = 500 * time.Millisecond
+
+// IndexStateChange describes a change to the state of an index being watched by WatchQueryIndexes.
+type IndexStateChange struct {
+	Name     string
+	Keyspace string
+	// PreviousState is empty when the index is first seen.
+	PreviousState string
+	State         string
+}
+
+// WatchQueryIndexesOptions is the set of options available to WatchQueryIndexes.
+type WatchQueryIndexesOptions struct {
+	// Context, if set, is used instead of the context of the manager.  The watch stops once it is done.
+	Context context.Context
+	// Timeout is how long to wait for the indexes to come online.  If zero the timeout of the manager is used, or
+	// ClusterOptions.ManagementTimeout if the manager has none.
+	Timeout time.Duration
+	// PollInterval is how often system:indexes is queried for the state of the indexes, 500ms by default.
+	PollInterval time.Duration
+	// WatchPrimary also waits for the primary index, "#primary", to come online.
+	WatchPrimary bool
+	// OnStateChange, if set, is called each time the state of a watched index changes, and when it is first seen.
+	// It is called on the goroutine running WatchQueryIndexes.
+	OnStateChange func(IndexStateChange)
+}
+
+// WatchQueryIndexes waits for the indexes in watchList to come online, polling their state until they all have,
+// the timeout is reached or the context is done.  It fails with ErrIndexNotFound if any of the indexes does not
+// exist.
+func (qm *QueryIndexManager) WatchQueryIndexes(watchList []string, opts *WatchQueryIndexesOptions) error {
+	if opts == nil {
+		opts = &WatchQueryIndexesOptions{}
+	}
+
+	span := startManagerTrace("query", "watch_indexes", "n1ql")
+	defer span.Finish()
+
+	if opts.WatchPrimary {
+		watchList = append(watchList, "#primary")
+	}
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = qm.ctx
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = qm.timeout
+	}
+	if timeout <= 0 {
+		timeout = defaultManagementTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	interval := opts.PollInterval
+	if interval <= 0 {
+		interval = defaultIndexWatchPollInterval
+	}
+
+	watcher := qm.WithContext(ctx)
+	states := make(map[string]string, len(watchList))
+	for {
+		indexes, err := watcher.getIndexes(span.Context())
+		if err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return timeoutError{}
+			}
+			return err
+		}
+
+		if opts.OnStateChange != nil {
+			reportIndexStateChanges(indexes, watchList, states, opts.OnStateChange)
+		}
+
+		allOnline, err := checkIndexesActive(indexes, watchList)
+		if err != nil {
+			return err
+		}
+
+		if allOnline {
+			return nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				return timeoutError{}
+			}
+			return ctx.Err()
+		}
+	}
+}
+
+// reportIndexStateChanges calls onChange for each watched index whose state differs from that in states, which
+// is updated with the new states.
+func reportIndexStateChanges(indexes []IndexInfo, watchList []string, states map[string]string,
+	onChange func(IndexStateChange)) {
+	for _, name := range watchList {
+		for _, index := range indexes {
+			if index.Name != name {
+				continue
+			}
+
+			previous, seen := states[name]
+			if !seen || previous != index.State {
+				states[name] = index.State
+				onChange(IndexStateChange{
+					Name:          index.Name,
+					Keyspace:      index.Keyspace,
+					PreviousState: previous,
+					State:         index.State,
+				})
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gocb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// QueryTransactionOptions are the options available when running a server side query transaction.
+type QueryTransactionOptions struct {
+	// Timeout is the maximum time that the transaction may remain open on the server.
+	Timeout           time.Duration
+	Context           context.Context
+	ParentSpanContext opentracing.SpanContext
+}
+
+// QueryTransaction represents an open server side query transaction.  Every statement executed through
+// the transaction is sent to the query node on which the transaction was started.
+type QueryTransaction struct {
+	cluster  *Cluster
+	id       string
+	ctx      context.Context
+	traceCtx opentracing.SpanContext
+	provider httpProvider
+}
+
+// stickyHTTPProvider sends every request to the endpoint used by the first request made through it.
+type stickyHTTPProvider struct {
+	provider httpProvider
+
+	lock     sync.Mutex
+	endpoint string
+}
+
+func (p *stickyHTTPProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	p.lock.Lock()
+	endpoint := p.endpoint
+	p.lock.Unlock()
+
+	if req.Endpoint == "" {
+		req.Endpoint = endpoint
+	}
+
+	resp, err := p.provider.DoHttpRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if endpoint == "" {
+		p.lock.Lock()
+		if p.endpoint == "" {
+			p.endpoint = resp.Endpoint
+		}
+		p.lock.Unlock()
+	}
+
+	return resp, nil
+}
+
+// ID returns the server assigned id of this transaction.
+func (tx *QueryTransaction) ID() string {
+	return tx.id
+}
+
+// Query executes a N1QL statement as part of this transaction.
+func (tx *QueryTransaction) Query(statement string, opts *QueryOptions) (*QueryResults, error) {
+	var txOpts QueryOptions
+	if opts != nil {
+		txOpts = *opts
+	}
+	txOpts.TransactionID = tx.id
+
+	ctx := txOpts.Context
+	if ctx == nil {
+		ctx = tx.ctx
+	}
+
+	traceCtx := parentSpanContext(txOpts.Context, txOpts.ParentSpanContext)
+	if traceCtx == nil {
+		traceCtx = tx.traceCtx
+	}
+
+	span := opentracing.GlobalTracer().StartSpan("ExecuteN1QLQuery",
+		opentracing.Tag{Key: "couchbase.service", Value: "n1ql"}, opentracing.ChildOf(traceCtx))
+	defer span.Finish()
+
+	return tx.cluster.query(ctx, span.Context(), statement, &txOpts, tx.provider, false)
+}
+
+func (tx *QueryTransaction) end(ctx context.Context, statement string) error {
+	res, err := tx.Query(statement, &QueryOptions{Context: ctx})
+	if err != nil {
+		return err
+	}
+
+	return res.Close()
+}
+
+// QueryTransaction starts a server side query transaction and calls fn with it.  If fn returns nil then the
+// transaction is committed, otherwise it is rolled back and the error from fn is returned.
+// VOLATILE: This API is subject to change at any time.
+func (c *Cluster) QueryTransaction(fn func(tx *QueryTransaction) error, opts *QueryTransactionOptions) error {
+	if opts == nil {
+		opts = &QueryTransactionOptions{}
+	}
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
+	var span opentracing.Span
+	if parentSpanCtx == nil {
+		span = opentracing.GlobalTracer().StartSpan("QueryTransaction",
+			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"})
+	} else {
+		span = opentracing.GlobalTracer().StartSpan("QueryTransaction",
+			opentracing.Tag{Key: "couchbase.service", Value: "n1ql"}, opentracing.ChildOf(parentSpanCtx))
+	}
+	defer span.Finish()
+
+	provider, err := c.getQueryProvider()
+	if err != nil {
+		return err
+	}
+
+	tx := &QueryTransaction{
+		cluster:  c,
+		ctx:      ctx,
+		traceCtx: span.Context(),
+		provider: &stickyHTTPProvider{provider: provider},
+	}
+
+	beginOpts := &QueryOptions{}
+	if opts.Timeout > 0 {
+		beginOpts.Custom = map[string]interface{}{
+			"txtimeout": opts.Timeout.String(),
+		}
+	}
+
+	res, err := tx.Query("BEGIN WORK", beginOpts)
+	if err != nil {
+		return err
+	}
+
+	var begin struct {
+		TxID string `json:"txid"`
+	}
+	err = res.One(&begin)
+	if err != nil {
+		return err
+	}
+	if begin.TxID == "" {
+		return errors.New("query service did not return a transaction id")
+	}
+	tx.id = begin.TxID
+
+	err = fn(tx)
+	if err != nil {
+		// The context may have been cancelled or timed out, which is often why fn failed, so the rollback is
+		// bounded only by the query timeout rather than leaving the transaction open until it expires.
+		rollbackErr := tx.end(context.Background(), "ROLLBACK WORK")
+		if rollbackErr != nil {
+			logWarnf("Failed to rollback query transaction %s: %s", tx.id, rollbackErr)
+		}
+		return err
+	}
+
+	return tx.end(ctx, "COMMIT WORK")
+}
@@ -0,0 +1,138 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func testQueryTxProvider(t *testing.T, statements *[]map[string]interface{}, endpoints *[]string) *mockHTTPProvider {
+	nodes := []string{"http://10.112.0.1:8093", "http://10.112.0.2:8093"}
+	return &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			if req.Context != nil && req.Context.Err() != nil {
+				return nil, req.Context.Err()
+			}
+
+			var body map[string]interface{}
+			err := json.Unmarshal(req.Body, &body)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal request body: %v", err)
+			}
+			*statements = append(*statements, body)
+			*endpoints = append(*endpoints, req.Endpoint)
+
+			endpoint := req.Endpoint
+			if endpoint == "" {
+				// Simulate the request being routed to any node.
+				endpoint = nodes[len(*statements)%len(nodes)]
+			}
+
+			results := `[]`
+			if body["statement"] == "BEGIN WORK" {
+				results = `[{"txid":"d81d9b4a-b758-4f98-b007-87ba262d3a51"}]`
+			}
+
+			return &gocbcore.HttpResponse{
+				Endpoint:   endpoint,
+				StatusCode: 200,
+				Body: &testReadCloser{bytes.NewBufferString(`{"requestID":"1","results":` + results +
+					`,"status":"success","metrics":{"elapsedTime":"1ms","executionTime":"1ms"}}`), nil},
+			}, nil
+		},
+	}
+}
+
+func TestQueryTransactionCommit(t *testing.T) {
+	var statements []map[string]interface{}
+	var endpoints []string
+	cluster := testGetClusterForHTTP(testQueryTxProvider(t, &statements, &endpoints), 60*time.Second, 0, 0)
+
+	err := cluster.QueryTransaction(func(tx *QueryTransaction) error {
+		if tx.ID() != "d81d9b4a-b758-4f98-b007-87ba262d3a51" {
+			t.Fatalf("Unexpected transaction id: %s", tx.ID())
+		}
+
+		res, err := tx.Query("UPDATE default SET a = 1", nil)
+		if err != nil {
+			return err
+		}
+		return res.Close()
+	}, &QueryTransactionOptions{Timeout: 2 * time.Minute})
+	if err != nil {
+		t.Fatalf("Expected transaction to succeed but was %v", err)
+	}
+
+	expected := []string{"BEGIN WORK", "UPDATE default SET a = 1", "COMMIT WORK"}
+	if len(statements) != len(expected) {
+		t.Fatalf("Expected %d statements but was %d", len(expected), len(statements))
+	}
+
+	for i, statement := range statements {
+		if statement["statement"] != expected[i] {
+			t.Fatalf("Expected statement %d to be %s but was %v", i, expected[i], statement["statement"])
+		}
+
+		if i == 0 {
+			if statement["txtimeout"] != "2m0s" {
+				t.Fatalf("Expected txtimeout to be 2m0s but was %v", statement["txtimeout"])
+			}
+			continue
+		}
+
+		if statement["txid"] != "d81d9b4a-b758-4f98-b007-87ba262d3a51" {
+			t.Fatalf("Expected statement %d to have txid but was %v", i, statement["txid"])
+		}
+
+		if endpoints[i] != "http://10.112.0.2:8093" {
+			t.Fatalf("Expected statement %d to be sent to the transaction's node but was %s", i, endpoints[i])
+		}
+	}
+}
+
+func TestQueryTransactionRollback(t *testing.T) {
+	var statements []map[string]interface{}
+	var endpoints []string
+	cluster := testGetClusterForHTTP(testQueryTxProvider(t, &statements, &endpoints), 60*time.Second, 0, 0)
+
+	txErr := errors.New("something went wrong")
+	err := cluster.QueryTransaction(func(tx *QueryTransaction) error {
+		return txErr
+	}, nil)
+	if err != txErr {
+		t.Fatalf("Expected error from transaction function but was %v", err)
+	}
+
+	if len(statements) != 2 || statements[1]["statement"] != "ROLLBACK WORK" {
+		t.Fatalf("Expected transaction to be rolled back but statements were %v", statements)
+	}
+}
+
+func TestQueryTransactionRollbackAfterContextCancelled(t *testing.T) {
+	var statements []map[string]interface{}
+	var endpoints []string
+	cluster := testGetClusterForHTTP(testQueryTxProvider(t, &statements, &endpoints), 60*time.Second, 0, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cluster.QueryTransaction(func(tx *QueryTransaction) error {
+		cancel()
+		_, err := tx.Query("UPDATE t SET a = 1", nil)
+		return err
+	}, &QueryTransactionOptions{Context: ctx})
+	if err == nil {
+		t.Fatalf("Expected the query to fail with the cancelled context")
+	}
+
+	if len(statements) != 2 || statements[1]["statement"] != "ROLLBACK WORK" {
+		t.Fatalf("Expected transaction to be rolled back despite the cancelled context but statements were %v",
+			statements)
+	}
+	if statements[1]["txid"] != "d81d9b4a-b758-4f98-b007-87ba262d3a51" {
+		t.Fatalf("Expected rollback to be part of the transaction but was %v", statements[1])
+	}
+}
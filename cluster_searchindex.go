@@ -2,10 +2,14 @@ package gocb
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/couchbase/gocbcore.v7"
 )
@@ -42,6 +46,21 @@ type SearchIndexManager struct {
 	httpClient httpProvider
 }
 
+// WithContext returns a copy of the manager whose operations are cancelled once ctx is done.
+func (sim *SearchIndexManager) WithContext(ctx context.Context) *SearchIndexManager {
+	newM := *sim
+	newM.httpClient = asMgmtProvider(sim.httpClient).withContext(ctx)
+	return &newM
+}
+
+// WithTimeout returns a copy of the manager whose operations time out after timeout, rather than after
+// ClusterOptions.ManagementTimeout.  Requests which are safe to repeat are retried within the timeout.
+func (sim *SearchIndexManager) WithTimeout(timeout time.Duration) *SearchIndexManager {
+	newM := *sim
+	newM.httpClient = asMgmtProvider(sim.httpClient).withTimeout(timeout)
+	return &newM
+}
+
 // SearchIndexDefinitionBuilder provides methods for building a Couchbase FTS index.
 type SearchIndexDefinitionBuilder struct {
 	data map[string]interface{}
@@ -64,6 +83,9 @@ type searchIndexesResp struct {
 
 // GetAllIndexDefinitions retrieves all of the FTS indexes for the cluster.
 func (sim *SearchIndexManager) GetAllIndexDefinitions() ([]interface{}, error) {
+	span := startManagerTrace("search", "get_all_indexes", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -97,6 +119,9 @@ func (sim *SearchIndexManager) GetAllIndexDefinitions() ([]interface{}, error) {
 
 // GetIndexDefinition retrieves a specific FTS index by name.
 func (sim *SearchIndexManager) GetIndexDefinition(indexName string) (interface{}, error) {
+	span := startManagerTrace("search", "get_index", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -129,6 +154,9 @@ func (sim *SearchIndexManager) GetIndexDefinition(indexName string) (interface{}
 
 // CreateIndex creates a FTS index with the specific definition.
 func (sim *SearchIndexManager) CreateIndex(builder SearchIndexDefinitionBuilder) error {
+	span := startManagerTrace("search", "create_index", "fts")
+	defer span.Finish()
+
 	err := builder.validate()
 	if err != nil {
 		return err
@@ -170,6 +198,9 @@ func (sim *SearchIndexManager) CreateIndex(builder SearchIndexDefinitionBuilder)
 
 // DeleteIndex removes the FTS index with the specific name.
 func (sim *SearchIndexManager) DeleteIndex(indexName string) (bool, error) {
+	span := startManagerTrace("search", "drop_index", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "DELETE",
@@ -200,6 +231,9 @@ func (sim *SearchIndexManager) DeleteIndex(indexName string) (bool, error) {
 
 // GetIndexedDocumentCount retrieves the document count for a FTS index.
 func (sim *SearchIndexManager) GetIndexedDocumentCount(indexName string) (int, error) {
+	span := startManagerTrace("search", "get_indexed_documents_count", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -235,6 +269,9 @@ func (sim *SearchIndexManager) GetIndexedDocumentCount(indexName string) (int, e
 
 // SetIndexIngestion sets the FTS index ingestion state.
 func (sim *SearchIndexManager) SetIndexIngestion(indexName string, op string) (bool, error) {
+	span := startManagerTrace("search", "set_index_ingestion", "fts")
+	defer span.Finish()
+
 	if op != SearchIndexIngestControlOpPause && op != SearchIndexIngestControlOpResume {
 		return false, ErrSearchIndexInvalidIngestControlOp
 	}
@@ -269,6 +306,9 @@ func (sim *SearchIndexManager) SetIndexIngestion(indexName string, op string) (b
 
 // SetIndexQuerying sets the FTS index querying ability state.
 func (sim *SearchIndexManager) SetIndexQuerying(indexName string, op string) (bool, error) {
+	span := startManagerTrace("search", "set_index_querying", "fts")
+	defer span.Finish()
+
 	if op != SearchIndexQueryControlOpPause && op != SearchIndexQueryControlOpResume {
 		return false, ErrSearchIndexInvalidQueryControlOp
 	}
@@ -303,6 +343,9 @@ func (sim *SearchIndexManager) SetIndexQuerying(indexName string, op string) (bo
 
 // SetIndexPlanFreeze sets the FTS index plan freeze state.
 func (sim *SearchIndexManager) SetIndexPlanFreeze(indexName string, op string) (bool, error) {
+	span := startManagerTrace("search", "set_index_plan_freeze", "fts")
+	defer span.Finish()
+
 	if op != SearchIndexPlanFreezeControlOpPause && op != SearchIndexPlanFreezeControlOpResume {
 		return false, ErrSearchIndexInvalidPlanFreezeControlOp
 	}
@@ -337,6 +380,9 @@ func (sim *SearchIndexManager) SetIndexPlanFreeze(indexName string, op string) (
 
 // GetAllIndexStats retrieves all search index stats.
 func (sim *SearchIndexManager) GetAllIndexStats() (interface{}, error) {
+	span := startManagerTrace("search", "get_all_index_stats", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -369,6 +415,9 @@ func (sim *SearchIndexManager) GetAllIndexStats() (interface{}, error) {
 
 // GetIndexStats retrieves search index stats for the specified index.
 func (sim *SearchIndexManager) GetIndexStats(indexName string) (interface{}, error) {
+	span := startManagerTrace("search", "get_index_stats", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -401,6 +450,9 @@ func (sim *SearchIndexManager) GetIndexStats(indexName string) (interface{}, err
 
 // GetAllIndexPartitionInfo retrieves all index partition information.
 func (sim *SearchIndexManager) GetAllIndexPartitionInfo() (interface{}, error) {
+	span := startManagerTrace("search", "get_all_index_partition_info", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -436,6 +488,9 @@ func (sim *SearchIndexManager) GetAllIndexPartitionInfo() (interface{}, error) {
 
 // GetIndexPartitionInfo retrieves a specific index partition information.
 func (sim *SearchIndexManager) GetIndexPartitionInfo(pIndexName string) (interface{}, error) {
+	span := startManagerTrace("search", "get_index_partition_info", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -471,6 +526,9 @@ func (sim *SearchIndexManager) GetIndexPartitionInfo(pIndexName string) (interfa
 
 // GetIndexPartitionIndexedDocumentCount retrieves a specific index partition document count.
 func (sim *SearchIndexManager) GetIndexPartitionIndexedDocumentCount(pIndexName string) (int, error) {
+	span := startManagerTrace("search", "get_index_partition_indexed_documents_count", "fts")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(FtsService),
 		Method:  "GET",
@@ -504,6 +562,152 @@ func (sim *SearchIndexManager) GetIndexPartitionIndexedDocumentCount(pIndexName
 	return count.Count, nil
 }
 
+type searchIndexAliasDef struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	SourceType string `json:"sourceType"`
+	Params     struct {
+		Targets map[string]struct{} `json:"targets"`
+	} `json:"params"`
+}
+
+// GetIndexAlias retrieves the names of the indexes targeted by a FTS index alias.
+func (sim *SearchIndexManager) GetIndexAlias(aliasName string) ([]string, error) {
+	span := startManagerTrace("search", "get_index_alias", "fts")
+	defer span.Finish()
+
+	def, _, err := sim.getIndexAlias(aliasName)
+	if err != nil {
+		return nil, err
+	}
+	if def == nil {
+		return nil, ErrSearchIndexNotFound
+	}
+
+	targets := make([]string, 0, len(def.Params.Targets))
+	for target := range def.Params.Targets {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	return targets, nil
+}
+
+// UpsertIndexAlias creates a FTS index alias targeting the given indexes, or updates an existing alias to target
+// them.  An existing alias is only updated if it has not been changed since it was read, allowing an alias to be
+// atomically repointed at a rebuilt index.  Search queries can be run against an alias in the same way as an index.
+func (sim *SearchIndexManager) UpsertIndexAlias(aliasName string, targetIndexes []string) error {
+	span := startManagerTrace("search", "upsert_index_alias", "fts")
+	defer span.Finish()
+
+	if aliasName == "" {
+		return ErrSearchIndexInvalidName
+	}
+	if len(targetIndexes) == 0 {
+		return ErrSearchIndexAliasNoTargets
+	}
+
+	_, prevUUID, err := sim.getIndexAlias(aliasName)
+	if err != nil {
+		return err
+	}
+
+	def := searchIndexAliasDef{
+		Type:       "fulltext-alias",
+		Name:       aliasName,
+		SourceType: "nil",
+	}
+	def.Params.Targets = make(map[string]struct{}, len(targetIndexes))
+	for _, target := range targetIndexes {
+		def.Params.Targets[target] = struct{}{}
+	}
+
+	body, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/api/index/%s", url.PathEscape(aliasName))
+	if prevUUID != "" {
+		path += "?prevIndexUUID=" + url.QueryEscape(prevUUID)
+	}
+
+	req := &gocbcore.HttpRequest{
+		Service:     gocbcore.ServiceType(FtsService),
+		Method:      "PUT",
+		Path:        path,
+		Body:        body,
+		ContentType: "application/json",
+		Headers:     make(map[string]string),
+	}
+	req.Headers["cache-control"] = "no-cache"
+
+	res, err := sim.httpClient.DoHttpRequest(req)
+	if err != nil {
+		return err
+	}
+
+	err = sim.checkRespBodyForError(res)
+	if err != nil {
+		return err
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		logDebugf("Failed to close socket (%s)", err)
+	}
+
+	return nil
+}
+
+// getIndexAlias fetches the definition of an alias along with its uuid, the definition is nil if no
+// alias or index exists with the name.
+func (sim *SearchIndexManager) getIndexAlias(aliasName string) (*searchIndexAliasDef, string, error) {
+	req := &gocbcore.HttpRequest{
+		Service: gocbcore.ServiceType(FtsService),
+		Method:  "GET",
+		Path:    fmt.Sprintf("/api/index/%s", url.PathEscape(aliasName)),
+	}
+	res, err := sim.httpClient.DoHttpRequest(req)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = sim.checkRespBodyForError(res)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, "", nil
+		}
+		return nil, "", err
+	}
+
+	var indexResp struct {
+		IndexDef *struct {
+			searchIndexAliasDef
+			UUID string `json:"uuid"`
+		} `json:"indexDef"`
+	}
+	jsonDec := json.NewDecoder(res.Body)
+	err = jsonDec.Decode(&indexResp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		logDebugf("Failed to close socket (%s)", err)
+	}
+
+	if indexResp.IndexDef == nil {
+		return nil, "", nil
+	}
+	if indexResp.IndexDef.Type != "fulltext-alias" {
+		return nil, "", ErrSearchIndexNotAlias
+	}
+
+	return &indexResp.IndexDef.searchIndexAliasDef, indexResp.IndexDef.UUID, nil
+}
+
 // AddField adds a field with the specified name to the Couchbase Search index being built
 func (b *SearchIndexDefinitionBuilder) AddField(name string, value interface{}) *SearchIndexDefinitionBuilder {
 	if b.data == nil {
@@ -0,0 +1,88 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestSearchIndexManagerUpsertIndexAlias(t *testing.T) {
+	var putReq *gocbcore.HttpRequest
+	doHTTP := func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+		if req.Method == "GET" {
+			if req.Path != "/api/index/products" {
+				t.Fatalf("Expected alias to be fetched from /api/index/products but was %s", req.Path)
+			}
+			return &gocbcore.HttpResponse{
+				StatusCode: 200,
+				Body: &testReadCloser{bytes.NewBufferString(`{"status":"ok","indexDef":{"type":"fulltext-alias",` +
+					`"name":"products","uuid":"abc123","params":{"targets":{"products_v1":{}}}}}`), nil},
+			}, nil
+		}
+
+		putReq = req
+		return &gocbcore.HttpResponse{
+			StatusCode: 200,
+			Body:       &testReadCloser{bytes.NewBufferString(`{"status":"ok"}`), nil},
+		}, nil
+	}
+
+	sim := &SearchIndexManager{
+		httpClient: &mockHTTPProvider{doFn: doHTTP},
+	}
+
+	err := sim.UpsertIndexAlias("products", []string{"products_v2"})
+	if err != nil {
+		t.Fatalf("Expected alias upsert to succeed but was %v", err)
+	}
+
+	if putReq == nil {
+		t.Fatalf("Expected alias to be written")
+	}
+	if putReq.Method != "PUT" {
+		t.Fatalf("Expected alias to be written with PUT but was %s", putReq.Method)
+	}
+	if putReq.Path != "/api/index/products?prevIndexUUID=abc123" {
+		t.Fatalf("Expected alias update to be conditional on the previous uuid but path was %s", putReq.Path)
+	}
+
+	var def searchIndexAliasDef
+	err = json.Unmarshal(putReq.Body, &def)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal alias definition: %v", err)
+	}
+
+	if def.Type != "fulltext-alias" || def.Name != "products" {
+		t.Fatalf("Unexpected alias definition: %+v", def)
+	}
+	if !reflect.DeepEqual(def.Params.Targets, map[string]struct{}{"products_v2": {}}) {
+		t.Fatalf("Expected alias to target products_v2 but was %v", def.Params.Targets)
+	}
+}
+
+func TestSearchIndexManagerUpsertIndexAliasNotAlias(t *testing.T) {
+	doHTTP := func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+		return &gocbcore.HttpResponse{
+			StatusCode: 200,
+			Body: &testReadCloser{bytes.NewBufferString(`{"status":"ok","indexDef":{"type":"fulltext-index",` +
+				`"name":"products","uuid":"abc123"}}`), nil},
+		}, nil
+	}
+
+	sim := &SearchIndexManager{
+		httpClient: &mockHTTPProvider{doFn: doHTTP},
+	}
+
+	err := sim.UpsertIndexAlias("products", []string{"products_v2"})
+	if err != ErrSearchIndexNotAlias {
+		t.Fatalf("Expected ErrSearchIndexNotAlias but was %v", err)
+	}
+
+	err = sim.UpsertIndexAlias("products", nil)
+	if err != ErrSearchIndexAliasNoTargets {
+		t.Fatalf("Expected ErrSearchIndexAliasNoTargets but was %v", err)
+	}
+}
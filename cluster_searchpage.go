@@ -0,0 +1,112 @@
+package gocb
+
+import (
+	"context"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// SearchPage runs a search for a page of hits, opts.Limit hits from opts.Skip, and a separate search for only the
+// facets in opts.Facets concurrently, returning their results merged together.  Computing large facets is
+// expensive and is done over every match rather than just the page, so requesting them alongside the hits makes
+// every page as slow as the facets.  Running them separately allows the page of hits to be fetched in parallel
+// with the facets.  If either search fails the other is cancelled and the error returned.  Without facets in
+// opts it is the same as SearchQuery.
+func (c *Cluster) SearchPage(q SearchQuery, opts *SearchQueryOptions) (*SearchResults, error) {
+	if opts == nil || len(opts.Facets) == 0 {
+		return c.SearchQuery(q, opts)
+	}
+
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
+	var span opentracing.Span
+	if parentSpanCtx == nil {
+		span = opentracing.GlobalTracer().StartSpan("ExecuteSearchPage",
+			opentracing.Tag{Key: "couchbase.service", Value: "fts"})
+	} else {
+		span = opentracing.GlobalTracer().StartSpan("ExecuteSearchPage",
+			opentracing.Tag{Key: "couchbase.service", Value: "fts"}, opentracing.ChildOf(parentSpanCtx))
+	}
+	defer span.Finish()
+
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	hitsOpts := *opts
+	hitsOpts.Context = ctx
+	hitsOpts.ParentSpanContext = span.Context()
+	hitsOpts.Facets = nil
+	hitsOpts.StreamHits = false
+
+	facetsOpts := *opts
+	facetsOpts.Context = ctx
+	facetsOpts.ParentSpanContext = span.Context()
+	facetsOpts.Limit = 0
+	facetsOpts.Skip = 0
+	facetsOpts.Explain = false
+	facetsOpts.Highlight = nil
+	facetsOpts.Fields = nil
+	facetsOpts.Sort = nil
+	facetsOpts.StreamHits = false
+	facetsOpts.facetsOnly = true
+
+	var hits, facets *SearchResults
+	var hitsErr, facetsErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		hits, hitsErr = c.SearchQuery(q, &hitsOpts)
+		if hitsErr != nil {
+			cancel()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		facets, facetsErr = c.SearchQuery(q, &facetsOpts)
+		if facetsErr != nil {
+			cancel()
+		}
+	}()
+	wg.Wait()
+
+	// Cancelling the other search causes it to fail too, only the first error is the cause.
+	if hitsErr != nil && (facetsErr == nil || !isContextCanceled(hitsErr)) {
+		return nil, hitsErr
+	}
+	if facetsErr != nil {
+		return nil, facetsErr
+	}
+
+	return mergeSearchPage(hits, facets), nil
+}
+
+// isContextCanceled returns whether err was caused by its context being cancelled.
+func isContextCanceled(err error) bool {
+	return errors.Cause(err) == context.Canceled
+}
+
+// mergeSearchPage returns the hits of one search with the facets of another.
+func mergeSearchPage(hits, facets *SearchResults) *SearchResults {
+	data := *hits.data
+	data.Facets = facets.data.Facets
+	if facets.data.Took > data.Took {
+		data.Took = facets.data.Took
+	}
+
+	merged := &SearchResults{
+		data:              &data,
+		err:               hits.err,
+		duplicatesRemoved: hits.duplicatesRemoved,
+	}
+	if merged.err == nil {
+		merged.err = facets.err
+	}
+
+	return merged
+}
@@ -0,0 +1,100 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestSearchPageRunsHitsAndFacetsSeparately(t *testing.T) {
+	var lock sync.Mutex
+	var requests []map[string]interface{}
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			var body map[string]interface{}
+			err := json.Unmarshal(req.Body, &body)
+			if err != nil {
+				t.Fatalf("Failed to parse request body: %v", err)
+			}
+			lock.Lock()
+			requests = append(requests, body)
+			lock.Unlock()
+
+			resp := `{"status":{"total":1,"successful":1},"total_hits":20,"max_score":2,"took":5,` +
+				`"hits":[{"id":"a","score":2},{"id":"b","score":1}]}`
+			if _, ok := body["facets"]; ok {
+				resp = `{"status":{"total":1,"successful":1},"total_hits":20,"took":9,` +
+					`"facets":{"types":{"field":"type","total":20,"terms":[{"term":"beer","count":20}]}}}`
+			}
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8094",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(resp), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 0, 0, 10*time.Second)
+	query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+
+	res, err := cluster.SearchPage(query, &SearchQueryOptions{
+		Limit:  2,
+		Skip:   10,
+		Facets: map[string]interface{}{"types": map[string]interface{}{"field": "type", "size": 100}},
+	})
+	if err != nil {
+		t.Fatalf("Expected search page to succeed but was %v", err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("Expected 2 requests but was %d", len(requests))
+	}
+	for _, req := range requests {
+		if _, ok := req["facets"]; ok {
+			if req["size"] != float64(0) {
+				t.Fatalf("Expected facets request to have size 0 but was %v", req["size"])
+			}
+			if _, ok := req["from"]; ok {
+				t.Fatalf("Expected facets request to have no from but was %v", req["from"])
+			}
+		} else if req["size"] != float64(2) || req["from"] != float64(10) {
+			t.Fatalf("Expected hits request to have size 2 from 10 but was %v from %v", req["size"], req["from"])
+		}
+	}
+
+	if len(res.Hits()) != 2 || res.TotalHits() != 20 {
+		t.Fatalf("Expected hits of hits request but had %d hits of %d", len(res.Hits()), res.TotalHits())
+	}
+	if res.Facets()["types"].Total != 20 {
+		t.Fatalf("Expected facets of facets request but was %v", res.Facets())
+	}
+	if res.Took() != 9*time.Nanosecond {
+		t.Fatalf("Expected took to be the slowest request but was %v", res.Took())
+	}
+}
+
+func TestSearchPageFailsIfEitherRequestFails(t *testing.T) {
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			if bytes.Contains(req.Body, []byte(`"facets"`)) {
+				return nil, errors.New("facets failed")
+			}
+			<-req.Context.Done()
+			return nil, req.Context.Err()
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 0, 0, 10*time.Second)
+	query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+
+	_, err := cluster.SearchPage(query, &SearchQueryOptions{
+		Facets: map[string]interface{}{"types": map[string]interface{}{"field": "type", "size": 100}},
+	})
+	if err == nil || errors.Cause(err) == context.Canceled {
+		t.Fatalf("Expected error of failed facets request but was %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package gocb
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -16,35 +17,57 @@ import (
 
 // SearchResultLocation holds the location of a hit in a list of search results.
 type SearchResultLocation struct {
-	Position       int    `json:"position,omitempty"`
-	Start          int    `json:"start,omitempty"`
-	End            int    `json:"end,omitempty"`
+	Position       int    `json:"position"`
+	Start          int    `json:"start"`
+	End            int    `json:"end"`
 	ArrayPositions []uint `json:"array_positions,omitempty"`
 }
 
-// SearchResultHit holds a single hit in a list of search results.
+// SearchResultHit holds a single hit in a list of search results.  Numeric values, such as the score and the
+// positions of locations, are included when a hit is marshaled to JSON even when they are zero.
 type SearchResultHit struct {
 	Index       string                                       `json:"index,omitempty"`
 	Id          string                                       `json:"id,omitempty"`
-	Score       float64                                      `json:"score,omitempty"`
+	Score       float64                                      `json:"score"`
 	Explanation map[string]interface{}                       `json:"explanation,omitempty"`
 	Locations   map[string]map[string][]SearchResultLocation `json:"locations,omitempty"`
 	Fragments   map[string][]string                          `json:"fragments,omitempty"`
 	Fields      map[string]string                            `json:"fields,omitempty"`
 }
 
+// FieldBytes returns the value of the stored field name decoded from base64, which is how the search service
+// returns fields which were indexed from binary values.  ErrSearchFieldNotFound is returned if the hit has no
+// such field.
+func (hit SearchResultHit) FieldBytes(name string) ([]byte, error) {
+	value, ok := hit.Fields[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrSearchFieldNotFound, "field %s not found", name)
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		// Some encoders omit the padding.
+		decoded, err = base64.RawStdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s is not base64 encoded", name)
+		}
+	}
+
+	return decoded, nil
+}
+
 // SearchResultTermFacet holds the results of a term facet in search results.
 type SearchResultTermFacet struct {
 	Term  string `json:"term,omitempty"`
-	Count int    `json:"count,omitempty"`
+	Count int    `json:"count"`
 }
 
 // SearchResultNumericFacet holds the results of a numeric facet in search results.
 type SearchResultNumericFacet struct {
 	Name  string  `json:"name,omitempty"`
-	Min   float64 `json:"min,omitempty"`
-	Max   float64 `json:"max,omitempty"`
-	Count int     `json:"count,omitempty"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
 }
 
 // SearchResultDateFacet holds the results of a date facet in search results.
@@ -52,15 +75,15 @@ type SearchResultDateFacet struct {
 	Name  string `json:"name,omitempty"`
 	Min   string `json:"min,omitempty"`
 	Max   string `json:"max,omitempty"`
-	Count int    `json:"count,omitempty"`
+	Count int    `json:"count"`
 }
 
 // SearchResultFacet holds the results of a specified facet in search results.
 type SearchResultFacet struct {
 	Field         string                     `json:"field,omitempty"`
-	Total         int                        `json:"total,omitempty"`
-	Missing       int                        `json:"missing,omitempty"`
-	Other         int                        `json:"other,omitempty"`
+	Total         int                        `json:"total"`
+	Missing       int                        `json:"missing"`
+	Other         int                        `json:"other"`
 	Terms         []SearchResultTermFacet    `json:"terms,omitempty"`
 	NumericRanges []SearchResultNumericFacet `json:"numeric_ranges,omitempty"`
 	DateRanges    []SearchResultDateFacet    `json:"date_ranges,omitempty"`
@@ -68,9 +91,9 @@ type SearchResultFacet struct {
 
 // SearchResultStatus holds the status information for an executed search query.
 type SearchResultStatus struct {
-	Total      int `json:"total,omitempty"`
-	Failed     int `json:"failed,omitempty"`
-	Successful int `json:"successful,omitempty"`
+	Total      int `json:"total"`
+	Failed     int `json:"failed"`
+	Successful int `json:"successful"`
 }
 
 type searchResponse struct {
@@ -83,9 +106,22 @@ type searchResponse struct {
 	MaxScore  float64                      `json:"max_score,omitempty"`
 }
 
-// SearchResults allows access to the results of a search query.
+// SearchResults allows access to the results of a search query.  When the query was run with StreamHits the hits
+// are read from the network as they are needed, so the results must be read to the end or closed to release the
+// connection.
 type SearchResults struct {
-	data *searchResponse
+	data   *searchResponse
+	err    error
+	stream *queryResultStream
+	// endpoint is the address of the node which served a streamed response.
+	endpoint string
+	// seen, if set, holds the ids of the streamed hits returned so far so that duplicates of them can be removed.
+	seen map[string]struct{}
+
+	next   int
+	closed bool
+
+	duplicatesRemoved int
 }
 
 // Status is the status information for the results.
@@ -98,11 +134,57 @@ func (r SearchResults) TotalHits() int {
 	return r.data.TotalHits
 }
 
-// Hits are the matches for the search query.
+// Hits are the matches for the search query.  It is nil when the query was run with StreamHits, use NextHit to
+// read the hits instead.
 func (r SearchResults) Hits() []SearchResultHit {
 	return r.data.Hits
 }
 
+// NextHit assigns the next hit from the results into hitPtr, returning whether there was one.  When the query was
+// run with StreamHits each hit is read from the response as it is needed, and the status, facets and other
+// metadata are only set once it returns false.  It always returns false once the results have been closed.
+func (r *SearchResults) NextHit(hitPtr *SearchResultHit) bool {
+	if r.closed {
+		return false
+	}
+
+	if r.stream != nil {
+		return r.nextStreamedHit(hitPtr)
+	}
+
+	if r.next >= len(r.data.Hits) {
+		return false
+	}
+
+	*hitPtr = r.data.Hits[r.next]
+	r.next++
+	return true
+}
+
+// Next assigns the next hit from the results into hitPtr, returning whether there was one.  It is the same as
+// NextHit.
+func (r *SearchResults) Next(hitPtr *SearchResultHit) bool {
+	return r.NextHit(hitPtr)
+}
+
+// Close marks the results as closed, returning the error for any index partitions which failed when the results
+// are partial.  When the query was run with StreamHits any hits which have not been read are discarded and the
+// connection released.  It is safe to call Close more than once.
+func (r *SearchResults) Close() error {
+	r.closed = true
+	if r.stream != nil {
+		r.discardStream()
+		r.finishStream()
+	}
+	return r.err
+}
+
+// Err returns the error for any index partitions which failed when the results are partial, or the error from
+// reading the hits when the query was run with StreamHits.
+func (r *SearchResults) Err() error {
+	return r.err
+}
+
 // Facets contains the information relative to the facets requested in the search query.
 func (r SearchResults) Facets() map[string]SearchResultFacet {
 	return r.data.Facets
@@ -118,6 +200,33 @@ func (r SearchResults) MaxScore() float64 {
 	return r.data.MaxScore
 }
 
+// DuplicatesRemoved returns the number of hits which were removed because another hit had the same document id,
+// this is always 0 unless DeduplicateHits was set in the query options.
+func (r SearchResults) DuplicatesRemoved() int {
+	return r.duplicatesRemoved
+}
+
+// deduplicateHits removes any hits for a document id which has already been seen, keeping the first (and so
+// highest ranked) hit for each id.  Streamed hits are deduplicated as they are read.
+func (r *SearchResults) deduplicateHits() {
+	if r.stream != nil {
+		r.seen = make(map[string]struct{})
+		return
+	}
+
+	seen := make(map[string]struct{}, len(r.data.Hits))
+	hits := r.data.Hits[:0]
+	for _, hit := range r.data.Hits {
+		if _, ok := seen[hit.Id]; ok {
+			r.duplicatesRemoved++
+			continue
+		}
+		seen[hit.Id] = struct{}{}
+		hits = append(hits, hit)
+	}
+	r.data.Hits = hits
+}
+
 // SearchQuery performs a n1ql query and returns a list of rows or an error.
 func (c *Cluster) SearchQuery(q SearchQuery, opts *SearchQueryOptions) (*SearchResults, error) {
 	if opts == nil {
@@ -128,17 +237,18 @@ func (c *Cluster) SearchQuery(q SearchQuery, opts *SearchQueryOptions) (*SearchR
 		ctx = context.Background()
 	}
 
+	parentSpanCtx := parentSpanContext(opts.Context, opts.ParentSpanContext)
 	var span opentracing.Span
-	if opts.ParentSpanContext == nil {
+	if parentSpanCtx == nil {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteSearchQuery",
 			opentracing.Tag{Key: "couchbase.service", Value: "fts"})
 	} else {
 		span = opentracing.GlobalTracer().StartSpan("ExecuteSearchQuery",
-			opentracing.Tag{Key: "couchbase.service", Value: "fts"}, opentracing.ChildOf(opts.ParentSpanContext))
+			opentracing.Tag{Key: "couchbase.service", Value: "fts"}, opentracing.ChildOf(parentSpanCtx))
 	}
 	defer span.Finish()
 
-	provider, err := c.getHTTPProvider()
+	provider, err := c.getSearchProvider()
 	if err != nil {
 		return nil, err
 	}
@@ -150,7 +260,17 @@ func (c *Cluster) searchQuery(ctx context.Context, traceCtx opentracing.SpanCont
 	provider httpProvider) (*SearchResults, error) {
 
 	qIndexName := q.indexName()
-	optsData, err := opts.toOptionsData()
+
+	var sourceBucket string
+	if opts.ConsistentWith != nil {
+		var err error
+		sourceBucket, err = c.searchIndexSourceBucket(ctx, qIndexName, provider)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	optsData, err := opts.toOptionsData(qIndexName, sourceBucket)
 	if err != nil {
 		return nil, err
 	}
@@ -185,15 +305,6 @@ func (c *Cluster) searchQuery(ctx context.Context, traceCtx opentracing.SpanCont
 			opTimeout = jsonMillisecondDuration(timeout)
 		}
 	}
-	err = ctlData.Set("timeout", opTimeout)
-	if err != nil {
-		return nil, err
-	}
-
-	err = queryData.Set("ctl", ctlData)
-	if err != nil {
-		return nil, err
-	}
 
 	dq, err := q.toSearchQueryData()
 	if err != nil {
@@ -205,31 +316,145 @@ func (c *Cluster) searchQuery(ctx context.Context, traceCtx opentracing.SpanCont
 		return nil, err
 	}
 
+	if opts.facetsOnly {
+		err = queryData.Set("size", 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Doing this will set the context deadline to whichever is shorter, what is already set or the timeout
-	// value
+	// value.  Streamed results take over cancelling the context once they have been read.
 	var cancel context.CancelFunc
 	ctx, cancel = context.WithTimeout(ctx, time.Duration(opTimeout))
-	defer cancel()
+	streamed := false
+	defer func() {
+		if !streamed {
+			cancel()
+		}
+	}()
+
+	clientContextID := opts.ClientContextID
+	if clientContextID == "" {
+		clientContextID = c.generatedID()
+	}
 
 	var retries uint
 	for {
 		retries++
+
+		// Each attempt asks the search service to stop once the request times out, rather than when the
+		// timeout of the first attempt would have, so that it does not keep searching after the client has given
+		// up.
+		err = ctlData.Set("timeout", searchAttemptTimeout(ctx, opTimeout))
+		if err != nil {
+			return nil, err
+		}
+		err = queryData.Set("ctl", ctlData)
+		if err != nil {
+			return nil, err
+		}
+
 		var res *SearchResults
-		res, err = c.executeSearchQuery(ctx, traceCtx, queryData, qIndexName, provider)
+		res, err = c.executeSearchQuery(ctx, traceCtx, queryData, qIndexName, clientContextID, provider,
+			opts.StreamHits)
+		if res != nil && res.stream != nil {
+			streamed = true
+			res.stream.release = cancel
+		}
+		if res != nil && opts.DeduplicateHits {
+			res.deduplicateHits()
+		}
 		if err == nil {
 			return res, err
 		}
 
-		if !isRetryableError(err) || c.sb.SearchRetryBehavior == nil || !c.sb.SearchRetryBehavior.CanRetry(retries) {
+		if !IsRetryableError(err) || c.sb.SearchRetryBehavior == nil || !c.sb.SearchRetryBehavior.CanRetry(retries) {
 			return res, err
 		}
 
-		time.Sleep(c.sb.SearchRetryBehavior.NextInterval(retries))
+		select {
+		case <-time.After(c.sb.SearchRetryBehavior.NextInterval(retries)):
+		case <-ctx.Done():
+			return nil, searchContextError(ctx)
+		}
+	}
+}
+
+// searchAttemptTimeout returns the timeout to send to the search service with an attempt of a search, which is
+// timeout or the time remaining before the deadline of ctx if that is sooner.  It is never less than a
+// millisecond, as the search service treats a timeout of zero as the default timeout.
+func searchAttemptTimeout(ctx context.Context, timeout jsonMillisecondDuration) jsonMillisecondDuration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+
+	remaining := time.Until(deadline)
+	if remaining < time.Millisecond {
+		remaining = time.Millisecond
+	}
+	if remaining < time.Duration(timeout) {
+		return jsonMillisecondDuration(remaining)
+	}
+	return timeout
+}
+
+// searchContextError returns the error for a search whose context is done, a timeout error if its deadline passed
+// or the context error if it was cancelled.
+func searchContextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return timeoutError{}
+	}
+	return ctx.Err()
+}
+
+// searchIndexSourceBucket returns the name of the bucket which the search index indexName is built on, so that
+// the ConsistentWith tokens of other buckets can be left out of the consistency vectors.  It returns an empty
+// string for an index alias, which can target indexes on several buckets.
+func (c *Cluster) searchIndexSourceBucket(ctx context.Context, indexName string, provider httpProvider) (string, error) {
+	req := &gocbcore.HttpRequest{
+		Service: gocbcore.FtsService,
+		Path:    fmt.Sprintf("/api/index/%s", indexName),
+		Method:  "GET",
+		Context: ctx,
+	}
+
+	resp, err := provider.DoHttpRequest(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", searchContextError(ctx)
+		}
+		return "", errors.Wrap(err, "could not fetch search index definition")
+	}
+	defer drainAndCloseHTTPBody(resp.Body)
+
+	if resp.StatusCode != 200 {
+		return "", errors.Errorf("could not fetch search index definition for %s, status code %d", indexName,
+			resp.StatusCode)
+	}
+
+	var indexResp struct {
+		IndexDef struct {
+			Type       string `json:"type"`
+			SourceName string `json:"sourceName"`
+		} `json:"indexDef"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&indexResp)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode search index definition")
+	}
+
+	if indexResp.IndexDef.Type == "fulltext-alias" {
+		return "", nil
 	}
+	return indexResp.IndexDef.SourceName, nil
 }
 
+// executeSearchQuery sends a search query and reads its response.  If stream is set the hits of a successful
+// response are read from the body as they are iterated, see queryResultStream.
 func (c *Cluster) executeSearchQuery(ctx context.Context, traceCtx opentracing.SpanContext, query jsonx.DelayedObject,
-	qIndexName string, provider httpProvider) (*SearchResults, error) {
+	qIndexName, clientContextID string, provider httpProvider, stream bool) (*SearchResults, error) {
 
 	qBytes, err := json.Marshal(query)
 	if err != nil {
@@ -244,19 +469,41 @@ func (c *Cluster) executeSearchQuery(ctx context.Context, traceCtx opentracing.S
 		Body:    qBytes,
 	}
 
+	// The search service has no body field for the client context id so it is only sent as a header.
+	c.setAttributionHeaders(req, clientContextID)
+	c.compressHTTPRequest(req)
+
 	dtrace := opentracing.GlobalTracer().StartSpan("dispatch", opentracing.ChildOf(traceCtx))
 
 	resp, err := provider.DoHttpRequest(req)
 	if err != nil {
 		dtrace.Finish()
-		if err == context.DeadlineExceeded {
-			return nil, timeoutError{}
-		} // TODO: test this...
+		// Abandoning the request closes its connection, which the search service treats as the search being
+		// cancelled.  The error from the HTTP client wraps the context error so the context is checked instead.
+		if ctx.Err() != nil {
+			return nil, searchContextError(ctx)
+		}
+		if svcErr := serviceUnavailableError("search", err); svcErr != nil {
+			return nil, svcErr
+		}
 		return nil, errors.Wrap(err, "could not complete query http request")
 	}
 
 	dtrace.Finish()
 
+	var hits *rowStream
+	var first json.RawMessage
+	defer func() {
+		if first == nil {
+			drainAndCloseHTTPBody(resp.Body)
+		}
+	}()
+
+	// A 401 from the search service means that the consistency requirements could not be met, handled below.
+	if resp.StatusCode == 403 {
+		return nil, serviceAuthError("search", resp.StatusCode)
+	}
+
 	strace := opentracing.GlobalTracer().StartSpan("streaming",
 		opentracing.ChildOf(traceCtx))
 
@@ -265,8 +512,11 @@ func (c *Cluster) executeSearchQuery(ctx context.Context, traceCtx opentracing.S
 	errHandled := false
 	switch resp.StatusCode {
 	case 200:
-		jsonDec := json.NewDecoder(resp.Body)
-		err = jsonDec.Decode(&ftsResp)
+		if stream {
+			hits, first, err = openSearchHitStream(resp.Body, &ftsResp)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(&ftsResp)
+		}
 		if err != nil {
 			strace.Finish()
 			return nil, errors.Wrap(err, "failed to decode query response body")
@@ -289,13 +539,10 @@ func (c *Cluster) executeSearchQuery(ctx context.Context, traceCtx opentracing.S
 		errHandled = true
 	}
 
-	err = resp.Body.Close()
-	if err != nil {
-		logDebugf("Failed to close socket (%s)", err)
+	if first == nil {
+		strace.Finish()
 	}
 
-	strace.Finish()
-
 	if resp.StatusCode != 200 && !errHandled {
 		errOut := &networkError{
 			statusCode: resp.StatusCode,
@@ -307,26 +554,49 @@ func (c *Cluster) executeSearchQuery(ctx context.Context, traceCtx opentracing.S
 		return nil, errOut
 	}
 
-	var multiErr searchMultiError
-	if len(ftsResp.Errors) > 0 {
-		errs := make([]SearchError, len(ftsResp.Errors))
-		for i, e := range ftsResp.Errors {
-			errs[i] = searchError{
-				message: e,
-			}
-		}
-		multiErr = searchMultiError{
-			errors:     errs,
-			endpoint:   resp.Endpoint,
-			httpStatus: resp.StatusCode,
-			// contextID:  resp.ClientContextID, TODO?
-		}
-		if ftsResp.Status.Failed != ftsResp.Status.Total {
-			multiErr.partial = true
-		}
+	if first != nil {
+		// The metadata is only set once every hit has been read, as most of it follows the hits.
+		return &SearchResults{
+			data:     &searchResponse{},
+			endpoint: resp.Endpoint,
+			stream: &queryResultStream{
+				rows:    hits,
+				body:    resp.Body,
+				ctx:     ctx,
+				span:    strace,
+				pending: first,
+			},
+		}, nil
 	}
 
-	return &SearchResults{
+	res := &SearchResults{
 		data: &ftsResp,
-	}, multiErr
+	}
+	if len(ftsResp.Errors) > 0 {
+		multiErr := newSearchMultiError(&ftsResp, resp.Endpoint, resp.StatusCode)
+		res.err = multiErr
+		return res, multiErr
+	}
+
+	return res, nil
+}
+
+// newSearchMultiError returns the error for the errors in a search response.
+func newSearchMultiError(ftsResp *searchResponse, endpoint string, httpStatus int) searchMultiError {
+	errs := make([]SearchError, len(ftsResp.Errors))
+	for i, e := range ftsResp.Errors {
+		errs[i] = searchError{
+			message: e,
+		}
+	}
+	multiErr := searchMultiError{
+		errors:     errs,
+		endpoint:   endpoint,
+		httpStatus: httpStatus,
+		// contextID:  resp.ClientContextID, TODO?
+	}
+	if ftsResp.Status.Failed != ftsResp.Status.Total {
+		multiErr.partial = true
+	}
+	return multiErr
 }
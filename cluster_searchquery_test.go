@@ -0,0 +1,257 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func testSearchProvider(body string) *mockHTTPProvider {
+	return &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8094",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(body), nil},
+			}, nil
+		},
+	}
+}
+
+func TestSearchQueryDeduplicateHits(t *testing.T) {
+	body := `{"status":{"total":2,"successful":2},"total_hits":4,"hits":[` +
+		`{"id":"a","score":4},{"id":"b","score":3},{"id":"a","score":2},{"id":"c","score":1}]}`
+	cluster := testGetClusterForHTTP(testSearchProvider(body), 0, 0, 10*time.Second)
+	query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+
+	res, err := cluster.SearchQuery(query, nil)
+	if err != nil {
+		t.Fatalf("Expected search query to succeed but was %v", err)
+	}
+	if len(res.Hits()) != 4 || res.DuplicatesRemoved() != 0 {
+		t.Fatalf("Expected hits not to be deduplicated by default, had %d hits", len(res.Hits()))
+	}
+
+	res, err = cluster.SearchQuery(query, &SearchQueryOptions{DeduplicateHits: true})
+	if err != nil {
+		t.Fatalf("Expected search query to succeed but was %v", err)
+	}
+	if res.DuplicatesRemoved() != 1 {
+		t.Fatalf("Expected 1 duplicate to be removed but was %d", res.DuplicatesRemoved())
+	}
+
+	hits := res.Hits()
+	if len(hits) != 3 || hits[0].Id != "a" || hits[0].Score != 4 || hits[1].Id != "b" || hits[2].Id != "c" {
+		t.Fatalf("Expected highest ranked hit for each id to be kept in order but was %v", hits)
+	}
+}
+
+func TestSearchResultHitFieldBytes(t *testing.T) {
+	hit := SearchResultHit{
+		Fields: map[string]string{
+			"padded":   "AAEC/w==",
+			"unpadded": "AAEC/w",
+			"text":     "not base64!",
+		},
+	}
+
+	for _, name := range []string{"padded", "unpadded"} {
+		value, err := hit.FieldBytes(name)
+		if err != nil {
+			t.Fatalf("Expected field %s to decode but error was %v", name, err)
+		}
+		if !bytes.Equal(value, []byte{0, 1, 2, 255}) {
+			t.Fatalf("Unexpected value for field %s: %v", name, value)
+		}
+	}
+
+	_, err := hit.FieldBytes("text")
+	if err == nil {
+		t.Fatalf("Expected non-base64 field to fail to decode")
+	}
+
+	_, err = hit.FieldBytes("missing")
+	if errors.Cause(err) != ErrSearchFieldNotFound {
+		t.Fatalf("Expected missing field error but was %v", err)
+	}
+}
+
+func TestSearchResultHitPreservesZeroValues(t *testing.T) {
+	body := `{"status":{"total":1,"failed":0,"successful":1},"total_hits":1,"hits":[{"index":"idx","id":"a",` +
+		`"score":0,"locations":{"name":{"beer":[{"position":0,"start":0,"end":4}]}}}],` +
+		`"facets":{"type":{"field":"type","total":1,"missing":0,"other":0,"terms":[{"term":"beer","count":0}]}}}`
+	cluster := testGetClusterForHTTP(testSearchProvider(body), 0, 0, 60*time.Second)
+
+	res, err := cluster.SearchQuery(SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}, nil)
+	if err != nil {
+		t.Fatalf("Expected search to succeed but was %v", err)
+	}
+
+	hitBytes, err := json.Marshal(res.Hits()[0])
+	if err != nil {
+		t.Fatalf("Failed to marshal hit: %v", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(hitBytes, &fields); err != nil {
+		t.Fatalf("Failed to unmarshal hit: %v", err)
+	}
+	if _, ok := fields["score"]; !ok {
+		t.Fatalf("Expected zero score to be marshaled but was %s", hitBytes)
+	}
+
+	var hit SearchResultHit
+	if err := json.Unmarshal(hitBytes, &hit); err != nil {
+		t.Fatalf("Failed to unmarshal hit: %v", err)
+	}
+	if !reflect.DeepEqual(hit, res.Hits()[0]) {
+		t.Fatalf("Expected hit to round trip but was %+v", hit)
+	}
+	location := hit.Locations["name"]["beer"][0]
+	if location.Position != 0 || location.End != 4 || !bytes.Contains(hitBytes, []byte(`"position":0`)) {
+		t.Fatalf("Expected location at position 0 to be preserved but was %s", hitBytes)
+	}
+
+	facetBytes, err := json.Marshal(res.Facets()["type"])
+	if err != nil {
+		t.Fatalf("Failed to marshal facet: %v", err)
+	}
+	if !bytes.Contains(facetBytes, []byte(`"missing":0`)) || !bytes.Contains(facetBytes, []byte(`"count":0`)) {
+		t.Fatalf("Expected zero facet counts to be marshaled but was %s", facetBytes)
+	}
+}
+
+func TestSearchQueryTimeoutFollowsContext(t *testing.T) {
+	var ctl struct {
+		Ctl struct {
+			Timeout int64 `json:"timeout"`
+		} `json:"ctl"`
+	}
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			if err := json.Unmarshal(req.Body, &ctl); err != nil {
+				t.Fatalf("Expected search request body to be JSON but was %v", err)
+			}
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8094",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(`{"status":{"total":1,"successful":1}}`), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 0, 0, 10*time.Second)
+	query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+
+	_, err := cluster.SearchQuery(query, nil)
+	if err != nil {
+		t.Fatalf("Expected search query to succeed but was %v", err)
+	}
+	if ctl.Ctl.Timeout <= 9000 || ctl.Ctl.Timeout > 10000 {
+		t.Fatalf("Expected cluster search timeout to be sent but was %dms", ctl.Ctl.Timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err = cluster.SearchQuery(query, &SearchQueryOptions{Context: ctx, Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Expected search query to succeed but was %v", err)
+	}
+	if ctl.Ctl.Timeout <= 0 || ctl.Ctl.Timeout > 2000 {
+		t.Fatalf("Expected time remaining before the context deadline to be sent but was %dms", ctl.Ctl.Timeout)
+	}
+}
+
+func TestSearchQueryContextDone(t *testing.T) {
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			<-req.Context.Done()
+			return nil, &url.Error{Op: "Post", URL: "http://localhost:8094", Err: req.Context.Err()}
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 0, 0, 10*time.Second)
+	query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err := cluster.SearchQuery(query, &SearchQueryOptions{Context: ctx})
+	if err != context.Canceled {
+		t.Fatalf("Expected cancelled search to fail with the context error but was %v", err)
+	}
+
+	_, err = cluster.SearchQuery(query, &SearchQueryOptions{Timeout: 10 * time.Millisecond})
+	if !IsTimeoutError(err) {
+		t.Fatalf("Expected search to time out but was %v", err)
+	}
+}
+
+func TestSearchQueryConsistentWith(t *testing.T) {
+	var body []byte
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			if req.Method == "GET" && req.Path == "/api/index/idx" {
+				return &gocbcore.HttpResponse{
+					Endpoint:   "http://localhost:8094",
+					StatusCode: 200,
+					Body: &testReadCloser{bytes.NewBufferString(
+						`{"status":"ok","indexDef":{"type":"fulltext-index","name":"idx","sourceName":"default"}}`), nil},
+				}, nil
+			}
+
+			body = req.Body
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8094",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(`{"status":{"total":1,"successful":1}}`), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 0, 0, 10*time.Second)
+	query := SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}}
+
+	state := NewMutationState(
+		MutationToken{token: gocbcore.MutationToken{VbId: 12, VbUuid: 1234, SeqNo: 5}, bucketName: "default"},
+		MutationToken{token: gocbcore.MutationToken{VbId: 40, VbUuid: 5678, SeqNo: 9}, bucketName: "default"},
+		// Tokens for other buckets than the one the index is built on are left out.
+		MutationToken{token: gocbcore.MutationToken{VbId: 12, VbUuid: 999, SeqNo: 50}, bucketName: "other"},
+	)
+	_, err := cluster.SearchQuery(query, &SearchQueryOptions{ConsistentWith: state})
+	if err != nil {
+		t.Fatalf("Expected search query to succeed but was %v", err)
+	}
+
+	var sent struct {
+		Ctl struct {
+			Consistency struct {
+				Level   string                       `json:"level"`
+				Vectors map[string]map[string]uint64 `json:"vectors"`
+			} `json:"consistency"`
+		} `json:"ctl"`
+	}
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatalf("Expected search request body to be JSON but was %v", err)
+	}
+	expected := map[string]map[string]uint64{"idx": {"12/1234": 5, "40/5678": 9}}
+	if sent.Ctl.Consistency.Level != "at_plus" || !reflect.DeepEqual(sent.Ctl.Consistency.Vectors, expected) {
+		t.Fatalf("Expected at_plus consistency with vectors for the index but was %s", body)
+	}
+
+	// Operations return an empty token when mutation tokens are not enabled on the bucket.
+	_, err = cluster.SearchQuery(query, &SearchQueryOptions{ConsistentWith: NewMutationState(MutationToken{bucketName: "default"})})
+	if err == nil {
+		t.Fatalf("Expected error when ConsistentWith has no mutation tokens")
+	}
+
+	otherState := NewMutationState(
+		MutationToken{token: gocbcore.MutationToken{VbId: 12, VbUuid: 999, SeqNo: 50}, bucketName: "other"},
+	)
+	_, err = cluster.SearchQuery(query, &SearchQueryOptions{ConsistentWith: otherState})
+	if err == nil {
+		t.Fatalf("Expected error when ConsistentWith has no mutation tokens for the bucket of the index")
+	}
+}
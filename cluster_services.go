@@ -0,0 +1,107 @@
+package gocb
+
+// getQueryProvider returns the provider for query requests, failing with a ServiceNotFoundError if the
+// cluster config shows that no node is running the query service.
+func (c *Cluster) getQueryProvider() (httpProvider, error) {
+	return c.getServiceProvider("query", N1qlService, func(provider httpProvider) ([]string, bool) {
+		p, ok := provider.(interface{ N1qlEps() []string })
+		if !ok {
+			return nil, false
+		}
+		return p.N1qlEps(), true
+	})
+}
+
+// getSearchProvider returns the provider for search requests, failing with a ServiceNotFoundError if the
+// cluster config shows that no node is running the search service.
+func (c *Cluster) getSearchProvider() (httpProvider, error) {
+	return c.getServiceProvider("search", FtsService, func(provider httpProvider) ([]string, bool) {
+		p, ok := provider.(interface{ FtsEps() []string })
+		if !ok {
+			return nil, false
+		}
+		return p.FtsEps(), true
+	})
+}
+
+// getAnalyticsProvider returns the provider for analytics requests, failing with a ServiceNotFoundError if
+// the cluster config shows that no node is running the analytics service.
+func (c *Cluster) getAnalyticsProvider() (httpProvider, error) {
+	return c.getServiceProvider("analytics", CbasService, func(provider httpProvider) ([]string, bool) {
+		p, ok := provider.(interface{ CbasEps() []string })
+		if !ok {
+			return nil, false
+		}
+		return p.CbasEps(), true
+	})
+}
+
+// getServiceProvider returns the HTTP provider, checking that the service is running on at least one node so
+// that requests fail immediately rather than when they time out.  Before a cluster config has been received
+// every endpoint list is empty, so the check is only made once the config lists the management endpoints, which
+// every node has.  Providers which do not expose their endpoints are not checked.  The provider uses the circuit
+// breakers if they are enabled.  Query and search requests are retried once on a different node when a
+// connection to their node cannot be made.
+func (c *Cluster) getServiceProvider(service string, serviceType ServiceType,
+	endpoints func(httpProvider) ([]string, bool)) (httpProvider, error) {
+	provider, err := c.getHTTPProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	mgmt, ok := provider.(interface{ MgmtEps() []string })
+	if ok && len(mgmt.MgmtEps()) > 0 {
+		eps, ok := endpoints(provider)
+		if ok && len(eps) == 0 {
+			return nil, serviceNotFoundError{service: service}
+		}
+	}
+
+	provider = c.withFallbackHost(serviceType, provider)
+	return c.withCircuitBreakers(serviceType, provider), nil
+}
+
+// serviceEndpoints returns the endpoints of service known to provider, or nil if it does not expose them.
+func serviceEndpoints(provider httpProvider, service ServiceType) []string {
+	switch service {
+	case N1qlService:
+		if p, ok := provider.(interface{ N1qlEps() []string }); ok {
+			return p.N1qlEps()
+		}
+	case FtsService:
+		if p, ok := provider.(interface{ FtsEps() []string }); ok {
+			return p.FtsEps()
+		}
+	case CbasService:
+		if p, ok := provider.(interface{ CbasEps() []string }); ok {
+			return p.CbasEps()
+		}
+	case MgmtService:
+		if p, ok := provider.(interface{ MgmtEps() []string }); ok {
+			return p.MgmtEps()
+		}
+	}
+	return nil
+}
+
+// endpointForwarder is embedded by providers which wrap another, so that they expose the endpoints of the
+// provider that they wrap.
+type endpointForwarder struct {
+	httpProvider
+}
+
+func (p endpointForwarder) N1qlEps() []string {
+	return serviceEndpoints(p.httpProvider, N1qlService)
+}
+
+func (p endpointForwarder) FtsEps() []string {
+	return serviceEndpoints(p.httpProvider, FtsService)
+}
+
+func (p endpointForwarder) CbasEps() []string {
+	return serviceEndpoints(p.httpProvider, CbasService)
+}
+
+func (p endpointForwarder) MgmtEps() []string {
+	return serviceEndpoints(p.httpProvider, MgmtService)
+}
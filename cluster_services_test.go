@@ -0,0 +1,83 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/cbft"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type servicesHTTPProvider struct {
+	*mockHTTPProvider
+	mgmtEps []string
+	n1qlEps []string
+	ftsEps  []string
+	cbasEps []string
+}
+
+func (p *servicesHTTPProvider) MgmtEps() []string {
+	return p.mgmtEps
+}
+
+func (p *servicesHTTPProvider) N1qlEps() []string {
+	return p.n1qlEps
+}
+
+func (p *servicesHTTPProvider) FtsEps() []string {
+	return p.ftsEps
+}
+
+func (p *servicesHTTPProvider) CbasEps() []string {
+	return p.cbasEps
+}
+
+func TestServiceNotAvailableFailsFast(t *testing.T) {
+	var requests int
+	provider := &servicesHTTPProvider{
+		mgmtEps: []string{"http://node1:8091"},
+		mockHTTPProvider: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				requests++
+				return nil, errors.New("request should not have been sent")
+			},
+		},
+	}
+
+	cluster := testGetClusterForHTTP(nil, time.Second, time.Second, time.Second)
+	cluster.connections["mock-false"].(*mockClient).mockHTTPProvider = provider
+
+	_, err := cluster.Query("SELECT 1=1", nil)
+	if !IsServiceNotFoundError(err) {
+		t.Fatalf("Expected query to fail with a service not found error but error was %v", err)
+	}
+
+	_, err = cluster.SearchQuery(SearchQuery{Name: "index", Query: cbft.NewMatchQuery("a")}, nil)
+	if !IsServiceNotFoundError(err) {
+		t.Fatalf("Expected search query to fail with a service not found error but error was %v", err)
+	}
+
+	_, err = cluster.AnalyticsQuery("SELECT 1=1", nil)
+	if !IsServiceNotFoundError(err) {
+		t.Fatalf("Expected analytics query to fail with a service not found error but error was %v", err)
+	}
+
+	if requests != 0 {
+		t.Fatalf("Expected no requests to be sent but %d were", requests)
+	}
+}
+
+func TestServiceCheckSkippedWithoutConfig(t *testing.T) {
+	provider := &servicesHTTPProvider{mockHTTPProvider: &mockHTTPProvider{}}
+	cluster := testGetClusterForHTTP(nil, time.Second, time.Second, time.Second)
+	cluster.connections["mock-false"].(*mockClient).mockHTTPProvider = provider
+
+	p, err := cluster.getQueryProvider()
+	if err != nil {
+		t.Fatalf("Expected provider to be returned before a config is received but error was %v", err)
+	}
+	if p != provider {
+		t.Fatalf("Expected the HTTP provider to be returned")
+	}
+}
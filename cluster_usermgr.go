@@ -1,11 +1,13 @@
 package gocb
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/url"
 	"strings"
+	"time"
 
 	"gopkg.in/couchbase/gocbcore.v7"
 )
@@ -15,6 +17,21 @@ type UserManager struct {
 	httpClient httpProvider
 }
 
+// WithContext returns a copy of the manager whose operations are cancelled once ctx is done.
+func (um *UserManager) WithContext(ctx context.Context) *UserManager {
+	newM := *um
+	newM.httpClient = asMgmtProvider(um.httpClient).withContext(ctx)
+	return &newM
+}
+
+// WithTimeout returns a copy of the manager whose operations time out after timeout, rather than after
+// ClusterOptions.ManagementTimeout.  Requests which are safe to repeat are retried within the timeout.
+func (um *UserManager) WithTimeout(timeout time.Duration) *UserManager {
+	newM := *um
+	newM.httpClient = asMgmtProvider(um.httpClient).withTimeout(timeout)
+	return &newM
+}
+
 // UserRole represents a role for a particular user on the server.
 type UserRole struct {
 	Role       string
@@ -82,6 +99,9 @@ func transformUserJson(userData *userJson) User {
 
 // GetUsers returns a list of all users on the cluster.
 func (um *UserManager) GetUsers(domain AuthDomain) ([]*User, error) {
+	span := startManagerTrace("users", "get_all_users", "mgmt")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(MgmtService),
 		Method:  "GET",
@@ -123,6 +143,9 @@ func (um *UserManager) GetUsers(domain AuthDomain) ([]*User, error) {
 
 // GetUser returns the data for a particular user
 func (um *UserManager) GetUser(domain AuthDomain, name string) (*User, error) {
+	span := startManagerTrace("users", "get_user", "mgmt")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(MgmtService),
 		Method:  "GET",
@@ -159,6 +182,9 @@ func (um *UserManager) GetUser(domain AuthDomain, name string) (*User, error) {
 
 // UpsertUser updates a built-in RBAC user on the cluster.
 func (um *UserManager) UpsertUser(domain AuthDomain, name string, settings *UserSettings) error {
+	span := startManagerTrace("users", "upsert_user", "mgmt")
+	defer span.Finish()
+
 	var reqRoleStrs []string
 	for _, roleData := range settings.Roles {
 		reqRoleStrs = append(reqRoleStrs, fmt.Sprintf("%s[%s]", roleData.Role, roleData.BucketName))
@@ -199,6 +225,9 @@ func (um *UserManager) UpsertUser(domain AuthDomain, name string, settings *User
 
 // RemoveUser removes a built-in RBAC user on the cluster.
 func (um *UserManager) RemoveUser(domain AuthDomain, name string) error {
+	span := startManagerTrace("users", "drop_user", "mgmt")
+	defer span.Finish()
+
 	req := &gocbcore.HttpRequest{
 		Service: gocbcore.ServiceType(MgmtService),
 		Method:  "DELETE",
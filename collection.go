@@ -10,24 +10,6 @@ import (
 	gocbcore "gopkg.in/couchbase/gocbcore.v7"
 )
 
-// type Collection interface {
-// 	// Name() string
-// 	Get(id string, spec *GetSpec, opts *GetOptions) (*GetResult, error)
-// 	// Append(id string, val interface{}, opts *AppendOptions) (*MutationResult, error)
-// 	// Prepend(id string, val interface{}, opts *PrependOptions) (*MutationResult, error)
-// 	// Touch(id string, opts *TouchOptions) (*MutationResult, error)
-// 	// Unlock(id string, opts *UnlockOptions) (*MutationResult, error)
-// 	// Increment(id string, opts *IncrementOptions) (*MutationResult, error)
-// 	// Decrement(id string, opts *DecrementOptions) (*MutationResult, error)
-// 	Upsert(id string, val interface{}, opts *UpsertOptions) (*MutationResult, error)
-// 	Insert(id string, val interface{}, opts *InsertOptions) (*MutationResult, error)
-// 	Replace(id string, val interface{}, opts *ReplaceOptions) (*MutationResult, error)
-// 	Remove(id string, opts *RemoveOptions) (*MutationResult, error)
-// 	Mutate(id string, spec MutateSpec, opts *MutateOptions) (*MutationResult, error)
-
-// 	SetKvTimeout(duration time.Duration) Collection
-// }
-
 type Collection struct {
 	sb  stateBlock
 	csb *collectionStateBlock
@@ -37,6 +19,10 @@ type CollectionOptions struct {
 	ParentSpanContext opentracing.SpanContext
 	Timeout           time.Duration
 	Context           context.Context
+	// HashLongKeys shortens keys longer than the 250 byte maximum to a prefix of the key followed by its SHA1
+	// hash, rather than failing operations on them with ErrInvalidArgument.  This allows user generated ids of
+	// any length to be used as keys but the stored keys then differ from those given.
+	HashLongKeys bool
 }
 
 func (c *Collection) setCollectionID(collectionID uint32) error {
@@ -81,16 +67,11 @@ func newCollection(scope *Scope, collectionName string, opts *CollectionOptions)
 	}
 
 	collection := &Collection{
-		sb:  scope.stateBlock(),
+		sb:  scope.stateBlock().withCollection(collectionName).withHashLongKeys(opts.HashLongKeys),
 		csb: &collectionStateBlock{},
 	}
-	collection.sb.CollectionName = collectionName
-	collection.sb.KvTimeout = 10 * time.Second
-	collection.sb.DuraTimeout = 40000 * time.Millisecond
-	collection.sb.DuraPollTimeout = 100 * time.Millisecond
-	collection.sb.recacheClient()
 
-	span := collection.startKvOpTrace(opts.ParentSpanContext, "GetCollectionID")
+	span := collection.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "GetCollectionID")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -103,6 +84,7 @@ func newCollection(scope *Scope, collectionName string, opts *CollectionOptions)
 	defer cancel()
 
 	cli := collection.sb.getCachedClient()
+	atomic.StoreUint32(&collection.csb.BucketGeneration, cli.bucketGeneration())
 	collectionID, err := cli.fetchCollectionID(deadlinedCtx, collection.sb.ScopeName, collection.sb.CollectionName)
 	if err != nil {
 		if gocbcore.IsErrorStatus(err, gocbcore.StatusScopeUnknown) {
@@ -124,17 +106,59 @@ func newCollection(scope *Scope, collectionName string, opts *CollectionOptions)
 	return collection, nil
 }
 
+// refreshCollectionID resolves the collection id again after the bucket has been recreated, at which
+// point both the cached id and any unknown scope or collection state may be stale.
+func (c *Collection) refreshCollectionID(cli client, generation uint32) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.sb.KvTimeout)
+	defer cancel()
+
+	collectionID, err := cli.fetchCollectionID(ctx, c.sb.ScopeName, c.sb.CollectionName)
+	if err != nil {
+		if gocbcore.IsErrorStatus(err, gocbcore.StatusScopeUnknown) {
+			atomic.StoreUint32(&c.csb.BucketGeneration, generation)
+			c.setScopeUnknown()
+			return maybeEnhanceErr(err, "")
+		}
+		if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
+			atomic.StoreUint32(&c.csb.BucketGeneration, generation)
+			c.setCollectionUnknown()
+			return maybeEnhanceErr(err, "")
+		}
+
+		// Leave the generation alone so that the next operation tries again.
+		return err
+	}
+
+	atomic.StoreUint32(&c.csb.BucketGeneration, generation)
+	atomic.StoreUint32(&c.csb.CollectionID, collectionID)
+	atomic.StoreUint32(&c.csb.ScopeUnknown, 0)
+	atomic.StoreUint32(&c.csb.CollectionUnknown, 0)
+
+	return nil
+}
+
 func (c *Collection) clone() *Collection {
 	newC := *c
 	return &newC
 }
 
-func (c *Collection) getKvProvider() (kvProvider, error) {
+// getKvProvider returns the provider to dispatch an operation, whose context is ctx, through.
+func (c *Collection) getKvProvider(ctx context.Context) (kvProvider, error) {
 	cli := c.sb.getCachedClient()
 	agent, err := cli.getKvProvider()
 	if err != nil {
 		return nil, err
 	}
+	if waiting, ok := agent.(*overloadWaitingProvider); ok {
+		agent = waiting.withContext(ctx)
+	}
+
+	if generation := cli.bucketGeneration(); generation != atomic.LoadUint32(&c.csb.BucketGeneration) {
+		err = c.refreshCollectionID(cli, generation)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	if c.scopeUnknown() {
 		return nil, kvError{
@@ -150,42 +174,78 @@ func (c *Collection) getKvProvider() (kvProvider, error) {
 		}
 	}
 
-	return agent, nil
+	var provider kvProvider = &keyCheckingProvider{kvProvider: agent, prefix: c.sb.KeyPrefix, hashLong: c.sb.HashLongKeys}
+	if c.sb.ReadOnly {
+		provider = &readOnlyProvider{kvProvider: provider}
+	}
+
+	return provider, nil
 }
 
 // func (c *Collection) WithDurability(persistTo, replicateTo uint) *Collection {
 // 	n := c.clone()
-// 	n.sb.PersistTo = persistTo
-// 	n.sb.ReplicateTo = replicateTo
-// 	n.sb.recacheClient()
+// 	n.sb = n.sb.withDurability(persistTo, replicateTo)
 // 	return n
 // }
 
 func (c *Collection) WithOperationTimeout(duration time.Duration) *Collection {
 	n := c.clone()
-	n.sb.KvTimeout = duration
-	n.sb.recacheClient()
+	n.sb = c.sb.withKvTimeout(duration)
+	return n
+}
+
+// WithJSONValidation returns a copy of the Collection which checks that every value encoded as JSON is valid UTF-8
+// JSON before it is written, failing the write with ErrInvalidValue if not.  This stops invalid documents, such as
+// those produced by custom encoders, from being stored where they would break N1QL indexing.
+func (c *Collection) WithJSONValidation() *Collection {
+	n := c.clone()
+	n.sb = c.sb.withValidateJSON(true)
+	return n
+}
+
+// WithKeyPrefix returns a copy of the Collection which adds prefix to the key of every operation, for example
+// to keep the documents of each tenant of an application sharing a bucket apart.  Results report the keys given,
+// without the prefix.  Prefixes are added to any prefix that the Collection already has.
+func (c *Collection) WithKeyPrefix(prefix string) *Collection {
+	n := c.clone()
+	n.sb = c.sb.withKeyPrefix(c.sb.KeyPrefix + prefix)
+	return n
+}
+
+// WithObservabilityName returns a copy of the Collection which is identified by name, rather than by
+// bucket.scope.collection, in the couchbase.keyspace tag of the spans of its operations and the Keyspace label of
+// its metrics.  This allows latency to be broken down by, for example, the part of an application using it.
+func (c *Collection) WithObservabilityName(name string) *Collection {
+	n := c.clone()
+	n.sb = c.sb.withObservabilityName(name)
 	return n
 }
 
 // startKvOpTrace starts a new span for a given operationName. If parentSpanCtx is not nil then the span will be a
-// ChildOf that span context.
+// ChildOf that span context, unless parentSpanCtx marks the operation as untraced in which case a no-op span is returned.
+// A no-op span is also returned when no tracer is registered.
 func (c *Collection) startKvOpTrace(parentSpanCtx opentracing.SpanContext, operationName string) opentracing.Span {
-	var span opentracing.Span
-	if parentSpanCtx == nil {
-		span = opentracing.GlobalTracer().StartSpan(operationName,
-			opentracing.Tag{Key: "couchbase.collection", Value: c.sb.CollectionName},
-			opentracing.Tag{Key: "couchbase.service", Value: "kv"})
-	} else {
-		span = opentracing.GlobalTracer().StartSpan(operationName,
-			opentracing.Tag{Key: "couchbase.collection", Value: c.sb.CollectionName},
-			opentracing.Tag{Key: "couchbase.service", Value: "kv"}, opentracing.ChildOf(parentSpanCtx))
+	if isUntraced(parentSpanCtx) || !tracingEnabled() {
+		return newUntracedSpan()
+	}
+
+	opts := []opentracing.StartSpanOption{
+		opentracing.Tag{Key: "couchbase.bucket", Value: c.sb.BucketName},
+		opentracing.Tag{Key: "couchbase.scope", Value: c.sb.ScopeName},
+		opentracing.Tag{Key: "couchbase.collection", Value: c.sb.CollectionName},
+		opentracing.Tag{Key: "couchbase.keyspace", Value: c.keyspaceLabel()},
+		opentracing.Tag{Key: "couchbase.service", Value: "kv"},
+	}
+	if parentSpanCtx != nil {
+		opts = append(opts, opentracing.ChildOf(parentSpanCtx))
 	}
 
-	return span
+	return opentracing.GlobalTracer().StartSpan(operationName, opts...)
 }
 
+// SetKvTimeout sets the KV operation timeout of the Collection to duration, returning the Collection.  It must not
+// be called while the Collection is in use by other goroutines, use WithOperationTimeout for that.
 func (c *Collection) SetKvTimeout(duration time.Duration) *Collection {
-	c.sb.KvTimeout = duration
+	c.sb = c.sb.withKvTimeout(duration)
 	return c
 }
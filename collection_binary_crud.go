@@ -2,9 +2,11 @@ package gocb
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
@@ -18,6 +20,10 @@ type AppendOptions struct {
 	ParentSpanContext opentracing.SpanContext
 	Timeout           time.Duration
 	Context           context.Context
+	// MaxSize, if set, is the largest size in bytes that the document may grow to.  The current size of the
+	// document is fetched before the operation and ErrValueTooLarge returned if it would be exceeded.  Note
+	// that the check does not guard against concurrent modification of the document.
+	MaxSize uint32
 }
 
 // Append appends a byte value to a document.
@@ -26,7 +32,7 @@ func (c *CollectionBinary) Append(key string, val []byte, opts *AppendOptions) (
 		opts = &AppendOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "BinaryAppend")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "BinaryAppend")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -38,24 +44,33 @@ func (c *CollectionBinary) Append(key string, val []byte, opts *AppendOptions) (
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	if opts.MaxSize > 0 {
+		err = c.checkAdjoinSize(deadlinedCtx, span.Context(), agent, key, len(val), opts.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.AppendEx(gocbcore.AdjoinOptions{
 		Key:          []byte(key),
 		Value:        val,
 		CollectionID: c.collectionID(),
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "append"),
 	}, func(res *gocbcore.AdjoinResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = err
+			errOut = ctrl.recordErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -68,6 +83,7 @@ func (c *CollectionBinary) Append(key string, val []byte, opts *AppendOptions) (
 			mt: mutTok,
 		}
 		mutOut.cas = Cas(res.Cas)
+		c.recordDocumentWrite("append", len(val))
 
 		ctrl.resolve()
 	}))
@@ -83,6 +99,10 @@ type PrependOptions struct {
 	ParentSpanContext opentracing.SpanContext
 	Timeout           time.Duration
 	Context           context.Context
+	// MaxSize, if set, is the largest size in bytes that the document may grow to.  The current size of the
+	// document is fetched before the operation and ErrValueTooLarge returned if it would be exceeded.  Note
+	// that the check does not guard against concurrent modification of the document.
+	MaxSize uint32
 }
 
 // Prepend prepends a byte value to a document.
@@ -91,7 +111,7 @@ func (c *CollectionBinary) Prepend(key string, val []byte, opts *PrependOptions)
 		opts = &PrependOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "BinaryPrepend")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "BinaryPrepend")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -103,24 +123,33 @@ func (c *CollectionBinary) Prepend(key string, val []byte, opts *PrependOptions)
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	if opts.MaxSize > 0 {
+		err = c.checkAdjoinSize(deadlinedCtx, span.Context(), agent, key, len(val), opts.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.PrependEx(gocbcore.AdjoinOptions{
 		Key:          []byte(key),
 		Value:        val,
 		CollectionID: c.collectionID(),
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "prepend"),
 	}, func(res *gocbcore.AdjoinResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = err
+			errOut = ctrl.recordErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -133,6 +162,62 @@ func (c *CollectionBinary) Prepend(key string, val []byte, opts *PrependOptions)
 			mt: mutTok,
 		}
 		mutOut.cas = Cas(res.Cas)
+		c.recordDocumentWrite("prepend", len(val))
+
+		ctrl.resolve()
+	}))
+	if err != nil {
+		errOut = err
+	}
+
+	return
+}
+
+// checkAdjoinSize returns ErrValueTooLarge if adding valLen bytes to the document would take it over maxSize.
+func (c *CollectionBinary) checkAdjoinSize(ctx context.Context, traceCtx opentracing.SpanContext, agent kvProvider,
+	key string, valLen int, maxSize uint32) (errOut error) {
+	if uint64(valLen) > uint64(maxSize) {
+		return ErrValueTooLarge
+	}
+
+	ctrl := c.newOpManager(ctx, key)
+	err := ctrl.wait(agent.LookupInEx(gocbcore.LookupInOptions{
+		Key: []byte(key),
+		Ops: []gocbcore.SubDocOp{{
+			Op:    gocbcore.SubDocOpGet,
+			Path:  "$document.value_bytes",
+			Flags: gocbcore.SubdocFlag(SubdocFlagXattr),
+		}},
+		CollectionID: c.collectionID(),
+		TraceContext: c.kvTraceContext(traceCtx, "adjoin_size_check"),
+	}, func(res *gocbcore.LookupInResult, err error) {
+		if err != nil {
+			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
+				c.setCollectionUnknown()
+			}
+
+			errOut = ctrl.enhanceErr(err)
+			ctrl.resolve()
+			return
+		}
+
+		if len(res.Ops) != 1 || res.Ops[0].Err != nil {
+			errOut = ErrDocumentSizeUnavailable
+			ctrl.resolve()
+			return
+		}
+
+		var size uint64
+		err = json.Unmarshal(res.Ops[0].Value, &size)
+		if err != nil {
+			errOut = errors.Wrap(err, "failed to parse the current document size")
+			ctrl.resolve()
+			return
+		}
+
+		if size+uint64(valLen) > uint64(maxSize) {
+			errOut = ErrValueTooLarge
+		}
 
 		ctrl.resolve()
 	}))
@@ -146,11 +231,21 @@ func (c *CollectionBinary) Prepend(key string, val []byte, opts *PrependOptions)
 // CounterOptions are the options available to the Counter operation.
 type CounterOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 	// Expiration is the length of time in seconds that the document will be stored in Couchbase.
 	// A value of 0 will set the document to never expire.
 	Expiration uint32
+	// ExpiresAt is the time at which the document will expire, it cannot be used together with Expiration.
+	ExpiresAt time.Time
+	// UpdateExpiry also applies Expiration or ExpiresAt to an existing document.  By default, as the server only
+	// applies the expiry of a counter operation when creating the document, the expiry of an existing document is
+	// left unchanged.  With UpdateExpiry the document is touched after the operation to set its expiry.  The touch
+	// is a separate operation so is not atomic with the counter update, the CAS and mutation token returned are
+	// those of the touch.  If the touch fails then the result of the counter operation, which has been applied, is
+	// returned along with an error whose cause is ErrCounterExpiryNotSet, the operation must not be retried.
+	UpdateExpiry bool
 	// Initial, if non-negative, is the `initial` value to use for the document if it does not exist.
 	// If present, this is the value that will be returned by a successful operation.
 	Initial int64
@@ -158,6 +253,56 @@ type CounterOptions struct {
 	Delta uint64
 }
 
+func (opts *CounterOptions) expiry() (uint32, error) {
+	if opts.ExpiresAt.IsZero() {
+		return opts.Expiration, nil
+	}
+
+	if opts.Expiration > 0 {
+		return 0, errors.New("Expiration and ExpiresAt must be used exclusively")
+	}
+
+	// The server treats expiries of more than 30 days as absolute unix timestamps.
+	return uint32(opts.ExpiresAt.Unix()), nil
+}
+
+// applyCounterExpiry sets the expiry of a counter document following a counter operation, updating countOut with
+// the result of doing so.  Failing to do so returns ErrCounterExpiryNotSet, as the counter operation itself has
+// been applied.
+func (c *CollectionBinary) applyCounterExpiry(ctx context.Context, traceCtx opentracing.SpanContext, agent kvProvider,
+	key string, expiry uint32, countOut *CounterResult) (errOut error) {
+	ctrl := c.newOpManager(ctx, key)
+	err := ctrl.wait(agent.TouchEx(gocbcore.TouchOptions{
+		Key:          []byte(key),
+		CollectionID: c.collectionID(),
+		Expiry:       expiry,
+		TraceContext: c.kvTraceContext(traceCtx, "touch"),
+	}, func(res *gocbcore.TouchResult, err error) {
+		if err != nil {
+			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
+				c.setCollectionUnknown()
+			}
+
+			errOut = errors.Wrapf(ErrCounterExpiryNotSet, "%s", ctrl.enhanceErr(err))
+			ctrl.resolve()
+			return
+		}
+
+		countOut.cas = Cas(res.Cas)
+		countOut.mt = MutationToken{
+			token:      res.MutationToken,
+			bucketName: c.sb.BucketName,
+		}
+
+		ctrl.resolve()
+	}))
+	if err != nil {
+		errOut = err
+	}
+
+	return
+}
+
 // Increment performs an atomic addition for an integer document. Passing a
 // non-negative `initial` value will cause the document to be created if it did not
 // already exist.
@@ -166,7 +311,7 @@ func (c *CollectionBinary) Increment(key string, opts *CounterOptions) (countOut
 		opts = &CounterOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Counter")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Counter")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -183,26 +328,33 @@ func (c *CollectionBinary) Increment(key string, opts *CounterOptions) (countOut
 		realInitial = uint64(opts.Initial)
 	}
 
-	agent, err := c.getKvProvider()
+	expiry, err := opts.expiry()
+	if err != nil {
+		return nil, err
+	}
+
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.IncrementEx(gocbcore.CounterOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		Delta:        opts.Delta,
 		Initial:      realInitial,
-		Expiry:       opts.Expiration,
-		TraceContext: span.Context(),
+		Expiry:       expiry,
+		TraceContext: c.kvTraceContext(span.Context(), "increment"),
 	}, func(res *gocbcore.CounterResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = err
+			errOut = ctrl.recordErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -223,6 +375,10 @@ func (c *CollectionBinary) Increment(key string, opts *CounterOptions) (countOut
 		errOut = err
 	}
 
+	if errOut == nil && expiry > 0 && opts.UpdateExpiry {
+		errOut = c.applyCounterExpiry(deadlinedCtx, span.Context(), agent, key, expiry, countOut)
+	}
+
 	return
 }
 
@@ -234,7 +390,7 @@ func (c *CollectionBinary) Decrement(key string, opts *CounterOptions) (countOut
 		opts = &CounterOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Counter")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Counter")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -251,26 +407,33 @@ func (c *CollectionBinary) Decrement(key string, opts *CounterOptions) (countOut
 		realInitial = uint64(opts.Initial)
 	}
 
-	agent, err := c.getKvProvider()
+	expiry, err := opts.expiry()
+	if err != nil {
+		return nil, err
+	}
+
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.DecrementEx(gocbcore.CounterOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		Delta:        opts.Delta,
 		Initial:      realInitial,
-		Expiry:       opts.Expiration,
-		TraceContext: span.Context(),
+		Expiry:       expiry,
+		TraceContext: c.kvTraceContext(span.Context(), "decrement"),
 	}, func(res *gocbcore.CounterResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = err
+			errOut = ctrl.recordErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -291,5 +454,9 @@ func (c *CollectionBinary) Decrement(key string, opts *CounterOptions) (countOut
 		errOut = err
 	}
 
+	if errOut == nil && expiry > 0 && opts.UpdateExpiry {
+		errOut = c.applyCounterExpiry(deadlinedCtx, span.Context(), agent, key, expiry, countOut)
+	}
+
 	return
 }
@@ -0,0 +1,119 @@
+package gocb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestAppendMaxSize(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas: gocbcore.Cas(1),
+		Value: []gocbcore.SubDocResult{
+			{Value: []byte("10")},
+		},
+	}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Binary().Append("key", []byte("12345"), &AppendOptions{MaxSize: 14})
+	if err != ErrValueTooLarge {
+		t.Fatalf("Expected ErrValueTooLarge but was %v", err)
+	}
+
+	if len(provider.LookupInOps) != 1 || provider.LookupInOps[0].Path != "$document.value_bytes" {
+		t.Fatalf("Expected document size to be fetched but ops were %v", provider.LookupInOps)
+	}
+
+	res, err := col.Binary().Append("key", []byte("12345"), &AppendOptions{MaxSize: 15})
+	if err != nil {
+		t.Fatalf("Expected append to succeed but was %v", err)
+	}
+	if res.Cas() != Cas(1) {
+		t.Fatalf("Expected cas value to be %d but was %d", Cas(1), res.Cas())
+	}
+}
+
+func TestPrependMaxSizeSmallerThanValue(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas: gocbcore.Cas(1),
+	}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Binary().Prepend("key", []byte("12345"), &PrependOptions{MaxSize: 4})
+	if err != ErrValueTooLarge {
+		t.Fatalf("Expected ErrValueTooLarge but was %v", err)
+	}
+
+	if provider.LookupInOps != nil {
+		t.Fatalf("Expected no lookup to be made when the value alone is too large")
+	}
+}
+
+func TestIncrementExpiry(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(2),
+		Value: uint64(11),
+	}
+	col := testGetCollection(t, provider)
+
+	res, err := col.Binary().Increment("key", &CounterOptions{Delta: 1, Expiration: 60})
+	if err != nil {
+		t.Fatalf("Expected increment to succeed but was %v", err)
+	}
+	if res.Content() != 11 || res.Cas() != Cas(2) {
+		t.Fatalf("Expected value 11 and cas 2 but were %d and %d", res.Content(), res.Cas())
+	}
+	if !reflect.DeepEqual(provider.Expiries, []uint32{60}) {
+		t.Fatalf("Expected expiry to only be sent with the counter but was %v", provider.Expiries)
+	}
+
+	provider.Expiries = nil
+	_, err = col.Binary().Decrement("key", &CounterOptions{Delta: 1, Expiration: 60, UpdateExpiry: true})
+	if err != nil {
+		t.Fatalf("Expected decrement to succeed but was %v", err)
+	}
+	if !reflect.DeepEqual(provider.Expiries, []uint32{60, 60}) {
+		t.Fatalf("Expected expiry to be sent with the counter and a touch but was %v", provider.Expiries)
+	}
+
+	provider.Expiries = nil
+	expiresAt := time.Unix(1893456000, 0)
+	_, err = col.Binary().Increment("key", &CounterOptions{Delta: 1, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("Expected increment to succeed but was %v", err)
+	}
+	if !reflect.DeepEqual(provider.Expiries, []uint32{1893456000}) {
+		t.Fatalf("Expected absolute expiry to be sent but was %v", provider.Expiries)
+	}
+
+	_, err = col.Binary().Increment("key", &CounterOptions{Delta: 1, Expiration: 60, ExpiresAt: expiresAt})
+	if err == nil {
+		t.Fatalf("Expected increment with both Expiration and ExpiresAt to fail")
+	}
+}
+
+type failingTouchProvider struct {
+	*mocktest.KvOperator
+}
+
+func (p *failingTouchProvider) TouchEx(opts gocbcore.TouchOptions, cb gocbcore.TouchExCallback) (gocbcore.PendingOp, error) {
+	go cb(nil, gocbcore.ErrTimeout)
+	return &mocktest.PendingOp{}, nil
+}
+
+func TestIncrementExpiryTouchFails(t *testing.T) {
+	provider := &failingTouchProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(2), Value: uint64(11)}}
+	col := testGetCollection(t, provider)
+
+	res, err := col.Binary().Increment("key", &CounterOptions{Delta: 1, Expiration: 60, UpdateExpiry: true})
+	if errors.Cause(err) != ErrCounterExpiryNotSet {
+		t.Fatalf("Expected ErrCounterExpiryNotSet but was %v", err)
+	}
+	if res == nil || res.Content() != 11 {
+		t.Fatalf("Expected the result of the applied increment to be returned but was %v", res)
+	}
+}
@@ -0,0 +1,200 @@
+package gocb
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// CachedDocument is a document held within a DocumentCache.
+type CachedDocument struct {
+	Contents []byte
+	Flags    uint32
+	Cas      Cas
+}
+
+// DocumentCache is a look-aside cache which can be attached to a Collection using WithDocumentCache.
+// Full document Get operations are served from the cache when possible, with documents stored after they
+// have been fetched or written through Insert, Upsert or Replace.  Any other mutation of a document
+// invalidates it.  Implementations must be safe for concurrent use, and may be backed by an external
+// store such as Redis.
+//
+// Documents are cached under the key "bucket/scope/collection/key", where key includes any KeyPrefix, so a single
+// cache can be shared between collections.
+type DocumentCache interface {
+	// Get returns the document cached for key, if any.
+	Get(key string) (*CachedDocument, bool)
+	// Set stores the document for key, expiring it after ttl.  A zero ttl means that the document does not expire.
+	Set(key string, doc *CachedDocument, ttl time.Duration)
+	// Invalidate removes any document cached for key.
+	Invalidate(key string)
+}
+
+// WithDocumentCache returns a copy of the Collection which uses cache as a look-aside cache for documents,
+// each document being cached for at most ttl.  Note that the cache is not notified of changes made to
+// documents by other clients so ttl bounds how stale a cached document can be.
+func (c *Collection) WithDocumentCache(cache DocumentCache, ttl time.Duration) *Collection {
+	n := c.clone()
+	n.sb = c.sb.withDocumentCache(cache, ttl)
+	return n
+}
+
+// cacheKey returns the key which the document key is cached under.  Bucket, scope and collection names cannot
+// contain a slash so the key is unambiguous.
+func (c *Collection) cacheKey(key string) string {
+	return c.sb.BucketName + "/" + c.sb.ScopeName + "/" + c.sb.CollectionName + "/" + c.sb.KeyPrefix + key
+}
+
+func (c *Collection) cachedGet(key string) *GetResult {
+	if c.sb.DocumentCache == nil {
+		return nil
+	}
+
+	doc, ok := c.sb.DocumentCache.Get(c.cacheKey(key))
+	if !ok {
+		return nil
+	}
+
+	return &GetResult{
+		id:       key,
+		contents: doc.Contents,
+		flags:    doc.Flags,
+		cas:      doc.Cas,
+	}
+}
+
+func (c *Collection) cacheStore(key string, contents []byte, flags uint32, cas Cas) {
+	if c.sb.DocumentCache == nil {
+		return
+	}
+
+	c.sb.DocumentCache.Set(c.cacheKey(key), &CachedDocument{
+		Contents: contents,
+		Flags:    flags,
+		Cas:      cas,
+	}, c.sb.DocumentCacheTTL)
+}
+
+// cacheWriteThrough stores a document which has just been written.  Documents written with an expiry are
+// invalidated instead, so that the cache never serves a document which the server has already expired.  Writes
+// invalidate the document before they are dispatched, so that one which fails or times out leaves it uncached
+// rather than stale.
+func (c *Collection) cacheWriteThrough(key string, contents []byte, flags uint32, cas Cas, expiry uint32) {
+	if expiry > 0 {
+		c.cacheInvalidate(key)
+		return
+	}
+
+	c.cacheStore(key, contents, flags, cas)
+}
+
+// cacheInvalidateMutation invalidates a document which is about to be mutated by an operation which does not write
+// it through, returning a function to be deferred which invalidates it again once the operation has completed.
+// The second invalidation happens whether or not the operation succeeded, as one which failed or timed out may
+// still have been applied, and covers a Get which cached the document whilst the operation was in flight.
+func (c *Collection) cacheInvalidateMutation(key string) func() {
+	c.cacheInvalidate(key)
+	return func() {
+		c.cacheInvalidate(key)
+	}
+}
+
+func (c *Collection) cacheInvalidate(key string) {
+	if c.sb.DocumentCache == nil {
+		return
+	}
+
+	c.sb.DocumentCache.Invalidate(c.cacheKey(key))
+}
+
+type lruCacheEntry struct {
+	key     string
+	doc     *CachedDocument
+	expires time.Time
+}
+
+// LRUDocumentCache is an in memory DocumentCache which holds up to a fixed number of documents,
+// evicting the least recently used document when full.
+type LRUDocumentCache struct {
+	lock     sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+// NewLRUDocumentCache creates a new LRUDocumentCache holding at most capacity documents.
+func NewLRUDocumentCache(capacity int) *LRUDocumentCache {
+	return &LRUDocumentCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// Get returns the document cached for key, if any.
+func (lru *LRUDocumentCache) Get(key string) (*CachedDocument, bool) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	elem, ok := lru.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*lruCacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		lru.removeElementLocked(elem)
+		return nil, false
+	}
+
+	lru.order.MoveToFront(elem)
+	return entry.doc, true
+}
+
+// Set stores the document for key, expiring it after ttl.
+func (lru *LRUDocumentCache) Set(key string, doc *CachedDocument, ttl time.Duration) {
+	if lru.capacity <= 0 {
+		return
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	if elem, ok := lru.entries[key]; ok {
+		entry := elem.Value.(*lruCacheEntry)
+		entry.doc = doc
+		entry.expires = expires
+		lru.order.MoveToFront(elem)
+		return
+	}
+
+	lru.entries[key] = lru.order.PushFront(&lruCacheEntry{
+		key:     key,
+		doc:     doc,
+		expires: expires,
+	})
+
+	for lru.order.Len() > lru.capacity {
+		lru.removeElementLocked(lru.order.Back())
+	}
+}
+
+// Invalidate removes any document cached for key.
+func (lru *LRUDocumentCache) Invalidate(key string) {
+	lru.lock.Lock()
+	defer lru.lock.Unlock()
+
+	if elem, ok := lru.entries[key]; ok {
+		lru.removeElementLocked(elem)
+	}
+}
+
+func (lru *LRUDocumentCache) removeElementLocked(elem *list.Element) {
+	entry := lru.order.Remove(elem).(*lruCacheEntry)
+	delete(lru.entries, entry.key)
+}
@@ -0,0 +1,200 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestLRUDocumentCacheEviction(t *testing.T) {
+	cache := NewLRUDocumentCache(2)
+
+	cache.Set("a", &CachedDocument{Cas: 1}, 0)
+	cache.Set("b", &CachedDocument{Cas: 2}, 0)
+	if _, ok := cache.Get("a"); !ok {
+		t.Fatalf("Expected a to be cached")
+	}
+
+	// b is now the least recently used document.
+	cache.Set("c", &CachedDocument{Cas: 3}, 0)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Fatalf("Expected b to have been evicted")
+	}
+	if doc, ok := cache.Get("a"); !ok || doc.Cas != 1 {
+		t.Fatalf("Expected a to be cached with cas 1, was %v", doc)
+	}
+	if doc, ok := cache.Get("c"); !ok || doc.Cas != 3 {
+		t.Fatalf("Expected c to be cached with cas 3, was %v", doc)
+	}
+
+	cache.Invalidate("a")
+	if _, ok := cache.Get("a"); ok {
+		t.Fatalf("Expected a to have been invalidated")
+	}
+}
+
+func TestLRUDocumentCacheTTL(t *testing.T) {
+	cache := NewLRUDocumentCache(10)
+
+	cache.Set("a", &CachedDocument{Cas: 1}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, ok := cache.Get("a"); ok {
+		t.Fatalf("Expected a to have expired")
+	}
+}
+
+func TestGetUsesDocumentCache(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(1),
+		Value: []byte(`{"name":"first"}`),
+	}
+
+	col := testGetCollection(t, provider).WithDocumentCache(NewLRUDocumentCache(10), time.Minute)
+
+	res, err := col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Get encountered error: %v", err)
+	}
+	if res.Cas() != Cas(1) {
+		t.Fatalf("Expected cas value to be %d but was %d", Cas(1), res.Cas())
+	}
+
+	provider.Cas = gocbcore.Cas(2)
+	provider.Value = []byte(`{"name":"second"}`)
+
+	res, err = col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Get encountered error: %v", err)
+	}
+	if res.Cas() != Cas(1) {
+		t.Fatalf("Expected cached cas value to be %d but was %d", Cas(1), res.Cas())
+	}
+
+	var doc map[string]string
+	err = res.Content(&doc)
+	if err != nil {
+		t.Fatalf("Failed to get content from result: %v", err)
+	}
+	if doc["name"] != "first" {
+		t.Fatalf("Expected cached document but was %v", doc)
+	}
+
+	_, err = col.Remove("key", nil)
+	if err != nil {
+		t.Fatalf("Remove encountered error: %v", err)
+	}
+
+	res, err = col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Get encountered error: %v", err)
+	}
+	if res.Cas() != Cas(2) {
+		t.Fatalf("Expected cas value after invalidation to be %d but was %d", Cas(2), res.Cas())
+	}
+}
+
+func TestUpsertWritesThroughDocumentCache(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas: gocbcore.Cas(5),
+	}
+
+	cache := NewLRUDocumentCache(10)
+	col := testGetCollection(t, provider).WithDocumentCache(cache, time.Minute)
+
+	_, err := col.Upsert("key", map[string]string{"name": "upserted"}, nil)
+	if err != nil {
+		t.Fatalf("Upsert encountered error: %v", err)
+	}
+
+	cached, ok := cache.Get("mock/_default/_default/key")
+	if !ok {
+		t.Fatalf("Expected upserted document to be cached")
+	}
+	if cached.Cas != Cas(5) {
+		t.Fatalf("Expected cached cas value to be %d but was %d", Cas(5), cached.Cas)
+	}
+	if string(cached.Contents) != `{"name":"upserted"}` {
+		t.Fatalf("Expected cached contents to be the upserted document but was %s", cached.Contents)
+	}
+
+	_, err = col.Upsert("key", map[string]string{"name": "expiring"}, &UpsertOptions{Expiration: 10})
+	if err != nil {
+		t.Fatalf("Upsert encountered error: %v", err)
+	}
+
+	if _, ok := cache.Get("mock/_default/_default/key"); ok {
+		t.Fatalf("Expected document written with an expiry to be invalidated")
+	}
+}
+
+func TestDocumentCacheKeyedByCollection(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(1),
+		Value: []byte(`{"name":"first"}`),
+	}
+
+	cache := NewLRUDocumentCache(10)
+	col := testGetCollection(t, provider).WithDocumentCache(cache, time.Minute)
+	other := col.clone()
+	other.sb = other.sb.withCollection("other")
+
+	_, err := col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Get encountered error: %v", err)
+	}
+
+	provider.Cas = gocbcore.Cas(2)
+	res, err := other.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Get encountered error: %v", err)
+	}
+	if res.Cas() != Cas(2) {
+		t.Fatalf("Expected document from another collection not to be served from the cache but cas was %d",
+			res.Cas())
+	}
+
+	if _, ok := cache.Get("mock/_default/other/key"); !ok {
+		t.Fatalf("Expected document to be cached under its collection")
+	}
+}
+
+func TestTimedOutMutationInvalidatesDocumentCache(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(1),
+		Value: []byte(`{"name":"first"}`),
+	}
+
+	cache := NewLRUDocumentCache(10)
+	col := testGetCollection(t, provider).WithDocumentCache(cache, time.Minute)
+
+	_, err := col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Get encountered error: %v", err)
+	}
+	if _, ok := cache.Get("mock/_default/_default/key"); !ok {
+		t.Fatalf("Expected document to be cached")
+	}
+
+	provider.OpWait = 100 * time.Millisecond
+	provider.CancelSuccess = true
+	_, err = col.Remove("key", &RemoveOptions{Timeout: 10 * time.Millisecond})
+	if err == nil {
+		t.Fatalf("Expected remove to time out")
+	}
+	if _, ok := cache.Get("mock/_default/_default/key"); ok {
+		t.Fatalf("Expected document to be invalidated by a remove which timed out")
+	}
+
+	cache.Set("mock/_default/_default/key", &CachedDocument{Cas: 1}, 0)
+	_, err = col.Upsert("key", map[string]string{"name": "second"}, &UpsertOptions{Timeout: 10 * time.Millisecond})
+	if err == nil {
+		t.Fatalf("Expected upsert to time out")
+	}
+	if _, ok := cache.Get("mock/_default/_default/key"); ok {
+		t.Fatalf("Expected document to be invalidated by an upsert which timed out")
+	}
+}
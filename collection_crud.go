@@ -3,9 +3,12 @@ package gocb
 import (
 	"context"
 	"encoding/json"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
@@ -15,6 +18,7 @@ type kvProvider interface {
 	ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error)
 	GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error)
 	GetReplicaEx(opts gocbcore.GetReplicaOptions, cb gocbcore.GetReplicaExCallback) (gocbcore.PendingOp, error)
+	GetMetaEx(opts gocbcore.GetMetaOptions, cb gocbcore.GetMetaExCallback) (gocbcore.PendingOp, error)
 	ObserveEx(opts gocbcore.ObserveOptions, cb gocbcore.ObserveExCallback) (gocbcore.PendingOp, error)
 	ObserveVbEx(opts gocbcore.ObserveVbOptions, cb gocbcore.ObserveVbExCallback) (gocbcore.PendingOp, error)
 	DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error)
@@ -54,14 +58,18 @@ func (c *Collection) deadline(ctx context.Context, now time.Time, opTimeout time
 }
 
 type opManager struct {
-	signal chan struct{}
-	ctx    context.Context
+	signal     chan struct{}
+	ctx        context.Context
+	collection *Collection
+	key        string
 }
 
-func (c *Collection) newOpManager(ctx context.Context) *opManager {
+func (c *Collection) newOpManager(ctx context.Context, key string) *opManager {
 	return &opManager{
-		signal: make(chan struct{}, 1),
-		ctx:    ctx,
+		signal:     make(chan struct{}, 1),
+		ctx:        ctx,
+		collection: c,
+		key:        key,
 	}
 }
 
@@ -69,6 +77,18 @@ func (ctrl *opManager) resolve() {
 	ctrl.signal <- struct{}{}
 }
 
+// recordErr records err, returned by the server for the operation, in the error heatmap and returns it.
+func (ctrl *opManager) recordErr(err error) error {
+	ctrl.collection.recordKvError(ctrl.key, err)
+	return err
+}
+
+// enhanceErr records err, returned by the server for the operation, in the error heatmap and returns it
+// enhanced with the key of the operation.
+func (ctrl *opManager) enhanceErr(err error) error {
+	return maybeEnhanceErr(ctrl.recordErr(err), ctrl.key)
+}
+
 func (ctrl *opManager) wait(op gocbcore.PendingOp, err error) (errOut error) {
 	if err != nil {
 		return err
@@ -79,7 +99,7 @@ func (ctrl *opManager) wait(op gocbcore.PendingOp, err error) (errOut error) {
 		if op.Cancel() {
 			ctxErr := ctrl.ctx.Err()
 			if ctxErr == context.DeadlineExceeded {
-				errOut = timeoutError{}
+				errOut = ctrl.recordErr(timeoutError{})
 			} else {
 				errOut = ctxErr
 			}
@@ -95,26 +115,56 @@ func (ctrl *opManager) wait(op gocbcore.PendingOp, err error) (errOut error) {
 // UpsertOptions are options that can be applied to an Upsert operation.
 type UpsertOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 	Expiration        uint32
-	// Encode            Encode
+	// ExpirationJitter randomly moves Expiration by up to this fraction of its length in either direction, e.g. 0.1
+	// for +/-10%, so that documents written with the same expiration do not all expire at the same moment.
+	ExpirationJitter float64
+	// Encode encodes the value into the bytes and flags which are stored, defaulting to DefaultEncode.
+	Encode          Encode
 	PersistTo       uint
 	ReplicateTo     uint
 	DurabilityLevel DurabilityLevel
+	// ValidateJSON checks that a value encoded as JSON is valid UTF-8 JSON before it is sent, failing with
+	// ErrInvalidValue if not, see Collection.WithJSONValidation.
+	ValidateJSON bool
+	// DisableCompression sends the value uncompressed even when compression is enabled by the compression
+	// connection string option, for values which are already compressed or are known not to compress well.  It
+	// has no effect when the connections cannot report that they negotiated compression, in which case values
+	// are compressed by gocbcore.
+	DisableCompression bool
+	// FetchDocumentAfterMutation fetches the document once it has been written, and any durability requirements
+	// met, making it available from MutationResult.Document.  ErrDocumentChangedAfterMutation is returned, with
+	// the result, if the document was changed again before it was fetched.
+	FetchDocumentAfterMutation bool
 }
 
 // InsertOptions are options that can be applied to an Insert operation.
 type InsertOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 	// The expiration length in seconds
 	Expiration uint32
-	// Encode            Encode
+	// ExpirationJitter randomly moves Expiration by up to this fraction of its length in either direction, e.g. 0.1
+	// for +/-10%, so that documents written with the same expiration do not all expire at the same moment.
+	ExpirationJitter float64
+	// Encode encodes the value into the bytes and flags which are stored, defaulting to DefaultEncode.
+	Encode          Encode
 	PersistTo       uint
 	ReplicateTo     uint
 	DurabilityLevel DurabilityLevel
+	// ValidateJSON checks that a value encoded as JSON is valid UTF-8 JSON before it is sent, failing with
+	// ErrInvalidValue if not, see Collection.WithJSONValidation.
+	ValidateJSON bool
+	// DisableCompression sends the value uncompressed even when compression is enabled by the compression
+	// connection string option, for values which are already compressed or are known not to compress well.  It
+	// has no effect when the connections cannot report that they negotiated compression, in which case values
+	// are compressed by gocbcore.
+	DisableCompression bool
 }
 
 // Insert creates a new document in the Collection.
@@ -123,7 +173,7 @@ func (c *Collection) Insert(key string, val interface{}, opts *InsertOptions) (m
 		opts = &InsertOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Insert")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Insert")
 	defer span.Finish()
 
 	res, err := c.insert(span.Context(), key, val, *opts)
@@ -148,39 +198,55 @@ func (c *Collection) insert(traceCtx opentracing.SpanContext, key string, val in
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	// encodeFn := opts.Encode
-	// if encodeFn == nil {
-	// 	encodeFn = DefaultEncode
-	// }
+	encodeFn := opts.Encode
+	if encodeFn == nil {
+		encodeFn = DefaultEncode
+	}
 
-	agent, err := c.getKvProvider()
+	expiry, err := jitterExpiration(opts.Expiration, opts.ExpirationJitter)
 	if err != nil {
 		errOut = err
 		return
 	}
 
-	encodeSpan := opentracing.GlobalTracer().StartSpan("Encoding", opentracing.ChildOf(traceCtx))
-	bytes, flags, err := DefaultEncode(val)
+	agent, err := c.getKvProvider(deadlinedCtx)
+	if err != nil {
+		errOut = err
+		return
+	}
+
+	encodeSpan := startChildTrace(traceCtx, "Encoding")
+	bytes, flags, err := encodeFn(val)
 	if err != nil {
 		errOut = err
 		return
 	}
 	encodeSpan.Finish()
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	err = c.validateValue(bytes, flags, opts.ValidateJSON)
+	if err != nil {
+		errOut = err
+		return
+	}
+
+	value, datatype := c.compressValue(agent, "insert", bytes, opts.DisableCompression)
+
+	c.cacheInvalidate(key)
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.AddEx(gocbcore.AddOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
-		Value:        bytes,
+		Value:        value,
 		Flags:        flags,
-		Expiry:       opts.Expiration,
-		TraceContext: traceCtx,
+		Datatype:     datatype,
+		Expiry:       expiry,
+		TraceContext: c.kvTraceContext(traceCtx, "insert"),
 	}, func(res *gocbcore.StoreResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -193,6 +259,8 @@ func (c *Collection) insert(traceCtx opentracing.SpanContext, key string, val in
 			mt: mutTok,
 		}
 		mutOut.cas = Cas(res.Cas)
+		c.recordDocumentWrite("insert", len(bytes))
+		c.cacheWriteThrough(key, bytes, flags, mutOut.cas, expiry)
 
 		ctrl.resolve()
 	}))
@@ -209,7 +277,7 @@ func (c *Collection) Upsert(key string, val interface{}, opts *UpsertOptions) (m
 		opts = &UpsertOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Upsert")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Upsert")
 	defer span.Finish()
 
 	res, err := c.upsert(span.Context(), key, val, *opts)
@@ -217,10 +285,17 @@ func (c *Collection) Upsert(key string, val interface{}, opts *UpsertOptions) (m
 		return nil, err
 	}
 
-	if opts.PersistTo == 0 && opts.ReplicateTo == 0 {
-		return res, nil
+	if opts.PersistTo != 0 || opts.ReplicateTo != 0 {
+		err = c.durability(opts.Context, span.Context(), key, res.Cas(), res.MutationToken(), opts.ReplicateTo, opts.PersistTo, false)
+		if err != nil {
+			return res, err
+		}
 	}
-	return res, c.durability(opts.Context, span.Context(), key, res.Cas(), res.MutationToken(), opts.ReplicateTo, opts.PersistTo, false)
+
+	if opts.FetchDocumentAfterMutation {
+		return res, c.fetchAfterMutation(opts.Context, span.Context(), key, opts.Timeout, res)
+	}
+	return res, nil
 }
 
 func (c *Collection) upsert(traceCtx opentracing.SpanContext, key string, val interface{}, opts UpsertOptions) (mutOut *MutationResult, errOut error) {
@@ -233,37 +308,53 @@ func (c *Collection) upsert(traceCtx opentracing.SpanContext, key string, val in
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	// if opts.Encode == nil {
-	// 	opts.Encode = DefaultEncode
-	// }
+	if opts.Encode == nil {
+		opts.Encode = DefaultEncode
+	}
+
+	expiry, err := jitterExpiration(opts.Expiration, opts.ExpirationJitter)
+	if err != nil {
+		errOut = err
+		return
+	}
+
+	agent, err := c.getKvProvider(deadlinedCtx)
+	if err != nil {
+		errOut = err
+		return
+	}
 
-	agent, err := c.getKvProvider()
+	bytes, flags, err := opts.Encode(val)
 	if err != nil {
 		errOut = err
 		return
 	}
 
-	bytes, flags, err := DefaultEncode(val)
+	err = c.validateValue(bytes, flags, opts.ValidateJSON)
 	if err != nil {
 		errOut = err
 		return
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	value, datatype := c.compressValue(agent, "upsert", bytes, opts.DisableCompression)
+
+	c.cacheInvalidate(key)
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.SetEx(gocbcore.SetOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
-		Value:        bytes,
+		Value:        value,
 		Flags:        flags,
-		Expiry:       opts.Expiration,
-		TraceContext: traceCtx,
+		Datatype:     datatype,
+		Expiry:       expiry,
+		TraceContext: c.kvTraceContext(traceCtx, "upsert"),
 	}, func(res *gocbcore.StoreResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -276,11 +367,13 @@ func (c *Collection) upsert(traceCtx opentracing.SpanContext, key string, val in
 			mt: mutTok,
 		}
 		mutOut.cas = Cas(res.Cas)
+		c.recordDocumentWrite("upsert", len(bytes))
+		c.cacheWriteThrough(key, bytes, flags, mutOut.cas, expiry)
 
 		ctrl.resolve()
 	}))
 	if err != nil {
-		return
+		errOut = err
 	}
 
 	return
@@ -289,6 +382,7 @@ func (c *Collection) upsert(traceCtx opentracing.SpanContext, key string, val in
 // ReplaceOptions are the options available to a Replace operation.
 type ReplaceOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 	Expiration        uint32
@@ -297,6 +391,17 @@ type ReplaceOptions struct {
 	PersistTo         uint
 	ReplicateTo       uint
 	DurabilityLevel   DurabilityLevel
+	// ExpirationJitter randomly moves Expiration by up to this fraction of its length in either direction, e.g. 0.1
+	// for +/-10%, so that documents written with the same expiration do not all expire at the same moment.
+	ExpirationJitter float64
+	// ValidateJSON checks that a value encoded as JSON is valid UTF-8 JSON before it is sent, failing with
+	// ErrInvalidValue if not, see Collection.WithJSONValidation.
+	ValidateJSON bool
+	// DisableCompression sends the value uncompressed even when compression is enabled by the compression
+	// connection string option, for values which are already compressed or are known not to compress well.  It
+	// has no effect when the connections cannot report that they negotiated compression, in which case values
+	// are compressed by gocbcore.
+	DisableCompression bool
 }
 
 // Replace updates a document in the collection.
@@ -305,7 +410,7 @@ func (c *Collection) Replace(key string, val interface{}, opts *ReplaceOptions)
 		opts = &ReplaceOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Replace")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Replace")
 	defer span.Finish()
 
 	res, err := c.replace(span.Context(), key, val, *opts)
@@ -333,7 +438,13 @@ func (c *Collection) replace(traceCtx opentracing.SpanContext, key string, val i
 		opts.Encode = DefaultEncode
 	}
 
-	agent, err := c.getKvProvider()
+	expiry, err := jitterExpiration(opts.Expiration, opts.ExpirationJitter)
+	if err != nil {
+		errOut = err
+		return
+	}
+
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -343,21 +454,30 @@ func (c *Collection) replace(traceCtx opentracing.SpanContext, key string, val i
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	err = c.validateValue(bytes, flags, opts.ValidateJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	value, datatype := c.compressValue(agent, "replace", bytes, opts.DisableCompression)
+
+	c.cacheInvalidate(key)
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.ReplaceEx(gocbcore.ReplaceOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
-		Value:        bytes,
+		Value:        value,
 		Flags:        flags,
-		Expiry:       opts.Expiration,
+		Datatype:     datatype,
+		Expiry:       expiry,
 		Cas:          gocbcore.Cas(opts.Cas),
-		TraceContext: traceCtx,
+		TraceContext: c.kvTraceContext(traceCtx, "replace"),
 	}, func(res *gocbcore.StoreResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -370,6 +490,8 @@ func (c *Collection) replace(traceCtx opentracing.SpanContext, key string, val i
 			mt: mutTok,
 		}
 		mutOut.cas = Cas(res.Cas)
+		c.recordDocumentWrite("replace", len(bytes))
+		c.cacheWriteThrough(key, bytes, flags, mutOut.cas, expiry)
 
 		ctrl.resolve()
 	}))
@@ -383,6 +505,7 @@ func (c *Collection) replace(traceCtx opentracing.SpanContext, key string, val i
 // GetOptions are the options available to a Get operation.
 type GetOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 	WithExpiry        bool
@@ -394,13 +517,14 @@ type GetOptions struct {
 
 // Get performs a fetch operation against the collection. This can take 3 paths, a standard full document
 // fetch, a subdocument full document fetch also fetching document expiry (when WithExpiry is set),
-// or a subdocument fetch (when Project is used).
+// or a subdocument fetch (when Project is used).  Full documents are upgraded by the Migrations of the collection,
+// if it has any.
 func (c *Collection) Get(key string, opts *GetOptions) (docOut *GetResult, errOut error) {
 	if opts == nil {
 		opts = &GetOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Get")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Get")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -413,10 +537,25 @@ func (c *Collection) Get(key string, opts *GetOptions) (docOut *GetResult, errOu
 	defer cancel()
 
 	if len(opts.Project) == 0 && !opts.WithExpiry {
-		// No projection and no expiry so standard fulldoc
+		// No projection and no expiry so standard fulldoc, which may be served from the document cache
+		if cached := c.cachedGet(key); cached != nil {
+			docOut = cached
+			errOut = c.migrate(deadlinedCtx, span.Context(), docOut)
+			if errOut != nil {
+				docOut = nil
+			}
+			return
+		}
+
 		docOut, errOut = c.get(deadlinedCtx, span.Context(), key, opts)
 		if docOut != nil {
 			docOut.id = key
+			errOut = c.migrate(deadlinedCtx, span.Context(), docOut)
+			if errOut != nil {
+				docOut = nil
+				return
+			}
+			c.cacheStore(key, docOut.contents, docOut.flags, docOut.cas)
 		}
 		return
 	}
@@ -448,32 +587,71 @@ func (c *Collection) Get(key string, opts *GetOptions) (docOut *GetResult, errOu
 		return
 	}
 
+	if len(opts.Project) == 0 {
+		err = c.migrate(deadlinedCtx, span.Context(), doc)
+		if err != nil {
+			errOut = err
+			return
+		}
+	}
+
 	docOut = doc
 	return
 }
 
+// GetAs performs a fetch operation against the collection and decodes the document into valuePtr.  If
+// valuePtr points to a struct and no Project paths are set then the document is projected to the fields
+// of that struct, as named by their json tags, so that only those fields are fetched from the server.
+// Note that, unlike decoding a full document, projected field names are matched case sensitively.  Documents are
+// not projected when the Collection has Migrations, so that they can be upgraded before being decoded.
+func (c *Collection) GetAs(key string, valuePtr interface{}, opts *GetOptions) (docOut *GetResult, errOut error) {
+	if opts == nil {
+		opts = &GetOptions{}
+	}
+
+	if len(opts.Project) == 0 && c.sb.Migrations == nil {
+		if paths, ok := projectionPaths(valuePtr); ok {
+			projectedOpts := *opts
+			projectedOpts.Project = paths
+			opts = &projectedOpts
+		}
+	}
+
+	docOut, errOut = c.Get(key, opts)
+	if errOut != nil {
+		return
+	}
+
+	errOut = docOut.Content(valuePtr)
+	if errOut != nil {
+		docOut = nil
+	}
+
+	return
+}
+
 // get performs a full document fetch against the collection
 func (c *Collection) get(ctx context.Context, traceCtx opentracing.SpanContext, key string, opts *GetOptions) (docOut *GetResult, errOut error) {
 	span := c.startKvOpTrace(traceCtx, "get")
 	defer span.Finish()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(ctx)
+	ctrl := c.newOpManager(ctx, key)
 	err = ctrl.wait(agent.GetEx(gocbcore.GetOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
-		TraceContext: traceCtx,
+		TraceContext: c.kvTraceContext(traceCtx, "get"),
 	}, func(res *gocbcore.GetResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -482,10 +660,12 @@ func (c *Collection) get(ctx context.Context, traceCtx opentracing.SpanContext,
 				id:       key,
 				contents: res.Value,
 				flags:    res.Flags,
+				datatype: res.Datatype,
 				cas:      Cas(res.Cas),
 			}
 
 			docOut = doc
+			c.recordDocumentRead("get", len(res.Value))
 		}
 
 		ctrl.resolve()
@@ -500,6 +680,7 @@ func (c *Collection) get(ctx context.Context, traceCtx opentracing.SpanContext,
 // ExistsOptions are the options available to the Exists command.
 type ExistsOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 }
@@ -510,7 +691,7 @@ func (c *Collection) Exists(key string, opts *ExistsOptions) (docOut *ExistsResu
 		opts = &ExistsOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Exists")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Exists")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -522,16 +703,16 @@ func (c *Collection) Exists(key string, opts *ExistsOptions) (docOut *ExistsResu
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.ObserveEx(gocbcore.ObserveOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "exists"),
 		ReplicaIdx:   0,
 	}, func(res *gocbcore.ObserveResult, err error) {
 		if err != nil {
@@ -539,7 +720,7 @@ func (c *Collection) Exists(key string, opts *ExistsOptions) (docOut *ExistsResu
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -562,6 +743,76 @@ func (c *Collection) Exists(key string, opts *ExistsOptions) (docOut *ExistsResu
 	return
 }
 
+// GetMetaOptions are the options available to the GetMeta command.
+type GetMetaOptions struct {
+	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
+	Timeout           time.Duration
+	Context           context.Context
+}
+
+// GetMeta fetches the metadata of a document, without its contents.  Unlike other operations the metadata of a
+// deleted document, whose tombstone has not yet been purged, is also returned.  Only the default collection is
+// supported, GetMeta on any other Collection fails with ErrGetMetaNotSupported.
+func (c *Collection) GetMeta(key string, opts *GetMetaOptions) (docOut *GetMetaResult, errOut error) {
+	if opts == nil {
+		opts = &GetMetaOptions{}
+	}
+
+	// The server does not accept a collection ID with a get meta request, so it would read the document from the
+	// default collection.
+	if c.sb.ScopeName != "_default" || c.sb.CollectionName != "_default" {
+		return nil, ErrGetMetaNotSupported
+	}
+
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "GetMeta")
+	defer span.Finish()
+
+	deadlinedCtx := opts.Context
+	if deadlinedCtx == nil {
+		deadlinedCtx = context.Background()
+	}
+
+	d := c.deadline(deadlinedCtx, time.Now(), opts.Timeout)
+	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
+	defer cancel()
+
+	agent, err := c.getKvProvider(deadlinedCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
+	err = ctrl.wait(agent.GetMetaEx(gocbcore.GetMetaOptions{
+		Key:          []byte(key),
+		TraceContext: c.kvTraceContext(span.Context(), "get_meta"),
+	}, func(res *gocbcore.GetMetaResult, err error) {
+		if err != nil {
+			errOut = ctrl.enhanceErr(err)
+			ctrl.resolve()
+			return
+		}
+		if res != nil {
+			docOut = &GetMetaResult{
+				id:         key,
+				cas:        Cas(res.Cas),
+				flags:      res.Flags,
+				datatype:   res.Datatype,
+				expiration: res.Expiry,
+				seqNo:      uint64(res.SeqNo),
+				deleted:    res.Deleted != 0,
+			}
+		}
+
+		ctrl.resolve()
+	}))
+	if err != nil {
+		errOut = err
+	}
+
+	return
+}
+
 // GetFromReplicaOptions are the options available to the GetFromReplica command.
 type GetFromReplicaOptions struct {
 	ParentSpanContext opentracing.SpanContext
@@ -575,7 +826,7 @@ func (c *Collection) GetFromReplica(key string, replicaIdx int, opts *GetFromRep
 		opts = &GetFromReplicaOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "GetFromReplica")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "GetFromReplica")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -587,16 +838,16 @@ func (c *Collection) GetFromReplica(key string, replicaIdx int, opts *GetFromRep
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.GetReplicaEx(gocbcore.GetReplicaOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "get_from_replica"),
 		ReplicaIdx:   0,
 	}, func(res *gocbcore.GetReplicaResult, err error) {
 		if err != nil {
@@ -604,7 +855,7 @@ func (c *Collection) GetFromReplica(key string, replicaIdx int, opts *GetFromRep
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -613,10 +864,12 @@ func (c *Collection) GetFromReplica(key string, replicaIdx int, opts *GetFromRep
 				id:       key,
 				contents: res.Value,
 				flags:    res.Flags,
+				datatype: res.Datatype,
 				cas:      Cas(res.Cas),
 			}
 
 			docOut = doc
+			c.recordDocumentRead("get_from_replica", len(res.Value))
 		}
 
 		ctrl.resolve()
@@ -631,12 +884,17 @@ func (c *Collection) GetFromReplica(key string, replicaIdx int, opts *GetFromRep
 // RemoveOptions are the options available to the Remove command.
 type RemoveOptions struct {
 	ParentSpanContext opentracing.SpanContext
+	Tracing           TracingPolicy
 	Timeout           time.Duration
 	Context           context.Context
 	Cas               Cas
 	PersistTo         uint
 	ReplicateTo       uint
 	DurabilityLevel   DurabilityLevel
+	// TombstoneXattrs are extended attributes to set on the tombstone left by the removal, so that DCP consumers
+	// and transactions can see metadata about the deletion.  Only system attributes, whose names begin with an
+	// underscore, are kept on tombstones so other names fail with ErrInvalidArgument.
+	TombstoneXattrs map[string]interface{}
 }
 
 // Remove removes a document from the collection.
@@ -645,7 +903,7 @@ func (c *Collection) Remove(key string, opts *RemoveOptions) (mutOut *MutationRe
 		opts = &RemoveOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Remove")
+	span := c.startKvOpTrace(tracingParent(opts.Tracing, parentSpanContext(opts.Context, opts.ParentSpanContext)), "Remove")
 	defer span.Finish()
 
 	res, err := c.remove(span.Context(), key, *opts)
@@ -660,6 +918,10 @@ func (c *Collection) Remove(key string, opts *RemoveOptions) (mutOut *MutationRe
 }
 
 func (c *Collection) remove(traceCtx opentracing.SpanContext, key string, opts RemoveOptions) (mutOut *MutationResult, errOut error) {
+	if len(opts.TombstoneXattrs) > 0 {
+		return c.removeWithTombstoneXattrs(traceCtx, key, opts)
+	}
+
 	deadlinedCtx := opts.Context
 	if deadlinedCtx == nil {
 		deadlinedCtx = context.Background()
@@ -669,24 +931,26 @@ func (c *Collection) remove(traceCtx opentracing.SpanContext, key string, opts R
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.DeleteEx(gocbcore.DeleteOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		Cas:          gocbcore.Cas(opts.Cas),
-		TraceContext: traceCtx,
+		TraceContext: c.kvTraceContext(traceCtx, "remove"),
 	}, func(res *gocbcore.DeleteResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -721,6 +985,10 @@ type LookupInOptions struct {
 	spec              lookupSpec
 	ParentSpanContext opentracing.SpanContext
 	WithExpiry        bool
+	// AccessDeleted allows the lookup to read a deleted document, whose tombstone has not yet been purged, which
+	// is typically used to read the xattrs left on it.  Whether the document was deleted is reported by
+	// LookupInResult.Deleted.  ErrAccessDeletedNotSupported is returned if the server does not support this.
+	AccessDeleted bool
 }
 
 // Path indicates a path to be retrieved from the document.  The value of the path
@@ -785,6 +1053,20 @@ func (opts LookupInOptions) XAttr(path string) LookupInOptions {
 	return opts.getWithFlags(path, SubdocFlagXattr)
 }
 
+func isDeletedDocumentStatus(err error) bool {
+	return gocbcore.IsErrorStatus(err, gocbcore.StatusSubDocSuccessDeleted) ||
+		gocbcore.IsErrorStatus(err, gocbcore.StatusSubDocMultiPathFailureDeleted)
+}
+
+// isAccessDeletedUnsupportedStatus returns whether err is how a server which predates access to deleted
+// documents rejects the access deleted doc flag.
+func isAccessDeletedUnsupportedStatus(err error) bool {
+	return gocbcore.IsErrorStatus(err, gocbcore.StatusInvalidArgs) ||
+		gocbcore.IsErrorStatus(err, gocbcore.StatusNotSupported) ||
+		gocbcore.IsErrorStatus(err, gocbcore.StatusUnknownCommand) ||
+		gocbcore.IsErrorStatus(err, gocbcore.StatusSubDocXattrInvalidFlagCombo)
+}
+
 // LookupIn performs a set of subdocument lookup operations on the document identified by key.
 func (c *Collection) LookupIn(key string, opts *LookupInOptions) (docOut *LookupInResult, errOut error) {
 	if opts == nil {
@@ -800,7 +1082,7 @@ func (c *Collection) LookupIn(key string, opts *LookupInOptions) (docOut *Lookup
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "LookupIn")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "LookupIn")
 	defer span.Finish()
 
 	return c.lookupIn(deadlinedCtx, span.Context(), key, *opts)
@@ -810,7 +1092,7 @@ func (c *Collection) lookupIn(ctx context.Context, traceCtx opentracing.SpanCont
 	span := c.startKvOpTrace(traceCtx, "lookupIn")
 	defer span.Finish()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -848,20 +1130,32 @@ func (c *Collection) lookupIn(ctx context.Context, traceCtx opentracing.SpanCont
 		}
 	}
 
-	ctrl := c.newOpManager(ctx)
+	flags := spec.flags
+	if opts.AccessDeleted {
+		flags |= gocbcore.SubdocDocFlagAccessDeleted
+	}
+
+	ctrl := c.newOpManager(ctx, key)
 	err = ctrl.wait(agent.LookupInEx(gocbcore.LookupInOptions{
 		Key:          []byte(key),
-		Flags:        spec.flags,
+		Flags:        flags,
 		Ops:          spec.ops,
 		CollectionID: c.collectionID(),
-		TraceContext: traceCtx,
+		TraceContext: c.kvTraceContext(traceCtx, "lookup_in"),
 	}, func(res *gocbcore.LookupInResult, err error) {
-		if err != nil {
+		// When accessing deleted documents the server reports that the document was deleted via the status
+		// of an otherwise successful lookup.
+		deleted := res != nil && isDeletedDocumentStatus(err)
+		if err != nil && !deleted {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			if opts.AccessDeleted && isAccessDeletedUnsupportedStatus(err) {
+				errOut = ErrAccessDeletedNotSupported
+			} else {
+				errOut = ctrl.enhanceErr(err)
+			}
 			ctrl.resolve()
 			return
 		}
@@ -869,6 +1163,7 @@ func (c *Collection) lookupIn(ctx context.Context, traceCtx opentracing.SpanCont
 		if res != nil {
 			resSet := &LookupInResult{}
 			resSet.cas = Cas(res.Cas)
+			resSet.deleted = deleted
 			resSet.contents = make([]lookupInPartial, len(spec.ops))
 
 			for i, opRes := range res.Ops {
@@ -920,7 +1215,12 @@ type MutateInOptions struct {
 	ReplicateTo       uint
 	DurabilityLevel   DurabilityLevel
 	CreateDocument    bool
-	spec              mutateSpec
+	// FetchDocumentAfterMutation fetches the whole document once the mutations have been applied, and any
+	// durability requirements met, making it available from MutationResult.Document.
+	// ErrDocumentChangedAfterMutation is returned, with the result, if the document was changed again before it
+	// was fetched.
+	FetchDocumentAfterMutation bool
+	spec                       mutateSpec
 }
 
 func (opts *MutateInOptions) marshalValue(value interface{}) []byte {
@@ -1129,7 +1429,7 @@ func (c *Collection) Mutate(key string, opts *MutateInOptions) (mutOut *Mutation
 		opts = &MutateInOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "MutateIn")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "MutateIn")
 	defer span.Finish()
 
 	res, err := c.mutate(span.Context(), key, *opts)
@@ -1137,10 +1437,54 @@ func (c *Collection) Mutate(key string, opts *MutateInOptions) (mutOut *Mutation
 		return nil, err
 	}
 
-	if opts.PersistTo == 0 && opts.ReplicateTo == 0 {
-		return res, nil
+	if opts.PersistTo != 0 || opts.ReplicateTo != 0 {
+		err = c.durability(opts.Context, span.Context(), key, res.Cas(), res.MutationToken(), opts.ReplicateTo, opts.PersistTo, false)
+		if err != nil {
+			return res, err
+		}
 	}
-	return res, c.durability(opts.Context, span.Context(), key, res.Cas(), res.MutationToken(), opts.ReplicateTo, opts.PersistTo, false)
+
+	if opts.FetchDocumentAfterMutation {
+		return res, c.fetchAfterMutation(opts.Context, span.Context(), key, opts.Timeout, res)
+	}
+	return res, nil
+}
+
+// UpdateFields performs a partial update of the document specified by key, upserting each of the fields given.
+// Field names are subdocument paths so nested fields can be updated using dot-notation, e.g. "address.city".
+// Any missing parent objects are created. The fields are applied in addition to any operations already specified
+// on opts.
+func (c *Collection) UpdateFields(key string, fields map[string]interface{}, opts *MutateInOptions) (mutOut *MutationResult, errOut error) {
+	if opts == nil {
+		opts = &MutateInOptions{}
+	}
+
+	if len(fields) == 0 {
+		return nil, ErrNoFields
+	}
+
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		if path == "" {
+			return nil, ErrInvalidFieldName
+		}
+		paths = append(paths, path)
+	}
+	// Sort the paths so that the operations sent are deterministic.
+	sort.Strings(paths)
+
+	updateOpts := *opts
+	updateOpts.spec.ops = append([]gocbcore.SubDocOp{}, opts.spec.ops...)
+	for _, path := range paths {
+		bytes, err := json.Marshal(fields[path])
+		if err != nil {
+			return nil, err
+		}
+
+		updateOpts = updateOpts.Upsert(path, bytes, true)
+	}
+
+	return c.Mutate(key, &updateOpts)
 }
 
 func (c *Collection) mutate(traceCtx opentracing.SpanContext, key string, opts MutateInOptions) (mutOut *MutationResult, errOut error) { // TODO: should return MutateInResult
@@ -1153,7 +1497,7 @@ func (c *Collection) mutate(traceCtx opentracing.SpanContext, key string, opts M
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -1163,14 +1507,16 @@ func (c *Collection) mutate(traceCtx opentracing.SpanContext, key string, opts M
 		flags |= SubdocDocFlagMkDoc
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.MutateInEx(gocbcore.MutateInOptions{
 		Key:          []byte(key),
 		Flags:        gocbcore.SubdocDocFlag(flags),
 		Cas:          gocbcore.Cas(opts.Cas),
 		CollectionID: c.collectionID(),
 		Ops:          opts.spec.ops,
-		TraceContext: traceCtx,
+		TraceContext: c.kvTraceContext(traceCtx, "mutate_in"),
 		Expiry:       opts.Expiration,
 	}, func(res *gocbcore.MutateInResult, err error) {
 		if err != nil {
@@ -1178,7 +1524,7 @@ func (c *Collection) mutate(traceCtx opentracing.SpanContext, key string, opts M
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -1215,7 +1561,7 @@ func (c *Collection) GetAndTouch(key string, expiration uint32, opts *GetAndTouc
 		opts = &GetAndTouchOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "GetAndTouch")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "GetAndTouch")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -1227,24 +1573,26 @@ func (c *Collection) GetAndTouch(key string, expiration uint32, opts *GetAndTouc
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.GetAndTouchEx(gocbcore.GetAndTouchOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		Expiry:       expiration,
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "get_and_touch"),
 	}, func(res *gocbcore.GetAndTouchResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -1253,10 +1601,12 @@ func (c *Collection) GetAndTouch(key string, expiration uint32, opts *GetAndTouc
 				id:       key,
 				contents: res.Value,
 				flags:    res.Flags,
+				datatype: res.Datatype,
 				cas:      Cas(res.Cas),
 			}
 
 			docOut = doc
+			c.recordDocumentRead("get_and_touch", len(res.Value))
 		}
 
 		ctrl.resolve()
@@ -1281,7 +1631,7 @@ func (c *Collection) GetAndLock(key string, expiration uint32, opts *GetAndLockO
 		opts = &GetAndLockOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "GetAndLock")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "GetAndLock")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -1293,24 +1643,26 @@ func (c *Collection) GetAndLock(key string, expiration uint32, opts *GetAndLockO
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.GetAndLockEx(gocbcore.GetAndLockOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		LockTime:     expiration,
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "get_and_lock"),
 	}, func(res *gocbcore.GetAndLockResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -1319,10 +1671,12 @@ func (c *Collection) GetAndLock(key string, expiration uint32, opts *GetAndLockO
 				id:       key,
 				contents: res.Value,
 				flags:    res.Flags,
+				datatype: res.Datatype,
 				cas:      Cas(res.Cas),
 			}
 
 			docOut = doc
+			c.recordDocumentRead("get_and_lock", len(res.Value))
 		}
 
 		ctrl.resolve()
@@ -1348,7 +1702,7 @@ func (c *Collection) Unlock(key string, opts *UnlockOptions) (mutOut *MutationRe
 		opts = &UnlockOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Unlock")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "Unlock")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -1360,24 +1714,26 @@ func (c *Collection) Unlock(key string, opts *UnlockOptions) (mutOut *MutationRe
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.UnlockEx(gocbcore.UnlockOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		Cas:          gocbcore.Cas(opts.Cas),
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "unlock"),
 	}, func(res *gocbcore.UnlockResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -1414,7 +1770,7 @@ func (c *Collection) Touch(key string, expiration uint32, opts *GetAndTouchOptio
 		opts = &GetAndTouchOptions{}
 	}
 
-	span := c.startKvOpTrace(opts.ParentSpanContext, "Touch")
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "Touch")
 	defer span.Finish()
 
 	deadlinedCtx := opts.Context
@@ -1426,24 +1782,26 @@ func (c *Collection) Touch(key string, expiration uint32, opts *GetAndTouchOptio
 	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
 	defer cancel()
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(deadlinedCtx)
 	if err != nil {
 		return nil, err
 	}
 
-	ctrl := c.newOpManager(deadlinedCtx)
+	defer c.cacheInvalidateMutation(key)()
+
+	ctrl := c.newOpManager(deadlinedCtx, key)
 	err = ctrl.wait(agent.TouchEx(gocbcore.TouchOptions{
 		Key:          []byte(key),
 		CollectionID: c.collectionID(),
 		Expiry:       expiration,
-		TraceContext: span.Context(),
+		TraceContext: c.kvTraceContext(span.Context(), "touch"),
 	}, func(res *gocbcore.TouchResult, err error) {
 		if err != nil {
 			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
 				c.setCollectionUnknown()
 			}
 
-			errOut = maybeEnhanceErr(err, key)
+			errOut = ctrl.enhanceErr(err)
 			ctrl.resolve()
 			return
 		}
@@ -1466,6 +1824,45 @@ func (c *Collection) Touch(key string, expiration uint32, opts *GetAndTouchOptio
 	return
 }
 
+// removeWithTombstoneXattrs removes a document using a subdocument mutation which sets the tombstone xattrs and
+// deletes the document atomically.
+func (c *Collection) removeWithTombstoneXattrs(traceCtx opentracing.SpanContext, key string, opts RemoveOptions) (*MutationResult, error) {
+	names := make([]string, 0, len(opts.TombstoneXattrs))
+	for name := range opts.TombstoneXattrs {
+		if !strings.HasPrefix(name, "_") {
+			return nil, errors.Wrapf(ErrInvalidArgument, "tombstone xattr %s is not a system xattr", name)
+		}
+		names = append(names, name)
+	}
+	// Sort the names so that the operations sent are deterministic.
+	sort.Strings(names)
+
+	mutateOpts := MutateInOptions{
+		Timeout: opts.Timeout,
+		Context: opts.Context,
+		Cas:     opts.Cas,
+	}
+	for _, name := range names {
+		bytes, err := json.Marshal(opts.TombstoneXattrs[name])
+		if err != nil {
+			return nil, err
+		}
+
+		mutateOpts.spec.ops = append(mutateOpts.spec.ops, gocbcore.SubDocOp{
+			Op:    gocbcore.SubDocOpDictSet,
+			Path:  name,
+			Flags: gocbcore.SubdocFlag(SubdocFlagXattr | SubdocFlagCreatePath),
+			Value: bytes,
+		})
+	}
+	mutateOpts.spec.ops = append(mutateOpts.spec.ops, gocbcore.SubDocOp{
+		Op:    gocbcore.SubDocOpDeleteDoc,
+		Flags: gocbcore.SubdocFlagNone,
+	})
+
+	return c.mutate(traceCtx, key, mutateOpts)
+}
+
 // Binary creates and returns a CollectionBinary object.
 func (c *Collection) Binary() *CollectionBinary {
 	return &CollectionBinary{c}
@@ -1,12 +1,16 @@
 package gocb
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"math/rand"
 	"reflect"
 	"testing"
 	"time"
 
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
@@ -22,10 +26,10 @@ func TestGetNoOptions(t *testing.T) {
 		t.Fatalf("Failed to unmarshal dataset: %v", err)
 	}
 
-	provider := &mockKvOperator{
-		cas:      gocbcore.Cas(1),
-		datatype: 1,
-		value:    expectedBytes,
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    expectedBytes,
 	}
 
 	col := testGetCollection(t, provider)
@@ -80,11 +84,11 @@ func TestGetWithExpiry(t *testing.T) {
 		Value: expectedBytes,
 	}
 
-	provider := &mockKvOperator{
-		cas:      gocbcore.Cas(1),
-		datatype: 1,
-		value:    resultOps,
-		opWait:   1 * time.Millisecond,
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    resultOps,
+		OpWait:   1 * time.Millisecond,
 	}
 	col := testGetCollection(t, provider)
 
@@ -142,11 +146,11 @@ func TestGetProject(t *testing.T) {
 		Value: accuracyBytes,
 	}
 
-	provider := &mockKvOperator{
-		cas:      gocbcore.Cas(1),
-		datatype: 1,
-		value:    resultOps,
-		opWait:   1 * time.Millisecond,
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    resultOps,
+		OpWait:   1 * time.Millisecond,
 	}
 	col := testGetCollection(t, provider)
 
@@ -176,6 +180,98 @@ func TestGetProject(t *testing.T) {
 }
 
 // In this test it is expected that the operation will timeout and ctx.Err() will be DeadlineExceeded.
+func TestGetMeta(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:           gocbcore.Cas(7),
+		Flags:         33554432,
+		Datatype:      1,
+		Expiry:        1550000000,
+		Deleted:       true,
+		MutationToken: gocbcore.MutationToken{SeqNo: 12},
+	}
+
+	col := testGetCollection(t, provider)
+
+	res, err := col.GetMeta("key", nil)
+	if err != nil {
+		t.Fatalf("GetMeta encountered error: %v", err)
+	}
+
+	if res.Cas() != Cas(7) {
+		t.Fatalf("Expected cas value to be %d but was %d", Cas(7), res.Cas())
+	}
+
+	if res.Flags() != 33554432 || res.Datatype() != 1 {
+		t.Fatalf("Expected flags and datatype to be 33554432 and 1 but were %d and %d", res.Flags(), res.Datatype())
+	}
+
+	if res.Expiration() != 1550000000 {
+		t.Fatalf("Expected expiration to be 1550000000 but was %d", res.Expiration())
+	}
+
+	if res.SeqNo() != 12 {
+		t.Fatalf("Expected seqno to be 12 but was %d", res.SeqNo())
+	}
+
+	if !res.Deleted() {
+		t.Fatalf("Expected document to be deleted")
+	}
+}
+
+func TestGetMetaNonDefaultCollection(t *testing.T) {
+	provider := &mocktest.KvOperator{Cas: gocbcore.Cas(7)}
+	col := testGetCollection(t, provider)
+	other := col.clone()
+	other.sb = col.sb.withCollection("other")
+
+	_, err := other.GetMeta("key", nil)
+	if err != ErrGetMetaNotSupported {
+		t.Fatalf("Expected GetMeta to fail with ErrGetMetaNotSupported but was %v", err)
+	}
+}
+
+func TestLookupInAccessDeleted(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas: gocbcore.Cas(3),
+		Value: []gocbcore.SubDocResult{
+			{Value: []byte(`{"id":"txn"}`)},
+		},
+		ResultErr: &gocbcore.KvError{Code: gocbcore.StatusSubDocSuccessDeleted},
+	}
+
+	col := testGetCollection(t, provider)
+
+	opts := LookupInOptions{AccessDeleted: true}.XAttr("txn")
+	res, err := col.LookupIn("key", &opts)
+	if err != nil {
+		t.Fatalf("LookupIn encountered error: %v", err)
+	}
+
+	if provider.LookupInFlags&gocbcore.SubdocDocFlagAccessDeleted == 0 {
+		t.Fatalf("Expected access deleted flag to be sent")
+	}
+
+	if !res.Deleted() {
+		t.Fatalf("Expected document to be deleted")
+	}
+
+	var txn map[string]string
+	err = res.ContentAt(0, &txn)
+	if err != nil {
+		t.Fatalf("Failed to get content from result: %v", err)
+	}
+	if txn["id"] != "txn" {
+		t.Fatalf("Expected xattr id to be txn but was %s", txn["id"])
+	}
+
+	provider.ResultErr = nil
+	provider.Err = &gocbcore.KvError{Code: gocbcore.StatusInvalidArgs}
+	_, err = col.LookupIn("key", &opts)
+	if err != ErrAccessDeletedNotSupported {
+		t.Fatalf("Expected ErrAccessDeletedNotSupported but was %v", err)
+	}
+}
+
 func TestInsertContextTimeout1(t *testing.T) {
 	var doc testBreweryDocument
 	err := loadJSONTestDataset("beer_sample_single", &doc)
@@ -183,12 +279,12 @@ func TestInsertContextTimeout1(t *testing.T) {
 		t.Fatalf("Could not load dataset: %v", err)
 	}
 
-	provider := &mockKvOperator{
-		cas:                   gocbcore.Cas(0),
-		datatype:              1,
-		value:                 nil,
-		opWait:                2000 * time.Millisecond,
-		opCancellationSuccess: true,
+	provider := &mocktest.KvOperator{
+		Cas:           gocbcore.Cas(0),
+		Datatype:      1,
+		Value:         nil,
+		OpWait:        2000 * time.Millisecond,
+		CancelSuccess: true,
 	}
 	col := testGetCollection(t, provider)
 
@@ -218,12 +314,12 @@ func TestInsertContextTimeout2(t *testing.T) {
 		t.Fatalf("Could not load dataset: %v", err)
 	}
 
-	provider := &mockKvOperator{
-		cas:                   gocbcore.Cas(0),
-		datatype:              1,
-		value:                 nil,
-		opWait:                2000 * time.Millisecond,
-		opCancellationSuccess: true,
+	provider := &mocktest.KvOperator{
+		Cas:           gocbcore.Cas(0),
+		Datatype:      1,
+		Value:         nil,
+		OpWait:        2000 * time.Millisecond,
+		CancelSuccess: true,
 	}
 	col := testGetCollection(t, provider)
 
@@ -243,3 +339,342 @@ func TestInsertContextTimeout2(t *testing.T) {
 		t.Fatalf("Context error should have been nil")
 	}
 }
+
+func TestCollectionRefreshesAfterBucketRecreated(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+	col.setCollectionUnknown()
+
+	_, err := col.Get("recreated", nil)
+	if err == nil {
+		t.Fatalf("Expected Get to fail whilst collection is unknown")
+	}
+
+	cli := col.sb.getCachedClient().(*mockClient)
+	cli.collectionId = 9
+	cli.generation++
+
+	_, err = col.Get("recreated", nil)
+	if err != nil {
+		t.Fatalf("Expected Get to succeed after bucket was recreated but was %v", err)
+	}
+
+	if col.collectionID() != 9 {
+		t.Fatalf("Expected collection id to be refreshed to 9 but was %d", col.collectionID())
+	}
+}
+
+func TestUpdateFields(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(1),
+		Value: []gocbcore.SubDocResult{},
+	}
+	col := testGetCollection(t, provider)
+
+	res, err := col.UpdateFields("updateFields", map[string]interface{}{
+		"name":         "21st Amendment Brewery Cafe",
+		"address.city": "San Francisco",
+		"abv":          7.2,
+	}, nil)
+	if err != nil {
+		t.Fatalf("UpdateFields failed, error was %v", err)
+	}
+
+	if res.Cas() != 1 {
+		t.Fatalf("Expected cas to be 1 but was %d", res.Cas())
+	}
+
+	expected := []gocbcore.SubDocOp{
+		{Op: gocbcore.SubDocOpDictSet, Path: "abv", Value: []byte("7.2")},
+		{Op: gocbcore.SubDocOpDictSet, Path: "address.city", Value: []byte(`"San Francisco"`)},
+		{Op: gocbcore.SubDocOpDictSet, Path: "name", Value: []byte(`"21st Amendment Brewery Cafe"`)},
+	}
+	if len(provider.MutateInOps) != len(expected) {
+		t.Fatalf("Expected %d ops but was %d", len(expected), len(provider.MutateInOps))
+	}
+
+	for i, op := range provider.MutateInOps {
+		if op.Op != expected[i].Op || op.Path != expected[i].Path || string(op.Value) != string(expected[i].Value) {
+			t.Fatalf("Expected op %d to be %v but was %v", i, expected[i], op)
+		}
+
+		if op.Flags != gocbcore.SubdocFlag(SubdocFlagCreatePath) {
+			t.Fatalf("Expected op %d to create parents", i)
+		}
+	}
+}
+
+func TestUpdateFieldsNoFields(t *testing.T) {
+	col := testGetCollection(t, &mocktest.KvOperator{})
+
+	_, err := col.UpdateFields("updateFields", nil, nil)
+	if err != ErrNoFields {
+		t.Fatalf("Expected ErrNoFields but was %v", err)
+	}
+}
+
+type flagsRecordingProvider struct {
+	*mocktest.KvOperator
+	setFlags uint32
+}
+
+func (p *flagsRecordingProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.setFlags = opts.Flags
+	return p.KvOperator.SetEx(opts, cb)
+}
+
+func TestGetFlagsRoundTrip(t *testing.T) {
+	// Flags in the legacy format written by older SDKs, which have no common flags.
+	legacyFlags := uint32(0x02)
+	provider := &flagsRecordingProvider{KvOperator: &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Flags:    legacyFlags,
+		Datatype: 1,
+		Value:    []byte(`{"name":"a"}`),
+	}}
+	col := testGetCollection(t, provider)
+
+	res, err := col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Expected get to succeed but error was %v", err)
+	}
+	if res.Flags() != legacyFlags || res.Datatype() != 1 {
+		t.Fatalf("Expected flags %d and datatype 1 but had %d and %d", legacyFlags, res.Flags(), res.Datatype())
+	}
+
+	var raw []byte
+	err = res.Decode(&raw, func(bytes []byte, flags uint32, out interface{}) error {
+		*out.(*[]byte) = bytes
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected decode to succeed but error was %v", err)
+	}
+
+	_, err = col.Upsert("key", raw, &UpsertOptions{Encode: RawEncode(res.Flags())})
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setFlags != legacyFlags {
+		t.Fatalf("Expected flags %d to be written but were %d", legacyFlags, provider.setFlags)
+	}
+
+	_, err = col.Upsert("key", 1, &UpsertOptions{Encode: RawEncode(res.Flags())})
+	if err == nil {
+		t.Fatalf("Expected raw encoding of a non byte value to fail")
+	}
+}
+
+func TestUpsertValidateJSON(t *testing.T) {
+	provider := &flagsRecordingProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}}
+	col := testGetCollection(t, provider)
+
+	jsonFlags := gocbcore.EncodeCommonFlags(gocbcore.JsonType, gocbcore.NoCompression)
+	invalidUTF8 := []byte("{\"name\":\"\xff\"}")
+
+	_, err := col.Upsert("key", invalidUTF8, &UpsertOptions{Encode: RawEncode(jsonFlags)})
+	if err != nil {
+		t.Fatalf("Expected upsert without validation to succeed but error was %v", err)
+	}
+
+	provider.setFlags = 0
+	_, err = col.Upsert("key", invalidUTF8, &UpsertOptions{Encode: RawEncode(jsonFlags), ValidateJSON: true})
+	if errors.Cause(err) != ErrInvalidValue {
+		t.Fatalf("Expected upsert of invalid UTF-8 to fail with ErrInvalidValue but error was %v", err)
+	}
+	if provider.setFlags != 0 {
+		t.Fatalf("Expected invalid value not to be sent")
+	}
+
+	validating := col.WithJSONValidation()
+	_, err = validating.Upsert("key", []byte(`{"name":`), &UpsertOptions{Encode: RawEncode(jsonFlags)})
+	if errors.Cause(err) != ErrInvalidValue {
+		t.Fatalf("Expected upsert of invalid JSON to fail with ErrInvalidValue but error was %v", err)
+	}
+
+	binaryFlags := gocbcore.EncodeCommonFlags(gocbcore.BinaryType, gocbcore.NoCompression)
+	_, err = validating.Upsert("key", invalidUTF8, &UpsertOptions{Encode: RawEncode(binaryFlags)})
+	if err != nil {
+		t.Fatalf("Expected upsert of binary value to succeed but error was %v", err)
+	}
+
+	_, err = validating.Upsert("key", map[string]string{"name": "a"}, nil)
+	if err != nil {
+		t.Fatalf("Expected upsert of valid JSON to succeed but error was %v", err)
+	}
+}
+
+type compressionRecordingProvider struct {
+	*mocktest.KvOperator
+	setValue    []byte
+	setDatatype uint8
+	snappy      bool
+}
+
+func (p *compressionRecordingProvider) SupportsFeature(feature gocbcore.HelloFeature) bool {
+	return feature == gocbcore.FeatureSnappy && p.snappy
+}
+
+func (p *compressionRecordingProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.setValue = opts.Value
+	p.setDatatype = opts.Datatype
+	return p.KvOperator.SetEx(opts, cb)
+}
+
+func TestUpsertCompression(t *testing.T) {
+	provider := &compressionRecordingProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}, snappy: true}
+	col := testGetCollection(t, provider)
+	metrics := NewCollectionMetrics()
+	col.sb.MetricsRecorder = metrics
+
+	value := bytes.Repeat([]byte("compressible"), 100)
+	_, err := col.Upsert("key", value, nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setDatatype != 0 || !bytes.Equal(provider.setValue, value) {
+		t.Fatalf("Expected value not to be compressed when compression is disabled")
+	}
+
+	col.sb.ValueCompression = valueCompression{enabled: true}
+	_, err = col.Upsert("key", value, nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setDatatype&uint8(gocbcore.DatatypeFlagCompressed) == 0 || len(provider.setValue) >= len(value) {
+		t.Fatalf("Expected value to be sent compressed")
+	}
+
+	_, err = col.Upsert("key", value, &UpsertOptions{DisableCompression: true})
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setDatatype != 0 || !bytes.Equal(provider.setValue, value) {
+		t.Fatalf("Expected value not to be compressed when disabled for the operation")
+	}
+
+	incompressible := make([]byte, 1024)
+	rand.New(rand.NewSource(1)).Read(incompressible)
+	_, err = col.Upsert("key", incompressible, nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setDatatype != 0 || !bytes.Equal(provider.setValue, incompressible) {
+		t.Fatalf("Expected value which does not compress well to be sent uncompressed")
+	}
+
+	_, err = col.Upsert("key", []byte("short"), nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setDatatype != 0 {
+		t.Fatalf("Expected value below the minimum size not to be compressed")
+	}
+
+	// Values are left to gocbcore when the connection has not negotiated snappy.
+	provider.snappy = false
+	_, err = col.Upsert("key", value, nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.setDatatype != 0 || !bytes.Equal(provider.setValue, value) {
+		t.Fatalf("Expected value not to be compressed without snappy support")
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].CompressionCount != 2 || snapshot[0].CompressedCount != 1 {
+		t.Fatalf("Expected two values to be considered and one compressed to be recorded but was %+v", snapshot)
+	}
+	if ratio := snapshot[0].CompressionRatio(); ratio <= 0 || ratio >= 1 {
+		t.Fatalf("Expected compression ratio to be recorded but was %f", ratio)
+	}
+}
+
+func TestRemoveTombstoneXattrs(t *testing.T) {
+	provider := &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []gocbcore.SubDocResult{}}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Remove("key", &RemoveOptions{
+		TombstoneXattrs: map[string]interface{}{"_txn": "abc", "_deleted_by": "svc"},
+	})
+	if err != nil {
+		t.Fatalf("Expected remove to succeed but error was %v", err)
+	}
+
+	ops := provider.MutateInOps
+	if len(ops) != 3 {
+		t.Fatalf("Expected 2 xattr ops and a delete but had %d ops", len(ops))
+	}
+	xattrFlags := gocbcore.SubdocFlag(SubdocFlagXattr | SubdocFlagCreatePath)
+	if ops[0].Op != gocbcore.SubDocOpDictSet || ops[0].Path != "_deleted_by" || ops[0].Flags != xattrFlags ||
+		string(ops[0].Value) != `"svc"` {
+		t.Fatalf("Expected first op to set _deleted_by xattr but was %+v", ops[0])
+	}
+	if ops[1].Path != "_txn" || string(ops[1].Value) != `"abc"` {
+		t.Fatalf("Expected second op to set _txn xattr but was %+v", ops[1])
+	}
+	if ops[2].Op != gocbcore.SubDocOpDeleteDoc {
+		t.Fatalf("Expected last op to delete the document but was %+v", ops[2])
+	}
+
+	_, err = col.Remove("key", &RemoveOptions{
+		TombstoneXattrs: map[string]interface{}{"deleted_by": "svc"},
+	})
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected user xattr to fail with ErrInvalidArgument but error was %v", err)
+	}
+}
+
+type casChangingProvider struct {
+	*mocktest.KvOperator
+	getValue []byte
+	getCas   gocbcore.Cas
+}
+
+func (p *casChangingProvider) GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error) {
+	cb(&gocbcore.GetResult{Cas: p.getCas, Value: p.getValue}, nil)
+	return &mocktest.PendingOp{}, nil
+}
+
+func TestFetchDocumentAfterMutation(t *testing.T) {
+	provider := &casChangingProvider{
+		KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []gocbcore.SubDocResult{}},
+		getValue:   []byte(`{"name":"a"}`),
+		getCas:     gocbcore.Cas(1),
+	}
+	col := testGetCollection(t, provider)
+
+	res, err := col.Upsert("key", map[string]string{"name": "a"}, nil)
+	if err != nil || res.Document() != nil {
+		t.Fatalf("Expected upsert not to fetch the document by default but was %v", err)
+	}
+
+	res, err = col.Upsert("key", map[string]string{"name": "a"}, &UpsertOptions{FetchDocumentAfterMutation: true})
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but was %v", err)
+	}
+	var doc map[string]string
+	if res.Document() == nil || res.Document().Content(&doc) != nil || doc["name"] != "a" || res.Document().Cas() != 1 {
+		t.Fatalf("Expected document written by the upsert but was %v", res.Document())
+	}
+
+	mutateOpts := (&MutateInOptions{FetchDocumentAfterMutation: true}).Upsert("name", "a", false)
+	res, err = col.Mutate("key", &mutateOpts)
+	if err != nil || res.Document() == nil {
+		t.Fatalf("Expected mutate to fetch the document but was %v", err)
+	}
+
+	// A document changed between the mutation and the fetch is not the one written.
+	provider.getCas = gocbcore.Cas(2)
+	res, err = col.Mutate("key", &mutateOpts)
+	if errors.Cause(err) != ErrDocumentChangedAfterMutation {
+		t.Fatalf("Expected ErrDocumentChangedAfterMutation but was %v", err)
+	}
+	if res == nil || res.Cas() != 1 || res.Document() != nil {
+		t.Fatalf("Expected mutation result without a document but was %v", res)
+	}
+}
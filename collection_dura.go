@@ -7,8 +7,8 @@ import (
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
-func (c *Collection) observeOnceCas(tracectx opentracing.SpanContext, key []byte, cas Cas, forDelete bool, replicaIdx int, commCh chan uint) (pendingOp, error) {
-	agent, err := c.getKvProvider()
+func (c *Collection) observeOnceCas(ctx context.Context, tracectx opentracing.SpanContext, key []byte, cas Cas, forDelete bool, replicaIdx int, commCh chan uint) (pendingOp, error) {
+	agent, err := c.getKvProvider(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -16,7 +16,7 @@ func (c *Collection) observeOnceCas(tracectx opentracing.SpanContext, key []byte
 	return agent.ObserveEx(gocbcore.ObserveOptions{
 		Key:          key,
 		ReplicaIdx:   replicaIdx,
-		TraceContext: tracectx,
+		TraceContext: c.kvTraceContext(tracectx, "observe"),
 	}, func(res *gocbcore.ObserveResult, err error) {
 		if err != nil || res == nil {
 			commCh <- 0
@@ -65,8 +65,8 @@ func (c *Collection) observeOnceCas(tracectx opentracing.SpanContext, key []byte
 	})
 }
 
-func (c *Collection) observeOnceSeqNo(tracectx opentracing.SpanContext, mt MutationToken, replicaIdx int, commCh chan uint) (pendingOp, error) {
-	agent, err := c.getKvProvider()
+func (c *Collection) observeOnceSeqNo(ctx context.Context, tracectx opentracing.SpanContext, mt MutationToken, replicaIdx int, commCh chan uint) (pendingOp, error) {
+	agent, err := c.getKvProvider(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -75,7 +75,7 @@ func (c *Collection) observeOnceSeqNo(tracectx opentracing.SpanContext, mt Mutat
 		VbId:         mt.token.VbId,
 		VbUuid:       mt.token.VbUuid,
 		ReplicaIdx:   replicaIdx,
-		TraceContext: tracectx,
+		TraceContext: c.kvTraceContext(tracectx, "observe_seqno"),
 	}, func(res *gocbcore.ObserveVbResult, err error) {
 		if err != nil || res == nil {
 			commCh <- 0
@@ -99,9 +99,9 @@ func (c *Collection) observeOnceSeqNo(tracectx opentracing.SpanContext, mt Mutat
 func (c *Collection) observeOne(ctx context.Context, tracectx opentracing.SpanContext, key []byte, mt MutationToken, cas Cas, forDelete bool, replicaIdx int, replicaCh, persistCh chan bool) {
 	observeOnce := func(commCh chan uint) (pendingOp, error) {
 		if mt.token.VbUuid != 0 && mt.token.SeqNo != 0 {
-			return c.observeOnceSeqNo(tracectx, mt, replicaIdx, commCh)
+			return c.observeOnceSeqNo(ctx, tracectx, mt, replicaIdx, commCh)
 		}
-		return c.observeOnceCas(tracectx, key, cas, forDelete, replicaIdx, commCh)
+		return c.observeOnceCas(ctx, tracectx, key, cas, forDelete, replicaIdx, commCh)
 	}
 
 	sentReplicated := false
@@ -118,12 +118,6 @@ func (c *Collection) observeOne(ctx context.Context, tracectx opentracing.SpanCo
 		}
 	}
 
-	// Doing this will set the context deadline to whichever is shorter, what is already set or the timeout
-	// value
-	var cancel context.CancelFunc
-	ctx, cancel = context.WithTimeout(ctx, c.sb.DuraTimeout)
-	defer cancel()
-
 	commCh := make(chan uint)
 	for {
 		op, err := observeOnce(commCh)
@@ -173,7 +167,7 @@ func (c *Collection) durability(ctx context.Context, tracectx opentracing.SpanCo
 		ctx = context.Background()
 	}
 
-	agent, err := c.getKvProvider()
+	agent, err := c.getKvProvider(ctx)
 	if err != nil {
 		return err
 	}
@@ -186,6 +180,11 @@ func (c *Collection) durability(ctx context.Context, tracectx opentracing.SpanCo
 
 	keyBytes := []byte(key)
 
+	// Doing this will set the context deadline to whichever is shorter, what is already set or the timeout
+	// value
+	ctx, cancel := context.WithTimeout(ctx, c.sb.DuraTimeout)
+	defer cancel()
+
 	replicaCh := make(chan bool, numServers)
 	persistCh := make(chan bool, numServers)
 
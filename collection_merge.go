@@ -0,0 +1,127 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const defaultMergeMaxRetries = 10
+
+// MergeOptions are the options available to the Merge operation.
+type MergeOptions struct {
+	ParentSpanContext opentracing.SpanContext
+	Timeout           time.Duration
+	Context           context.Context
+	// Expiration is the expiry set on the merged document, as with Replace the existing expiry is not kept.
+	Expiration  uint32
+	PersistTo   uint
+	ReplicateTo uint
+	// MaxRetries is the number of times that the merge is retried when the document is modified concurrently,
+	// defaulting to 10.
+	MaxRetries uint
+}
+
+// Merge applies partial to the document specified by key using JSON merge patch (RFC 7386) semantics: fields in
+// partial replace those in the document, objects are merged recursively and fields set to null are removed.
+// The document is fetched and replaced using its CAS, retrying if it is modified concurrently, so partial
+// updates such as those received by HTTP PATCH handlers can be applied directly.
+func (c *Collection) Merge(key string, partial interface{}, opts *MergeOptions) (mutOut *MutationResult, errOut error) {
+	if opts == nil {
+		opts = &MergeOptions{}
+	}
+
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "Merge")
+	defer span.Finish()
+
+	patchBytes, err := json.Marshal(partial)
+	if err != nil {
+		return nil, err
+	}
+	var patch interface{}
+	err = unmarshalJSONNumbers(patchBytes, &patch)
+	if err != nil {
+		return nil, err
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = defaultMergeMaxRetries
+	}
+
+	deadlinedCtx := opts.Context
+	if deadlinedCtx == nil {
+		deadlinedCtx = context.Background()
+	}
+
+	d := c.deadline(deadlinedCtx, time.Now(), opts.Timeout)
+	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
+	defer cancel()
+
+	var res *MutationResult
+	for retries := uint(0); ; retries++ {
+		// The document cache is bypassed as a stale cas would never succeed.
+		doc, err := c.get(deadlinedCtx, span.Context(), key, &GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+
+		var current interface{}
+		err = unmarshalJSONNumbers(doc.contents, &current)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err = c.replace(span.Context(), key, mergePatch(current, patch), ReplaceOptions{
+			Context:    deadlinedCtx,
+			Expiration: opts.Expiration,
+			Cas:        doc.Cas(),
+		})
+		if err == nil {
+			break
+		}
+
+		if !IsKeyExistsError(err) || retries >= maxRetries {
+			return nil, err
+		}
+	}
+
+	if opts.PersistTo == 0 && opts.ReplicateTo == 0 {
+		return res, nil
+	}
+	return res, c.durability(opts.Context, span.Context(), key, res.Cas(), res.MutationToken(), opts.ReplicateTo, opts.PersistTo, false)
+}
+
+// unmarshalJSONNumbers decodes data into out with numbers decoded as json.Number, rather than float64, so that
+// integers larger than 2^53 are written back unchanged.
+func unmarshalJSONNumbers(data []byte, out interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// mergePatch applies patch to target as described by RFC 7386.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+		targetObj[name] = mergePatch(targetObj[name], value)
+	}
+
+	return targetObj
+}
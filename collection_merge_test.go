@@ -0,0 +1,133 @@
+package gocb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7386 appendix A.
+	cases := []struct {
+		target, patch, expected string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range cases {
+		var target, patch, expected interface{}
+		for _, v := range []struct {
+			raw string
+			out *interface{}
+		}{{tc.target, &target}, {tc.patch, &patch}, {tc.expected, &expected}} {
+			if err := json.Unmarshal([]byte(v.raw), v.out); err != nil {
+				t.Fatalf("Failed to unmarshal %s: %v", v.raw, err)
+			}
+		}
+
+		actual := mergePatch(target, patch)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("Expected merging %s into %s to give %s but was %v", tc.patch, tc.target, tc.expected, actual)
+		}
+	}
+}
+
+// casMismatchProvider fails the first failures replaces with a cas mismatch, recording the values replaced.
+type casMismatchProvider struct {
+	*mocktest.KvOperator
+	failures int
+	replaced []string
+}
+
+func (p *casMismatchProvider) ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.replaced = append(p.replaced, string(opts.Value))
+	if p.failures > 0 {
+		p.failures--
+		time.AfterFunc(0, func() {
+			cb(nil, &gocbcore.KvError{Code: gocbcore.StatusKeyExists})
+		})
+		return &mocktest.PendingOp{}, nil
+	}
+
+	return p.KvOperator.ReplaceEx(opts, cb)
+}
+
+func TestMerge(t *testing.T) {
+	provider := &casMismatchProvider{
+		KvOperator: &mocktest.KvOperator{
+			Cas:      gocbcore.Cas(5),
+			Datatype: 1,
+			Value:    []byte(`{"name":"beer","abv":5,"brewery":{"name":"x","city":"y"}}`),
+		},
+		failures: 2,
+	}
+	col := testGetCollection(t, provider)
+
+	res, err := col.Merge("beer", map[string]interface{}{
+		"abv":     nil,
+		"brewery": map[string]interface{}{"city": "z"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("Expected merge to succeed but was %v", err)
+	}
+	if res.Cas() != 5 {
+		t.Fatalf("Expected cas to be 5 but was %d", res.Cas())
+	}
+
+	if len(provider.replaced) != 3 {
+		t.Fatalf("Expected merge to be retried after cas mismatches, replaced %d times", len(provider.replaced))
+	}
+	expected := `{"brewery":{"city":"z","name":"x"},"name":"beer"}`
+	if provider.replaced[2] != expected {
+		t.Fatalf("Expected merged document to be %s but was %s", expected, provider.replaced[2])
+	}
+
+	provider.failures = 5
+	provider.replaced = nil
+	_, err = col.Merge("beer", map[string]interface{}{"abv": 6}, &MergeOptions{MaxRetries: 1})
+	if !IsKeyExistsError(err) {
+		t.Fatalf("Expected cas mismatch once retries were exhausted but was %v", err)
+	}
+	if len(provider.replaced) != 2 {
+		t.Fatalf("Expected 2 replace attempts but was %d", len(provider.replaced))
+	}
+}
+
+func TestMergeLargeIntegers(t *testing.T) {
+	provider := &casMismatchProvider{
+		KvOperator: &mocktest.KvOperator{
+			Cas:      gocbcore.Cas(5),
+			Datatype: 1,
+			Value:    []byte(`{"id":9007199254740993,"count":1}`),
+		},
+	}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Merge("key", map[string]interface{}{"other": int64(9007199254740995)}, nil)
+	if err != nil {
+		t.Fatalf("Expected merge to succeed but was %v", err)
+	}
+
+	expected := `{"count":1,"id":9007199254740993,"other":9007199254740995}`
+	if len(provider.replaced) != 1 || provider.replaced[0] != expected {
+		t.Fatalf("Expected merged document to be %s but was %v", expected, provider.replaced)
+	}
+}
@@ -0,0 +1,210 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+const defaultMigrationVersionField = "_version"
+
+// DocumentMigration upgrades the content of a document from one version of its schema to the next, returning the
+// upgraded content.  doc may be modified and returned.  Numbers within doc are decoded as json.Number so that they
+// are not changed when the document is written back.
+type DocumentMigration func(doc map[string]interface{}) (map[string]interface{}, error)
+
+// MigrationOptions are the options available when creating Migrations.
+type MigrationOptions struct {
+	// VersionField is the field of each document which holds the version of its schema, defaulting to "_version".
+	// Documents without the field are at version 0.
+	VersionField string
+	// WriteBack writes upgraded documents back to the server, using their CAS, so that each document is only
+	// upgraded once.  The expiry of the document is kept.  Failing to write a document back does not fail the Get,
+	// the upgraded document is still returned.
+	WriteBack bool
+}
+
+// Migrations holds the DocumentMigrations registered for each type of document, identified by the prefix of the
+// keys that the documents are stored under, and can be attached to a Collection using WithMigrations.  Full
+// document Get operations on that Collection upgrade documents written with an older version of their schema to
+// the latest version as they are read, so that long-lived datasets can evolve without rewriting every document at
+// once.  Migrations are safe for concurrent use.
+type Migrations struct {
+	lock         sync.RWMutex
+	versionField string
+	writeBack    bool
+	types        map[string]map[uint]DocumentMigration
+}
+
+// NewMigrations creates a new, empty, Migrations.
+func NewMigrations(opts *MigrationOptions) *Migrations {
+	if opts == nil {
+		opts = &MigrationOptions{}
+	}
+
+	versionField := opts.VersionField
+	if versionField == "" {
+		versionField = defaultMigrationVersionField
+	}
+
+	return &Migrations{
+		versionField: versionField,
+		writeBack:    opts.WriteBack,
+		types:        make(map[string]map[uint]DocumentMigration),
+	}
+}
+
+// Register registers migrate to upgrade documents whose keys begin with prefix from version to version+1.  Where
+// the prefixes of several types match a key, the migrations of the longest are used.  Documents are upgraded to
+// one more than the highest version registered for their type, so a migration must be registered for every
+// version before it.
+func (m *Migrations) Register(prefix string, version uint, migrate DocumentMigration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	steps, ok := m.types[prefix]
+	if !ok {
+		steps = make(map[uint]DocumentMigration)
+		m.types[prefix] = steps
+	}
+	steps[version] = migrate
+}
+
+// LatestVersion returns the version that documents with key are upgraded to, 0 if no migrations are registered
+// for them.
+func (m *Migrations) LatestVersion(key string) uint {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	_, latest := m.stepsForLocked(key)
+	return latest
+}
+
+// stepsForLocked returns the migrations of the type of document with key, and the version that they upgrade to.
+func (m *Migrations) stepsForLocked(key string) (map[uint]DocumentMigration, uint) {
+	var steps map[uint]DocumentMigration
+	matched := -1
+	for prefix, typeSteps := range m.types {
+		if len(prefix) > matched && strings.HasPrefix(key, prefix) {
+			steps = typeSteps
+			matched = len(prefix)
+		}
+	}
+
+	var latest uint
+	for version := range steps {
+		if version+1 > latest {
+			latest = version + 1
+		}
+	}
+	return steps, latest
+}
+
+// upgrade returns contents upgraded to the latest version of its type, or nil if it does not need upgrading.
+// Documents which are not JSON objects, or which are at or beyond the latest version, are not upgraded.
+func (m *Migrations) upgrade(key string, contents []byte) ([]byte, error) {
+	m.lock.RLock()
+	steps, latest := m.stepsForLocked(key)
+	m.lock.RUnlock()
+
+	if latest == 0 {
+		return nil, nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(contents))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil || doc == nil {
+		return nil, nil
+	}
+
+	version, err := m.documentVersion(doc)
+	if err != nil {
+		return nil, errors.Wrapf(ErrMigrationFailed, "document %s %s", key, err)
+	}
+	if version >= latest {
+		return nil, nil
+	}
+
+	for ; version < latest; version++ {
+		migrate := steps[version]
+		if migrate == nil {
+			return nil, errors.Wrapf(ErrMigrationFailed, "no migration registered for document %s from version %d",
+				key, version)
+		}
+
+		doc, err = migrate(doc)
+		if err != nil {
+			return nil, errors.Wrapf(ErrMigrationFailed, "document %s from version %d: %s", key, version, err)
+		}
+		if doc == nil {
+			return nil, errors.Wrapf(ErrMigrationFailed, "document %s from version %d: migration returned no document",
+				key, version)
+		}
+		doc[m.versionField] = version + 1
+	}
+
+	return json.Marshal(doc)
+}
+
+// documentVersion returns the version held in the version field of doc.
+func (m *Migrations) documentVersion(doc map[string]interface{}) (uint, error) {
+	value, ok := doc[m.versionField]
+	if !ok {
+		return 0, nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, errors.Errorf("has a %s which is not a number", m.versionField)
+	}
+	version, err := strconv.ParseUint(number.String(), 10, 0)
+	if err != nil {
+		return 0, errors.Errorf("has an invalid %s %s", m.versionField, number)
+	}
+	return uint(version), nil
+}
+
+// WithMigrations returns a copy of the Collection which upgrades documents using migrations as they are fetched by
+// full document Get operations.  Documents fetched with Project are not upgraded, and GetAs does not project the
+// document to the fields of a struct, so that documents are always upgraded before being decoded.
+func (c *Collection) WithMigrations(migrations *Migrations) *Collection {
+	n := c.clone()
+	n.sb = c.sb.withMigrations(migrations)
+	return n
+}
+
+// migrate upgrades doc in place if it was written with an older version of its schema than the latest registered
+// with the Migrations of the Collection, writing it back if WriteBack is set.
+func (c *Collection) migrate(ctx context.Context, traceCtx opentracing.SpanContext, doc *GetResult) error {
+	m := c.sb.Migrations
+	if m == nil {
+		return nil
+	}
+
+	contents, err := m.upgrade(doc.id, doc.contents)
+	if err != nil || contents == nil {
+		return err
+	}
+	doc.contents = contents
+
+	if !m.writeBack {
+		return nil
+	}
+
+	// A subdocument full document set, unlike a replace, keeps the expiry of the document.
+	res, err := c.mutate(traceCtx, doc.id, MutateInOptions{Context: ctx, Cas: doc.cas}.Upsert("", contents, false))
+	if err != nil {
+		logDebugf("Failed to write back migrated document (%s)", err)
+		return nil
+	}
+
+	doc.cas = res.Cas()
+	return nil
+}
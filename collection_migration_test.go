@@ -0,0 +1,118 @@
+package gocb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func testUserMigrations(opts *MigrationOptions) *Migrations {
+	migrations := NewMigrations(opts)
+	migrations.Register("user::", 0, func(doc map[string]interface{}) (map[string]interface{}, error) {
+		doc["fullName"] = doc["name"]
+		delete(doc, "name")
+		return doc, nil
+	})
+	migrations.Register("user::", 1, func(doc map[string]interface{}) (map[string]interface{}, error) {
+		if _, ok := doc["fullName"].(string); !ok {
+			return nil, errors.New("fullName is not a string")
+		}
+		doc["active"] = true
+		return doc, nil
+	})
+	return migrations
+}
+
+func TestGetMigratesDocument(t *testing.T) {
+	provider := &casChangingProvider{
+		KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(7), Value: []gocbcore.SubDocResult{}},
+		getValue:   []byte(`{"name":"a","age":30}`),
+		getCas:     gocbcore.Cas(1),
+	}
+	migrations := testUserMigrations(nil)
+	col := testGetCollection(t, provider).WithMigrations(migrations)
+
+	if migrations.LatestVersion("user::1") != 2 || migrations.LatestVersion("order::1") != 0 {
+		t.Fatalf("Expected latest versions of 2 and 0 but were %d and %d",
+			migrations.LatestVersion("user::1"), migrations.LatestVersion("order::1"))
+	}
+
+	res, err := col.Get("user::1", nil)
+	if err != nil {
+		t.Fatalf("Expected get to succeed but was %v", err)
+	}
+	var doc map[string]interface{}
+	if err := res.Content(&doc); err != nil {
+		t.Fatalf("Failed to decode document: %v", err)
+	}
+	if doc["fullName"] != "a" || doc["name"] != nil || doc["active"] != true || doc["age"] != float64(30) ||
+		doc["_version"] != float64(2) {
+		t.Fatalf("Expected document to be migrated to version 2 but was %v", doc)
+	}
+	if res.Cas() != 1 || provider.MutateInOps != nil {
+		t.Fatalf("Expected document not to be written back but cas was %d", res.Cas())
+	}
+
+	type user struct {
+		FullName string `json:"fullName"`
+	}
+	var u user
+	if _, err := col.GetAs("user::1", &u, nil); err != nil || u.FullName != "a" {
+		t.Fatalf("Expected GetAs to decode the migrated document but was %v, %v", u, err)
+	}
+
+	// Documents of other types, or already at the latest version, are not changed.
+	res, err = col.Get("order::1", nil)
+	if err != nil || string(res.contents) != `{"name":"a","age":30}` {
+		t.Fatalf("Expected document without migrations to be unchanged but was %s, %v", res.contents, err)
+	}
+	provider.getValue = []byte(`{"fullName":"a","_version":2}`)
+	res, err = col.Get("user::1", nil)
+	if err != nil || string(res.contents) != `{"fullName":"a","_version":2}` {
+		t.Fatalf("Expected latest document to be unchanged but was %s, %v", res.contents, err)
+	}
+
+	provider.getValue = []byte(`{"fullName":7,"_version":1}`)
+	res, err = col.Get("user::1", nil)
+	if errors.Cause(err) != ErrMigrationFailed || res != nil {
+		t.Fatalf("Expected failed migration to fail the get but was %v", err)
+	}
+
+	provider.getValue = []byte(`{"fullName":"a","_version":"one"}`)
+	_, err = col.Get("user::1", nil)
+	if errors.Cause(err) != ErrMigrationFailed {
+		t.Fatalf("Expected invalid version to fail the get but was %v", err)
+	}
+}
+
+func TestGetMigratesDocumentWriteBack(t *testing.T) {
+	provider := &casChangingProvider{
+		KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(7), Value: []gocbcore.SubDocResult{}},
+		getValue:   []byte(`{"_version":1,"fullName":"a","id":12345678901234567890}`),
+		getCas:     gocbcore.Cas(1),
+	}
+	col := testGetCollection(t, provider).WithMigrations(testUserMigrations(&MigrationOptions{WriteBack: true}))
+
+	res, err := col.Get("user::1", nil)
+	if err != nil {
+		t.Fatalf("Expected get to succeed but was %v", err)
+	}
+	if res.Cas() != 7 {
+		t.Fatalf("Expected cas of the written back document but was %d", res.Cas())
+	}
+
+	if len(provider.MutateInOps) != 1 || provider.MutateInOps[0].Op != gocbcore.SubDocOpSetDoc {
+		t.Fatalf("Expected document to be written back with a full document set but was %v", provider.MutateInOps)
+	}
+	var written map[string]json.RawMessage
+	if err := json.Unmarshal(provider.MutateInOps[0].Value, &written); err != nil {
+		t.Fatalf("Failed to decode written document: %v", err)
+	}
+	if string(written["id"]) != "12345678901234567890" || string(written["_version"]) != "2" ||
+		string(written["active"]) != "true" {
+		t.Fatalf("Expected migrated document to be written back unchanged but was %s", provider.MutateInOps[0].Value)
+	}
+}
@@ -0,0 +1,71 @@
+package gocb
+
+import (
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// ReadOnly returns a copy of the Collection which rejects all mutations with ErrReadOnly before they are sent
+// to the server.  This is useful for enforcing that code only reads from, for example, replica or disaster
+// recovery clusters.  Operations which lock a document or change its expiry are also rejected.
+func (c *Collection) ReadOnly() *Collection {
+	n := c.clone()
+	n.sb = c.sb.withReadOnly(true)
+	return n
+}
+
+// readOnlyProvider fails the dispatch of every operation which would modify a document.
+type readOnlyProvider struct {
+	kvProvider
+}
+
+func (p *readOnlyProvider) AddEx(opts gocbcore.AddOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) MutateInEx(opts gocbcore.MutateInOptions, cb gocbcore.MutateInExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) GetAndTouchEx(opts gocbcore.GetAndTouchOptions, cb gocbcore.GetAndTouchExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) GetAndLockEx(opts gocbcore.GetAndLockOptions, cb gocbcore.GetAndLockExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) UnlockEx(opts gocbcore.UnlockOptions, cb gocbcore.UnlockExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) TouchEx(opts gocbcore.TouchOptions, cb gocbcore.TouchExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) IncrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) DecrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) AppendEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
+
+func (p *readOnlyProvider) PrependEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	return nil, ErrReadOnly
+}
@@ -0,0 +1,37 @@
+package gocb
+
+import (
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestCollectionReadOnly(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    []byte(`{}`),
+	}
+	col := testGetCollection(t, provider).ReadOnly()
+
+	_, err := col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Expected Get to succeed but error was %v", err)
+	}
+
+	_, err = col.Upsert("key", "value", nil)
+	if err != ErrReadOnly {
+		t.Fatalf("Expected Upsert to be rejected but error was %v", err)
+	}
+
+	_, err = col.Remove("key", nil)
+	if err != ErrReadOnly {
+		t.Fatalf("Expected Remove to be rejected but error was %v", err)
+	}
+
+	_, err = col.Binary().Increment("key", nil)
+	if err != ErrReadOnly {
+		t.Fatalf("Expected Increment to be rejected but error was %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package gocb
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// RenameOptions are the options available to the Rename operation.
+type RenameOptions struct {
+	ParentSpanContext opentracing.SpanContext
+	// Timeout is the timeout of each of the operations which make up the rename.
+	Timeout time.Duration
+	Context context.Context
+	// Cas, if set, is the cas which the document must have for it to be renamed.
+	Cas         Cas
+	PersistTo   uint
+	ReplicateTo uint
+}
+
+// RenameResult is the result of a Rename operation.
+type RenameResult struct {
+	MutationResult
+	removedMt MutationToken
+}
+
+// RemovedMutationToken returns the mutation token of the removal of the document under its old key.  The
+// mutation token of the document under its new key is returned by MutationToken.
+func (r *RenameResult) RemovedMutationToken() MutationToken {
+	return r.removedMt
+}
+
+// Rename moves the document stored under oldKey to newKey, keeping its content, flags and expiry.  The document
+// is read, inserted under newKey and then removed from oldKey, using the cas that it was read with.  If newKey
+// already exists an error satisfying IsKeyExistsError is returned.  If the document is changed or removed between
+// being read and removed, or the insert does not meet the requested durability, then the document inserted under
+// newKey is removed again and the error is returned, leaving the document under oldKey.  If it is not known whether
+// the document was removed from oldKey, such as when the remove timed out, the document under newKey is kept, so
+// that it cannot be lost under both keys, and the error is returned naming both keys along with the result of the
+// insert.
+func (c *Collection) Rename(oldKey, newKey string, opts *RenameOptions) (*RenameResult, error) {
+	if opts == nil {
+		opts = &RenameOptions{}
+	}
+
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "Rename")
+	defer span.Finish()
+
+	doc, err := c.getForRename(span.Context(), oldKey, opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Cas != 0 && doc.cas != opts.Cas {
+		return nil, kvError{
+			id:          oldKey,
+			status:      gocbcore.StatusKeyExists,
+			description: "the document has been modified",
+		}
+	}
+
+	inserted, err := c.insertRaw(span.Context(), newKey, doc, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.PersistTo > 0 || opts.ReplicateTo > 0 {
+		err = c.durability(opts.Context, span.Context(), newKey, inserted.Cas(), inserted.MutationToken(),
+			opts.ReplicateTo, opts.PersistTo, false)
+		if err != nil {
+			c.undoRenameInsert(span.Context(), newKey, inserted.Cas(), opts)
+			return nil, err
+		}
+	}
+
+	removed, err := c.remove(span.Context(), oldKey, RemoveOptions{
+		Context: opts.Context,
+		Timeout: opts.Timeout,
+		Cas:     doc.cas,
+	})
+	if err != nil {
+		if !IsKeyExistsError(err) && !IsKeyNotFoundError(err) {
+			return &RenameResult{MutationResult: *inserted}, errors.Wrapf(err,
+				"rename may not have completed, the document is under %s and may also still be under %s",
+				newKey, oldKey)
+		}
+		c.undoRenameInsert(span.Context(), newKey, inserted.Cas(), opts)
+		return nil, err
+	}
+
+	res := &RenameResult{
+		MutationResult: *inserted,
+		removedMt:      removed.MutationToken(),
+	}
+
+	if opts.PersistTo == 0 && opts.ReplicateTo == 0 {
+		return res, nil
+	}
+	return res, c.durability(opts.Context, span.Context(), oldKey, removed.Cas(), removed.MutationToken(),
+		opts.ReplicateTo, opts.PersistTo, true)
+}
+
+// renamedDocument is a document as it was read to be renamed.
+type renamedDocument struct {
+	value  []byte
+	flags  uint32
+	expiry uint32
+	cas    Cas
+}
+
+// getForRename reads the content, flags and expiry of the document, which are all read in one lookup so that
+// they are consistent with each other and with the cas.
+func (c *Collection) getForRename(traceCtx opentracing.SpanContext, key string, opts *RenameOptions) (*renamedDocument, error) {
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d := c.deadline(ctx, time.Now(), opts.Timeout)
+	ctx, cancel := context.WithDeadline(ctx, d)
+	defer cancel()
+
+	spec := LookupInOptions{}.XAttr("$document.exptime").XAttr("$document.flags").Path("")
+	res, err := c.lookupIn(ctx, traceCtx, key, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &renamedDocument{cas: res.Cas()}
+	err = res.ContentAt(0, &doc.expiry)
+	if err != nil {
+		return nil, err
+	}
+	err = res.ContentAt(1, &doc.flags)
+	if err != nil {
+		return nil, err
+	}
+	if res.contents[2].err != nil {
+		return nil, res.contents[2].err
+	}
+	doc.value = res.contents[2].data
+
+	return doc, nil
+}
+
+// insertRaw inserts the content of doc under key without encoding it again, keeping its flags and expiry.
+func (c *Collection) insertRaw(traceCtx opentracing.SpanContext, key string, doc *renamedDocument, opts *RenameOptions) (mutOut *MutationResult, errOut error) {
+	deadlinedCtx := opts.Context
+	if deadlinedCtx == nil {
+		deadlinedCtx = context.Background()
+	}
+
+	d := c.deadline(deadlinedCtx, time.Now(), opts.Timeout)
+	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
+	defer cancel()
+
+	agent, err := c.getKvProvider(deadlinedCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.cacheInvalidate(key)
+	ctrl := c.newOpManager(deadlinedCtx, key)
+	err = ctrl.wait(agent.AddEx(gocbcore.AddOptions{
+		Key:          []byte(key),
+		CollectionID: c.collectionID(),
+		Value:        doc.value,
+		Flags:        doc.flags,
+		Expiry:       doc.expiry,
+		TraceContext: c.kvTraceContext(traceCtx, "rename"),
+	}, func(res *gocbcore.StoreResult, err error) {
+		if err != nil {
+			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
+				c.setCollectionUnknown()
+			}
+			errOut = ctrl.enhanceErr(err)
+			ctrl.resolve()
+			return
+		}
+
+		mutTok := MutationToken{
+			token:      res.MutationToken,
+			bucketName: c.sb.BucketName,
+		}
+		mutOut = &MutationResult{
+			mt: mutTok,
+		}
+		mutOut.cas = Cas(res.Cas)
+		c.recordDocumentWrite("rename", len(doc.value))
+		c.cacheWriteThrough(key, doc.value, doc.flags, mutOut.cas, doc.expiry)
+
+		ctrl.resolve()
+	}))
+	if err != nil {
+		errOut = err
+	}
+
+	return
+}
+
+// undoRenameInsert removes the document inserted by a rename which could not be completed.  The context of the
+// rename is not used as the rename may have failed because it was cancelled.
+func (c *Collection) undoRenameInsert(traceCtx opentracing.SpanContext, key string, cas Cas, opts *RenameOptions) {
+	_, err := c.remove(traceCtx, key, RemoveOptions{
+		Timeout: opts.Timeout,
+		Cas:     cas,
+	})
+	if err != nil {
+		logWarnf("Failed to remove %s after its rename failed, the document now exists under both keys (%s)", key, err)
+	}
+}
@@ -0,0 +1,126 @@
+package gocb
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type renameProvider struct {
+	*mocktest.KvOperator
+	lock      sync.Mutex
+	added     []gocbcore.AddOptions
+	deleted   []gocbcore.DeleteOptions
+	deleteErr error
+}
+
+func newRenameProvider() *renameProvider {
+	return &renameProvider{KvOperator: &mocktest.KvOperator{
+		Cas: gocbcore.Cas(7),
+		Value: []gocbcore.SubDocResult{
+			{Value: []byte(`3600`)},
+			{Value: []byte(`33554432`)},
+			{Value: []byte(`{"name":"a"}`)},
+		},
+	}}
+}
+
+func (p *renameProvider) AddEx(opts gocbcore.AddOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.lock.Lock()
+	p.added = append(p.added, opts)
+	p.lock.Unlock()
+
+	go cb(&gocbcore.StoreResult{Cas: 9}, nil)
+	return &mocktest.PendingOp{}, nil
+}
+
+func (p *renameProvider) DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error) {
+	p.lock.Lock()
+	p.deleted = append(p.deleted, opts)
+	p.lock.Unlock()
+
+	if p.deleteErr != nil && string(opts.Key) == "old" {
+		go cb(nil, p.deleteErr)
+		return &mocktest.PendingOp{}, nil
+	}
+
+	go cb(&gocbcore.DeleteResult{Cas: 10}, nil)
+	return &mocktest.PendingOp{}, nil
+}
+
+func TestCollectionRename(t *testing.T) {
+	provider := newRenameProvider()
+	col := testGetCollection(t, provider)
+
+	res, err := col.Rename("old", "new", nil)
+	if err != nil {
+		t.Fatalf("Expected rename to succeed but error was %v", err)
+	}
+	if res.Cas() != 9 {
+		t.Fatalf("Expected cas of the new document but was %d", res.Cas())
+	}
+
+	if len(provider.added) != 1 {
+		t.Fatalf("Expected one insert but had %d", len(provider.added))
+	}
+	added := provider.added[0]
+	if string(added.Key) != "new" || string(added.Value) != `{"name":"a"}` || added.Flags != 33554432 || added.Expiry != 3600 {
+		t.Fatalf("Expected document to be inserted unchanged but was %+v", added)
+	}
+
+	if len(provider.deleted) != 1 || string(provider.deleted[0].Key) != "old" || provider.deleted[0].Cas != 7 {
+		t.Fatalf("Expected old document to be removed with its cas but had %+v", provider.deleted)
+	}
+}
+
+func TestCollectionRenameCasMismatch(t *testing.T) {
+	provider := newRenameProvider()
+	col := testGetCollection(t, provider)
+
+	_, err := col.Rename("old", "new", &RenameOptions{Cas: 6})
+	if !IsKeyExistsError(err) {
+		t.Fatalf("Expected key exists error but was %v", err)
+	}
+	if len(provider.added) != 0 {
+		t.Fatalf("Expected nothing to be inserted")
+	}
+}
+
+func TestCollectionRenameUndoesInsert(t *testing.T) {
+	provider := newRenameProvider()
+	provider.deleteErr = &gocbcore.KvError{Code: gocbcore.StatusKeyExists}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Rename("old", "new", nil)
+	if !IsKeyExistsError(err) {
+		t.Fatalf("Expected key exists error but was %v", err)
+	}
+
+	if len(provider.deleted) != 2 || string(provider.deleted[1].Key) != "new" || provider.deleted[1].Cas != 9 {
+		t.Fatalf("Expected new document to be removed with its cas but had %+v", provider.deleted)
+	}
+}
+
+func TestCollectionRenameKeepsInsertWhenRemoveAmbiguous(t *testing.T) {
+	provider := newRenameProvider()
+	provider.deleteErr = gocbcore.ErrTimeout
+	col := testGetCollection(t, provider)
+
+	res, err := col.Rename("old", "new", nil)
+	if !IsTimeoutError(err) {
+		t.Fatalf("Expected timeout error but was %v", err)
+	}
+	if !strings.Contains(err.Error(), "new") || !strings.Contains(err.Error(), "old") {
+		t.Fatalf("Expected error to name both keys but was %v", err)
+	}
+	if res == nil || res.Cas() != 9 {
+		t.Fatalf("Expected result of the insert to be returned but was %v", res)
+	}
+
+	if len(provider.deleted) != 1 {
+		t.Fatalf("Expected new document to be kept but had %+v", provider.deleted)
+	}
+}
@@ -0,0 +1,301 @@
+package gocb
+
+import (
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// serverGroupTopologyTTL is how long the server groups of the nodes holding each vbucket are cached for before
+// they are fetched again.
+const serverGroupTopologyTTL = 30 * time.Second
+
+// serverGroupFailureTTL is how long a failure to fetch the server groups is cached for, fetching them requires
+// cluster management rights which most users do not have.
+const serverGroupFailureTTL = 5 * time.Minute
+
+// GetAnyReplicaOptions are the options available to the GetAnyReplica command.
+type GetAnyReplicaOptions struct {
+	ParentSpanContext opentracing.SpanContext
+	Timeout           time.Duration
+	Context           context.Context
+	// PreferredServerGroup is the server group, such as a rack or availability zone, whose replicas are read in
+	// preference to those in other groups, reducing cross zone traffic.  If no replica in the group can be read
+	// then the document is read from any replica.
+	PreferredServerGroup string
+}
+
+// GetAnyReplica returns the value of a document from whichever replica responds first, or from a replica in
+// opts.PreferredServerGroup if one holds the document.  Use Get to read the active copy of the document.
+func (c *Collection) GetAnyReplica(key string, opts *GetAnyReplicaOptions) (docOut *GetResult, errOut error) {
+	if opts == nil {
+		opts = &GetAnyReplicaOptions{}
+	}
+
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "GetAnyReplica")
+	defer span.Finish()
+
+	deadlinedCtx := opts.Context
+	if deadlinedCtx == nil {
+		deadlinedCtx = context.Background()
+	}
+
+	d := c.deadline(deadlinedCtx, time.Now(), opts.Timeout)
+	deadlinedCtx, cancel := context.WithDeadline(deadlinedCtx, d)
+	defer cancel()
+
+	agent, err := c.getKvProvider(deadlinedCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.PreferredServerGroup != "" {
+		for _, replicaIdx := range c.replicasInServerGroup(deadlinedCtx, key, opts.PreferredServerGroup) {
+			doc, err := c.getReplica(deadlinedCtx, span.Context(), agent, key, replicaIdx)
+			if err == nil {
+				return doc, nil
+			}
+			if deadlinedCtx.Err() != nil {
+				return nil, err
+			}
+
+			logDebugf("Failed to read %s from replica %d in server group %s, falling back to any replica (%s)",
+				key, replicaIdx, opts.PreferredServerGroup, err)
+		}
+	}
+
+	// A replica index of zero reads from all of the replicas and returns the first response.
+	return c.getReplica(deadlinedCtx, span.Context(), agent, key, 0)
+}
+
+func (c *Collection) getReplica(ctx context.Context, traceCtx opentracing.SpanContext, agent kvProvider, key string,
+	replicaIdx int) (docOut *GetResult, errOut error) {
+	ctrl := c.newOpManager(ctx, key)
+	err := ctrl.wait(agent.GetReplicaEx(gocbcore.GetReplicaOptions{
+		Key:          []byte(key),
+		CollectionID: c.collectionID(),
+		TraceContext: c.kvTraceContext(traceCtx, "get_any_replica"),
+		ReplicaIdx:   replicaIdx,
+	}, func(res *gocbcore.GetReplicaResult, err error) {
+		if err != nil {
+			if gocbcore.IsErrorStatus(err, gocbcore.StatusCollectionUnknown) {
+				c.setCollectionUnknown()
+			}
+
+			errOut = ctrl.enhanceErr(err)
+			ctrl.resolve()
+			return
+		}
+		if res != nil {
+			doc := &GetResult{
+				id:       key,
+				contents: res.Value,
+				flags:    res.Flags,
+				datatype: res.Datatype,
+				cas:      Cas(res.Cas),
+			}
+
+			docOut = doc
+			c.recordDocumentRead("get_any_replica", len(res.Value))
+		}
+
+		ctrl.resolve()
+	}))
+	if err != nil {
+		errOut = err
+	}
+
+	return
+}
+
+// replicasInServerGroup returns the indexes of the replicas of key which are held by nodes in group.  If the
+// server groups of the nodes cannot be found then no replicas are returned.  An expired topology is still used
+// when it cannot be refreshed.
+func (c *Collection) replicasInServerGroup(ctx context.Context, key string, group string) []int {
+	topology, err := c.serverGroupTopology(ctx)
+	if err != nil {
+		logDebugf("Failed to fetch server groups, reading from any replica (%s)", err)
+	}
+	if topology == nil {
+		return nil
+	}
+
+	stored, err := storedKey([]byte(key), c.sb.KeyPrefix, c.sb.HashLongKeys)
+	if err != nil {
+		return nil
+	}
+
+	return topology.replicasInGroup(stored, group)
+}
+
+// serverGroupTopology returns the server group of the nodes holding each vbucket of the bucket, fetching it
+// if it is not cached or has expired.  Only one caller fetches it at a time, and outside of the lock, so that
+// while it is being fetched other callers are given the expired topology, or none, rather than waiting.
+func (c *Collection) serverGroupTopology(ctx context.Context) (*serverGroupTopology, error) {
+	c.csb.serverGroupsLock.Lock()
+	cached := c.csb.serverGroups
+	if cached != nil && time.Since(cached.fetched) < serverGroupTopologyTTL {
+		c.csb.serverGroupsLock.Unlock()
+		return cached, nil
+	}
+	if c.csb.serverGroupsFetching {
+		c.csb.serverGroupsLock.Unlock()
+		return cached, nil
+	}
+	if c.csb.serverGroupsErr != nil && time.Since(c.csb.serverGroupsFailed) < serverGroupFailureTTL {
+		err := c.csb.serverGroupsErr
+		c.csb.serverGroupsLock.Unlock()
+		return cached, err
+	}
+	c.csb.serverGroupsFetching = true
+	c.csb.serverGroupsLock.Unlock()
+
+	topology, err := c.fetchServerGroupTopology(ctx)
+
+	c.csb.serverGroupsLock.Lock()
+	defer c.csb.serverGroupsLock.Unlock()
+	c.csb.serverGroupsFetching = false
+	if err != nil {
+		c.csb.serverGroupsErr = err
+		c.csb.serverGroupsFailed = time.Now()
+		return cached, err
+	}
+
+	c.csb.serverGroups = topology
+	c.csb.serverGroupsErr = nil
+	return topology, nil
+}
+
+func (c *Collection) fetchServerGroupTopology(ctx context.Context) (*serverGroupTopology, error) {
+	provider, err := c.sb.getCachedClient().getHTTPProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	return fetchServerGroupTopology(ctx, provider, c.sb.BucketName)
+}
+
+type serverGroupTopology struct {
+	vbMap [][]int
+	// groups holds the server group of each server in the vbucket map.
+	groups  []string
+	fetched time.Time
+}
+
+// replicasInGroup returns the indexes of the replicas of the vbucket of key which are held by nodes in group.
+func (t *serverGroupTopology) replicasInGroup(key []byte, group string) []int {
+	if len(t.vbMap) == 0 {
+		return nil
+	}
+
+	var replicas []int
+	servers := t.vbMap[int(cbCrc(key))%len(t.vbMap)]
+	// The first server of each vbucket holds the active copy.
+	for replicaIdx := 1; replicaIdx < len(servers); replicaIdx++ {
+		server := servers[replicaIdx]
+		if server >= 0 && server < len(t.groups) && t.groups[server] == group {
+			replicas = append(replicas, replicaIdx)
+		}
+	}
+
+	return replicas
+}
+
+type serverGroupsJSON struct {
+	Groups []struct {
+		Name  string `json:"name"`
+		Nodes []struct {
+			Hostname string `json:"hostname"`
+		} `json:"nodes"`
+	} `json:"groups"`
+}
+
+type bucketServerMapJSON struct {
+	VBucketServerMap struct {
+		ServerList []string `json:"serverList"`
+		VBucketMap [][]int  `json:"vBucketMap"`
+	} `json:"vBucketServerMap"`
+}
+
+func fetchServerGroupTopology(ctx context.Context, provider httpProvider, bucketName string) (*serverGroupTopology, error) {
+	var groupsData serverGroupsJSON
+	err := getMgmtJSON(ctx, provider, "/pools/default/serverGroups", &groupsData)
+	if err != nil {
+		return nil, err
+	}
+
+	var bucketData bucketServerMapJSON
+	err = getMgmtJSON(ctx, provider, "/pools/default/buckets/"+url.PathEscape(bucketName), &bucketData)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nodes are listed with their management port and servers with their data port so they are matched by host.
+	hostGroups := make(map[string]string)
+	for _, group := range groupsData.Groups {
+		for _, node := range group.Nodes {
+			hostGroups[hostFromAddress(node.Hostname)] = group.Name
+		}
+	}
+
+	serverMap := bucketData.VBucketServerMap
+	topology := &serverGroupTopology{
+		vbMap:   serverMap.VBucketMap,
+		groups:  make([]string, len(serverMap.ServerList)),
+		fetched: time.Now(),
+	}
+	for i, server := range serverMap.ServerList {
+		topology.groups[i] = hostGroups[hostFromAddress(server)]
+	}
+
+	return topology, nil
+}
+
+func getMgmtJSON(ctx context.Context, provider httpProvider, path string, valuePtr interface{}) error {
+	resp, err := provider.DoHttpRequest(&gocbcore.HttpRequest{
+		Service: gocbcore.ServiceType(MgmtService),
+		Path:    path,
+		Method:  "GET",
+		Context: ctx,
+	})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			logDebugf("Failed to close socket (%s)", err)
+		}
+	}()
+
+	if resp.StatusCode != 200 {
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return networkError{statusCode: resp.StatusCode, message: string(data)}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(valuePtr)
+}
+
+func hostFromAddress(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
+
+// cbCrc returns the hash used to map a key to its vbucket.
+func cbCrc(key []byte) uint32 {
+	return crc32.ChecksumIEEE(key) >> 16
+}
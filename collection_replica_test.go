@@ -0,0 +1,148 @@
+package gocb
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type replicaRecordingProvider struct {
+	*mocktest.KvOperator
+	lock       sync.Mutex
+	replicas   []int
+	failIdx    int
+	failStatus gocbcore.StatusCode
+}
+
+func (p *replicaRecordingProvider) GetReplicaEx(opts gocbcore.GetReplicaOptions, cb gocbcore.GetReplicaExCallback) (gocbcore.PendingOp, error) {
+	p.lock.Lock()
+	p.replicas = append(p.replicas, opts.ReplicaIdx)
+	p.lock.Unlock()
+
+	if opts.ReplicaIdx == p.failIdx {
+		go cb(nil, &gocbcore.KvError{Code: p.failStatus})
+		return &mocktest.PendingOp{}, nil
+	}
+
+	return p.KvOperator.GetReplicaEx(opts, cb)
+}
+
+func testServerGroupsHTTPProvider() *mockHTTPProvider {
+	return &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			var body string
+			switch req.Path {
+			case "/pools/default/serverGroups":
+				body = `{"groups":[{"name":"zone-a","nodes":[{"hostname":"10.0.0.1:8091"}]},` +
+					`{"name":"zone-b","nodes":[{"hostname":"10.0.0.2:8091"},{"hostname":"10.0.0.3:8091"}]}]}`
+			case "/pools/default/buckets/mock":
+				body = `{"vBucketServerMap":{"serverList":["10.0.0.1:11210","10.0.0.2:11210","10.0.0.3:11210"],` +
+					`"vBucketMap":[[0,1,2],[0,1,2],[1,2,0],[1,2,0]]}}`
+			default:
+				return &gocbcore.HttpResponse{StatusCode: 404, Body: &testReadCloser{bytes.NewBufferString(""), nil}}, nil
+			}
+
+			return &gocbcore.HttpResponse{StatusCode: 200, Body: &testReadCloser{bytes.NewBufferString(body), nil}}, nil
+		},
+	}
+}
+
+func TestGetAnyReplicaPreferredServerGroup(t *testing.T) {
+	provider := &replicaRecordingProvider{
+		KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []byte(`{"name":"a"}`)},
+		failIdx:    -1,
+	}
+	col := testGetCollection(t, provider)
+	col.sb.getCachedClient().(*mockClient).mockHTTPProvider = testServerGroupsHTTPProvider()
+
+	// Find a key whose second replica is in zone-a, which is the first server.
+	key := testKeyInVbuckets(2, 3)
+
+	res, err := col.GetAnyReplica(key, &GetAnyReplicaOptions{PreferredServerGroup: "zone-a"})
+	if err != nil {
+		t.Fatalf("Expected GetAnyReplica to succeed but error was %v", err)
+	}
+	if res.Cas() != 1 {
+		t.Fatalf("Expected cas of 1 but was %d", res.Cas())
+	}
+	if len(provider.replicas) != 1 || provider.replicas[0] != 2 {
+		t.Fatalf("Expected a read from replica 2 but read from %v", provider.replicas)
+	}
+
+	// With no replica in the group the read goes to any replica.
+	provider.replicas = nil
+	_, err = col.GetAnyReplica(key, &GetAnyReplicaOptions{PreferredServerGroup: "zone-c"})
+	if err != nil {
+		t.Fatalf("Expected GetAnyReplica to succeed but error was %v", err)
+	}
+	if len(provider.replicas) != 1 || provider.replicas[0] != 0 {
+		t.Fatalf("Expected a read from any replica but read from %v", provider.replicas)
+	}
+}
+
+func TestGetAnyReplicaFallsBackToAnyReplica(t *testing.T) {
+	provider := &replicaRecordingProvider{
+		KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []byte(`{"name":"a"}`)},
+		failIdx:    1,
+		failStatus: gocbcore.StatusTmpFail,
+	}
+	col := testGetCollection(t, provider)
+	col.sb.getCachedClient().(*mockClient).mockHTTPProvider = testServerGroupsHTTPProvider()
+
+	// Find a key whose only replica in zone-b is the first.
+	key := testKeyInVbuckets(2, 3)
+
+	_, err := col.GetAnyReplica(key, &GetAnyReplicaOptions{PreferredServerGroup: "zone-b"})
+	if err != nil {
+		t.Fatalf("Expected GetAnyReplica to succeed but error was %v", err)
+	}
+	if len(provider.replicas) != 2 || provider.replicas[0] != 1 || provider.replicas[1] != 0 {
+		t.Fatalf("Expected a read from replica 1 then any replica but read from %v", provider.replicas)
+	}
+}
+
+func TestGetAnyReplicaCachesServerGroupsFailure(t *testing.T) {
+	provider := &replicaRecordingProvider{
+		KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []byte(`{"name":"a"}`)},
+		failIdx:    -1,
+	}
+	col := testGetCollection(t, provider)
+	var requests int
+	col.sb.getCachedClient().(*mockClient).mockHTTPProvider = &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			requests++
+			return &gocbcore.HttpResponse{StatusCode: 403, Body: &testReadCloser{bytes.NewBufferString("forbidden"), nil}}, nil
+		},
+	}
+
+	key := testKeyInVbuckets(2, 3)
+	for i := 0; i < 3; i++ {
+		_, err := col.GetAnyReplica(key, &GetAnyReplicaOptions{PreferredServerGroup: "zone-a"})
+		if err != nil {
+			t.Fatalf("Expected GetAnyReplica to succeed but error was %v", err)
+		}
+	}
+
+	if requests != 1 {
+		t.Fatalf("Expected server groups to be requested once but were requested %d times", requests)
+	}
+	if len(provider.replicas) != 3 || provider.replicas[0] != 0 {
+		t.Fatalf("Expected reads from any replica but read from %v", provider.replicas)
+	}
+}
+
+// testKeyInVbuckets returns a key which maps to one of vbIDs in a four vbucket map.
+func testKeyInVbuckets(vbIDs ...uint32) string {
+	for i := 0; ; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		for _, vbID := range vbIDs {
+			if cbCrc([]byte(key))%4 == vbID {
+				return key
+			}
+		}
+	}
+}
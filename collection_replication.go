@@ -0,0 +1,114 @@
+package gocb
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// WaitForMutationOptions are the options available to the WaitForReplication and WaitForPersistence operations.
+type WaitForMutationOptions struct {
+	ParentSpanContext opentracing.SpanContext
+	// Timeout is how long to wait for, the durability timeout of the Collection is used if it is 0.
+	Timeout time.Duration
+	Context context.Context
+}
+
+// WaitForReplication waits until the mutation in result has been replicated to at least replicas replica nodes,
+// returning ErrDurabilityTimeout if it has not been within the timeout.  It allows writes to be made without
+// durability requirements, and so quickly, with only the mutations which matter being verified afterwards.  The
+// mutation is identified by its mutation token, so the bucket must have been opened with mutation tokens enabled,
+// and it is still verified if the document has since been modified again.
+func (c *Collection) WaitForReplication(result MutationResult, replicas int, opts *WaitForMutationOptions) error {
+	if replicas < 0 {
+		return errors.Wrap(ErrInvalidArgument, "replicas cannot be negative")
+	}
+
+	return c.waitForMutation(result.MutationToken(), uint(replicas), 0, opts)
+}
+
+// WaitForPersistence waits until the mutation in result has been persisted to disk on at least nodes nodes,
+// including the active node, returning ErrDurabilityTimeout if it has not been within the timeout.  Like
+// WaitForReplication it requires mutation tokens to be enabled.
+func (c *Collection) WaitForPersistence(result MutationResult, nodes int, opts *WaitForMutationOptions) error {
+	if nodes < 0 {
+		return errors.Wrap(ErrInvalidArgument, "nodes cannot be negative")
+	}
+
+	return c.waitForMutation(result.MutationToken(), 0, uint(nodes), opts)
+}
+
+// waitForMutation observes the vbucket of mt on every node until the mutation has reached replicateTo replicas
+// and been persisted on persistTo nodes.  If opts.Context is cancelled first its error is returned.
+func (c *Collection) waitForMutation(mt MutationToken, replicateTo, persistTo uint, opts *WaitForMutationOptions) error {
+	if opts == nil {
+		opts = &WaitForMutationOptions{}
+	}
+
+	if mt.token.VbUuid == 0 && mt.token.SeqNo == 0 {
+		return errors.Wrap(ErrInvalidArgument, "the mutation has no mutation token, mutation tokens must be enabled")
+	}
+
+	span := c.startKvOpTrace(parentSpanContext(opts.Context, opts.ParentSpanContext), "WaitForMutation")
+	defer span.Finish()
+
+	parentCtx := opts.Context
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = c.sb.DuraTimeout
+	}
+	ctx, cancel := context.WithTimeout(parentCtx, timeout)
+	defer cancel()
+
+	agent, err := c.getKvProvider(ctx)
+	if err != nil {
+		return err
+	}
+
+	numReplicas := agent.NumReplicas()
+	if replicateTo > uint(numReplicas) || persistTo > uint(numReplicas+1) {
+		return ErrNotEnoughReplicas
+	}
+
+	numServers := numReplicas + 1
+	replicaCh := make(chan bool, numServers)
+	persistCh := make(chan bool, numServers)
+	for replicaIdx := 0; replicaIdx < numServers; replicaIdx++ {
+		nodeReplicaCh := replicaCh
+		if replicaIdx == 0 {
+			// The active node always has the mutation, it does not count as a replica of it.
+			nodeReplicaCh = make(chan bool, 1)
+		}
+		go c.observeOne(ctx, span.Context(), nil, mt, 0, false, replicaIdx, nodeReplicaCh, persistCh)
+	}
+
+	var results, replicated, persisted uint
+	for replicated < replicateTo || persisted < persistTo {
+		if results == uint(numReplicas+numServers) {
+			if parentCtx.Err() == context.Canceled {
+				return parentCtx.Err()
+			}
+			return ErrDurabilityTimeout
+		}
+
+		select {
+		case ok := <-replicaCh:
+			if ok {
+				replicated++
+			}
+		case ok := <-persistCh:
+			if ok {
+				persisted++
+			}
+		}
+		results++
+	}
+
+	return nil
+}
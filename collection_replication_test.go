@@ -0,0 +1,78 @@
+package gocb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// replicatingKvOperator reports the seqnos that each node, by replica index, has replicated and persisted.
+type replicatingKvOperator struct {
+	*mocktest.KvOperator
+	currentSeqNos []gocbcore.SeqNo
+	persistSeqNos []gocbcore.SeqNo
+}
+
+func (p *replicatingKvOperator) NumReplicas() int {
+	return len(p.currentSeqNos) - 1
+}
+
+func (p *replicatingKvOperator) ObserveVbEx(opts gocbcore.ObserveVbOptions, cb gocbcore.ObserveVbExCallback) (gocbcore.PendingOp, error) {
+	go cb(&gocbcore.ObserveVbResult{
+		VbId:         opts.VbId,
+		VbUuid:       opts.VbUuid,
+		CurrentSeqNo: p.currentSeqNos[opts.ReplicaIdx],
+		PersistSeqNo: p.persistSeqNos[opts.ReplicaIdx],
+	}, nil)
+
+	return &mocktest.PendingOp{CancelSuccess: true}, nil
+}
+
+func TestWaitForReplication(t *testing.T) {
+	provider := &replicatingKvOperator{
+		KvOperator: &mocktest.KvOperator{},
+		// The active node has seqno 10, the first replica has it but the second does not.
+		currentSeqNos: []gocbcore.SeqNo{10, 10, 9},
+		persistSeqNos: []gocbcore.SeqNo{10, 9, 9},
+	}
+	col := testGetCollection(t, provider)
+	col.sb.DuraPollTimeout = time.Millisecond
+
+	result := MutationResult{mt: MutationToken{token: gocbcore.MutationToken{VbId: 1, VbUuid: 2, SeqNo: 10}}}
+
+	err := col.WaitForReplication(result, 1, &WaitForMutationOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Expected wait for 1 replica to succeed but error was %v", err)
+	}
+
+	err = col.WaitForPersistence(result, 1, &WaitForMutationOptions{Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("Expected wait for persistence on 1 node to succeed but error was %v", err)
+	}
+
+	err = col.WaitForReplication(result, 2, &WaitForMutationOptions{Timeout: 50 * time.Millisecond})
+	if err != ErrDurabilityTimeout {
+		t.Fatalf("Expected wait for 2 replicas to time out but error was %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err = col.WaitForReplication(result, 2, &WaitForMutationOptions{Context: ctx, Timeout: 5 * time.Second})
+	if err != context.Canceled {
+		t.Fatalf("Expected wait for 2 replicas to be cancelled but error was %v", err)
+	}
+
+	err = col.WaitForReplication(result, 3, nil)
+	if err != ErrNotEnoughReplicas {
+		t.Fatalf("Expected wait for more replicas than exist to fail but error was %v", err)
+	}
+
+	err = col.WaitForReplication(MutationResult{}, 1, nil)
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected wait without a mutation token to fail but error was %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package gocb
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// fetchAfterMutation fetches the document written by a mutation into res, for the FetchDocumentAfterMutation
+// option.  The server cannot return the document from a mutation, even a subdocument one, so it is read
+// separately.  If the document read does not have the CAS of the mutation then another mutation was applied in
+// between, in which case ErrDocumentChangedAfterMutation is returned and res has no document.
+func (c *Collection) fetchAfterMutation(ctx context.Context, traceCtx opentracing.SpanContext, key string,
+	timeout time.Duration, res *MutationResult) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	d := c.deadline(ctx, time.Now(), timeout)
+	ctx, cancel := context.WithDeadline(ctx, d)
+	defer cancel()
+
+	doc, err := c.get(ctx, traceCtx, key, &GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if doc.Cas() != res.Cas() {
+		return errors.Wrapf(ErrDocumentChangedAfterMutation, "document cas was %d rather than %d", doc.Cas(), res.Cas())
+	}
+
+	res.document = doc
+	return nil
+}
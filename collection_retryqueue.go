@@ -0,0 +1,247 @@
+package gocb
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryQueueMaxQueued      = 1000
+	defaultRetryQueueMaxRetries     = 10
+	defaultRetryQueueInitialBackoff = 100 * time.Millisecond
+	defaultRetryQueueMaxBackoff     = 10 * time.Second
+)
+
+// RetryQueueOptions are the options available when creating a RetryQueue.
+type RetryQueueOptions struct {
+	// MaxQueued is the maximum number of mutations which can be waiting to be retried at once, defaulting
+	// to 1000.
+	MaxQueued int
+	// MaxRetries is the number of times that each mutation is retried before giving up, defaulting to 10.
+	MaxRetries uint
+	// InitialBackoff is the time waited before the first retry, defaulting to 100ms.  The wait doubles after
+	// each failed retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the longest time waited between retries, defaulting to 10s.
+	MaxBackoff time.Duration
+	// OnComplete, if set, is called once for every enqueued mutation when it succeeds, fails with an error
+	// which cannot be retried or runs out of retries.
+	OnComplete func(result RetryQueueResult)
+}
+
+// RetryQueueResult is the outcome of a mutation retried by a RetryQueue.
+type RetryQueueResult struct {
+	Key      string
+	Result   *MutationResult
+	Err      error
+	Attempts uint
+}
+
+// RetryQueue retries failed mutations in the background, backing off exponentially between attempts.  It is
+// intended for writes, such as telemetry, which must not be lost because of a temporary failure or timeout but
+// which the application does not want to wait on.  Only errors which are temporary are retried.  Mutations of the
+// same key are retried one at a time, in the order that they were enqueued, so that an older value never
+// overwrites a newer one.
+type RetryQueue struct {
+	collection     *Collection
+	maxQueued      int
+	maxRetries     uint
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	onComplete     func(result RetryQueueResult)
+
+	lock    sync.Mutex
+	queued  int
+	closed  bool
+	pending map[string][]retryQueueOp
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type retryQueueOp func() (*MutationResult, error)
+
+// NewRetryQueue creates a RetryQueue which retries mutations against this collection.
+func (c *Collection) NewRetryQueue(opts *RetryQueueOptions) *RetryQueue {
+	if opts == nil {
+		opts = &RetryQueueOptions{}
+	}
+
+	q := &RetryQueue{
+		collection:     c,
+		maxQueued:      opts.MaxQueued,
+		maxRetries:     opts.MaxRetries,
+		initialBackoff: opts.InitialBackoff,
+		maxBackoff:     opts.MaxBackoff,
+		onComplete:     opts.OnComplete,
+		pending:        make(map[string][]retryQueueOp),
+		stop:           make(chan struct{}),
+	}
+	if q.maxQueued <= 0 {
+		q.maxQueued = defaultRetryQueueMaxQueued
+	}
+	if q.maxRetries == 0 {
+		q.maxRetries = defaultRetryQueueMaxRetries
+	}
+	if q.initialBackoff <= 0 {
+		q.initialBackoff = defaultRetryQueueInitialBackoff
+	}
+	if q.maxBackoff <= 0 {
+		q.maxBackoff = defaultRetryQueueMaxBackoff
+	}
+
+	return q
+}
+
+// Upsert enqueues an upsert of val to key, typically after an Upsert has failed.  The Context in opts is not
+// used as it will usually have finished before the mutation is retried, each attempt uses its own timeout.
+func (q *RetryQueue) Upsert(key string, val interface{}, opts *UpsertOptions) error {
+	var upsertOpts UpsertOptions
+	if opts != nil {
+		upsertOpts = *opts
+	}
+	upsertOpts.Context = nil
+
+	return q.enqueue(key, func() (*MutationResult, error) {
+		return q.collection.Upsert(key, val, &upsertOpts)
+	})
+}
+
+// Remove enqueues the removal of key, typically after a Remove has failed.  As with Upsert the Context in
+// opts is not used.
+func (q *RetryQueue) Remove(key string, opts *RemoveOptions) error {
+	var removeOpts RemoveOptions
+	if opts != nil {
+		removeOpts = *opts
+	}
+	removeOpts.Context = nil
+
+	return q.enqueue(key, func() (*MutationResult, error) {
+		return q.collection.Remove(key, &removeOpts)
+	})
+}
+
+// Len returns the number of mutations waiting to be retried.
+func (q *RetryQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.queued
+}
+
+// Close stops the queue from accepting new mutations and waits for those already enqueued to complete.  If ctx is
+// done first then the mutations which have not completed are abandoned, completing with ErrRetryQueueClosed, and
+// the error of ctx is returned.
+func (q *RetryQueue) Close(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	q.lock.Lock()
+	select {
+	case <-q.stop:
+	default:
+		close(q.stop)
+	}
+	q.lock.Unlock()
+
+	<-done
+	return ctx.Err()
+}
+
+func (q *RetryQueue) enqueue(key string, op retryQueueOp) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.closed {
+		return ErrRetryQueueClosed
+	}
+	if q.queued >= q.maxQueued {
+		return ErrRetryQueueFull
+	}
+
+	q.queued++
+	ops, running := q.pending[key]
+	q.pending[key] = append(ops, op)
+	if !running {
+		q.wg.Add(1)
+		go q.retryKey(key)
+	}
+
+	return nil
+}
+
+// retryKey retries the mutations enqueued for key, in order, until there are none left.
+func (q *RetryQueue) retryKey(key string) {
+	defer q.wg.Done()
+
+	for {
+		q.lock.Lock()
+		ops := q.pending[key]
+		if len(ops) == 0 {
+			delete(q.pending, key)
+			q.lock.Unlock()
+			return
+		}
+		op := ops[0]
+		q.pending[key] = ops[1:]
+		q.lock.Unlock()
+
+		result := q.retry(key, op)
+
+		q.lock.Lock()
+		q.queued--
+		q.lock.Unlock()
+
+		if q.onComplete != nil {
+			q.onComplete(result)
+		}
+	}
+}
+
+func (q *RetryQueue) retry(key string, op retryQueueOp) RetryQueueResult {
+	result := RetryQueueResult{Key: key}
+	backoff := q.initialBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-q.stop:
+			timer.Stop()
+			result.Result, result.Err = nil, ErrRetryQueueClosed
+			return result
+		}
+
+		result.Attempts++
+		result.Result, result.Err = op()
+		if result.Err == nil || !isRetryableWriteError(result.Err) || result.Attempts >= q.maxRetries {
+			return result
+		}
+
+		backoff *= 2
+		if backoff > q.maxBackoff {
+			backoff = q.maxBackoff
+		}
+	}
+}
+
+// isRetryableWriteError returns whether a failed mutation is worth retrying later.
+func isRetryableWriteError(err error) bool {
+	return IsTempFailError(err) || IsTimeoutError(err) || IsOverloadError(err) || IsNetworkError(err) ||
+		IsRetryableError(err)
+}
@@ -0,0 +1,125 @@
+package gocb
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type flakySetProvider struct {
+	*mocktest.KvOperator
+	lock     sync.Mutex
+	failures int
+	written  []string
+}
+
+func (p *flakySetProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.failures > 0 {
+		p.failures--
+		return nil, gocbcore.ErrDispatchFail
+	}
+	p.written = append(p.written, string(opts.Value))
+	return p.KvOperator.SetEx(opts, cb)
+}
+
+func TestRetryQueue(t *testing.T) {
+	provider := &flakySetProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}, failures: 2}
+	col := testGetCollection(t, provider)
+
+	results := make(chan RetryQueueResult, 1)
+	q := col.NewRetryQueue(&RetryQueueOptions{
+		MaxQueued:      1,
+		InitialBackoff: time.Millisecond,
+		OnComplete: func(result RetryQueueResult) {
+			results <- result
+		},
+	})
+
+	err := q.Upsert("key", "value", nil)
+	if err != nil {
+		t.Fatalf("Expected Upsert to be enqueued but error was %v", err)
+	}
+
+	err = q.Upsert("other", "value", nil)
+	if err != ErrRetryQueueFull {
+		t.Fatalf("Expected queue to be full but error was %v", err)
+	}
+
+	result := <-results
+	if result.Err != nil || result.Key != "key" || result.Attempts != 3 {
+		t.Fatalf("Expected mutation to succeed on the third attempt but was %+v", result)
+	}
+
+	err = q.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected queue to close but error was %v", err)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("Expected queue to be empty but had %d", q.Len())
+	}
+
+	err = q.Upsert("key", "value", nil)
+	if err != ErrRetryQueueClosed {
+		t.Fatalf("Expected queue to be closed but error was %v", err)
+	}
+}
+
+func TestRetryQueueOrdersMutationsOfAKey(t *testing.T) {
+	provider := &flakySetProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}, failures: 3}
+	col := testGetCollection(t, provider)
+
+	q := col.NewRetryQueue(&RetryQueueOptions{InitialBackoff: time.Millisecond})
+	for _, val := range []string{"1", "2", "3"} {
+		err := q.Upsert("key", val, nil)
+		if err != nil {
+			t.Fatalf("Expected Upsert to be enqueued but error was %v", err)
+		}
+	}
+
+	err := q.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected queue to close but error was %v", err)
+	}
+
+	if strings.Join(provider.written, ",") != "1,2,3" {
+		t.Fatalf("Expected values to be written in the order they were enqueued but was %v", provider.written)
+	}
+}
+
+func TestRetryQueueCloseAbandonsMutations(t *testing.T) {
+	provider := &flakySetProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}, failures: 100}
+	col := testGetCollection(t, provider)
+
+	results := make(chan RetryQueueResult, 1)
+	q := col.NewRetryQueue(&RetryQueueOptions{
+		InitialBackoff: time.Hour,
+		OnComplete: func(result RetryQueueResult) {
+			results <- result
+		},
+	})
+
+	err := q.Upsert("key", "value", nil)
+	if err != nil {
+		t.Fatalf("Expected Upsert to be enqueued but error was %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = q.Close(ctx)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected close to give up at the deadline but error was %v", err)
+	}
+
+	result := <-results
+	if result.Err != ErrRetryQueueClosed || result.Attempts != 0 {
+		t.Fatalf("Expected mutation to be abandoned but was %+v", result)
+	}
+}
@@ -0,0 +1,178 @@
+package driver
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/couchbase/gocb"
+	"github.com/pkg/errors"
+)
+
+var (
+	_ driver.QueryerContext     = &conn{}
+	_ driver.ExecerContext      = &conn{}
+	_ driver.ConnPrepareContext = &conn{}
+	_ driver.NamedValueChecker  = &conn{}
+	_ driver.StmtQueryContext   = &stmt{}
+	_ driver.StmtExecContext    = &stmt{}
+)
+
+// conn is a connection, N1QL queries are stateless HTTP requests so connections share the queryer.
+type conn struct {
+	queryer gocb.QueryerInterface
+	// close, if set, closes the cluster which the connection was opened with, see Driver.Open.
+	close func() error
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+// PrepareContext returns a statement which is executed as a prepared N1QL statement.  The statement is prepared
+// by the query service when it is first executed, and the plan is then reused from the plan cache.
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	if c.close == nil {
+		return nil
+	}
+	return c.close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, ErrTransactionsNotSupported
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.query(ctx, query, args, false)
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.exec(ctx, query, args, false)
+}
+
+// CheckNamedValue accepts any argument, they are sent to the query service as JSON.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if valuer, ok := nv.Value.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		nv.Value = value
+	}
+	return nil
+}
+
+func (c *conn) query(ctx context.Context, query string, args []driver.NamedValue, prepared bool) (driver.Rows, error) {
+	opts, err := queryOptions(ctx, args, prepared)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.queryer.Query(query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRows(res)
+}
+
+func (c *conn) exec(ctx context.Context, query string, args []driver.NamedValue, prepared bool) (driver.Result, error) {
+	opts, err := queryOptions(ctx, args, prepared)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.queryer.Query(query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	err = res.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return result{rowsAffected: int64(res.Metrics().MutationCount)}, nil
+}
+
+// queryOptions returns the options for a query with args, which must either all be named or all be positional.
+func queryOptions(ctx context.Context, args []driver.NamedValue, prepared bool) (*gocb.QueryOptions, error) {
+	opts := &gocb.QueryOptions{
+		Context:  ctx,
+		Prepared: prepared,
+	}
+
+	for _, arg := range args {
+		if arg.Name != "" {
+			if opts.PositionalParameters != nil {
+				return nil, errors.New("named and positional arguments cannot be used together")
+			}
+			if opts.NamedParameters == nil {
+				opts.NamedParameters = make(map[string]interface{}, len(args))
+			}
+			opts.NamedParameters[arg.Name] = arg.Value
+			continue
+		}
+
+		if opts.NamedParameters != nil {
+			return nil, errors.New("named and positional arguments cannot be used together")
+		}
+		opts.PositionalParameters = append(opts.PositionalParameters, arg.Value)
+	}
+
+	return opts, nil
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+// NumInput returns -1 as the number of parameters is only known to the query service.
+func (s *stmt) NumInput() int {
+	return -1
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.exec(ctx, s.query, args, true)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.query(ctx, s.query, args, true)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type result struct {
+	rowsAffected int64
+}
+
+// LastInsertId returns an error as documents do not have generated ids.
+func (r result) LastInsertId() (int64, error) {
+	return 0, errors.New("LastInsertId is not supported by the n1ql driver")
+}
+
+func (r result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
@@ -0,0 +1,141 @@
+// Package driver is a database/sql driver which runs N1QL queries through gocb, allowing ORMs and code written
+// against database/sql to query Couchbase.
+//
+// The driver is registered as "n1ql" and is opened with a connection string which may include the username
+// and password as parameters:
+//
+//	db, err := sql.Open("n1ql", "couchbase://localhost?username=Administrator&password=password")
+//
+// An existing gocb.Cluster can be used with sql.OpenDB(driver.NewConnector(cluster)).
+//
+// Query parameters are passed to N1QL as positional parameters ($1, $2...) or, when sql.Named is used, as named
+// parameters ($name).  Statements prepared with database/sql are executed as prepared N1QL statements, sharing the
+// plan cache of the cluster.  Transactions are not supported.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net/url"
+	"strings"
+
+	"github.com/couchbase/gocb"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	sql.Register("n1ql", &Driver{})
+}
+
+// ErrTransactionsNotSupported is returned when a transaction is started.
+var ErrTransactionsNotSupported = errors.New("transactions are not supported by the n1ql driver")
+
+// Driver is the database/sql driver for N1QL.
+type Driver struct{}
+
+// Open returns a new connection to the cluster identified by dsn, which is closed along with the connection.
+// Each call connects to the cluster again, so sql.DB uses OpenConnector instead to share the connection to the
+// cluster.
+func (d *Driver) Open(dsn string) (driver.Conn, error) {
+	connector, err := d.openConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return connector.connectOwned(), nil
+}
+
+// OpenConnector connects to the cluster identified by dsn, a connection string which may include the username
+// and password parameters.  All of the connections from the connector share the connection to the cluster.
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	return d.openConnector(dsn)
+}
+
+func (d *Driver) openConnector(dsn string) (*connector, error) {
+	connStr, username, password, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := gocb.ClusterOptions{}
+	if username != "" {
+		opts.Authenticator = gocb.PasswordAuthenticator{
+			Username: username,
+			Password: password,
+		}
+	}
+
+	cluster, err := gocb.NewCluster(connStr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &connector{
+		queryer: cluster,
+		driver:  d,
+		close: func() error {
+			return cluster.Close(nil)
+		},
+	}, nil
+}
+
+// parseDSN removes the username and password parameters from dsn, returning them separately.
+func parseDSN(dsn string) (string, string, string, error) {
+	paramsIdx := strings.Index(dsn, "?")
+	if paramsIdx < 0 {
+		return dsn, "", "", nil
+	}
+
+	params, err := url.ParseQuery(dsn[paramsIdx+1:])
+	if err != nil {
+		return "", "", "", err
+	}
+
+	username := params.Get("username")
+	password := params.Get("password")
+	params.Del("username")
+	params.Del("password")
+
+	connStr := dsn[:paramsIdx]
+	if len(params) > 0 {
+		connStr += "?" + params.Encode()
+	}
+
+	return connStr, username, password, nil
+}
+
+// NewConnector returns a connector which runs queries using queryer, typically a gocb.Cluster, so that it can
+// be used with sql.OpenDB.  The queryer is not closed when the sql.DB is closed.
+func NewConnector(queryer gocb.QueryerInterface) driver.Connector {
+	return &connector{
+		queryer: queryer,
+		driver:  &Driver{},
+	}
+}
+
+type connector struct {
+	queryer gocb.QueryerInterface
+	driver  *Driver
+	close   func() error
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return &conn{queryer: c.queryer}, nil
+}
+
+// connectOwned returns a connection which closes the connector, and so the cluster, when it is closed.
+func (c *connector) connectOwned() *conn {
+	return &conn{queryer: c.queryer, close: c.Close}
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+// Close closes the cluster opened by the connector, it is called by sql.DB.Close.
+func (c *connector) Close() error {
+	if c.close == nil {
+		return nil
+	}
+	return c.close()
+}
@@ -0,0 +1,254 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/couchbase/gocb"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type testHTTPProvider struct {
+	resp     string
+	requests []map[string]interface{}
+}
+
+func (p *testHTTPProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	var body map[string]interface{}
+	err := json.Unmarshal(req.Body, &body)
+	if err != nil {
+		return nil, err
+	}
+	p.requests = append(p.requests, body)
+
+	resp := p.resp
+	if statement, ok := body["statement"].(string); ok && strings.HasPrefix(statement, "PREPARE ") {
+		resp = `{"requestID":"r","results":[{"name":"p1","encoded_plan":"plan"}],"status":"success"}`
+	}
+
+	return &gocbcore.HttpResponse{
+		Endpoint:   req.Endpoint,
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(resp)),
+	}, nil
+}
+
+func testOpenDB(t *testing.T, results string) (*sql.DB, *testHTTPProvider) {
+	provider := &testHTTPProvider{
+		resp: `{"requestID":"r","results":` + results + `,"status":"success",` +
+			`"metrics":{"elapsedTime":"1ms","executionTime":"1ms","resultCount":1,"resultSize":10,"mutationCount":3}}`,
+	}
+	cluster, err := gocb.NewMockCluster(nil, provider, gocb.ClusterOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create mock cluster: %v", err)
+	}
+
+	return sql.OpenDB(NewConnector(cluster)), provider
+}
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn      string
+		connStr  string
+		username string
+		password string
+	}{
+		{"couchbase://localhost", "couchbase://localhost", "", ""},
+		{"couchbase://localhost?username=user&password=pass", "couchbase://localhost", "user", "pass"},
+		{"couchbase://localhost?username=user&network=external", "couchbase://localhost?network=external", "user", ""},
+	}
+
+	for _, test := range tests {
+		connStr, username, password, err := parseDSN(test.dsn)
+		if err != nil {
+			t.Fatalf("Expected %s to parse but error was %v", test.dsn, err)
+		}
+		if connStr != test.connStr || username != test.username || password != test.password {
+			t.Fatalf("Expected %s to parse to %s, %s, %s but was %s, %s, %s", test.dsn, test.connStr,
+				test.username, test.password, connStr, username, password)
+		}
+	}
+
+	_, _, _, err := parseDSN("couchbase://localhost?username=%zz")
+	if err == nil {
+		t.Fatalf("Expected invalid parameters to fail")
+	}
+}
+
+func TestQueryRows(t *testing.T) {
+	db, provider := testOpenDB(t, `[{"name":"Alice","age":30,"score":1.5,"tags":["a"],"ok":true,"gone":null}]`)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT * FROM users WHERE name = $1", "Alice")
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		t.Fatalf("Expected columns but error was %v", err)
+	}
+	if strings.Join(columns, ",") != "name,age,score,tags,ok,gone" {
+		t.Fatalf("Expected columns to be in field order but were %v", columns)
+	}
+
+	if !rows.Next() {
+		t.Fatalf("Expected a row but error was %v", rows.Err())
+	}
+	values := make([]interface{}, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	err = rows.Scan(dest...)
+	if err != nil {
+		t.Fatalf("Expected row to scan but error was %v", err)
+	}
+
+	if values[0] != "Alice" || values[1] != int64(30) || values[2] != 1.5 || string(values[3].([]byte)) != `["a"]` ||
+		values[4] != true || values[5] != nil {
+		t.Fatalf("Unexpected values %v", values)
+	}
+
+	if rows.Next() {
+		t.Fatalf("Expected only one row")
+	}
+	if rows.Err() != nil {
+		t.Fatalf("Expected no error but was %v", rows.Err())
+	}
+
+	args, ok := provider.requests[0]["args"].([]interface{})
+	if !ok || len(args) != 1 || args[0] != "Alice" {
+		t.Fatalf("Expected positional args to be sent but request was %v", provider.requests[0])
+	}
+}
+
+func TestQueryRawRows(t *testing.T) {
+	db, provider := testOpenDB(t, `["Alice","Bob"]`)
+	defer db.Close()
+
+	rows, err := db.Query("SELECT RAW name FROM users WHERE age > $age", sql.Named("age", 20))
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			t.Fatalf("Expected row to scan but error was %v", err)
+		}
+		names = append(names, name)
+	}
+	if strings.Join(names, ",") != "Alice,Bob" {
+		t.Fatalf("Expected raw rows but had %v", names)
+	}
+
+	if provider.requests[0]["$age"] != float64(20) {
+		t.Fatalf("Expected named args to be sent but request was %v", provider.requests[0])
+	}
+}
+
+func TestPreparedStatement(t *testing.T) {
+	db, provider := testOpenDB(t, `["Alice"]`)
+	defer db.Close()
+
+	stmt, err := db.Prepare("SELECT RAW name FROM users WHERE age > $1")
+	if err != nil {
+		t.Fatalf("Expected prepare to succeed but error was %v", err)
+	}
+	defer stmt.Close()
+
+	for i := 0; i < 2; i++ {
+		var name string
+		err = stmt.QueryRow(20).Scan(&name)
+		if err != nil {
+			t.Fatalf("Expected prepared query to succeed but error was %v", err)
+		}
+		if name != "Alice" {
+			t.Fatalf("Expected Alice but had %s", name)
+		}
+	}
+
+	if len(provider.requests) != 3 {
+		t.Fatalf("Expected the statement to be prepared once and executed twice but had %v", provider.requests)
+	}
+	if provider.requests[0]["statement"] != "PREPARE SELECT RAW name FROM users WHERE age > $1" {
+		t.Fatalf("Expected the statement to be prepared but request was %v", provider.requests[0])
+	}
+	for _, req := range provider.requests[1:] {
+		if req["prepared"] != "p1" || req["encoded_plan"] != "plan" {
+			t.Fatalf("Expected the prepared plan to be executed but request was %v", req)
+		}
+		args, ok := req["args"].([]interface{})
+		if !ok || len(args) != 1 || args[0] != float64(20) {
+			t.Fatalf("Expected positional args to be sent but request was %v", req)
+		}
+	}
+}
+
+func TestExec(t *testing.T) {
+	db, _ := testOpenDB(t, `[]`)
+	defer db.Close()
+
+	res, err := db.Exec("DELETE FROM users WHERE age > $1", 20)
+	if err != nil {
+		t.Fatalf("Expected exec to succeed but error was %v", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected != 3 {
+		t.Fatalf("Expected 3 rows affected but was %d, %v", affected, err)
+	}
+
+	_, err = res.LastInsertId()
+	if err == nil {
+		t.Fatalf("Expected LastInsertId to fail")
+	}
+
+	_, err = db.Begin()
+	if err != ErrTransactionsNotSupported {
+		t.Fatalf("Expected transactions to fail but error was %v", err)
+	}
+}
+
+func TestMixedArgs(t *testing.T) {
+	db, _ := testOpenDB(t, `[]`)
+	defer db.Close()
+
+	_, err := db.Exec("SELECT $1, $name", 1, sql.Named("name", "x"))
+	if err == nil {
+		t.Fatalf("Expected named and positional args together to fail")
+	}
+}
+
+func TestOwnedConnClosesConnector(t *testing.T) {
+	closed := 0
+	c := &connector{
+		close: func() error {
+			closed++
+			return nil
+		},
+	}
+
+	conn, err := c.Connect(context.Background())
+	if err != nil {
+		t.Fatalf("Expected connect to succeed but error was %v", err)
+	}
+	conn.Close()
+	if closed != 0 {
+		t.Fatalf("Expected connections from Connect not to close the connector")
+	}
+
+	c.connectOwned().Close()
+	if closed != 1 {
+		t.Fatalf("Expected owned connection to close the connector, closed %d times", closed)
+	}
+}
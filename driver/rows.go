@@ -0,0 +1,154 @@
+package driver
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+
+	"github.com/couchbase/gocb"
+	"github.com/couchbase/gocb/internal/jsonkeys"
+	"github.com/pkg/errors"
+)
+
+// rows reads the rows of a query as columns.  The columns are the selected fields, in order as for
+// gocb.QueryResults.Columns, taken from the signature of the query or, when it does not list them, from the
+// fields of the first row.  Rows which are not objects, such as those of SELECT RAW queries, have a single column
+// named "value".
+type rows struct {
+	res     *gocb.QueryResults
+	columns []string
+	// next is the first row, which is read early when it is needed for the columns.
+	next []byte
+}
+
+func newRows(res *gocb.QueryResults) (*rows, error) {
+	r := &rows{
+		res:     res,
+		columns: res.Columns(),
+	}
+	if r.columns != nil {
+		return r, nil
+	}
+
+	r.next = res.NextBytes()
+	if r.next == nil {
+		return r, nil
+	}
+
+	row := bytes.TrimSpace(r.next)
+	if len(row) == 0 || row[0] != '{' {
+		r.columns = []string{"value"}
+		return r, nil
+	}
+
+	columns, err := jsonkeys.ObjectKeys(row)
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+	r.columns = columns
+
+	return r, nil
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return r.res.Close()
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	row := r.next
+	if row != nil {
+		r.next = nil
+	} else {
+		row = r.res.NextBytes()
+	}
+	if row == nil {
+		err := r.res.Err()
+		if err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	row = bytes.TrimSpace(row)
+	if len(row) == 0 || row[0] != '{' {
+		if len(dest) != 1 {
+			return errors.Errorf("row has 1 column but %d were expected", len(dest))
+		}
+		return convertValue(row, &dest[0])
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(row, &fields)
+	if err != nil {
+		return err
+	}
+
+	for i, column := range r.columns {
+		value, ok := fields[column]
+		if !ok {
+			dest[i] = nil
+			continue
+		}
+
+		err = convertValue(value, &dest[i])
+		if err != nil {
+			return errors.Wrapf(err, "failed to convert column %s", column)
+		}
+	}
+
+	return nil
+}
+
+// convertValue converts a JSON value into a driver value.  Integers become int64 and other numbers float64,
+// objects and arrays are left as JSON in a []byte.
+func convertValue(raw []byte, dest *driver.Value) error {
+	if len(raw) == 0 {
+		*dest = nil
+		return nil
+	}
+
+	switch raw[0] {
+	case '{', '[':
+		*dest = append([]byte(nil), raw...)
+		return nil
+	case '"':
+		var value string
+		err := json.Unmarshal(raw, &value)
+		*dest = value
+		return err
+	case 't', 'f':
+		var value bool
+		err := json.Unmarshal(raw, &value)
+		*dest = value
+		return err
+	case 'n':
+		*dest = nil
+		return nil
+	}
+
+	var number json.Number
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	err := dec.Decode(&number)
+	if err != nil {
+		return err
+	}
+
+	if value, err := number.Int64(); err == nil {
+		*dest = value
+		return nil
+	}
+
+	value, err := number.Float64()
+	if err != nil {
+		return err
+	}
+	*dest = value
+	return nil
+}
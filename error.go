@@ -2,15 +2,22 @@ package gocb
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"gopkg.in/couchbase/gocbcore.v7"
 
 	"github.com/pkg/errors"
 )
 
-type retryAbleError interface {
-	retryable() bool
+// RetryableError is implemented by the errors returned from failed KV, query, analytics, search, view and
+// management requests.  Retryable reports whether the same request may succeed if it is retried, for example
+// because the server was temporarily busy.  Errors for which the outcome of the request is unknown, such as
+// timeouts, are not retryable as retrying a non-idempotent request could apply it twice.
+type RetryableError interface {
+	error
+	Retryable() bool
 }
 
 // KeyValueError represents an error that occurred while
@@ -65,6 +72,16 @@ func (err kvError) KVError() bool {
 	return true
 }
 
+// Retryable returns whether the operation failed due to a temporary condition on the server.
+func (err kvError) Retryable() bool {
+	switch err.status {
+	case gocbcore.StatusTmpFail, gocbcore.StatusBusy, gocbcore.StatusOutOfMemory, gocbcore.StatusLocked:
+		return true
+	default:
+		return false
+	}
+}
+
 // IsScopeUnknownError verifies whether or not the cause for an error is scope unknown
 func IsScopeUnknownError(err error) bool {
 	cause := errors.Cause(err)
@@ -196,6 +213,17 @@ func IsServiceNotFoundError(err error) bool {
 	return false
 }
 
+// IsOverloadError verifies whether or not the cause for an error is that the client's operation queues were full,
+// in which case the operation was never sent.
+func IsOverloadError(err error) bool {
+	switch errType := errors.Cause(err).(type) {
+	case interface{ Overload() bool }:
+		return errType.Overload()
+	default:
+		return false
+	}
+}
+
 // IsTimeoutError verifies whether or not the cause for an error is a timeout.
 func IsTimeoutError(err error) bool {
 	switch errType := errors.Cause(err).(type) {
@@ -232,6 +260,151 @@ func (err timeoutError) Timeout() bool {
 	return true
 }
 
+// Retryable always returns false as the outcome of an operation which timed out is unknown.
+func (err timeoutError) Retryable() bool {
+	return false
+}
+
+// QueryTimeoutError occurs when a N1QL query times out, it provides details to help diagnose why.
+type QueryTimeoutError interface {
+	TimeoutError
+	// Elapsed is the time spent on the query, including any retries, before it timed out.
+	Elapsed() time.Duration
+	// Attempts is the number of times that the query was sent.
+	Attempts() uint
+	// LastEndpoint is the query node which was last sent the query, it is empty if no query node responded.
+	LastEndpoint() string
+	// ClientContextID is the client context id sent with the query, it can be used to find the query in server logs.
+	ClientContextID() string
+}
+
+type queryTimeoutError struct {
+	elapsed         time.Duration
+	attempts        uint
+	lastEndpoint    string
+	clientContextID string
+}
+
+func (err queryTimeoutError) Error() string {
+	endpoint := err.lastEndpoint
+	if endpoint == "" {
+		endpoint = "none"
+	}
+
+	return fmt.Sprintf("query timed out after %s (attempts: %d, last endpoint: %s, client context id: %s)",
+		err.elapsed, err.attempts, endpoint, err.clientContextID)
+}
+
+func (err queryTimeoutError) Timeout() bool {
+	return true
+}
+
+func (err queryTimeoutError) Elapsed() time.Duration {
+	return err.elapsed
+}
+
+func (err queryTimeoutError) Attempts() uint {
+	return err.attempts
+}
+
+func (err queryTimeoutError) LastEndpoint() string {
+	return err.lastEndpoint
+}
+
+func (err queryTimeoutError) ClientContextID() string {
+	return err.clientContextID
+}
+
+// Retryable always returns false as the outcome of a query which timed out is unknown.
+func (err queryTimeoutError) Retryable() bool {
+	return false
+}
+
+// QueryDecodeError occurs when a row of query results cannot be decoded with QueryOptions.StrictDecoding enabled,
+// it identifies the field which could not be decoded and the type that it was expected to be.
+type QueryDecodeError interface {
+	error
+	// Row is the index of the row which could not be decoded, the first row is 0.
+	Row() int
+	// Field is the path of the field which could not be decoded, it is empty if the row as a whole could not be.
+	Field() string
+	// Expected is the type the field was expected to be, either from the query signature or the Go type that it
+	// was being decoded into.
+	Expected() string
+	// Actual is the JSON type of the value which could not be decoded.
+	Actual() string
+}
+
+type queryDecodeError struct {
+	row      int
+	field    string
+	expected string
+	actual   string
+	cause    error
+}
+
+func (err queryDecodeError) Error() string {
+	msg := fmt.Sprintf("failed to decode query row %d", err.row)
+	if err.field != "" {
+		msg += fmt.Sprintf(": field %q", err.field)
+	}
+	if err.expected != "" {
+		msg += fmt.Sprintf(": expected %s but got %s", err.expected, err.actual)
+	}
+	if err.cause != nil {
+		msg += ": " + err.cause.Error()
+	}
+	return msg
+}
+
+func (err queryDecodeError) Row() int {
+	return err.row
+}
+
+func (err queryDecodeError) Field() string {
+	return err.field
+}
+
+func (err queryDecodeError) Expected() string {
+	return err.expected
+}
+
+func (err queryDecodeError) Actual() string {
+	return err.actual
+}
+
+// NotReadyError occurs when WaitUntilReady times out before the services it was waiting for were ready, it
+// describes which of them were and were not ready.
+type NotReadyError interface {
+	error
+	Services() []ServiceReadiness
+}
+
+type notReadyError struct {
+	services []ServiceReadiness
+	cause    error
+}
+
+func (err notReadyError) Error() string {
+	msg := "services not ready"
+	if err.cause != nil {
+		msg += " (" + err.cause.Error() + ")"
+	}
+	for i, service := range err.services {
+		if i == 0 {
+			msg += ": "
+		} else {
+			msg += ", "
+		}
+		msg += service.String()
+	}
+	return msg
+}
+
+func (err notReadyError) Services() []ServiceReadiness {
+	return err.services
+}
+
 type PartialResultError interface {
 	PartialResults() bool
 }
@@ -243,24 +416,40 @@ type ServiceNotFoundError interface {
 	ServiceNotFoundError() bool
 }
 
+// serviceNotFoundError occurs when the requested service is not running on the node requested or, when service
+// is set, on any node in the cluster.
 type serviceNotFoundError struct {
+	service string
 }
 
 func (e serviceNotFoundError) Error() string {
+	if e.service != "" {
+		return fmt.Sprintf("the %s service is not enabled on any node in the cluster", e.service)
+	}
 	return fmt.Sprintf("the service requested is not enabled or cannot be found on the node requested")
 }
 
+// StatusCode always returns 0, the request was never sent as there was no node to send it to.
+func (e serviceNotFoundError) StatusCode() int {
+	return 0
+}
+
 // ServiceNotFoundError returns whether or not the error is a service not found error.
 func (e serviceNotFoundError) ServiceNotFoundError() bool {
 	return true
 }
 
+// Retryable always returns false, the service will not become available by retrying.
+func (e serviceNotFoundError) Retryable() bool {
+	return false
+}
+
 // NetworkError occurs when there is a network error.
 type NetworkError interface {
 	error
 	StatusCode() int
 	NetworkError() bool
-	retryable() bool
+	Retryable() bool
 }
 
 type networkError struct {
@@ -290,8 +479,10 @@ func (e networkError) NetworkError() bool {
 	return true
 }
 
-func (e networkError) retryable() bool {
-	return e.isRetryable
+// Retryable returns whether the request failed in a way which is known to be temporary, including being
+// rate limited or the service being temporarily unavailable.
+func (e networkError) Retryable() bool {
+	return e.isRetryable || e.statusCode == 429 || e.statusCode == 503
 }
 
 // ViewQueryError is the error type for an error that occurs during view query execution.
@@ -320,6 +511,11 @@ func (e *viewError) Message() string {
 	return e.ErrorMessage
 }
 
+// Retryable always returns false, view errors are returned for requests which cannot succeed as given.
+func (e *viewError) Retryable() bool {
+	return false
+}
+
 type ViewQueryErrors interface {
 	error
 	Errors() []ViewQueryError
@@ -359,6 +555,11 @@ func (e viewMultiError) PartialResults() bool {
 	return e.partial
 }
 
+// Retryable returns whether the view engine reported that it was temporarily unable to service the request.
+func (e viewMultiError) Retryable() bool {
+	return e.httpStatus == 429 || e.httpStatus == 503
+}
+
 type AnalyticsQueryError interface {
 	error
 	Code() uint32
@@ -382,7 +583,8 @@ func (e analyticsQueryError) Message() string {
 	return e.ErrorMessage
 }
 
-func (e analyticsQueryError) retryable() bool {
+// Retryable returns whether the error code indicates a temporary failure.
+func (e analyticsQueryError) Retryable() bool {
 	if e.Code() != 21002 && e.Code() != 23000 && e.Code() != 23003 && e.Code() != 23007 {
 		return true
 	}
@@ -405,9 +607,10 @@ type analyticsQueryMultiError struct {
 	contextID  string
 }
 
-func (e analyticsQueryMultiError) retryable() bool {
+// Retryable returns whether any of the errors is retryable.
+func (e analyticsQueryMultiError) Retryable() bool {
 	for _, aErr := range e.errors {
-		if isRetryableError(aErr) {
+		if IsRetryableError(aErr) {
 			return true
 		}
 	}
@@ -462,7 +665,12 @@ func (e queryError) Message() string {
 	return e.ErrorMessage
 }
 
-func (e queryError) retryable() bool {
+// Retryable returns whether the error code indicates a temporary failure, such as a stale prepared statement.
+// Internal errors reporting that an index already exists or does not exist are not temporary.
+func (e queryError) Retryable() bool {
+	if e.ErrorCode == 5000 && (isIndexExistsQueryError(e) || isIndexNotFoundQueryError(e)) {
+		return false
+	}
 	if e.ErrorCode == 4050 || e.ErrorCode == 4070 || e.ErrorCode == 5000 {
 		return true
 	}
@@ -470,6 +678,64 @@ func (e queryError) retryable() bool {
 	return false
 }
 
+// isIndexExistsQueryError returns whether the query service reported that an index already exists, either with
+// the dedicated code or, for GSI indexes, as an internal error.
+func isIndexExistsQueryError(err QueryError) bool {
+	if err.Code() == 4300 {
+		return true
+	}
+	return err.Code() == 5000 && strings.Contains(strings.ToLower(err.Message()), "already exist")
+}
+
+// indexNotFoundMessage matches the message of the internal error which GSI reports for an index which does not
+// exist, such as "GSI index beers not found.".
+var indexNotFoundMessage = regexp.MustCompile(`(?i)\bindex \S+ not found\b`)
+
+// isIndexNotFoundQueryError returns whether the query service reported that an index does not exist, either
+// with one of the dedicated codes or, for GSI indexes, as an internal error.  Other internal errors which report
+// something as not found, such as a document fetched by a query, are not index not found errors.
+func isIndexNotFoundQueryError(err QueryError) bool {
+	if err.Code() == 12004 || err.Code() == 12016 {
+		return true
+	}
+	return err.Code() == 5000 && indexNotFoundMessage.MatchString(err.Message())
+}
+
+// isPreparedNotFoundQueryError returns whether the query service reported that a prepared statement does not
+// exist, such as when executing a statement by a name that no instance has prepared it with yet.
+func isPreparedNotFoundQueryError(err QueryError) bool {
+	return err.Code() == 4040
+}
+
+// isQueryErrorMatching returns whether err is, or contains, a query error for which match returns true.
+func isQueryErrorMatching(err error, match func(QueryError) bool) bool {
+	switch qErr := errors.Cause(err).(type) {
+	case QueryErrors:
+		for _, e := range qErr.Errors() {
+			if match(e) {
+				return true
+			}
+		}
+	case QueryError:
+		return match(qErr)
+	}
+
+	return false
+}
+
+// isServerQueryTimeout returns whether the query service reported that the query timed out.
+func isServerQueryTimeout(err error) bool {
+	if qErrs, ok := errors.Cause(err).(QueryErrors); ok {
+		for _, qErr := range qErrs.Errors() {
+			if qErr.Code() == 1080 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 type QueryErrors interface {
 	error
 	Errors() []QueryError
@@ -485,9 +751,10 @@ type queryMultiError struct {
 	contextID  string
 }
 
-func (e queryMultiError) retryable() bool {
+// Retryable returns whether any of the errors is retryable.
+func (e queryMultiError) Retryable() bool {
 	for _, n1qlErr := range e.errors {
-		if isRetryableError(n1qlErr) {
+		if IsRetryableError(n1qlErr) {
 			return true
 		}
 	}
@@ -536,6 +803,11 @@ func (e searchError) Message() string {
 	return e.message
 }
 
+// Retryable always returns false, search errors carry no information about whether they are temporary.
+func (e searchError) Retryable() bool {
+	return false
+}
+
 type SearchErrors interface {
 	error
 	Errors() []SearchError
@@ -581,15 +853,28 @@ func (e searchMultiError) PartialResults() bool {
 	return e.partial
 }
 
+// Retryable returns whether the search service reported that it was temporarily unable to service the request.
+func (e searchMultiError) Retryable() bool {
+	return e.httpStatus == 429 || e.httpStatus == 503
+}
+
 // ErrorCause returns the underlying cause of an error.
 func ErrorCause(err error) error {
 	return errors.Cause(err)
 }
 
-func isRetryableError(err error) bool {
-	switch errType := errors.Cause(err).(type) {
-	case retryAbleError:
-		return errType.retryable()
+// IsRetryableError indicates whether the passed error is temporary, such that retrying the request which
+// caused it may succeed.
+func IsRetryableError(err error) bool {
+	cause := errors.Cause(err)
+	if cause == gocbcore.ErrOverload || cause == gocbcore.ErrDispatchFail {
+		// These are returned before the request has been sent, so it is always safe to retry.
+		return true
+	}
+
+	switch errType := cause.(type) {
+	case RetryableError:
+		return errType.Retryable()
 	default:
 		return false
 	}
@@ -620,6 +905,29 @@ func maybeEnhanceErr(err error, key string) error {
 	return err
 }
 
+// serviceUnavailableError returns a ServiceNotFoundError naming the service if err means that no node in the
+// cluster is running it.  Otherwise it returns nil.
+func serviceUnavailableError(service string, err error) error {
+	if errIsGocbcoreInvalidService(errors.Cause(err)) {
+		return serviceNotFoundError{service: service}
+	}
+
+	return nil
+}
+
+// serviceAuthError returns ErrAuthenticationFailure, naming the service, if the HTTP status code means that the
+// user could not access it.  Otherwise it returns nil.
+func serviceAuthError(service string, statusCode int) error {
+	switch statusCode {
+	case 401:
+		return errors.Wrapf(ErrAuthenticationFailure, "%s service rejected the credentials", service)
+	case 403:
+		return errors.Wrapf(ErrAuthenticationFailure, "user has no role granting access to the %s service", service)
+	default:
+		return nil
+	}
+}
+
 func errIsGocbcoreInvalidService(err error) bool {
 	return err == gocbcore.ErrNoCapiService ||
 		err == gocbcore.ErrNoCbasService ||
@@ -646,6 +954,63 @@ var (
 	ErrIndexAlreadyExists = errors.New("The index specified already exists.")
 	// ErrFacetNoRanges occurs when a range-based facet is specified but no ranges were indicated.
 	ErrFacetNoRanges = errors.New("At least one range must be specified on a facet.")
+	// ErrResultTooLarge occurs when a query returns more rows than the MaxBufferedRows specified.
+	ErrResultTooLarge = errors.New("The query returned more rows than the maximum specified.")
+
+	// ErrValueTooLarge occurs when an operation would make a document larger than the maximum size specified.
+	ErrValueTooLarge = errors.New("The operation would make the document larger than the maximum size specified.")
+
+	// ErrAccessDeletedNotSupported occurs when a lookup of a deleted document is attempted against a server which
+	// does not support accessing deleted documents.
+	ErrAccessDeletedNotSupported = errors.New("The server does not support accessing deleted documents.")
+
+	// ErrGetMetaNotSupported occurs when GetMeta is used on a Collection other than the default collection, which
+	// the server does not support.
+	ErrGetMetaNotSupported = errors.New("The server does not support fetching metadata outside of the default collection.")
+
+	// ErrInvalidArgument occurs when an invalid argument, such as a malformed document key, is given.
+	ErrInvalidArgument = errors.New("An invalid argument was specified.")
+
+	// ErrReadOnly occurs when a mutation is attempted through a read-only Collection.
+	ErrReadOnly = errors.New("The collection is read-only.")
+
+	// ErrSearchFieldNotFound occurs when a field is requested from a search hit which does not contain it.
+	ErrSearchFieldNotFound = errors.New("The search hit does not contain the requested field.")
+
+	// ErrRetryQueueFull occurs when a mutation is enqueued on a RetryQueue which already holds its maximum.
+	ErrRetryQueueFull = errors.New("The retry queue is full.")
+
+	// ErrRetryQueueClosed occurs when a mutation is enqueued on a RetryQueue which has been closed, or when an
+	// enqueued mutation is abandoned because the queue was closed before it completed.
+	ErrRetryQueueClosed = errors.New("The retry queue is closed.")
+
+	// ErrInvalidValue occurs when a value which is to be written as JSON is not valid UTF-8 JSON.
+	ErrInvalidValue = errors.New("The value is not valid JSON.")
+
+	// ErrExportColumnsChanged occurs when query results are exported as CSV and a row has a field which is not
+	// a column of the export.
+	ErrExportColumnsChanged = errors.New("The row has a field which is not a column of the export.")
+
+	// ErrDocumentSizeUnavailable occurs when the size of a document cannot be fetched to check the MaxSize of an
+	// Append or Prepend.
+	ErrDocumentSizeUnavailable = errors.New("The current size of the document could not be fetched.")
+
+	// ErrCounterExpiryNotSet occurs when a counter operation was applied but the expiry of the existing document
+	// could not be set afterwards.  The result of the counter operation is returned along with it.
+	ErrCounterExpiryNotSet = errors.New("The counter was updated but its expiry could not be set.")
+
+	// ErrDocumentChangedAfterMutation occurs when FetchDocumentAfterMutation is set and the document was changed
+	// by another mutation before it could be fetched.
+	ErrDocumentChangedAfterMutation = errors.New("The document was changed by another mutation before it could be fetched.")
+
+	// ErrMigrationFailed occurs when a document fetched from a Collection with Migrations cannot be upgraded to the
+	// latest version of its schema.
+	ErrMigrationFailed = errors.New("The document could not be migrated to the latest version of its schema.")
+
+	// ErrNoFields occurs when a partial update is attempted without any fields to update.
+	ErrNoFields = errors.New("You must specify at least one field to update.")
+	// ErrInvalidFieldName occurs when a partial update is attempted with an empty field name.
+	ErrInvalidFieldName = errors.New("An invalid field name was specified.")
 
 	// ErrSearchIndexInvalidName occurs when an invalid name was specified for a search index.
 	ErrSearchIndexInvalidName = errors.New("An invalid search index name was specified.")
@@ -657,6 +1022,12 @@ var (
 	ErrSearchIndexInvalidSourceName = errors.New("An invalid search index source name was specified.")
 	// ErrSearchIndexAlreadyExists occurs when an invalid source name was specific for a search index.
 	ErrSearchIndexAlreadyExists = errors.New("The search index specified already exists.")
+	// ErrSearchIndexNotFound occurs when the search index specified does not exist.
+	ErrSearchIndexNotFound = errors.New("The search index specified does not exist.")
+	// ErrSearchIndexNotAlias occurs when an alias operation targets a search index which is not an alias.
+	ErrSearchIndexNotAlias = errors.New("The search index specified is not an index alias.")
+	// ErrSearchIndexAliasNoTargets occurs when a search index alias is created without any target indexes.
+	ErrSearchIndexAliasNoTargets = errors.New("You must specify at least one index for a search index alias to target.")
 	// ErrSearchIndexInvalidIngestControlOp occurs when an invalid ingest control op was specific for a search index.
 	ErrSearchIndexInvalidIngestControlOp = errors.New("An invalid search index ingest control op was specified.")
 	// ErrSearchIndexInvalidQueryControlOp occurs when an invalid query control op was specific for a search index.
@@ -664,6 +1035,13 @@ var (
 	// ErrSearchIndexInvalidPlanFreezeControlOp occurs when an invalid plan freeze control op was specific for a search index.
 	ErrSearchIndexInvalidPlanFreezeControlOp = errors.New("An invalid search index plan freeze control op was specified.")
 
+	// ErrCircuitOpen occurs when every endpoint that a request could be sent to has failed repeatedly, and is not
+	// being sent requests until it has had time to recover.  See ClusterOptions.CircuitBreaker.
+	ErrCircuitOpen = errors.New("The circuit breaker is open for every endpoint of the requested service.")
+	// ErrAuthenticationFailure occurs when a service rejects the credentials used, or the user has no role
+	// which grants access to the service.
+	ErrAuthenticationFailure = errors.New("Authentication failed for the requested service.")
+
 	// ErrMixedAuthentication occurs when a combination of certification authentication and password authentication are used.
 	ErrMixedAuthentication = errors.New("Invalid mixed authentication configuration, cannot use cluster level authentication with bucket password authentication.")
 	// ErrMixedCertAuthentication occurs when client certificate authentication is setup but CertAuthenticator is not used or vise versa.
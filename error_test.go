@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
 )
 
 func TestQueryErrors(t *testing.T) {
@@ -68,3 +69,50 @@ func TestQueryErrors(t *testing.T) {
 		}
 	}
 }
+
+func TestIsRetryableError(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"kv temp fail", kvError{status: gocbcore.StatusTmpFail}, true},
+		{"kv key not found", kvError{status: gocbcore.StatusKeyNotFound}, false},
+		{"timeout", timeoutError{}, false},
+		{"service not found", serviceNotFoundError{}, false},
+		{"network rate limited", &networkError{statusCode: 429}, true},
+		{"network bad request", networkError{statusCode: 400}, false},
+		{"view", &viewError{}, false},
+		{"view unavailable", viewMultiError{httpStatus: 503}, true},
+		{"query", queryMultiError{errors: []QueryError{queryError{ErrorCode: 4050}}}, true},
+		{"query syntax", queryMultiError{errors: []QueryError{queryError{ErrorCode: 3000}}}, false},
+		{"query index not found", queryMultiError{errors: []QueryError{
+			queryError{ErrorCode: 5000, ErrorMessage: "GSI index beers not found."}}}, false},
+		{"query internal not found", queryMultiError{errors: []QueryError{
+			queryError{ErrorCode: 5000, ErrorMessage: "Scan failed: bucket not found"}}}, true},
+		{"analytics", analyticsQueryMultiError{errors: []AnalyticsQueryError{analyticsQueryError{ErrorCode: 23000}}}, false},
+		{"search", searchMultiError{httpStatus: 400}, false},
+		{"overload", gocbcore.ErrOverload, true},
+		{"wrapped", errors.Wrap(kvError{status: gocbcore.StatusBusy}, "context"), true},
+		{"other", errors.New("some error"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if IsRetryableError(tc.err) != tc.retryable {
+				t.Fatalf("Expected retryable to be %t", tc.retryable)
+			}
+		})
+	}
+
+	var _ RetryableError = kvError{}
+	var _ RetryableError = timeoutError{}
+	var _ RetryableError = serviceNotFoundError{}
+	var _ RetryableError = networkError{}
+	var _ RetryableError = &viewError{}
+	var _ RetryableError = viewMultiError{}
+	var _ RetryableError = queryMultiError{}
+	var _ RetryableError = analyticsQueryMultiError{}
+	var _ RetryableError = searchError{}
+	var _ RetryableError = searchMultiError{}
+}
@@ -0,0 +1,71 @@
+package gocb
+
+import (
+	"math/rand"
+	"net"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// isDialError returns whether err means that a connection to a node could not be made, so the request was never
+// sent and can safely be sent to another node.  Errors from a connection which was lost after the request was sent,
+// such as io.EOF, are not included, as the node may already have executed the request.
+func isDialError(err error) bool {
+	err = errors.Cause(err)
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// fallbackHostProvider retries query and search requests once on a different node when a connection to the node
+// they were sent to cannot be made, such as while a node is restarting, so that it does not surface as a failed
+// request.  The retry is only made if the context of the request has not been cancelled or passed its deadline.
+type fallbackHostProvider struct {
+	endpointForwarder
+	service ServiceType
+}
+
+// withFallbackHost returns provider, wrapped to retry requests for service on a different node when a connection
+// to the node cannot be made.  Provider is returned unwrapped if there is no other node to retry on, or if the circuit
+// breakers are enabled as they already reroute requests.
+func (c *Cluster) withFallbackHost(service ServiceType, provider httpProvider) httpProvider {
+	if c.breakers != nil || (service != N1qlService && service != FtsService) ||
+		len(serviceEndpoints(provider, service)) < 2 {
+		return provider
+	}
+
+	return &fallbackHostProvider{
+		endpointForwarder: endpointForwarder{provider},
+		service:           service,
+	}
+}
+
+func (p *fallbackHostProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	// Requests for a specific endpoint, such as those which are part of a transaction, cannot be sent elsewhere.
+	if ServiceType(req.Service) != p.service || req.Endpoint != "" {
+		return p.httpProvider.DoHttpRequest(req)
+	}
+
+	eps := serviceEndpoints(p.httpProvider, p.service)
+	if len(eps) < 2 {
+		return p.httpProvider.DoHttpRequest(req)
+	}
+
+	idx := rand.Intn(len(eps))
+	attempt := *req
+	attempt.Endpoint = eps[idx]
+	resp, err := p.httpProvider.DoHttpRequest(&attempt)
+	if err == nil || !isDialError(err) || (req.Context != nil && req.Context.Err() != nil) {
+		return resp, err
+	}
+
+	fallback := eps[(idx+1+rand.Intn(len(eps)-1))%len(eps)]
+	logDebugf("Retrying request on %s after failing to connect to %s (%s)", fallback, attempt.Endpoint, err)
+	attempt.Endpoint = fallback
+	return p.httpProvider.DoHttpRequest(&attempt)
+}
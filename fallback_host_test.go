@@ -0,0 +1,102 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"testing"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestFallbackHostRetriesConnectionErrors(t *testing.T) {
+	down := "http://a:8093"
+	var attempts []string
+	var failWith error
+	provider := &mockServiceEpsProvider{
+		mockHTTPProvider: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				attempts = append(attempts, req.Endpoint)
+				if req.Endpoint == down {
+					return nil, failWith
+				}
+				return &gocbcore.HttpResponse{
+					Endpoint:   req.Endpoint,
+					StatusCode: 200,
+					Body:       &testReadCloser{bytes.NewBufferString(`{"results":[],"status":"success"}`), nil},
+				}, nil
+			},
+		},
+		n1qlEps: []string{"http://a:8093", "http://b:8093"},
+	}
+
+	cluster := &Cluster{}
+	p := cluster.withFallbackHost(N1qlService, provider)
+
+	failWith = &url.Error{Op: "Post", URL: down, Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	for i := 0; i < 10; i++ {
+		attempts = nil
+		resp, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+		if err != nil {
+			t.Fatalf("Expected request to be retried on the other node but was %v", err)
+		}
+		if resp.Endpoint != "http://b:8093" {
+			t.Fatalf("Expected request to be sent to b but was %s", resp.Endpoint)
+		}
+		if len(attempts) > 2 {
+			t.Fatalf("Expected at most one retry but was sent to %v", attempts)
+		}
+	}
+
+	// Errors other than connection errors are not retried.
+	failWith = errors.New("invalid request")
+	down = "http://b:8093"
+	for i := 0; i < 10; i++ {
+		attempts = nil
+		_, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+		if err == nil && len(attempts) != 1 {
+			t.Fatalf("Expected request to be sent once but was sent to %v", attempts)
+		}
+		if err != nil && (err != failWith || len(attempts) != 1) {
+			t.Fatalf("Expected request to fail without retrying but was %v after %v", err, attempts)
+		}
+	}
+
+	// Connections lost after the request was sent are not retried, as the request may have been executed.
+	down = "http://a:8093"
+	for _, lost := range []error{
+		&url.Error{Op: "Post", URL: down, Err: &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset")}},
+		&url.Error{Op: "Post", URL: down, Err: io.EOF},
+	} {
+		failWith = lost
+		for i := 0; i < 10; i++ {
+			attempts = nil
+			_, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService})
+			if len(attempts) != 1 || (attempts[0] == down && err != lost) {
+				t.Fatalf("Expected request not to be retried after %v but was %v after %v", lost, err, attempts)
+			}
+		}
+	}
+
+	// Requests whose context has been cancelled are not retried.
+	failWith = &url.Error{Op: "Post", URL: down, Err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		attempts = nil
+		_, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService, Context: ctx})
+		if err != nil && len(attempts) != 1 {
+			t.Fatalf("Expected cancelled request not to be retried but was sent to %v", attempts)
+		}
+	}
+
+	// Requests for a specific endpoint are not sent elsewhere.
+	attempts = nil
+	_, err := p.DoHttpRequest(&gocbcore.HttpRequest{Service: gocbcore.N1qlService, Endpoint: down})
+	if err == nil || len(attempts) != 1 {
+		t.Fatalf("Expected request for a specific endpoint to fail on it but was %v after %v", err, attempts)
+	}
+}
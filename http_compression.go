@@ -0,0 +1,49 @@
+package gocb
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+const defaultHTTPRequestCompressionMinSize = 1024
+
+// compressHTTPRequest gzips the body of req when request compression is enabled and the body is large enough
+// for it to be worthwhile.  Compressed responses need no handling here, the HTTP client asks for them and
+// decompresses them transparently.
+func (c *Cluster) compressHTTPRequest(req *gocbcore.HttpRequest) {
+	if !c.ssb.httpRequestCompression {
+		return
+	}
+
+	minSize := c.ssb.httpRequestCompressionMinSize
+	if minSize <= 0 {
+		minSize = defaultHTTPRequestCompressionMinSize
+	}
+	if len(req.Body) < minSize {
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write(req.Body)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		logDebugf("Failed to compress request body (%s)", err)
+		return
+	}
+
+	// Some bodies, such as those mostly made up of already compressed parameters, get larger.
+	if buf.Len() >= len(req.Body) {
+		return
+	}
+
+	if req.Headers == nil {
+		req.Headers = make(map[string]string)
+	}
+	req.Headers["Content-Encoding"] = "gzip"
+	req.Body = buf.Bytes()
+}
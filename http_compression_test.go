@@ -0,0 +1,72 @@
+package gocb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestQueryRequestCompression(t *testing.T) {
+	var lastReq *gocbcore.HttpRequest
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			lastReq = req
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(`{"results":[],"status":"success"}`), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 10*time.Second, 0, 0)
+	cluster.ssb.httpRequestCompression = true
+
+	_, err := cluster.Query("SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if lastReq.Headers["Content-Encoding"] != "" {
+		t.Fatalf("Expected small request not to be compressed")
+	}
+
+	param := strings.Repeat("beer", 1000)
+	_, err = cluster.Query("SELECT $1", &QueryOptions{PositionalParameters: []interface{}{param}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if lastReq.Headers["Content-Encoding"] != "gzip" {
+		t.Fatalf("Expected large request to be compressed")
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(lastReq.Body))
+	if err != nil {
+		t.Fatalf("Failed to read compressed body: %v", err)
+	}
+	body, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	var opts map[string]interface{}
+	err = json.Unmarshal(body, &opts)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal decompressed body: %v", err)
+	}
+	if args, ok := opts["args"].([]interface{}); !ok || args[0] != param {
+		t.Fatalf("Expected decompressed body to contain the parameters but was %s", body)
+	}
+
+	cluster.ssb.httpRequestCompression = false
+	_, err = cluster.Query("SELECT $1", &QueryOptions{PositionalParameters: []interface{}{param}})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if lastReq.Headers["Content-Encoding"] != "" {
+		t.Fatalf("Expected request not to be compressed when compression is disabled")
+	}
+}
@@ -0,0 +1,158 @@
+package gocb
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// ServiceHTTPConfig configures the pool of HTTP connections used for one service, in place of the pool shared by
+// the other HTTP services.  A zero value field leaves the corresponding shared setting in place.
+type ServiceHTTPConfig struct {
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// TLSConfig overrides the TLS configuration from the connection string for the connections to the service,
+	// e.g. when it is behind a terminating proxy with its own CA or requires a different client certificate.
+	TLSConfig *tls.Config
+	// RequestTimeout bounds each HTTP request to the service, including reading the response body, on top of the
+	// timeout of the operation which sends it.
+	RequestTimeout time.Duration
+}
+
+// serviceTransport is installed as the transport of the HTTP client used by gocbcore when any service has its own
+// ServiceHTTPConfig.  Requests to the endpoints of those services are sent through a transport of their own, so
+// that they still go through gocbcore's request pipeline but do not share connections with the other services.
+type serviceTransport struct {
+	base            *http.Transport
+	endpoints       httpProvider
+	transports      map[ServiceType]*http.Transport
+	requestTimeouts map[ServiceType]time.Duration
+}
+
+// newServiceTransport creates a serviceTransport which sends requests for the services in configs through
+// transports cloned from base, identifying the service of each request from the endpoints of provider.
+func newServiceTransport(base *http.Transport, provider httpProvider,
+	configs map[ServiceType]ServiceHTTPConfig) *serviceTransport {
+	transports := make(map[ServiceType]*http.Transport, len(configs))
+	requestTimeouts := make(map[ServiceType]time.Duration)
+	for service, config := range configs {
+		transport := base.Clone()
+		if config.MaxIdleConns > 0 {
+			transport.MaxIdleConns = config.MaxIdleConns
+		}
+		if config.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+		}
+		if config.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = config.IdleConnTimeout
+		}
+		if config.TLSConfig != nil {
+			transport.TLSClientConfig = config.TLSConfig
+		}
+		transports[service] = transport
+
+		if config.RequestTimeout > 0 {
+			requestTimeouts[service] = config.RequestTimeout
+		}
+	}
+
+	return &serviceTransport{
+		base:            base,
+		endpoints:       provider,
+		transports:      transports,
+		requestTimeouts: requestTimeouts,
+	}
+}
+
+// serviceFor returns the service with its own configuration whose endpoint req is for, if there is one.
+func (t *serviceTransport) serviceFor(req *http.Request) (ServiceType, bool) {
+	origin := req.URL.Scheme + "://" + req.URL.Host
+	for service := range t.transports {
+		for _, ep := range serviceEndpoints(t.endpoints, service) {
+			if ep == origin {
+				return service, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// transportFor returns the transport for the service whose endpoint req is for.
+func (t *serviceTransport) transportFor(req *http.Request) *http.Transport {
+	if service, ok := t.serviceFor(req); ok {
+		return t.transports[service]
+	}
+	return t.base
+}
+
+func (t *serviceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service, ok := t.serviceFor(req)
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	timeout := t.requestTimeouts[service]
+	if timeout <= 0 {
+		return t.transports[service].RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.transports[service].RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The timeout also covers reading the body, so it is only released once the body is closed.
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnCloseBody releases the context of the request it is the response body of once it is closed.
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// CloseIdleConnections closes the idle connections of every service, gocbcore only closes those of its own
+// transport when the agent is closed.
+func (t *serviceTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+	for _, transport := range t.transports {
+		transport.CloseIdleConnections()
+	}
+}
+
+// withServiceTransports installs a serviceTransport in the HTTP client of agent if any service has its own HTTP
+// configuration.  This is done as soon as the agent is created, before gocb sends any requests through it.
+func (c *Cluster) withServiceTransports(agent *gocbcore.Agent) {
+	if len(c.serviceHTTPConfigs) == 0 {
+		return
+	}
+
+	client := agent.HttpClient()
+	base, ok := client.Transport.(*http.Transport)
+	if !ok {
+		logDebugf("Not applying service HTTP configuration, unexpected transport %T", client.Transport)
+		return
+	}
+	client.Transport = newServiceTransport(base, agent, c.serviceHTTPConfigs)
+}
+
+// closeServiceTransports closes the idle connections of the service transports of agent, which is being closed.
+func closeServiceTransports(agent *gocbcore.Agent) {
+	if transport, ok := agent.HttpClient().Transport.(*serviceTransport); ok {
+		transport.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,135 @@
+package gocb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type mockServiceEpsProvider struct {
+	*mockHTTPProvider
+	n1qlEps []string
+}
+
+func (p *mockServiceEpsProvider) N1qlEps() []string {
+	return p.n1qlEps
+}
+
+func TestServiceTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	base := &http.Transport{
+		MaxIdleConns:          10,
+		MaxIdleConnsPerHost:   5,
+		IdleConnTimeout:       time.Minute,
+		ResponseHeaderTimeout: time.Second,
+	}
+	provider := &mockServiceEpsProvider{n1qlEps: []string{server.URL}}
+	transport := newServiceTransport(base, provider, map[ServiceType]ServiceHTTPConfig{
+		N1qlService: {MaxIdleConnsPerHost: 50},
+	})
+
+	queryReq, _ := http.NewRequest("POST", server.URL+"/query/service", nil)
+	queryTransport := transport.transportFor(queryReq)
+	if queryTransport == base {
+		t.Fatalf("Expected query request to use the query transport")
+	}
+	if queryTransport.MaxIdleConnsPerHost != 50 || queryTransport.MaxIdleConns != 10 ||
+		queryTransport.IdleConnTimeout != time.Minute || queryTransport.ResponseHeaderTimeout != time.Second {
+		t.Fatalf("Expected query transport to override only the settings given but was %+v", queryTransport)
+	}
+
+	mgmtReq, _ := http.NewRequest("GET", "http://localhost:8091/pools", nil)
+	if transport.transportFor(mgmtReq) != base {
+		t.Fatalf("Expected other requests to use the shared transport")
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Do(queryReq)
+	if err != nil {
+		t.Fatalf("Expected request to succeed but was %v", err)
+	}
+	resp.Body.Close()
+	transport.CloseIdleConnections()
+}
+
+func TestServiceTransportTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer server.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(server.Certificate())
+
+	base := &http.Transport{}
+	provider := &mockServiceEpsProvider{n1qlEps: []string{server.URL}}
+	transport := newServiceTransport(base, provider, map[ServiceType]ServiceHTTPConfig{
+		N1qlService: {TLSConfig: &tls.Config{RootCAs: pool}},
+	})
+	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	resp, err := client.Get(server.URL + "/query/service")
+	if err != nil {
+		t.Fatalf("Expected request to be sent with the query TLS config but was %v", err)
+	}
+	resp.Body.Close()
+
+	// The override only applies to the service that it is configured for.
+	provider.n1qlEps = nil
+	_, err = client.Get(server.URL + "/query/service")
+	if err == nil {
+		t.Fatalf("Expected request to be sent without the query TLS config")
+	}
+}
+
+func TestServiceTransportRequestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(200)
+		w.(http.Flusher).Flush()
+		if req.URL.Path == "/slow" {
+			select {
+			case <-release:
+			case <-req.Context().Done():
+			}
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	provider := &mockServiceEpsProvider{n1qlEps: []string{server.URL}}
+	transport := newServiceTransport(&http.Transport{}, provider, map[ServiceType]ServiceHTTPConfig{
+		N1qlService: {RequestTimeout: 50 * time.Millisecond},
+	})
+	client := &http.Client{Transport: transport}
+	defer transport.CloseIdleConnections()
+
+	resp, err := client.Get(server.URL + "/fast")
+	if err != nil {
+		t.Fatalf("Expected request within the timeout to succeed but was %v", err)
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("Expected body within the timeout to be read but was %v", err)
+	}
+
+	// The timeout applies to reading the body, not just to receiving the response headers.
+	resp, err = client.Get(server.URL + "/slow")
+	if err != nil {
+		t.Fatalf("Expected response headers to be received but was %v", err)
+	}
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil {
+		t.Fatalf("Expected reading the body to time out")
+	}
+}
@@ -0,0 +1,209 @@
+// +build integration
+
+package gocb
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// The integration harness prepares a real server, such as one started by `make integration-server` or
+// allocated by cbdyncluster, for the integration tests.  Provisioning is opt-in via the -provision flag and is
+// idempotent so that the same server can be reused between runs.
+
+const (
+	testBucketQuota       = 256
+	testProvisionTimeout  = 60 * time.Second
+	testQueryDatasetName  = "beer_sample_query_dataset"
+	testProvisionProbeKey = "gocb-provision-probe"
+)
+
+// provision creates the bucket and indexes used by the tests and loads the query dataset into it.
+func (c *testCluster) provision(bucketName string) error {
+	if c.isMock() {
+		// The mock creates its buckets up front and has no query service.
+		return nil
+	}
+
+	err := c.provisionBucket(BucketSettings{
+		Name:         bucketName,
+		Type:         Couchbase,
+		Quota:        testBucketQuota,
+		FlushEnabled: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = c.waitForBucket(bucketName, testProvisionTimeout)
+	if err != nil {
+		return err
+	}
+
+	if c.SupportsFeature(N1qlFeature) {
+		err = c.provisionPrimaryIndex(bucketName)
+		if err != nil {
+			return err
+		}
+	}
+
+	bucket, err := c.Bucket(bucketName, nil)
+	if err != nil {
+		return err
+	}
+
+	col, err := bucket.DefaultCollection(nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = loadQueryDataset(col, testQueryDatasetName)
+	return err
+}
+
+// provisionBucket creates a bucket with settings unless a bucket with the same name already exists.
+func (c *testCluster) provisionBucket(settings BucketSettings) error {
+	manager, err := c.Buckets()
+	if err != nil {
+		return err
+	}
+
+	buckets, err := manager.GetBuckets()
+	if err != nil {
+		return err
+	}
+
+	for _, bucket := range buckets {
+		if bucket.Name == settings.Name {
+			return nil
+		}
+	}
+
+	return manager.InsertBucket(&settings)
+}
+
+// waitForBucket waits until a document can be written to the bucket, newly created buckets take some time to
+// become available on every node.
+func (c *testCluster) waitForBucket(bucketName string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := c.probeBucket(bucketName)
+		if err == nil {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("bucket %s was not ready after %s: %v", bucketName, timeout, err)
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func (c *testCluster) probeBucket(bucketName string) error {
+	bucket, err := c.Bucket(bucketName, nil)
+	if err != nil {
+		return err
+	}
+
+	col, err := bucket.DefaultCollection(nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = col.Upsert(testProvisionProbeKey, "probe", nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = col.Remove(testProvisionProbeKey, nil)
+	return err
+}
+
+// provisionPrimaryIndex creates the primary index on a bucket and waits for it to come online.
+func (c *testCluster) provisionPrimaryIndex(bucketName string) error {
+	manager, err := c.QueryIndexes()
+	if err != nil {
+		return err
+	}
+
+	err = manager.CreatePrimaryIndex(bucketName, "", true, false)
+	if err != nil {
+		return err
+	}
+
+	return manager.WatchIndexes(nil, true, testProvisionTimeout)
+}
+
+// loadQueryDataset upserts each of the results of a query dataset from testdata into col, returning the keys
+// that were used.
+func loadQueryDataset(col *Collection, dataset string) ([]string, error) {
+	var data struct {
+		Results []json.RawMessage `json:"results"`
+	}
+	err := loadJSONTestDataset(dataset, &data)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, len(data.Results))
+	for i, row := range data.Results {
+		keys[i] = fmt.Sprintf("%s-%d", dataset, i)
+		_, err = col.Upsert(keys[i], row, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
+
+// requireServer skips the current test when running against the mock.
+func (c *testCluster) requireServer(t *testing.T) {
+	if c.isMock() {
+		t.Skip("Test requires a real server")
+	}
+}
+
+// requireFeature skips the current test when the server being tested against does not support feature.
+func (c *testCluster) requireFeature(t *testing.T, feature FeatureCode) {
+	if c.NotSupportsFeature(feature) {
+		t.Skipf("Test requires feature %d which is not supported by version %v", feature, *c.Version)
+	}
+}
+
+func TestProvisionedQueryDataset(t *testing.T) {
+	globalCluster.requireServer(t)
+	globalCluster.requireFeature(t, N1qlFeature)
+
+	keys, err := loadQueryDataset(globalCollection, testQueryDatasetName)
+	if err != nil {
+		t.Fatalf("Failed to load query dataset: %v", err)
+	}
+
+	statement := fmt.Sprintf("SELECT META().id FROM `%s` WHERE META().id LIKE $prefix", globalBucket.Name())
+	results, err := globalCluster.Query(statement, &QueryOptions{
+		Consistency:     RequestPlus,
+		NamedParameters: map[string]interface{}{"prefix": testQueryDatasetName + "-%"},
+	})
+	if err != nil {
+		t.Fatalf("Query failed, error was %v", err)
+	}
+
+	var row interface{}
+	var count int
+	for results.Next(&row) {
+		count++
+	}
+
+	err = results.Close()
+	if err != nil {
+		t.Fatalf("Failed to close query results: %v", err)
+	}
+
+	if count != len(keys) {
+		t.Fatalf("Expected query to return %d rows but was %d", len(keys), count)
+	}
+}
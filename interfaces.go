@@ -0,0 +1,199 @@
+package gocb
+
+// The interfaces in this file cover the SDK's types so that application code can depend on them rather than on the
+// concrete types, allowing the SDK to be replaced in tests by mocks generated with tools such as gomock or
+// testify.  Methods which open another type return its interface, so that a mock can return further mocks.  As a
+// Go method cannot satisfy an interface method with a different return type the concrete types are adapted to the
+// interfaces with WrapCluster, WrapBucket, WrapScope and WrapCollection, and the types opened through an adapted
+// type are adapted in turn.  Methods which configure a copy of a type, such as Collection.WithOperationTimeout,
+// are deliberately left out.  Mocks can build the results which they return with NewGetResult, NewExistsResult,
+// NewMutationResult, NewCounterResult and NewQueryResults.
+
+// CollectionInterface is the set of key value operations available on a Collection.
+// VOLATILE: This API is subject to change at any time.
+type CollectionInterface interface {
+	Insert(key string, val interface{}, opts *InsertOptions) (*MutationResult, error)
+	Upsert(key string, val interface{}, opts *UpsertOptions) (*MutationResult, error)
+	Replace(key string, val interface{}, opts *ReplaceOptions) (*MutationResult, error)
+	Get(key string, opts *GetOptions) (*GetResult, error)
+	GetAs(key string, valuePtr interface{}, opts *GetOptions) (*GetResult, error)
+	Exists(key string, opts *ExistsOptions) (*ExistsResult, error)
+	GetMeta(key string, opts *GetMetaOptions) (*GetMetaResult, error)
+	GetFromReplica(key string, replicaIdx int, opts *GetFromReplicaOptions) (*GetResult, error)
+	GetAnyReplica(key string, opts *GetAnyReplicaOptions) (*GetResult, error)
+	Remove(key string, opts *RemoveOptions) (*MutationResult, error)
+	Rename(oldKey, newKey string, opts *RenameOptions) (*RenameResult, error)
+	LookupIn(key string, opts *LookupInOptions) (*LookupInResult, error)
+	Mutate(key string, opts *MutateInOptions) (*MutationResult, error)
+	UpdateFields(key string, fields map[string]interface{}, opts *MutateInOptions) (*MutationResult, error)
+	Merge(key string, partial interface{}, opts *MergeOptions) (*MutationResult, error)
+	GetAndTouch(key string, expiration uint32, opts *GetAndTouchOptions) (*GetResult, error)
+	GetAndLock(key string, expiration uint32, opts *GetAndLockOptions) (*GetResult, error)
+	Unlock(key string, opts *UnlockOptions) (*MutationResult, error)
+	Touch(key string, expiration uint32, opts *GetAndTouchOptions) (*MutationResult, error)
+	WaitForReplication(result MutationResult, replicas int, opts *WaitForMutationOptions) error
+	WaitForPersistence(result MutationResult, nodes int, opts *WaitForMutationOptions) error
+	Binary() BinaryCollectionInterface
+}
+
+// BinaryCollectionInterface is the set of binary and counter operations available on a CollectionBinary.
+// VOLATILE: This API is subject to change at any time.
+type BinaryCollectionInterface interface {
+	Append(key string, val []byte, opts *AppendOptions) (*MutationResult, error)
+	Prepend(key string, val []byte, opts *PrependOptions) (*MutationResult, error)
+	Increment(key string, opts *CounterOptions) (*CounterResult, error)
+	Decrement(key string, opts *CounterOptions) (*CounterResult, error)
+}
+
+// BucketInterface is the set of operations available on a Bucket.
+// VOLATILE: This API is subject to change at any time.
+type BucketInterface interface {
+	Name() string
+	Scope(scopeName string) ScopeInterface
+	Collection(scopeName string, collectionName string, opts *CollectionOptions) (CollectionInterface, error)
+	DefaultCollection(opts *CollectionOptions) (CollectionInterface, error)
+	ViewQuery(designDoc string, viewName string, opts *ViewOptions) (*ViewResults, error)
+	SpatialViewQuery(designDoc string, viewName string, opts *SpatialViewOptions) (*ViewResults, error)
+	Views() (*ViewManager, error)
+	Ping(opts *PingOptions) (*PingReport, error)
+	Close(opts *BucketCloseOptions) error
+}
+
+// ScopeInterface is the set of operations available on a Scope.
+// VOLATILE: This API is subject to change at any time.
+type ScopeInterface interface {
+	Collection(collectionName string, opts *CollectionOptions) (CollectionInterface, error)
+	DefaultCollection(opts *CollectionOptions) (CollectionInterface, error)
+}
+
+// QueryerInterface is implemented by types which can execute N1QL queries, such as a Cluster or a
+// QueryTransaction.
+// VOLATILE: This API is subject to change at any time.
+type QueryerInterface interface {
+	Query(statement string, opts *QueryOptions) (*QueryResults, error)
+}
+
+// AnalyticsQueryerInterface is implemented by types which can execute analytics queries.
+// VOLATILE: This API is subject to change at any time.
+type AnalyticsQueryerInterface interface {
+	AnalyticsQuery(statement string, opts *AnalyticsQueryOptions) (*AnalyticsResults, error)
+}
+
+// SearchQueryerInterface is implemented by types which can execute full text search queries.
+// VOLATILE: This API is subject to change at any time.
+type SearchQueryerInterface interface {
+	SearchQuery(q SearchQuery, opts *SearchQueryOptions) (*SearchResults, error)
+}
+
+// ClusterInterface is the set of operations available on a Cluster.
+// VOLATILE: This API is subject to change at any time.
+type ClusterInterface interface {
+	QueryerInterface
+	AnalyticsQueryerInterface
+	SearchQueryerInterface
+
+	Bucket(bucketName string, opts *BucketOptions) (BucketInterface, error)
+	PartitionedQuery(statement string, partitions []QueryPartition, opts *PartitionedQueryOptions) (*QueryResults, error)
+	QueryTransaction(fn func(tx QueryerInterface) error, opts *QueryTransactionOptions) error
+	Diagnostics() (*DiagnosticsReport, error)
+	Reauthenticate(auth Authenticator) error
+	Users() (*UserManager, error)
+	Buckets() (*BucketManager, error)
+	QueryIndexes() (*QueryIndexManager, error)
+	SearchIndexes() (*SearchIndexManager, error)
+	Close(opts *ClusterCloseOptions) error
+}
+
+// WrapCluster adapts c to ClusterInterface.
+// VOLATILE: This API is subject to change at any time.
+func WrapCluster(c *Cluster) ClusterInterface {
+	return clusterInterface{c}
+}
+
+type clusterInterface struct {
+	*Cluster
+}
+
+func (c clusterInterface) Bucket(bucketName string, opts *BucketOptions) (BucketInterface, error) {
+	b, err := c.Cluster.Bucket(bucketName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return WrapBucket(b), nil
+}
+
+func (c clusterInterface) QueryTransaction(fn func(tx QueryerInterface) error, opts *QueryTransactionOptions) error {
+	return c.Cluster.QueryTransaction(func(tx *QueryTransaction) error {
+		return fn(tx)
+	}, opts)
+}
+
+// WrapBucket adapts b to BucketInterface.
+// VOLATILE: This API is subject to change at any time.
+func WrapBucket(b *Bucket) BucketInterface {
+	return bucketInterface{b}
+}
+
+type bucketInterface struct {
+	*Bucket
+}
+
+func (b bucketInterface) Scope(scopeName string) ScopeInterface {
+	return WrapScope(b.Bucket.Scope(scopeName))
+}
+
+func (b bucketInterface) Collection(scopeName string, collectionName string,
+	opts *CollectionOptions) (CollectionInterface, error) {
+	return wrapCollection(b.Bucket.Collection(scopeName, collectionName, opts))
+}
+
+func (b bucketInterface) DefaultCollection(opts *CollectionOptions) (CollectionInterface, error) {
+	return wrapCollection(b.Bucket.DefaultCollection(opts))
+}
+
+// WrapScope adapts s to ScopeInterface.
+// VOLATILE: This API is subject to change at any time.
+func WrapScope(s *Scope) ScopeInterface {
+	return scopeInterface{s}
+}
+
+type scopeInterface struct {
+	*Scope
+}
+
+func (s scopeInterface) Collection(collectionName string, opts *CollectionOptions) (CollectionInterface, error) {
+	return wrapCollection(s.Scope.Collection(collectionName, opts))
+}
+
+func (s scopeInterface) DefaultCollection(opts *CollectionOptions) (CollectionInterface, error) {
+	return wrapCollection(s.Scope.DefaultCollection(opts))
+}
+
+// WrapCollection adapts c to CollectionInterface.
+// VOLATILE: This API is subject to change at any time.
+func WrapCollection(c *Collection) CollectionInterface {
+	return collectionInterface{c}
+}
+
+// wrapCollection adapts the result of opening a Collection, leaving the interface nil if it failed to open.
+func wrapCollection(c *Collection, err error) (CollectionInterface, error) {
+	if err != nil {
+		return nil, err
+	}
+	return WrapCollection(c), nil
+}
+
+type collectionInterface struct {
+	*Collection
+}
+
+func (c collectionInterface) Binary() BinaryCollectionInterface {
+	return c.Collection.Binary()
+}
+
+var (
+	_ BinaryCollectionInterface = &CollectionBinary{}
+	_ QueryerInterface          = &QueryTransaction{}
+	_ AnalyticsQueryerInterface = &Cluster{}
+	_ SearchQueryerInterface    = &Cluster{}
+)
@@ -0,0 +1,73 @@
+package gocb_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/couchbase/gocb"
+)
+
+// fakeCollection implements CollectionInterface outside of the gocb package, embedding the interface so that
+// only the operations which are used need implementing.
+type fakeCollection struct {
+	gocb.CollectionInterface
+	docs map[string]interface{}
+}
+
+func (c *fakeCollection) Get(key string, opts *gocb.GetOptions) (*gocb.GetResult, error) {
+	doc, ok := c.docs[key]
+	if !ok {
+		return nil, errors.New("document not found")
+	}
+	return gocb.NewGetResult(gocb.Cas(1), doc)
+}
+
+func (c *fakeCollection) Upsert(key string, val interface{}, opts *gocb.UpsertOptions) (*gocb.MutationResult, error) {
+	c.docs[key] = val
+	return gocb.NewMutationResult(gocb.Cas(2), gocb.MutationToken{}), nil
+}
+
+type fakeQueryer struct {
+	rows []interface{}
+}
+
+func (q *fakeQueryer) Query(statement string, opts *gocb.QueryOptions) (*gocb.QueryResults, error) {
+	return gocb.NewQueryResults(q.rows)
+}
+
+func TestInterfacesImplementedExternally(t *testing.T) {
+	var col gocb.CollectionInterface = &fakeCollection{docs: make(map[string]interface{})}
+
+	res, err := col.Upsert("key", map[string]string{"name": "a"}, nil)
+	if err != nil || res.Cas() != 2 {
+		t.Fatalf("Expected upsert to succeed but was %v, %v", res, err)
+	}
+
+	doc, err := col.Get("key", nil)
+	if err != nil {
+		t.Fatalf("Expected get to succeed but error was %v", err)
+	}
+	var content map[string]string
+	err = doc.Content(&content)
+	if err != nil || content["name"] != "a" || doc.Cas() != 1 {
+		t.Fatalf("Expected document to be returned but was %v, %v", content, err)
+	}
+
+	var queryer gocb.QueryerInterface = &fakeQueryer{rows: []interface{}{map[string]int{"a": 1}, map[string]int{"a": 2}}}
+	rows, err := queryer.Query("SELECT a", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	var row map[string]int
+	var values []int
+	for rows.Next(&row) {
+		values = append(values, row["a"])
+	}
+	err = rows.Close()
+	if err != nil || len(values) != 2 || values[0] != 1 || values[1] != 2 {
+		t.Fatalf("Expected rows to be returned but were %v, %v", values, err)
+	}
+	if rows.Metrics().ResultCount != 2 {
+		t.Fatalf("Expected result count of 2 but was %d", rows.Metrics().ResultCount)
+	}
+}
@@ -0,0 +1,30 @@
+package gocb
+
+import (
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestWrapBucket(t *testing.T) {
+	provider := &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []byte(`{"name":"a"}`)}
+	bucket := WrapBucket(testGetBucket(provider))
+
+	col, err := bucket.Scope("_default").DefaultCollection(nil)
+	if err != nil {
+		t.Fatalf("Opening collection encountered error: %v", err)
+	}
+	if _, ok := col.(collectionInterface); !ok {
+		t.Fatalf("Expected collection opened through a wrapped scope to be wrapped but was %T", col)
+	}
+
+	res, err := col.Get("key", nil)
+	if err != nil || res.Cas() != 1 {
+		t.Fatalf("Expected get through the interface to succeed but was %v", err)
+	}
+
+	if _, ok := col.Binary().(*CollectionBinary); !ok {
+		t.Fatalf("Expected binary collection to be returned through its interface")
+	}
+}
@@ -0,0 +1,39 @@
+// Package jsonkeys reads the keys of JSON objects in the order in which they appear, which encoding/json does
+// not preserve when decoding into a map.
+package jsonkeys
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ObjectKeys returns the keys of the JSON object in data, in order.
+func ObjectKeys(data []byte) ([]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	// The opening brace.
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, fmt.Errorf("unexpected token %v, expected an object", tok)
+	}
+
+	var keys []string
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, keyToken.(string))
+
+		var value json.RawMessage
+		err = dec.Decode(&value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,21 @@
+package jsonkeys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestObjectKeys(t *testing.T) {
+	keys, err := ObjectKeys([]byte(`{"b":1,"a":{"c":[1,2]},"d":null}`))
+	if err != nil {
+		t.Fatalf("Expected keys but error was %v", err)
+	}
+	if strings.Join(keys, ",") != "b,a,d" {
+		t.Fatalf("Expected keys in order but were %v", keys)
+	}
+
+	_, err = ObjectKeys([]byte(`[1,2]`))
+	if err == nil {
+		t.Fatalf("Expected an array to fail")
+	}
+}
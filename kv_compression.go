@@ -0,0 +1,97 @@
+package gocb
+
+import (
+	"github.com/golang/snappy"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+const (
+	// The defaults used by gocbcore, which gocb takes over value compression from.
+	defaultCompressionMinSize  = 32
+	defaultCompressionMinRatio = 0.83
+)
+
+// valueCompression configures the snappy compression of document values written to the server, set from the
+// compression, compression_min_size and compression_min_ratio connection string options.
+type valueCompression struct {
+	enabled  bool
+	minSize  int
+	minRatio float64
+}
+
+// CompressionRecorder can be implemented by a MetricsRecorder to also receive the raw and compressed sizes of
+// document values which were considered for compression, so that it can be verified that compression is
+// reducing the size of the values being written.  compressedSize is the size of the snappy encoded value, the
+// value is only sent compressed if compressed is true.  Implementations must be safe for concurrent use.
+type CompressionRecorder interface {
+	RecordCompression(labels MetricLabels, rawSize, compressedSize int, compressed bool)
+}
+
+// helloFeatureProvider is implemented by KV providers which report the features negotiated by their connections
+// to the server.
+type helloFeatureProvider interface {
+	SupportsFeature(feature gocbcore.HelloFeature) bool
+}
+
+// featureProvider returns the provider underneath the ones which gocb wraps agent in which reports the features
+// negotiated by its connections, or nil if agent cannot report its features.
+func featureProvider(agent kvProvider) helloFeatureProvider {
+	for {
+		switch p := agent.(type) {
+		case helloFeatureProvider:
+			return p
+		case *keyCheckingProvider:
+			agent = p.kvProvider
+		case *readOnlyProvider:
+			agent = p.kvProvider
+		default:
+			return nil
+		}
+	}
+}
+
+// supportsSnappy returns whether the connections of agent report that snappy compression was negotiated with the
+// server.  It returns false if agent cannot report its features.
+func supportsSnappy(agent kvProvider) bool {
+	p := featureProvider(agent)
+	return p != nil && p.SupportsFeature(gocbcore.FeatureSnappy)
+}
+
+// compressValue returns value snappy compressed, along with the datatype flag marking it as compressed, if
+// compression is enabled, not disabled for the operation, negotiated by the connections of agent, and reduces the
+// size of the value enough to be worth it.  Otherwise value is returned unchanged with no datatype flags.  gocb
+// compresses values itself, rather than leaving it to gocbcore, so that compression can be disabled per operation
+// and its effect measured.  Values are only compressed once the connections report that the server supports
+// snappy, a value sent compressed to a server which does not would be rejected, otherwise they are left to
+// gocbcore which compresses them on the connections which support it.
+func (c *Collection) compressValue(agent kvProvider, operation string, value []byte, disable bool) ([]byte, uint8) {
+	compression := c.sb.ValueCompression
+	if !compression.enabled || disable || !supportsSnappy(agent) {
+		return value, 0
+	}
+
+	minSize := compression.minSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	if len(value) <= minSize {
+		return value, 0
+	}
+
+	minRatio := compression.minRatio
+	if minRatio <= 0 {
+		minRatio = defaultCompressionMinRatio
+	}
+
+	compressedValue := snappy.Encode(nil, value)
+	compressed := float64(len(compressedValue))/float64(len(value)) <= minRatio
+
+	if recorder, ok := c.sb.MetricsRecorder.(CompressionRecorder); ok {
+		recorder.RecordCompression(c.metricLabels(operation), len(value), len(compressedValue), compressed)
+	}
+
+	if !compressed {
+		return value, 0
+	}
+	return compressedValue, uint8(gocbcore.DatatypeFlagCompressed)
+}
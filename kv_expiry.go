@@ -0,0 +1,50 @@
+package gocb
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// relativeExpiryLimit is the largest expiration which the server treats as a number of seconds from now, larger
+// expirations are absolute unix times.
+const relativeExpiryLimit = 30 * 24 * 60 * 60
+
+// jitterExpiration returns expiration randomly moved by up to jitter of its length in either direction, so that
+// documents written together with the same expiration do not all expire at the same moment.  Absolute expirations
+// are moved by a fraction of the time remaining until they are reached.
+func jitterExpiration(expiration uint32, jitter float64) (uint32, error) {
+	if jitter < 0 || jitter >= 1 {
+		return 0, errors.Wrapf(ErrInvalidArgument, "expiration jitter must be at least 0 and less than 1, was %v", jitter)
+	}
+	if expiration == 0 || jitter == 0 {
+		return expiration, nil
+	}
+
+	var now int64
+	length := int64(expiration)
+	if expiration > relativeExpiryLimit {
+		now = time.Now().Unix()
+		length -= now
+		if length <= 0 {
+			return expiration, nil
+		}
+	}
+
+	offset := int64((rand.Float64()*2 - 1) * jitter * float64(length))
+	jittered := length + offset
+	if jittered < 1 {
+		jittered = 1
+	}
+
+	if now == 0 {
+		// Keep relative expirations relative, longer ones would be read as an absolute time in 1970.
+		if jittered > relativeExpiryLimit {
+			jittered = relativeExpiryLimit
+		}
+		return uint32(jittered), nil
+	}
+
+	return uint32(now + jittered), nil
+}
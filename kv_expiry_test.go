@@ -0,0 +1,82 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestJitterExpiration(t *testing.T) {
+	seen := make(map[uint32]bool)
+	for i := 0; i < 1000; i++ {
+		expiry, err := jitterExpiration(1000, 0.1)
+		if err != nil {
+			t.Fatalf("Expected jitter to succeed but error was %v", err)
+		}
+		if expiry < 900 || expiry > 1100 {
+			t.Fatalf("Expected expiry within 10%% of 1000 but was %d", expiry)
+		}
+		seen[expiry] = true
+	}
+	if len(seen) < 10 {
+		t.Fatalf("Expected expiries to be spread out but only saw %d distinct values", len(seen))
+	}
+
+	absolute := uint32(time.Now().Unix()) + 1000
+	expiry, err := jitterExpiration(absolute, 0.5)
+	if err != nil {
+		t.Fatalf("Expected jitter to succeed but error was %v", err)
+	}
+	if expiry < absolute-501 || expiry > absolute+501 {
+		t.Fatalf("Expected absolute expiry within 50%% of the remaining time but was %d", expiry)
+	}
+
+	expiry, err = jitterExpiration(relativeExpiryLimit, 0.5)
+	if err != nil {
+		t.Fatalf("Expected jitter to succeed but error was %v", err)
+	}
+	if expiry > relativeExpiryLimit {
+		t.Fatalf("Expected relative expiry to stay relative but was %d", expiry)
+	}
+
+	expiry, err = jitterExpiration(0, 0.5)
+	if err != nil || expiry != 0 {
+		t.Fatalf("Expected no expiry to be left alone but was %d, %v", expiry, err)
+	}
+
+	_, err = jitterExpiration(1000, 1)
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected ErrInvalidArgument but was %v", err)
+	}
+}
+
+type expiryRecordingProvider struct {
+	*mocktest.KvOperator
+	expiry uint32
+}
+
+func (p *expiryRecordingProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.expiry = opts.Expiry
+	return p.KvOperator.SetEx(opts, cb)
+}
+
+func TestUpsertExpirationJitter(t *testing.T) {
+	provider := &expiryRecordingProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Upsert("key", "value", &UpsertOptions{Expiration: 3600, ExpirationJitter: 0.1})
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+	if provider.expiry < 3240 || provider.expiry > 3960 {
+		t.Fatalf("Expected expiry within 10%% of 3600 but was %d", provider.expiry)
+	}
+
+	_, err = col.Upsert("key", "value", &UpsertOptions{Expiration: 3600, ExpirationJitter: -0.1})
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected ErrInvalidArgument but was %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package gocb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultKvHeartbeatTimeout       = 2500 * time.Millisecond
+	defaultKvDeadConnectionFailures = 3
+)
+
+// kvHeartbeater periodically sends a NOOP to every KV node whilst a client has been idle, keeping connections
+// alive through firewalls which drop idle connections and detecting nodes which have stopped responding.  When a
+// dead connection is detected, the connections of the client are recycled.
+type kvHeartbeater struct {
+	provider  diagnosticsProvider
+	interval  time.Duration
+	timeout   time.Duration
+	threshold uint
+	recycle   func() error
+	onDead    func(endpoint string)
+
+	lastActivity int64
+	failures     map[string]uint
+
+	stopOnce sync.Once
+	stop     chan struct{}
+}
+
+func newKvHeartbeater(provider diagnosticsProvider, ssb servicesStateBlock, recycle func() error,
+	onDead func(endpoint string)) *kvHeartbeater {
+	timeout := ssb.kvHeartbeatTimeout
+	if timeout <= 0 {
+		timeout = defaultKvHeartbeatTimeout
+	}
+
+	threshold := ssb.kvDeadConnectionFailures
+	if threshold == 0 {
+		threshold = defaultKvDeadConnectionFailures
+	}
+
+	return &kvHeartbeater{
+		provider:     provider,
+		interval:     ssb.kvHeartbeatInterval,
+		timeout:      timeout,
+		threshold:    threshold,
+		recycle:      recycle,
+		onDead:       onDead,
+		lastActivity: time.Now().UnixNano(),
+		failures:     make(map[string]uint),
+		stop:         make(chan struct{}),
+	}
+}
+
+// touch records that an operation has been sent, postponing the next heartbeat.
+func (h *kvHeartbeater) touch() {
+	if h == nil {
+		return
+	}
+
+	atomic.StoreInt64(&h.lastActivity, time.Now().UnixNano())
+}
+
+func (h *kvHeartbeater) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, atomic.LoadInt64(&h.lastActivity)))
+}
+
+func (h *kvHeartbeater) start() {
+	go h.run()
+}
+
+func (h *kvHeartbeater) close() {
+	if h == nil {
+		return
+	}
+
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+}
+
+func (h *kvHeartbeater) run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stop:
+			return
+		case now := <-ticker.C:
+			if h.idleFor(now) < h.interval {
+				continue
+			}
+
+			h.beat()
+		}
+	}
+}
+
+// beat sends a single round of heartbeats, reporting any node which has failed threshold consecutive heartbeats
+// and recycling the connections once if there are any.
+func (h *kvHeartbeater) beat() {
+	results, err := pingKvProvider(h.provider, h.timeout)
+	if err != nil {
+		logDebugf("Failed to send KV heartbeats: %s", err)
+		return
+	}
+
+	var dead []string
+	for _, result := range results {
+		if result.Error == nil {
+			delete(h.failures, result.Endpoint)
+			continue
+		}
+
+		h.failures[result.Endpoint]++
+		if h.failures[result.Endpoint] == h.threshold {
+			logWarnf("KV node %s has failed %d consecutive heartbeats, the connection may be dead: %s",
+				result.Endpoint, h.threshold, result.Error)
+			dead = append(dead, result.Endpoint)
+		}
+	}
+
+	if len(dead) == 0 {
+		return
+	}
+
+	// Recycling replaces the agent, and with it this heartbeater, so the failures are not reset here.
+	if h.recycle != nil {
+		if err := h.recycle(); err != nil {
+			logWarnf("Failed to reconnect after detecting dead KV connections to %v: %s", dead, err)
+		}
+	}
+
+	if h.onDead != nil {
+		for _, endpoint := range dead {
+			h.onDead(endpoint)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gocb
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type mockPingProvider struct {
+	mockStatsProvider
+	results []gocbcore.PingResult
+	pings   int
+}
+
+func (p *mockPingProvider) PingKvEx(opts gocbcore.PingKvOptions, cb gocbcore.PingKvExCallback) (gocbcore.PendingOp, error) {
+	p.pings++
+	go cb(&gocbcore.PingKvResult{Services: p.results}, nil)
+	return &mocktest.PendingOp{}, nil
+}
+
+func TestKvHeartbeaterDeadConnection(t *testing.T) {
+	provider := &mockPingProvider{
+		results: []gocbcore.PingResult{
+			{Endpoint: "10.112.0.1:11210"},
+			{Endpoint: "10.112.0.2:11210", Error: errors.New("timed out")},
+		},
+	}
+
+	var dead []string
+	recycled := 0
+	h := newKvHeartbeater(provider, servicesStateBlock{
+		kvHeartbeatInterval:      time.Second,
+		kvDeadConnectionFailures: 2,
+	}, func() error {
+		recycled++
+		return nil
+	}, func(endpoint string) {
+		dead = append(dead, endpoint)
+	})
+
+	h.beat()
+	if len(dead) != 0 || recycled != 0 {
+		t.Fatalf("Expected no dead connections after one failure but had %v, recycled %d times", dead, recycled)
+	}
+
+	h.beat()
+	h.beat()
+	if len(dead) != 1 || dead[0] != "10.112.0.2:11210" {
+		t.Fatalf("Expected a single dead connection to be reported but had %v", dead)
+	}
+	if recycled != 1 {
+		t.Fatalf("Expected the connections to be recycled once but were recycled %d times", recycled)
+	}
+
+	provider.results[1].Error = nil
+	h.beat()
+	if _, ok := h.failures["10.112.0.2:11210"]; ok {
+		t.Fatalf("Expected failures to be reset after a successful heartbeat")
+	}
+}
+
+func TestKvHeartbeaterSkipsWhenActive(t *testing.T) {
+	provider := &mockPingProvider{}
+	h := newKvHeartbeater(provider, servicesStateBlock{kvHeartbeatInterval: time.Minute}, nil, nil)
+
+	h.touch()
+	if h.idleFor(time.Now()) >= h.interval {
+		t.Fatalf("Expected heartbeater to not be idle after activity")
+	}
+
+	if h.idleFor(time.Now().Add(2*time.Minute)) < h.interval {
+		t.Fatalf("Expected heartbeater to be idle after the interval")
+	}
+
+	var nilHeartbeater *kvHeartbeater
+	nilHeartbeater.touch()
+	nilHeartbeater.close()
+}
@@ -0,0 +1,267 @@
+package gocb
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+const (
+	// kvErrorWindow is how long errors are counted in the heatmap for, after which they are forgotten so that the
+	// heatmap reflects recent problems rather than every error since the client was created.
+	kvErrorWindow = 5 * time.Minute
+
+	// kvErrorHeatmapMaxVbuckets is the most vbuckets listed for each bucket in a heatmap, those with the most
+	// errors are listed.
+	kvErrorHeatmapMaxVbuckets = 20
+)
+
+// kvErrorKey identifies the vbucket, and the address of the server holding its active copy, that an error
+// occurred on.  server is empty if it is not known.
+type kvErrorKey struct {
+	bucket  string
+	vbucket uint16
+	server  string
+}
+
+// kvErrorHeatmap counts recent KV errors per vbucket and server.  Errors are counted in two consecutive windows,
+// the current and the previous one, so that the counts cover between one and two windows of time.
+type kvErrorHeatmap struct {
+	lock     sync.Mutex
+	started  time.Time
+	current  map[kvErrorKey]uint64
+	previous map[kvErrorKey]uint64
+}
+
+func newKvErrorHeatmap() *kvErrorHeatmap {
+	return &kvErrorHeatmap{
+		started: time.Now(),
+		current: make(map[kvErrorKey]uint64),
+	}
+}
+
+func (h *kvErrorHeatmap) rotateLocked(now time.Time) {
+	elapsed := now.Sub(h.started)
+	if elapsed < kvErrorWindow {
+		return
+	}
+
+	if elapsed < 2*kvErrorWindow {
+		h.previous = h.current
+	} else {
+		h.previous = nil
+	}
+	h.current = make(map[kvErrorKey]uint64)
+	h.started = now
+}
+
+func (h *kvErrorHeatmap) record(key kvErrorKey, now time.Time) {
+	h.lock.Lock()
+	h.rotateLocked(now)
+	h.current[key]++
+	h.lock.Unlock()
+}
+
+func (h *kvErrorHeatmap) counts(now time.Time) map[kvErrorKey]uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.rotateLocked(now)
+	counts := make(map[kvErrorKey]uint64, len(h.current)+len(h.previous))
+	for key, count := range h.previous {
+		counts[key] += count
+	}
+	for key, count := range h.current {
+		counts[key] += count
+	}
+	return counts
+}
+
+// KvErrorHeatmap summarizes the KV errors which have occurred recently, per bucket, so that errors concentrated
+// on a single vbucket or server, for example after a failed rebalance, can be spotted from the client.  Only
+// errors which suggest a problem with the cluster are counted, such as timeouts, network errors and temporary
+// failures, not errors such as a document not existing.
+type KvErrorHeatmap struct {
+	// Window is the length of time that errors are counted for, the counts cover at least this long and at most
+	// twice it.
+	Window  time.Duration
+	Buckets []KvBucketErrorHeatmap
+}
+
+// KvBucketErrorHeatmap holds the recent KV errors for a single bucket.
+type KvBucketErrorHeatmap struct {
+	BucketName string
+	Errors     uint64
+	// Vbuckets are the vbuckets with the most errors, most first.
+	Vbuckets []KvVbucketErrors
+	// Servers are the servers with errors, most first.
+	Servers []KvServerErrors
+}
+
+// KvVbucketErrors holds the number of recent errors for a vbucket.
+type KvVbucketErrors struct {
+	Vbucket uint16
+	Errors  uint64
+}
+
+// KvServerErrors holds the number of recent errors for a server, identified by the host and port of its data
+// service.
+type KvServerErrors struct {
+	Server string
+	Errors uint64
+}
+
+func (h *kvErrorHeatmap) summary(now time.Time) *KvErrorHeatmap {
+	type bucketCounts struct {
+		total    uint64
+		vbuckets map[uint16]uint64
+		servers  map[string]uint64
+	}
+	buckets := make(map[string]*bucketCounts)
+	for key, count := range h.counts(now) {
+		b, ok := buckets[key.bucket]
+		if !ok {
+			b = &bucketCounts{
+				vbuckets: make(map[uint16]uint64),
+				servers:  make(map[string]uint64),
+			}
+			buckets[key.bucket] = b
+		}
+		b.total += count
+		b.vbuckets[key.vbucket] += count
+		if key.server != "" {
+			b.servers[key.server] += count
+		}
+	}
+
+	heatmap := &KvErrorHeatmap{
+		Window: kvErrorWindow,
+	}
+	for name, b := range buckets {
+		bucket := KvBucketErrorHeatmap{
+			BucketName: name,
+			Errors:     b.total,
+		}
+		for vbucket, count := range b.vbuckets {
+			bucket.Vbuckets = append(bucket.Vbuckets, KvVbucketErrors{Vbucket: vbucket, Errors: count})
+		}
+		sort.Slice(bucket.Vbuckets, func(i, j int) bool {
+			if bucket.Vbuckets[i].Errors != bucket.Vbuckets[j].Errors {
+				return bucket.Vbuckets[i].Errors > bucket.Vbuckets[j].Errors
+			}
+			return bucket.Vbuckets[i].Vbucket < bucket.Vbuckets[j].Vbucket
+		})
+		if len(bucket.Vbuckets) > kvErrorHeatmapMaxVbuckets {
+			bucket.Vbuckets = bucket.Vbuckets[:kvErrorHeatmapMaxVbuckets]
+		}
+
+		for server, count := range b.servers {
+			bucket.Servers = append(bucket.Servers, KvServerErrors{Server: server, Errors: count})
+		}
+		sort.Slice(bucket.Servers, func(i, j int) bool {
+			if bucket.Servers[i].Errors != bucket.Servers[j].Errors {
+				return bucket.Servers[i].Errors > bucket.Servers[j].Errors
+			}
+			return bucket.Servers[i].Server < bucket.Servers[j].Server
+		})
+
+		heatmap.Buckets = append(heatmap.Buckets, bucket)
+	}
+	sort.Slice(heatmap.Buckets, func(i, j int) bool {
+		return heatmap.Buckets[i].BucketName < heatmap.Buckets[j].BucketName
+	})
+
+	return heatmap
+}
+
+// isKvHealthError returns whether err suggests a problem with the cluster, rather than with the document or
+// request, and so should be counted in the error heatmap.
+func isKvHealthError(err error) bool {
+	if IsTimeoutError(err) || IsNetworkError(err) {
+		return true
+	}
+
+	switch cause := errors.Cause(err).(type) {
+	case *gocbcore.KvError:
+		return isKvHealthStatus(cause.Code)
+	case KeyValueError:
+		return cause.KVError() && isKvHealthStatus(gocbcore.StatusCode(cause.StatusCode()))
+	}
+
+	cause := errors.Cause(err)
+	return cause == gocbcore.ErrNetwork || cause == gocbcore.ErrTimeout
+}
+
+func isKvHealthStatus(status gocbcore.StatusCode) bool {
+	switch status {
+	case gocbcore.StatusTmpFail, gocbcore.StatusBusy, gocbcore.StatusOutOfMemory, gocbcore.StatusNotMyVBucket,
+		gocbcore.StatusInternalError:
+		return true
+	}
+	return false
+}
+
+// recordKvError counts err against the vbucket of key in the error heatmap if it suggests a problem with the
+// cluster.
+func (c *Collection) recordKvError(key string, err error) {
+	if c.sb.KvErrors == nil || err == nil || !isKvHealthError(err) {
+		return
+	}
+
+	provider, providerErr := c.sb.getCachedClient().getKvProvider()
+	if providerErr != nil {
+		return
+	}
+	router, ok := provider.(interface {
+		KeyToVbucket(key []byte) uint16
+		VbucketToServer(vbID uint16, replicaIdx uint32) int
+	})
+	if !ok {
+		return
+	}
+
+	// Errors are counted against the key as stored, which is what the server hashed to a vbucket.
+	stored, keyErr := storedKey([]byte(key), c.sb.KeyPrefix, c.sb.HashLongKeys)
+	if keyErr != nil {
+		return
+	}
+
+	vbucket := router.KeyToVbucket(stored)
+	c.sb.KvErrors.record(kvErrorKey{
+		bucket:  c.sb.BucketName,
+		vbucket: vbucket,
+		server:  kvServerAddress(provider, router.VbucketToServer(vbucket, 0)),
+	}, time.Now())
+}
+
+// kvServerAddress returns the address of the server at index in the server list of the bucket of provider, or an
+// empty string if it is not known.  gocbcore does not expose the server list, but its diagnostics list the
+// connections to each server in the order of the list.
+func kvServerAddress(provider kvProvider, index int) string {
+	diagProvider, ok := provider.(interface {
+		Diagnostics() (*gocbcore.DiagnosticInfo, error)
+	})
+	if !ok || index < 0 {
+		return ""
+	}
+
+	info, err := diagProvider.Diagnostics()
+	if err != nil {
+		return ""
+	}
+
+	var servers int
+	for i, conn := range info.MemdConns {
+		if i > 0 && conn.RemoteAddr == info.MemdConns[i-1].RemoteAddr {
+			continue
+		}
+		if servers == index {
+			return conn.RemoteAddr
+		}
+		servers++
+	}
+	return ""
+}
@@ -0,0 +1,115 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type routingKvProvider struct {
+	*mocktest.KvOperator
+}
+
+func (p *routingKvProvider) KeyToVbucket(key []byte) uint16 {
+	return uint16(len(key))
+}
+
+func (p *routingKvProvider) VbucketToServer(vbID uint16, replicaIdx uint32) int {
+	return int(vbID % 2)
+}
+
+func (p *routingKvProvider) Diagnostics() (*gocbcore.DiagnosticInfo, error) {
+	return &gocbcore.DiagnosticInfo{
+		MemdConns: []gocbcore.MemdConnInfo{
+			{RemoteAddr: "10.0.0.1:11210"},
+			{RemoteAddr: "10.0.0.1:11210"},
+			{RemoteAddr: "10.0.0.2:11210"},
+			{RemoteAddr: "10.0.0.2:11210"},
+		},
+	}, nil
+}
+
+func TestKvErrorHeatmapRecordsHealthErrors(t *testing.T) {
+	provider := &routingKvProvider{&mocktest.KvOperator{
+		Err: &gocbcore.KvError{Code: gocbcore.StatusTmpFail},
+	}}
+	col := testGetCollection(t, provider)
+	col.sb.KvErrors = newKvErrorHeatmap()
+
+	for _, key := range []string{"key", "key", "keys"} {
+		_, err := col.Get(key, nil)
+		if !IsTempFailError(err) {
+			t.Fatalf("Expected temporary failure but was %v", err)
+		}
+	}
+
+	provider.Err = &gocbcore.KvError{Code: gocbcore.StatusKeyNotFound}
+	_, err := col.Get("key", nil)
+	if !IsKeyNotFoundError(err) {
+		t.Fatalf("Expected key not found but was %v", err)
+	}
+
+	heatmap := col.sb.KvErrors.summary(time.Now())
+	if len(heatmap.Buckets) != 1 {
+		t.Fatalf("Expected errors for 1 bucket but had %v", heatmap.Buckets)
+	}
+
+	bucket := heatmap.Buckets[0]
+	if bucket.BucketName != "mock" || bucket.Errors != 3 {
+		t.Fatalf("Expected 3 errors for bucket mock but had %d for %s", bucket.Errors, bucket.BucketName)
+	}
+	if len(bucket.Vbuckets) != 2 || bucket.Vbuckets[0] != (KvVbucketErrors{Vbucket: 3, Errors: 2}) ||
+		bucket.Vbuckets[1] != (KvVbucketErrors{Vbucket: 4, Errors: 1}) {
+		t.Fatalf("Expected errors to be counted per vbucket, most first, but were %v", bucket.Vbuckets)
+	}
+	if len(bucket.Servers) != 2 || bucket.Servers[0] != (KvServerErrors{Server: "10.0.0.2:11210", Errors: 2}) {
+		t.Fatalf("Expected errors to be counted per server, most first, but were %v", bucket.Servers)
+	}
+}
+
+func TestKvErrorHeatmapUsesStoredKey(t *testing.T) {
+	provider := &routingKvProvider{&mocktest.KvOperator{
+		Err: &gocbcore.KvError{Code: gocbcore.StatusTmpFail},
+	}}
+	col := testGetCollection(t, provider).WithKeyPrefix("tenant:")
+	col.sb.KvErrors = newKvErrorHeatmap()
+
+	_, err := col.Get("key", nil)
+	if !IsTempFailError(err) {
+		t.Fatalf("Expected temporary failure but was %v", err)
+	}
+
+	bucket := col.sb.KvErrors.summary(time.Now()).Buckets[0]
+	if len(bucket.Vbuckets) != 1 || bucket.Vbuckets[0].Vbucket != 10 {
+		t.Fatalf("Expected error to be counted against the vbucket of the prefixed key but was %v", bucket.Vbuckets)
+	}
+	if len(bucket.Servers) != 1 || bucket.Servers[0].Server != "10.0.0.1:11210" {
+		t.Fatalf("Expected error to be counted against the first server but was %v", bucket.Servers)
+	}
+}
+
+func TestKvErrorHeatmapForgetsOldErrors(t *testing.T) {
+	heatmap := newKvErrorHeatmap()
+	start := heatmap.started
+	key := kvErrorKey{bucket: "default", vbucket: 12, server: "10.0.0.1:11210"}
+
+	heatmap.record(key, start)
+	heatmap.record(key, start.Add(kvErrorWindow+time.Second))
+
+	counts := heatmap.counts(start.Add(kvErrorWindow + 2*time.Second))
+	if counts[key] != 2 {
+		t.Fatalf("Expected errors from the previous window to be counted but had %d", counts[key])
+	}
+
+	counts = heatmap.counts(start.Add(2*kvErrorWindow + 2*time.Second))
+	if counts[key] != 1 {
+		t.Fatalf("Expected errors from before the previous window to be forgotten but had %d", counts[key])
+	}
+
+	counts = heatmap.counts(start.Add(5 * kvErrorWindow))
+	if len(counts) != 0 {
+		t.Fatalf("Expected all errors to be forgotten but had %v", counts)
+	}
+}
@@ -0,0 +1,231 @@
+package gocb
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// maxKeyLength is the longest key, in bytes, that the server accepts.
+const maxKeyLength = 250
+
+// normalizeKey validates key, returning ErrInvalidArgument if it is empty, contains control characters or is
+// too long.  When hashLong is set keys which are too long are instead shortened to a prefix of the key followed
+// by the SHA1 hash of the whole key, which keeps them unique.
+func normalizeKey(key []byte, hashLong bool) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, errors.Wrap(ErrInvalidArgument, "key must not be empty")
+	}
+
+	for _, r := range string(key) {
+		if unicode.IsControl(r) {
+			return nil, errors.Wrapf(ErrInvalidArgument, "key %q must not contain control characters", key)
+		}
+	}
+
+	if len(key) <= maxKeyLength {
+		return key, nil
+	}
+
+	if !hashLong {
+		return nil, errors.Wrapf(ErrInvalidArgument, "key is %d bytes long, the maximum is %d", len(key), maxKeyLength)
+	}
+
+	hash := sha1.Sum(key)
+	suffix := "#" + hex.EncodeToString(hash[:])
+
+	// Never split a multi-byte character when cutting the key down to its prefix.
+	prefixLen := maxKeyLength - len(suffix)
+	for prefixLen > 0 && !utf8.RuneStart(key[prefixLen]) {
+		prefixLen--
+	}
+
+	hashed := make([]byte, 0, prefixLen+len(suffix))
+	hashed = append(hashed, key[:prefixLen]...)
+	return append(hashed, suffix...), nil
+}
+
+// storedKey returns the key which key is stored under, prefix followed by key, normalized by normalizeKey.
+func storedKey(key []byte, prefix string, hashLong bool) ([]byte, error) {
+	if len(key) > 0 && prefix != "" {
+		prefixed := make([]byte, 0, len(prefix)+len(key))
+		prefixed = append(prefixed, prefix...)
+		key = append(prefixed, key...)
+	}
+
+	return normalizeKey(key, hashLong)
+}
+
+// keyCheckingProvider adds the key prefix to, and normalizes, the key of each operation before it is dispatched,
+// failing the dispatch if the key is invalid.
+type keyCheckingProvider struct {
+	kvProvider
+	prefix   string
+	hashLong bool
+}
+
+func (p *keyCheckingProvider) AddEx(opts gocbcore.AddOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.AddEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.SetEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.ReplaceEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.GetEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) GetReplicaEx(opts gocbcore.GetReplicaOptions, cb gocbcore.GetReplicaExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.GetReplicaEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) GetMetaEx(opts gocbcore.GetMetaOptions, cb gocbcore.GetMetaExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.GetMetaEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) ObserveEx(opts gocbcore.ObserveOptions, cb gocbcore.ObserveExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.ObserveEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.DeleteEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) LookupInEx(opts gocbcore.LookupInOptions, cb gocbcore.LookupInExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.LookupInEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) MutateInEx(opts gocbcore.MutateInOptions, cb gocbcore.MutateInExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.MutateInEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) GetAndTouchEx(opts gocbcore.GetAndTouchOptions, cb gocbcore.GetAndTouchExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.GetAndTouchEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) GetAndLockEx(opts gocbcore.GetAndLockOptions, cb gocbcore.GetAndLockExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.GetAndLockEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) UnlockEx(opts gocbcore.UnlockOptions, cb gocbcore.UnlockExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.UnlockEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) TouchEx(opts gocbcore.TouchOptions, cb gocbcore.TouchExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.TouchEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) IncrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.IncrementEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) DecrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.DecrementEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) AppendEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.AppendEx(opts, cb)
+}
+
+func (p *keyCheckingProvider) PrependEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	key, err := storedKey(opts.Key, p.prefix, p.hashLong)
+	if err != nil {
+		return nil, err
+	}
+	opts.Key = key
+	return p.kvProvider.PrependEx(opts, cb)
+}
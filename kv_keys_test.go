@@ -0,0 +1,121 @@
+package gocb
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestNormalizeKey(t *testing.T) {
+	for _, key := range []string{"", "a\nb", "tab\tkey", "nul\x00", strings.Repeat("k", 251)} {
+		_, err := normalizeKey([]byte(key), false)
+		if errors.Cause(err) != ErrInvalidArgument {
+			t.Fatalf("Expected key %q to be invalid but error was %v", key, err)
+		}
+	}
+
+	for _, key := range []string{"a", "beer::1", "ünïcödé", strings.Repeat("k", 250)} {
+		normalized, err := normalizeKey([]byte(key), true)
+		if err != nil {
+			t.Fatalf("Expected key %q to be valid but was %v", key, err)
+		}
+		if string(normalized) != key {
+			t.Fatalf("Expected valid key %q to be unchanged but was %q", key, normalized)
+		}
+	}
+
+	long := strings.Repeat("é", 200)
+	hashed, err := normalizeKey([]byte(long), true)
+	if err != nil {
+		t.Fatalf("Expected long key to be hashed but was %v", err)
+	}
+	if len(hashed) > maxKeyLength || !utf8.Valid(hashed) || !strings.HasPrefix(long, strings.Split(string(hashed), "#")[0]) {
+		t.Fatalf("Expected hashed key to be a valid shortened key but was %q", hashed)
+	}
+
+	other, _ := normalizeKey([]byte(long+"x"), true)
+	if string(other) == string(hashed) {
+		t.Fatalf("Expected different long keys to hash to different keys")
+	}
+}
+
+type keyRecordingProvider struct {
+	*mocktest.KvOperator
+	keys []string
+}
+
+func (p *keyRecordingProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	p.keys = append(p.keys, string(opts.Key))
+	return p.KvOperator.SetEx(opts, cb)
+}
+
+func TestCollectionKeyValidation(t *testing.T) {
+	provider := &keyRecordingProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1)}}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Upsert("", "value", nil)
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected empty key to be rejected but error was %v", err)
+	}
+
+	long := strings.Repeat("k", 300)
+	_, err = col.Upsert(long, "value", nil)
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected long key to be rejected but error was %v", err)
+	}
+	if len(provider.keys) != 0 {
+		t.Fatalf("Expected invalid keys not to be sent but %d were", len(provider.keys))
+	}
+
+	col.sb = col.sb.withHashLongKeys(true)
+	_, err = col.Upsert(long, "value", nil)
+	if err != nil {
+		t.Fatalf("Expected long key to be hashed but error was %v", err)
+	}
+	if len(provider.keys) != 1 || len(provider.keys[0]) != maxKeyLength {
+		t.Fatalf("Expected a hashed key to be sent but was %v", provider.keys)
+	}
+}
+
+func (p *keyRecordingProvider) GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error) {
+	p.keys = append(p.keys, string(opts.Key))
+	return p.KvOperator.GetEx(opts, cb)
+}
+
+func TestCollectionWithKeyPrefix(t *testing.T) {
+	provider := &keyRecordingProvider{KvOperator: &mocktest.KvOperator{Cas: gocbcore.Cas(1), Value: []byte(`"value"`)}}
+	col := testGetCollection(t, provider)
+	tenant := col.WithKeyPrefix("tenant42::")
+
+	_, err := tenant.Upsert("key", "value", nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+
+	res, err := tenant.WithKeyPrefix("users::").Get("key", nil)
+	if err != nil {
+		t.Fatalf("Expected get to succeed but error was %v", err)
+	}
+	if res.id != "key" {
+		t.Fatalf("Expected result key without the prefix but was %s", res.id)
+	}
+
+	_, err = col.Upsert("key", "value", nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed but error was %v", err)
+	}
+
+	expected := []string{"tenant42::key", "tenant42::users::key", "key"}
+	if strings.Join(provider.keys, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected keys %v but were %v", expected, provider.keys)
+	}
+
+	_, err = tenant.Upsert("", "value", nil)
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected empty key to be rejected but error was %v", err)
+	}
+}
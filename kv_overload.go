@@ -0,0 +1,207 @@
+package gocb
+
+import (
+	"context"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// OverloadBehavior controls what happens when a key value operation is dispatched whilst the queues of the
+// connections it would be sent on are full.
+type OverloadBehavior int
+
+const (
+	// OverloadFailFast fails the operation immediately with ErrOverload, allowing the application to shed load.
+	OverloadFailFast = OverloadBehavior(0)
+
+	// OverloadWait waits for space in the queues, up to ClusterOptions.OverloadMaxWait, before failing the
+	// operation with ErrOverload.
+	OverloadWait = OverloadBehavior(1)
+)
+
+const (
+	defaultOverloadMaxWait   = 1 * time.Second
+	overloadInitialBackoff   = 1 * time.Millisecond
+	overloadMaxBackoffPeriod = 50 * time.Millisecond
+)
+
+// overloadWaitingProvider retries the dispatch of operations which fail because the queues are full.  The wait is
+// bounded by maxWait, and by ctx, the context of the operation being dispatched, see withContext.
+type overloadWaitingProvider struct {
+	kvProvider
+	maxWait time.Duration
+	ctx     context.Context
+}
+
+func newOverloadWaitingProvider(provider kvProvider, maxWait time.Duration) *overloadWaitingProvider {
+	if maxWait <= 0 {
+		maxWait = defaultOverloadMaxWait
+	}
+
+	return &overloadWaitingProvider{
+		kvProvider: provider,
+		maxWait:    maxWait,
+	}
+}
+
+// withContext returns a copy of the provider which stops waiting to dispatch operations once ctx is done.
+func (p *overloadWaitingProvider) withContext(ctx context.Context) *overloadWaitingProvider {
+	n := *p
+	n.ctx = ctx
+	return &n
+}
+
+func (p *overloadWaitingProvider) dispatch(fn func() (gocbcore.PendingOp, error)) (gocbcore.PendingOp, error) {
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	deadline := time.Now().Add(p.maxWait)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	backoff := overloadInitialBackoff
+	for {
+		op, err := fn()
+		if err != gocbcore.ErrOverload {
+			return op, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, err
+		}
+
+		if backoff > remaining {
+			backoff = remaining
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+
+		backoff *= 2
+		if backoff > overloadMaxBackoffPeriod {
+			backoff = overloadMaxBackoffPeriod
+		}
+	}
+}
+
+func (p *overloadWaitingProvider) AddEx(opts gocbcore.AddOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.AddEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.SetEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.ReplaceEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.GetEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) GetReplicaEx(opts gocbcore.GetReplicaOptions, cb gocbcore.GetReplicaExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.GetReplicaEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) GetMetaEx(opts gocbcore.GetMetaOptions, cb gocbcore.GetMetaExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.GetMetaEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) ObserveEx(opts gocbcore.ObserveOptions, cb gocbcore.ObserveExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.ObserveEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) ObserveVbEx(opts gocbcore.ObserveVbOptions, cb gocbcore.ObserveVbExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.ObserveVbEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.DeleteEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) LookupInEx(opts gocbcore.LookupInOptions, cb gocbcore.LookupInExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.LookupInEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) MutateInEx(opts gocbcore.MutateInOptions, cb gocbcore.MutateInExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.MutateInEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) GetAndTouchEx(opts gocbcore.GetAndTouchOptions, cb gocbcore.GetAndTouchExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.GetAndTouchEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) GetAndLockEx(opts gocbcore.GetAndLockOptions, cb gocbcore.GetAndLockExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.GetAndLockEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) UnlockEx(opts gocbcore.UnlockOptions, cb gocbcore.UnlockExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.UnlockEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) TouchEx(opts gocbcore.TouchOptions, cb gocbcore.TouchExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.TouchEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) IncrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.IncrementEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) DecrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.DecrementEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) AppendEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.AppendEx(opts, cb)
+	})
+}
+
+func (p *overloadWaitingProvider) PrependEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	return p.dispatch(func() (gocbcore.PendingOp, error) {
+		return p.kvProvider.PrependEx(opts, cb)
+	})
+}
@@ -0,0 +1,104 @@
+package gocb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type overloadedKvOperator struct {
+	mocktest.KvOperator
+	overloads int
+	attempts  int
+}
+
+func (o *overloadedKvOperator) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	o.attempts++
+	if o.attempts <= o.overloads {
+		return nil, gocbcore.ErrOverload
+	}
+
+	return o.KvOperator.SetEx(opts, cb)
+}
+
+func TestOverloadFailFast(t *testing.T) {
+	provider := &overloadedKvOperator{overloads: 1}
+	col := testGetCollection(t, provider)
+
+	_, err := col.Upsert("key", "value", nil)
+	if !IsOverloadError(err) {
+		t.Fatalf("Expected overload error but was %v", err)
+	}
+
+	if IsTimeoutError(err) {
+		t.Fatalf("Expected overload error to not be a timeout")
+	}
+
+	if provider.attempts != 1 {
+		t.Fatalf("Expected a single attempt but was %d", provider.attempts)
+	}
+}
+
+func TestOverloadWait(t *testing.T) {
+	provider := &overloadedKvOperator{
+		KvOperator: mocktest.KvOperator{Cas: gocbcore.Cas(1)},
+		overloads:  3,
+	}
+	waitingProvider := newOverloadWaitingProvider(provider, time.Second)
+
+	col := testGetCollection(t, waitingProvider)
+
+	res, err := col.Upsert("key", "value", nil)
+	if err != nil {
+		t.Fatalf("Expected upsert to succeed once the queue had space but was %v", err)
+	}
+	if res.Cas() != Cas(1) {
+		t.Fatalf("Expected cas to be 1 but was %d", res.Cas())
+	}
+	if provider.attempts != 4 {
+		t.Fatalf("Expected 4 attempts but was %d", provider.attempts)
+	}
+
+	provider.attempts = 0
+	provider.overloads = 1000
+	waitingProvider.maxWait = 20 * time.Millisecond
+	_, err = col.Upsert("key", "value", nil)
+	if !IsOverloadError(err) {
+		t.Fatalf("Expected overload error after waiting but was %v", err)
+	}
+
+	// The wait ends when the context of the operation is done.
+	provider.attempts = 0
+	waitingProvider.maxWait = time.Minute
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	_, err = col.Upsert("key", "value", &UpsertOptions{Context: ctx})
+	if !IsOverloadError(err) {
+		t.Fatalf("Expected overload error after the context was cancelled but was %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("Expected the wait to end with the context but took %s", elapsed)
+	}
+
+	provider.attempts = 0
+	start = time.Now()
+	_, err = col.Upsert("key", "value", &UpsertOptions{Timeout: 20 * time.Millisecond})
+	if !IsOverloadError(err) || time.Since(start) > 10*time.Second {
+		t.Fatalf("Expected overload error at the deadline of the operation but was %v", err)
+	}
+}
+
+func TestIsOverloadError(t *testing.T) {
+	if !IsOverloadError(errors.Wrap(ErrOverload, "context")) {
+		t.Fatalf("Expected wrapped ErrOverload to be an overload error")
+	}
+
+	if IsOverloadError(timeoutError{}) {
+		t.Fatalf("Expected timeout to not be an overload error")
+	}
+}
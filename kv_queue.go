@@ -0,0 +1,136 @@
+package gocb
+
+import (
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+// kvQueueDurationTag is the tag, set on the span of each KV request, holding the time that the request spent
+// queued on the client before it was written to the network.  Comparing it with the server_duration tag shows
+// whether slow requests are caused by the client being saturated or by the server.
+const kvQueueDurationTag = "queue_duration"
+
+// kvNetSpanName is the name of the span which gocbcore starts as a request is written to the network.
+const kvNetSpanName = "rpc"
+
+// kvQueueTiming identifies the operation that a request being timed belongs to.
+type kvQueueTiming struct {
+	collection *Collection
+	operation  string
+	traced     bool
+}
+
+// kvQueueSpanContext is the span context passed to gocbcore for KV operations.  gocbcore passes it back to the
+// kvQueueTracer as the parent of the spans it starts for each request, allowing the time between a request being
+// queued and being written to the network to be measured.
+type kvQueueSpanContext struct {
+	opentracing.SpanContext
+	timing *kvQueueTiming
+	// span and started are set for the span of a request, which starts as the request is queued.
+	span    opentracing.Span
+	started time.Time
+}
+
+// kvQueueSpan is the span of a request, its context carries the queue timing to the spans started beneath it.
+type kvQueueSpan struct {
+	opentracing.Span
+	ctx kvQueueSpanContext
+}
+
+func (s *kvQueueSpan) Context() opentracing.SpanContext {
+	return s.ctx
+}
+
+// kvQueueTracer is the tracer used by gocbcore.  It measures how long requests spend queued on the client and
+// starts all spans using the global tracer, or a no-op tracer for operations which are not traced.
+type kvQueueTracer struct{}
+
+func (t kvQueueTracer) StartSpan(operationName string, opts ...opentracing.StartSpanOption) opentracing.Span {
+	var spanOpts opentracing.StartSpanOptions
+	for _, opt := range opts {
+		opt.Apply(&spanOpts)
+	}
+
+	var parent *kvQueueSpanContext
+	for i, ref := range spanOpts.References {
+		if ctx, ok := ref.ReferencedContext.(kvQueueSpanContext); ok {
+			parent = &ctx
+			spanOpts.References[i].ReferencedContext = ctx.SpanContext
+		}
+	}
+	if parent == nil {
+		return opentracing.GlobalTracer().StartSpan(operationName, opts...)
+	}
+
+	var tracer opentracing.Tracer = opentracing.NoopTracer{}
+	if parent.timing.traced {
+		tracer = opentracing.GlobalTracer()
+	}
+	span := tracer.StartSpan(operationName, kvQueueStartSpanOptions(spanOpts))
+
+	if operationName == kvNetSpanName {
+		if parent.span != nil {
+			parent.timing.recordQueueDuration(parent.span, time.Since(parent.started))
+		}
+		return span
+	}
+
+	return &kvQueueSpan{
+		Span: span,
+		ctx: kvQueueSpanContext{
+			SpanContext: span.Context(),
+			timing:      parent.timing,
+			span:        span,
+			started:     time.Now(),
+		},
+	}
+}
+
+func (t kvQueueTracer) Inject(sm opentracing.SpanContext, format interface{}, carrier interface{}) error {
+	if ctx, ok := sm.(kvQueueSpanContext); ok {
+		sm = ctx.SpanContext
+	}
+	return opentracing.GlobalTracer().Inject(sm, format, carrier)
+}
+
+func (t kvQueueTracer) Extract(format interface{}, carrier interface{}) (opentracing.SpanContext, error) {
+	return opentracing.GlobalTracer().Extract(format, carrier)
+}
+
+// kvQueueStartSpanOptions applies start span options which have already been resolved.
+type kvQueueStartSpanOptions opentracing.StartSpanOptions
+
+func (opts kvQueueStartSpanOptions) Apply(o *opentracing.StartSpanOptions) {
+	*o = opentracing.StartSpanOptions(opts)
+}
+
+func (timing *kvQueueTiming) recordQueueDuration(span opentracing.Span, duration time.Duration) {
+	span.SetTag(kvQueueDurationTag, duration)
+
+	if recorder, ok := timing.collection.sb.MetricsRecorder.(QueueDurationRecorder); ok {
+		recorder.RecordQueueDuration(timing.collection.metricLabels(timing.operation), duration)
+	}
+}
+
+// kvTraceContext returns the trace context to pass to gocbcore for operation, through which the time that its
+// requests spend queued on the client is recorded.  It is nil for untraced operations so that gocbcore also
+// skips creating spans, unless queue durations are being recorded as metrics.
+func (c *Collection) kvTraceContext(traceCtx opentracing.SpanContext, operation string) opentracing.SpanContext {
+	traced := !isUntraced(traceCtx) && traceCtx != nil
+	if !traced {
+		if _, ok := c.sb.MetricsRecorder.(QueueDurationRecorder); !ok {
+			return nil
+		}
+		traceCtx = opentracing.NoopTracer{}.StartSpan("").Context()
+	}
+
+	return kvQueueSpanContext{
+		SpanContext: traceCtx,
+		timing: &kvQueueTiming{
+			collection: c,
+			operation:  operation,
+			traced:     traced,
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	gocbcore "gopkg.in/couchbase/gocbcore.v7"
+
+	"github.com/couchbase/gocb/mocktest"
+)
+
+// queueingKvOperator starts spans for a get as gocbcore does, with the request queued for queueTime between
+// the span of the request being started and it being written to the network.
+type queueingKvOperator struct {
+	*mocktest.KvOperator
+	queueTime time.Duration
+}
+
+func (p *queueingKvOperator) GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error) {
+	if opts.TraceContext != nil {
+		tracer := kvQueueTracer{}
+		cmdSpan := tracer.StartSpan("Get", opentracing.ChildOf(opts.TraceContext))
+		time.Sleep(p.queueTime)
+		tracer.StartSpan(kvNetSpanName, opentracing.ChildOf(cmdSpan.Context())).Finish()
+		cmdSpan.Finish()
+	}
+
+	return p.KvOperator.GetEx(opts, cb)
+}
+
+func TestKvQueueDuration(t *testing.T) {
+	provider := &queueingKvOperator{
+		KvOperator: &mocktest.KvOperator{
+			Cas:      gocbcore.Cas(1),
+			Datatype: 1,
+			Value:    []byte(`{}`),
+		},
+		queueTime: 10 * time.Millisecond,
+	}
+	col := testGetCollection(t, provider)
+
+	metrics := NewCollectionMetrics()
+	col.sb.MetricsRecorder = metrics
+
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	_, err := col.Get("queued", nil)
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	var cmdSpan *mocktracer.MockSpan
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == "Get" && span.ParentID != 0 {
+			if _, ok := span.Tag(kvQueueDurationTag).(time.Duration); ok {
+				cmdSpan = span
+			}
+		}
+	}
+	if cmdSpan == nil {
+		t.Fatalf("Expected request span to be tagged with its queue duration")
+	}
+	if cmdSpan.Tag(kvQueueDurationTag).(time.Duration) < provider.queueTime {
+		t.Fatalf("Expected queue duration of at least %s but was %s", provider.queueTime,
+			cmdSpan.Tag(kvQueueDurationTag))
+	}
+
+	// Queue durations are still recorded as metrics for operations which are not traced.
+	_, err = col.Get("queued", &GetOptions{Tracing: TracingDisabled()})
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].QueuedCount != 2 {
+		t.Fatalf("Expected 2 queue durations to be recorded but was %v", snapshot)
+	}
+	if snapshot[0].MaxQueueDuration < provider.queueTime || snapshot[0].QueueDuration < 2*provider.queueTime {
+		t.Fatalf("Expected queue durations of at least %s but were %v", provider.queueTime, snapshot[0])
+	}
+}
@@ -0,0 +1,223 @@
+package gocb
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MetricLabels identifies the collection and operation that a document metric was recorded for.
+type MetricLabels struct {
+	BucketName     string
+	ScopeName      string
+	CollectionName string
+	// Keyspace identifies the collection as bucket.scope.collection, or is the name given to the collection with
+	// Collection.WithObservabilityName.  It is also set as the couchbase.keyspace tag of the operation's span.
+	Keyspace  string
+	Operation string
+}
+
+// MetricsRecorder receives client side measurements of the documents read from and written to collections.
+// Implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	// RecordDocumentWrite is called with the encoded size, in bytes, of each document successfully written.
+	RecordDocumentWrite(labels MetricLabels, size int)
+	// RecordDocumentRead is called with the encoded size, in bytes, of each document successfully read.
+	RecordDocumentRead(labels MetricLabels, size int)
+}
+
+// QueueDurationRecorder can be implemented by a MetricsRecorder to also receive the time that each KV request
+// spends queued on the client before it is written to the network.  Long queue durations show that the client,
+// rather than the server, is saturated.  Implementations must be safe for concurrent use.
+type QueueDurationRecorder interface {
+	RecordQueueDuration(labels MetricLabels, duration time.Duration)
+}
+
+// CollectionSizeMetrics holds the aggregated document metrics for a single collection.
+type CollectionSizeMetrics struct {
+	BucketName     string
+	ScopeName      string
+	CollectionName string
+	Keyspace       string
+	ReadCount      uint64
+	ReadBytes      uint64
+	WriteCount     uint64
+	WriteBytes     uint64
+	// QueuedCount is the number of KV requests whose queue duration was recorded, QueueDuration is the total
+	// time that they spent queued on the client and MaxQueueDuration the longest time any of them did.
+	QueuedCount      uint64
+	QueueDuration    time.Duration
+	MaxQueueDuration time.Duration
+	// CompressionCount is the number of values written which were considered for compression, of which
+	// CompressedCount were sent compressed.  CompressionRawBytes and CompressionCompressedBytes are the total
+	// sizes of those values before and after compressing them.
+	CompressionCount           uint64
+	CompressedCount            uint64
+	CompressionRawBytes        uint64
+	CompressionCompressedBytes uint64
+}
+
+// CompressionRatio returns the average size of the values considered for compression after compressing them,
+// as a fraction of their raw size.  The lower the ratio the more compression is helping, a ratio close to 1
+// means that it is costing CPU time for little benefit.  It is 0 if no values were considered.
+func (m CollectionSizeMetrics) CompressionRatio() float64 {
+	if m.CompressionRawBytes == 0 {
+		return 0
+	}
+	return float64(m.CompressionCompressedBytes) / float64(m.CompressionRawBytes)
+}
+
+type collectionMetricsKey struct {
+	bucketName     string
+	scopeName      string
+	collectionName string
+	keyspace       string
+}
+
+// CollectionMetrics is a MetricsRecorder which aggregates item counts and document sizes per collection.
+type CollectionMetrics struct {
+	lock        sync.Mutex
+	collections map[collectionMetricsKey]*CollectionSizeMetrics
+}
+
+// NewCollectionMetrics returns a new, empty, CollectionMetrics.
+func NewCollectionMetrics() *CollectionMetrics {
+	return &CollectionMetrics{
+		collections: make(map[collectionMetricsKey]*CollectionSizeMetrics),
+	}
+}
+
+func (m *CollectionMetrics) collectionLocked(labels MetricLabels) *CollectionSizeMetrics {
+	key := collectionMetricsKey{
+		bucketName:     labels.BucketName,
+		scopeName:      labels.ScopeName,
+		collectionName: labels.CollectionName,
+		keyspace:       labels.Keyspace,
+	}
+
+	metrics, ok := m.collections[key]
+	if !ok {
+		metrics = &CollectionSizeMetrics{
+			BucketName:     labels.BucketName,
+			ScopeName:      labels.ScopeName,
+			CollectionName: labels.CollectionName,
+			Keyspace:       labels.Keyspace,
+		}
+		m.collections[key] = metrics
+	}
+
+	return metrics
+}
+
+// RecordDocumentWrite records the size of a document written to a collection.
+func (m *CollectionMetrics) RecordDocumentWrite(labels MetricLabels, size int) {
+	m.lock.Lock()
+	metrics := m.collectionLocked(labels)
+	metrics.WriteCount++
+	metrics.WriteBytes += uint64(size)
+	m.lock.Unlock()
+}
+
+// RecordDocumentRead records the size of a document read from a collection.
+func (m *CollectionMetrics) RecordDocumentRead(labels MetricLabels, size int) {
+	m.lock.Lock()
+	metrics := m.collectionLocked(labels)
+	metrics.ReadCount++
+	metrics.ReadBytes += uint64(size)
+	m.lock.Unlock()
+}
+
+// RecordQueueDuration records the time that a KV request against a collection spent queued on the client.
+func (m *CollectionMetrics) RecordQueueDuration(labels MetricLabels, duration time.Duration) {
+	m.lock.Lock()
+	metrics := m.collectionLocked(labels)
+	metrics.QueuedCount++
+	metrics.QueueDuration += duration
+	if duration > metrics.MaxQueueDuration {
+		metrics.MaxQueueDuration = duration
+	}
+	m.lock.Unlock()
+}
+
+// RecordCompression records the raw and compressed sizes of a value written to a collection.
+func (m *CollectionMetrics) RecordCompression(labels MetricLabels, rawSize, compressedSize int, compressed bool) {
+	m.lock.Lock()
+	metrics := m.collectionLocked(labels)
+	metrics.CompressionCount++
+	if compressed {
+		metrics.CompressedCount++
+	}
+	metrics.CompressionRawBytes += uint64(rawSize)
+	metrics.CompressionCompressedBytes += uint64(compressedSize)
+	m.lock.Unlock()
+}
+
+// Snapshot returns a copy of the metrics recorded so far, ordered by bucket, scope and collection name, then by
+// keyspace for collections given different names with Collection.WithObservabilityName.
+func (m *CollectionMetrics) Snapshot() []CollectionSizeMetrics {
+	m.lock.Lock()
+	snapshot := make([]CollectionSizeMetrics, 0, len(m.collections))
+	for _, metrics := range m.collections {
+		snapshot = append(snapshot, *metrics)
+	}
+	m.lock.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].BucketName != snapshot[j].BucketName {
+			return snapshot[i].BucketName < snapshot[j].BucketName
+		}
+		if snapshot[i].ScopeName != snapshot[j].ScopeName {
+			return snapshot[i].ScopeName < snapshot[j].ScopeName
+		}
+		if snapshot[i].CollectionName != snapshot[j].CollectionName {
+			return snapshot[i].CollectionName < snapshot[j].CollectionName
+		}
+		return snapshot[i].Keyspace < snapshot[j].Keyspace
+	})
+
+	return snapshot
+}
+
+func (c *Collection) metricLabels(operation string) MetricLabels {
+	return MetricLabels{
+		BucketName:     c.sb.BucketName,
+		ScopeName:      c.sb.ScopeName,
+		CollectionName: c.sb.CollectionName,
+		Keyspace:       c.keyspaceLabel(),
+		Operation:      operation,
+	}
+}
+
+// keyspaceLabel returns the name identifying the collection in spans and metrics, bucket.scope.collection unless
+// the collection has been given another name with WithObservabilityName.
+func (c *Collection) keyspaceLabel() string {
+	if c.sb.ObservabilityName != "" {
+		return c.sb.ObservabilityName
+	}
+
+	scopeName := c.sb.ScopeName
+	if scopeName == "" {
+		scopeName = "_default"
+	}
+	collectionName := c.sb.CollectionName
+	if collectionName == "" {
+		collectionName = "_default"
+	}
+	return c.sb.BucketName + "." + scopeName + "." + collectionName
+}
+
+func (c *Collection) recordDocumentWrite(operation string, size int) {
+	if c.sb.MetricsRecorder == nil {
+		return
+	}
+
+	c.sb.MetricsRecorder.RecordDocumentWrite(c.metricLabels(operation), size)
+}
+
+func (c *Collection) recordDocumentRead(operation string, size int) {
+	if c.sb.MetricsRecorder == nil {
+		return
+	}
+
+	c.sb.MetricsRecorder.RecordDocumentRead(c.metricLabels(operation), size)
+}
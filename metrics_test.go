@@ -0,0 +1,104 @@
+package gocb
+
+import (
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	gocbcore "gopkg.in/couchbase/gocbcore.v7"
+
+	"github.com/couchbase/gocb/mocktest"
+)
+
+func TestCollectionMetricsRecordsDocumentSizes(t *testing.T) {
+	value := []byte(`{"name":"21st Amendment Brewery Cafe"}`)
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    value,
+	}
+	col := testGetCollection(t, provider)
+
+	metrics := NewCollectionMetrics()
+	col.sb.MetricsRecorder = metrics
+
+	_, err := col.Upsert("metrics", value, nil)
+	if err != nil {
+		t.Fatalf("Upsert failed, error was %v", err)
+	}
+
+	_, err = col.Get("metrics", nil)
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	_, err = col.Get("metrics", nil)
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 1 {
+		t.Fatalf("Expected metrics for 1 collection but had %d", len(snapshot))
+	}
+
+	collectionMetrics := snapshot[0]
+	if collectionMetrics.BucketName != "mock" || collectionMetrics.CollectionName != "_default" {
+		t.Fatalf("Metrics recorded against wrong collection: %v", collectionMetrics)
+	}
+
+	if collectionMetrics.WriteCount != 1 || collectionMetrics.WriteBytes != uint64(len(value)) {
+		t.Fatalf("Expected 1 write of %d bytes but was %d writes of %d bytes", len(value),
+			collectionMetrics.WriteCount, collectionMetrics.WriteBytes)
+	}
+
+	if collectionMetrics.ReadCount != 2 || collectionMetrics.ReadBytes != 2*uint64(len(value)) {
+		t.Fatalf("Expected 2 reads of %d bytes but was %d reads of %d bytes", 2*len(value),
+			collectionMetrics.ReadCount, collectionMetrics.ReadBytes)
+	}
+}
+
+func TestCollectionKeyspaceLabels(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+
+	metrics := NewCollectionMetrics()
+	col.sb.MetricsRecorder = metrics
+
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	_, err := col.Get("labelled", nil)
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	_, err = col.WithObservabilityName("checkout").Get("labelled", nil)
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	var keyspaces []interface{}
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == "Get" && span.ParentID == 0 {
+			keyspaces = append(keyspaces, span.Tag("couchbase.keyspace"))
+		}
+	}
+	if len(keyspaces) != 2 || keyspaces[0] != "mock._default._default" || keyspaces[1] != "checkout" {
+		t.Fatalf("Expected spans to be tagged with the keyspaces but were %v", keyspaces)
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("Expected metrics for 2 keyspaces but had %d", len(snapshot))
+	}
+	if snapshot[0].Keyspace != "checkout" || snapshot[1].Keyspace != "mock._default._default" {
+		t.Fatalf("Expected metrics to be recorded per keyspace but were %v", snapshot)
+	}
+}
@@ -0,0 +1,155 @@
+package gocb
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+const defaultManagementTimeout = 75 * time.Second
+
+// mgmtProvider is the provider used by the management managers.  Every request is bound to the context of the
+// manager and to a timeout, so that a slow or unresponsive management service cannot block a call indefinitely,
+// and requests which are safe to repeat are retried when they fail to be sent or the service is unavailable.
+type mgmtProvider struct {
+	httpProvider
+	ctx           context.Context
+	timeout       time.Duration
+	retryBehavior RetryBehavior
+}
+
+// newMgmtProvider wraps provider using the management timeout and retry behavior of the cluster, which may be nil
+// for managers created without one.
+func (c *Cluster) newMgmtProvider(provider httpProvider) *mgmtProvider {
+	p := &mgmtProvider{
+		httpProvider:  provider,
+		ctx:           context.Background(),
+		timeout:       defaultManagementTimeout,
+		retryBehavior: StandardDelayRetryBehavior(10, 2, 500*time.Millisecond, ExponentialDelayFunction),
+	}
+	if c == nil {
+		return p
+	}
+
+	if c.ssb.mgmtTimeout > 0 {
+		p.timeout = c.ssb.mgmtTimeout
+	}
+	if c.sb.MgmtRetryBehavior != nil {
+		p.retryBehavior = c.sb.MgmtRetryBehavior
+	}
+	return p
+}
+
+// asMgmtProvider returns provider as a mgmtProvider, wrapping it with the defaults if it is not one.
+func asMgmtProvider(provider httpProvider) *mgmtProvider {
+	if p, ok := provider.(*mgmtProvider); ok {
+		return p
+	}
+
+	var c *Cluster
+	return c.newMgmtProvider(provider)
+}
+
+func (p *mgmtProvider) withContext(ctx context.Context) *mgmtProvider {
+	newP := *p
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	newP.ctx = ctx
+	return &newP
+}
+
+func (p *mgmtProvider) withTimeout(timeout time.Duration) *mgmtProvider {
+	newP := *p
+	newP.timeout = timeout
+	return &newP
+}
+
+// isIdempotentMgmtRequest returns whether req can be sent again after failing, without risking it being
+// applied twice.
+func isIdempotentMgmtRequest(req *gocbcore.HttpRequest) bool {
+	return req.Method == "GET" || req.Method == "HEAD"
+}
+
+// isRetryableMgmtStatus returns whether the status code shows that the service, or a proxy in front of it, was
+// temporarily unable to handle the request.
+func isRetryableMgmtStatus(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusServiceUnavailable ||
+		statusCode == http.StatusGatewayTimeout
+}
+
+func (p *mgmtProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	ctx := p.ctx
+	if req.Context != nil {
+		ctx = req.Context
+	}
+	var cancel context.CancelFunc
+	if p.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+
+	var retries uint
+	for {
+		retries++
+		attempt := *req
+		attempt.Context = ctx
+
+		resp, err := p.httpProvider.DoHttpRequest(&attempt)
+		if ctx.Err() != nil {
+			cancel()
+			if resp != nil {
+				drainAndCloseHTTPBody(resp.Body)
+			}
+			if ctx.Err() == context.DeadlineExceeded {
+				return nil, timeoutError{}
+			}
+			return nil, ctx.Err()
+		}
+
+		canRetry := isIdempotentMgmtRequest(req) && p.retryBehavior != nil && p.retryBehavior.CanRetry(retries)
+		if err == nil && (!canRetry || !isRetryableMgmtStatus(resp.StatusCode)) {
+			// The context must stay alive until the body has been read, it is released when the body is closed.
+			resp.Body = &mgmtResponseBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+		if err != nil && !canRetry {
+			cancel()
+			return nil, err
+		}
+
+		if err == nil {
+			logDebugf("Retrying management request to %s after status %d", req.Path, resp.StatusCode)
+			drainAndCloseHTTPBody(resp.Body)
+		} else {
+			logDebugf("Retrying management request to %s after error (%s)", req.Path, err)
+		}
+
+		select {
+		case <-time.After(p.retryBehavior.NextInterval(retries)):
+		case <-ctx.Done():
+			err := ctx.Err()
+			cancel()
+			if err == context.DeadlineExceeded {
+				return nil, timeoutError{}
+			}
+			return nil, err
+		}
+	}
+}
+
+// mgmtResponseBody releases the context of a management request once its response body is closed.
+type mgmtResponseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *mgmtResponseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,88 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestManagementRequestRetriesIdempotentRequests(t *testing.T) {
+	var attempts int
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			attempts++
+			if req.Context == nil {
+				t.Fatalf("Expected request to have a context")
+			}
+			if attempts == 1 {
+				return nil, errors.New("connection reset")
+			}
+			if attempts == 2 {
+				return &gocbcore.HttpResponse{
+					StatusCode: 503,
+					Body:       &testReadCloser{bytes.NewBufferString("unavailable"), nil},
+				}, nil
+			}
+			return &gocbcore.HttpResponse{
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(`[{"name":"default","bucketType":"membase"}]`), nil},
+			}, nil
+		},
+	}
+
+	var cluster *Cluster
+	mgmt := cluster.newMgmtProvider(provider)
+	mgmt.retryBehavior = StandardDelayRetryBehavior(3, 1, time.Millisecond, LinearDelayFunction)
+	bm := &BucketManager{httpClient: mgmt}
+
+	buckets, err := bm.GetBuckets()
+	if err != nil {
+		t.Fatalf("Expected GetBuckets to succeed but was %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Name != "default" {
+		t.Fatalf("Expected the default bucket but was %v", buckets)
+	}
+	if attempts != 3 {
+		t.Fatalf("Expected 3 attempts but was %d", attempts)
+	}
+
+	attempts = 0
+	err = bm.RemoveBucket("default")
+	if err == nil {
+		t.Fatalf("Expected RemoveBucket to fail")
+	}
+	if attempts != 1 {
+		t.Fatalf("Expected requests which are not idempotent to be sent once but were sent %d times", attempts)
+	}
+}
+
+func TestManagementRequestTimeout(t *testing.T) {
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			<-req.Context.Done()
+			return nil, req.Context.Err()
+		},
+	}
+
+	bm := &BucketManager{httpClient: provider}
+
+	start := time.Now()
+	_, err := bm.WithTimeout(20 * time.Millisecond).GetBuckets()
+	if !IsTimeoutError(err) {
+		t.Fatalf("Expected timeout error but was %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("Expected request to time out promptly but took %s", time.Since(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = bm.WithContext(ctx).GetBuckets()
+	if err != context.Canceled {
+		t.Fatalf("Expected context canceled error but was %v", err)
+	}
+}
@@ -0,0 +1,363 @@
+// Package mocktest provides a stand-in for the key value service of a Couchbase cluster, which can be passed to
+// gocb.NewMockCluster to unit test code built on top of gocb without a live cluster.
+// VOLATILE: This API is subject to change at any time.
+package mocktest
+
+import (
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// KvOperator is a gocb.MockKvProvider which responds to every key value operation with the same configured
+// result, recording the options of the operations which it receives.  Operations are not synchronised, so a
+// KvOperator must not be used by concurrent operations whilst its fields are read or written.
+type KvOperator struct {
+	// OpWait is how long to wait before responding to each operation.
+	OpWait time.Duration
+	// Value is the value returned by reads.  Get style operations expect a []byte, counters a uint64, Observe a
+	// gocbcore.KeyState and LookupIn and MutateIn a []gocbcore.SubDocResult.
+	Value         interface{}
+	Cas           gocbcore.Cas
+	MutationToken gocbcore.MutationToken
+	Flags         uint32
+	Datatype      uint8
+	// Expiry and Deleted are returned by GetMeta, along with the sequence number of MutationToken.
+	Expiry  uint32
+	Deleted bool
+	// Err, if set, fails every operation with the given error.
+	Err error
+	// CancelSuccess is returned when a pending operation is cancelled, such as when it times out.
+	CancelSuccess bool
+	// ResultErr is returned alongside the result of LookupIn, such as gocbcore.ErrSubDocBadMulti.
+	ResultErr error
+
+	// LookupInOps and LookupInFlags are the ops and flags of the last LookupIn, MutateInOps the ops of the last
+	// MutateIn and Expiries the expiry of every Touch, Increment and Decrement.
+	LookupInOps   []gocbcore.SubDocOp
+	LookupInFlags gocbcore.SubdocDocFlag
+	MutateInOps   []gocbcore.SubDocOp
+	Expiries      []uint32
+}
+
+// PendingOp is the gocbcore.PendingOp returned by the operations of a KvOperator.
+type PendingOp struct {
+	CancelSuccess bool
+}
+
+func (mpo *PendingOp) Cancel() bool {
+	return mpo.CancelSuccess
+}
+
+func (mko *KvOperator) AddEx(opts gocbcore.AddOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.StoreResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) SetEx(opts gocbcore.SetOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.StoreResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+
+}
+
+func (mko *KvOperator) ReplaceEx(opts gocbcore.ReplaceOptions, cb gocbcore.StoreExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.StoreResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) GetEx(opts gocbcore.GetOptions, cb gocbcore.GetExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.GetResult{
+				Cas:      mko.Cas,
+				Flags:    mko.Flags,
+				Datatype: mko.Datatype,
+				Value:    mko.Value.([]byte),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) GetAndTouchEx(opts gocbcore.GetAndTouchOptions, cb gocbcore.GetAndTouchExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.GetAndTouchResult{
+				Cas:      mko.Cas,
+				Flags:    mko.Flags,
+				Datatype: mko.Datatype,
+				Value:    mko.Value.([]byte),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) GetAndLockEx(opts gocbcore.GetAndLockOptions, cb gocbcore.GetAndLockExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.GetAndLockResult{
+				Cas:      mko.Cas,
+				Flags:    mko.Flags,
+				Datatype: mko.Datatype,
+				Value:    mko.Value.([]byte),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) UnlockEx(opts gocbcore.UnlockOptions, cb gocbcore.UnlockExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.UnlockResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) TouchEx(opts gocbcore.TouchOptions, cb gocbcore.TouchExCallback) (gocbcore.PendingOp, error) {
+	mko.Expiries = append(mko.Expiries, opts.Expiry)
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.TouchResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) DeleteEx(opts gocbcore.DeleteOptions, cb gocbcore.DeleteExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.DeleteResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) IncrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	mko.Expiries = append(mko.Expiries, opts.Expiry)
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.CounterResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+				Value:         mko.Value.(uint64),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) DecrementEx(opts gocbcore.CounterOptions, cb gocbcore.CounterExCallback) (gocbcore.PendingOp, error) {
+	mko.Expiries = append(mko.Expiries, opts.Expiry)
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.CounterResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+				Value:         mko.Value.(uint64),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) AppendEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.AdjoinResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) PrependEx(opts gocbcore.AdjoinOptions, cb gocbcore.AdjoinExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.AdjoinResult{
+				Cas:           mko.Cas,
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) LookupInEx(opts gocbcore.LookupInOptions, cb gocbcore.LookupInExCallback) (gocbcore.PendingOp, error) {
+	mko.LookupInOps = opts.Ops
+	mko.LookupInFlags = opts.Flags
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.LookupInResult{
+				Cas: mko.Cas,
+				Ops: mko.Value.([]gocbcore.SubDocResult),
+			}, mko.ResultErr)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+
+}
+
+func (mko *KvOperator) MutateInEx(opts gocbcore.MutateInOptions, cb gocbcore.MutateInExCallback) (gocbcore.PendingOp, error) {
+	mko.MutateInOps = opts.Ops
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.MutateInResult{
+				Cas:           mko.Cas,
+				Ops:           mko.Value.([]gocbcore.SubDocResult),
+				MutationToken: mko.MutationToken,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) ObserveEx(opts gocbcore.ObserveOptions, cb gocbcore.ObserveExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.ObserveResult{
+				Cas:      mko.Cas,
+				KeyState: mko.Value.(gocbcore.KeyState),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) ObserveVbEx(opts gocbcore.ObserveVbOptions, cb gocbcore.ObserveVbExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.ObserveVbResult{}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) GetReplicaEx(opts gocbcore.GetReplicaOptions, cb gocbcore.GetReplicaExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			cb(&gocbcore.GetReplicaResult{
+				Cas:      mko.Cas,
+				Flags:    mko.Flags,
+				Datatype: mko.Datatype,
+				Value:    mko.Value.([]byte),
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) GetMetaEx(opts gocbcore.GetMetaOptions, cb gocbcore.GetMetaExCallback) (gocbcore.PendingOp, error) {
+	time.AfterFunc(mko.OpWait, func() {
+		if mko.Err == nil {
+			var deleted uint32
+			if mko.Deleted {
+				deleted = 1
+			}
+			cb(&gocbcore.GetMetaResult{
+				Cas:      mko.Cas,
+				Flags:    mko.Flags,
+				Datatype: mko.Datatype,
+				Expiry:   mko.Expiry,
+				SeqNo:    mko.MutationToken.SeqNo,
+				Deleted:  deleted,
+			}, nil)
+		} else {
+			cb(nil, mko.Err)
+		}
+	})
+
+	return &PendingOp{CancelSuccess: mko.CancelSuccess}, nil
+}
+
+func (mko *KvOperator) NumReplicas() int {
+	return 0
+}
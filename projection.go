@@ -0,0 +1,88 @@
+package gocb
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// projectionPathsCache holds the projection paths derived for each struct type, keyed by reflect.Type.
+var projectionPathsCache sync.Map
+
+// projectionPaths returns the top level document paths which would be decoded into the value pointed to by
+// valuePtr, derived from the json tags of its fields.  ok is false if no projection could be derived, in which
+// case the full document should be fetched.
+func projectionPaths(valuePtr interface{}) (paths []string, ok bool) {
+	typ := reflect.TypeOf(valuePtr)
+	if typ == nil || typ.Kind() != reflect.Ptr {
+		return nil, false
+	}
+	typ = typ.Elem()
+	if typ.Kind() != reflect.Struct {
+		return nil, false
+	}
+
+	if cached, found := projectionPathsCache.Load(typ); found {
+		paths = cached.([]string)
+		return paths, paths != nil
+	}
+
+	seen := make(map[string]bool)
+	if structProjectionPaths(typ, seen, &paths) {
+		// A sub-document lookup is limited to 16 paths, there's no benefit to projecting beyond that.
+		if len(paths) == 0 || len(paths) > 16 {
+			paths = nil
+		}
+	} else {
+		paths = nil
+	}
+
+	projectionPathsCache.Store(typ, paths)
+	return paths, paths != nil
+}
+
+func structProjectionPaths(typ reflect.Type, seen map[string]bool, paths *[]string) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+
+		name, _, skip := parseJSONFieldTag(field.Tag.Get("json"))
+		if skip {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			// Untagged embedded structs have their fields promoted into the parent object.
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if !structProjectionPaths(embedded, seen, paths) {
+					return false
+				}
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			// Unexported fields are never decoded into.
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		// Names which would need escaping within a sub-document path cannot be safely projected.
+		if strings.ContainsAny(name, ".[]`") {
+			return false
+		}
+
+		if !seen[name] {
+			seen[name] = true
+			*paths = append(*paths, name)
+		}
+	}
+
+	return true
+}
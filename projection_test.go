@@ -0,0 +1,90 @@
+package gocb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type testProjectionBase struct {
+	Type string `json:"type"`
+}
+
+type testProjectionDocument struct {
+	testProjectionBase
+	Name     string            `json:"name"`
+	Country  string            `json:"country,omitempty"`
+	Ignored  string            `json:"-"`
+	Untagged int               `json:",omitempty"`
+	Geo      map[string]string `json:"geo"`
+	internal string
+}
+
+func TestProjectionPaths(t *testing.T) {
+	paths, ok := projectionPaths(&testProjectionDocument{})
+	if !ok {
+		t.Fatalf("Expected projection paths to be derived")
+	}
+
+	expected := []string{"type", "name", "country", "Untagged", "geo"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("Expected paths to be %v but were %v", expected, paths)
+	}
+
+	if _, ok := projectionPaths(&map[string]interface{}{}); ok {
+		t.Fatalf("Expected no projection paths for a map")
+	}
+
+	if _, ok := projectionPaths(testProjectionDocument{}); ok {
+		t.Fatalf("Expected no projection paths for a non-pointer")
+	}
+
+	var dotted struct {
+		Name string `json:"a.b"`
+	}
+	if _, ok := projectionPaths(&dotted); ok {
+		t.Fatalf("Expected no projection paths for a field name requiring escaping")
+	}
+}
+
+func TestGetAsProjectsStructFields(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas: gocbcore.Cas(1),
+		Value: []gocbcore.SubDocResult{
+			{Value: []byte(`"brewery"`)},
+			{Value: []byte(`"21st Amendment"`)},
+			{Value: []byte(`"United States"`)},
+			{Err: gocbcore.ErrSubDocPathNotFound},
+			{Value: []byte(`{"accuracy":"ROOFTOP"}`)},
+		},
+	}
+	col := testGetCollection(t, provider)
+
+	var doc testProjectionDocument
+	res, err := col.GetAs("key", &doc, nil)
+	if err != nil {
+		t.Fatalf("GetAs encountered error: %v", err)
+	}
+
+	if res.Cas() != Cas(1) {
+		t.Fatalf("Expected cas value to be %d but was %d", Cas(1), res.Cas())
+	}
+
+	var paths []string
+	for _, op := range provider.LookupInOps {
+		paths = append(paths, op.Path)
+	}
+	expectedPaths := []string{"type", "name", "country", "Untagged", "geo"}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Fatalf("Expected lookup paths to be %v but were %v", expectedPaths, paths)
+	}
+
+	if doc.Type != "brewery" || doc.Name != "21st Amendment" || doc.Country != "United States" {
+		t.Fatalf("Document was not decoded as expected: %+v", doc)
+	}
+	if doc.Geo["accuracy"] != "ROOFTOP" {
+		t.Fatalf("Expected geo accuracy to be ROOFTOP but was %v", doc.Geo)
+	}
+}
@@ -0,0 +1,154 @@
+package gocb
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// queryCacheEntry holds the results of a query, copied so that they are not affected by reads of the results
+// that were returned to the caller.
+type queryCacheEntry struct {
+	key             string
+	rows            []json.RawMessage
+	signature       json.RawMessage
+	requestID       string
+	clientContextID string
+	metrics         QueryResultMetrics
+	warnings        []QueryWarning
+	sourceAddr      string
+	expires         time.Time
+}
+
+// queryResultCache is an in memory cache of the results of queries run with QueryOptions.CacheFor, holding up to
+// a fixed number of results and evicting the least recently used when full.
+type queryResultCache struct {
+	lock     sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+func newQueryResultCache(capacity int) *queryResultCache {
+	if capacity <= 0 {
+		return nil
+	}
+
+	return &queryResultCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// queryResultCacheKey returns the key that the results of a query run as user are cached under, derived from the
+// statement and every option sent with it other than those which differ between executions of the same query.
+// Users can have different rights to the same data, so results are never shared between them.  It returns an
+// empty string if the query cannot be cached, such as when it is part of a transaction.
+func queryResultCacheKey(user string, queryOpts map[string]interface{}) string {
+	if _, ok := queryOpts["txid"]; ok {
+		return ""
+	}
+	if _, ok := queryOpts["tximplicit"]; ok {
+		return ""
+	}
+
+	keyOpts := make(map[string]interface{}, len(queryOpts))
+	for k, v := range queryOpts {
+		if k == "timeout" || k == "client_context_id" {
+			continue
+		}
+		keyOpts[k] = v
+	}
+
+	// Map keys are marshalled in sorted order, so the same options always produce the same key.
+	keyBytes, err := json.Marshal(keyOpts)
+	if err != nil {
+		logDebugf("Failed to create query cache key (%s)", err)
+		return ""
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(user))
+	hash.Write([]byte{0})
+	hash.Write(keyBytes)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// get returns a copy of the results cached for key, if they have not expired.
+func (qc *queryResultCache) get(key string) (*QueryResults, bool) {
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	elem, ok := qc.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*queryCacheEntry)
+	if qc.now().After(entry.expires) {
+		qc.removeElementLocked(elem)
+		return nil, false
+	}
+	qc.order.MoveToFront(elem)
+
+	return &QueryResults{
+		index:           -1,
+		rows:            copyRawRows(entry.rows),
+		signature:       entry.signature,
+		requestID:       entry.requestID,
+		clientContextID: entry.clientContextID,
+		metrics:         entry.metrics,
+		warnings:        entry.warnings,
+		sourceAddr:      entry.sourceAddr,
+		cached:          true,
+	}, true
+}
+
+// set caches the results of a query for ttl.  It must be called before any of the rows have been read.
+func (qc *queryResultCache) set(key string, res *QueryResults, ttl time.Duration) {
+	entry := &queryCacheEntry{
+		key:             key,
+		rows:            copyRawRows(res.rows),
+		signature:       res.signature,
+		requestID:       res.requestID,
+		clientContextID: res.clientContextID,
+		metrics:         res.metrics,
+		warnings:        res.warnings,
+		sourceAddr:      res.sourceAddr,
+		expires:         qc.now().Add(ttl),
+	}
+
+	qc.lock.Lock()
+	defer qc.lock.Unlock()
+
+	if elem, ok := qc.entries[key]; ok {
+		elem.Value = entry
+		qc.order.MoveToFront(elem)
+		return
+	}
+
+	qc.entries[key] = qc.order.PushFront(entry)
+	for qc.order.Len() > qc.capacity {
+		qc.removeElementLocked(qc.order.Back())
+	}
+}
+
+func (qc *queryResultCache) removeElementLocked(elem *list.Element) {
+	entry := qc.order.Remove(elem).(*queryCacheEntry)
+	delete(qc.entries, entry.key)
+}
+
+// copyRawRows copies rows so that the rows returned from a cached result can be modified by the caller.
+func copyRawRows(rows []json.RawMessage) []json.RawMessage {
+	copied := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		copied[i] = append(json.RawMessage(nil), row...)
+	}
+	return copied
+}
@@ -0,0 +1,98 @@
+package gocb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestQueryResultCache(t *testing.T) {
+	var requests int
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			requests++
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body: &testReadCloser{bytes.NewBufferString(
+					`{"requestID":"req-1","results":[{"a":1},{"a":2}],"status":"success"}`), nil},
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	now := time.Now()
+	cluster.queryResults = newQueryResultCache(2)
+	cluster.queryResults.now = func() time.Time { return now }
+
+	query := func(statement string, opts *QueryOptions) *QueryResults {
+		res, err := cluster.Query(statement, opts)
+		if err != nil {
+			t.Fatalf("Expected query to succeed but was %v", err)
+		}
+		var rows []map[string]int
+		var row map[string]int
+		for res.Next(&row) {
+			rows = append(rows, row)
+			row = nil
+		}
+		if err := res.Close(); err != nil {
+			t.Fatalf("Expected results to be read but was %v", err)
+		}
+		if len(rows) != 2 || rows[1]["a"] != 2 {
+			t.Fatalf("Expected 2 rows but were %v", rows)
+		}
+		return res
+	}
+
+	opts := &QueryOptions{CacheFor: time.Minute, PositionalParameters: []interface{}{1}}
+	if query("SELECT a FROM t WHERE b=$1", opts).Cached() {
+		t.Fatalf("Expected first results not to be cached")
+	}
+	res := query("SELECT a FROM t WHERE b=$1", opts)
+	if !res.Cached() || res.RequestID() != "req-1" {
+		t.Fatalf("Expected second results to be served from the cache")
+	}
+	if requests != 1 {
+		t.Fatalf("Expected 1 request but were %d", requests)
+	}
+
+	// Different parameters, and queries run without CacheFor, are not served from the cache.
+	query("SELECT a FROM t WHERE b=$1", &QueryOptions{CacheFor: time.Minute, PositionalParameters: []interface{}{2}})
+	query("SELECT a FROM t WHERE b=$1", &QueryOptions{PositionalParameters: []interface{}{1}})
+	if requests != 3 {
+		t.Fatalf("Expected 3 requests but were %d", requests)
+	}
+
+	// Results cached for one user are not served to another.
+	cluster.auth = PasswordAuthenticator{Username: "bob", Password: "password"}
+	query("SELECT a FROM t WHERE b=$1", opts)
+	if requests != 4 {
+		t.Fatalf("Expected 4 requests but were %d", requests)
+	}
+	cluster.auth = nil
+
+	// Results expire after the ttl.
+	now = now.Add(2 * time.Minute)
+	query("SELECT a FROM t WHERE b=$1", opts)
+	if requests != 5 {
+		t.Fatalf("Expected 5 requests but were %d", requests)
+	}
+
+	// The least recently used results are evicted when the cache is full.
+	query("SELECT 1", &QueryOptions{CacheFor: time.Minute})
+	query("SELECT 2", &QueryOptions{CacheFor: time.Minute})
+	query("SELECT a FROM t WHERE b=$1", opts)
+	if requests != 8 {
+		t.Fatalf("Expected 8 requests but were %d", requests)
+	}
+
+	// Results with more rows than can be buffered are not served from the cache.
+	query("SELECT 2", &QueryOptions{CacheFor: time.Minute})
+	_, err := cluster.Query("SELECT 2", &QueryOptions{CacheFor: time.Minute, MaxBufferedRows: 1})
+	if err == nil || requests != 9 {
+		t.Fatalf("Expected query to be sent and fail with too many rows but was %v after %d requests", err, requests)
+	}
+}
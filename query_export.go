@@ -0,0 +1,211 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ExportFormat is the format in which query rows are written by QueryResults.Export.
+type ExportFormat int
+
+const (
+	// ExportNDJSON writes each row as a line of JSON.
+	ExportNDJSON = ExportFormat(0)
+
+	// ExportCSV writes the rows as CSV, with a header of the column names.  The columns are the fields of the first
+	// row, in the order returned by the server.  Nested objects are flattened into a column for each of their
+	// fields named by the dot separated path to it, e.g. "address.city".  Strings are written without quotes,
+	// nulls and fields missing from a row are written as empty cells and arrays are written as JSON.  Rows which
+	// are not objects, such as those of SELECT RAW queries, are written to a single column named "value".  If a
+	// later row has a field which is not a column then ErrExportColumnsChanged is returned.
+	ExportCSV = ExportFormat(1)
+)
+
+// WriteTo writes the remaining rows to w as NDJSON, see Export.
+func (r *QueryResults) WriteTo(w io.Writer) (int64, error) {
+	return r.Export(w, ExportNDJSON)
+}
+
+// Export writes the remaining rows to w in format, one row at a time, and then closes the results.  It returns
+// the number of bytes written.  This allows the results of a query to be served from an export endpoint, or saved
+// by a tool, without the rows being decoded.
+func (r *QueryResults) Export(w io.Writer, format ExportFormat) (int64, error) {
+	cw := &countingWriter{w: w}
+
+	var err error
+	switch format {
+	case ExportNDJSON:
+		err = r.exportNDJSON(cw)
+	case ExportCSV:
+		err = r.exportCSV(cw)
+	default:
+		err = errors.Wrapf(ErrInvalidArgument, "unknown export format %d", format)
+	}
+	if err != nil {
+		r.Close()
+		return cw.n, err
+	}
+
+	return cw.n, r.Close()
+}
+
+func (r *QueryResults) exportNDJSON(w io.Writer) error {
+	var line bytes.Buffer
+	for row := r.NextBytes(); row != nil; row = r.NextBytes() {
+		line.Reset()
+		err := json.Compact(&line, row)
+		if err != nil {
+			return err
+		}
+		line.WriteByte('\n')
+
+		_, err = w.Write(line.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *QueryResults) exportCSV(w io.Writer) error {
+	csvWriter := csv.NewWriter(w)
+
+	var columns []string
+	var columnSet map[string]bool
+	var record []string
+	for row := r.NextBytes(); row != nil; row = r.NextBytes() {
+		rowColumns, values, err := flattenRow(row)
+		if err != nil {
+			return err
+		}
+
+		if columns == nil {
+			columns = rowColumns
+			columnSet = make(map[string]bool, len(columns))
+			for _, column := range columns {
+				columnSet[column] = true
+			}
+			record = make([]string, len(columns))
+			err = csvWriter.Write(columns)
+			if err != nil {
+				return err
+			}
+		} else {
+			for _, column := range rowColumns {
+				if !columnSet[column] {
+					return errors.Wrapf(ErrExportColumnsChanged, "row %d has column %s", r.index, column)
+				}
+			}
+		}
+
+		for i, column := range columns {
+			record[i] = values[column]
+		}
+		err = csvWriter.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// flattenRow returns the columns of row, in order, and the value of each.
+func flattenRow(row []byte) ([]string, map[string]string, error) {
+	values := make(map[string]string)
+	row = bytes.TrimSpace(row)
+	if len(row) == 0 || row[0] != '{' {
+		value, err := flattenValue(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		values["value"] = value
+		return []string{"value"}, values, nil
+	}
+
+	var columns []string
+	err := flattenObject(row, "", &columns, values)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return columns, values, nil
+}
+
+func flattenObject(object []byte, prefix string, columns *[]string, values map[string]string) error {
+	dec := json.NewDecoder(bytes.NewReader(object))
+	// The opening brace.
+	_, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		column := prefix + keyToken.(string)
+
+		var raw json.RawMessage
+		err = dec.Decode(&raw)
+		if err != nil {
+			return err
+		}
+
+		if len(raw) > 0 && raw[0] == '{' {
+			err = flattenObject(raw, column+".", columns, values)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := flattenValue(raw)
+		if err != nil {
+			return err
+		}
+		*columns = append(*columns, column)
+		values[column] = value
+	}
+
+	return nil
+}
+
+func flattenValue(raw []byte) (string, error) {
+	if len(raw) == 0 {
+		return "", nil
+	}
+
+	switch raw[0] {
+	case '"':
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case 'n':
+		return "", nil
+	case '[':
+		var compacted bytes.Buffer
+		err := json.Compact(&compacted, raw)
+		return compacted.String(), err
+	default:
+		return string(raw), nil
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
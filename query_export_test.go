@@ -0,0 +1,82 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func testQueryResultsWithRows(rows ...string) *QueryResults {
+	res := &QueryResults{index: -1}
+	for _, row := range rows {
+		res.rows = append(res.rows, json.RawMessage(row))
+	}
+	return res
+}
+
+func TestQueryResultsExportNDJSON(t *testing.T) {
+	res := testQueryResultsWithRows(`{"id": "a", "n": 1}`, `{"id": "b",
+		"n": 2}`)
+
+	var buf bytes.Buffer
+	n, err := res.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("Expected export to succeed but error was %v", err)
+	}
+
+	expected := "{\"id\":\"a\",\"n\":1}\n{\"id\":\"b\",\"n\":2}\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q but was %q", expected, buf.String())
+	}
+	if n != int64(len(expected)) {
+		t.Fatalf("Expected %d bytes written but was %d", len(expected), n)
+	}
+	if res.Next(&struct{}{}) {
+		t.Fatalf("Expected results to be closed after export")
+	}
+}
+
+func TestQueryResultsExportCSV(t *testing.T) {
+	res := testQueryResultsWithRows(
+		`{"id":"a","name":"Alice, A","address":{"city":"Leeds","geo":{"lat":1.5}},"tags":["x","y"],"age":null}`,
+		`{"id":"b","address":{"city":"York"},"age":30}`,
+	)
+
+	var buf bytes.Buffer
+	_, err := res.Export(&buf, ExportCSV)
+	if err != nil {
+		t.Fatalf("Expected export to succeed but error was %v", err)
+	}
+
+	expected := "id,name,address.city,address.geo.lat,tags,age\n" +
+		"a,\"Alice, A\",Leeds,1.5,\"[\"\"x\"\",\"\"y\"\"]\",\n" +
+		"b,,York,,,30\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q but was %q", expected, buf.String())
+	}
+}
+
+func TestQueryResultsExportCSVRaw(t *testing.T) {
+	res := testQueryResultsWithRows(`"a"`, `2`)
+
+	var buf bytes.Buffer
+	_, err := res.Export(&buf, ExportCSV)
+	if err != nil {
+		t.Fatalf("Expected export to succeed but error was %v", err)
+	}
+	if buf.String() != "value\na\n2\n" {
+		t.Fatalf("Unexpected export %q", buf.String())
+	}
+}
+
+func TestQueryResultsExportCSVColumnsChanged(t *testing.T) {
+	res := testQueryResultsWithRows(`{"id":"a"}`, `{"id":"b","extra":1}`)
+
+	var buf bytes.Buffer
+	_, err := res.Export(&buf, ExportCSV)
+	if errors.Cause(err) != ErrExportColumnsChanged {
+		t.Fatalf("Expected ErrExportColumnsChanged but was %v", err)
+	}
+}
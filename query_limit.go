@@ -0,0 +1,124 @@
+package gocb
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// statementToken is a word or number at the top level of a statement, outside of any brackets, strings,
+// identifiers or comments.
+type statementToken struct {
+	text       string
+	start, end int
+}
+
+// topLevelTokens returns the words and numbers at the top level of statement.
+func topLevelTokens(statement string) []statementToken {
+	var tokens []statementToken
+	depth := 0
+	for i := 0; i < len(statement); {
+		c := statement[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Strings and identifiers end at the next unescaped quote, quotes are escaped by a backslash or by
+			// being doubled.
+			i++
+			for i < len(statement) {
+				if statement[i] == '\\' {
+					i += 2
+					continue
+				}
+				if statement[i] == c {
+					if i+1 < len(statement) && statement[i+1] == c {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+		case c == '-' && i+1 < len(statement) && statement[i+1] == '-':
+			end := strings.IndexByte(statement[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end + 1
+		case c == '/' && i+1 < len(statement) && statement[i+1] == '*':
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '(' || c == '[' || c == '{':
+			depth++
+			i++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			i++
+		case c == '_' || c < unicode.MaxASCII && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))):
+			start := i
+			for i < len(statement) && (statement[i] == '_' || statement[i] == '$' ||
+				unicode.IsLetter(rune(statement[i])) || unicode.IsDigit(rune(statement[i]))) {
+				i++
+			}
+			if depth == 0 {
+				tokens = append(tokens, statementToken{text: statement[start:i], start: start, end: i})
+			}
+		default:
+			i++
+		}
+	}
+	return tokens
+}
+
+// limitStatement returns statement with a top level LIMIT of at most limit, so that the query service stops
+// once it has returned that many rows.  An existing LIMIT which is a larger number is lowered, one which is
+// smaller or is not a number is left unchanged.  Statements which are not SELECT statements are not changed.
+func limitStatement(statement string, limit int) string {
+	trimmed := strings.TrimRightFunc(statement, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ';'
+	})
+
+	tokens := topLevelTokens(trimmed)
+	if len(tokens) == 0 || !strings.EqualFold(tokens[0].text, "SELECT") {
+		return statement
+	}
+
+	limitText := strconv.Itoa(limit)
+	for i, token := range tokens {
+		if strings.EqualFold(token.text, "LIMIT") {
+			if i+1 >= len(tokens) {
+				return statement
+			}
+			existing, err := strconv.Atoi(tokens[i+1].text)
+			if err != nil || existing <= limit || tokens[i+1].start != nextNonSpace(trimmed, token.end) {
+				return statement
+			}
+			return trimmed[:tokens[i+1].start] + limitText + trimmed[tokens[i+1].end:]
+		}
+	}
+
+	// The LIMIT clause comes before any OFFSET clause.
+	for _, token := range tokens {
+		if strings.EqualFold(token.text, "OFFSET") {
+			return trimmed[:token.start] + "LIMIT " + limitText + " " + trimmed[token.start:]
+		}
+	}
+
+	// A LIMIT appended after a line comment would be part of the comment.
+	separator := " "
+	if strings.Contains(trimmed[strings.LastIndex(trimmed, "\n")+1:], "--") {
+		separator = "\n"
+	}
+	return trimmed + separator + "LIMIT " + limitText
+}
+
+// nextNonSpace returns the index of the first character from start which is not whitespace.
+func nextNonSpace(s string, start int) int {
+	for start < len(s) && unicode.IsSpace(rune(s[start])) {
+		start++
+	}
+	return start
+}
@@ -0,0 +1,32 @@
+package gocb
+
+import (
+	"testing"
+)
+
+func TestLimitStatement(t *testing.T) {
+	tests := []struct {
+		statement string
+		expected  string
+	}{
+		{"SELECT * FROM default", "SELECT * FROM default LIMIT 11"},
+		{"select * from default;  ", "select * from default LIMIT 11"},
+		{"SELECT * FROM default LIMIT 100", "SELECT * FROM default LIMIT 11"},
+		{"SELECT * FROM default LIMIT 5", "SELECT * FROM default LIMIT 5"},
+		{"SELECT * FROM default LIMIT $1", "SELECT * FROM default LIMIT $1"},
+		{"SELECT * FROM default ORDER BY name OFFSET 20", "SELECT * FROM default ORDER BY name LIMIT 11 OFFSET 20"},
+		{"SELECT * FROM (SELECT * FROM default LIMIT 100) d", "SELECT * FROM (SELECT * FROM default LIMIT 100) d LIMIT 11"},
+		{"SELECT 'LIMIT 100' AS s FROM default", "SELECT 'LIMIT 100' AS s FROM default LIMIT 11"},
+		{"SELECT `limit` FROM default -- LIMIT 100\n", "SELECT `limit` FROM default -- LIMIT 100\nLIMIT 11"},
+		{"SELECT * FROM default /* LIMIT 100 */", "SELECT * FROM default /* LIMIT 100 */ LIMIT 11"},
+		{"UPDATE default SET a = 1", "UPDATE default SET a = 1"},
+		{"INSERT INTO default (KEY, VALUE) SELECT ...", "INSERT INTO default (KEY, VALUE) SELECT ..."},
+	}
+
+	for _, test := range tests {
+		actual := limitStatement(test.statement, 11)
+		if actual != test.expected {
+			t.Fatalf("Expected %q to be limited to %q but was %q", test.statement, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package gocb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// preparedName returns the name that the statement in queryOpts is prepared with, or an empty string if the
+// query service chooses the name.  Names derived from the prefix include the query context, as the same
+// statement resolves to different keyspaces in different query contexts.
+func (c *Cluster) preparedName(queryOpts map[string]interface{}, opts *QueryOptions) string {
+	if opts.PreparedName != "" {
+		return opts.PreparedName
+	}
+
+	prefix := c.ssb.preparedNamePrefix
+	if prefix == "" {
+		return ""
+	}
+
+	statement, _ := queryOpts["statement"].(string)
+	queryContext, _ := queryOpts["query_context"].(string)
+	hash := sha256.Sum256([]byte(queryContext + "\x00" + statement))
+	return prefix + hex.EncodeToString(hash[:12])
+}
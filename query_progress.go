@@ -0,0 +1,228 @@
+package gocb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// QueryProgress describes how far a N1QL or Analytics query has progressed.
+type QueryProgress struct {
+	// Elapsed is the time since the query was first dispatched, including any retries.
+	Elapsed time.Duration
+	// BytesRead is the number of response bytes read so far.
+	BytesRead uint64
+	// Rows is the number of result rows read so far.
+	Rows uint64
+}
+
+// QueryProgressFunc is called periodically whilst a query is executing.  Returning an error aborts the query,
+// the query then returns that error.
+type QueryProgressFunc func(progress QueryProgress) error
+
+const defaultQueryProgressInterval = 1 * time.Second
+
+// queryProgressTracker invokes a QueryProgressFunc on an interval until stopped.  A nil tracker is valid and
+// does nothing, which is what is used when no progress function has been set.
+type queryProgressTracker struct {
+	start  time.Time
+	bytes  uint64
+	rows   uint64
+	fn     QueryProgressFunc
+	cancel context.CancelFunc
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+
+	lock     sync.Mutex
+	abortErr error
+}
+
+// newQueryProgressTracker starts a tracker calling fn every interval, cancel is called if fn returns an error.
+func newQueryProgressTracker(fn QueryProgressFunc, interval time.Duration, cancel context.CancelFunc) *queryProgressTracker {
+	if fn == nil {
+		return nil
+	}
+	if interval <= 0 {
+		interval = defaultQueryProgressInterval
+	}
+
+	t := &queryProgressTracker{
+		start:  time.Now(),
+		fn:     fn,
+		cancel: cancel,
+		stopCh: make(chan struct{}),
+	}
+	go t.run(interval)
+
+	return t
+}
+
+func (t *queryProgressTracker) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stopCh:
+			return
+		case <-ticker.C:
+			if err := t.fn(t.progress()); err != nil {
+				t.lock.Lock()
+				t.abortErr = err
+				t.lock.Unlock()
+				t.cancel()
+				return
+			}
+		}
+	}
+}
+
+func (t *queryProgressTracker) progress() QueryProgress {
+	return QueryProgress{
+		Elapsed:   time.Since(t.start),
+		BytesRead: atomic.LoadUint64(&t.bytes),
+		Rows:      atomic.LoadUint64(&t.rows),
+	}
+}
+
+// err returns the error which aborted the query, if any.
+func (t *queryProgressTracker) err() error {
+	if t == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.abortErr
+}
+
+// row records that a row has been read, returning an error if the query has been aborted.
+func (t *queryProgressTracker) row() error {
+	if t == nil {
+		return nil
+	}
+
+	atomic.AddUint64(&t.rows, 1)
+	return t.err()
+}
+
+func (t *queryProgressTracker) stop() {
+	if t == nil {
+		return
+	}
+
+	t.stopOnce.Do(func() {
+		close(t.stopCh)
+	})
+}
+
+// wrapProvider returns a provider which counts the response bytes read through it.
+func (t *queryProgressTracker) wrapProvider(provider httpProvider) httpProvider {
+	if t == nil {
+		return provider
+	}
+
+	return &progressProvider{provider: provider, tracker: t}
+}
+
+type progressProvider struct {
+	provider httpProvider
+	tracker  *queryProgressTracker
+}
+
+func (p *progressProvider) DoHttpRequest(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+	resp, err := p.provider.DoHttpRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &countingReadCloser{ReadCloser: resp.Body, count: &p.tracker.bytes}
+	return resp, nil
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	count *uint64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddUint64(r.count, uint64(n))
+	return n, err
+}
+
+// limitRows returns a row callback which fails with ErrResultTooLarge once more than max rows have been read,
+// calling next for each row before then.  A max of 0 means unlimited.
+func limitRows(max int, next func() error) func() error {
+	if max <= 0 {
+		return next
+	}
+
+	var rows int
+	return func() error {
+		rows++
+		if rows > max {
+			return ErrResultTooLarge
+		}
+		return next()
+	}
+}
+
+// decodeRowsResponse decodes a query response object from r into out, except for the results array which is
+// decoded row by row and returned.  onRow, if not nil, is called after each row is read and aborts the decode
+// if it returns an error.
+func decodeRowsResponse(r io.Reader, out interface{}, onRow func() error) ([]json.RawMessage, error) {
+	stream, err := newRowStream(r, "results")
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readStreamRows(stream, nil, onRow)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := stream.decodeFields(out); err != nil {
+		return nil, err
+	}
+
+	return rows, nil
+}
+
+// readStreamRows reads the remaining rows from stream, appending them to rows.
+func readStreamRows(stream *rowStream, rows []json.RawMessage, onRow func() error) ([]json.RawMessage, error) {
+	for {
+		row, err := stream.nextRow()
+		if err != nil {
+			return nil, err
+		}
+		if row == nil {
+			return rows, nil
+		}
+
+		rows = append(rows, row)
+		if onRow != nil {
+			if err := onRow(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func expectJSONDelim(dec *json.Decoder, expected json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("unexpected token %v in response, expected %s", tok, expected)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package gocb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// slowReader returns a single byte per read, waiting delay before each.
+type slowReader struct {
+	data  *bytes.Buffer
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return r.data.Read(p[:1])
+}
+
+func (r *slowReader) Close() error {
+	return nil
+}
+
+func TestDecodeRowsResponse(t *testing.T) {
+	body := `{"requestID":"abc","results":[{"a":1},{"b":[2]}],"status":"success","metrics":{"resultCount":2}}`
+
+	var rowsSeen int
+	var resp n1qlResponse
+	rows, err := decodeRowsResponse(strings.NewReader(body), &resp, func() error {
+		rowsSeen++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Expected decode to succeed but was %v", err)
+	}
+
+	if len(rows) != 2 || string(rows[0]) != `{"a":1}` || string(rows[1]) != `{"b":[2]}` {
+		t.Fatalf("Unexpected rows %s", rows)
+	}
+	if rowsSeen != 2 {
+		t.Fatalf("Expected 2 rows to be seen but was %d", rowsSeen)
+	}
+	if resp.RequestID != "abc" || resp.Status != "success" || resp.Metrics.ResultCount != 2 {
+		t.Fatalf("Unexpected response fields %+v", resp)
+	}
+
+	rows, err = decodeRowsResponse(strings.NewReader(`{"results":null,"status":"success"}`), &resp, nil)
+	if err != nil || rows != nil {
+		t.Fatalf("Expected null results to decode to no rows, rows were %v and error %v", rows, err)
+	}
+
+	_, err = decodeRowsResponse(strings.NewReader(`{"results":[1,2`), &resp, nil)
+	if err == nil {
+		t.Fatalf("Expected truncated response to fail to decode")
+	}
+}
+
+func TestQueryProgress(t *testing.T) {
+	var rows []string
+	for i := 0; i < 50; i++ {
+		rows = append(rows, fmt.Sprintf("%d", i))
+	}
+	body := `{"results":[` + strings.Join(rows, ",") + `],"status":"success"}`
+
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &slowReader{data: bytes.NewBufferString(body), delay: time.Millisecond},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 10*time.Second, 0, 0)
+
+	abortErr := errors.New("too slow")
+	var lock sync.Mutex
+	var seen []QueryProgress
+	res, err := cluster.Query("SELECT 1", &QueryOptions{
+		ProgressInterval: 10 * time.Millisecond,
+		Progress: func(progress QueryProgress) error {
+			lock.Lock()
+			defer lock.Unlock()
+			seen = append(seen, progress)
+			if len(seen) == 2 {
+				return abortErr
+			}
+			return nil
+		},
+	})
+	// The rows are streamed, so the query is aborted whilst they are being read.
+	if err == nil {
+		for res.NextBytes() != nil {
+		}
+		err = res.Close()
+	}
+	if err != abortErr {
+		t.Fatalf("Expected query to be aborted by the progress function but error was %v", err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(seen) != 2 {
+		t.Fatalf("Expected progress to stop being reported after aborting, was reported %d times", len(seen))
+	}
+	if seen[1].Elapsed <= seen[0].Elapsed || seen[1].BytesRead <= seen[0].BytesRead || seen[1].BytesRead == 0 {
+		t.Fatalf("Expected progress to increase but was %+v", seen)
+	}
+}
+
+func TestQueryMaxBufferedRows(t *testing.T) {
+	body := `{"results":[1,2,3],"status":"success"}`
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(body), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, 10*time.Second, 0, 0)
+
+	res, err := cluster.Query("SELECT 1", &QueryOptions{MaxBufferedRows: 3})
+	if err != nil {
+		t.Fatalf("Expected query within the row limit to succeed but was %v", err)
+	}
+	var count int
+	var row int
+	for res.Next(&row) {
+		count++
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 rows but had %d", count)
+	}
+
+	_, err = cluster.Query("SELECT 1", &QueryOptions{MaxBufferedRows: 2})
+	if err != ErrResultTooLarge {
+		t.Fatalf("Expected ErrResultTooLarge but was %v", err)
+	}
+}
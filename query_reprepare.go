@@ -0,0 +1,166 @@
+package gocb
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+)
+
+const (
+	// reprepareMinInterval is the least time between background re-prepares of the prepared statement cache, so
+	// that a cluster which keeps rejecting plans is not flooded with PREPARE requests.
+	reprepareMinInterval = time.Minute
+
+	// defaultReprepareDelay is the time waited between each statement prepared in the background.
+	defaultReprepareDelay = 100 * time.Millisecond
+)
+
+// queryReprepareState tracks the background re-preparing of the prepared statement cache.
+type queryReprepareState struct {
+	lock    sync.Mutex
+	running bool
+	last    time.Time
+	// delay is the time waited between each statement prepared, defaultReprepareDelay if zero.
+	delay time.Duration
+	// cancel stops a running re-prepare, it is set while running.
+	cancel context.CancelFunc
+	closed bool
+}
+
+// stop cancels any running re-prepare and prevents further ones, it is called when the cluster is closed.
+func (state *queryReprepareState) stop() {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	state.closed = true
+	if state.cancel != nil {
+		state.cancel()
+	}
+}
+
+// isPlanRejectedQueryError returns whether the query service rejected the encoded plan of a prepared statement,
+// which happens to every cached statement once the query nodes are upgraded to a version with a different plan
+// format.
+func isPlanRejectedQueryError(err QueryError) bool {
+	return err.Code() == 4050 || err.Code() == 4070
+}
+
+// reprepareInBackground prepares every cached statement again, other than the one identified by except which the
+// caller is preparing itself, once a query node has rejected the plan of a cached statement.  Doing so in the
+// background means that the queries using the other statements do not each have a plan rejected first.  It does
+// nothing if the cache is already being re-prepared or was re-prepared within reprepareMinInterval, or if the
+// cluster has been closed, which also stops a running re-prepare.
+func (c *Cluster) reprepareInBackground(except n1qlCacheKey) {
+	state := &c.reprepare
+	state.lock.Lock()
+	if state.closed || state.running || (!state.last.IsZero() && time.Since(state.last) < reprepareMinInterval) {
+		state.lock.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	state.running = true
+	state.cancel = cancel
+	state.lock.Unlock()
+
+	go func() {
+		c.reprepareCached(ctx, except)
+
+		state.lock.Lock()
+		state.running = false
+		state.cancel = nil
+		state.last = time.Now()
+		state.lock.Unlock()
+		cancel()
+	}()
+}
+
+// reprepareCached prepares the cached statements, other than except, one at a time until ctx is done.  Statements
+// which were prepared for another user are skipped, as they would be prepared with the credentials of the current
+// one.  A statement is only replaced in the cache if it has not been re-prepared by a query in the meantime.
+func (c *Cluster) reprepareCached(ctx context.Context, except n1qlCacheKey) {
+	user := c.queryUser()
+
+	c.clusterLock.RLock()
+	stale := make(map[n1qlCacheKey]*n1qlCache, len(c.queryCache))
+	for key, stmt := range c.queryCache {
+		if key != except && key.user == user {
+			stale[key] = stmt
+		}
+	}
+	c.clusterLock.RUnlock()
+
+	if len(stale) == 0 {
+		return
+	}
+
+	logInfof("Query plan rejected, re-preparing %d cached statements in the background", len(stale))
+
+	delay := c.reprepare.delay
+	if delay <= 0 {
+		delay = defaultReprepareDelay
+	}
+
+	first := true
+	for key, oldStmt := range stale {
+		if !first {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+		first = false
+
+		c.clusterLock.RLock()
+		current := c.queryCache[key]
+		c.clusterLock.RUnlock()
+		if current != oldStmt {
+			continue
+		}
+
+		stmt, err := c.reprepareStatement(ctx, key, oldStmt)
+		if err != nil {
+			logDebugf("Failed to re-prepare statement in the background (%s)", err)
+			continue
+		}
+
+		c.clusterLock.Lock()
+		if c.queryCache[key] == oldStmt {
+			c.queryCache[key] = stmt
+		}
+		c.clusterLock.Unlock()
+	}
+}
+
+// reprepareStatement prepares the statement identified by key again, with the same name if it was prepared with
+// a name chosen by the application.
+func (c *Cluster) reprepareStatement(ctx context.Context, key n1qlCacheKey, stmt *n1qlCache) (*n1qlCache, error) {
+	provider, err := c.getQueryProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := c.n1qlTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	opts := map[string]interface{}{
+		"timeout":           timeout.String(),
+		"client_context_id": c.newID(),
+	}
+	if key.queryContext != "" {
+		opts["query_context"] = key.queryContext
+	}
+
+	var name string
+	if stmt.named {
+		name = stmt.name
+	}
+
+	span := opentracing.GlobalTracer().StartSpan("prepare")
+	defer span.Finish()
+
+	return c.prepareN1qlQuery(ctx, span.Context(), opts, key.statement, name, provider)
+}
@@ -0,0 +1,163 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestReprepareOnPlanRejected(t *testing.T) {
+	var lock sync.Mutex
+	var prepared []string
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			var body map[string]interface{}
+			if err := json.Unmarshal(req.Body, &body); err != nil {
+				t.Errorf("Failed to parse request body: %v", err)
+			}
+
+			respBody := `{"results":[{"a":1}],"status":"success"}`
+			if statement, ok := body["statement"].(string); ok && strings.HasPrefix(statement, "PREPARE ") {
+				lock.Lock()
+				prepared = append(prepared, statement)
+				lock.Unlock()
+				respBody = `{"results":[{"name":"p","encoded_plan":"new"}],"status":"success"}`
+			} else if body["encoded_plan"] == "old" {
+				respBody = `{"errors":[{"code":4050,"msg":"Unrecognizable prepared statement"}],"status":"fatal"}`
+			}
+
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(respBody), nil},
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	cluster.reprepare.delay = time.Millisecond
+	cluster.queryCache = make(map[n1qlCacheKey]*n1qlCache)
+	keyA := cluster.queryCacheKey(map[string]interface{}{"statement": "SELECT a"})
+	keyB := cluster.queryCacheKey(map[string]interface{}{"statement": "SELECT b", "query_context": "default:`b`"})
+	keyC := cluster.queryCacheKey(map[string]interface{}{"statement": "SELECT c"})
+	cluster.queryCache[keyA] = &n1qlCache{name: "a", encodedPlan: "old"}
+	cluster.queryCache[keyB] = &n1qlCache{name: "b", encodedPlan: "old"}
+	cluster.queryCache[keyC] = &n1qlCache{name: "c", encodedPlan: "old", named: true}
+	// Statements prepared for another user are not prepared with the current credentials.
+	keyD := n1qlCacheKey{statement: "SELECT d", user: "bob"}
+	cluster.queryCache[keyD] = &n1qlCache{name: "d", encodedPlan: "old"}
+
+	res, err := cluster.Query("SELECT a", &QueryOptions{Prepared: true})
+	if err != nil {
+		t.Fatalf("Expected query to succeed after re-preparing but was %v", err)
+	}
+	res.Close()
+
+	// The other cached statements are re-prepared in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cluster.clusterLock.RLock()
+		done := cluster.queryCache[keyB].encodedPlan == "new" && cluster.queryCache[keyC].encodedPlan == "new"
+		cluster.clusterLock.RUnlock()
+		cluster.reprepare.lock.Lock()
+		running := cluster.reprepare.running
+		cluster.reprepare.lock.Unlock()
+		if done && !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected cached statements to be re-prepared in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	lock.Lock()
+	if len(prepared) != 3 {
+		t.Fatalf("Expected each statement to be prepared once but were %v", prepared)
+	}
+	var namedPrepared bool
+	for _, statement := range prepared {
+		if statement == "PREPARE `c` FROM SELECT c" {
+			namedPrepared = true
+		}
+	}
+	if !namedPrepared {
+		t.Fatalf("Expected named statement to be prepared with its name but were %v", prepared)
+	}
+	if cluster.queryCache[keyD].encodedPlan != "old" {
+		t.Fatalf("Expected statement of another user not to be re-prepared")
+	}
+	prepared = nil
+	lock.Unlock()
+
+	// Further rejections soon after do not re-prepare the cache again.
+	cluster.queryCache[keyA] = &n1qlCache{name: "a", encodedPlan: "old"}
+	cluster.queryCache[keyB] = &n1qlCache{name: "b", encodedPlan: "old"}
+	res, err = cluster.Query("SELECT a", &QueryOptions{Prepared: true})
+	if err != nil {
+		t.Fatalf("Expected query to succeed after re-preparing but was %v", err)
+	}
+	res.Close()
+
+	cluster.reprepare.lock.Lock()
+	running := cluster.reprepare.running
+	cluster.reprepare.lock.Unlock()
+	if running {
+		t.Fatalf("Expected the cache not to be re-prepared again within the minimum interval")
+	}
+}
+
+func TestReprepareStoppedByClose(t *testing.T) {
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8093",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(`{"results":[{"name":"p","encoded_plan":"new"}],"status":"success"}`), nil},
+			}, nil
+		},
+	}
+
+	cluster := testGetClusterForHTTP(provider, 60*time.Second, 0, 0)
+	cluster.reprepare.delay = time.Hour
+	cluster.queryCache = make(map[n1qlCacheKey]*n1qlCache)
+	keyA := cluster.queryCacheKey(map[string]interface{}{"statement": "SELECT a"})
+	keyB := cluster.queryCacheKey(map[string]interface{}{"statement": "SELECT b"})
+	cluster.queryCache[keyA] = &n1qlCache{name: "a", encodedPlan: "old"}
+	cluster.queryCache[keyB] = &n1qlCache{name: "b", encodedPlan: "old"}
+
+	// The first statement is prepared immediately, the second only after the delay.
+	cluster.reprepareInBackground(n1qlCacheKey{})
+
+	err := cluster.Close(nil)
+	if err != nil {
+		t.Fatalf("Expected close to succeed but error was %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cluster.reprepare.lock.Lock()
+		running := cluster.reprepare.running
+		cluster.reprepare.lock.Unlock()
+		if !running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected close to stop re-preparing in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cluster.reprepareInBackground(n1qlCacheKey{})
+	cluster.reprepare.lock.Lock()
+	running := cluster.reprepare.running
+	cluster.reprepare.lock.Unlock()
+	if running {
+		t.Fatalf("Expected no re-prepare to start once the cluster is closed")
+	}
+}
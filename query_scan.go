@@ -0,0 +1,108 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/couchbase/gocb/internal/jsonkeys"
+	"github.com/pkg/errors"
+)
+
+// Scan assigns the fields of the next row to dest, in the order of Columns, returning whether the read was
+// successful.  This is similar to Scan in database/sql, except that it also advances to the next row, and is
+// intended for simple tabular queries such as "SELECT name, age FROM users", whose fields are scanned as name then
+// age.  Each field is decoded into its destination as JSON, fields which are null or missing leave their
+// destination unchanged.  The fields are taken from the signature of the query, or from the row itself when the
+// signature does not list them such as for "SELECT *".  A row which is not an object, such as one from a SELECT
+// RAW query, is decoded into a single destination.  It always returns false once the results have been closed or
+// an error has occurred, the error is returned by Close.
+func (r *QueryResults) Scan(dest ...interface{}) bool {
+	if r.err != nil || r.closed {
+		return false
+	}
+
+	row := r.NextBytes()
+	if row == nil {
+		return false
+	}
+
+	r.err = r.scanRow(row, dest)
+	return r.err == nil
+}
+
+func (r *QueryResults) scanRow(row []byte, dest []interface{}) error {
+	row = bytes.TrimSpace(row)
+	if len(row) == 0 || row[0] != '{' {
+		if len(dest) != 1 {
+			return errors.Wrapf(ErrInvalidArgument, "row has 1 column but %d destinations were given", len(dest))
+		}
+		return json.Unmarshal(row, dest[0])
+	}
+
+	columns := r.Columns()
+	if len(columns) == 0 {
+		var err error
+		columns, err = jsonkeys.ObjectKeys(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(columns) != len(dest) {
+		return errors.Wrapf(ErrInvalidArgument, "row has %d columns but %d destinations were given",
+			len(columns), len(dest))
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(row, &fields)
+	if err != nil {
+		return err
+	}
+
+	for i, column := range columns {
+		value, ok := fields[column]
+		if !ok {
+			continue
+		}
+
+		err = json.Unmarshal(value, dest[i])
+		if err != nil {
+			return errors.Wrapf(err, "failed to scan column %s", column)
+		}
+	}
+
+	return nil
+}
+
+// Columns returns the names of the fields selected by the query, in the order in which they are listed by its
+// signature, which is the order of the SELECT clause.  It returns nil when the signature does not list the fields,
+// such as for "SELECT *" and "SELECT RAW" queries.
+func (r *QueryResults) Columns() []string {
+	if r.scanColumns == nil {
+		r.scanColumns = signatureColumns(r.signature)
+	}
+	return r.scanColumns
+}
+
+// signatureColumns returns the names of the fields selected by a query, in order, from its signature.  If
+// the signature does not list the fields, such as for "SELECT *", then no columns are returned.
+func signatureColumns(signature json.RawMessage) []string {
+	signature = bytes.TrimSpace(signature)
+	if len(signature) == 0 || signature[0] != '{' {
+		return nil
+	}
+
+	columns, err := jsonkeys.ObjectKeys(signature)
+	if err != nil {
+		logDebugf("Failed to parse query signature (%s)", err)
+		return nil
+	}
+
+	for _, column := range columns {
+		if column == "*" {
+			return nil
+		}
+	}
+
+	return columns
+}
@@ -0,0 +1,89 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestQueryResultsScan(t *testing.T) {
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			// The signature lists the fields in select order, the rows need not.
+			resp := `{"requestID":"r","signature":{"name":"json","age":"json"},` +
+				`"results":[{"age":30,"name":"Alice"},{"name":"Bob"}],"status":"success",` +
+				`"metrics":{"elapsedTime":"1ms","executionTime":"1ms","resultCount":2,"resultSize":20}}`
+			return &gocbcore.HttpResponse{
+				Endpoint:   req.Endpoint,
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(resp), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, time.Second, 0, 0)
+
+	res, err := cluster.Query("SELECT name, age FROM users", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+
+	if columns := res.Columns(); len(columns) != 2 || columns[0] != "name" || columns[1] != "age" {
+		t.Fatalf("Expected columns to be in signature order but were %v", columns)
+	}
+
+	var name string
+	var age int
+	if !res.Scan(&name, &age) || name != "Alice" || age != 30 {
+		t.Fatalf("Expected first row to scan but had %s, %d, %v", name, age, res.Err())
+	}
+
+	age = 0
+	if !res.Scan(&name, &age) || name != "Bob" || age != 0 {
+		t.Fatalf("Expected second row to scan but had %s, %d, %v", name, age, res.Err())
+	}
+
+	if res.Scan(&name, &age) {
+		t.Fatalf("Expected no more rows")
+	}
+	if err := res.Close(); err != nil {
+		t.Fatalf("Expected results to close but error was %v", err)
+	}
+}
+
+func TestQueryResultsScanWithoutSignature(t *testing.T) {
+	res := testQueryResultsWithRows(`{"n":1,"id":"a"}`)
+	res.signature = json.RawMessage(`{"*":"*"}`)
+
+	var id string
+	var n int
+	if !res.Scan(&n, &id) || id != "a" || n != 1 {
+		t.Fatalf("Expected row to scan in field order but had %s, %d, %v", id, n, res.Err())
+	}
+}
+
+func TestQueryResultsScanRaw(t *testing.T) {
+	res := testQueryResultsWithRows(`"a"`)
+	res.signature = json.RawMessage(`"json"`)
+
+	var id string
+	if !res.Scan(&id) || id != "a" {
+		t.Fatalf("Expected raw row to scan but had %s, %v", id, res.Err())
+	}
+}
+
+func TestQueryResultsScanWrongDestinations(t *testing.T) {
+	res := testQueryResultsWithRows(`{"id":"a","n":1}`)
+	res.signature = json.RawMessage(`{"id":"json","n":"json"}`)
+
+	var id string
+	if res.Scan(&id) {
+		t.Fatalf("Expected scan to fail")
+	}
+	if err := res.Close(); errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected ErrInvalidArgument but was %v", err)
+	}
+}
@@ -0,0 +1,82 @@
+package gocb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SafeStatement builds a N1QL statement from constant query text, identifiers and values, where values are
+// always sent as positional parameters rather than being interpolated into the statement.  This makes the
+// statement safe from injection no matter where the values come from, for example:
+//
+//	stmt := NewSafeStatement("SELECT * FROM ").Identifier(bucketName).Text(" WHERE type = ").Param(docType)
+//	opts, err := stmt.Options(nil)
+//	results, err := cluster.Query(stmt.String(), opts)
+type SafeStatement struct {
+	text   string
+	params []interface{}
+}
+
+// NewSafeStatement creates a new SafeStatement starting with the query text text.
+func NewSafeStatement(text string) *SafeStatement {
+	s := &SafeStatement{}
+	return s.Text(text)
+}
+
+// Text appends query text to the statement.  The text is used as is so must never contain user input, use
+// Param or Identifier for anything that isn't a constant.
+func (s *SafeStatement) Text(text string) *SafeStatement {
+	s.text += text
+	return s
+}
+
+// Param appends a positional parameter placeholder to the statement, value is sent as its parameter.
+func (s *SafeStatement) Param(value interface{}) *SafeStatement {
+	s.params = append(s.params, value)
+	s.text += "$" + strconv.Itoa(len(s.params))
+	return s
+}
+
+// Identifier appends an escaped identifier, such as a bucket or field name, to the statement.  Identifiers
+// cannot be sent as parameters so are escaped instead.
+func (s *SafeStatement) Identifier(name string) *SafeStatement {
+	s.text += "`" + strings.Replace(name, "`", "``", -1) + "`"
+	return s
+}
+
+// String returns the statement.
+func (s *SafeStatement) String() string {
+	return s.text
+}
+
+// Parameters returns the positional parameters of the statement.
+func (s *SafeStatement) Parameters() []interface{} {
+	return s.params
+}
+
+// Options returns a copy of opts, or new options if opts is nil, with the statement's positional parameters set.
+// It returns ErrInvalidArgument if opts has named parameters, as the query service does not accept named and
+// positional parameters together, or if both opts and the statement have positional parameters.
+func (s *SafeStatement) Options(opts *QueryOptions) (*QueryOptions, error) {
+	var newOpts QueryOptions
+	if opts != nil {
+		newOpts = *opts
+	}
+	if len(newOpts.NamedParameters) > 0 {
+		return nil, errors.Wrap(ErrInvalidArgument,
+			"query options have named parameters, which cannot be used with the positional parameters of a statement")
+	}
+	if len(s.params) == 0 {
+		return &newOpts, nil
+	}
+
+	if len(newOpts.PositionalParameters) > 0 {
+		return nil, errors.Wrap(ErrInvalidArgument,
+			"query options already have positional parameters, which would conflict with those of the statement")
+	}
+
+	newOpts.PositionalParameters = append([]interface{}{}, s.params...)
+	return &newOpts, nil
+}
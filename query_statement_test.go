@@ -0,0 +1,49 @@
+package gocb
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestSafeStatement(t *testing.T) {
+	stmt := NewSafeStatement("SELECT * FROM ").
+		Identifier("beer`sample").
+		Text(" WHERE type = ").Param("beer").
+		Text(" AND name = ").Param("x' OR '1'='1")
+
+	expected := "SELECT * FROM `beer``sample` WHERE type = $1 AND name = $2"
+	if stmt.String() != expected {
+		t.Fatalf("Expected statement to be %s but was %s", expected, stmt.String())
+	}
+
+	opts, err := stmt.Options(&QueryOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Expected options to be created but error was %v", err)
+	}
+	if !opts.ReadOnly {
+		t.Fatalf("Expected existing options to be kept")
+	}
+
+	if !reflect.DeepEqual(opts.PositionalParameters, []interface{}{"beer", "x' OR '1'='1"}) {
+		t.Fatalf("Expected values to be sent as parameters but were %v", opts.PositionalParameters)
+	}
+
+	// Copying a statement must not break it.
+	copied := *stmt
+	copied.Text(" LIMIT 1")
+	if copied.String() != expected+" LIMIT 1" || stmt.String() != expected {
+		t.Fatalf("Expected copied statement to be built independently but was %s", copied.String())
+	}
+
+	_, err = stmt.Options(&QueryOptions{PositionalParameters: []interface{}{1}})
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected conflicting parameters to fail with ErrInvalidArgument but was %v", err)
+	}
+
+	_, err = stmt.Options(&QueryOptions{NamedParameters: map[string]interface{}{"a": 1}})
+	if errors.Cause(err) != ErrInvalidArgument {
+		t.Fatalf("Expected named parameters to fail with ErrInvalidArgument but was %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package gocb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pkg/errors"
+)
+
+// rowStream decodes a response object, reading the rows of one of its array fields, such as the results of a
+// query, one at a time as they are needed.  The other fields of the response are kept as they are read, those
+// after the rows are only available once every row has been read.
+type rowStream struct {
+	dec    *json.Decoder
+	fields map[string]json.RawMessage
+	key    string
+	inRows bool
+}
+
+// newRowStream reads the response from r up to the first row of the array field key, or to the end if it has no
+// such field.
+func newRowStream(r io.Reader, key string) (*rowStream, error) {
+	s := &rowStream{
+		dec:    json.NewDecoder(r),
+		fields: make(map[string]json.RawMessage),
+		key:    key,
+	}
+	if err := expectJSONDelim(s.dec, '{'); err != nil {
+		return nil, err
+	}
+	if err := s.readFields(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readFields reads the fields of the response until the start of the rows or the end of the response.
+func (s *rowStream) readFields() error {
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("unexpected token %v in response", tok)
+		}
+
+		if key != s.key {
+			var value json.RawMessage
+			if err := s.dec.Decode(&value); err != nil {
+				return err
+			}
+			s.fields[key] = value
+			continue
+		}
+
+		tok, err = s.dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+			return fmt.Errorf("unexpected token %v for %s", tok, s.key)
+		}
+		s.inRows = true
+		return nil
+	}
+	return expectJSONDelim(s.dec, '}')
+}
+
+// nextRow returns the next row, or nil once there are no more rows and the rest of the response
+// has been read.
+func (s *rowStream) nextRow() (json.RawMessage, error) {
+	if !s.inRows {
+		return nil, nil
+	}
+
+	if s.dec.More() {
+		var row json.RawMessage
+		if err := s.dec.Decode(&row); err != nil {
+			return nil, err
+		}
+		return row, nil
+	}
+
+	if err := expectJSONDelim(s.dec, ']'); err != nil {
+		return nil, err
+	}
+	s.inRows = false
+	return nil, s.readFields()
+}
+
+// decodeFields decodes the fields of the response read so far into out.
+func (s *rowStream) decodeFields(out interface{}) error {
+	fieldBytes, err := json.Marshal(s.fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(fieldBytes, out)
+}
+
+// queryResultStream holds the state of query, analytics or search results whose rows are read from the response body as
+// they are needed, rather than all being read before the results are returned.
+type queryResultStream struct {
+	rows    *rowStream
+	body    io.ReadCloser
+	ctx     context.Context
+	span    opentracing.Span
+	pending json.RawMessage
+	onRow   func() error
+	// mapErr, if set, converts errors from reading the response, such as when the request timed out.
+	mapErr func(error) error
+	// release, if set, is called once the response has been read or the results closed.
+	release     func()
+	logWarnings bool
+	finished    bool
+}
+
+// next returns the next row read from the response body, or nil once all rows have been read.
+func (s *queryResultStream) next() (json.RawMessage, error) {
+	row := s.pending
+	s.pending = nil
+	if row == nil {
+		var err error
+		row, err = s.rows.nextRow()
+		if err != nil {
+			return nil, s.readError(errors.Wrap(err, "failed to decode response body"))
+		}
+		if row == nil {
+			return nil, nil
+		}
+	}
+
+	if s.onRow != nil {
+		if err := s.onRow(); err != nil {
+			return nil, s.readError(err)
+		}
+	}
+
+	return row, nil
+}
+
+// discard reads the rows which have not been read so that the fields which follow them are available, returning
+// whether every row was read.  It stops once more than maxHTTPBodyDrainBytes of rows have been discarded, in which
+// case it is cheaper to abort the response.
+func (s *queryResultStream) discard() (bool, error) {
+	discarded := len(s.pending)
+	s.pending = nil
+	for discarded <= maxHTTPBodyDrainBytes {
+		row, err := s.rows.nextRow()
+		if err != nil {
+			return false, s.readError(errors.Wrap(err, "failed to decode response body"))
+		}
+		if row == nil {
+			return true, nil
+		}
+		discarded += len(row)
+	}
+	return false, nil
+}
+
+// finish closes the response body and releases the request.  It is safe to call more than once.
+func (s *queryResultStream) finish() {
+	s.close(drainAndCloseHTTPBody)
+}
+
+// abort closes the response body without reading any more of it and releases the request, for when the rest of
+// the response is not wanted.  It is safe to call more than once, and after finish.
+func (s *queryResultStream) abort() {
+	s.close(closeHTTPBody)
+}
+
+func (s *queryResultStream) close(closeBody func(io.ReadCloser)) {
+	if s.finished {
+		return
+	}
+	s.finished = true
+
+	closeBody(s.body)
+	s.span.Finish()
+	if s.release != nil {
+		s.release()
+	}
+}
+
+// readError returns the error to report for err, which occurred whilst reading the response.
+func (s *queryResultStream) readError(err error) error {
+	if s.mapErr != nil {
+		return s.mapErr(err)
+	}
+	if s.ctx.Err() == context.DeadlineExceeded {
+		return timeoutError{}
+	}
+	return err
+}
+
+// nextStreamedRow returns the next row read from the response body, or nil once all rows have been read or an
+// error occurred, in which case the error is set on the results.
+func (r *QueryResults) nextStreamedRow() []byte {
+	row, err := r.stream.next()
+	if err != nil {
+		r.err = err
+		r.finishStream()
+		return nil
+	}
+
+	if row == nil {
+		r.completeStream()
+		r.finishStream()
+		return nil
+	}
+
+	return row
+}
+
+// completeStream sets the metadata and any errors from the fields which follow the rows in the response.
+func (r *QueryResults) completeStream() {
+	var n1qlResp n1qlResponse
+	err := r.stream.rows.decodeFields(&n1qlResp)
+	if err != nil {
+		r.err = errors.Wrap(err, "failed to decode query response body")
+		return
+	}
+
+	r.metrics = n1qlResultMetrics(n1qlResp.Metrics)
+	r.warnings = n1qlResp.Warnings
+	if r.stream.logWarnings {
+		logQueryWarnings(r)
+	}
+
+	if len(n1qlResp.Errors) > 0 {
+		errs := make([]QueryError, len(n1qlResp.Errors))
+		for i, e := range n1qlResp.Errors {
+			errs[i] = e
+		}
+		r.err = queryMultiError{
+			errors:     errs,
+			endpoint:   r.sourceAddr,
+			httpStatus: 200,
+			contextID:  n1qlResp.ClientContextID,
+		}
+	}
+}
+
+// discardStream reads the rows which have not been read so that the metadata which follows them is available,
+// unless more than maxHTTPBodyDrainBytes of rows remain.
+func (r *QueryResults) discardStream() {
+	s := r.stream
+	if s == nil || s.finished || r.err != nil {
+		return
+	}
+
+	complete, err := s.discard()
+	if err != nil {
+		r.err = err
+		return
+	}
+	if complete {
+		r.completeStream()
+	}
+}
+
+// finishStream closes the response body and releases the request.  It is safe to call more than once.
+func (r *QueryResults) finishStream() {
+	if r.stream != nil {
+		r.stream.finish()
+	}
+}
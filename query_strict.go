@@ -0,0 +1,151 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/couchbase/gocb/internal/jsonkeys"
+)
+
+// decodeRowStrict decodes row into valuePtr, first checking that the fields of the row match the signature of
+// the query.  Errors identify the field which could not be decoded and the type it was expected to be.
+func (r *QueryResults) decodeRowStrict(row []byte, valuePtr interface{}) error {
+	row = bytes.TrimSpace(row)
+	if len(row) > 0 && row[0] == '{' {
+		err := r.checkRowSignature(row)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := json.Unmarshal(row, valuePtr)
+	switch typeErr := err.(type) {
+	case nil:
+		return nil
+	case *json.UnmarshalTypeError:
+		return queryDecodeError{
+			row:      r.index,
+			field:    typeErr.Field,
+			expected: typeErr.Type.String(),
+			actual:   typeErr.Value,
+		}
+	default:
+		return queryDecodeError{
+			row:   r.index,
+			cause: err,
+		}
+	}
+}
+
+// checkRowSignature checks that every field of the row is in the signature, unless the signature includes "*",
+// and that the type of each is the one listed in the signature.  Null values are allowed for any type.
+func (r *QueryResults) checkRowSignature(row []byte) error {
+	types, wildcard := signatureTypes(r.signature)
+	if types == nil {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(row, &fields)
+	if err != nil {
+		return queryDecodeError{
+			row:   r.index,
+			cause: err,
+		}
+	}
+
+	// The fields are checked in the order that they appear so that the first invalid field is reported.
+	names, err := jsonkeys.ObjectKeys(row)
+	if err != nil {
+		return queryDecodeError{
+			row:   r.index,
+			cause: err,
+		}
+	}
+
+	for _, name := range names {
+		value := fields[name]
+		expected, ok := types[name]
+		if !ok {
+			if wildcard {
+				continue
+			}
+			return queryDecodeError{
+				row:      r.index,
+				field:    name,
+				expected: "no field as it is not in the query signature",
+				actual:   jsonValueType(value),
+			}
+		}
+
+		actual := jsonValueType(value)
+		if expected == "json" || actual == "null" || expected == actual {
+			continue
+		}
+		return queryDecodeError{
+			row:      r.index,
+			field:    name,
+			expected: expected,
+			actual:   actual,
+		}
+	}
+
+	return nil
+}
+
+// signatureTypes returns the types of the fields in a query signature, such as {"name":"string","age":"number"},
+// and whether it includes "*".  Fields which are themselves objects have the type "object".  It returns nil if the
+// signature does not list fields.
+func signatureTypes(signature json.RawMessage) (map[string]string, bool) {
+	signature = bytes.TrimSpace(signature)
+	if len(signature) == 0 || signature[0] != '{' {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(signature, &fields)
+	if err != nil {
+		logDebugf("Failed to parse query signature (%s)", err)
+		return nil, false
+	}
+
+	types := make(map[string]string, len(fields))
+	var wildcard bool
+	for name, value := range fields {
+		if name == "*" {
+			wildcard = true
+			continue
+		}
+
+		var fieldType string
+		if json.Unmarshal(value, &fieldType) != nil {
+			fieldType = jsonValueType(value)
+		}
+		types[name] = fieldType
+	}
+
+	return types, wildcard
+}
+
+// jsonValueType returns the JSON type of value, as named in query signatures.
+func jsonValueType(value json.RawMessage) string {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 {
+		return "null"
+	}
+
+	switch value[0] {
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case '"':
+		return "string"
+	case 't', 'f':
+		return "boolean"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
@@ -0,0 +1,84 @@
+package gocb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func testStrictQueryResults(signature string, rows ...string) *QueryResults {
+	res := &QueryResults{
+		index:          -1,
+		signature:      json.RawMessage(signature),
+		strictDecoding: true,
+	}
+	for _, row := range rows {
+		res.rows = append(res.rows, json.RawMessage(row))
+	}
+	return res
+}
+
+func TestQueryStrictDecoding(t *testing.T) {
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+
+	res := testStrictQueryResults(`{"name":"string","age":"number"}`,
+		`{"name":"a","age":1}`,
+		`{"name":"b","age":null}`,
+		`{"name":"c","age":"ten"}`)
+
+	var u user
+	if !res.Next(&u) || u.Name != "a" || u.Age != 1 {
+		t.Fatalf("Expected first row to be decoded but was %v (%v)", u, res.Err())
+	}
+	if !res.Next(&u) || u.Name != "b" {
+		t.Fatalf("Expected row with null field to be decoded but was %v (%v)", u, res.Err())
+	}
+	if res.Next(&u) {
+		t.Fatalf("Expected row with a field of the wrong type to fail")
+	}
+
+	decodeErr, ok := res.Close().(QueryDecodeError)
+	if !ok {
+		t.Fatalf("Expected a QueryDecodeError but error was %v", res.Err())
+	}
+	if decodeErr.Row() != 2 || decodeErr.Field() != "age" || decodeErr.Expected() != "number" ||
+		decodeErr.Actual() != "string" {
+		t.Fatalf("Unexpected decode error: %v", decodeErr)
+	}
+}
+
+func TestQueryStrictDecodingUnexpectedField(t *testing.T) {
+	res := testStrictQueryResults(`{"name":"string"}`, `{"name":"a","extra":true}`)
+
+	var row map[string]interface{}
+	if res.Next(&row) {
+		t.Fatalf("Expected row with a field not in the signature to fail")
+	}
+	decodeErr, ok := res.Err().(QueryDecodeError)
+	if !ok || decodeErr.Field() != "extra" || decodeErr.Actual() != "boolean" {
+		t.Fatalf("Unexpected error: %v", res.Err())
+	}
+
+	res = testStrictQueryResults(`{"*":"*","name":"string"}`, `{"name":"a","extra":true}`)
+	if !res.Next(&row) {
+		t.Fatalf("Expected fields not in a signature with * to be allowed but error was %v", res.Err())
+	}
+}
+
+func TestQueryStrictDecodingGoType(t *testing.T) {
+	// The signature only says that the field is JSON, so the failure comes from decoding into the struct.
+	res := testStrictQueryResults(`{"age":"json"}`, `{"age":"ten"}`)
+
+	var u struct {
+		Age int `json:"age"`
+	}
+	if res.Next(&u) {
+		t.Fatalf("Expected row which cannot be decoded into the struct to fail")
+	}
+	decodeErr, ok := res.Err().(QueryDecodeError)
+	if !ok || decodeErr.Field() != "age" || decodeErr.Expected() != "int" || decodeErr.Actual() != "string" {
+		t.Fatalf("Unexpected error: %v", res.Err())
+	}
+}
@@ -2,6 +2,7 @@ package gocb
 
 import (
 	"context"
+	"reflect"
 	"strconv"
 	"strings"
 	"time"
@@ -46,8 +47,47 @@ type QueryOptions struct {
 	NamedParameters      map[string]interface{}
 	Context              context.Context
 	ParentSpanContext    opentracing.SpanContext
+	// ClientContextID is an identifier sent with the query, it is returned in the results and allows the
+	// request to be correlated, e.g. in proxy or audit logs.
+	ClientContextID string
+	// TransactionID is the id of the server side transaction which the statement is part of. Statements
+	// which are part of a transaction must all be sent to the same query node, see Cluster.QueryTransaction.
+	TransactionID string
+	// TransactionImplicit runs the statement within its own single statement transaction.
+	TransactionImplicit bool
+	// QueryContext is the namespace and bucket, e.g. "default:`travel-sample`", against which keyspaces in the
+	// statement which are not fully qualified are resolved.
+	QueryContext string
 	// Custom allows specifying custom query options.
 	Custom map[string]interface{}
+	// Progress is called every ProgressInterval, defaulting to 1 second, whilst the query executes.  It can be
+	// used to emit liveness signals for long running queries or to abort them by returning an error.
+	Progress         QueryProgressFunc
+	ProgressInterval time.Duration
+	// StrictDecoding checks each row read with Next or One against the types in the signature of the query, and
+	// reports rows which cannot be decoded with a QueryDecodeError naming the field and the type it was expected to
+	// be rather than with the error from encoding/json.
+	StrictDecoding bool
+	// MaxBufferedRows reads the rows of the results into memory before they are returned, rather than streaming
+	// them, and is the most rows that will be read, the query fails with ErrResultTooLarge if more rows are
+	// returned.  0 means that the rows are streamed.  A LIMIT is added to SELECT statements, or an existing
+	// larger one lowered, so that the query service stops once it has returned one more row than this.
+	MaxBufferedRows int
+	// LogWarnings logs any warnings returned by the query service, such as the use of deprecated syntax, at the
+	// warn level as well as making them available from QueryResults.Warnings.
+	LogWarnings bool
+	// PreparedName is the name that a Prepared query is prepared with.  Application instances which use the same
+	// name for the same statement share its plan, with enhanced prepared statements an instance executes the plan
+	// prepared by its peers rather than preparing the statement again.  The name must always be used for the
+	// same statement and query context.  If empty the name is derived from ClusterOptions.PreparedNamePrefix, or
+	// chosen by the query service if there is no prefix.
+	PreparedName string
+	// CacheFor, if set, serves the results of the query from a client side cache for up to this long after they
+	// were fetched, so that dashboards repeatedly running the same expensive query do not run it each time.
+	// Results are cached by the statement and its parameters and options, see ClusterOptions.QueryResultCacheSize
+	// which must be set to enable the cache.  The rows of cached results are read into memory rather than
+	// streamed.  Queries which are part of a transaction are never cached.
+	CacheFor time.Duration
 }
 
 func (opts *QueryOptions) toMap(statement string) (map[string]interface{}, error) {
@@ -74,6 +114,9 @@ func (opts *QueryOptions) toMap(statement string) (map[string]interface{}, error
 	}
 
 	if opts.ConsistentWith != nil {
+		if opts.ConsistentWith.data == nil || len(*opts.ConsistentWith.data) == 0 {
+			return nil, errors.New("ConsistentWith has no mutation tokens, UseMutationTokens must be enabled on the bucket")
+		}
 		execOpts["scan_consistency"] = "at_plus"
 		execOpts["scan_vectors"] = opts.ConsistentWith
 	}
@@ -82,6 +125,26 @@ func (opts *QueryOptions) toMap(statement string) (map[string]interface{}, error
 		execOpts["profile"] = opts.Profile
 	}
 
+	if opts.ClientContextID != "" {
+		execOpts["client_context_id"] = opts.ClientContextID
+	}
+
+	if opts.QueryContext != "" {
+		execOpts["query_context"] = opts.QueryContext
+	}
+
+	if opts.TransactionID != "" && opts.TransactionImplicit {
+		return nil, errors.New("TransactionID and TransactionImplicit must be used exclusively")
+	}
+
+	if opts.TransactionID != "" {
+		execOpts["txid"] = opts.TransactionID
+	}
+
+	if opts.TransactionImplicit {
+		execOpts["tximplicit"] = true
+	}
+
 	if opts.Custom != nil {
 		for k, v := range opts.Custom {
 			execOpts[k] = v
@@ -123,3 +186,102 @@ func (opts *QueryOptions) toMap(statement string) (map[string]interface{}, error
 
 	return execOpts, nil
 }
+
+// NamedParametersFromStruct creates a set of named parameters from the exported fields of a struct, suitable for use
+// as QueryOptions.NamedParameters. Parameter names are taken from the `json` struct tag where present, falling back
+// to the field name. Fields tagged with `json:"-"` are skipped, as are zero valued fields tagged with omitempty.
+// Embedded structs have their fields promoted in the same way as with JSON encoding.
+func NamedParametersFromStruct(v interface{}) (map[string]interface{}, error) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil, errors.New("named parameters struct cannot be nil")
+		}
+		val = val.Elem()
+	}
+
+	if val.Kind() != reflect.Struct {
+		return nil, errors.New("named parameters must be derived from a struct")
+	}
+
+	params := make(map[string]interface{})
+	addStructNamedParameters(val, params)
+
+	return params, nil
+}
+
+func addStructNamedParameters(val reflect.Value, params map[string]interface{}) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldVal := val.Field(i)
+
+		name, omitEmpty, skip := parseJSONFieldTag(field.Tag.Get("json"))
+		if skip {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			if fieldVal.Kind() == reflect.Ptr {
+				if fieldVal.IsNil() {
+					continue
+				}
+				fieldVal = fieldVal.Elem()
+			}
+			if fieldVal.Kind() == reflect.Struct {
+				addStructNamedParameters(fieldVal, params)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+
+		if omitEmpty && isEmptyValue(fieldVal) {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		params[name] = fieldVal.Interface()
+	}
+}
+
+// parseJSONFieldTag parses a json struct tag in the same way as encoding/json, returning the name of the field,
+// empty if the Go field name is used, whether it has the omitempty option and whether the field is skipped.
+func parseJSONFieldTag(tag string) (name string, omitEmpty bool, skip bool) {
+	if tag == "-" {
+		return "", false, true
+	}
+
+	parts := strings.Split(tag, ",")
+	for _, opt := range parts[1:] {
+		if opt == "omitempty" {
+			omitEmpty = true
+		}
+	}
+
+	return parts[0], omitEmpty, false
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
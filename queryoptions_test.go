@@ -7,6 +7,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
 )
 
 func TestQueryOptionsToMap(t *testing.T) {
@@ -134,6 +136,48 @@ func TestQueryOptionsToMap(t *testing.T) {
 	}
 }
 
+func TestNamedParametersFromStruct(t *testing.T) {
+	type embedded struct {
+		Country string `json:"country"`
+	}
+	type params struct {
+		embedded
+		Name     string `json:"name"`
+		Type     string `json:"type,omitempty"`
+		Limit    int
+		Ignored  string `json:"-"`
+		internal string
+	}
+
+	namedParams, err := NamedParametersFromStruct(&params{
+		embedded: embedded{Country: "United States"},
+		Name:     "21st Amendment Brewery Cafe",
+		Limit:    10,
+		Ignored:  "ignored",
+		internal: "internal",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error but was %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"country": "United States",
+		"name":    "21st Amendment Brewery Cafe",
+		"Limit":   10,
+	}
+	if len(namedParams) != len(expected) {
+		t.Fatalf("Expected %d named parameters but was %d, %v", len(expected), len(namedParams), namedParams)
+	}
+	for k, v := range expected {
+		testAssertOption(t, v, k, namedParams)
+	}
+
+	_, err = NamedParametersFromStruct("not a struct")
+	if err == nil {
+		t.Fatalf("Expected error when deriving named parameters from a non-struct")
+	}
+}
+
 func testAssertOption(t *testing.T, expected interface{}, key string, optMap map[string]interface{}) {
 	if expected == nil {
 		if val, ok := optMap[key]; ok {
@@ -165,7 +209,10 @@ func testCreateQueryOptions(seed int64) *QueryOptions {
 
 	randVal = rand.Intn(2)
 	if randVal == 1 {
-		opts.ConsistentWith = NewMutationState(MutationToken{bucketName: "default"})
+		opts.ConsistentWith = NewMutationState(MutationToken{
+			token:      gocbcore.MutationToken{VbId: 1, VbUuid: 1234, SeqNo: 10},
+			bucketName: "default",
+		})
 	}
 
 	randVal = rand.Intn(2)
@@ -229,3 +276,12 @@ func testCreateQueryOptions(seed int64) *QueryOptions {
 
 	return opts
 }
+
+func TestQueryOptionsConsistentWithoutTokens(t *testing.T) {
+	// Operations return an empty token when mutation tokens are not enabled on the bucket.
+	opts := &QueryOptions{ConsistentWith: NewMutationState(MutationToken{bucketName: "default"})}
+	_, err := opts.toMap("select * from default")
+	if err == nil {
+		t.Fatalf("Expected error when ConsistentWith has no mutation tokens")
+	}
+}
@@ -0,0 +1,33 @@
+package gocb
+
+import (
+	"github.com/google/uuid"
+)
+
+// IDGenerator returns a new identifier each time it is called.  It is used for the client context ids sent with
+// query, analytics and search requests, and for the ids of ping and diagnostics reports and change streams, so that
+// they can match the trace or request ids used elsewhere, e.g. in application logs.  It must be safe for concurrent
+// use.  KV operations are correlated by opaques which are assigned by the connection and cannot be replaced.
+type IDGenerator func() string
+
+// newID returns an id from the configured IDGenerator, or a random uuid if there is none or it returns an
+// empty id.
+func (c *Cluster) newID() string {
+	if c != nil && c.ssb.idGenerator != nil {
+		if id := c.ssb.idGenerator(); id != "" {
+			return id
+		}
+	}
+
+	return uuid.New().String()
+}
+
+// generatedID returns an id from the configured IDGenerator, or an empty string if there is none.  It is used for
+// ids which are only sent when the user has provided them or has configured a generator.
+func (c *Cluster) generatedID() string {
+	if c == nil || c.ssb.idGenerator == nil {
+		return ""
+	}
+
+	return c.ssb.idGenerator()
+}
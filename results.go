@@ -12,6 +12,7 @@ import (
 type GetResult struct {
 	id             string
 	flags          uint32
+	datatype       uint8
 	cas            Cas
 	expiration     uint32
 	withExpiration bool
@@ -23,6 +24,18 @@ func (d *GetResult) Cas() Cas {
 	return d.cas
 }
 
+// Flags returns the flags stored with the document, which describe the format of its content.  These are the
+// common flags, or the legacy flags of documents written by older SDKs, decoded by DefaultDecode.
+func (d *GetResult) Flags() uint32 {
+	return d.flags
+}
+
+// Datatype returns the datatype that the server reported for the document, such as whether its content is JSON.
+// It is 0 for results which were not read directly from the server, such as projections and cached documents.
+func (d *GetResult) Datatype() uint8 {
+	return d.datatype
+}
+
 // HasExpiration verifies whether or not the result has an expiration value.
 func (d *GetResult) HasExpiration() bool {
 	return d.withExpiration
@@ -86,6 +99,7 @@ type LookupInResult struct {
 	pathMap        map[string]int
 	expiration     uint32
 	withExpiration bool
+	deleted        bool
 }
 
 type lookupInPartial struct {
@@ -131,6 +145,12 @@ func (lir *LookupInResult) Exists(idx int) bool {
 	return lir.contents[idx].exists()
 }
 
+// Deleted returns whether the document was deleted, this can only be true when LookupInOptions.AccessDeleted
+// was set.
+func (lir *LookupInResult) Deleted() bool {
+	return lir.deleted
+}
+
 // HasExpiration verifies whether or not the result has an expiration value set on it.
 func (lir *LookupInResult) HasExpiration() bool {
 	return lir.withExpiration
@@ -158,10 +178,52 @@ func (d *ExistsResult) Exists() bool {
 	return d.keyState != gocbcore.KeyStateNotFound && d.keyState != gocbcore.KeyStateDeleted
 }
 
+// GetMetaResult is the return type of GetMeta operations.
+type GetMetaResult struct {
+	id         string
+	cas        Cas
+	flags      uint32
+	datatype   uint8
+	expiration uint32
+	seqNo      uint64
+	deleted    bool
+}
+
+// Cas returns the cas of the document.
+func (d *GetMetaResult) Cas() Cas {
+	return d.cas
+}
+
+// Flags returns the flags stored with the document.
+func (d *GetMetaResult) Flags() uint32 {
+	return d.flags
+}
+
+// Datatype returns the datatype of the document's contents, as stored by the server.
+func (d *GetMetaResult) Datatype() uint8 {
+	return d.datatype
+}
+
+// Expiration returns the expiration value of the document, zero if the document does not expire.
+func (d *GetMetaResult) Expiration() uint32 {
+	return d.expiration
+}
+
+// SeqNo returns the sequence number of the last mutation of the document.
+func (d *GetMetaResult) SeqNo() uint64 {
+	return d.seqNo
+}
+
+// Deleted returns whether the document has been deleted, i.e. only its tombstone remains.
+func (d *GetMetaResult) Deleted() bool {
+	return d.deleted
+}
+
 // MutationResult is the return type of any store related operations. It contains Cas and mutation tokens.
 type MutationResult struct {
-	mt  MutationToken
-	cas Cas
+	mt       MutationToken
+	cas      Cas
+	document *GetResult
 }
 
 // MutationToken returns the mutation token belonging to an operation.
@@ -174,6 +236,11 @@ func (mr MutationResult) Cas() Cas {
 	return mr.cas
 }
 
+// Document returns the document as written by the operation when FetchDocumentAfterMutation was set, or nil.
+func (mr MutationResult) Document() *GetResult {
+	return mr.document
+}
+
 // CounterResult is the return type of counter operations.
 type CounterResult struct {
 	mt      MutationToken
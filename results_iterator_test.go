@@ -0,0 +1,195 @@
+package gocb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+// testResultsIterator adapts the results of each service to a common form so that they can all be checked for
+// the same iterator semantics.
+type testResultsIterator struct {
+	next  func() bool
+	close func() error
+	err   func() error
+}
+
+func testRawRows(rows []string) []json.RawMessage {
+	raw := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		raw[i] = json.RawMessage(row)
+	}
+	return raw
+}
+
+// testStreamedCluster returns a cluster whose services all respond with body, with rows substituted for the
+// placeholder ROWS, so that the results of each service are read from the response as they are iterated.
+func testStreamedCluster(body string, rows []string) *Cluster {
+	body = strings.Replace(body, "ROWS", strings.Join(rows, ","), 1)
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				Endpoint:   "http://localhost:8091",
+				StatusCode: 200,
+				Body:       &testReadCloser{bytes.NewBufferString(body), nil},
+			}, nil
+		},
+	}
+	return testGetClusterForHTTP(provider, 10*time.Second, 10*time.Second, 10*time.Second)
+}
+
+// testFailedResultsIterator is returned by the streamed factories when the results could not be opened, so that
+// the tests report the error rather than any rows.
+func testFailedResultsIterator(err error) testResultsIterator {
+	return testResultsIterator{func() bool { return false }, func() error { return err }, func() error { return err }}
+}
+
+var testResultsIteratorFactories = map[string]func(rows []string) testResultsIterator{
+	"query": func(rows []string) testResultsIterator {
+		res := &QueryResults{index: -1, rows: testRawRows(rows)}
+		var v int
+		return testResultsIterator{func() bool { return res.Next(&v) }, res.Close, res.Err}
+	},
+	"analytics": func(rows []string) testResultsIterator {
+		res := &AnalyticsResults{rows: &analyticsRows{index: -1, rows: testRawRows(rows)}}
+		var v int
+		return testResultsIterator{func() bool { return res.Next(&v) }, res.Close, res.Err}
+	},
+	"analytics deferred": func(rows []string) testResultsIterator {
+		res := &analyticsDeferredResultHandle{
+			status:    "success",
+			hasResult: true,
+			rows:      &analyticsRows{index: -1, rows: testRawRows(rows)},
+		}
+		var v int
+		return testResultsIterator{func() bool { return res.Next(&v) }, res.Close, res.Err}
+	},
+	"view": func(rows []string) testResultsIterator {
+		res := &ViewResults{index: -1, rows: testRawRows(rows)}
+		var v int
+		return testResultsIterator{func() bool { return res.Next(&v) }, res.Close, res.Err}
+	},
+	"search": func(rows []string) testResultsIterator {
+		res := &SearchResults{data: &searchResponse{}}
+		for _, row := range rows {
+			res.data.Hits = append(res.data.Hits, SearchResultHit{Id: row})
+		}
+		var hit SearchResultHit
+		return testResultsIterator{func() bool { return res.Next(&hit) }, res.Close, res.Err}
+	},
+	"query streamed": func(rows []string) testResultsIterator {
+		cluster := testStreamedCluster(`{"requestID":"r","results":[ROWS],"status":"success"}`, rows)
+		res, err := cluster.Query("SELECT a FROM t", nil)
+		if err != nil {
+			return testFailedResultsIterator(err)
+		}
+		var v int
+		return testResultsIterator{func() bool { return res.Next(&v) }, res.Close, res.Err}
+	},
+	"analytics streamed": func(rows []string) testResultsIterator {
+		cluster := testStreamedCluster(`{"requestID":"r","results":[ROWS],"status":"success"}`, rows)
+		res, err := cluster.AnalyticsQuery("SELECT a FROM t", nil)
+		if err != nil {
+			return testFailedResultsIterator(err)
+		}
+		var v int
+		return testResultsIterator{func() bool { return res.Next(&v) }, res.Close, res.Err}
+	},
+	"search streamed": func(rows []string) testResultsIterator {
+		hits := make([]string, len(rows))
+		for i, row := range rows {
+			hits[i] = `{"id":"` + row + `"}`
+		}
+		cluster := testStreamedCluster(`{"status":{"total":1,"successful":1},"hits":[ROWS],"total_hits":2}`, hits)
+		res, err := cluster.SearchQuery(SearchQuery{Name: "idx", Query: map[string]interface{}{"match": "beer"}},
+			&SearchQueryOptions{StreamHits: true})
+		if err != nil {
+			return testFailedResultsIterator(err)
+		}
+		var hit SearchResultHit
+		return testResultsIterator{func() bool { return res.Next(&hit) }, res.Close, res.Err}
+	},
+}
+
+func TestResultsIteratorExhausted(t *testing.T) {
+	for name, factory := range testResultsIteratorFactories {
+		it := factory([]string{"1", "2"})
+		if !it.next() || !it.next() {
+			t.Fatalf("%s: expected 2 rows", name)
+		}
+		if it.next() || it.next() {
+			t.Fatalf("%s: expected no more rows once exhausted", name)
+		}
+		if err := it.close(); err != nil {
+			t.Fatalf("%s: expected close to succeed but was %v", name, err)
+		}
+		if err := it.close(); err != nil {
+			t.Fatalf("%s: expected second close to succeed but was %v", name, err)
+		}
+		if it.err() != nil {
+			t.Fatalf("%s: expected no error but was %v", name, it.err())
+		}
+	}
+}
+
+func TestResultsIteratorNextAfterClose(t *testing.T) {
+	for name, factory := range testResultsIteratorFactories {
+		it := factory([]string{"1", "2"})
+		if !it.next() {
+			t.Fatalf("%s: expected a row", name)
+		}
+		if err := it.close(); err != nil {
+			t.Fatalf("%s: expected close to succeed but was %v", name, err)
+		}
+		if it.next() {
+			t.Fatalf("%s: expected no rows after close", name)
+		}
+	}
+}
+
+func TestResultsIteratorErrorLatching(t *testing.T) {
+	for name, factory := range testResultsIteratorFactories {
+		if strings.HasPrefix(name, "search") {
+			// Search hits are decoded up front, or are test rows embedded in a valid hit when streamed, so
+			// reading them cannot fail.
+			continue
+		}
+
+		it := factory([]string{"1", `"not a number"`, "3"})
+		if !it.next() {
+			t.Fatalf("%s: expected first row to be read", name)
+		}
+		if it.next() {
+			t.Fatalf("%s: expected reading an invalid row to fail", name)
+		}
+		if it.next() {
+			t.Fatalf("%s: expected no rows after an error", name)
+		}
+
+		err := it.err()
+		if err == nil {
+			t.Fatalf("%s: expected decode error to be reported", name)
+		}
+		if it.close() != err || it.close() != err || it.err() != err {
+			t.Fatalf("%s: expected the first error to be reported by every call", name)
+		}
+	}
+}
+
+func TestSearchResultsPartialErrorLatched(t *testing.T) {
+	partialErr := errors.New("partial")
+	res := &SearchResults{data: &searchResponse{Hits: []SearchResultHit{{Id: "a"}}}, err: partialErr}
+
+	var hit SearchResultHit
+	if !res.Next(&hit) || hit.Id != "a" {
+		t.Fatalf("Expected partial results to still be readable")
+	}
+	if res.Close() != partialErr || res.Close() != partialErr || res.Err() != partialErr {
+		t.Fatalf("Expected the partial results error to be reported")
+	}
+}
@@ -5,12 +5,9 @@ type Scope struct {
 }
 
 func newScope(bucket *Bucket, scopeName string) *Scope {
-	scope := &Scope{
-		sb: bucket.stateBlock(),
+	return &Scope{
+		sb: bucket.stateBlock().withScope(scopeName),
 	}
-	scope.sb.ScopeName = scopeName
-	scope.sb.recacheClient()
-	return scope
 }
 
 func (s *Scope) clone() *Scope {
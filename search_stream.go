@@ -0,0 +1,140 @@
+package gocb
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// openSearchHitStream reads a search response from r up to and including its first hit, which is returned along
+// with the stream of the remaining hits.  Hits are only streamed once the first has been read, so that errors
+// which the search service returns before any hits are still returned with the results.  If the response has no
+// hits, or has errors, it is read in full into ftsResp instead and the returned hit is nil.
+func openSearchHitStream(r io.Reader, ftsResp *searchResponse) (*rowStream, json.RawMessage, error) {
+	hits, err := newRowStream(r, "hits")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	first, err := hits.nextRow()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if first != nil {
+		err = hits.decodeFields(ftsResp)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(ftsResp.Errors) == 0 {
+			return hits, first, nil
+		}
+	}
+
+	var rows []json.RawMessage
+	if first != nil {
+		rows = append(rows, first)
+	}
+	rows, err = readStreamRows(hits, rows, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	*ftsResp = searchResponse{}
+	err = hits.decodeFields(ftsResp)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, row := range rows {
+		var hit SearchResultHit
+		err = json.Unmarshal(row, &hit)
+		if err != nil {
+			return nil, nil, err
+		}
+		ftsResp.Hits = append(ftsResp.Hits, hit)
+	}
+
+	return nil, nil, nil
+}
+
+// nextStreamedHit assigns the next hit read from the response body into hitPtr, returning false once all hits
+// have been read or an error occurred, in which case the error is set on the results.
+func (r *SearchResults) nextStreamedHit(hitPtr *SearchResultHit) bool {
+	if r.stream.finished {
+		return false
+	}
+
+	for {
+		row, err := r.stream.next()
+		if err != nil {
+			r.err = err
+			r.finishStream()
+			return false
+		}
+
+		if row == nil {
+			r.completeStream()
+			r.finishStream()
+			return false
+		}
+
+		var hit SearchResultHit
+		if err := json.Unmarshal(row, &hit); err != nil {
+			r.err = errors.Wrap(err, "failed to decode search hit")
+			r.finishStream()
+			return false
+		}
+
+		if r.seen != nil {
+			if _, ok := r.seen[hit.Id]; ok {
+				r.duplicatesRemoved++
+				continue
+			}
+			r.seen[hit.Id] = struct{}{}
+		}
+
+		*hitPtr = hit
+		return true
+	}
+}
+
+// completeStream sets the metadata and any errors from the fields of the response, most of which follow the hits.
+func (r *SearchResults) completeStream() {
+	var ftsResp searchResponse
+	err := r.stream.rows.decodeFields(&ftsResp)
+	if err != nil {
+		r.err = errors.Wrap(err, "failed to decode search response body")
+		return
+	}
+
+	*r.data = ftsResp
+	if len(ftsResp.Errors) > 0 {
+		r.err = newSearchMultiError(&ftsResp, r.endpoint, 200)
+	}
+}
+
+// discardStream reads the hits which have not been read so that the metadata which follows them is available,
+// unless more than maxHTTPBodyDrainBytes of hits remain.
+func (r *SearchResults) discardStream() {
+	s := r.stream
+	if s == nil || s.finished || r.err != nil {
+		return
+	}
+
+	complete, err := s.discard()
+	if err != nil {
+		r.err = err
+		return
+	}
+	if complete {
+		r.completeStream()
+	}
+}
+
+// finishStream closes the response body and releases the request.  It is safe to call more than once.
+func (r *SearchResults) finishStream() {
+	if r.stream != nil {
+		r.stream.finish()
+	}
+}
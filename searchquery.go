@@ -4,7 +4,8 @@ type searchQueryData struct {
 	Query interface{} `json:"query,omitempty"`
 }
 
-// SearchQuery represents a pending search query.
+// SearchQuery represents a pending search query.  Name may be the name of either a search index or a search
+// index alias, querying an alias searches across all of the indexes that it targets.
 type SearchQuery struct {
 	Name  string
 	Query interface{}
@@ -27,8 +27,8 @@ type searchQueryHighlightData struct {
 	Fields []string `json:"fields,omitempty"`
 }
 type searchQueryConsistencyData struct {
-	Level   string         `json:"level,omitempty"`
-	Vectors *MutationState `json:"vectors,omitempty"`
+	Level   string                       `json:"level,omitempty"`
+	Vectors map[string]map[string]uint64 `json:"vectors,omitempty"`
 }
 type searchQueryCtlData struct {
 	Timeout     uint                        `json:"timeout,omitempty"`
@@ -65,9 +65,25 @@ type SearchQueryOptions struct {
 	ConsistentWith    *MutationState
 	Context           context.Context
 	ParentSpanContext opentracing.SpanContext
+	// ClientContextID is an identifier sent with the request to allow it to be correlated, e.g. in
+	// proxy or audit logs.
+	ClientContextID string
+	// DeduplicateHits removes any hits with the same document id as a higher ranked hit.  FTS can return
+	// duplicate hits across index partitions in rare partial rollback scenarios.
+	DeduplicateHits bool
+	// StreamHits reads the hits from the response body as they are iterated with NextHit, rather than reading
+	// them all before the results are returned, so that large result sets are not held in memory.  The status,
+	// facets and other metadata are only available once every hit has been read, and Hits returns nil.  It is
+	// ignored by SearchPage when facets are requested.
+	StreamHits bool
+
+	// facetsOnly requests no hits, only the facets, as a zero Limit means the default number of hits.
+	facetsOnly bool
 }
 
-func (opts *SearchQueryOptions) toOptionsData() (*searchQueryOptionsData, error) {
+// toOptionsData returns the options to send for a query of indexName, whose source bucket is sourceBucket.  The
+// source bucket is only needed for ConsistentWith, and may be empty for an index alias.
+func (opts *SearchQueryOptions) toOptionsData(indexName, sourceBucket string) (*searchQueryOptionsData, error) {
 	data := &searchQueryOptionsData{}
 
 	data.Size = opts.Limit
@@ -114,13 +130,25 @@ func (opts *SearchQueryOptions) toOptionsData() (*searchQueryOptionsData, error)
 	}
 
 	if opts.ConsistentWith != nil {
+		vectors, err := opts.ConsistentWith.searchVectors(sourceBucket)
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) == 0 {
+			if sourceBucket != "" {
+				return nil, errors.Errorf("ConsistentWith has no mutation tokens for bucket %s, which index %s is built on",
+					sourceBucket, indexName)
+			}
+			return nil, errors.New("ConsistentWith has no mutation tokens, UseMutationTokens must be enabled on the bucket")
+		}
+
 		if data.Ctl == nil {
 			data.Ctl = &searchQueryCtlData{}
 		}
 
 		data.Ctl.Consistency = &searchQueryConsistencyData{}
 		data.Ctl.Consistency.Level = "at_plus"
-		data.Ctl.Consistency.Vectors = opts.ConsistentWith
+		data.Ctl.Consistency.Vectors = map[string]map[string]uint64{indexName: vectors}
 	}
 
 	return data, nil
@@ -0,0 +1,104 @@
+package gocb
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// serverDurationUnits maps the units which services use in durations to their length.  As well as the units
+// accepted by time.ParseDuration it includes longer names and the Greek letter mu for microseconds.
+var serverDurationUnits = map[string]time.Duration{
+	"ns":           time.Nanosecond,
+	"nanosecond":   time.Nanosecond,
+	"nanoseconds":  time.Nanosecond,
+	"us":           time.Microsecond,
+	"µs":           time.Microsecond, // U+00B5 micro sign
+	"μs":           time.Microsecond, // U+03BC Greek small letter mu
+	"microsecond":  time.Microsecond,
+	"microseconds": time.Microsecond,
+	"ms":           time.Millisecond,
+	"millisecond":  time.Millisecond,
+	"milliseconds": time.Millisecond,
+	"s":            time.Second,
+	"sec":          time.Second,
+	"secs":         time.Second,
+	"second":       time.Second,
+	"seconds":      time.Second,
+	"m":            time.Minute,
+	"min":          time.Minute,
+	"mins":         time.Minute,
+	"minute":       time.Minute,
+	"minutes":      time.Minute,
+	"h":            time.Hour,
+	"hr":           time.Hour,
+	"hrs":          time.Hour,
+	"hour":         time.Hour,
+	"hours":        time.Hour,
+}
+
+// parseServerDuration parses a duration reported by the query or analytics service, such as the elapsed time of a
+// request.  It accepts everything that time.ParseDuration does, and also tolerates the variations that services
+// occasionally return: a bare number, which is taken to be seconds, spaces between values and units, upper case or
+// long unit names, commas as decimal separators and trailing characters which are not part of the duration.
+func parseServerDuration(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err == nil {
+		return d, nil
+	}
+
+	s := strings.TrimRightFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	s = strings.TrimSpace(strings.Replace(s, ",", ".", -1))
+	if s == "" {
+		return 0, errors.Errorf("invalid duration %q", value)
+	}
+
+	negative := false
+	if s[0] == '-' || s[0] == '+' {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	var total float64
+	for s != "" {
+		i := strings.IndexFunc(s, func(r rune) bool {
+			return !unicode.IsDigit(r) && r != '.'
+		})
+		if i == -1 {
+			i = len(s)
+		}
+		number, err := strconv.ParseFloat(s[:i], 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid duration %q", value)
+		}
+		s = strings.TrimLeftFunc(s[i:], unicode.IsSpace)
+
+		j := strings.IndexFunc(s, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+		if j == -1 {
+			j = len(s)
+		}
+		unit := time.Second
+		if j > 0 {
+			var ok bool
+			unit, ok = serverDurationUnits[s[:j]]
+			if !ok {
+				return 0, errors.Errorf("unknown unit %q in duration %q", s[:j], value)
+			}
+		}
+		s = strings.TrimLeftFunc(s[j:], unicode.IsSpace)
+
+		total += number * float64(unit)
+	}
+
+	if negative {
+		total = -total
+	}
+	return time.Duration(total), nil
+}
@@ -0,0 +1,46 @@
+package gocb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseServerDuration(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"1m2.3s", time.Minute + 2300*time.Millisecond},
+		{"12.345678ms", 12345678 * time.Nanosecond},
+		{"0", 0},
+		{"0s", 0},
+		{"2", 2 * time.Second},
+		{"1.2ms·", 1200 * time.Microsecond},
+		{"1.2ms ", 1200 * time.Microsecond},
+		{"1.5 ms", 1500 * time.Microsecond},
+		{"1.5MS", 1500 * time.Microsecond},
+		{"3 seconds", 3 * time.Second},
+		{"1 min 30 sec", 90 * time.Second},
+		{"10μs", 10 * time.Microsecond},
+		{"10µs", 10 * time.Microsecond},
+		{"1,5s", 1500 * time.Millisecond},
+		{"-1.5s", -1500 * time.Millisecond},
+	}
+
+	for _, test := range tests {
+		d, err := parseServerDuration(test.value)
+		if err != nil {
+			t.Fatalf("Expected %q to parse but was %v", test.value, err)
+		}
+		if d != test.expected {
+			t.Fatalf("Expected %q to be %s but was %s", test.value, test.expected, d)
+		}
+	}
+
+	for _, value := range []string{"", "ms", "1.2.3s", "5 fortnights", "·"} {
+		_, err := parseServerDuration(value)
+		if err == nil {
+			t.Fatalf("Expected %q to fail to parse", value)
+		}
+	}
+}
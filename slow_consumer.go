@@ -0,0 +1,66 @@
+package gocb
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SlowConsumerRecorder can be implemented by a MetricsRecorder to be notified when query or analytics results are
+// held open for longer than ClusterOptions.SlowConsumerThreshold without being fully read or closed.
+// Implementations must be safe for concurrent use.
+type SlowConsumerRecorder interface {
+	// RecordSlowConsumer is called with the service, "query" or "analytics", once the results of a request have
+	// been held open for held.
+	RecordSlowConsumer(service string, held time.Duration)
+}
+
+// consumerWatch detects results which are held open for longer than a threshold, which usually means that the
+// code reading them has stalled or has leaked them without closing them.
+type consumerWatch struct {
+	timer   *time.Timer
+	start   time.Time
+	service string
+	id      string
+	slow    uint32
+}
+
+// watchConsumer starts watching the results of a request to service, identified in logs by id.  It returns nil
+// if no threshold is configured.
+func (c *Cluster) watchConsumer(service, id string) *consumerWatch {
+	threshold := c.ssb.slowConsumerThreshold
+	if threshold <= 0 {
+		return nil
+	}
+
+	w := &consumerWatch{
+		start:   time.Now(),
+		service: service,
+		id:      id,
+	}
+	recorder, _ := c.sb.MetricsRecorder.(SlowConsumerRecorder)
+	w.timer = time.AfterFunc(threshold, func() {
+		atomic.StoreUint32(&w.slow, 1)
+		held := time.Since(w.start)
+		logWarnf("The results of %s request %s have been held open for %s without being fully read or closed, "+
+			"make sure that results are closed once they are no longer needed", service, id, held)
+		if recorder != nil {
+			recorder.RecordSlowConsumer(service, held)
+		}
+	})
+
+	return w
+}
+
+// done stops watching the results once they have been fully read or closed.  It is safe to call on a nil watch
+// and more than once.
+func (w *consumerWatch) done() {
+	if w == nil {
+		return
+	}
+
+	w.timer.Stop()
+	if atomic.CompareAndSwapUint32(&w.slow, 1, 2) {
+		logWarnf("The results of %s request %s were released after being held open for %s", w.service, w.id,
+			time.Since(w.start))
+	}
+}
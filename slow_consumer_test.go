@@ -0,0 +1,69 @@
+package gocb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+type slowConsumerRecorder struct {
+	*CollectionMetrics
+	slow chan string
+}
+
+func (r *slowConsumerRecorder) RecordSlowConsumer(service string, held time.Duration) {
+	r.slow <- service
+}
+
+func TestSlowConsumerDetected(t *testing.T) {
+	provider := &mockHTTPProvider{
+		doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+			return &gocbcore.HttpResponse{
+				StatusCode: 200,
+				Body: &testReadCloser{bytes.NewBufferString(`{"results":[{"id":1},{"id":2}],` +
+					`"status":"success"}`), nil},
+			}, nil
+		},
+	}
+	cluster := testGetClusterForHTTP(provider, time.Second, time.Second, time.Second)
+	cluster.ssb.slowConsumerThreshold = 20 * time.Millisecond
+	recorder := &slowConsumerRecorder{CollectionMetrics: NewCollectionMetrics(), slow: make(chan string, 10)}
+	cluster.sb.MetricsRecorder = recorder
+
+	closed, err := cluster.Query("SELECT 1", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	closed.Close()
+
+	var row interface{}
+	exhausted, err := cluster.Query("SELECT 2", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	for exhausted.Next(&row) {
+	}
+
+	held, err := cluster.Query("SELECT 3", nil)
+	if err != nil {
+		t.Fatalf("Expected query to succeed but error was %v", err)
+	}
+	held.Next(&row)
+
+	select {
+	case service := <-recorder.slow:
+		if service != "query" {
+			t.Fatalf("Expected slow consumer of the query service but was %s", service)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected results held open to be reported as a slow consumer")
+	}
+
+	held.Close()
+	time.Sleep(40 * time.Millisecond)
+	if len(recorder.slow) != 0 {
+		t.Fatalf("Expected only the results held open to be reported but had %d more", len(recorder.slow))
+	}
+}
@@ -7,14 +7,13 @@ import (
 	"strconv"
 
 	"github.com/opentracing/opentracing-go"
-	"github.com/pkg/errors"
 )
 
 // SpatialViewOptions represents the options available when executing a spatial query.
 type SpatialViewOptions struct {
-	Stale StaleMode
-	Skip  uint
-	Limit uint
+	ScanConsistency ViewScanConsistency
+	Skip            uint
+	Limit           uint
 	// Bbox specifies the bounding region to use for the spatial query.
 	Bbox              []float64
 	Development       bool
@@ -26,16 +25,12 @@ type SpatialViewOptions struct {
 func (opts *SpatialViewOptions) toURLValues() (*url.Values, error) {
 	options := &url.Values{}
 
-	if opts.Stale != 0 {
-		if opts.Stale == Before {
-			options.Set("stale", "false")
-		} else if opts.Stale == None {
-			options.Set("stale", "ok")
-		} else if opts.Stale == After {
-			options.Set("stale", "update_after")
-		} else {
-			return nil, errors.New("Unexpected stale option")
+	if opts.ScanConsistency != 0 {
+		stale, err := opts.ScanConsistency.staleValue()
+		if err != nil {
+			return nil, err
 		}
+		options.Set("stale", stale)
 	}
 
 	if opts.Skip != 0 {
@@ -43,7 +38,7 @@ func (opts *SpatialViewOptions) toURLValues() (*url.Values, error) {
 	}
 
 	if opts.Limit != 0 {
-		options.Set("limit", strconv.FormatUint(uint64(opts.Skip), 10))
+		options.Set("limit", strconv.FormatUint(uint64(opts.Limit), 10))
 	}
 
 	if len(opts.Bbox) == 4 {
@@ -2,6 +2,7 @@ package gocb
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -22,12 +23,48 @@ type collectionStateBlock struct {
 	CollectionInitialized uint32
 	CollectionUnknown     uint32
 	ScopeUnknown          uint32
+	BucketGeneration      uint32
+
+	serverGroupsLock     sync.Mutex
+	serverGroups         *serverGroupTopology
+	serverGroupsFetching bool
+	serverGroupsErr      error
+	serverGroupsFailed   time.Time
 }
 
 type servicesStateBlock struct {
 	n1qlTimeout      time.Duration
 	analyticsTimeout time.Duration
 	searchTimeout    time.Duration
+
+	httpMaxIdleConns        int
+	httpMaxIdleConnsPerHost int
+	httpIdleConnTimeout     time.Duration
+
+	applicationName string
+
+	kvHeartbeatInterval      time.Duration
+	kvHeartbeatTimeout       time.Duration
+	kvDeadConnectionFailures uint
+
+	connectTimeout   time.Duration
+	kvConnectTimeout time.Duration
+
+	overloadBehavior OverloadBehavior
+	overloadMaxWait  time.Duration
+
+	httpRequestCompression        bool
+	httpRequestCompressionMinSize int
+
+	slowConsumerThreshold time.Duration
+
+	idGenerator IDGenerator
+
+	mgmtTimeout time.Duration
+
+	preparedNamePrefix string
+
+	insecureSkipVerify bool
 }
 
 type stateBlock struct {
@@ -47,11 +84,29 @@ type stateBlock struct {
 	N1qlRetryBehavior      RetryBehavior
 	AnalyticsRetryBehavior RetryBehavior
 	SearchRetryBehavior    RetryBehavior
+	MgmtRetryBehavior      RetryBehavior
 
 	N1qlTimeout      func() time.Duration
 	SearchTimeout    func() time.Duration
 	AnalyticsTimeout func() time.Duration
 
+	MetricsRecorder MetricsRecorder
+
+	DocumentCache    DocumentCache
+	DocumentCacheTTL time.Duration
+
+	Migrations *Migrations
+
+	HashLongKeys bool
+	ReadOnly     bool
+	KeyPrefix    string
+	ValidateJSON bool
+
+	ObservabilityName string
+
+	ValueCompression valueCompression
+	KvErrors         *kvErrorHeatmap
+
 	client func(*clientStateBlock) client
 }
 
@@ -63,13 +118,74 @@ func (sb *stateBlock) getCachedClient() client {
 	return sb.cachedClient
 }
 
-// TODO: Is the check here redundant? We should only be changing hash if the bucket
-// is different, which is a new stateblock anyway so does recaching ever
-// make sense?
-func (sb *stateBlock) recacheClient() {
+// stateBlocks are immutable once they are owned by a Cluster, Bucket, Scope or Collection, each of which holds
+// its own copy.  Changes are made through the with* methods which operate on, and return, a copy of the block
+// so that a block is never modified after it may have been shared between goroutines.
+
+// withRecachedClient returns a copy of the block with its client fetched for the current client state.
+func (sb stateBlock) withRecachedClient() stateBlock {
 	if sb.cachedClient != nil && sb.cachedClient.Hash() == sb.Hash() {
-		return
+		return sb
 	}
 
 	sb.cachedClient = sb.client(&sb.clientStateBlock)
+	return sb
+}
+
+func (sb stateBlock) withScope(scopeName string) stateBlock {
+	sb.ScopeName = scopeName
+	return sb.withRecachedClient()
+}
+
+func (sb stateBlock) withCollection(collectionName string) stateBlock {
+	sb.CollectionName = collectionName
+	if sb.KvTimeout == 0 {
+		sb.KvTimeout = 10 * time.Second
+	}
+	if sb.DuraTimeout == 0 {
+		sb.DuraTimeout = 40000 * time.Millisecond
+	}
+	sb.DuraPollTimeout = 100 * time.Millisecond
+	return sb.withRecachedClient()
+}
+
+func (sb stateBlock) withKvTimeout(duration time.Duration) stateBlock {
+	sb.KvTimeout = duration
+	return sb
+}
+
+func (sb stateBlock) withHashLongKeys(hashLongKeys bool) stateBlock {
+	sb.HashLongKeys = hashLongKeys
+	return sb
+}
+
+func (sb stateBlock) withReadOnly(readOnly bool) stateBlock {
+	sb.ReadOnly = readOnly
+	return sb
+}
+
+func (sb stateBlock) withValidateJSON(validateJSON bool) stateBlock {
+	sb.ValidateJSON = validateJSON
+	return sb
+}
+
+func (sb stateBlock) withKeyPrefix(keyPrefix string) stateBlock {
+	sb.KeyPrefix = keyPrefix
+	return sb
+}
+
+func (sb stateBlock) withObservabilityName(name string) stateBlock {
+	sb.ObservabilityName = name
+	return sb
+}
+
+func (sb stateBlock) withDocumentCache(cache DocumentCache, ttl time.Duration) stateBlock {
+	sb.DocumentCache = cache
+	sb.DocumentCacheTTL = ttl
+	return sb
+}
+
+func (sb stateBlock) withMigrations(migrations *Migrations) stateBlock {
+	sb.Migrations = migrations
+	return sb
 }
@@ -0,0 +1,70 @@
+package gocb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/couchbase/gocb/mocktest"
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestStateBlockDerivationDoesNotModifyParent(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(1),
+		Value: []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+
+	derived := col.WithOperationTimeout(time.Millisecond)
+	if derived == col {
+		t.Fatalf("Expected WithOperationTimeout to return a new collection")
+	}
+	if derived.sb.KvTimeout != time.Millisecond {
+		t.Fatalf("Expected derived timeout to be %s but was %s", time.Millisecond, derived.sb.KvTimeout)
+	}
+	if col.sb.KvTimeout != 10*time.Second {
+		t.Fatalf("Expected original timeout to be unchanged but was %s", col.sb.KvTimeout)
+	}
+
+	sb := col.sb
+	scoped := sb.withScope("scope")
+	if sb.ScopeName == "scope" || scoped.ScopeName != "scope" {
+		t.Fatalf("Expected withScope to only modify the returned block")
+	}
+
+	col.SetKvTimeout(time.Second)
+	if col.sb.KvTimeout != time.Second || derived.sb.KvTimeout != time.Millisecond {
+		t.Fatalf("Expected SetKvTimeout to only modify its receiver but timeouts were %s and %s",
+			col.sb.KvTimeout, derived.sb.KvTimeout)
+	}
+}
+
+// This test is only meaningful when run with -race.
+func TestStateBlockConcurrentDerivation(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:   gocbcore.Cas(1),
+		Value: []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			derived := col.WithOperationTimeout(time.Duration(i+1) * time.Second).WithOperationTimeout(time.Second)
+			_, err := derived.Get("key", nil)
+			if err != nil {
+				t.Errorf("Get encountered error: %v", err)
+			}
+
+			_, err = col.Get("key", nil)
+			if err != nil {
+				t.Errorf("Get encountered error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,36 @@
+package gocb
+
+import (
+	"crypto/tls"
+)
+
+// withTLSVerification returns the TLS configuration to use for the connections of this cluster, built from config
+// which comes from the connection string.  Certificate verification is disabled if ClusterOptions.InsecureSkipVerify
+// is set, in which case config is copied so that it is only disabled for this cluster.  A warning is logged, once
+// per cluster, whenever verification is disabled.  It returns nil if config is nil, as TLS is not in use.
+func (c *Cluster) withTLSVerification(config *tls.Config) *tls.Config {
+	if config == nil {
+		return nil
+	}
+
+	if c.ssb.insecureSkipVerify && !config.InsecureSkipVerify {
+		config = config.Clone()
+		config.InsecureSkipVerify = true
+	}
+
+	if config.InsecureSkipVerify {
+		c.insecureWarning.Do(func() {
+			if c.ssb.insecureSkipVerify {
+				logWarnf("TLS certificate verification is DISABLED by ClusterOptions.InsecureSkipVerify, " +
+					"connections to the cluster are not protected against man-in-the-middle attacks, " +
+					"this must only be used for development and test clusters")
+				return
+			}
+			logWarnf("TLS certificate verification is DISABLED as no CA certificate was given with the cacertpath " +
+				"connection string option, connections to the cluster are not protected against man-in-the-middle " +
+				"attacks, set cacertpath to verify the certificates presented by the cluster")
+		})
+	}
+
+	return config
+}
@@ -0,0 +1,50 @@
+package gocb
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestInsecureSkipVerify(t *testing.T) {
+	logger := &recordingLogger{}
+	oldLogger := globalLogger
+	globalLogger = logger
+	defer func() {
+		globalLogger = oldLogger
+	}()
+
+	cluster := &Cluster{}
+	if cluster.withTLSVerification(nil) != nil {
+		t.Fatalf("Expected no TLS config when TLS is not in use")
+	}
+
+	connStrConfig := &tls.Config{ServerName: "cluster"}
+	config := cluster.withTLSVerification(connStrConfig)
+	if config != connStrConfig || config.InsecureSkipVerify {
+		t.Fatalf("Expected TLS config to be used unchanged")
+	}
+	if len(logger.messages) != 0 {
+		t.Fatalf("Expected no warnings when certificates are verified but were %v", logger.messages)
+	}
+
+	cluster.ssb.insecureSkipVerify = true
+	config = cluster.withTLSVerification(connStrConfig)
+	if !config.InsecureSkipVerify || config.ServerName != "cluster" {
+		t.Fatalf("Expected certificate verification to be disabled but config was %+v", config)
+	}
+	if connStrConfig.InsecureSkipVerify {
+		t.Fatalf("Expected the TLS config from the connection string not to be modified")
+	}
+	cluster.withTLSVerification(connStrConfig)
+	if len(logger.messages) != 1 {
+		t.Fatalf("Expected one warning but were %v", logger.messages)
+	}
+
+	// Verification which is disabled as no CA certificate was given is also warned about.
+	logger.messages = nil
+	cluster = &Cluster{}
+	cluster.withTLSVerification(&tls.Config{InsecureSkipVerify: true})
+	if len(logger.messages) != 1 {
+		t.Fatalf("Expected one warning but were %v", logger.messages)
+	}
+}
@@ -2,7 +2,11 @@ package gocb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"gopkg.in/couchbase/gocbcore.v7"
 )
@@ -13,6 +17,87 @@ type MutationToken struct {
 	bucketName string
 }
 
+// String returns the mutation token in the form bucket:vbid:vbuuid:seqno, suitable for round-tripping
+// through HTTP headers or other string based transports.  Use ParseMutationToken to convert it back.
+func (mt MutationToken) String() string {
+	var buf [96]byte
+	b := append(buf[:0], mt.bucketName...)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, uint64(mt.token.VbId), 10)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, uint64(mt.token.VbUuid), 10)
+	b = append(b, ':')
+	b = strconv.AppendUint(b, uint64(mt.token.SeqNo), 10)
+	return string(b)
+}
+
+// ParseMutationToken parses a mutation token from the form returned by MutationToken.String.
+func ParseMutationToken(s string) (MutationToken, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 4 || parts[0] == "" {
+		return MutationToken{}, errors.New("mutation tokens must be in the form bucket:vbid:vbuuid:seqno")
+	}
+
+	vbID, err := strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return MutationToken{}, err
+	}
+
+	vbUUID, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return MutationToken{}, err
+	}
+
+	seqNo, err := strconv.ParseUint(parts[3], 10, 64)
+	if err != nil {
+		return MutationToken{}, err
+	}
+
+	return MutationToken{
+		token: gocbcore.MutationToken{
+			VbId:   uint16(vbID),
+			VbUuid: gocbcore.VbUuid(vbUUID),
+			SeqNo:  gocbcore.SeqNo(seqNo),
+		},
+		bucketName: parts[0],
+	}, nil
+}
+
+type mutationTokenJSON struct {
+	PartitionID    uint16 `json:"partition_id"`
+	PartitionUUID  uint64 `json:"partition_uuid"`
+	SequenceNumber uint64 `json:"sequence_number"`
+	BucketName     string `json:"bucket_name"`
+}
+
+// MarshalJSON marshal's this mutation token to JSON, in the same form used by the other Couchbase SDKs:
+// {"partition_id": 12, "partition_uuid": 1234, "sequence_number": 5, "bucket_name": "default"}.
+func (mt MutationToken) MarshalJSON() ([]byte, error) {
+	return json.Marshal(mutationTokenJSON{
+		PartitionID:    mt.token.VbId,
+		PartitionUUID:  uint64(mt.token.VbUuid),
+		SequenceNumber: uint64(mt.token.SeqNo),
+		BucketName:     mt.bucketName,
+	})
+}
+
+// UnmarshalJSON unmarshal's a mutation token from the JSON form produced by MarshalJSON.
+func (mt *MutationToken) UnmarshalJSON(data []byte) error {
+	var token mutationTokenJSON
+	err := json.Unmarshal(data, &token)
+	if err != nil {
+		return err
+	}
+
+	mt.token = gocbcore.MutationToken{
+		VbId:   token.PartitionID,
+		VbUuid: gocbcore.VbUuid(token.PartitionUUID),
+		SeqNo:  gocbcore.SeqNo(token.SequenceNumber),
+	}
+	mt.bucketName = token.BucketName
+	return nil
+}
+
 type bucketToken struct {
 	SeqNo  uint64 `json:"seqno"`
 	VbUuid string `json:"vbuuid"`
@@ -44,7 +129,8 @@ func NewMutationState(tokens ...MutationToken) *MutationState {
 }
 
 func (mt *MutationState) addSingle(token MutationToken) {
-	if token.bucketName == "" {
+	// Operations return an empty token when mutation tokens are not enabled on the bucket.
+	if token.bucketName == "" || (token.token.VbUuid == 0 && token.token.SeqNo == 0) {
 		return
 	}
 
@@ -77,12 +163,82 @@ func (mt *MutationState) Add(tokens ...MutationToken) {
 	}
 }
 
-// MarshalJSON marshal's this mutation state to JSON.
+// Tokens returns the mutation tokens held by this mutation state, ordered by bucket name and then vbucket id.
+func (mt *MutationState) Tokens() ([]MutationToken, error) {
+	if mt.data == nil {
+		return nil, nil
+	}
+
+	var tokens []MutationToken
+	for bucketName, bucketTokens := range *mt.data {
+		if bucketTokens == nil {
+			continue
+		}
+
+		for vbID, stateToken := range *bucketTokens {
+			vbIDVal, err := strconv.ParseUint(vbID, 10, 16)
+			if err != nil {
+				return nil, err
+			}
+
+			vbUUID, err := strconv.ParseUint(stateToken.VbUuid, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, MutationToken{
+				token: gocbcore.MutationToken{
+					VbId:   uint16(vbIDVal),
+					VbUuid: gocbcore.VbUuid(vbUUID),
+					SeqNo:  gocbcore.SeqNo(stateToken.SeqNo),
+				},
+				bucketName: bucketName,
+			})
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].bucketName != tokens[j].bucketName {
+			return tokens[i].bucketName < tokens[j].bucketName
+		}
+		return tokens[i].token.VbId < tokens[j].token.VbId
+	})
+
+	return tokens, nil
+}
+
+// searchVectors returns the tokens held by this mutation state for bucketName, or for every bucket if it is empty,
+// in the form used for the consistency vectors of the search service, {"vbid/vbuuid": seqno}.  The vectors only
+// identify vbuckets so tokens for other buckets than the one an index is built on must not be included.
+func (mt *MutationState) searchVectors(bucketName string) (map[string]uint64, error) {
+	tokens, err := mt.Tokens()
+	if err != nil {
+		return nil, err
+	}
+
+	vectors := make(map[string]uint64, len(tokens))
+	for _, token := range tokens {
+		if bucketName != "" && token.bucketName != bucketName {
+			continue
+		}
+
+		key := fmt.Sprintf("%d/%d", token.token.VbId, token.token.VbUuid)
+		if seqNo := uint64(token.token.SeqNo); seqNo > vectors[key] {
+			vectors[key] = seqNo
+		}
+	}
+	return vectors, nil
+}
+
+// MarshalJSON marshal's this mutation state to JSON.  The format is the scan vector form understood by the
+// query and search services, and is the same as that exported and imported by the other Couchbase SDKs:
+// {"bucket": {"vbid": [seqno, "vbuuid"]}}, e.g. {"default": {"12": [5, "1234"]}}.
+// The format is stable so mutation states can be safely persisted or passed between services.
 func (mt *MutationState) MarshalJSON() ([]byte, error) {
 	return json.Marshal(mt.data)
 }
 
-// UnmarshalJSON unmarshal's a mutation state from JSON.
+// UnmarshalJSON unmarshal's a mutation state from the JSON form produced by MarshalJSON.
 func (mt *MutationState) UnmarshalJSON(data []byte) error {
 	return json.Unmarshal(data, &mt.data)
 }
@@ -0,0 +1,136 @@
+package gocb
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"gopkg.in/couchbase/gocbcore.v7"
+)
+
+func TestCasStringRoundTrip(t *testing.T) {
+	cas := Cas(1549368823443554304)
+
+	str := cas.String()
+	if str != "1549368823443554304" {
+		t.Fatalf("Expected cas string to be 1549368823443554304 but was %s", str)
+	}
+
+	parsed, err := ParseCas(str)
+	if err != nil {
+		t.Fatalf("Failed to parse cas: %v", err)
+	}
+
+	if parsed != cas {
+		t.Fatalf("Expected parsed cas to be %d but was %d", cas, parsed)
+	}
+
+	_, err = ParseCas("W/\"123\"")
+	if err == nil {
+		t.Fatalf("Expected parsing an invalid cas to fail")
+	}
+}
+
+func TestMutationTokenStringRoundTrip(t *testing.T) {
+	token := MutationToken{
+		token: gocbcore.MutationToken{
+			VbId:   512,
+			VbUuid: 171717171717,
+			SeqNo:  42,
+		},
+		bucketName: "beer-sample",
+	}
+
+	str := token.String()
+	if str != "beer-sample:512:171717171717:42" {
+		t.Fatalf("Unexpected mutation token string: %s", str)
+	}
+
+	parsed, err := ParseMutationToken(str)
+	if err != nil {
+		t.Fatalf("Failed to parse mutation token: %v", err)
+	}
+
+	if parsed != token {
+		t.Fatalf("Expected parsed mutation token to be %v but was %v", token, parsed)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = token.String()
+	})
+	if allocs > 1 {
+		t.Fatalf("Expected formatting a mutation token to allocate at most once but was %v", allocs)
+	}
+
+	for _, invalid := range []string{"", "beer-sample:512:1", ":512:1:42", "beer-sample:70000:1:42"} {
+		_, err = ParseMutationToken(invalid)
+		if err == nil {
+			t.Fatalf("Expected parsing %s to fail", invalid)
+		}
+	}
+}
+
+func TestMutationTokenJSONRoundTrip(t *testing.T) {
+	token := MutationToken{
+		token: gocbcore.MutationToken{
+			VbId:   12,
+			VbUuid: 183838292829,
+			SeqNo:  5,
+		},
+		bucketName: "default",
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		t.Fatalf("Failed to marshal mutation token: %v", err)
+	}
+
+	expected := `{"partition_id":12,"partition_uuid":183838292829,"sequence_number":5,"bucket_name":"default"}`
+	if string(data) != expected {
+		t.Fatalf("Expected mutation token JSON to be %s but was %s", expected, data)
+	}
+
+	var parsed MutationToken
+	err = json.Unmarshal(data, &parsed)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal mutation token: %v", err)
+	}
+
+	if parsed != token {
+		t.Fatalf("Expected unmarshaled mutation token to be %v but was %v", token, parsed)
+	}
+}
+
+func TestMutationStateJSONRoundTrip(t *testing.T) {
+	tokens := []MutationToken{
+		{token: gocbcore.MutationToken{VbId: 1, VbUuid: 1234, SeqNo: 10}, bucketName: "beer-sample"},
+		{token: gocbcore.MutationToken{VbId: 12, VbUuid: 183838292829, SeqNo: 5}, bucketName: "default"},
+		{token: gocbcore.MutationToken{VbId: 1023, VbUuid: 1, SeqNo: 2}, bucketName: "default"},
+	}
+	state := NewMutationState(tokens...)
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Failed to marshal mutation state: %v", err)
+	}
+
+	expected := `{"beer-sample":{"1":[10,"1234"]},"default":{"1023":[2,"1"],"12":[5,"183838292829"]}}`
+	if string(data) != expected {
+		t.Fatalf("Expected mutation state JSON to be %s but was %s", expected, data)
+	}
+
+	var parsed MutationState
+	err = json.Unmarshal(data, &parsed)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal mutation state: %v", err)
+	}
+
+	parsedTokens, err := parsed.Tokens()
+	if err != nil {
+		t.Fatalf("Failed to get tokens from mutation state: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsedTokens, []MutationToken{tokens[0], tokens[1], tokens[2]}) {
+		t.Fatalf("Expected tokens to be %v but were %v", tokens, parsedTokens)
+	}
+}
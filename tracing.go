@@ -1,6 +1,9 @@
 package gocb
 
 import (
+	"context"
+	"math/rand"
+
 	"github.com/opentracing/opentracing-go"
 )
 
@@ -25,3 +28,111 @@ func tracerDecRef(tracer opentracing.Tracer) {
 		refTracer.DecRef()
 	}
 }
+
+// TracingPolicy controls whether spans are created for an individual operation, allowing very high frequency
+// operations to skip the overhead of tracing whilst tracing remains enabled for everything else.  It is set
+// using the Tracing field of the operation options, a nil policy means that the operation is always traced.
+type TracingPolicy interface {
+	shouldTrace() bool
+}
+
+type tracingDisabledPolicy struct{}
+
+func (p tracingDisabledPolicy) shouldTrace() bool {
+	return false
+}
+
+type tracingSampledPolicy struct {
+	rate float64
+}
+
+func (p tracingSampledPolicy) shouldTrace() bool {
+	return rand.Float64() < p.rate
+}
+
+// TracingDisabled returns a TracingPolicy which prevents any spans from being created for an operation.
+func TracingDisabled() TracingPolicy {
+	return tracingDisabledPolicy{}
+}
+
+// TracingSampled returns a TracingPolicy which only traces the given fraction of operations, where rate is
+// between 0 (never trace) and 1 (always trace).
+func TracingSampled(rate float64) TracingPolicy {
+	return tracingSampledPolicy{rate: rate}
+}
+
+// untracedSpanContext is used as the parent of operations which should not be traced, any spans started
+// as children of it are no-ops.
+type untracedSpanContext struct{}
+
+func (sc untracedSpanContext) ForeachBaggageItem(handler func(k, v string) bool) {}
+
+// untracedSpan is a no-op span which propagates untracedSpanContext to its children.
+type untracedSpan struct {
+	opentracing.Span
+}
+
+func (s untracedSpan) Context() opentracing.SpanContext {
+	return untracedSpanContext{}
+}
+
+// sharedUntracedSpan is returned for every untraced operation, it records nothing so it can be shared rather than
+// allocating a span for each one.
+var sharedUntracedSpan opentracing.Span = untracedSpan{opentracing.NoopTracer{}.StartSpan("")}
+
+func newUntracedSpan() opentracing.Span {
+	return sharedUntracedSpan
+}
+
+// tracingEnabled returns whether a tracer has been registered.  When the global tracer is the no-op tracer the
+// spans it starts are discarded, but building their options and tags still allocates, so hot paths skip starting
+// them entirely and treat the operation as untraced.
+func tracingEnabled() bool {
+	_, isNoop := opentracing.GlobalTracer().(opentracing.NoopTracer)
+	return !isNoop
+}
+
+func isUntraced(spanCtx opentracing.SpanContext) bool {
+	_, ok := spanCtx.(untracedSpanContext)
+	return ok
+}
+
+// parentSpanContext returns the span context which an operation's span should be a child of.  An explicit
+// ParentSpanContext option takes precedence, otherwise the span active in ctx (if any) is used so that
+// callers don't need to pass the same span twice.
+func parentSpanContext(ctx context.Context, parentSpanCtx opentracing.SpanContext) opentracing.SpanContext {
+	if parentSpanCtx != nil || ctx == nil {
+		return parentSpanCtx
+	}
+
+	if span := opentracing.SpanFromContext(ctx); span != nil {
+		return span.Context()
+	}
+
+	return nil
+}
+
+// tracingParent returns the span context to use as the parent of an operation given its tracing policy.
+func tracingParent(policy TracingPolicy, parentSpanCtx opentracing.SpanContext) opentracing.SpanContext {
+	if policy == nil || policy.shouldTrace() {
+		return parentSpanCtx
+	}
+
+	return untracedSpanContext{}
+}
+
+// startChildTrace starts a new span for operationName as a ChildOf traceCtx.
+func startChildTrace(traceCtx opentracing.SpanContext, operationName string) opentracing.Span {
+	if isUntraced(traceCtx) || !tracingEnabled() {
+		return newUntracedSpan()
+	}
+
+	return opentracing.GlobalTracer().StartSpan(operationName, opentracing.ChildOf(traceCtx))
+}
+
+// startManagerTrace starts a span for a management operation, named manager_<manager>_<operation> (such as
+// "manager_buckets_create_bucket") so that admin actions can be found in traces alongside data operations.
+func startManagerTrace(manager, operation, service string) opentracing.Span {
+	return opentracing.GlobalTracer().StartSpan("manager_"+manager+"_"+operation,
+		opentracing.Tag{Key: "couchbase.service", Value: service})
+}
@@ -0,0 +1,179 @@
+package gocb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	gocbcore "gopkg.in/couchbase/gocbcore.v7"
+
+	"github.com/couchbase/gocb/mocktest"
+)
+
+func TestTracingPolicy(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	_, err := col.Get("traced", &GetOptions{Tracing: TracingDisabled()})
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	_, err = col.Insert("traced", []byte(`{}`), &InsertOptions{Tracing: TracingSampled(0)})
+	if err != nil {
+		t.Fatalf("Insert failed, error was %v", err)
+	}
+
+	if len(tracer.FinishedSpans()) != 0 {
+		t.Fatalf("Expected no spans to be created for untraced operations but had %d", len(tracer.FinishedSpans()))
+	}
+
+	_, err = col.Get("traced", &GetOptions{Tracing: TracingSampled(1)})
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+
+	if len(tracer.FinishedSpans()) == 0 {
+		t.Fatalf("Expected spans to be created for traced operations")
+	}
+}
+
+func TestTracingParentFromContext(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	parent := tracer.StartSpan("parent")
+	ctx := opentracing.ContextWithSpan(context.Background(), parent)
+
+	_, err := col.Get("traced", &GetOptions{Context: ctx})
+	if err != nil {
+		t.Fatalf("Get failed, error was %v", err)
+	}
+	parent.Finish()
+
+	parentID := parent.Context().(mocktracer.MockSpanContext).SpanID
+	var found bool
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == "Get" {
+			found = true
+			if span.ParentID != parentID {
+				t.Fatalf("Expected Get span to be a child of the context span")
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("Expected a Get span to be created")
+	}
+
+	explicit := tracer.StartSpan("explicit")
+	explicitID := explicit.Context().(mocktracer.MockSpanContext).SpanID
+	if parentSpanContext(ctx, explicit.Context()).(mocktracer.MockSpanContext).SpanID != explicitID {
+		t.Fatalf("Expected an explicit parent span context to take precedence over the context span")
+	}
+
+	if parentSpanContext(context.Background(), nil) != nil {
+		t.Fatalf("Expected no parent span context without a context span")
+	}
+}
+
+func TestManagerTracing(t *testing.T) {
+	tracer := mocktracer.New()
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(tracer)
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	var queryParent opentracing.SpanContext
+	qm := &QueryIndexManager{
+		ExecuteQuery: func(s string, opts *QueryOptions) (*QueryResults, error) {
+			queryParent = opts.ParentSpanContext
+			return &QueryResults{index: -1}, nil
+		},
+	}
+
+	err := qm.CreateIndex("default", "idx", []string{"name"}, false, false)
+	if err != nil {
+		t.Fatalf("CreateIndex failed, error was %v", err)
+	}
+
+	bm := &BucketManager{
+		httpClient: &mockHTTPProvider{
+			doFn: func(req *gocbcore.HttpRequest) (*gocbcore.HttpResponse, error) {
+				return &gocbcore.HttpResponse{StatusCode: 200, Body: &testReadCloser{bytes.NewBufferString(""), nil}}, nil
+			},
+		},
+	}
+
+	err = bm.RemoveBucket("default")
+	if err != nil {
+		t.Fatalf("RemoveBucket failed, error was %v", err)
+	}
+
+	spans := tracer.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans but had %d", len(spans))
+	}
+
+	if spans[0].OperationName != "manager_query_create_index" {
+		t.Fatalf("Unexpected span name %s", spans[0].OperationName)
+	}
+	if spans[0].Tag("couchbase.service") != "n1ql" {
+		t.Fatalf("Unexpected service tag %v", spans[0].Tag("couchbase.service"))
+	}
+	if queryParent.(mocktracer.MockSpanContext).SpanID != spans[0].SpanContext.SpanID {
+		t.Fatalf("Expected the index query to be a child of the manager span")
+	}
+
+	if spans[1].OperationName != "manager_buckets_drop_bucket" {
+		t.Fatalf("Unexpected span name %s", spans[1].OperationName)
+	}
+}
+
+func TestNoopTracerSkipsSpans(t *testing.T) {
+	provider := &mocktest.KvOperator{
+		Cas:      gocbcore.Cas(1),
+		Datatype: 1,
+		Value:    []byte(`{}`),
+	}
+	col := testGetCollection(t, provider)
+
+	oldTracer := opentracing.GlobalTracer()
+	opentracing.SetGlobalTracer(opentracing.NoopTracer{})
+	defer opentracing.SetGlobalTracer(oldTracer)
+
+	span := col.startKvOpTrace(nil, "Get")
+	if !isUntraced(span.Context()) {
+		t.Fatalf("Expected operations to be untraced when no tracer is registered")
+	}
+	if col.kvTraceContext(span.Context(), "get") != nil {
+		t.Fatalf("Expected no trace context to be passed to gocbcore when no tracer is registered")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		span := col.startKvOpTrace(nil, "Get")
+		startChildTrace(span.Context(), "encoding").Finish()
+		span.Finish()
+	})
+	if allocs != 0 {
+		t.Fatalf("Expected starting untraced spans not to allocate but had %v allocations", allocs)
+	}
+}
@@ -2,7 +2,9 @@ package gocb
 
 import (
 	"encoding/json"
+	"unicode/utf8"
 
+	"github.com/pkg/errors"
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
@@ -89,3 +91,41 @@ func DefaultEncode(value interface{}) ([]byte, uint32, error) {
 
 	return bytes, flags, nil
 }
+
+// RawEncode returns an Encode which stores []byte and string values unchanged with the given flags, allowing a
+// document to be written with exactly the flags which another SDK, or an earlier read, used.
+func RawEncode(flags uint32) Encode {
+	return func(value interface{}) ([]byte, uint32, error) {
+		switch typedValue := value.(type) {
+		case []byte:
+			return typedValue, flags, nil
+		case string:
+			return []byte(typedValue), flags, nil
+		default:
+			return nil, 0, errors.Wrapf(ErrInvalidArgument, "raw values must be []byte or string, not %T", value)
+		}
+	}
+}
+
+// validateValue checks that value is valid UTF-8 JSON if flags mark it as JSON and validation is enabled, either
+// for the operation or for the collection.
+func (c *Collection) validateValue(value []byte, flags uint32, validate bool) error {
+	if !validate && !c.sb.ValidateJSON {
+		return nil
+	}
+
+	valueType, _ := gocbcore.DecodeCommonFlags(flags)
+	if valueType != gocbcore.JsonType {
+		return nil
+	}
+
+	// The JSON decoder accepts invalid UTF-8 within strings, replacing it when decoding.
+	if !utf8.Valid(value) {
+		return errors.Wrap(ErrInvalidValue, "value is not valid UTF-8")
+	}
+	if !json.Valid(value) {
+		return errors.Wrap(ErrInvalidValue, "value is not valid JSON")
+	}
+
+	return nil
+}
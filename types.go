@@ -1,8 +1,25 @@
 package gocb
 
 import (
+	"strconv"
+
 	"gopkg.in/couchbase/gocbcore.v7"
 )
 
 type Cas gocbcore.Cas
 type pendingOp gocbcore.PendingOp
+
+// String returns the decimal string form of the cas, suitable for use in ETags or HTTP headers.
+func (c Cas) String() string {
+	return strconv.FormatUint(uint64(c), 10)
+}
+
+// ParseCas parses a cas from the decimal string form returned by Cas.String.
+func ParseCas(s string) (Cas, error) {
+	cas, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return Cas(cas), nil
+}
@@ -1,6 +1,7 @@
 package gocb
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
@@ -77,8 +78,27 @@ func (trc *testReadCloser) Close() error {
 	return trc.closeErr
 }
 
+// testBufferReadCloser records whether it has been closed, and how much of it is left unread.
+type testBufferReadCloser struct {
+	*bytes.Buffer
+	closed bool
+}
+
+func (tbrc *testBufferReadCloser) Close() error {
+	tbrc.closed = true
+	return nil
+}
+
 // Not a test, just gets a collection instance.
-func testGetCollection(t *testing.T, provider *mockKvOperator) *Collection {
+func testGetCollection(t *testing.T, provider kvProvider) *Collection {
+	col, err := testGetBucket(provider).DefaultCollection(nil)
+	if err != nil {
+		t.Fatalf("Opening collection encountered error: %v", err)
+	}
+	return col
+}
+
+func testGetBucket(provider kvProvider) *Bucket {
 	clients := make(map[string]client)
 	clients["mock-false"] = &mockClient{
 		bucketName:        "mock",
@@ -102,9 +122,5 @@ func testGetCollection(t *testing.T, provider *mockKvOperator) *Collection {
 			SearchTimeout:    c.searchTimeout,
 		},
 	}
-	col, err := b.DefaultCollection(nil)
-	if err != nil {
-		t.Fatalf("Opening collection encountered error: %v", err)
-	}
-	return col
+	return b
 }
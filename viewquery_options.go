@@ -11,18 +11,6 @@ import (
 	"github.com/pkg/errors"
 )
 
-// StaleMode specifies the consistency required for a view query.
-type StaleMode int
-
-const (
-	// Before indicates to update the index before querying it.
-	Before = StaleMode(1)
-	// None indicates that no special behaviour should be used.
-	None = StaleMode(2)
-	// After indicates to update the index asynchronously after querying.
-	After = StaleMode(3)
-)
-
 // SortOrder specifies the ordering for the view queries results.
 type SortOrder int
 
@@ -33,25 +21,49 @@ const (
 	Descending = SortOrder(2)
 )
 
-// Range specifies a value range to get results between.
-type Range struct {
-	Start        interface{}
-	End          interface{}
-	InclusiveEnd bool
+// ViewScanConsistency specifies the consistency required for a view query.
+type ViewScanConsistency int
+
+const (
+	// ViewScanConsistencyNotBounded indicates that the index should be queried as it is, without updating it.
+	ViewScanConsistencyNotBounded = ViewScanConsistency(1)
+	// ViewScanConsistencyRequestPlus indicates that the index should be updated before it is queried.
+	ViewScanConsistencyRequestPlus = ViewScanConsistency(2)
+	// ViewScanConsistencyUpdateAfter indicates that the index should be updated asynchronously after it is queried.
+	ViewScanConsistencyUpdateAfter = ViewScanConsistency(3)
+)
+
+// staleValue returns the value of the stale parameter of view queries for the scan consistency.
+func (consistency ViewScanConsistency) staleValue() (string, error) {
+	switch consistency {
+	case ViewScanConsistencyRequestPlus:
+		return "false", nil
+	case ViewScanConsistencyNotBounded:
+		return "ok", nil
+	case ViewScanConsistencyUpdateAfter:
+		return "update_after", nil
+	}
+	return "", errors.New("Unexpected scan consistency option")
 }
 
 // ViewOptions represents the options available when executing view query.
 type ViewOptions struct {
-	Stale             StaleMode
-	Skip              uint
-	Limit             uint
-	Order             SortOrder
-	Reduce            bool
-	Group             bool
-	GroupLevel        uint
-	Key               interface{}
-	Keys              []interface{}
-	Range             *Range
+	ScanConsistency ViewScanConsistency
+	Skip            uint
+	Limit           uint
+	Order           SortOrder
+	Reduce          bool
+	Group           bool
+	GroupLevel      uint
+	// Key and Keys are JSON encoded before being sent, so should be given as the
+	// value emitted by the view rather than as a pre-encoded string.
+	Key  interface{}
+	Keys []interface{}
+	// StartKey and EndKey restrict the results to the given range of emitted keys,
+	// they are JSON encoded in the same way as Key.
+	StartKey          interface{}
+	EndKey            interface{}
+	InclusiveEnd      bool
 	IDRangeStart      string
 	IDRangeEnd        string
 	Development       bool
@@ -63,16 +75,12 @@ type ViewOptions struct {
 func (opts *ViewOptions) toURLValues() (*url.Values, error) {
 	options := &url.Values{}
 
-	if opts.Stale != 0 {
-		if opts.Stale == Before {
-			options.Set("stale", "false")
-		} else if opts.Stale == None {
-			options.Set("stale", "ok")
-		} else if opts.Stale == After {
-			options.Set("stale", "update_after")
-		} else {
-			return nil, errors.New("Unexpected stale option")
+	if opts.ScanConsistency != 0 {
+		stale, err := opts.ScanConsistency.staleValue()
+		if err != nil {
+			return nil, err
 		}
+		options.Set("stale", stale)
 	}
 
 	if opts.Skip != 0 {
@@ -124,35 +132,27 @@ func (opts *ViewOptions) toURLValues() (*url.Values, error) {
 		options.Set("keys", string(jsonKeys))
 	}
 
-	if opts.Range != nil {
-		if opts.Range.Start != nil {
-			jsonStartKey, err := opts.marshalJson(opts.Range.Start)
-			if err != nil {
-				return nil, err
-			}
-			options.Set("startkey", string(jsonStartKey))
-		} else {
-			options.Del("startkey")
+	if opts.StartKey != nil {
+		jsonStartKey, err := opts.marshalJson(opts.StartKey)
+		if err != nil {
+			return nil, err
 		}
+		options.Set("startkey", string(jsonStartKey))
+	}
 
-		if opts.Range.End != nil {
-			jsonEndKey, err := opts.marshalJson(opts.Range.End)
-			if err != nil {
-				return nil, err
-			}
-			options.Set("endkey", string(jsonEndKey))
-		} else {
-			options.Del("endkey")
+	if opts.EndKey != nil {
+		jsonEndKey, err := opts.marshalJson(opts.EndKey)
+		if err != nil {
+			return nil, err
 		}
+		options.Set("endkey", string(jsonEndKey))
+	}
 
-		if opts.Range.Start != nil || opts.Range.End != nil {
-			if opts.Range.InclusiveEnd {
-				options.Set("inclusive_end", "true")
-			} else {
-				options.Set("inclusive_end", "false")
-			}
+	if opts.StartKey != nil || opts.EndKey != nil {
+		if opts.InclusiveEnd {
+			options.Set("inclusive_end", "true")
 		} else {
-			options.Del("inclusive_end")
+			options.Set("inclusive_end", "false")
 		}
 	}
 
@@ -185,5 +185,7 @@ func (opts *ViewOptions) marshalJson(value interface{}) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+
+	// Encode always terminates the value with a newline, which must not end up in the query string.
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
 }
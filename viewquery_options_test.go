@@ -14,9 +14,9 @@ func TestViewQueryOptionsToURLValues(t *testing.T) {
 
 		optValues, err := opts.toURLValues()
 
-		if opts.Stale > After || opts.Stale < 0 {
+		if opts.ScanConsistency > ViewScanConsistencyUpdateAfter || opts.ScanConsistency < 0 {
 			if err == nil {
-				t.Fatalf("Expected an error for invalid stale value")
+				t.Fatalf("Expected an error for invalid scan consistency value")
 			} else {
 				continue
 			}
@@ -34,13 +34,13 @@ func TestViewQueryOptionsToURLValues(t *testing.T) {
 			t.Fatalf("Expected no error but was %v", err)
 		}
 
-		if opts.Stale == 0 {
+		if opts.ScanConsistency == 0 {
 			testAssertViewOption(t, "", "stale", optValues)
-		} else if opts.Stale == Before {
+		} else if opts.ScanConsistency == ViewScanConsistencyRequestPlus {
 			testAssertViewOption(t, "false", "stale", optValues)
-		} else if opts.Stale == None {
+		} else if opts.ScanConsistency == ViewScanConsistencyNotBounded {
 			testAssertViewOption(t, "ok", "stale", optValues)
-		} else if opts.Stale == After {
+		} else if opts.ScanConsistency == ViewScanConsistencyUpdateAfter {
 			testAssertViewOption(t, "update_after", "stale", optValues)
 		}
 
@@ -87,13 +87,33 @@ func TestViewQueryOptionsToURLValues(t *testing.T) {
 		if opts.Key == nil {
 			testAssertViewOption(t, "", "key", optValues)
 		} else {
-			testAssertViewOption(t, "[\"key1\"]\n", "key", optValues)
+			testAssertViewOption(t, "[\"key1\"]", "key", optValues)
 		}
 
 		if len(opts.Keys) == 0 {
 			testAssertViewOption(t, "", "keys", optValues)
 		} else {
-			testAssertViewOption(t, "[\"key2\",\"key3\",{\"key\":\"key4\"}]\n", "keys", optValues)
+			testAssertViewOption(t, "[\"key2\",\"key3\",{\"key\":\"key4\"}]", "keys", optValues)
+		}
+
+		if opts.StartKey == nil {
+			testAssertViewOption(t, "", "startkey", optValues)
+		} else {
+			testAssertViewOption(t, "\"keystart\"", "startkey", optValues)
+		}
+
+		if opts.EndKey == nil {
+			testAssertViewOption(t, "", "endkey", optValues)
+		} else {
+			testAssertViewOption(t, "[\"keyend\",{}]", "endkey", optValues)
+		}
+
+		if opts.StartKey == nil && opts.EndKey == nil {
+			testAssertViewOption(t, "", "inclusive_end", optValues)
+		} else if opts.InclusiveEnd {
+			testAssertViewOption(t, "true", "inclusive_end", optValues)
+		} else {
+			testAssertViewOption(t, "false", "inclusive_end", optValues)
 		}
 	}
 }
@@ -111,13 +131,13 @@ func testCreateViewQueryOptions(seed int64) *ViewOptions {
 
 	randVal := rand.Intn(6)
 	if randVal == 1 {
-		opts.Stale = Before
+		opts.ScanConsistency = ViewScanConsistencyRequestPlus
 	} else if randVal == 2 {
-		opts.Stale = None
+		opts.ScanConsistency = ViewScanConsistencyNotBounded
 	} else if randVal == 3 {
-		opts.Stale = After
+		opts.ScanConsistency = ViewScanConsistencyUpdateAfter
 	} else if randVal == 4 {
-		opts.Stale = 5
+		opts.ScanConsistency = 5
 	}
 
 	randVal = rand.Intn(2)
@@ -168,24 +188,17 @@ func testCreateViewQueryOptions(seed int64) *ViewOptions {
 
 	randVal = rand.Intn(2)
 	if randVal == 1 {
-		r := &Range{}
-
-		randVal = rand.Intn(2)
-		if randVal == 1 {
-			r.Start = "keystart"
-		}
+		opts.StartKey = "keystart"
+	}
 
-		randVal = rand.Intn(2)
-		if randVal == 1 {
-			r.End = "keyend"
-		}
+	randVal = rand.Intn(2)
+	if randVal == 1 {
+		opts.EndKey = []interface{}{"keyend", struct{}{}}
+	}
 
-		randVal = rand.Intn(3)
-		if randVal == 1 {
-			r.InclusiveEnd = true
-		} else if randVal == 2 {
-			r.InclusiveEnd = false
-		}
+	randVal = rand.Intn(2)
+	if randVal == 1 {
+		opts.InclusiveEnd = true
 	}
 
 	randVal = rand.Intn(2)